@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/ngocp/user-tracker/internal/migration"
@@ -24,8 +29,12 @@ func main() {
 	migrationsPath := filepath.Join(projectRoot, "database", "migrations")
 
 	// Parse command line flags
-	command := flag.String("command", "up", "Migration command: up, down, version, or to")
+	command := flag.String("command", "up", "Migration command: up, down, version, to, force, or backfill")
 	version := flag.Uint("version", 0, "Target version for 'to' command")
+	name := flag.String("name", "", "Backfill to run for 'backfill' command")
+	batchSize := flag.Int("batch-size", 1000, "Rows per batch for 'backfill' command")
+	throttle := flag.Duration("throttle", 100*time.Millisecond, "Pause between batches for 'backfill' command")
+	maxBatches := flag.Int("max-batches", 0, "Stop 'backfill' after this many batches (0 runs to completion)")
 	flag.Parse()
 
 	switch *command {
@@ -75,8 +84,28 @@ func main() {
 		}
 		log.Printf("Forced version to %d successfully", *version)
 
+	case "backfill":
+		backfill, ok := migration.Backfills[*name]
+		if !ok {
+			log.Fatalf("Unknown backfill %q. Use -name with one of: %s", *name, strings.Join(migration.BackfillNames(), ", "))
+		}
+		// Stop between batches on interrupt; completed batches stay committed
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		log.Printf("Running backfill %s: %s", backfill.Name, backfill.Description)
+		rows, err := migration.RunBackfill(ctx, databaseURL, backfill, migration.BackfillConfig{
+			BatchSize:  *batchSize,
+			Throttle:   *throttle,
+			MaxBatches: *maxBatches,
+		})
+		if err != nil {
+			log.Fatalf("Backfill failed after %d rows: %v", rows, err)
+		}
+		log.Printf("Backfill updated %d rows", rows)
+
 	default:
-		log.Fatalf("Unknown command: %s. Use: up, down, version, to, or force", *command)
+		log.Fatalf("Unknown command: %s. Use: up, down, version, to, force, or backfill", *command)
 	}
 }
 
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/ngocp/user-tracker/internal/queue"
+)
+
+// queuectl inspects the dead-letter streams and moves messages back onto the event
+// stream, e.g. once the database is back after an outage. It reads the queue settings
+// the server uses from the environment or .env.
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	command := flag.String("command", "list", "Dead-letter command: list, dump, or requeue")
+	sessionID := flag.String("session", "", "Only messages of this session ID")
+	from := flag.String("from", "", "Only messages dead-lettered at or after this time (RFC3339)")
+	to := flag.String("to", "", "Only messages dead-lettered at or before this time (RFC3339)")
+	limit := flag.Int("limit", 100, "Maximum number of messages (0 for all)")
+	dryRun := flag.Bool("dry-run", false, "With 'requeue', only list the messages that would be requeued")
+	flag.Parse()
+
+	filter := queue.DeadLetterFilter{SessionID: *sessionID}
+	var err error
+	if filter.From, err = parseTime(*from); err != nil {
+		log.Fatalf("Invalid -from: %v", err)
+	}
+	if filter.To, err = parseTime(*to); err != nil {
+		log.Fatalf("Invalid -to: %v", err)
+	}
+
+	redisClient, err := queue.NewRedisClient(queue.RedisConfig{
+		URL:         getEnv("REDIS_URL", "redis://localhost:6379/0"),
+		MaxRetries:  getEnvAsInt("REDIS_MAX_RETRIES", 3),
+		PoolSize:    2,
+		MinIdleConn: 1,
+	})
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+	defer redisClient.Close()
+
+	eventQueue := queue.NewEventQueue(redisClient, queue.QueueConfig{
+		StreamKey:     getEnv("QUEUE_STREAM_KEY", queue.DefaultStreamKey),
+		ConsumerGroup: getEnv("QUEUE_CONSUMER_GROUP", queue.DefaultConsumerGroup),
+		MaxLen:        int64(getEnvAsInt("QUEUE_MAX_LEN", queue.DefaultMaxLen)),
+		ShardCount:    getEnvAsInt("QUEUE_SHARD_COUNT", 1),
+		TrimMode:      getEnv("QUEUE_TRIM_MODE", queue.TrimMaxLen),
+		MaxAge:        getEnvAsDuration("QUEUE_TRIM_MAX_AGE", queue.DefaultMaxAge),
+		// Requeued messages are compressed like the server would
+		Compression:      getEnv("QUEUE_COMPRESSION", queue.CompressionNone),
+		CompressMinBytes: getEnvAsInt("QUEUE_COMPRESS_MIN_BYTES", queue.DefaultCompressMinBytes),
+		// Dead letters of the priority lane are only listed and requeued when it is set
+		PriorityTypes: strings.Split(getEnv("QUEUE_PRIORITY_TYPES", ""), ","),
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	letters, err := eventQueue.ListDeadLetters(ctx, filter, *limit)
+	if err != nil {
+		log.Fatalf("Failed to read dead letters: %v", err)
+	}
+
+	switch *command {
+	case "list":
+		printSummary(letters)
+		log.Printf("%d dead letters", len(letters))
+
+	case "dump":
+		encoder := json.NewEncoder(os.Stdout)
+		for _, letter := range letters {
+			if err := encoder.Encode(letter); err != nil {
+				log.Fatalf("Failed to write dead letter: %v", err)
+			}
+		}
+
+	case "requeue":
+		if *dryRun {
+			printSummary(letters)
+			log.Printf("Would requeue %d dead letters", len(letters))
+			return
+		}
+		requeued, err := eventQueue.Requeue(ctx, letters)
+		if err != nil {
+			log.Fatalf("Requeued %d of %d dead letters: %v", requeued, len(letters), err)
+		}
+		log.Printf("Requeued %d dead letters", requeued)
+
+	default:
+		log.Fatalf("Unknown command: %s. Use: list, dump, or requeue", *command)
+	}
+}
+
+// printSummary prints one line per dead letter
+func printSummary(letters []queue.DeadLetter) {
+	for _, letter := range letters {
+		requestID := letter.QueuedEvent.RequestID
+		if requestID == "" {
+			requestID = "-"
+		}
+		fmt.Printf("%s\t%s\t%s\tsession=%s\trequest=%s\tevents=%d\terror=%s\n",
+			letter.Stream, letter.ID, letter.FailedAt, letter.QueuedEvent.SessionID, requestID,
+			len(letter.QueuedEvent.Events), letter.Error)
+	}
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvAsInt(key string, defaultValue int) int {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.Atoi(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr := getEnv(key, "")
+	if value, err := time.ParseDuration(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
@@ -8,17 +8,50 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/joho/godotenv"
+	"github.com/ngocp/user-tracker/internal/accesstoken"
+	"github.com/ngocp/user-tracker/internal/alerts"
+	"github.com/ngocp/user-tracker/internal/apikey"
+	"github.com/ngocp/user-tracker/internal/archive"
+	"github.com/ngocp/user-tracker/internal/assets"
+	"github.com/ngocp/user-tracker/internal/canary"
+	"github.com/ngocp/user-tracker/internal/catalog"
+	"github.com/ngocp/user-tracker/internal/cdc"
+	"github.com/ngocp/user-tracker/internal/cron"
+	"github.com/ngocp/user-tracker/internal/drain"
+	"github.com/ngocp/user-tracker/internal/encrypt"
+	"github.com/ngocp/user-tracker/internal/exporter"
 	"github.com/ngocp/user-tracker/internal/handlers"
+	handlersv2 "github.com/ngocp/user-tracker/internal/handlers/v2"
+	"github.com/ngocp/user-tracker/internal/imagecheck"
+	"github.com/ngocp/user-tracker/internal/importer"
+	"github.com/ngocp/user-tracker/internal/issues"
+	"github.com/ngocp/user-tracker/internal/jobs"
+	"github.com/ngocp/user-tracker/internal/liveness"
+	"github.com/ngocp/user-tracker/internal/logpolicy"
+	"github.com/ngocp/user-tracker/internal/malware"
 	"github.com/ngocp/user-tracker/internal/middleware"
 	"github.com/ngocp/user-tracker/internal/migration"
+	"github.com/ngocp/user-tracker/internal/models"
 	"github.com/ngocp/user-tracker/internal/queue"
 	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/retention"
+	"github.com/ngocp/user-tracker/internal/sessioncheck"
+	"github.com/ngocp/user-tracker/internal/shaping"
+	"github.com/ngocp/user-tracker/internal/stats"
+	"github.com/ngocp/user-tracker/internal/storage"
+	"github.com/ngocp/user-tracker/internal/trackertoken"
+	"github.com/ngocp/user-tracker/internal/urlgroup"
+	"github.com/ngocp/user-tracker/internal/validation"
+	"github.com/ngocp/user-tracker/internal/visibility"
+	"github.com/ngocp/user-tracker/internal/warehouse"
+	"github.com/ngocp/user-tracker/internal/watchlist"
 )
 
 func main() {
@@ -47,21 +80,34 @@ func main() {
 	// The CORS middleware will automatically add "null" if not present, but including it here for clarity
 	corsOrigins := getEnv("CORS_ORIGINS", "http://localhost:3000,http://localhost:3009,http://127.0.0.1:8000,http://localhost:8000")
 	autoMigrate := getEnv("AUTO_MIGRATE", "false") == "true"
+	migrateFailFast := getEnv("AUTO_MIGRATE_REQUIRED", "false") == "true"
+	migrateLockTimeout := getEnvAsDuration("AUTO_MIGRATE_LOCK_TIMEOUT", 2*time.Minute)
+
+	// With prefork every child process runs its own workers; give each its own consumer names
+	prefork := getEnv("SERVER_PREFORK", "false") == "true"
+	consumerPrefix := getEnv("QUEUE_CONSUMER_PREFIX", "")
+	if prefork {
+		consumerPrefix = strings.TrimPrefix(fmt.Sprintf("%s-%d", consumerPrefix, os.Getpid()), "-")
+	}
 
 	log.Printf("[DEBUG] Configuration - PORT: %s, HOST: %s", port, host)
 	log.Printf("[DEBUG] Configuration - DATABASE_URL: %s", databaseURL)
 	log.Printf("[DEBUG] Configuration - CORS_ORIGINS: %s", corsOrigins)
-	log.Printf("[DEBUG] Configuration - AUTO_MIGRATE: %v", autoMigrate)
+	log.Printf("[DEBUG] Configuration - AUTO_MIGRATE: %v (required: %v, lock timeout: %v)", autoMigrate, migrateFailFast, migrateLockTimeout)
+
+	log.Printf("[DEBUG] Getting project root for migrations...")
+	projectRoot := getProjectRoot()
+	log.Printf("[DEBUG] Project root: %s", projectRoot)
+	migrationsPath := filepath.Join(projectRoot, "database", "migrations")
+	log.Printf("[DEBUG] Migrations path: %s", migrationsPath)
 
 	// Run migrations if AUTO_MIGRATE is enabled
 	if autoMigrate {
 		log.Println("AUTO_MIGRATE is enabled, running migrations...")
-		log.Printf("[DEBUG] Getting project root for migrations...")
-		projectRoot := getProjectRoot()
-		log.Printf("[DEBUG] Project root: %s", projectRoot)
-		migrationsPath := filepath.Join(projectRoot, "database", "migrations")
-		log.Printf("[DEBUG] Migrations path: %s", migrationsPath)
-		if err := migration.RunMigrations(databaseURL, migrationsPath); err != nil {
+		if err := migration.RunMigrationsLocked(databaseURL, migrationsPath, migrateLockTimeout); err != nil {
+			if migrateFailFast {
+				log.Fatalf("Migration failed: %v", err)
+			}
 			log.Printf("Warning: Migration failed (server will continue): %v", err)
 			log.Printf("[DEBUG] Migration error details: %v", err)
 		} else {
@@ -69,6 +115,35 @@ func main() {
 		}
 	}
 
+	// Warn when the schema does not match the migrations this server ships with
+	migrationStatus := migration.NewStatusChecker(databaseURL, migrationsPath)
+	if status, err := migrationStatus.Status(); err != nil {
+		log.Printf("Warning: Could not check migration status: %v", err)
+	} else if status.Dirty {
+		log.Printf("Warning: Database schema version %d is dirty; a migration failed part-way", status.Version)
+	} else if status.Behind {
+		log.Printf("Warning: Server expects schema version %d but database is at %d (%d pending migrations)",
+			status.Latest, status.Version, len(status.Pending))
+	} else if status.Ahead {
+		log.Printf("Warning: Database schema version %d is not known to this server (latest %d)", status.Version, status.Latest)
+	}
+
+	// Verify the tables, columns, types and indexes the repositories depend on before
+	// serving traffic. SCHEMA_CHECK: fail (exit with the report), warn or off
+	if schemaCheck := getEnv("SCHEMA_CHECK", "fail"); schemaCheck != "off" {
+		schemaCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		report, err := migration.CheckSchema(schemaCtx, databaseURL, migration.RequiredSchema)
+		cancel()
+		if err != nil {
+			log.Printf("Warning: Could not check schema: %v", err)
+		} else if !report.OK() {
+			if schemaCheck == "fail" {
+				log.Fatalf("Database schema is not compatible with this server: %s", report)
+			}
+			log.Printf("Warning: %s", report)
+		}
+	}
+
 	// Initialize database
 	log.Printf("[DEBUG] Initializing database connection...")
 	log.Printf("[DEBUG] Database URL: %s", databaseURL)
@@ -107,39 +182,175 @@ func main() {
 	log.Println("Successfully connected to Redis")
 	log.Printf("[DEBUG] Redis connection established")
 
+	// Initialize blob storage (optional)
+	blobStore, err := storage.New(storageConfigFromEnv())
+	if err != nil {
+		log.Fatalf("Failed to initialize blob storage: %v", err)
+	}
+	if blobStore != nil {
+		log.Printf("Blob storage enabled: %s", getEnv("BLOB_STORAGE", ""))
+	}
+
+	imageLimits := imagecheck.DefaultLimits
+	imageLimits.MaxBytes = map[string]int{
+		"png":  getEnvAsInt("MAX_SCREENSHOT_SIZE_PNG", imagecheck.DefaultLimits.MaxBytes["png"]),
+		"jpeg": getEnvAsInt("MAX_SCREENSHOT_SIZE_JPEG", imagecheck.DefaultLimits.MaxBytes["jpeg"]),
+	}
+
+	// Optional malware scanning of uploads; infected files are quarantined in blob storage
+	scanner, err := malware.NewScanner(malware.Config{
+		Backend: getEnv("MALWARE_SCANNER", ""),
+		Address: getEnv("MALWARE_SCANNER_ADDRESS", ""),
+		APIKey:  getEnv("MALWARE_SCANNER_API_KEY", ""),
+		Timeout: getEnvAsDuration("MALWARE_SCAN_TIMEOUT", 10*time.Second),
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize malware scanner: %v", err)
+	}
+	scanGuard := malware.NewGuard(scanner, getEnv("MALWARE_SCAN_FAIL_OPEN", "false") == "true", blobStore, getEnv("MALWARE_QUARANTINE_PREFIX", "quarantine"))
+	if scanGuard != nil {
+		log.Printf("Malware scanning enabled: %s", getEnv("MALWARE_SCANNER", ""))
+	}
+
 	// Initialize repositories
 	log.Printf("[DEBUG] Initializing repositories...")
 	sessionRepo := repository.NewSessionRepository(db)
 	eventRepo := repository.NewEventRepository(db)
-	screenshotRepo := repository.NewScreenshotRepository(db)
+	screenshotRepo := repository.NewScreenshotRepository(db, blobStore, imageLimits, scanGuard)
+	issueRepo := repository.NewIssueRepository(db)
+	markerRepo := repository.NewMarkerRepository(db)
+	analyticsRepo := repository.NewAnalyticsRepository(db)
+	importRepo := repository.NewImportRepository(db)
+	exportRepo := repository.NewExportRepository(db)
+	exportScheduleRepo := repository.NewExportScheduleRepository(db)
+	jobRepo := repository.NewJobRepository(db)
+	ingestStatsRepo := repository.NewIngestStatsRepository(db)
 	log.Printf("[DEBUG] Repositories initialized")
 
 	// Initialize event queue
 	log.Printf("[DEBUG] Initializing event queue...")
+	queueBackend := getEnv("QUEUE_BACKEND", queue.BackendRedis)
+	if err := queue.CheckBackend(queueBackend); err != nil {
+		log.Fatalf("Invalid QUEUE_BACKEND: %v", err)
+	}
 	queueMaxRetries := getEnvAsInt("REDIS_MAX_RETRIES", 3)
-	eventQueue := queue.NewEventQueue(redisClient, queueMaxRetries)
-	log.Printf("[DEBUG] Event queue initialized with max retries: %d", queueMaxRetries)
+	queueMaxLen := getEnvAsInt("QUEUE_MAX_LEN", queue.DefaultMaxLen)
+	queueTrimMode := getEnv("QUEUE_TRIM_MODE", queue.TrimMaxLen)
+	if err := queue.CheckTrimMode(queueTrimMode); err != nil {
+		log.Fatalf("Invalid QUEUE_TRIM_MODE: %v", err)
+	}
+	queueCompression := getEnv("QUEUE_COMPRESSION", queue.CompressionNone)
+	if err := queue.CheckCompression(queueCompression); err != nil {
+		log.Fatalf("Invalid QUEUE_COMPRESSION: %v", err)
+	}
+	// streamQueue is only set with Redis Streams, which replay and scaling metrics need
+	var eventQueue queue.Queue
+	var streamQueue *queue.EventQueue
+	var kafkaQueue *queue.KafkaQueue
+	switch queueBackend {
+	case queue.BackendKafka:
+		brokers := getEnv("KAFKA_BROKERS", "")
+		if brokers == "" {
+			log.Fatalf("KAFKA_BROKERS is required with QUEUE_BACKEND=%s", queue.BackendKafka)
+		}
+		kafkaQueue = queue.NewKafkaQueue(queue.KafkaConfig{
+			Brokers:           strings.Split(brokers, ","),
+			Topic:             getEnv("KAFKA_TOPIC", queue.DefaultKafkaTopic),
+			ConsumerGroup:     getEnv("QUEUE_CONSUMER_GROUP", queue.DefaultConsumerGroup),
+			Partitions:        getEnvAsInt("KAFKA_PARTITIONS", queue.DefaultKafkaPartitions),
+			ReplicationFactor: getEnvAsInt("KAFKA_REPLICATION_FACTOR", queue.DefaultKafkaReplicationFactor),
+			Compression:       queueCompression,
+		})
+		eventQueue = kafkaQueue
+		log.Printf("[DEBUG] Event queue initialized - kafka topic: %s, brokers: %s, group: %s, compression: %s",
+			kafkaQueue.StreamKey(), brokers, kafkaQueue.ConsumerGroup(), queueCompression)
+	default:
+		streamQueue = queue.NewEventQueue(redisClient, queue.QueueConfig{
+			StreamKey:        getEnv("QUEUE_STREAM_KEY", queue.DefaultStreamKey),
+			ConsumerGroup:    getEnv("QUEUE_CONSUMER_GROUP", queue.DefaultConsumerGroup),
+			MaxLen:           int64(queueMaxLen),
+			MaxRetries:       queueMaxRetries,
+			ShardCount:       getEnvAsInt("QUEUE_SHARD_COUNT", 1),
+			TrimMode:         queueTrimMode,
+			MaxAge:           getEnvAsDuration("QUEUE_TRIM_MAX_AGE", queue.DefaultMaxAge),
+			Compression:      queueCompression,
+			CompressMinBytes: getEnvAsInt("QUEUE_COMPRESS_MIN_BYTES", queue.DefaultCompressMinBytes),
+			PriorityTypes:    strings.Split(getEnv("QUEUE_PRIORITY_TYPES", ""), ","),
+		})
+		eventQueue = streamQueue
+		log.Printf("[DEBUG] Event queue initialized - stream: %s, shards: %d, group: %s, trimming: %s, compression: %s, max retries: %d",
+			streamQueue.StreamKey(), len(streamQueue.Shards()), streamQueue.ConsumerGroup(), streamQueue.TrimPolicy(), queueCompression, queueMaxRetries)
+		if priority := streamQueue.Priority(); priority != nil {
+			log.Printf("[DEBUG] Priority lane %s for event types: %s", priority.StreamKey(), strings.Join(streamQueue.PriorityTypes(), ", "))
+		}
+	}
 
 	// Initialize event processor
 	log.Printf("[DEBUG] Initializing event processor...")
 	workerCount := getEnvAsInt("QUEUE_WORKER_COUNT", 5)
 	batchSize := getEnvAsInt("QUEUE_BATCH_SIZE", 100)
-	processInterval := getEnvAsDuration("QUEUE_PROCESS_INTERVAL", 1*time.Second)
+	blockTimeout := getEnvAsDuration("QUEUE_BLOCK_TIMEOUT", 2*time.Second)
 	shutdownTimeout := getEnvAsDuration("QUEUE_SHUTDOWN_TIMEOUT", 30*time.Second)
 
-	log.Printf("[DEBUG] Event processor config - WorkerCount: %d, BatchSize: %d, ProcessInterval: %v, ShutdownTimeout: %v",
-		workerCount, batchSize, processInterval, shutdownTimeout)
+	log.Printf("[DEBUG] Event processor config - WorkerCount: %d, BatchSize: %d, BlockTimeout: %v, ShutdownTimeout: %v",
+		workerCount, batchSize, blockTimeout, shutdownTimeout)
 
+	// Optional change data capture publishing of persisted events
+	var publishers cdc.MultiPublisher
+	if webhookURL := getEnv("CDC_WEBHOOK_URL", ""); webhookURL != "" {
+		publishers = append(publishers, cdc.NewWebhookPublisher(webhookURL, getEnv("CDC_WEBHOOK_SECRET", ""), 5*time.Second))
+		log.Printf("[DEBUG] CDC webhook publisher enabled: %s", webhookURL)
+	}
+	if streamKey := getEnv("CDC_REDIS_STREAM", ""); streamKey != "" {
+		publishers = append(publishers, cdc.NewRedisStreamPublisher(redisClient.GetClient(), streamKey, 100000))
+		log.Printf("[DEBUG] CDC Redis stream publisher enabled: %s", streamKey)
+	}
+	var publisher cdc.Publisher
+	if len(publishers) > 0 {
+		publisher = publishers
+	}
+
+	// Ingest audit counters live in Redis and are flushed to ingest_stats
+	ingestStats := stats.NewIngestCounters(redisClient.GetClient())
+
+	// Optionally shadow a percentage of sessions through the candidate COPY write path
+	shadowPercent := getEnvAsInt("SHADOW_INGEST_PERCENT", 0)
+	shadow := queue.NewShadow(repository.NewShadowRepository(db), ingestStats, shadowPercent)
+	log.Printf("[DEBUG] Shadow ingestion percent: %d", shadowPercent)
+
+	catalogRepo := repository.NewCatalogRepository(db)
+	eventCatalog := catalog.NewRecorder(catalogRepo, getEnvAsDuration("CATALOG_FLUSH_INTERVAL", time.Minute))
+	// Workers stop reading while the database is down instead of failing every batch
+	var dbGate *queue.HealthGate
+	if interval := getEnvAsDuration("DB_HEALTH_INTERVAL", 5*time.Second); interval > 0 {
+		dbGate = queue.NewHealthGate(db.Health, interval, getEnvAsInt("DB_HEALTH_FAILURES", 2), getEnvAsDuration("DB_RESUME_WARMUP", 10*time.Second))
+	}
 	processor := queue.NewEventProcessor(
 		eventQueue,
 		eventRepo,
+		publisher,
+		ingestStats,
+		shadow,
+		eventCatalog,
+		dbGate,
 		queue.ProcessorConfig{
 			WorkerCount:     workerCount,
 			BatchSize:       int64(batchSize),
-			ProcessInterval: processInterval,
+			BlockTimeout:    blockTimeout,
+			ConsumerPrefix:  consumerPrefix,
 			ShutdownTimeout: shutdownTimeout,
-			MaxRetries:      queueMaxRetries,
-			RetryDelay:      1 * time.Second,
+			MaxRetries:      getEnvAsInt("QUEUE_INSERT_MAX_RETRIES", queue.DefaultInsertRetries),
+			RetryDelay:      getEnvAsDuration("QUEUE_INSERT_RETRY_DELAY", time.Second),
+			PublishTimeout:  getEnvAsDuration("CDC_PUBLISH_TIMEOUT", 5*time.Second),
+			SessionShards:   getEnvAsInt("QUEUE_SESSION_SHARDS", workerCount),
+			ReclaimInterval: getEnvAsDuration("QUEUE_RECLAIM_INTERVAL", time.Minute),
+			ReclaimMinIdle:  getEnvAsDuration("QUEUE_RECLAIM_MIN_IDLE", 5*time.Minute),
+			MaxDeliveries:   getEnvAsInt("QUEUE_MAX_DELIVERIES", 5),
+			MaxWorkers:      getEnvAsInt("QUEUE_WORKER_MAX", 0),
+			ScaleInterval:   getEnvAsDuration("QUEUE_SCALE_INTERVAL", queue.DefaultScaleInterval),
+			ScaleBacklog:    int64(getEnvAsInt("QUEUE_SCALE_BACKLOG", queue.DefaultScaleBacklog)),
+			BreakerFailures: getEnvAsInt("QUEUE_BREAKER_FAILURES", 5),
+			BreakerCooldown: getEnvAsDuration("QUEUE_BREAKER_COOLDOWN", 30*time.Second),
 		},
 	)
 
@@ -152,31 +363,361 @@ func main() {
 		log.Printf("[DEBUG] Event processor start failed: %v", err)
 		log.Fatalf("Failed to start event processor: %v", err)
 	}
+	eventCatalog.Start(ctx)
+
+	// Event batches are turned away with 429 while the backlog is over QUEUE_MAX_DEPTH,
+	// by default well before the stream trims unprocessed entries at QUEUE_MAX_LEN
+	var backpressure *queue.Backpressure
+	if maxDepth := getEnvAsInt("QUEUE_MAX_DEPTH", queueMaxLen*4/5); maxDepth > 0 {
+		backpressure = queue.NewBackpressure(eventQueue, int64(maxDepth), getEnvAsDuration("QUEUE_DEPTH_CHECK_INTERVAL", time.Second))
+		backpressure.Start(ctx)
+	}
 
 	log.Printf("Event processor started with %d workers", workerCount)
 	log.Printf("[DEBUG] Event processor started successfully")
 
+	// Start generic background job runner
+	jobQueue := queue.NewJobQueue(redisClient, jobRepo, queue.QueueConfig{
+		StreamKey:     getEnv("JOB_STREAM_KEY", queue.DefaultJobStreamKey),
+		ConsumerGroup: getEnv("JOB_CONSUMER_GROUP", queue.DefaultJobConsumerGroup),
+	})
+	jobRunner := queue.NewJobRunner(jobQueue, queue.RunnerConfig{
+		Concurrency:    getEnvAsInt("JOB_WORKER_COUNT", 2),
+		BlockTimeout:   blockTimeout,
+		ConsumerPrefix: consumerPrefix,
+		SweepInterval:  getEnvAsDuration("JOB_SWEEP_INTERVAL", 15*time.Second),
+		StaleAfter:     getEnvAsDuration("JOB_STALE_AFTER", 2*time.Minute),
+		ResendAfter:    getEnvAsDuration("JOB_RESEND_AFTER", time.Minute),
+		RetryDelay:     getEnvAsDuration("JOB_RETRY_DELAY", 10*time.Second),
+	})
+	jobRunner.Register(jobs.TypeBackfill, jobs.Backfill(databaseURL))
+	jobRunner.Register(jobs.TypeBlobCleanup, jobs.BlobCleanup(screenshotRepo, blobStore))
+	if err := jobRunner.Start(ctx); err != nil {
+		log.Fatalf("Failed to start job runner: %v", err)
+	}
+	log.Printf("[DEBUG] Job runner started")
+
+	// Start issue clustering job
+	clusterer := issues.NewClusterer(issueRepo, issues.ClustererConfig{
+		Interval:           getEnvAsDuration("ISSUE_CLUSTER_INTERVAL", 5*time.Minute),
+		Lookback:           getEnvAsDuration("ISSUE_CLUSTER_LOOKBACK", 24*time.Hour),
+		RageClickThreshold: getEnvAsInt("ISSUE_RAGE_CLICK_THRESHOLD", 3),
+	})
+	clusterer.Start(ctx)
+	log.Printf("[DEBUG] Issue clusterer started")
+
+	// Start historical import worker
+	importWorker := importer.NewWorker(importRepo, sessionRepo, eventRepo, blobStore, importer.WorkerConfig{
+		PollInterval:  getEnvAsDuration("IMPORT_POLL_INTERVAL", 10*time.Second),
+		BatchSize:     getEnvAsInt("IMPORT_BATCH_SIZE", 500),
+		ProgressEvery: int64(getEnvAsInt("IMPORT_PROGRESS_EVERY", 1000)),
+	})
+	importWorker.Start(ctx)
+	log.Printf("[DEBUG] Import worker started")
+
+	// Start export job worker and scheduler (export jobs need blob storage)
+	var exportWorker *exporter.Worker
+	var exportScheduler *exporter.Scheduler
+	if blobStore != nil {
+		exportNotifier := exporter.NewNotifier(getEnv("EXPORT_NOTIFY_URL", ""), getEnv("EXPORT_NOTIFY_SECRET", ""), 5*time.Second)
+		exportWorker = exporter.NewWorker(exportRepo, exportScheduleRepo, sessionRepo, eventRepo, blobStore, exportNotifier, exporter.WorkerConfig{
+			PollInterval: getEnvAsDuration("EXPORT_POLL_INTERVAL", 10*time.Second),
+			PageSize:     getEnvAsInt("EXPORT_PAGE_SIZE", 1000),
+			Prefix:       getEnv("EXPORT_PREFIX", "exports"),
+		})
+		exportWorker.Start(ctx)
+		log.Printf("[DEBUG] Export worker started")
+
+		exportScheduler = exporter.NewScheduler(exportScheduleRepo, getEnvAsDuration("EXPORT_SCHEDULE_INTERVAL", 30*time.Second))
+		exportScheduler.Start(ctx)
+		log.Printf("[DEBUG] Export scheduler started")
+	}
+
+	// Optionally archive accepted /track payloads to blob storage
+	var archiver *archive.Archiver
+	if getEnv("ARCHIVE_PAYLOADS", "false") == "true" {
+		if blobStore == nil {
+			log.Fatalf("ARCHIVE_PAYLOADS requires BLOB_STORAGE to be configured")
+		}
+		var archiveRecipient *encrypt.Recipient
+		if method := getEnv("ARCHIVE_ENCRYPTION", encrypt.MethodNone); method != encrypt.MethodNone {
+			recipient, err := encrypt.ParseRecipient(method, getEnv("ARCHIVE_PUBLIC_KEY", ""))
+			if err != nil {
+				log.Fatalf("Invalid ARCHIVE_PUBLIC_KEY: %v", err)
+			}
+			archiveRecipient = recipient
+			log.Printf("[DEBUG] Payload archives encrypted with %s key %s", method, recipient.Fingerprint)
+		}
+		archiver = archive.NewArchiver(blobStore, archive.Config{
+			Prefix:        getEnv("ARCHIVE_PREFIX", "archive/track"),
+			FlushInterval: getEnvAsDuration("ARCHIVE_FLUSH_INTERVAL", time.Minute),
+			MaxBytes:      getEnvAsInt("ARCHIVE_MAX_BYTES", 8*1024*1024),
+			Recipient:     archiveRecipient,
+		})
+		archiver.Start(ctx)
+		log.Printf("[DEBUG] Payload archiver started")
+	}
+
+	// Start expiry of events with SDK-provided TTLs
+	expirer := retention.NewExpirer(eventRepo,
+		getEnvAsDuration("EVENT_EXPIRY_INTERVAL", 5*time.Minute),
+		getEnvAsInt("EVENT_EXPIRY_BATCH_SIZE", 1000),
+	)
+	expirer.Start(ctx)
+	log.Printf("[DEBUG] Event expirer started")
+
+	// Start sandbox purger
+	sandboxPurgeSchedule, err := cron.Parse(getEnv("SANDBOX_PURGE_CRON", "0 3 * * *"))
+	if err != nil {
+		log.Fatalf("Invalid SANDBOX_PURGE_CRON: %v", err)
+	}
+	sandboxPurger := retention.NewSandboxPurger(sessionRepo, blobStore, sandboxPurgeSchedule,
+		getEnvAsDuration("SANDBOX_RETENTION", 24*time.Hour),
+		getEnvAsInt("SANDBOX_PURGE_BATCH_SIZE", 100),
+	)
+	sandboxPurger.Start(ctx)
+	log.Printf("[DEBUG] Sandbox purger started")
+
+	// Start watchlist watcher
+	watchlistRepo := repository.NewWatchlistRepository(db)
+	watcher := watchlist.NewWatcher(watchlistRepo, watchlist.NewNotifier(
+		getEnv("WATCHLIST_NOTIFY_URL", ""),
+		getEnv("WATCHLIST_NOTIFY_SECRET", ""),
+		getEnv("DASHBOARD_URL", ""),
+		getEnvAsDuration("WATCHLIST_NOTIFY_TIMEOUT", 10*time.Second),
+	), getEnvAsDuration("WATCHLIST_POLL_INTERVAL", 15*time.Second))
+	watcher.Start(ctx)
+	log.Printf("[DEBUG] Watchlist watcher started")
+
+	// Start alert evaluator
+	alertRepo := repository.NewAlertRepository(db)
+	alertEvaluator := alerts.NewEvaluator(alertRepo, eventQueue, alerts.NewNotifier(
+		getEnv("ALERT_NOTIFY_URL", ""),
+		getEnv("ALERT_NOTIFY_SECRET", ""),
+		getEnvAsDuration("ALERT_NOTIFY_TIMEOUT", 10*time.Second),
+	), getEnvAsDuration("ALERT_EVAL_INTERVAL", time.Minute))
+	alertEvaluator.Start(ctx)
+	log.Printf("[DEBUG] Alert evaluator started")
+
+	// Start warehouse syncer loading sessions and events into BigQuery and Snowflake
+	warehouseRepo := repository.NewWarehouseRepository(db)
+	var warehouseSyncer *warehouse.Syncer
+	if interval := getEnvAsDuration("WAREHOUSE_SYNC_INTERVAL", time.Minute); interval > 0 {
+		warehouseSyncer = warehouse.NewSyncer(warehouseRepo, sessionRepo, eventRepo, warehouse.SyncerConfig{
+			PollInterval:  interval,
+			Lease:         getEnvAsDuration("WAREHOUSE_SYNC_LEASE", 30*time.Minute),
+			BatchSize:     getEnvAsInt("WAREHOUSE_BATCH_SIZE", 5000),
+			MaxRowsPerRun: getEnvAsInt("WAREHOUSE_MAX_ROWS_PER_RUN", 500000),
+			HTTPTimeout:   getEnvAsDuration("WAREHOUSE_HTTP_TIMEOUT", 5*time.Minute),
+			Options: warehouse.Options{
+				Store:       blobStore,
+				StagePrefix: getEnv("WAREHOUSE_STAGE_PREFIX", "warehouse"),
+			},
+		})
+		warehouseSyncer.Start(ctx)
+		log.Printf("[DEBUG] Warehouse syncer started")
+	}
+
+	// Start ingest stats flusher
+	statsFlusher := stats.NewFlusher(redisClient.GetClient(), ingestStatsRepo, getEnvAsDuration("INGEST_STATS_FLUSH_INTERVAL", time.Minute))
+	statsFlusher.Start(ctx)
+	log.Printf("[DEBUG] Ingest stats flusher started")
+
+	// Degrade mode drops events that cannot be queued or are rate limited, instead of
+	// failing the request, and counts them per project
+	var drops *stats.DropCounter
+	if getEnv("INGEST_DEGRADE_MODE", "error") == "drop" {
+		drops = stats.NewDropCounter(ingestStats, getEnvAsDuration("INGEST_DROP_FLUSH_INTERVAL", 10*time.Second))
+		drops.Start(ctx)
+		log.Printf("[DEBUG] Ingest degrade mode: drop")
+	}
+
+	// Ingest request bodies are not logged unless LOG_REQUEST_BODIES is redacted or full
+	bodyLog, err := logpolicy.New(getEnv("LOG_REQUEST_BODIES", logpolicy.BodyOff), getEnvAsInt("LOG_BODY_SAMPLE_PERCENT", 100), getEnvAsInt("LOG_BODY_MAX_BYTES", 500))
+	if err != nil {
+		log.Fatalf("Invalid request body logging config: %v", err)
+	}
+	log.Printf("[DEBUG] Request body logging: %s", bodyLog.Mode())
+
 	// Initialize handlers
 	log.Printf("[DEBUG] Initializing handlers...")
-	sessionHandler := handlers.NewSessionHandler(sessionRepo, eventRepo)
-	trackHandler := handlers.NewTrackHandler(eventQueue, screenshotRepo)
+	sessionResumeWindow := getEnvAsDuration("SESSION_RESUME_WINDOW", 30*time.Minute)
+	domainPolicy := validation.NewDomainPolicy(
+		strings.Split(getEnv("ALLOWED_PAGE_DOMAINS", ""), ","),
+		getEnv("PAGE_DOMAIN_MODE", validation.DomainModeReject),
+	)
+	log.Printf("[DEBUG] Page domain policy enabled: %v", domainPolicy.Enabled())
+	sessionHandler := handlers.NewSessionHandler(sessionRepo, eventRepo, markerRepo, sessionResumeWindow, int64(getEnvAsInt("COUNT_ESTIMATE_THRESHOLD", 100000)))
+	// Throttles advertised to SDKs, and the floor enforced whatever the SDK sends
+	trackThrottles := shaping.Throttles{
+		MouseMove: getEnvAsDuration("TRACK_MOUSEMOVE_THROTTLE", 100*time.Millisecond),
+		Scroll:    getEnvAsDuration("TRACK_SCROLL_THROTTLE", 100*time.Millisecond),
+	}
+	trackShaper := shaping.NewShaper(shaping.Throttles{
+		MouseMove: getEnvAsDuration("TRACK_MOUSEMOVE_MIN_INTERVAL", 50*time.Millisecond),
+		Scroll:    getEnvAsDuration("TRACK_SCROLL_MIN_INTERVAL", 50*time.Millisecond),
+	})
+
+	urlRuleRepo := repository.NewURLRuleRepository(db)
+	urlRules := urlgroup.NewCache(urlRuleRepo, getEnvAsDuration("URL_RULES_CACHE_TTL", time.Minute))
+
+	// The last rejected /track requests of each tracker key, for GET /admin/ingest-errors
+	var ingestErrors *stats.RejectionLog
+	if size := getEnvAsInt("INGEST_ERRORS_SIZE", 100); size > 0 {
+		ingestErrors = stats.NewRejectionLog(redisClient.GetClient(), size, getEnvAsDuration("INGEST_ERRORS_TTL", 7*24*time.Hour))
+	}
+
+	// Replay asset cache: copies of the stylesheets and images screenshots' pages
+	// referenced, fetched only from ASSET_PROXY_DOMAINS
+	var assetCache *assets.Cache
+	if domains := getEnv("ASSET_PROXY_DOMAINS", ""); domains != "" {
+		if blobStore == nil {
+			log.Fatalf("ASSET_PROXY_DOMAINS requires BLOB_STORAGE to be configured")
+		}
+		assetCache = assets.NewCache(repository.NewAssetRepository(db), blobStore,
+			validation.NewDomainPolicy(strings.Split(domains, ","), validation.DomainModeReject), assets.Config{
+				Prefix:     getEnv("ASSET_CACHE_PREFIX", "assets"),
+				MaxBytes:   int64(getEnvAsInt("ASSET_MAX_BYTES", 5*1024*1024)),
+				QuotaBytes: int64(getEnvAsInt("ASSET_QUOTA_BYTES", 1024*1024*1024)),
+				MaxPerPage: getEnvAsInt("ASSET_MAX_PER_PAGE", 100),
+				Workers:    getEnvAsInt("ASSET_FETCH_WORKERS", 2),
+				QueueSize:  getEnvAsInt("ASSET_QUEUE_SIZE", 1000),
+				Timeout:    getEnvAsDuration("ASSET_FETCH_TIMEOUT", 30*time.Second),
+			})
+		assetCache.Start(ctx)
+	}
+
+	// Sessions are live while their tabs send events or heartbeats within the timeout
+	livenessTracker := liveness.NewTracker(redisClient.GetClient(), getEnvAsDuration("LIVENESS_TIMEOUT", time.Minute))
+	livenessHandler := handlers.NewLivenessHandler(sessionRepo, livenessTracker,
+		getEnvAsDuration("LIVENESS_STREAM_INTERVAL", 5*time.Second), getEnvAsDuration("LIVENESS_STREAM_MAX", 10*time.Minute))
+	// Retried /track batches carrying a batch_id are only queued once within the TTL;
+	// 0 disables deduplication
+	var batchDeduper *queue.BatchDeduper
+	if ttl := getEnvAsDuration("TRACK_BATCH_DEDUPE_TTL", 24*time.Hour); ttl > 0 {
+		batchDeduper = queue.NewBatchDeduper(redisClient.GetClient(), ttl)
+	}
+	// /track refuses (reject) or marks (flag) batches for session IDs not in the
+	// database; known IDs are cached in Redis for SESSION_CHECK_TTL
+	sessionCheckMode := getEnv("SESSION_CHECK_MODE", sessioncheck.ModeFlag)
+	if err := sessioncheck.CheckMode(sessionCheckMode); err != nil {
+		log.Fatalf("Invalid SESSION_CHECK_MODE: %v", err)
+	}
+	sessionCheck := sessioncheck.NewChecker(redisClient.GetClient(), sessionRepo, getEnvAsDuration("SESSION_CHECK_TTL", time.Hour), sessionCheckMode)
+	trackHandler := handlers.NewTrackHandler(handlers.TrackHandlerDeps{
+		EventQueue:     eventQueue,
+		Processor:      processor,
+		SyncMaxEvents:  getEnvAsInt("TRACK_SYNC_MAX_EVENTS", 100),
+		ScreenshotRepo: screenshotRepo,
+		BlobStore:      blobStore,
+		ScreenshotURLs: handlers.ScreenshotURLConfig{
+			Delivery: getEnv("SCREENSHOT_DELIVERY", handlers.ScreenshotDeliveryProxy),
+			TTL:      getEnvAsDuration("SCREENSHOT_URL_TTL", 15*time.Minute),
+		},
+		DomainPolicy: domainPolicy,
+		IngestStats:  ingestStats,
+		Archiver:     archiver,
+		Drops:        drops,
+		BodyLog:      bodyLog,
+		Shaper:       trackShaper,
+		URLRules:     urlRules,
+		Rejections:   ingestErrors,
+		AssetCache:   assetCache,
+		Liveness:     livenessTracker,
+		Deduper:      batchDeduper,
+		SessionCheck: sessionCheck,
+	})
+	issueHandler := handlers.NewIssueHandler(issueRepo, markerRepo)
+	watchlistHandler := handlers.NewWatchlistHandler(watchlistRepo)
+	alertHandler := handlers.NewAlertHandler(alertRepo)
+	warehouseHandler := handlers.NewWarehouseHandler(warehouseRepo)
+	assetHandler := handlers.NewAssetHandler(assetCache)
+	linkHandler := handlers.NewLinkHandler(repository.NewLinkRepository(db))
+	trackerTokenSigner, err := trackertoken.NewSigner(getEnv("TRACKER_TOKEN_SECRETS", ""), getEnvAsDuration("TRACKER_TOKEN_TTL", 15*time.Minute))
+	if err != nil {
+		log.Fatalf("Invalid TRACKER_TOKEN_SECRETS: %v", err)
+	}
+	trackerKeyRepo := repository.NewTrackerKeyRepository(db)
+	trackerKeyCache := trackertoken.NewKeyCache(trackerKeyRepo, getEnvAsDuration("TRACKER_KEY_CACHE_TTL", 30*time.Second))
+	urlRuleHandler := handlers.NewURLRuleHandler(urlRuleRepo, urlRules)
+	trackerKeyHandler := handlers.NewTrackerKeyHandler(trackerKeyRepo, trackerKeyCache, trackerTokenSigner, trackThrottles, trackShaper)
+	segmentHandler := handlers.NewSegmentHandler(trackerKeyRepo, sessionRepo, eventQueue, ingestStats, getEnvAsDuration("SEGMENT_SESSION_WINDOW", sessionResumeWindow), domainPolicy, urlRules, batchDeduper)
+	trackerScriptHandler := handlers.NewTrackerScriptHandler(trackerKeyRepo, getEnv("TRACKER_BUNDLE_PATH", "../tracker/dist/tracker.min.js"), getEnv("TRACKER_SCRIPT_API_URL", ""))
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	apiKeyCache := apikey.NewCache(apiKeyRepo, getEnvAsDuration("API_KEY_CACHE_TTL", 30*time.Second))
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyRepo, apiKeyCache)
+	accessTokenSigner := accesstoken.NewSigner(getEnv("ACCESS_TOKEN_SECRET", ""))
+	accessTokenHandler := handlers.NewAccessTokenHandler(sessionRepo, accessTokenSigner, getEnvAsDuration("ACCESS_TOKEN_MAX_TTL", 7*24*time.Hour), getEnv("DASHBOARD_URL", ""))
+	feedHandler := handlers.NewFeedHandler(repository.NewFeedRepository(db), handlers.FeedConfig{
+		RageClickThreshold: getEnvAsInt("ISSUE_RAGE_CLICK_THRESHOLD", 3),
+		SpikeScore:         getEnvAsInt("FEED_SPIKE_SCORE", 6),
+	})
+	markerHandler := handlers.NewMarkerHandler(markerRepo)
+	eventSchemaRepo := repository.NewEventSchemaRepository(db)
+	eventHandler := handlers.NewEventHandler(eventRepo, eventSchemaRepo)
+	eventSchemaHandler := handlers.NewEventSchemaHandler(eventSchemaRepo)
+	analyticsHandler := handlers.NewAnalyticsHandler(analyticsRepo)
+	catalogHandler := handlers.NewCatalogHandler(catalogRepo)
+	importHandler := handlers.NewImportHandler(importRepo, blobStore)
+	exportHandler := handlers.NewExportHandler(sessionRepo, exportRepo, exportScheduleRepo, blobStore, handlers.ExportJobConfig{
+		RequireEncryption: getEnv("EXPORT_REQUIRE_ENCRYPTION", "false") == "true",
+		URLTTL:            getEnvAsDuration("EXPORT_URL_TTL", 15*time.Minute),
+	})
+	drainState := drain.New()
+	var replayer *queue.Replayer
+	if streamQueue != nil {
+		replayer = queue.NewReplayer(streamQueue, eventRepo)
+	}
+	adminHandler := handlers.NewAdminHandler(replayer, ingestStatsRepo, migrationStatus, jobQueue, drainState, eventRepo, ingestErrors)
+	jobHandler := handlers.NewJobHandler(jobRepo, importRepo, exportRepo)
+	// Synthetic canary sending a session through this instance's public ingest path
+	var probe *canary.Canary
+	if interval := getEnvAsDuration("CANARY_INTERVAL", 0); interval > 0 {
+		probe = canary.New(canary.Config{
+			BaseURL:   getEnv("CANARY_BASE_URL", "http://127.0.0.1:"+port),
+			Interval:  interval,
+			SLO:       getEnvAsDuration("CANARY_SLO", 10*time.Second),
+			PageURL:   getEnv("CANARY_PAGE_URL", "https://canary.invalid/"),
+			PublicKey: getEnv("CANARY_PUBLIC_KEY", ""),
+			Origin:    getEnv("CANARY_ORIGIN", ""),
+			Consent:   getEnv("CANARY_CONSENT", ""),
+		}, sessionRepo, eventRepo)
+		probe.Start(ctx)
+	}
+	metricsHandler := handlers.NewMetricsHandler(streamQueue, processor, getEnvAsDuration("SCALING_ACTIVE_WITHIN", time.Minute), scanGuard, drops, probe)
+	sessionHandlerV2 := handlersv2.NewSessionHandler(sessionRepo, eventRepo, livenessTracker)
 	log.Printf("[DEBUG] Handlers initialized")
 
 	// Initialize Fiber app
 	log.Printf("[DEBUG] Initializing Fiber app...")
+	// fasthttp serves HTTP/1.1 with keep-alive; terminate HTTP/2 at the load balancer.
+	// SERVER_CONCURRENCY caps concurrent connections (0 uses fiber's default).
 	app := fiber.New(fiber.Config{
-		AppName:      "User Tracker API",
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		BodyLimit:    10 * 1024 * 1024, // 10MB for screenshots
+		AppName:          "User Tracker API",
+		ReadTimeout:      getEnvAsDuration("SERVER_READ_TIMEOUT", 10*time.Second),
+		WriteTimeout:     getEnvAsDuration("SERVER_WRITE_TIMEOUT", 10*time.Second),
+		IdleTimeout:      getEnvAsDuration("SERVER_IDLE_TIMEOUT", 2*time.Minute),
+		Concurrency:      getEnvAsInt("SERVER_CONCURRENCY", 0),
+		DisableKeepalive: getEnv("SERVER_DISABLE_KEEPALIVE", "false") == "true",
+		Prefork:          prefork,
+		BodyLimit:        10 * 1024 * 1024, // 10MB for screenshots
 	})
 	log.Printf("[DEBUG] Fiber app created")
 
 	// Global middleware
 	log.Printf("[DEBUG] Setting up global middleware...")
 	app.Use(recover.New())
+	// Correlation ID for access logs, queued messages and worker logs
+	app.Use(middleware.RequestID())
 	app.Use(middleware.Logger())
 	app.Use(middleware.CORS(corsOrigins))
+	// Cancel dashboard queries whose client has gone away
+	app.Use(middleware.CancelOnDisconnect(
+		getEnvAsDuration("REQUEST_TIMEOUT", 0),
+		getEnvAsDuration("DISCONNECT_POLL_INTERVAL", 250*time.Millisecond),
+	))
+	// Resolve the caller's role for field visibility (fingerprints, input values)
+	app.Use(middleware.Role(getEnv("ADMIN_TOKEN", ""), getEnv("VIEWER_TOKEN", ""), apiKeyCache, visibility.ParseRole(getEnv("DEFAULT_ROLE", string(visibility.RoleViewer)))))
 	log.Printf("[DEBUG] Global middleware configured")
 
 	// Health check
@@ -185,6 +726,13 @@ func main() {
 			"status": "healthy",
 		}
 
+		// A draining instance fails its health check so load balancers stop routing to it
+		if drainState.Draining() {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"status": "draining",
+			})
+		}
+
 		// Check database
 		if err := db.Health(c.Context()); err != nil {
 			health["database"] = "unhealthy"
@@ -203,9 +751,17 @@ func main() {
 
 		// Get queue metrics
 		queueDepth, _ := eventQueue.GetQueueDepth(c.Context())
-		pendingCount, _ := eventQueue.GetPendingCount(c.Context())
 		health["queue_depth"] = queueDepth
-		health["queue_pending"] = pendingCount
+		if streamQueue != nil {
+			pendingCount, _ := streamQueue.GetPendingCount(c.Context())
+			health["queue_pending"] = pendingCount
+		}
+
+		// Canary failures are reported but do not fail the check: they usually affect
+		// every instance, and taking all of them out of rotation would not help
+		if probe != nil {
+			health["canary"] = probe.Status()
+		}
 
 		if health["status"] == "degraded" {
 			return c.Status(fiber.StatusServiceUnavailable).JSON(health)
@@ -214,23 +770,228 @@ func main() {
 		return c.JSON(health)
 	})
 
-	// API v1 routes
-	v1 := app.Group("/api/v1")
+	// Backlog metrics for KEDA/HPA autoscaling of processor replicas; Kafka deployments
+	// scale on consumer group lag from their own exporter
+	if streamQueue != nil {
+		app.Get("/metrics/scaling", metricsHandler.GetScaling)
+	}
+	app.Get("/metrics/processor", metricsHandler.GetProcessor)
+	app.Get("/metrics/scanning", metricsHandler.GetScanning)
+	app.Get("/metrics/drops", metricsHandler.GetDrops)
+	app.Get("/metrics/canary", metricsHandler.GetCanary)
+
+	// Tracker SDK with a tracker key's settings baked in, for embedding with one script tag
+	app.Get("/t/:project_key/tracker.js", trackerScriptHandler.GetScript)
+
+	// API v1 routes (frozen response shapes)
+	v1 := app.Group("/api/v1", middleware.APIVersion("v1"))
+
+	// Ingest routes must identify the client SDK
+	requireSDK := middleware.SDK(getEnv("REQUIRE_SDK_HEADER", "true") == "true")
+
+	// Ingest routes evaluate the visitor's TCF/GPP consent string
+	consent := middleware.Consent(getEnv("REQUIRE_CONSENT", "false") == "true")
+
+	// Ingest routes authenticate with short-lived tracker tokens when configured
+	trackerToken := middleware.TrackerToken(trackerTokenSigner, trackerKeyCache, apiKeyCache, getEnv("REQUIRE_TRACKER_TOKEN", "false") == "true")
+	if trackerTokenSigner == nil && getEnv("REQUIRE_TRACKER_TOKEN", "false") == "true" {
+		log.Fatalf("REQUIRE_TRACKER_TOKEN requires TRACKER_TOKEN_SECRETS to be configured")
+	}
+
+	// Ingest routes refuse new data while the instance drains
+	draining := middleware.RejectWhenDraining(drainState, getEnvAsDuration("DRAIN_RETRY_AFTER", 5*time.Second))
+
+	// Heavy dashboard reads share bounded slots so they cannot starve ingestion of
+	// database connections
+	concurrencyWait := getEnvAsDuration("HEAVY_REQUEST_WAIT", 2*time.Second)
+	screenshotDataLimit := middleware.ConcurrencyLimit(middleware.ConcurrencyConfig{
+		Name:   "screenshot data",
+		Limit:  getEnvAsInt("SCREENSHOT_DATA_CONCURRENCY", 4),
+		Wait:   concurrencyWait,
+		Filter: func(c *fiber.Ctx) bool { return c.QueryBool("include_data", false) },
+	})
+	exportLimit := middleware.ConcurrencyLimit(middleware.ConcurrencyConfig{
+		Name:  "export",
+		Limit: getEnvAsInt("EXPORT_CONCURRENCY", 2),
+		Wait:  concurrencyWait,
+	})
 
 	// Session routes
+	sessionIDParam := middleware.UUIDParam("id", "session ID")
+	// Session read routes also accept session:read access tokens for that session
+	sessionScope := middleware.SessionScope(accessTokenSigner, "id")
 	sessions := v1.Group("/sessions")
-	sessions.Post("/", sessionHandler.CreateSession)
+	sessions.Post("/", draining, trackerToken, requireSDK, consent, sessionHandler.CreateSession)
+	sessions.Post("/resume", draining, trackerToken, requireSDK, consent, sessionHandler.ResumeSession)
 	sessions.Get("/", sessionHandler.ListSessions)
-	sessions.Get("/:id", sessionHandler.GetSession)
-	sessions.Get("/:id/events", sessionHandler.GetSessionEvents)
-	sessions.Post("/:id/end", sessionHandler.EndSession)
-	sessions.Get("/:id/screenshots", trackHandler.GetSessionScreenshots)
+	sessions.Get("/:id", sessionIDParam, sessionScope, sessionHandler.GetSession)
+	sessions.Get("/:id/events", sessionIDParam, sessionScope, sessionHandler.GetSessionEvents)
+	sessions.Post("/:id/end", sessionIDParam, sessionHandler.EndSession)
+	sessions.Post("/:id/heartbeat", sessionIDParam, trackerToken, requireSDK, livenessHandler.Heartbeat)
+	sessions.Get("/:id/liveness", sessionIDParam, sessionScope, livenessHandler.GetLiveness)
+	sessions.Get("/:id/liveness/stream", sessionIDParam, sessionScope, livenessHandler.StreamLiveness)
+	sessions.Patch("/:id/metadata", sessionIDParam, draining, trackerToken, requireSDK, sessionHandler.UpdateMetadata)
+	sessions.Get("/:id/export/test", sessionIDParam, exportLimit, sessionHandler.ExportTestCase)
+	sessions.Get("/:id/screenshots", sessionIDParam, sessionScope, screenshotDataLimit, trackHandler.GetSessionScreenshots)
+	sessions.Get("/:id/screenshot-at", sessionIDParam, sessionScope, trackHandler.GetScreenshotAt)
+	sessions.Get("/:id/screenshot-diffs", sessionIDParam, sessionScope, trackHandler.GetScreenshotDiffs)
+	sessions.Post("/:id/links", sessionIDParam, linkHandler.CreateLink)
+	sessions.Get("/:id/links", sessionIDParam, linkHandler.ListLinks)
+	sessions.Delete("/:id/links/:linkId", sessionIDParam, linkHandler.DeleteLink)
+
+	// Event sync routes
+	v1.Get("/events", eventHandler.ListEvents)
 
 	// Tracking routes
+	// Per-IP limit on event batches; in degrade mode limited batches are dropped with 202
+	trackLimit := func(c *fiber.Ctx) error { return c.Next() }
+	if limit := getEnvAsInt("RATE_LIMIT_REQUESTS", 0); limit > 0 {
+		var limitReached fiber.Handler
+		if drops != nil {
+			limitReached = trackHandler.DropRateLimited
+		}
+		trackLimit = middleware.RateLimiter(limit, time.Duration(getEnvAsInt("RATE_LIMIT_DURATION", 60))*time.Second, limitReached)
+	}
+	// Event batches wait in the SDK while the queue is backed up
+	backedUp := func(c *fiber.Ctx) error { return c.Next() }
+	if backpressure != nil {
+		backedUp = middleware.RejectWhenBackedUp(backpressure, getEnvAsDuration("QUEUE_BACKPRESSURE_RETRY_AFTER", 10*time.Second))
+	}
 	track := v1.Group("/track")
-	track.Post("/", trackHandler.TrackEvents)
-	track.Post("/screenshot", trackHandler.UploadScreenshot)
-	track.Get("/screenshot/:id", trackHandler.GetScreenshot)
+	track.Post("/", draining, backedUp, trackLimit, trackerToken, requireSDK, consent, trackHandler.TrackEvents)
+	track.Post("/screenshot", draining, trackerToken, requireSDK, consent, trackHandler.UploadScreenshot)
+	track.Post("/token", trackerKeyHandler.IssueToken)
+	track.Get("/config", trackerKeyHandler.GetConfig)
+	track.Get("/screenshot/:id", middleware.SessionScope(accessTokenSigner, ""), trackHandler.GetScreenshot)
+
+	// Segment-spec ingest, for sites instrumented with analytics.js; the write key is a
+	// tracker key's public key
+	segment := app.Group("/v1")
+	segment.Post("/batch", draining, backedUp, segmentHandler.Batch)
+	segment.Post("/track", draining, backedUp, segmentHandler.Message(models.SegmentTypeTrack))
+	segment.Post("/page", draining, backedUp, segmentHandler.Message(models.SegmentTypePage))
+	segment.Post("/screen", draining, backedUp, segmentHandler.Message(models.SegmentTypeScreen))
+	segment.Post("/identify", draining, backedUp, segmentHandler.Message(models.SegmentTypeIdentify))
+
+	// Issue routes
+	issueRoutes := v1.Group("/issues")
+	issueRoutes.Get("/", issueHandler.ListIssues)
+	issueRoutes.Get("/:id", issueHandler.GetIssue)
+
+	// Triage feed routes
+	v1.Get("/feed/problem-sessions", feedHandler.GetProblemSessions)
+
+	// External reference lookup (sessions linked to a ticket)
+	v1.Get("/links", linkHandler.LookupLinks)
+
+	// Watchlist routes
+	watch := v1.Group("/watchlist")
+	watch.Post("/", watchlistHandler.Subscribe)
+	watch.Get("/", watchlistHandler.ListSubscriptions)
+	watch.Get("/sessions", watchlistHandler.ListSessions)
+	watch.Delete("/:id", middleware.UUIDParam("id", "watch subscription ID"), watchlistHandler.Unsubscribe)
+
+	// Alert rule routes; /history is registered before /:id
+	alertRoutes := v1.Group("/alerts")
+	alertIDParam := middleware.UUIDParam("id", "alert rule ID")
+	alertRoutes.Post("/", alertHandler.CreateRule)
+	alertRoutes.Get("/", alertHandler.ListRules)
+	alertRoutes.Get("/history", alertHandler.ListHistory)
+	alertRoutes.Get("/:id", alertIDParam, alertHandler.GetRule)
+	alertRoutes.Patch("/:id", alertIDParam, alertHandler.UpdateRule)
+	alertRoutes.Delete("/:id", alertIDParam, alertHandler.DeleteRule)
+
+	// Deploy marker routes
+	markers := v1.Group("/markers")
+	markers.Post("/", markerHandler.CreateMarker)
+	markers.Get("/", markerHandler.ListMarkers)
+
+	// Historical import routes
+	v1.Post("/import", importHandler.CreateImport)
+	v1.Get("/import/:id", middleware.UUIDParam("id", "import job ID"), importHandler.GetImport)
+
+	// Streaming export routes
+	exports := v1.Group("/export")
+	exports.Get("/sessions", exportLimit, exportHandler.ExportSessions)
+
+	// Asynchronous export job routes
+	exportJobs := v1.Group("/exports")
+	exportJobs.Post("/", exportHandler.CreateExport)
+	// Schedules are registered before /:id so "schedules" is not parsed as a job ID
+	scheduleIDParam := middleware.UUIDParam("id", "export schedule ID")
+	exportJobs.Post("/schedules", exportHandler.CreateSchedule)
+	exportJobs.Get("/schedules", exportHandler.ListSchedules)
+	exportJobs.Get("/schedules/:id", scheduleIDParam, exportHandler.GetSchedule)
+	exportJobs.Patch("/schedules/:id", scheduleIDParam, exportHandler.UpdateSchedule)
+	exportJobs.Delete("/schedules/:id", scheduleIDParam, exportHandler.DeleteSchedule)
+	exportJobs.Get("/:id", middleware.UUIDParam("id", "export job ID"), exportHandler.GetExport)
+	exportJobs.Get("/:id/download", middleware.UUIDParam("id", "export job ID"), exportLimit, exportHandler.DownloadExport)
+
+	// Admin routes (disabled unless ADMIN_TOKEN is set)
+	admin := v1.Group("/admin", middleware.AdminToken(getEnv("ADMIN_TOKEN", "")))
+	if replayer != nil {
+		admin.Post("/replay", adminHandler.ReplayStream)
+	}
+	admin.Get("/ingest-stats", adminHandler.GetIngestStats)
+	admin.Get("/ingest-errors", adminHandler.GetIngestErrors)
+	admin.Get("/migrations", adminHandler.GetMigrations)
+	admin.Get("/schema", adminHandler.GetSchema)
+	admin.Get("/assets/usage", assetHandler.GetUsage)
+	admin.Post("/backfills", adminHandler.StartBackfill)
+	admin.Post("/blob-cleanups", adminHandler.StartBlobCleanup)
+	admin.Post("/drain", adminHandler.Drain)
+	admin.Post("/sessions/:id/recompute", sessionIDParam, adminHandler.RecomputeSession)
+	admin.Post("/session-tokens", accessTokenHandler.MintSessionToken)
+	trackerKeyIDParam := middleware.UUIDParam("id", "tracker key ID")
+	admin.Post("/tracker-keys", trackerKeyHandler.CreateKey)
+	admin.Get("/tracker-keys", trackerKeyHandler.ListKeys)
+	admin.Post("/tracker-keys/:id/rotate", trackerKeyIDParam, trackerKeyHandler.RotateKey)
+	admin.Put("/tracker-keys/:id/throttles", trackerKeyIDParam, trackerKeyHandler.SetThrottles)
+	admin.Put("/tracker-keys/:id/sandbox", trackerKeyIDParam, trackerKeyHandler.SetSandbox)
+	admin.Put("/tracker-keys/:id/recording", trackerKeyIDParam, trackerKeyHandler.SetRecording)
+	admin.Get("/tracker-keys/:id/script", trackerKeyIDParam, trackerScriptHandler.GetScriptURL)
+	admin.Delete("/tracker-keys/:id", trackerKeyIDParam, trackerKeyHandler.RevokeKey)
+	apiKeyIDParam := middleware.UUIDParam("id", "API key ID")
+	admin.Post("/api-keys", apiKeyHandler.CreateKey)
+	admin.Get("/api-keys", apiKeyHandler.ListKeys)
+	admin.Post("/api-keys/:id/rotate", apiKeyIDParam, apiKeyHandler.RotateKey)
+	admin.Put("/api-keys/:id/scope", apiKeyIDParam, apiKeyHandler.SetScope)
+	admin.Delete("/api-keys/:id", apiKeyIDParam, apiKeyHandler.RevokeKey)
+	admin.Post("/url-rules", urlRuleHandler.CreateRule)
+	admin.Get("/url-rules", urlRuleHandler.ListRules)
+	admin.Get("/url-rules/preview", urlRuleHandler.PreviewRules)
+	admin.Delete("/url-rules/:id", middleware.UUIDParam("id", "URL rule ID"), urlRuleHandler.DeleteRule)
+	admin.Get("/event-schemas", eventSchemaHandler.ListSchemas)
+	admin.Put("/event-schemas", eventSchemaHandler.PutSchema)
+	admin.Delete("/event-schemas", eventSchemaHandler.DeleteSchema)
+	warehouseIDParam := middleware.UUIDParam("id", "warehouse connector ID")
+	admin.Post("/warehouse-connectors", warehouseHandler.CreateConnector)
+	admin.Get("/warehouse-connectors", warehouseHandler.ListConnectors)
+	admin.Get("/warehouse-connectors/:id", warehouseIDParam, warehouseHandler.GetConnector)
+	admin.Patch("/warehouse-connectors/:id", warehouseIDParam, warehouseHandler.UpdateConnector)
+	admin.Post("/warehouse-connectors/:id/reset", warehouseIDParam, warehouseHandler.ResetConnector)
+	admin.Delete("/warehouse-connectors/:id", warehouseIDParam, warehouseHandler.DeleteConnector)
+
+	// Background job status, shared by jobs, imports and exports
+	v1.Get("/jobs/:id", middleware.UUIDParam("id", "job ID"), jobHandler.GetJob)
+
+	// Analytics routes
+	analytics := v1.Group("/analytics")
+	analytics.Get("/overview", analyticsHandler.GetOverview)
+	analytics.Get("/timeseries", analyticsHandler.GetTimeseries)
+	analytics.Get("/breakdown", analyticsHandler.GetBreakdown)
+	analytics.Get("/sdk-versions", analyticsHandler.GetSDKVersions)
+
+	// Event catalog: what event types and event_data keys exist per project
+	v1.Get("/catalog", catalogHandler.GetCatalog)
+	v1.Get("/assets", assetHandler.GetAsset)
+
+	// API v2 routes: enveloped responses and cursor pagination
+	v2 := app.Group("/api/v2", middleware.APIVersion(handlersv2.Version))
+	v2Sessions := v2.Group("/sessions")
+	v2Sessions.Get("/", sessionHandlerV2.ListSessions)
+	v2Sessions.Get("/:id", sessionIDParam, sessionScope, sessionHandlerV2.GetSession)
+	v2Sessions.Get("/:id/events", sessionIDParam, sessionScope, sessionHandlerV2.GetSessionEvents)
 
 	// Start server in goroutine
 	addr := fmt.Sprintf("%s:%s", host, port)
@@ -251,23 +1012,82 @@ func main() {
 	time.Sleep(100 * time.Millisecond)
 	log.Printf("[DEBUG] Server startup sequence completed")
 
-	// Wait for interrupt signal for graceful shutdown
+	// SIGUSR1 starts a drain, like POST /api/v1/admin/drain
+	drainSignal := make(chan os.Signal, 1)
+	signal.Notify(drainSignal, syscall.SIGUSR1)
+	go func() {
+		<-drainSignal
+		if drainState.Start() {
+			log.Println("Drain requested by SIGUSR1")
+		}
+	}()
+
+	// Wait for interrupt signal or a drain for graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	select {
+	case <-quit:
+		drainState.Start()
+	case <-drainState.Started():
+		log.Println("Draining: rejecting new ingest requests")
+
+		// Give load balancers time to notice the failing health check
+		time.Sleep(getEnvAsDuration("DRAIN_DELAY", 5*time.Second))
+
+		if archiver != nil {
+			archiver.Flush(ctx)
+		}
+		// Only this instance's own work is waited for; the rest of the group's
+		// backlog is left to the other processors
+		processor.StopReading()
+		if drain.Wait(ctx, processor.Backlog, time.Second, getEnvAsDuration("DRAIN_TIMEOUT", 2*time.Minute)) {
+			log.Println("Draining: messages taken by this instance are processed")
+		} else {
+			log.Println("Draining: timed out with messages still pending, other processors reclaim them")
+		}
+	}
 
 	log.Println("Shutting down server...")
+	probe.Stop()
 
 	// Shutdown processor first
 	if err := processor.Stop(ctx); err != nil {
 		log.Printf("Error stopping processor: %v", err)
 	}
+	eventCatalog.Stop()
+	if kafkaQueue != nil {
+		if err := kafkaQueue.Close(); err != nil {
+			log.Printf("Error closing Kafka queue: %v", err)
+		}
+	}
+
+	clusterer.Stop()
+	jobRunner.Stop()
+	importWorker.Stop()
+	if exportWorker != nil {
+		exportScheduler.Stop()
+		exportWorker.Stop()
+	}
+	drops.Stop()
+	statsFlusher.Stop()
+	expirer.Stop()
+	sandboxPurger.Stop()
+	watcher.Stop()
+	alertEvaluator.Stop()
+	warehouseSyncer.Stop()
+	assetCache.Stop()
+	backpressure.Stop()
 
 	// Then shutdown HTTP server
 	if err := app.Shutdown(); err != nil {
 		log.Printf("Error shutting down server: %v", err)
 	}
 
+	// Archive payloads accepted while the server was draining
+	if archiver != nil {
+		archiver.Stop()
+	}
+
 	log.Println("Server shutdown complete")
 }
 
@@ -305,6 +1125,18 @@ func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 	return value
 }
 
+func storageConfigFromEnv() storage.Config {
+	return storage.Config{
+		Backend:           getEnv("BLOB_STORAGE", ""),
+		Dir:               getEnv("BLOB_STORAGE_DIR", "./data/blobs"),
+		S3Endpoint:        getEnv("S3_ENDPOINT", ""),
+		S3Region:          getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:          getEnv("S3_BUCKET", ""),
+		S3AccessKeyID:     getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey: getEnv("S3_SECRET_ACCESS_KEY", ""),
+	}
+}
+
 func getProjectRoot() string {
 	// Try to get current working directory
 	wd, err := os.Getwd()
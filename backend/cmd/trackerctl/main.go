@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// trackerctl manages API keys through the admin API of a running server, using
+// ADMIN_TOKEN from the environment or .env
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	command := flag.String("command", "list", "API key command: create, list, rotate, scope, or revoke")
+	baseURL := flag.String("url", getEnv("TRACKER_API_URL", "http://localhost:"+getEnv("PORT", "8085")), "Server base URL")
+	id := flag.String("id", "", "Key ID for 'rotate', 'scope' and 'revoke'")
+	name := flag.String("name", "", "Key name for 'create'")
+	scope := flag.String("scope", "ingest", "Key scope for 'create' and 'scope': ingest or read")
+	flag.Parse()
+
+	client := &adminClient{
+		baseURL: strings.TrimRight(*baseURL, "/") + "/api/v1/admin/api-keys",
+		token:   getEnv("ADMIN_TOKEN", ""),
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+	if client.token == "" {
+		log.Fatal("ADMIN_TOKEN is required")
+	}
+
+	var err error
+	switch *command {
+	case "create":
+		if *name == "" {
+			log.Fatal("Name is required for 'create' command. Use -name flag")
+		}
+		err = client.do(http.MethodPost, "", map[string]string{"name": *name, "scope": *scope})
+		if err == nil {
+			log.Println("Store the key now; it is not shown again")
+		}
+
+	case "list":
+		err = client.do(http.MethodGet, "", nil)
+
+	case "rotate":
+		requireID(*id, "rotate")
+		err = client.do(http.MethodPost, "/"+*id+"/rotate", nil)
+		if err == nil {
+			log.Println("The old key no longer works; store the new one now, it is not shown again")
+		}
+
+	case "scope":
+		requireID(*id, "scope")
+		err = client.do(http.MethodPut, "/"+*id+"/scope", map[string]string{"scope": *scope})
+
+	case "revoke":
+		requireID(*id, "revoke")
+		err = client.do(http.MethodDelete, "/"+*id, nil)
+		if err == nil {
+			log.Printf("Revoked API key %s", *id)
+		}
+
+	default:
+		log.Fatalf("Unknown command: %s. Use: create, list, rotate, scope, or revoke", *command)
+	}
+	if err != nil {
+		log.Fatalf("%s failed: %v", *command, err)
+	}
+}
+
+func requireID(id, command string) {
+	if id == "" {
+		log.Fatalf("Key ID is required for '%s' command. Use -id flag", command)
+	}
+}
+
+type adminClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// do sends a request to the API key endpoints and prints the JSON response
+func (a *adminClient) do(method, path string, body interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, a.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("server answered %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		out.Write(data)
+	}
+	fmt.Println(out.String())
+	return nil
+}
+
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
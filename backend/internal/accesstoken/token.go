@@ -0,0 +1,113 @@
+// Package accesstoken mints and verifies narrowly scoped, expiring read tokens, such
+// as "session:read:<id>", for embedded replay viewers and share links.
+package accesstoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Prefix marks scoped access tokens so they are not mistaken for role bearer tokens
+const Prefix = "st_"
+
+const sessionReadScope = "session:read:"
+
+var (
+	ErrMalformed = errors.New("malformed access token")
+	ErrSignature = errors.New("invalid access token signature")
+	ErrExpired   = errors.New("access token expired")
+)
+
+// SessionReadScope returns the scope granting read access to one session
+func SessionReadScope(sessionID uuid.UUID) string {
+	return sessionReadScope + sessionID.String()
+}
+
+// IsToken reports whether s looks like a scoped access token
+func IsToken(s string) bool {
+	return strings.HasPrefix(s, Prefix)
+}
+
+// Claims are the signed contents of a token
+type Claims struct {
+	Scope     string `json:"scope"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// SessionRead returns the session a session:read scope grants access to
+func (c *Claims) SessionRead() (uuid.UUID, bool) {
+	raw, ok := strings.CutPrefix(c.Scope, sessionReadScope)
+	if !ok {
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(raw)
+	return id, err == nil
+}
+
+// Signer signs tokens as "st_<base64url claims>.<base64url HMAC-SHA256>"
+type Signer struct {
+	secret []byte
+}
+
+// NewSigner returns nil for an empty secret: scoped access tokens are disabled
+func NewSigner(secret string) *Signer {
+	if secret == "" {
+		return nil
+	}
+	return &Signer{secret: []byte(secret)}
+}
+
+// Issue mints a token for scope valid for ttl
+func (s *Signer) Issue(scope string, ttl time.Duration, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(ttl).Truncate(time.Second)
+	payload, err := json.Marshal(Claims{
+		Scope:     scope,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to encode access token: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return Prefix + encoded + "." + s.sign(encoded), expiresAt, nil
+}
+
+// Verify checks the token's signature and expiry and returns its claims
+func (s *Signer) Verify(token string, now time.Time) (*Claims, error) {
+	encoded, sig, ok := strings.Cut(strings.TrimPrefix(token, Prefix), ".")
+	if !IsToken(token) || !ok {
+		return nil, ErrMalformed
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.sign(encoded))) {
+		return nil, ErrSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrMalformed
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrExpired
+	}
+	return &claims, nil
+}
+
+func (s *Signer) sign(encoded string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,162 @@
+// Package alerts evaluates alert rules on a schedule, tracks whether each is firing
+// and announces state changes to webhooks or Slack.
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/queue"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// Breached reports whether value compared with threshold by comparator holds
+func Breached(comparator string, value, threshold float64) bool {
+	switch comparator {
+	case models.AlertComparatorGT:
+		return value > threshold
+	case models.AlertComparatorGTE:
+		return value >= threshold
+	case models.AlertComparatorLT:
+		return value < threshold
+	case models.AlertComparatorLTE:
+		return value <= threshold
+	}
+	return false
+}
+
+// Evaluator evaluates the enabled alert rules every interval. A rule that breaches
+// its threshold starts firing and one that no longer does resolves; each change is
+// recorded and announced. A metric without data leaves the state as it is.
+type Evaluator struct {
+	repo       *repository.AlertRepository
+	eventQueue queue.Queue
+	notifier   *Notifier
+	interval   time.Duration
+	stopChan   chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewEvaluator creates an evaluator running every interval
+func NewEvaluator(repo *repository.AlertRepository, eventQueue queue.Queue, notifier *Notifier, interval time.Duration) *Evaluator {
+	return &Evaluator{
+		repo:       repo,
+		eventQueue: eventQueue,
+		notifier:   notifier,
+		interval:   interval,
+		stopChan:   make(chan struct{}),
+	}
+}
+
+// Start runs the evaluation loop in the background
+func (e *Evaluator) Start(ctx context.Context) {
+	e.wg.Add(1)
+	go e.run(ctx)
+}
+
+// Stop stops the loop
+func (e *Evaluator) Stop() {
+	close(e.stopChan)
+	e.wg.Wait()
+}
+
+func (e *Evaluator) run(ctx context.Context) {
+	defer e.wg.Done()
+
+	log.Printf("[Alerts] Evaluator started, interval: %v", e.interval)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stopChan:
+			log.Println("[Alerts] Evaluator stopped")
+			return
+		case <-ticker.C:
+			e.evaluateDue(ctx)
+		}
+	}
+}
+
+func (e *Evaluator) evaluateDue(ctx context.Context) {
+	// Claim slightly early so ticker jitter does not skip every other tick
+	rules, err := e.repo.ClaimDue(ctx, e.interval-e.interval/10)
+	if err != nil {
+		log.Printf("[Alerts] %v", err)
+		return
+	}
+	for _, rule := range rules {
+		if err := e.evaluate(ctx, rule); err != nil {
+			log.Printf("[Alerts] Failed to evaluate rule %s (%s): %v", rule.RuleID, rule.Name, err)
+		}
+	}
+}
+
+func (e *Evaluator) evaluate(ctx context.Context, rule *models.AlertRule) error {
+	value, err := e.measure(ctx, rule)
+	if err != nil {
+		return err
+	}
+
+	state := rule.State
+	if value != nil {
+		state = models.AlertStateOK
+		if Breached(rule.Comparator, *value, rule.Threshold) {
+			state = models.AlertStateFiring
+		}
+	}
+
+	event, err := e.repo.RecordEvaluation(ctx, rule, value, state)
+	if err != nil || event == nil {
+		return err
+	}
+
+	log.Printf("[Alerts] Rule %s (%s) is now %s", rule.RuleID, rule.Name, state)
+	notifyErr := e.notifier.Notify(ctx, rule, event)
+	if notifyErr != nil {
+		log.Printf("[Alerts] Notification for rule %s failed: %v", rule.RuleID, notifyErr)
+	}
+	return e.repo.RecordNotification(ctx, event.EventID, notifyErr)
+}
+
+// measure returns the rule's metric over its window, or nil without data
+func (e *Evaluator) measure(ctx context.Context, rule *models.AlertRule) (*float64, error) {
+	since := time.Now().Add(-rule.Window())
+
+	switch rule.Metric {
+	case models.AlertMetricQueueDepth:
+		backlog, err := e.eventQueue.GetBacklog(ctx)
+		if err != nil {
+			return nil, err
+		}
+		value := float64(backlog)
+		return &value, nil
+	case models.AlertMetricStreamLength:
+		length, err := e.eventQueue.GetQueueDepth(ctx)
+		if err != nil {
+			return nil, err
+		}
+		value := float64(length)
+		return &value, nil
+	case models.AlertMetricErrorRate:
+		return e.repo.ErrorRate(ctx, since)
+	case models.AlertMetricSessionsPerMinute:
+		sessions, err := e.repo.SessionsStarted(ctx, since)
+		if err != nil {
+			return nil, err
+		}
+		value := float64(sessions) / rule.Window().Minutes()
+		return &value, nil
+	case models.AlertMetricGoalConversion:
+		if rule.GoalURL == nil {
+			return nil, fmt.Errorf("goal_conversion rule without goal_url")
+		}
+		return e.repo.GoalConversion(ctx, since, *rule.GoalURL)
+	}
+	return nil, fmt.Errorf("unknown metric: %s", rule.Metric)
+}
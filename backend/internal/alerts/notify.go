@@ -0,0 +1,125 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// StateChanged is the body POSTed to webhooks when a rule starts firing or resolves
+type StateChanged struct {
+	Type          string    `json:"type"`
+	RuleID        uuid.UUID `json:"rule_id"`
+	Name          string    `json:"name"`
+	Metric        string    `json:"metric"`
+	Comparator    string    `json:"comparator"`
+	Threshold     float64   `json:"threshold"`
+	WindowSeconds int       `json:"window_seconds"`
+	State         string    `json:"state"`
+	Value         *float64  `json:"value"`
+	ChangedAt     time.Time `json:"changed_at"`
+}
+
+// Notifier announces alert state changes to the rule's notify URL, or a default URL.
+// Slack incoming webhook URLs get a Slack message instead of the JSON event.
+type Notifier struct {
+	defaultURL string
+	secret     string
+	client     *http.Client
+}
+
+// NewNotifier creates an alert notifier. When secret is set, webhook bodies are signed
+// with HMAC-SHA256 in the X-Tracker-Signature header.
+func NewNotifier(defaultURL, secret string, timeout time.Duration) *Notifier {
+	return &Notifier{
+		defaultURL: defaultURL,
+		secret:     secret,
+		client:     &http.Client{Timeout: timeout},
+	}
+}
+
+// Notify announces event. It is a no-op when neither the rule nor the notifier has
+// a URL.
+func (n *Notifier) Notify(ctx context.Context, rule *models.AlertRule, event *models.AlertEvent) error {
+	target := n.defaultURL
+	if rule.NotifyURL != nil && *rule.NotifyURL != "" {
+		target = *rule.NotifyURL
+	}
+	if target == "" {
+		return nil
+	}
+
+	change := StateChanged{
+		Type:          "alert." + event.State,
+		RuleID:        rule.RuleID,
+		Name:          rule.Name,
+		Metric:        rule.Metric,
+		Comparator:    rule.Comparator,
+		Threshold:     rule.Threshold,
+		WindowSeconds: rule.WindowSeconds,
+		State:         event.State,
+		Value:         event.Value,
+		ChangedAt:     event.CreatedAt,
+	}
+
+	var payload interface{} = change
+	if isSlackWebhook(target) {
+		payload = map[string]string{"text": slackText(change)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set("X-Tracker-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func isSlackWebhook(target string) bool {
+	u, err := url.Parse(target)
+	return err == nil && u.Host == "hooks.slack.com"
+}
+
+func slackText(c StateChanged) string {
+	value := "no data"
+	if c.Value != nil {
+		value = strconv.FormatFloat(*c.Value, 'g', 4, 64)
+	}
+	verb := "is firing"
+	if c.State == models.AlertStateOK {
+		verb = "resolved"
+	}
+	return fmt.Sprintf("Alert %q %s: %s is %s (%s %s over %ds) at %s", c.Name, verb, c.Metric, value,
+		c.Comparator, strconv.FormatFloat(c.Threshold, 'g', 4, 64), c.WindowSeconds, c.ChangedAt.UTC().Format(time.RFC3339))
+}
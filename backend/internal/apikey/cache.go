@@ -0,0 +1,103 @@
+// Package apikey authenticates the secret API keys of server-side callers.
+package apikey
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// touchInterval is how often a key's last use is written while it is in use
+const touchInterval = time.Minute
+
+type entry struct {
+	key       *models.APIKey
+	fetchedAt time.Time
+}
+
+// Cache resolves API keys, caching valid ones for ttl so rotation and revocation take
+// effect within ttl without a database query per request. Unknown keys are not
+// cached, so guessing cannot grow the cache. Last use is written at most once per
+// touchInterval per key.
+type Cache struct {
+	repo *repository.APIKeyRepository
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	keys    map[string]entry
+	touched map[uuid.UUID]time.Time
+}
+
+func NewCache(repo *repository.APIKeyRepository, ttl time.Duration) *Cache {
+	return &Cache{
+		repo:    repo,
+		ttl:     ttl,
+		keys:    make(map[string]entry),
+		touched: make(map[uuid.UUID]time.Time),
+	}
+}
+
+// Authenticate returns the unrevoked key with this secret, or nil when there is none
+func (c *Cache) Authenticate(ctx context.Context, secret string) (*models.APIKey, error) {
+	hash := repository.HashAPIKey(secret)
+
+	c.mu.Lock()
+	cached, ok := c.keys[hash]
+	c.mu.Unlock()
+
+	key := cached.key
+	if !ok || time.Since(cached.fetchedAt) > c.ttl {
+		var err error
+		key, err = c.repo.GetActiveByKey(ctx, secret)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.mu.Lock()
+			delete(c.keys, hash)
+			c.mu.Unlock()
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		c.keys[hash] = entry{key: key, fetchedAt: time.Now()}
+		c.mu.Unlock()
+	}
+
+	c.touch(ctx, key.KeyID)
+	return key, nil
+}
+
+// touch records the key's use unless it was recorded within touchInterval. A failed
+// write is only logged: it must not fail the request.
+func (c *Cache) touch(ctx context.Context, keyID uuid.UUID) {
+	c.mu.Lock()
+	if time.Since(c.touched[keyID]) < touchInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.touched[keyID] = time.Now()
+	c.mu.Unlock()
+
+	if err := c.repo.TouchLastUsed(ctx, keyID); err != nil {
+		log.Printf("[APIKey] Failed to record use of key %s: %v", keyID, err)
+	}
+}
+
+// Forget drops the cached state of a key after it was rotated, rescoped or revoked
+// through this instance
+func (c *Cache) Forget(keyID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for hash, cached := range c.keys {
+		if cached.key.KeyID == keyID {
+			delete(c.keys, hash)
+		}
+	}
+}
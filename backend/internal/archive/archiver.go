@@ -0,0 +1,226 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/encrypt"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/storage"
+)
+
+// Config holds configuration for the payload archiver
+type Config struct {
+	// Prefix is the object key prefix, e.g. "archive/track"
+	Prefix        string
+	FlushInterval time.Duration
+	// MaxBytes triggers an early flush once an hour's buffer grows past it
+	MaxBytes int
+	// Recipient, when set, encrypts every archive object for its public key
+	Recipient *encrypt.Recipient
+}
+
+// Record is one accepted /track payload as archived, one JSON object per line
+type Record struct {
+	SessionID  uuid.UUID          `json:"session_id"`
+	ReceivedAt time.Time          `json:"received_at"`
+	Events     []models.EventData `json:"events"`
+}
+
+// Archiver tees accepted payloads to an append-only log in blob storage. Records are
+// buffered per hour and written as new gzip objects under <prefix>/YYYY/MM/DD/HH/,
+// since object stores cannot append to an existing object.
+type Archiver struct {
+	store    storage.Store
+	config   Config
+	instance string
+	mu       sync.Mutex
+	buffers  map[time.Time]*bytes.Buffer
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewArchiver creates a new archiver writing to store
+func NewArchiver(store storage.Store, config Config) *Archiver {
+	instance, err := os.Hostname()
+	if err != nil || instance == "" {
+		instance = "server"
+	}
+
+	return &Archiver{
+		store:    store,
+		config:   config,
+		instance: instance,
+		buffers:  make(map[time.Time]*bytes.Buffer),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Append buffers a payload for archiving. A nil *Archiver is a no-op.
+func (a *Archiver) Append(sessionID uuid.UUID, events []models.EventData) {
+	if a == nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	line, err := json.Marshal(Record{SessionID: sessionID, ReceivedAt: now, Events: events})
+	if err != nil {
+		log.Printf("[Archiver] Failed to marshal payload for session %s: %v", sessionID, err)
+		return
+	}
+
+	hour := now.Truncate(time.Hour)
+
+	a.mu.Lock()
+	buf, ok := a.buffers[hour]
+	if !ok {
+		buf = &bytes.Buffer{}
+		a.buffers[hour] = buf
+	}
+	buf.Write(line)
+	buf.WriteByte('\n')
+	full := a.config.MaxBytes > 0 && buf.Len() >= a.config.MaxBytes
+	if full {
+		delete(a.buffers, hour)
+	}
+	a.mu.Unlock()
+
+	if full {
+		// Write outside the request path; the buffer is no longer shared
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.write(context.Background(), hour, buf)
+		}()
+	}
+}
+
+// Start runs the periodic flush loop in the background
+func (a *Archiver) Start(ctx context.Context) {
+	a.wg.Add(1)
+	go a.run(ctx)
+}
+
+// Stop flushes all buffered payloads and stops the archiver
+func (a *Archiver) Stop() {
+	close(a.stopChan)
+	a.wg.Wait()
+}
+
+// Flush writes all buffered payloads now, e.g. while the server drains
+func (a *Archiver) Flush(ctx context.Context) {
+	a.flush(ctx)
+}
+
+func (a *Archiver) run(ctx context.Context) {
+	defer a.wg.Done()
+
+	log.Printf("[Archiver] Started, flush interval: %v, prefix: %s", a.config.FlushInterval, a.config.Prefix)
+
+	ticker := time.NewTicker(a.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stopChan:
+			a.flush(context.Background())
+			log.Println("[Archiver] Stopped")
+			return
+		case <-ticker.C:
+			a.flush(ctx)
+		}
+	}
+}
+
+// flush writes and clears every hour's buffer
+func (a *Archiver) flush(ctx context.Context) {
+	a.mu.Lock()
+	buffers := a.buffers
+	a.buffers = make(map[time.Time]*bytes.Buffer)
+	a.mu.Unlock()
+
+	for hour, buf := range buffers {
+		a.write(ctx, hour, buf)
+	}
+}
+
+// write stores one gzip object. On failure the records are re-queued so they are
+// retried with the next flush instead of being dropped.
+func (a *Archiver) write(ctx context.Context, hour time.Time, buf *bytes.Buffer) {
+	if buf.Len() == 0 {
+		return
+	}
+
+	compressed, err := a.encode(buf.Bytes())
+	if err != nil {
+		log.Printf("[Archiver] Failed to encode archive: %v", err)
+		return
+	}
+
+	contentType := "application/gzip"
+	if a.config.Recipient != nil {
+		contentType = "application/octet-stream"
+	}
+
+	key := a.objectKey(hour, time.Now().UTC())
+	if err := a.store.Put(ctx, key, compressed.Bytes(), contentType); err != nil {
+		log.Printf("[Archiver] Failed to write %s, will retry: %v", key, err)
+		a.mu.Lock()
+		if pending, ok := a.buffers[hour]; ok {
+			buf.Write(pending.Bytes())
+		}
+		a.buffers[hour] = buf
+		a.mu.Unlock()
+		return
+	}
+
+	log.Printf("[Archiver] Wrote %s (%d bytes raw, %d compressed)", key, buf.Len(), compressed.Len())
+}
+
+// encode gzips the records and, with a configured recipient, encrypts the result
+func (a *Archiver) encode(records []byte) (*bytes.Buffer, error) {
+	var out bytes.Buffer
+	var sink io.Writer = &out
+	var sealer io.WriteCloser
+	if a.config.Recipient != nil {
+		s, err := a.config.Recipient.NewWriter(&out)
+		if err != nil {
+			return nil, err
+		}
+		sealer, sink = s, s
+	}
+
+	gz := gzip.NewWriter(sink)
+	if _, err := gz.Write(records); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if sealer != nil {
+		if err := sealer.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return &out, nil
+}
+
+// objectKey partitions archives by hour; the instance name and write time keep keys
+// unique across servers and flushes
+func (a *Archiver) objectKey(hour, now time.Time) string {
+	name := fmt.Sprintf("%s-%d.ndjson.gz", a.instance, now.UnixNano())
+	if a.config.Recipient != nil {
+		name += a.config.Recipient.Extension()
+	}
+	return path.Join(a.config.Prefix, hour.Format("2006/01/02/15"), name)
+}
@@ -0,0 +1,408 @@
+// Package assets keeps copies of the stylesheets, images and fonts pages referenced
+// when their screenshots were taken, so replays still render after the site changes,
+// and serves them through a proxy that fetches what it has not cached yet.
+package assets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/storage"
+	"github.com/ngocp/user-tracker/internal/validation"
+)
+
+var (
+	// ErrNotAllowed is returned for URLs that are not http(s) or whose host is not in
+	// the asset domains
+	ErrNotAllowed = errors.New("asset URL not allowed")
+	// ErrTooLarge is returned for assets larger than Config.MaxBytes
+	ErrTooLarge = errors.New("asset too large")
+	// ErrUnsupportedType is returned for responses that are not CSS, images or fonts
+	ErrUnsupportedType = errors.New("unsupported asset type")
+)
+
+// Config configures the asset cache
+type Config struct {
+	// Prefix is the blob storage prefix assets are stored under
+	Prefix string
+	// MaxBytes caps the size of one asset
+	MaxBytes int64
+	// QuotaBytes caps the total size of a project's assets; the least recently used
+	// ones are evicted to make room
+	QuotaBytes int64
+	// MaxPerPage caps the assets taken from one screenshot
+	MaxPerPage int
+	// Workers fetch assets queued from screenshots; QueueSize bounds the backlog, and
+	// assets queued beyond it are skipped
+	Workers   int
+	QueueSize int
+	// Timeout bounds each fetch
+	Timeout time.Duration
+}
+
+type fetchJob struct {
+	project string
+	url     string
+	// nested is set for assets referenced by a cached stylesheet, whose own
+	// references are not followed
+	nested bool
+}
+
+// Cache fetches assets into blob storage and serves them back
+type Cache struct {
+	repo    *repository.AssetRepository
+	store   storage.Store
+	domains *validation.DomainPolicy
+	client  *http.Client
+	config  Config
+
+	jobs     chan fetchJob
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	// quotaMu serializes evictions so concurrent fetches do not overshoot a quota
+	quotaMu sync.Mutex
+}
+
+// NewCache creates an asset cache fetching from the hosts domains allows
+func NewCache(repo *repository.AssetRepository, store storage.Store, domains *validation.DomainPolicy, config Config) *Cache {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: publicOnly}
+	client := &http.Client{
+		Timeout: config.Timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConnsPerHost: 4,
+		},
+	}
+	c := &Cache{
+		repo:     repo,
+		store:    store,
+		domains:  domains,
+		config:   config,
+		jobs:     make(chan fetchJob, config.QueueSize),
+		stopChan: make(chan struct{}),
+	}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		if !c.allowed(req.URL) {
+			return ErrNotAllowed
+		}
+		return nil
+	}
+	c.client = client
+	return c
+}
+
+// publicOnly refuses connections to loopback, private and link-local addresses, so
+// page-supplied URLs cannot reach the server's own network
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return fmt.Errorf("%w: %s is not a public address", ErrNotAllowed, host)
+	}
+	return nil
+}
+
+// Hash returns the cache key of an absolute asset URL
+func Hash(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cache) allowed(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && c.domains.Allows(u.String())
+}
+
+// normalize resolves ref against base and drops its fragment; ok is false for URLs
+// the cache does not fetch
+func (c *Cache) normalize(base *url.URL, ref string) (string, bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "data:") {
+		return "", false
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", false
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	u.Fragment = ""
+	if !c.allowed(u) {
+		return "", false
+	}
+	return u.String(), true
+}
+
+// Start runs the fetch workers in the background
+func (c *Cache) Start(ctx context.Context) {
+	for i := 0; i < c.config.Workers; i++ {
+		c.wg.Add(1)
+		go c.work(ctx)
+	}
+	log.Printf("[AssetCache] Started %d workers, quota %d bytes per project", c.config.Workers, c.config.QuotaBytes)
+}
+
+// Stop stops the workers; queued assets not fetched yet are dropped. Safe to call on
+// a nil cache.
+func (c *Cache) Stop() {
+	if c == nil {
+		return
+	}
+	close(c.stopChan)
+	c.wg.Wait()
+	log.Println("[AssetCache] Stopped")
+}
+
+func (c *Cache) work(ctx context.Context) {
+	defer c.wg.Done()
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case job := <-c.jobs:
+			c.prefetch(ctx, job)
+		}
+	}
+}
+
+// Enqueue queues the assets a page referenced to be cached for project, skipping
+// those it cannot queue. Safe to call on a nil cache.
+func (c *Cache) Enqueue(project, pageURL string, refs []string) {
+	if c == nil || len(refs) == 0 {
+		return
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return
+	}
+	c.enqueue(project, base, refs, false)
+}
+
+func (c *Cache) enqueue(project string, base *url.URL, refs []string, nested bool) {
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		if len(seen) >= c.config.MaxPerPage {
+			break
+		}
+		u, ok := c.normalize(base, ref)
+		if !ok || seen[u] {
+			continue
+		}
+		seen[u] = true
+
+		select {
+		case c.jobs <- fetchJob{project: project, url: u, nested: nested}:
+		default:
+			log.Printf("[AssetCache] Queue full, skipping %s", u)
+			return
+		}
+	}
+}
+
+// prefetch caches a queued asset unless it is cached already
+func (c *Cache) prefetch(ctx context.Context, job fetchJob) {
+	exists, err := c.repo.Exists(ctx, job.project, Hash(job.url))
+	if err != nil {
+		log.Printf("[AssetCache] %v", err)
+		return
+	}
+	if exists {
+		return
+	}
+
+	asset, data, err := c.fetch(ctx, job.project, job.url)
+	if err != nil {
+		log.Printf("[AssetCache] Failed to cache %s: %v", job.url, err)
+		return
+	}
+	if !job.nested && asset.ContentType == "text/css" {
+		base, _ := url.Parse(job.url)
+		c.enqueue(job.project, base, cssReferences(data), true)
+	}
+}
+
+// Get returns a cached asset of project with its content, fetching and caching it
+// when it is not cached yet. It reports whether the asset came from the cache.
+func (c *Cache) Get(ctx context.Context, project, rawURL string) (*models.ReplayAsset, []byte, bool, error) {
+	u, ok := c.normalize(nil, rawURL)
+	if !ok {
+		return nil, nil, false, ErrNotAllowed
+	}
+
+	asset, err := c.repo.Get(ctx, project, Hash(u))
+	if err == nil {
+		data, err := c.store.Get(ctx, asset.StorageKey)
+		if err == nil {
+			return asset, data, true, nil
+		}
+		log.Printf("[AssetCache] Cached asset %s is unreadable, fetching it again: %v", u, err)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, false, err
+	}
+
+	asset, data, err := c.fetch(ctx, project, u)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return asset, data, false, nil
+}
+
+// fetch downloads an asset, stores it and records it, evicting the project's least
+// recently used assets when it would exceed the quota
+func (c *Cache) fetch(ctx context.Context, project, rawURL string) (*models.ReplayAsset, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	contentType, ok := assetType(resp.Header.Get("Content-Type"))
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedType, resp.Header.Get("Content-Type"))
+	}
+	if resp.ContentLength > c.config.MaxBytes {
+		return nil, nil, ErrTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, c.config.MaxBytes+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(data)) > c.config.MaxBytes {
+		return nil, nil, ErrTooLarge
+	}
+
+	hash := Hash(rawURL)
+	asset := &models.ReplayAsset{
+		Project:     project,
+		URLHash:     hash,
+		URL:         rawURL,
+		StorageKey:  path.Join(c.config.Prefix, project, hash),
+		ContentType: contentType,
+		SizeBytes:   int64(len(data)),
+	}
+
+	c.quotaMu.Lock()
+	defer c.quotaMu.Unlock()
+
+	if err := c.makeRoom(ctx, project, asset.SizeBytes); err != nil {
+		return nil, nil, err
+	}
+	if err := c.store.Put(ctx, asset.StorageKey, data, contentType); err != nil {
+		return nil, nil, fmt.Errorf("failed to store asset: %w", err)
+	}
+	if err := c.repo.Save(ctx, asset); err != nil {
+		c.store.Delete(ctx, asset.StorageKey)
+		return nil, nil, err
+	}
+	return asset, data, nil
+}
+
+// makeRoom evicts project's least recently used assets until size more bytes fit in
+// its quota
+func (c *Cache) makeRoom(ctx context.Context, project string, size int64) error {
+	if size > c.config.QuotaBytes {
+		return ErrTooLarge
+	}
+	used, err := c.repo.SizeBytes(ctx, project)
+	if err != nil {
+		return err
+	}
+	for used+size > c.config.QuotaBytes {
+		victims, err := c.repo.LeastRecentlyUsed(ctx, project, 50)
+		if err != nil {
+			return err
+		}
+		if len(victims) == 0 {
+			return nil
+		}
+		for _, victim := range victims {
+			if err := c.store.Delete(ctx, victim.StorageKey); err != nil {
+				return fmt.Errorf("failed to evict asset: %w", err)
+			}
+			if err := c.repo.Delete(ctx, project, victim.URLHash); err != nil {
+				return err
+			}
+			used -= victim.SizeBytes
+			if used+size <= c.config.QuotaBytes {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// Usage returns each project's cached assets with the quota
+func (c *Cache) Usage(ctx context.Context) ([]*models.AssetUsage, error) {
+	usage, err := c.repo.Usage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range usage {
+		u.QuotaBytes = c.config.QuotaBytes
+	}
+	return usage, nil
+}
+
+// assetType returns the media type of a Content-Type header when it is CSS, an image
+// or a font
+func assetType(header string) (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return "", false
+	}
+	switch {
+	case mediaType == "text/css",
+		strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "font/"),
+		mediaType == "application/font-woff", mediaType == "application/x-font-woff",
+		mediaType == "application/x-font-ttf", mediaType == "application/vnd.ms-fontobject":
+		return mediaType, true
+	}
+	return "", false
+}
+
+var cssURLPattern = regexp.MustCompile(`url\(\s*['"]?([^'")\s]+)['"]?\s*\)|@import\s+['"]([^'"]+)['"]`)
+
+// cssReferences returns the URLs a stylesheet refers to with url() and @import
+func cssReferences(css []byte) []string {
+	var refs []string
+	for _, m := range cssURLPattern.FindAllSubmatch(css, -1) {
+		if len(m[1]) > 0 {
+			refs = append(refs, string(m[1]))
+		} else if len(m[2]) > 0 {
+			refs = append(refs, string(m[2]))
+		}
+	}
+	return refs
+}
@@ -0,0 +1,264 @@
+// Package canary runs a synthetic session through the public ingest path (HTTP, the
+// event queue, the processor and the database) and measures how long its events take
+// to become readable.
+package canary
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// SDK identifies canary requests in the X-Tracker-SDK header
+const SDK = "canary/1.0"
+
+// pollInterval is how often the database is checked for the canary's events
+const pollInterval = 100 * time.Millisecond
+
+// Config controls the canary probes
+type Config struct {
+	// BaseURL is the server's own address, e.g. http://127.0.0.1:8080
+	BaseURL  string
+	Interval time.Duration
+	// SLO is the longest a tracked event may take to be persisted; slower probes fail
+	SLO time.Duration
+	// PageURL must pass the page domain allowlist
+	PageURL string
+	// PublicKey is exchanged for a tracker token when tracker tokens are required
+	PublicKey string
+	Origin    string
+	// Consent is sent as the consent string when consent is required
+	Consent string
+}
+
+// Status is the outcome of the canary probes since the process started
+type Status struct {
+	Enabled             bool       `json:"enabled"`
+	Healthy             bool       `json:"healthy"`
+	SLOMs               int64      `json:"slo_ms"`
+	LastRunAt           *time.Time `json:"last_run_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	LastLatencyMs       *int64     `json:"last_latency_ms,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	Runs                int64      `json:"runs"`
+	Failures            int64      `json:"failures"`
+	ConsecutiveFailures int64      `json:"consecutive_failures"`
+}
+
+// Canary periodically creates a synthetic session, tracks an event for it over HTTP
+// and waits for the event to reach the database. The session is deleted afterwards.
+// A nil *Canary reports a disabled status.
+type Canary struct {
+	config   Config
+	client   *http.Client
+	sessions *repository.SessionRepository
+	events   *repository.EventRepository
+
+	mu     sync.Mutex
+	status Status
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New creates a canary probing every config.Interval
+func New(config Config, sessions *repository.SessionRepository, events *repository.EventRepository) *Canary {
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	return &Canary{
+		config:   config,
+		client:   &http.Client{Timeout: config.SLO},
+		sessions: sessions,
+		events:   events,
+		status:   Status{Enabled: true, SLOMs: config.SLO.Milliseconds()},
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Status returns the latest probe results
+func (c *Canary) Status() Status {
+	if c == nil {
+		return Status{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// Start runs the probe loop in the background; the first probe runs after one interval
+// so the server is listening by then
+func (c *Canary) Start(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	c.wg.Add(1)
+	go c.run(ctx)
+}
+
+// Stop stops the loop
+func (c *Canary) Stop() {
+	if c == nil {
+		return
+	}
+	close(c.stopChan)
+	c.wg.Wait()
+}
+
+func (c *Canary) run(ctx context.Context) {
+	defer c.wg.Done()
+
+	log.Printf("[Canary] Started, interval: %v, SLO: %v", c.config.Interval, c.config.SLO)
+
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			log.Println("[Canary] Stopped")
+			return
+		case <-ticker.C:
+			c.record(c.probe(ctx))
+		}
+	}
+}
+
+func (c *Canary) record(latency time.Duration, err error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status.Runs++
+	c.status.LastRunAt = &now
+	if err != nil {
+		log.Printf("[Canary] Probe failed: %v", err)
+		c.status.Healthy = false
+		c.status.Failures++
+		c.status.ConsecutiveFailures++
+		c.status.LastError = err.Error()
+		return
+	}
+
+	ms := latency.Milliseconds()
+	c.status.Healthy = true
+	c.status.ConsecutiveFailures = 0
+	c.status.LastError = ""
+	c.status.LastSuccessAt = &now
+	c.status.LastLatencyMs = &ms
+}
+
+// probe sends one synthetic session and event and returns the time from the /track
+// request until the event was readable
+func (c *Canary) probe(ctx context.Context) (time.Duration, error) {
+	headers := map[string]string{"X-Tracker-SDK": SDK}
+	if c.config.Origin != "" {
+		headers["Origin"] = c.config.Origin
+	}
+	if c.config.Consent != "" {
+		headers["X-Tracker-Consent"] = c.config.Consent
+	}
+	if c.config.PublicKey != "" {
+		var token struct {
+			Token string `json:"token"`
+		}
+		if err := c.post(ctx, "/api/v1/track/token", headers, map[string]string{"public_key": c.config.PublicKey}, &token); err != nil {
+			return 0, fmt.Errorf("tracker token: %w", err)
+		}
+		headers["X-Tracker-Token"] = token.Token
+	}
+
+	var session struct {
+		SessionID uuid.UUID `json:"session_id"`
+	}
+	err := c.post(ctx, "/api/v1/sessions", headers, map[string]interface{}{
+		"page_url": c.config.PageURL,
+		"metadata": map[string]interface{}{"synthetic": true},
+	}, &session)
+	if err != nil {
+		return 0, fmt.Errorf("create session: %w", err)
+	}
+	defer func() {
+		if err := c.sessions.Delete(context.WithoutCancel(ctx), session.SessionID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			log.Printf("[Canary] Failed to delete session %s: %v", session.SessionID, err)
+		}
+	}()
+
+	start := time.Now()
+	err = c.post(ctx, "/api/v1/track", headers, map[string]interface{}{
+		"session_id": session.SessionID,
+		"events": []map[string]interface{}{{
+			"timestamp":  start.UTC(),
+			"event_type": "navigation",
+			"page_url":   c.config.PageURL,
+		}},
+	}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("track: %w", err)
+	}
+
+	deadline := start.Add(c.config.SLO)
+	for {
+		count, _, err := c.events.CountBySessionID(ctx, session.SessionID, "", 0)
+		if err != nil {
+			return 0, fmt.Errorf("read events: %w", err)
+		}
+		if count > 0 {
+			return time.Since(start), nil
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("event not persisted within %v", c.config.SLO)
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// post sends body as JSON to path and decodes a 2xx response into out when set
+func (c *Canary) post(ctx context.Context, path string, headers map[string]string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
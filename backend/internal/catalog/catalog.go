@@ -0,0 +1,157 @@
+// Package catalog keeps the event catalog: which event types and event_data keys each
+// project actually sends, how often, and when they were first and last seen.
+package catalog
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// maxPending bounds the distinct entries held between flushes, so sites that use
+// unbounded event_data keys (IDs as keys) cannot grow memory; entries beyond it are
+// left out of the catalog until the next flush
+const maxPending = 10000
+
+// maxKeyLength is the longest event_data key kept, matching event_catalog.data_key
+const maxKeyLength = 255
+
+type entryKey struct {
+	project   string
+	eventType string
+	key       string
+}
+
+// Recorder counts observed event types and event_data keys in memory and adds them to
+// the catalog every interval. A nil *Recorder records nothing.
+type Recorder struct {
+	repo     *repository.CatalogRepository
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[entryKey]*models.CatalogEntry
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewRecorder creates a recorder flushing to repo every interval
+func NewRecorder(repo *repository.CatalogRepository, interval time.Duration) *Recorder {
+	return &Recorder{
+		repo:     repo,
+		interval: interval,
+		pending:  make(map[entryKey]*models.CatalogEntry),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Observe counts persisted events of project by type and top-level event_data key
+func (r *Recorder) Observe(project string, events []models.EventData) {
+	if r == nil || len(events) == 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, event := range events {
+		eventType := string(event.EventType)
+		r.add(entryKey{project, eventType, ""}, now)
+		for key := range event.EventData {
+			if key != "" && len(key) <= maxKeyLength {
+				r.add(entryKey{project, eventType, key}, now)
+			}
+		}
+	}
+}
+
+func (r *Recorder) add(k entryKey, seenAt time.Time) {
+	entry, ok := r.pending[k]
+	if !ok {
+		if len(r.pending) >= maxPending {
+			return
+		}
+		entry = &models.CatalogEntry{
+			Project:     k.project,
+			EventType:   k.eventType,
+			Key:         k.key,
+			FirstSeenAt: seenAt,
+		}
+		r.pending[k] = entry
+	}
+	entry.Count++
+	entry.LastSeenAt = seenAt
+}
+
+// Start runs the flush loop in the background
+func (r *Recorder) Start(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	r.wg.Add(1)
+	go r.run(ctx)
+}
+
+// Stop flushes one last time and stops the loop
+func (r *Recorder) Stop() {
+	if r == nil {
+		return
+	}
+	close(r.stopChan)
+	r.wg.Wait()
+}
+
+func (r *Recorder) run(ctx context.Context) {
+	defer r.wg.Done()
+
+	log.Printf("[Catalog] Recorder started, interval: %v", r.interval)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stopChan:
+			r.flush(ctx)
+			log.Println("[Catalog] Recorder stopped")
+			return
+		case <-ticker.C:
+			r.flush(ctx)
+		}
+	}
+}
+
+// flush adds the pending counts to the catalog. Counts the database refuses are
+// merged back and retried on the next tick.
+func (r *Recorder) flush(ctx context.Context) {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[entryKey]*models.CatalogEntry)
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	entries := make([]models.CatalogEntry, 0, len(pending))
+	for _, entry := range pending {
+		entries = append(entries, *entry)
+	}
+	if err := r.repo.Add(ctx, entries); err != nil {
+		log.Printf("[Catalog] Failed to update catalog with %d entries, retrying later: %v", len(entries), err)
+		r.mu.Lock()
+		for k, entry := range pending {
+			if current, ok := r.pending[k]; ok {
+				current.Count += entry.Count
+				current.FirstSeenAt = entry.FirstSeenAt
+			} else if len(r.pending) < maxPending {
+				r.pending[k] = entry
+			}
+		}
+		r.mu.Unlock()
+	}
+}
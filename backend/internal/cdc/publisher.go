@@ -0,0 +1,62 @@
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// SchemaVersion is bumped whenever the Envelope layout changes incompatibly
+const SchemaVersion = 1
+
+// EventTypePersisted is the envelope type emitted after events are stored
+const EventTypePersisted = "events.persisted"
+
+// Envelope is the documented payload published for every persisted batch:
+//
+//	{
+//	  "schema_version": 1,
+//	  "type": "events.persisted",
+//	  "session_id": "<uuid>",
+//	  "published_at": "<RFC3339>",
+//	  "events": [ <models.EventData>, ... ]
+//	}
+type Envelope struct {
+	SchemaVersion int                `json:"schema_version"`
+	Type          string             `json:"type"`
+	SessionID     uuid.UUID          `json:"session_id"`
+	PublishedAt   time.Time          `json:"published_at"`
+	Events        []models.EventData `json:"events"`
+}
+
+// Publisher delivers persisted event batches to a downstream system
+type Publisher interface {
+	Publish(ctx context.Context, envelope *Envelope) error
+}
+
+// NewEnvelope builds the envelope for a session's persisted events
+func NewEnvelope(sessionID uuid.UUID, events []models.EventData) *Envelope {
+	return &Envelope{
+		SchemaVersion: SchemaVersion,
+		Type:          EventTypePersisted,
+		SessionID:     sessionID,
+		PublishedAt:   time.Now().UTC(),
+		Events:        events,
+	}
+}
+
+// MultiPublisher fans an envelope out to several publishers
+type MultiPublisher []Publisher
+
+// Publish delivers to every publisher and returns the first error encountered
+func (mp MultiPublisher) Publish(ctx context.Context, envelope *Envelope) error {
+	var firstErr error
+	for _, p := range mp {
+		if err := p.Publish(ctx, envelope); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
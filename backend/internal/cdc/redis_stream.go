@@ -0,0 +1,51 @@
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStreamPublisher appends each envelope to an outbound Redis stream that
+// downstream consumers can read with their own consumer groups
+type RedisStreamPublisher struct {
+	redis     *redis.Client
+	streamKey string
+	maxLen    int64
+}
+
+// NewRedisStreamPublisher creates a publisher writing to streamKey
+func NewRedisStreamPublisher(client *redis.Client, streamKey string, maxLen int64) *RedisStreamPublisher {
+	return &RedisStreamPublisher{
+		redis:     client,
+		streamKey: streamKey,
+		maxLen:    maxLen,
+	}
+}
+
+// Publish adds the envelope to the stream
+func (rp *RedisStreamPublisher) Publish(ctx context.Context, envelope *Envelope) error {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+
+	args := &redis.XAddArgs{
+		Stream: rp.streamKey,
+		MaxLen: rp.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"type":       envelope.Type,
+			"session_id": envelope.SessionID.String(),
+			"data":       string(data),
+		},
+	}
+
+	if err := rp.redis.XAdd(ctx, args).Err(); err != nil {
+		return fmt.Errorf("failed to publish to stream: %w", err)
+	}
+
+	return nil
+}
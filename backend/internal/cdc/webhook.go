@@ -0,0 +1,63 @@
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookPublisher POSTs each envelope as JSON to a fixed URL
+type WebhookPublisher struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookPublisher creates a webhook publisher. When secret is set, the body is
+// signed with HMAC-SHA256 and sent in the X-Tracker-Signature header.
+func NewWebhookPublisher(url, secret string, timeout time.Duration) *WebhookPublisher {
+	return &WebhookPublisher{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Publish sends the envelope to the webhook
+func (wp *WebhookPublisher) Publish(ctx context.Context, envelope *Envelope) error {
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wp.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tracker-Schema-Version", fmt.Sprintf("%d", envelope.SchemaVersion))
+
+	if wp.secret != "" {
+		mac := hmac.New(sha256.New, []byte(wp.secret))
+		mac.Write(body)
+		req.Header.Set("X-Tracker-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := wp.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,252 @@
+// Package consent decodes IAB TCF v2 and GPP consent strings into the data
+// categories the tracker may collect.
+package consent
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// Consent states stored on sessions
+const (
+	StateGranted    = "granted"
+	StateRestricted = "restricted"
+	StateDenied     = "denied"
+)
+
+// TCF purposes the tracker relies on
+const (
+	purposeStoreAccess      = 1  // Store and/or access information on a device
+	purposeMeasureContent   = 8  // Measure content performance
+	purposeImproveServices  = 10 // Develop and improve services
+	tcfPurposeConsentOffset = 152
+	tcfPurposeCount         = 24
+	gppHeaderType           = 3
+	gppSectionTCFEUv2       = 2
+	maxFibonacciBits        = 64
+)
+
+// ErrInvalid is returned for consent strings that cannot be decoded
+var ErrInvalid = errors.New("invalid consent string")
+
+// Policy lists what may be collected under a consent string
+type Policy struct {
+	// Events allows recording interaction events at all
+	Events bool
+	// InputValues allows keeping typed input values and pressed keys
+	InputValues bool
+	// Screenshots allows storing page screenshots
+	Screenshots bool
+}
+
+// Granted is the policy when no consent restrictions apply
+var Granted = Policy{Events: true, InputValues: true, Screenshots: true}
+
+// State summarizes the policy for storage on the session
+func (p Policy) State() string {
+	switch {
+	case p == Granted:
+		return StateGranted
+	case !p.Events:
+		return StateDenied
+	default:
+		return StateRestricted
+	}
+}
+
+// Apply filters a batch under the policy: everything is dropped without event consent,
+// and input values and pressed keys are stripped without input consent. It returns
+// the events to keep and how many were dropped.
+func (p Policy) Apply(events []models.EventData) ([]models.EventData, int) {
+	if !p.Events {
+		return nil, len(events)
+	}
+	if !p.InputValues {
+		for i := range events {
+			if events[i].InputValue != nil || events[i].KeyPressed != nil {
+				events[i].InputValue = nil
+				events[i].KeyPressed = nil
+				events[i].InputMasked = true
+			}
+		}
+	}
+	return events, 0
+}
+
+// Parse decodes a TCF v2 or GPP consent string. GPP strings start with the GPP header
+// ("DB..."); only their TCF EU v2 section restricts collection, since the US sections
+// are opt-out regimes that the SDK enforces before sending.
+//
+// Events need purposes 1 (device storage) and 8 (content measurement); input values and
+// screenshots additionally need purpose 10 (develop and improve services).
+func Parse(s string) (Policy, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Granted, nil
+	}
+
+	if strings.HasPrefix(s, "DB") {
+		return parseGPP(s)
+	}
+	return parseTCF(s)
+}
+
+func parseGPP(s string) (Policy, error) {
+	parts := strings.Split(s, "~")
+	bits, err := decodeBits(parts[0])
+	if err != nil {
+		return Policy{}, err
+	}
+
+	if t, err := bits.readInt(6); err != nil || t != gppHeaderType {
+		return Policy{}, fmt.Errorf("%w: not a GPP header", ErrInvalid)
+	}
+	if _, err := bits.readInt(6); err != nil {
+		return Policy{}, fmt.Errorf("%w: truncated GPP header", ErrInvalid)
+	}
+
+	sections, err := bits.readFibonacciRange()
+	if err != nil {
+		return Policy{}, err
+	}
+	if len(sections) != len(parts)-1 {
+		return Policy{}, fmt.Errorf("%w: GPP header lists %d sections, string has %d", ErrInvalid, len(sections), len(parts)-1)
+	}
+
+	for i, id := range sections {
+		if id == gppSectionTCFEUv2 {
+			return parseTCF(parts[i+1])
+		}
+	}
+	return Granted, nil
+}
+
+func parseTCF(s string) (Policy, error) {
+	// Only the core segment carries purpose consents
+	core := strings.SplitN(s, ".", 2)[0]
+	bits, err := decodeBits(core)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	if v, err := bits.readInt(6); err != nil || v != 2 {
+		return Policy{}, fmt.Errorf("%w: unsupported TCF version", ErrInvalid)
+	}
+
+	bits.pos = tcfPurposeConsentOffset
+	purposes, err := bits.readInt(tcfPurposeCount)
+	if err != nil {
+		return Policy{}, fmt.Errorf("%w: truncated TCF core string", ErrInvalid)
+	}
+	consented := func(purpose int) bool {
+		return purposes&(1<<(tcfPurposeCount-purpose)) != 0
+	}
+
+	events := consented(purposeStoreAccess) && consented(purposeMeasureContent)
+	detailed := events && consented(purposeImproveServices)
+	return Policy{Events: events, InputValues: detailed, Screenshots: detailed}, nil
+}
+
+// bitReader reads big-endian bit fields from a decoded consent segment
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func decodeBits(segment string) (*bitReader, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return &bitReader{data: data}, nil
+}
+
+func (b *bitReader) readBit() (bool, error) {
+	if b.pos >= len(b.data)*8 {
+		return false, fmt.Errorf("%w: unexpected end of data", ErrInvalid)
+	}
+	bit := b.data[b.pos/8]&(0x80>>(b.pos%8)) != 0
+	b.pos++
+	return bit, nil
+}
+
+func (b *bitReader) readInt(n int) (int, error) {
+	value := 0
+	for i := 0; i < n; i++ {
+		bit, err := b.readBit()
+		if err != nil {
+			return 0, err
+		}
+		value <<= 1
+		if bit {
+			value |= 1
+		}
+	}
+	return value, nil
+}
+
+// readFibonacci reads a Fibonacci-coded integer terminated by two consecutive 1 bits
+func (b *bitReader) readFibonacci() (int, error) {
+	value, prev := 0, false
+	a, c := 1, 2
+	for i := 0; i < maxFibonacciBits; i++ {
+		bit, err := b.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit && prev {
+			return value, nil
+		}
+		if bit {
+			value += a
+		}
+		prev = bit
+		a, c = c, a+c
+	}
+	return 0, fmt.Errorf("%w: Fibonacci integer too long", ErrInvalid)
+}
+
+// readFibonacciRange reads a GPP section ID list: a 12-bit entry count followed by
+// single IDs or ranges, each Fibonacci-coded as an offset from the previous ID
+func (b *bitReader) readFibonacciRange() ([]int, error) {
+	count, err := b.readInt(12)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	last := 0
+	for i := 0; i < count; i++ {
+		isRange, err := b.readBit()
+		if err != nil {
+			return nil, err
+		}
+		start, err := b.readFibonacci()
+		if err != nil {
+			return nil, err
+		}
+		start += last
+		last = start
+		if !isRange {
+			ids = append(ids, start)
+			continue
+		}
+		end, err := b.readFibonacci()
+		if err != nil {
+			return nil, err
+		}
+		end += last
+		last = end
+		if end-start > maxFibonacciBits {
+			return nil, fmt.Errorf("%w: GPP section range too large", ErrInvalid)
+		}
+		for id := start; id <= end; id++ {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,181 @@
+// Package cron parses standard five-field cron expressions and computes their next
+// fire time.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression. Each field is a bitmask of allowed values.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar/dowStar record unrestricted day fields: when both day fields are
+	// restricted, a day matches if either does (standard cron semantics)
+	domStar, dowStar bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// macros are the supported @-shorthands
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses "minute hour day-of-month month day-of-week" or an @-macro such as
+// @daily. Fields accept *, values, ranges (1-5), lists (1,3) and steps (*/15, 0-30/5);
+// month and weekday fields also accept three-letter names. Sunday is 0 or 7.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := macros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d", len(parts))
+	}
+
+	s := &Schedule{domStar: parts[2] == "*", dowStar: parts[4] == "*"}
+	var err error
+	if s.minute, err = parseField(parts[0], minuteField); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(parts[1], hourField); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(parts[2], domField); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(parts[3], monthField); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(parts[4], dowField); err != nil {
+		return nil, err
+	}
+	// 7 is an alias for Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func parseField(expr string, f field) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(expr, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field: %q", f.name, part)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := f.min, f.max
+		if part != "*" {
+			var err error
+			if i := strings.IndexByte(part, '-'); i >= 0 {
+				if lo, err = f.value(part[:i]); err != nil {
+					return 0, err
+				}
+				if hi, err = f.value(part[i+1:]); err != nil {
+					return 0, err
+				}
+			} else {
+				if lo, err = f.value(part); err != nil {
+					return 0, err
+				}
+				hi = lo
+				if step > 1 {
+					hi = f.max
+				}
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("invalid range in %s field: %q", f.name, expr)
+		}
+
+		for v := lo; v <= hi; v += step {
+			mask |= 1 << v
+		}
+	}
+	return mask, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s value %q (allowed %d-%d)", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// maxSearch bounds Next for expressions that can never fire, e.g. "0 0 30 2 *"
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Next returns the first fire time strictly after t, in t's location, or the zero
+// time when the expression does not fire within five years
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
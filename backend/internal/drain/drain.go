@@ -0,0 +1,86 @@
+// Package drain coordinates taking an instance out of rotation before shutdown:
+// new ingest requests are rejected while the work already accepted is finished.
+package drain
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// State records whether the instance is draining. The zero value is not usable;
+// create it with New.
+type State struct {
+	draining  atomic.Bool
+	startedAt atomic.Int64
+	started   chan struct{}
+	once      sync.Once
+}
+
+// New creates a state that is not draining
+func New() *State {
+	return &State{started: make(chan struct{})}
+}
+
+// Start switches to draining. It reports false if draining had already started.
+func (s *State) Start() bool {
+	started := false
+	s.once.Do(func() {
+		s.startedAt.Store(time.Now().UnixNano())
+		s.draining.Store(true)
+		close(s.started)
+		started = true
+	})
+	return started
+}
+
+// Draining reports whether draining has started
+func (s *State) Draining() bool {
+	return s.draining.Load()
+}
+
+// StartedAt returns when draining started, or the zero time
+func (s *State) StartedAt() time.Time {
+	if ns := s.startedAt.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// Started is closed once draining starts
+func (s *State) Started() <-chan struct{} {
+	return s.started
+}
+
+// BacklogFunc returns the number of accepted messages not yet processed
+type BacklogFunc func(ctx context.Context) (int64, error)
+
+// Wait polls backlog every interval until it reports zero or timeout passes. It
+// reports whether the backlog was cleared.
+func Wait(ctx context.Context, backlog BacklogFunc, interval, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := backlog(ctx)
+		switch {
+		case err != nil:
+			log.Printf("[Drain] Error checking backlog: %v", err)
+		case n == 0:
+			return true
+		default:
+			log.Printf("[Drain] Waiting for %d queued messages", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
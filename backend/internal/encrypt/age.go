@@ -0,0 +1,23 @@
+package encrypt
+
+import (
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+)
+
+func parseAgeRecipient(s string) (*Recipient, error) {
+	recipient, err := age.ParseX25519Recipient(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	return &Recipient{
+		Method:      MethodAge,
+		Fingerprint: recipient.String(),
+		encrypt: func(w io.Writer) (io.WriteCloser, error) {
+			return age.Encrypt(w, recipient)
+		},
+	}, nil
+}
@@ -0,0 +1,59 @@
+// Package encrypt seals export bundles for a recipient-provided public key, using
+// age (X25519 recipients) or OpenPGP, so exported behavioral data is never stored
+// in plaintext.
+package encrypt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Encryption methods accepted by the export API
+const (
+	MethodNone = "none"
+	MethodAge  = "age"
+	MethodGPG  = "gpg"
+)
+
+// ErrInvalidKey is wrapped by every recipient key validation failure
+var ErrInvalidKey = errors.New("invalid recipient key")
+
+// Recipient is a validated public key
+type Recipient struct {
+	Method string
+	// Fingerprint identifies the key: the age recipient itself, or the hex OpenPGP
+	// primary key fingerprint
+	Fingerprint string
+
+	encrypt func(w io.Writer) (io.WriteCloser, error)
+}
+
+// ParseRecipient validates publicKey for method: an "age1..." recipient for age, or
+// an ASCII-armored public key block for gpg
+func ParseRecipient(method, publicKey string) (*Recipient, error) {
+	publicKey = strings.TrimSpace(publicKey)
+	switch method {
+	case MethodAge:
+		return parseAgeRecipient(publicKey)
+	case MethodGPG:
+		return parseGPGRecipient(publicKey)
+	default:
+		return nil, fmt.Errorf("%w: unsupported encryption method %q", ErrInvalidKey, method)
+	}
+}
+
+// Extension is the file suffix for bundles encrypted with the recipient's method
+func (r *Recipient) Extension() string {
+	if r.Method == MethodAge {
+		return ".age"
+	}
+	return ".gpg"
+}
+
+// NewWriter returns a writer that encrypts everything written to it into w. Close
+// must be called to flush the final block; it does not close w.
+func (r *Recipient) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return r.encrypt(w)
+}
@@ -0,0 +1,176 @@
+package encrypt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+var bundle = bytes.Repeat([]byte("session_id,event_type,page_url\n"), 10000)
+
+// seal encrypts bundle for recipient as an export does
+func seal(t *testing.T, recipient *Recipient) []byte {
+	t.Helper()
+	var sealed bytes.Buffer
+	w, err := recipient.NewWriter(&sealed)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if _, err := w.Write(bundle); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if bytes.Contains(sealed.Bytes(), bundle[:64]) {
+		t.Fatal("sealed bundle contains plaintext")
+	}
+	return sealed.Bytes()
+}
+
+func TestAgeRoundTrip(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := ParseRecipient(MethodAge, " "+identity.Recipient().String()+"\n")
+	if err != nil {
+		t.Fatalf("ParseRecipient: %v", err)
+	}
+	if recipient.Fingerprint != identity.Recipient().String() || recipient.Extension() != ".age" {
+		t.Errorf("recipient = %+v", recipient)
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(seal(t, recipient)), identity)
+	if err != nil {
+		t.Fatalf("age.Decrypt: %v", err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading decrypted bundle: %v", err)
+	}
+	if !bytes.Equal(plain, bundle) {
+		t.Error("decrypted bundle differs from the original")
+	}
+}
+
+// armoredKey returns the public keys of entities, or their private keys with private
+// set, as one armored block
+func armoredKey(t *testing.T, private bool, entities ...*openpgp.Entity) string {
+	t.Helper()
+	var buf bytes.Buffer
+	blockType := openpgp.PublicKeyType
+	if private {
+		blockType = openpgp.PrivateKeyType
+	}
+	w, err := armor.Encode(&buf, blockType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entity := range entities {
+		if private {
+			err = entity.SerializePrivate(w, nil)
+		} else {
+			err = entity.Serialize(w)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestGPGRoundTrip(t *testing.T) {
+	entity, err := openpgp.NewEntity("Export", "", "export@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := ParseRecipient(MethodGPG, armoredKey(t, false, entity))
+	if err != nil {
+		t.Fatalf("ParseRecipient: %v", err)
+	}
+	if recipient.Extension() != ".gpg" || len(recipient.Fingerprint) != 40 {
+		t.Errorf("recipient = %+v", recipient)
+	}
+
+	md, err := openpgp.ReadMessage(bytes.NewReader(seal(t, recipient)), openpgp.EntityList{entity}, nil, nil)
+	if err != nil {
+		t.Fatalf("openpgp.ReadMessage: %v", err)
+	}
+	plain, err := io.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatalf("reading decrypted bundle: %v", err)
+	}
+	if !bytes.Equal(plain, bundle) {
+		t.Error("decrypted bundle differs from the original")
+	}
+}
+
+func TestParseRecipientRejectsMalformedKeys(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ageKey := identity.Recipient().String()
+	lastChar := "q"
+	if strings.HasSuffix(ageKey, "q") {
+		lastChar = "p"
+	}
+
+	entity, err := openpgp.NewEntity("Export", "", "export@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := openpgp.NewEntity("Other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-48 * time.Hour)
+	expired, err := openpgp.NewEntity("Expired", "", "expired@example.com", &packet.Config{
+		Time:            func() time.Time { return past },
+		KeyLifetimeSecs: 3600,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		publicKey string
+	}{
+		{"empty age key", MethodAge, ""},
+		{"age checksum mismatch", MethodAge, ageKey[:len(ageKey)-1] + lastChar},
+		{"truncated age key", MethodAge, ageKey[:len(ageKey)-8]},
+		{"age identity instead of recipient", MethodAge, identity.String()},
+		{"ssh key as age recipient", MethodAge, "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"},
+		{"gpg key as age recipient", MethodAge, armoredKey(t, false, entity)},
+		{"empty gpg key", MethodGPG, ""},
+		{"gpg garbage", MethodGPG, "-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nbm90IGEga2V5\n-----END PGP PUBLIC KEY BLOCK-----\n"},
+		{"age key as gpg key", MethodGPG, ageKey},
+		{"two gpg keys", MethodGPG, armoredKey(t, false, entity, other)},
+		{"gpg private key", MethodGPG, armoredKey(t, true, entity)},
+		{"expired gpg key", MethodGPG, armoredKey(t, false, expired)},
+		{"unknown method", "rot13", ageKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipient, err := ParseRecipient(tt.method, tt.publicKey)
+			if !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("ParseRecipient = %+v, %v; want ErrInvalidKey", recipient, err)
+			}
+		})
+	}
+}
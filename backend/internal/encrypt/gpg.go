@@ -0,0 +1,37 @@
+package encrypt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+func parseGPGRecipient(armored string) (*Recipient, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armored))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	if len(entities) != 1 {
+		return nil, fmt.Errorf("%w: expected exactly one public key, got %d", ErrInvalidKey, len(entities))
+	}
+
+	entity := entities[0]
+	if entity.PrivateKey != nil {
+		return nil, fmt.Errorf("%w: expected a public key, got a private key", ErrInvalidKey)
+	}
+	// Refuse keys that cannot encrypt now (expired, revoked or signing-only) up front
+	// rather than when the export is written
+	if _, ok := entity.EncryptionKey(time.Now()); !ok {
+		return nil, fmt.Errorf("%w: public key has no valid encryption key", ErrInvalidKey)
+	}
+	return &Recipient{
+		Method:      MethodGPG,
+		Fingerprint: fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint),
+		encrypt: func(w io.Writer) (io.WriteCloser, error) {
+			return openpgp.Encrypt(w, []*openpgp.Entity{entity}, nil, &openpgp.FileHints{IsBinary: true}, nil)
+		},
+	}, nil
+}
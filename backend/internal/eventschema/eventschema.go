@@ -0,0 +1,178 @@
+// Package eventschema coerces event_data fields to the types declared for them per
+// project, so consumers read consistent types from payloads clients send loosely
+// (numbers as strings, booleans as "yes", timestamps as epoch milliseconds).
+package eventschema
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// Field types a schema can declare
+const (
+	TypeString    = "string"
+	TypeNumber    = "number"
+	TypeInteger   = "integer"
+	TypeBoolean   = "boolean"
+	TypeTimestamp = "timestamp"
+)
+
+var types = map[string]bool{
+	TypeString:    true,
+	TypeNumber:    true,
+	TypeInteger:   true,
+	TypeBoolean:   true,
+	TypeTimestamp: true,
+}
+
+// IsType reports whether t is a field type a schema can declare
+func IsType(t string) bool {
+	return types[t]
+}
+
+// Types lists the field types, for error messages
+func Types() []string {
+	names := make([]string, 0, len(types))
+	for t := range types {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Coerce converts a decoded JSON value to t. Numbers are float64, integers int64 and
+// timestamps time.Time; numeric timestamps are read as Unix epoch milliseconds.
+func Coerce(value interface{}, t string) (interface{}, error) {
+	switch t {
+	case TypeString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+	case TypeNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && !math.IsNaN(n) && !math.IsInf(n, 0) {
+				return n, nil
+			}
+		}
+	case TypeInteger:
+		switch v := value.(type) {
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				return int64(v), nil
+			}
+		case string:
+			if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return n, nil
+			}
+		}
+	case TypeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case float64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "true", "1", "yes":
+				return true, nil
+			case "false", "0", "no":
+				return false, nil
+			}
+		}
+	case TypeTimestamp:
+		switch v := value.(type) {
+		case string:
+			if ts, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(v)); err == nil {
+				return ts.UTC(), nil
+			}
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				return time.UnixMilli(int64(v)).UTC(), nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", t)
+	}
+	return nil, fmt.Errorf("%s cannot be read as %s", describe(value), t)
+}
+
+// describe names the JSON type of value
+func describe(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case float64:
+		return fmt.Sprintf("number %v", v)
+	case bool:
+		return fmt.Sprintf("boolean %v", v)
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// Schemas maps event types to their declared field types
+type Schemas map[string]map[string]string
+
+// New indexes schemas by event type
+func New(schemas []*models.EventSchema) Schemas {
+	s := make(Schemas, len(schemas))
+	for _, schema := range schemas {
+		s[schema.EventType] = schema.Fields
+	}
+	return s
+}
+
+// Apply sets the TypedData of every event whose type has a schema: each declared field
+// coerced, or nil when it is missing or cannot be coerced. It returns a warning per
+// value that failed to coerce.
+func (s Schemas) Apply(events []*models.Event) []models.CoercionWarning {
+	warnings := []models.CoercionWarning{}
+	for _, event := range events {
+		fields, ok := s[string(event.EventType)]
+		if !ok {
+			continue
+		}
+
+		event.TypedData = make(map[string]interface{}, len(fields))
+		for field, t := range fields {
+			value, ok := event.EventData[field]
+			if !ok || value == nil {
+				event.TypedData[field] = nil
+				continue
+			}
+			typed, err := Coerce(value, t)
+			if err != nil {
+				warnings = append(warnings, models.CoercionWarning{
+					EventID:   event.EventID,
+					EventType: string(event.EventType),
+					Field:     field,
+					Type:      t,
+					Value:     value,
+					Error:     err.Error(),
+				})
+			}
+			event.TypedData[field] = typed
+		}
+	}
+	return warnings
+}
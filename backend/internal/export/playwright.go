@@ -0,0 +1,117 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// PlaywrightScript converts a session's click, input and navigation events into a
+// Playwright test skeleton that QA can refine into a regression test
+func PlaywrightScript(session *models.Session, events []*models.Event) string {
+	var b strings.Builder
+
+	b.WriteString("import { test, expect } from '@playwright/test';\n\n")
+	fmt.Fprintf(&b, "// Generated from session %s\n", session.SessionID)
+	fmt.Fprintf(&b, "// Recorded at %s\n", session.StartedAt.UTC().Format(time.RFC3339))
+	if session.UserAgent != nil {
+		fmt.Fprintf(&b, "// User agent: %s\n", jsComment(*session.UserAgent))
+	}
+	b.WriteString("\n")
+
+	fmt.Fprintf(&b, "test(%s, async ({ page }) => {\n", jsString("replay session "+session.SessionID.String()))
+	if session.ViewportWidth != nil && session.ViewportHeight != nil {
+		fmt.Fprintf(&b, "  await page.setViewportSize({ width: %d, height: %d });\n", *session.ViewportWidth, *session.ViewportHeight)
+	}
+	fmt.Fprintf(&b, "  await page.goto(%s);\n", jsString(session.PageURL))
+
+	currentURL := session.PageURL
+	for i, event := range events {
+		if event.PageURL != currentURL {
+			if event.EventType == models.EventTypeNavigation {
+				fmt.Fprintf(&b, "  await page.goto(%s);\n", jsString(event.PageURL))
+			} else {
+				fmt.Fprintf(&b, "  await expect(page).toHaveURL(%s);\n", jsString(event.PageURL))
+			}
+			currentURL = event.PageURL
+		}
+
+		selector := eventSelector(event)
+
+		switch event.EventType {
+		case models.EventTypeClick:
+			if selector == "" {
+				continue
+			}
+			fmt.Fprintf(&b, "  await page.click(%s);\n", jsString(selector))
+
+		case models.EventTypeInput, models.EventTypeChange:
+			if selector == "" {
+				continue
+			}
+			// Only emit the final value of consecutive inputs on the same field
+			if i+1 < len(events) && isInput(events[i+1]) && eventSelector(events[i+1]) == selector {
+				continue
+			}
+			if event.InputMasked || event.InputValue == nil {
+				b.WriteString("  // TODO: value was masked during recording\n")
+				fmt.Fprintf(&b, "  await page.fill(%s, %s);\n", jsString(selector), jsString(""))
+			} else {
+				fmt.Fprintf(&b, "  await page.fill(%s, %s);\n", jsString(selector), jsString(*event.InputValue))
+			}
+
+		case models.EventTypeKeyPress:
+			if event.KeyPressed == nil || *event.KeyPressed != "Enter" || selector == "" {
+				continue
+			}
+			fmt.Fprintf(&b, "  await page.press(%s, 'Enter');\n", jsString(selector))
+
+		case models.EventTypeError:
+			message := "unknown error"
+			if msg, ok := event.EventData["message"].(string); ok {
+				message = msg
+			}
+			fmt.Fprintf(&b, "  // Error recorded here: %s\n", jsComment(message))
+		}
+	}
+
+	b.WriteString("});\n")
+	return b.String()
+}
+
+func isInput(event *models.Event) bool {
+	return event.EventType == models.EventTypeInput || event.EventType == models.EventTypeChange
+}
+
+// eventSelector prefers the recorded CSS selector and falls back to the element ID
+func eventSelector(event *models.Event) string {
+	if event.TargetSelector != nil && *event.TargetSelector != "" {
+		return *event.TargetSelector
+	}
+	if event.TargetID != nil && *event.TargetID != "" {
+		return "#" + *event.TargetID
+	}
+	return ""
+}
+
+// jsString quotes a value as a JavaScript string literal
+func jsString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+// jsComment makes a recorded value safe to write into a // comment. Every JavaScript
+// line terminator ends the comment, so each is replaced with a space; otherwise a
+// crafted user agent or error message would inject code into the generated test.
+func jsComment(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\n', '\r', '\u2028', '\u2029':
+			return ' '
+		}
+		return r
+	}, s)
+}
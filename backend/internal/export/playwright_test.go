@@ -0,0 +1,43 @@
+package export
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+func TestPlaywrightScriptEscapesComments(t *testing.T) {
+	userAgent := "Mozilla/5.0\nawait require('child_process').exec('ua-r');\r" +
+		"x\u2028uaLS();\u2029uaPS();"
+	session := &models.Session{
+		SessionID: uuid.New(),
+		StartedAt: time.Now(),
+		PageURL:   "https://example.com/",
+		UserAgent: &userAgent,
+	}
+	events := []*models.Event{{
+		EventType: models.EventTypeError,
+		PageURL:   "https://example.com/",
+		EventData: map[string]interface{}{"message": "boom\r\nerrCRLF();\u2028errLS();\u2029errPS();"},
+	}}
+
+	script := PlaywrightScript(session, events)
+
+	for _, payload := range []string{"require(", "uaLS()", "uaPS()", "errCRLF()", "errLS()", "errPS()"} {
+		for _, line := range strings.FieldsFunc(script, isLineTerminator) {
+			if strings.Contains(line, payload) && !strings.HasPrefix(strings.TrimSpace(line), "//") {
+				t.Errorf("%q escaped its comment: %q", payload, line)
+			}
+		}
+	}
+	if strings.ContainsAny(script, "\r\u2028\u2029") {
+		t.Errorf("script contains a line terminator other than \\n:\n%s", script)
+	}
+}
+
+func isLineTerminator(r rune) bool {
+	return r == '\n' || r == '\r' || r == '\u2028' || r == '\u2029'
+}
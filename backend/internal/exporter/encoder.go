@@ -0,0 +1,116 @@
+// Package exporter writes asynchronous session and event exports to blob storage.
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// SupportedKinds and SupportedFormats list what an export job may request
+var (
+	SupportedKinds   = []string{models.ExportKindSessions, models.ExportKindEvents}
+	SupportedFormats = []string{models.ExportFormatNDJSON, models.ExportFormatCSV}
+)
+
+var sessionCSVHeader = []string{
+	"session_id", "user_id", "started_at", "ended_at", "last_activity_at", "page_url", "referrer",
+	"device_type", "browser", "os", "country", "city", "screen_width", "screen_height", "fingerprint",
+}
+
+var eventCSVHeader = []string{
+	"event_id", "session_id", "timestamp", "event_type", "page_url", "target_selector",
+	"viewport_x", "viewport_y", "input_value", "input_masked", "key_pressed",
+}
+
+// encoder writes export rows in one format
+type encoder interface {
+	Session(s *models.Session) error
+	Event(e *models.Event) error
+	Close() error
+}
+
+func newEncoder(kind, format string, w io.Writer) (encoder, error) {
+	switch format {
+	case models.ExportFormatNDJSON:
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}, nil
+	case models.ExportFormatCSV:
+		cw := csv.NewWriter(w)
+		header := sessionCSVHeader
+		if kind == models.ExportKindEvents {
+			header = eventCSVHeader
+		}
+		if err := cw.Write(header); err != nil {
+			return nil, err
+		}
+		return &csvEncoder{w: cw}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Session(s *models.Session) error { return e.enc.Encode(s) }
+func (e *ndjsonEncoder) Event(ev *models.Event) error    { return e.enc.Encode(ev) }
+func (e *ndjsonEncoder) Close() error                    { return nil }
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) Session(s *models.Session) error {
+	return e.w.Write([]string{
+		s.SessionID.String(), str(s.UserID), s.StartedAt.Format(time.RFC3339Nano), timeStr(s.EndedAt),
+		s.LastActivityAt.Format(time.RFC3339Nano), s.PageURL, str(s.Referrer), str(s.DeviceType), str(s.Browser), str(s.OS),
+		str(s.Country), str(s.City), intStr(s.ScreenWidth), intStr(s.ScreenHeight), str(s.Fingerprint),
+	})
+}
+
+func (e *csvEncoder) Event(ev *models.Event) error {
+	return e.w.Write([]string{
+		strconv.FormatInt(ev.EventID, 10), ev.SessionID.String(), ev.Timestamp.Format(time.RFC3339Nano),
+		string(ev.EventType), ev.PageURL, str(ev.TargetSelector), floatStr(ev.ViewportX), floatStr(ev.ViewportY),
+		str(ev.InputValue), strconv.FormatBool(ev.InputMasked), str(ev.KeyPressed),
+	})
+}
+
+func (e *csvEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func timeStr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func intStr(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
+
+func floatStr(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
@@ -0,0 +1,97 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// Failure is the body POSTed when a scheduled export run fails
+type Failure struct {
+	Type                string    `json:"type"`
+	ScheduleID          uuid.UUID `json:"schedule_id"`
+	ScheduleName        string    `json:"schedule_name"`
+	JobID               uuid.UUID `json:"job_id"`
+	Error               string    `json:"error"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	RangeFrom           time.Time `json:"range_from"`
+	RangeTo             time.Time `json:"range_to"`
+	FailedAt            time.Time `json:"failed_at"`
+}
+
+// Notifier POSTs scheduled export failures to the schedule's notify URL, or to a
+// default URL for schedules without one
+type Notifier struct {
+	defaultURL string
+	secret     string
+	client     *http.Client
+}
+
+// NewNotifier creates a failure notifier. When secret is set, the body is signed with
+// HMAC-SHA256 and sent in the X-Tracker-Signature header, like CDC webhooks.
+func NewNotifier(defaultURL, secret string, timeout time.Duration) *Notifier {
+	return &Notifier{
+		defaultURL: defaultURL,
+		secret:     secret,
+		client:     &http.Client{Timeout: timeout},
+	}
+}
+
+// ScheduleFailed reports a failed run of schedule. It is a no-op when neither the
+// schedule nor the notifier has a URL.
+func (n *Notifier) ScheduleFailed(ctx context.Context, schedule *models.ExportSchedule, job *models.ExportJob, jobErr string) error {
+	url := n.defaultURL
+	if schedule.NotifyURL != nil && *schedule.NotifyURL != "" {
+		url = *schedule.NotifyURL
+	}
+	if url == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(Failure{
+		Type:                "export.schedule.failed",
+		ScheduleID:          schedule.ScheduleID,
+		ScheduleName:        schedule.Name,
+		JobID:               job.JobID,
+		Error:               jobErr,
+		ConsecutiveFailures: schedule.ConsecutiveFailures,
+		RangeFrom:           job.From,
+		RangeTo:             job.To,
+		FailedAt:            time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set("X-Tracker-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/cron"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// dueBatch bounds how many schedules are queued per tick
+const dueBatch = 100
+
+// Scheduler queues an export job for every due export schedule. Runs missed while no
+// scheduler was running are queued one per tick until the schedule has caught up.
+type Scheduler struct {
+	scheduleRepo *repository.ExportScheduleRepository
+	interval     time.Duration
+	stopChan     chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler that checks for due schedules every interval
+func NewScheduler(scheduleRepo *repository.ExportScheduleRepository, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		scheduleRepo: scheduleRepo,
+		interval:     interval,
+		stopChan:     make(chan struct{}),
+	}
+}
+
+// Start runs the scheduling loop in the background
+func (s *Scheduler) Start(ctx context.Context) {
+	s.wg.Add(1)
+	go s.loop(ctx)
+}
+
+// Stop stops the scheduler
+func (s *Scheduler) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context) {
+	defer s.wg.Done()
+
+	log.Printf("[ExportScheduler] Started, interval: %v", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			log.Println("[ExportScheduler] Stopped")
+			return
+		case <-ticker.C:
+			s.tick(ctx)
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	due, err := s.scheduleRepo.ListDue(ctx, time.Now(), dueBatch)
+	if err != nil {
+		log.Printf("[ExportScheduler] Error listing due schedules: %v", err)
+		return
+	}
+
+	for _, schedule := range due {
+		job, next, err := PlanRun(schedule)
+		if err != nil {
+			log.Printf("[ExportScheduler] Schedule %s cannot run: %v", schedule.ScheduleID, err)
+			continue
+		}
+
+		queued, err := s.scheduleRepo.QueueRun(ctx, schedule.ScheduleID, schedule.NextRunAt, next, job)
+		if err != nil {
+			log.Printf("[ExportScheduler] Error queueing schedule %s: %v", schedule.ScheduleID, err)
+			continue
+		}
+		if queued {
+			log.Printf("[ExportScheduler] Queued %s export for schedule %q (%s to %s), next run %s",
+				job.Kind, schedule.Name, job.From.Format(time.RFC3339), job.To.Format(time.RFC3339), next.Format(time.RFC3339))
+		}
+	}
+}
+
+// PlanRun builds the export job for the schedule's due run and computes the run after it.
+// The job covers the schedule's window ending at the run time; without a window it
+// covers the interval since the previous run.
+func PlanRun(schedule *models.ExportSchedule) (*models.ExportJob, time.Time, error) {
+	expr, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	runAt := schedule.NextRunAt.In(loc)
+	next := expr.Next(runAt)
+	if next.IsZero() {
+		return nil, time.Time{}, fmt.Errorf("cron expression %q never fires again", schedule.Cron)
+	}
+
+	from := runAt.Add(-next.Sub(runAt))
+	switch {
+	case schedule.WindowSeconds != nil:
+		from = runAt.Add(-time.Duration(*schedule.WindowSeconds) * time.Second)
+	case schedule.LastRunAt != nil:
+		from = *schedule.LastRunAt
+	}
+
+	job := &models.ExportJob{
+		ScheduleID:     &schedule.ScheduleID,
+		Kind:           schedule.Kind,
+		Format:         schedule.Format,
+		From:           from.UTC(),
+		To:             runAt.UTC(),
+		Role:           schedule.Role,
+		Encryption:     schedule.Encryption,
+		PublicKey:      schedule.PublicKey,
+		KeyFingerprint: schedule.KeyFingerprint,
+	}
+	return job, next.UTC(), nil
+}
+
+// NextRun returns the first run of cronExpr in timezone after t
+func NextRun(cronExpr, timezone string, t time.Time) (time.Time, error) {
+	expr, err := cron.Parse(cronExpr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+	next := expr.Next(t.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q never fires", cronExpr)
+	}
+	return next.UTC(), nil
+}
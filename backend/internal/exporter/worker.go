@@ -0,0 +1,286 @@
+package exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/encrypt"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/storage"
+	"github.com/ngocp/user-tracker/internal/visibility"
+)
+
+// WorkerConfig holds configuration for the export worker
+type WorkerConfig struct {
+	PollInterval time.Duration
+	PageSize     int
+	// Prefix is the object key prefix exports are written under, e.g. "exports"
+	Prefix string
+}
+
+// Worker claims pending export jobs and writes each one to blob storage as a gzip
+// bundle, encrypted for the job's recipient key when one was given
+type Worker struct {
+	exportRepo   *repository.ExportRepository
+	scheduleRepo *repository.ExportScheduleRepository
+	sessionRepo  *repository.SessionRepository
+	eventRepo    *repository.EventRepository
+	store        storage.Store
+	notifier     *Notifier
+	config       WorkerConfig
+	stopChan     chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewWorker creates a new export worker. Results of scheduled runs are recorded on
+// their schedule; notifier is optional and reports failed scheduled runs.
+func NewWorker(
+	exportRepo *repository.ExportRepository,
+	scheduleRepo *repository.ExportScheduleRepository,
+	sessionRepo *repository.SessionRepository,
+	eventRepo *repository.EventRepository,
+	store storage.Store,
+	notifier *Notifier,
+	config WorkerConfig,
+) *Worker {
+	return &Worker{
+		exportRepo:   exportRepo,
+		scheduleRepo: scheduleRepo,
+		sessionRepo:  sessionRepo,
+		eventRepo:    eventRepo,
+		store:        store,
+		notifier:     notifier,
+		config:       config,
+		stopChan:     make(chan struct{}),
+	}
+}
+
+// Start runs the polling loop in the background
+func (w *Worker) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go w.loop(ctx)
+}
+
+// Stop stops the worker after the job in progress, if any
+func (w *Worker) Stop() {
+	close(w.stopChan)
+	w.wg.Wait()
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	defer w.wg.Done()
+
+	log.Printf("[Exporter] Started, poll interval: %v", w.config.PollInterval)
+
+	ticker := time.NewTicker(w.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopChan:
+			log.Println("[Exporter] Stopped")
+			return
+		case <-ticker.C:
+			w.drain(ctx)
+		}
+	}
+}
+
+// drain processes pending jobs until none are left or the worker is stopped
+func (w *Worker) drain(ctx context.Context) {
+	for !w.stopped() {
+		job, err := w.exportRepo.ClaimNext(ctx)
+		if err != nil {
+			log.Printf("[Exporter] Error claiming job: %v", err)
+			return
+		}
+		if job == nil {
+			return
+		}
+
+		log.Printf("[Exporter] Processing job %s (%s %s, encryption: %s)", job.JobID, job.Kind, job.Format, job.Encryption)
+		status := models.ExportStatusCompleted
+		var jobErr *string
+		result, err := w.process(ctx, job)
+		if err != nil {
+			log.Printf("[Exporter] Job %s failed: %v", job.JobID, err)
+			status = models.ExportStatusFailed
+			msg := err.Error()
+			jobErr = &msg
+		}
+
+		if err := w.exportRepo.Finish(ctx, job.JobID, status, result, jobErr); err != nil {
+			log.Printf("[Exporter] Error finishing job %s: %v", job.JobID, err)
+		}
+		if job.ScheduleID != nil {
+			w.recordScheduledRun(ctx, job, status, jobErr)
+		}
+	}
+}
+
+// recordScheduledRun updates the run's schedule and reports failures
+func (w *Worker) recordScheduledRun(ctx context.Context, job *models.ExportJob, status models.ExportStatus, jobErr *string) {
+	schedule, err := w.scheduleRepo.RecordResult(ctx, *job.ScheduleID, status)
+	if err != nil {
+		log.Printf("[Exporter] Error recording result for schedule %s: %v", *job.ScheduleID, err)
+		return
+	}
+	if status != models.ExportStatusFailed || w.notifier == nil {
+		return
+	}
+	if err := w.notifier.ScheduleFailed(ctx, schedule, job, *jobErr); err != nil {
+		log.Printf("[Exporter] Failed to notify about schedule %s: %v", schedule.ScheduleID, err)
+	}
+}
+
+func (w *Worker) stopped() bool {
+	select {
+	case <-w.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *Worker) process(ctx context.Context, job *models.ExportJob) (models.ExportResult, error) {
+	var result models.ExportResult
+
+	var recipient *encrypt.Recipient
+	if job.Encryption != encrypt.MethodNone {
+		if job.PublicKey == nil {
+			return result, fmt.Errorf("export requires %s encryption but has no public key", job.Encryption)
+		}
+		r, err := encrypt.ParseRecipient(job.Encryption, *job.PublicKey)
+		if err != nil {
+			return result, err
+		}
+		recipient = r
+	}
+
+	// Records are gzipped, then encrypted: ciphertext does not compress
+	var out bytes.Buffer
+	var sink io.Writer = &out
+	var sealer io.WriteCloser
+	if recipient != nil {
+		s, err := recipient.NewWriter(&out)
+		if err != nil {
+			return result, fmt.Errorf("failed to start encryption: %w", err)
+		}
+		sealer, sink = s, s
+	}
+	gz := gzip.NewWriter(sink)
+
+	enc, err := newEncoder(job.Kind, job.Format, gz)
+	if err != nil {
+		return result, err
+	}
+
+	role := visibility.ParseRole(job.Role)
+	switch job.Kind {
+	case models.ExportKindSessions:
+		result.RowsExported, err = w.exportSessions(ctx, job, role, enc)
+	case models.ExportKindEvents:
+		result.RowsExported, err = w.exportEvents(ctx, job, role, enc)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if err := enc.Close(); err != nil {
+		return result, fmt.Errorf("failed to write export: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return result, fmt.Errorf("failed to compress export: %w", err)
+	}
+	if sealer != nil {
+		if err := sealer.Close(); err != nil {
+			return result, fmt.Errorf("failed to encrypt export: %w", err)
+		}
+	}
+
+	key := objectKey(w.config.Prefix, job.JobID, job.Format, recipient)
+	contentType := "application/gzip"
+	if recipient != nil {
+		contentType = "application/octet-stream"
+	}
+	if err := w.store.Put(ctx, key, out.Bytes(), contentType); err != nil {
+		return result, fmt.Errorf("failed to store export %s: %w", key, err)
+	}
+
+	result.ObjectKey = &key
+	result.BytesWritten = int64(out.Len())
+	log.Printf("[Exporter] Job %s wrote %d rows to %s (%d bytes)", job.JobID, result.RowsExported, key, out.Len())
+	return result, nil
+}
+
+func (w *Worker) exportSessions(ctx context.Context, job *models.ExportJob, role visibility.Role, enc encoder) (int64, error) {
+	var total int64
+	var after *time.Time
+	var afterID uuid.UUID
+
+	for !w.stopped() {
+		sessions, err := w.sessionRepo.ListRange(ctx, job.From, job.To, nil, after, afterID, w.config.PageSize)
+		if err != nil {
+			return total, err
+		}
+
+		visibility.Sessions(role, sessions)
+		for _, session := range sessions {
+			if err := enc.Session(session); err != nil {
+				return total, fmt.Errorf("failed to write export: %w", err)
+			}
+		}
+		total += int64(len(sessions))
+
+		if len(sessions) < w.config.PageSize {
+			return total, nil
+		}
+		last := sessions[len(sessions)-1]
+		after, afterID = &last.StartedAt, last.SessionID
+	}
+	return total, fmt.Errorf("export worker stopped")
+}
+
+func (w *Worker) exportEvents(ctx context.Context, job *models.ExportJob, role visibility.Role, enc encoder) (int64, error) {
+	var total int64
+	filter := repository.EventWindowFilter{From: job.From, To: job.To, Limit: w.config.PageSize}
+
+	for !w.stopped() {
+		events, err := w.eventRepo.ListByTimeWindow(ctx, filter)
+		if err != nil {
+			return total, err
+		}
+
+		visibility.Events(role, events)
+		for _, event := range events {
+			if err := enc.Event(event); err != nil {
+				return total, fmt.Errorf("failed to write export: %w", err)
+			}
+		}
+		total += int64(len(events))
+
+		if len(events) < w.config.PageSize {
+			return total, nil
+		}
+		last := events[len(events)-1]
+		filter.AfterTimestamp, filter.AfterEventID = last.Timestamp, last.EventID
+	}
+	return total, fmt.Errorf("export worker stopped")
+}
+
+// objectKey names a bundle after its job, e.g. exports/<job_id>.csv.gz.age
+func objectKey(prefix string, jobID uuid.UUID, format string, recipient *encrypt.Recipient) string {
+	key := fmt.Sprintf("%s/%s.%s.gz", prefix, jobID, format)
+	if recipient != nil {
+		key += recipient.Extension()
+	}
+	return key
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/accesstoken"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// defaultSessionTokenTTL applies when a mint request does not set ttl
+const defaultSessionTokenTTL = time.Hour
+
+type AccessTokenHandler struct {
+	sessionRepo  *repository.SessionRepository
+	signer       *accesstoken.Signer
+	maxTTL       time.Duration
+	dashboardURL string
+}
+
+func NewAccessTokenHandler(sessionRepo *repository.SessionRepository, signer *accesstoken.Signer, maxTTL time.Duration, dashboardURL string) *AccessTokenHandler {
+	return &AccessTokenHandler{
+		sessionRepo:  sessionRepo,
+		signer:       signer,
+		maxTTL:       maxTTL,
+		dashboardURL: strings.TrimSuffix(dashboardURL, "/"),
+	}
+}
+
+type sessionTokenRequest struct {
+	SessionID string `json:"session_id"`
+	TTL       string `json:"ttl"`
+}
+
+// MintSessionToken issues a session:read token for one session, valid for ttl
+// (default 1h, at most the configured maximum). With a dashboard URL configured the
+// response includes a share link carrying the token.
+func (h *AccessTokenHandler) MintSessionToken(c *fiber.Ctx) error {
+	if h.signer == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Access tokens are disabled",
+		})
+	}
+
+	var req sessionTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	sessionID, err := uuid.Parse(req.SessionID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid session_id",
+			"details": err.Error(),
+		})
+	}
+	ttl := defaultSessionTokenTTL
+	if req.TTL != "" {
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 || ttl > h.maxTTL {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid ttl",
+				"details": "ttl must be a positive duration up to " + h.maxTTL.String(),
+			})
+		}
+	}
+
+	if _, err := h.sessionRepo.GetByID(c.UserContext(), sessionID); err != nil {
+		return repositoryError(c, err, "Session not found", "Failed to mint access token")
+	}
+
+	scope := accesstoken.SessionReadScope(sessionID)
+	token, expiresAt, err := h.signer.Issue(scope, ttl, time.Now())
+	if err != nil {
+		log.Printf("Failed to mint access token: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to mint access token",
+		})
+	}
+
+	resp := fiber.Map{
+		"token":      token,
+		"scope":      scope,
+		"expires_at": expiresAt,
+	}
+	if h.dashboardURL != "" {
+		resp["share_url"] = h.dashboardURL + "/sessions/" + sessionID.String() + "?access_token=" + url.QueryEscape(token)
+	}
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
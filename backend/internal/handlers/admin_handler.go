@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/drain"
+	"github.com/ngocp/user-tracker/internal/jobs"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/migration"
+	"github.com/ngocp/user-tracker/internal/queue"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/stats"
+)
+
+// maxReplayMessages bounds one replay call; larger ranges are paged with "next"
+const maxReplayMessages = 10000
+
+type AdminHandler struct {
+	replayer        *queue.Replayer
+	ingestStatsRepo *repository.IngestStatsRepository
+	migrations      *migration.StatusChecker
+	jobQueue        *queue.JobQueue
+	drain           *drain.State
+	eventRepo       *repository.EventRepository
+	rejections      *stats.RejectionLog
+}
+
+func NewAdminHandler(replayer *queue.Replayer, ingestStatsRepo *repository.IngestStatsRepository, migrations *migration.StatusChecker, jobQueue *queue.JobQueue, drainState *drain.State, eventRepo *repository.EventRepository, rejections *stats.RejectionLog) *AdminHandler {
+	return &AdminHandler{
+		replayer:        replayer,
+		ingestStatsRepo: ingestStatsRepo,
+		migrations:      migrations,
+		jobQueue:        jobQueue,
+		drain:           drainState,
+		eventRepo:       eventRepo,
+		rejections:      rejections,
+	}
+}
+
+type replayRequest struct {
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	Limit  int64  `json:"limit"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// ReplayStream re-applies a range of the raw event stream to the events table.
+// Call again with the returned "next" as start until it is empty.
+func (h *AdminHandler) ReplayStream(c *fiber.Ctx) error {
+	var req replayRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Start == "" {
+		req.Start = "-"
+	}
+	if req.End == "" {
+		req.End = "+"
+	}
+	if req.Limit <= 0 || req.Limit > maxReplayMessages {
+		req.Limit = maxReplayMessages
+	}
+
+	result, err := h.replayer.Replay(c.UserContext(), req.Start, req.End, req.Limit, req.DryRun)
+	if err != nil {
+		log.Printf("Failed to replay stream: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":  "Failed to replay stream",
+			"result": result,
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// GetIngestStats returns hourly event counts per ingest stage for [from, to), defaulting
+// to the last 24 hours. "unaccounted" is enqueued minus persisted and failed events:
+// anything left there once the queue has drained was lost. Events the degrade mode
+// dropped are counted under "dropped".
+func (h *AdminHandler) GetIngestStats(c *fiber.Ctx) error {
+	from, to, err := queryWindow(c, 24*time.Hour, 31*24*time.Hour)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	buckets, err := h.ingestStatsRepo.List(c.UserContext(), c.Query("project"), from, to)
+	if err != nil {
+		log.Printf("Failed to list ingest stats: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get ingest stats",
+		})
+	}
+
+	totals := make(map[string]int64)
+	for _, bucket := range buckets {
+		for stage, count := range bucket.Stages {
+			totals[stage] += count
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"from":        from,
+		"to":          to,
+		"data":        buckets,
+		"totals":      totals,
+		"unaccounted": totals[stats.StageEnqueued] - totals[stats.StagePersisted] - totals[stats.StagePersistFailed],
+	})
+}
+
+// GetIngestErrors returns the last rejected /track requests of the tracker key in
+// ?key_id=, newest first, with the error and details the SDK received. Without key_id
+// it returns those sent without a tracker token.
+func (h *AdminHandler) GetIngestErrors(c *fiber.Ctx) error {
+	keyID := uuid.Nil
+	if raw := c.Query("key_id"); raw != "" {
+		var err error
+		if keyID, err = uuid.Parse(raw); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid key_id",
+			})
+		}
+	}
+	limit := c.QueryInt("limit", h.rejections.Size())
+	if limit < 1 || limit > h.rejections.Size() {
+		limit = h.rejections.Size()
+	}
+
+	rejections, err := h.rejections.List(c.UserContext(), keyID, limit)
+	if err != nil {
+		log.Printf("Failed to list ingest errors: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get ingest errors",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"key_id": keyID,
+		"data":   rejections,
+	})
+}
+
+// GetMigrations returns the applied schema version, its dirty flag and the migrations
+// shipped with the server that the database has not applied yet
+func (h *AdminHandler) GetMigrations(c *fiber.Ctx) error {
+	status, err := h.migrations.Status()
+	if err != nil {
+		log.Printf("Failed to get migration status: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get migration status",
+		})
+	}
+
+	return c.JSON(status)
+}
+
+// GetSchema reports tables, columns, column types and indexes the server depends on
+// that are missing or differ in the database, with the migration that provides each
+func (h *AdminHandler) GetSchema(c *fiber.Ctx) error {
+	report, err := h.migrations.Schema(c.UserContext())
+	if err != nil {
+		log.Printf("Failed to check schema: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check schema",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":       report.OK(),
+		"problems": report.Problems,
+	})
+}
+
+// StartBackfill queues a registered backfill as a background job; poll its progress
+// with GET /api/v1/jobs/:id
+func (h *AdminHandler) StartBackfill(c *fiber.Ctx) error {
+	var payload jobs.BackfillPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if _, ok := migration.Backfills[payload.Name]; !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Unknown backfill",
+			"details": "Available backfills: " + strings.Join(migration.BackfillNames(), ", "),
+		})
+	}
+	if payload.Throttle != "" {
+		if _, err := time.ParseDuration(payload.Throttle); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid throttle",
+				"details": err.Error(),
+			})
+		}
+	}
+
+	job, err := h.jobQueue.Enqueue(c.UserContext(), jobs.TypeBackfill, payload, 0)
+	if err != nil {
+		log.Printf("Failed to queue backfill %s: %v", payload.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to queue backfill",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// StartBlobCleanup queues a job that finds screenshot objects in blob storage no row
+// references and, unless dry_run is set, deletes them. The job's result reports the
+// orphaned objects; poll it with GET /api/v1/jobs/:id.
+func (h *AdminHandler) StartBlobCleanup(c *fiber.Ctx) error {
+	var payload jobs.BlobCleanupPayload
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+	for field, value := range map[string]string{"min_age": payload.MinAge, "throttle": payload.Throttle} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(value); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid " + field,
+				"details": err.Error(),
+			})
+		}
+	}
+
+	job, err := h.jobQueue.Enqueue(c.UserContext(), jobs.TypeBlobCleanup, payload, 0)
+	if err != nil {
+		log.Printf("Failed to queue blob cleanup: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to queue blob cleanup",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// Drain takes the instance out of rotation: ingest requests get 503 from now on, the
+// health check fails, and the server shuts down once queued events are processed.
+// Calling it again reports the drain already in progress.
+func (h *AdminHandler) Drain(c *fiber.Ctx) error {
+	if h.drain.Start() {
+		log.Println("Drain requested through the admin API")
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"status":     "draining",
+		"started_at": h.drain.StartedAt(),
+	})
+}
+
+// RecomputeSession rebuilds one session's derived data (activity time, viewport
+// history, normalized coordinates, hourly session stats) from its raw events, to
+// repair it after a fix without replaying the whole stream
+func (h *AdminHandler) RecomputeSession(c *fiber.Ctx) error {
+	sessionID := middleware.ParamUUID(c, "id")
+
+	result, err := h.eventRepo.RecomputeSession(c.UserContext(), sessionID)
+	if err != nil {
+		return repositoryError(c, err, "Session not found", "Failed to recompute session")
+	}
+
+	if err := h.eventRepo.RefreshSessionStats(c.UserContext(), result.StartedAt); err != nil {
+		log.Printf("Failed to refresh session stats for session %s: %v", sessionID, err)
+	} else {
+		result.StatsRefreshed = true
+	}
+
+	log.Printf("Recomputed session %s: %d events, %d renormalized, %d viewport changes",
+		sessionID, result.Events, result.NormalizedEvents, result.ViewportChanges)
+	return c.JSON(result)
+}
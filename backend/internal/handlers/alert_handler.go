@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// Bounds of an alert rule's window
+const (
+	defaultAlertWindowSeconds = 300
+	maxAlertWindowSeconds     = 7 * 24 * 3600
+)
+
+var alertMetrics = map[string]bool{
+	models.AlertMetricQueueDepth:        true,
+	models.AlertMetricErrorRate:         true,
+	models.AlertMetricSessionsPerMinute: true,
+	models.AlertMetricGoalConversion:    true,
+	models.AlertMetricStreamLength:      true,
+}
+
+var alertComparators = map[string]bool{
+	models.AlertComparatorGT:  true,
+	models.AlertComparatorGTE: true,
+	models.AlertComparatorLT:  true,
+	models.AlertComparatorLTE: true,
+}
+
+type AlertHandler struct {
+	alertRepo *repository.AlertRepository
+}
+
+func NewAlertHandler(alertRepo *repository.AlertRepository) *AlertHandler {
+	return &AlertHandler{alertRepo: alertRepo}
+}
+
+// CreateRule adds an alert rule; it is first evaluated on the evaluator's next tick
+func (h *AlertHandler) CreateRule(c *fiber.Ctx) error {
+	var req models.CreateAlertRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid name",
+			"details": "name must be 1-255 characters",
+		})
+	}
+	if !alertMetrics[req.Metric] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid metric",
+			"details": "Use queue_depth, stream_length, error_rate, sessions_per_minute or goal_conversion",
+		})
+	}
+	if !alertComparators[req.Comparator] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid comparator",
+			"details": "Use gt, gte, lt or lte",
+		})
+	}
+	if req.WindowSeconds == 0 {
+		req.WindowSeconds = defaultAlertWindowSeconds
+	}
+	if req.WindowSeconds < 60 || req.WindowSeconds > maxAlertWindowSeconds {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid window_seconds",
+			"details": "window_seconds must be between 60 and 604800",
+		})
+	}
+	if req.GoalURL != nil && *req.GoalURL == "" {
+		req.GoalURL = nil
+	}
+	if req.Metric == models.AlertMetricGoalConversion && req.GoalURL == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid goal_url",
+			"details": "goal_conversion rules need the goal page's URL",
+		})
+	}
+	if req.NotifyURL != nil && *req.NotifyURL != "" {
+		if u, err := url.Parse(*req.NotifyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid notify_url",
+				"details": "notify_url must be an http(s) URL",
+			})
+		}
+	} else {
+		req.NotifyURL = nil
+	}
+
+	rule, err := h.alertRepo.CreateRule(c.UserContext(), &req)
+	if err != nil {
+		log.Printf("Failed to create alert rule: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create alert rule",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// ListRules lists alert rules with their current state, firing ones first
+func (h *AlertHandler) ListRules(c *fiber.Ctx) error {
+	rules, err := h.alertRepo.ListRules(c.UserContext())
+	if err != nil {
+		log.Printf("Failed to list alert rules: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list alert rules",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": rules,
+	})
+}
+
+// GetRule returns an alert rule with its current state
+func (h *AlertHandler) GetRule(c *fiber.Ctx) error {
+	rule, err := h.alertRepo.GetRule(c.UserContext(), middleware.ParamUUID(c, "id"))
+	if err != nil {
+		return repositoryError(c, err, "Alert rule not found", "Failed to get alert rule")
+	}
+
+	return c.JSON(rule)
+}
+
+// UpdateRule pauses or resumes a rule: {"enabled": false}
+func (h *AlertHandler) UpdateRule(c *fiber.Ctx) error {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Enabled == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"details": "enabled is required",
+		})
+	}
+
+	rule, err := h.alertRepo.SetRuleEnabled(c.UserContext(), middleware.ParamUUID(c, "id"), *req.Enabled)
+	if err != nil {
+		return repositoryError(c, err, "Alert rule not found", "Failed to update alert rule")
+	}
+
+	return c.JSON(rule)
+}
+
+// DeleteRule removes a rule and its history
+func (h *AlertHandler) DeleteRule(c *fiber.Ctx) error {
+	if err := h.alertRepo.DeleteRule(c.UserContext(), middleware.ParamUUID(c, "id")); err != nil {
+		return repositoryError(c, err, "Alert rule not found", "Failed to delete alert rule")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListHistory returns the latest alert state changes, newest first, optionally of
+// one ?rule_id=
+func (h *AlertHandler) ListHistory(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	var ruleID *uuid.UUID
+	if raw := c.Query("rule_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid rule_id",
+				"details": err.Error(),
+			})
+		}
+		ruleID = &id
+	}
+
+	events, err := h.alertRepo.ListEvents(c.UserContext(), ruleID, limit)
+	if err != nil {
+		log.Printf("Failed to list alert history: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list alert history",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": events,
+	})
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// maxOverviewWindow bounds the dashboard overview and breakdown queries
+const maxOverviewWindow = 90 * 24 * time.Hour
+
+type AnalyticsHandler struct {
+	analyticsRepo *repository.AnalyticsRepository
+}
+
+func NewAnalyticsHandler(analyticsRepo *repository.AnalyticsRepository) *AnalyticsHandler {
+	return &AnalyticsHandler{analyticsRepo: analyticsRepo}
+}
+
+// GetSDKVersions breaks recent traffic down by client SDK so old versions can be retired
+func (h *AnalyticsHandler) GetSDKVersions(c *fiber.Ctx) error {
+	days := c.QueryInt("days", 30)
+	if days < 1 || days > 365 {
+		days = 30
+	}
+
+	usage, err := h.analyticsRepo.SDKVersions(c.UserContext(), days)
+	if err != nil {
+		log.Printf("Failed to get sdk versions: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get SDK versions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": usage,
+		"days": days,
+	})
+}
+
+// GetOverview returns the dashboard's headline KPIs for [from, to), defaulting to the last 7 days
+func (h *AnalyticsHandler) GetOverview(c *fiber.Ctx) error {
+	from, to, err := queryWindow(c, 7*24*time.Hour, maxOverviewWindow)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	top := c.QueryInt("top", 10)
+	if top < 1 || top > 50 {
+		top = 10
+	}
+
+	overview, err := h.analyticsRepo.Overview(c.UserContext(), from, to, top)
+	if err != nil {
+		log.Printf("Failed to get analytics overview: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get analytics overview",
+		})
+	}
+
+	return c.JSON(overview)
+}
+
+// timeseriesIntervals maps each bucket size to its default and maximum window
+var timeseriesIntervals = map[string]struct{ span, max time.Duration }{
+	"hour": {24 * time.Hour, 7 * 24 * time.Hour},
+	"day":  {30 * 24 * time.Hour, 366 * 24 * time.Hour},
+}
+
+// GetTimeseries returns a metric bucketed by hour or day over [from, to), with empty
+// buckets included as zero so charts can plot the series directly
+func (h *AnalyticsHandler) GetTimeseries(c *fiber.Ctx) error {
+	metric := c.Query("metric", repository.MetricSessions)
+	if !repository.IsTimeseriesMetric(metric) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "metric must be one of: sessions, events, errors",
+		})
+	}
+
+	interval := c.Query("interval", "day")
+	bounds, ok := timeseriesIntervals[interval]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "interval must be one of: hour, day",
+		})
+	}
+
+	from, to, err := queryWindow(c, bounds.span, bounds.max)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	points, err := h.analyticsRepo.Timeseries(c.UserContext(), metric, interval, from, to)
+	if err != nil {
+		log.Printf("Failed to get %s timeseries: %v", metric, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get timeseries",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"metric":   metric,
+		"interval": interval,
+		"from":     from,
+		"to":       to,
+		"data":     points,
+	})
+}
+
+// GetBreakdown returns session counts and engagement per value of a dimension
+// (country, browser, os or device_type) for [from, to), defaulting to the last 30 days
+func (h *AnalyticsHandler) GetBreakdown(c *fiber.Ctx) error {
+	dimension := c.Query("dimension")
+	if !repository.IsBreakdownDimension(dimension) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "dimension must be one of: country, browser, os, device_type",
+		})
+	}
+
+	from, to, err := queryWindow(c, 30*24*time.Hour, maxOverviewWindow)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	breakdown, err := h.analyticsRepo.Breakdown(c.UserContext(), dimension, from, to, limit)
+	if err != nil {
+		log.Printf("Failed to get %s breakdown: %v", dimension, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get breakdown",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"dimension": dimension,
+		"from":      from,
+		"to":        to,
+		"data":      breakdown,
+	})
+}
+
+// queryWindow reads the optional RFC3339 from/to query parameters. to defaults to now
+// and from to span before to; the window may not exceed max.
+func queryWindow(c *fiber.Ctx, span, max time.Duration) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("to must be an RFC3339 timestamp")
+		}
+		to = t
+	}
+
+	from := to.Add(-span)
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("from must be an RFC3339 timestamp")
+		}
+		from = t
+	}
+
+	if !to.After(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("to must be after from")
+	}
+
+	if to.Sub(from) > max {
+		return time.Time{}, time.Time{}, fmt.Errorf("time window cannot exceed %v", max)
+	}
+
+	return from, to, nil
+}
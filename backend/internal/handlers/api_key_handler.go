@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/apikey"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+type APIKeyHandler struct {
+	keyRepo  *repository.APIKeyRepository
+	keyCache *apikey.Cache
+}
+
+func NewAPIKeyHandler(keyRepo *repository.APIKeyRepository, keyCache *apikey.Cache) *APIKeyHandler {
+	return &APIKeyHandler{
+		keyRepo:  keyRepo,
+		keyCache: keyCache,
+	}
+}
+
+// CreateKey creates an API key and returns it with its secret, which is not shown again
+func (h *APIKeyHandler) CreateKey(c *fiber.Ctx) error {
+	var req models.CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid name",
+			"details": "name must be 1-255 characters",
+		})
+	}
+	if !models.ValidAPIKeyScope(req.Scope) {
+		return invalidScope(c)
+	}
+
+	key, err := h.keyRepo.Create(c.UserContext(), &req)
+	if err != nil {
+		log.Printf("Failed to create API key: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create API key",
+		})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusCreated).JSON(key)
+}
+
+// ListKeys lists all API keys, revoked ones included, without their secrets
+func (h *APIKeyHandler) ListKeys(c *fiber.Ctx) error {
+	keys, err := h.keyRepo.List(c.UserContext())
+	if err != nil {
+		log.Printf("Failed to list API keys: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list API keys",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": keys,
+	})
+}
+
+// RotateKey replaces the key's secret and returns the new one. The old secret stops
+// working at once on this instance and within the key cache TTL on others.
+func (h *APIKeyHandler) RotateKey(c *fiber.Ctx) error {
+	keyID := middleware.ParamUUID(c, "id")
+
+	key, err := h.keyRepo.Rotate(c.UserContext(), keyID)
+	if err != nil {
+		return repositoryError(c, err, "API key not found or revoked", "Failed to rotate API key")
+	}
+	h.keyCache.Forget(keyID)
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(key)
+}
+
+// SetScope changes what the key may do: {"scope": "ingest"} or {"scope": "read"}
+func (h *APIKeyHandler) SetScope(c *fiber.Ctx) error {
+	keyID := middleware.ParamUUID(c, "id")
+
+	var req struct {
+		Scope string `json:"scope"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if !models.ValidAPIKeyScope(req.Scope) {
+		return invalidScope(c)
+	}
+
+	key, err := h.keyRepo.SetScope(c.UserContext(), keyID, req.Scope)
+	if err != nil {
+		return repositoryError(c, err, "API key not found or revoked", "Failed to update API key")
+	}
+	h.keyCache.Forget(keyID)
+
+	return c.JSON(key)
+}
+
+// RevokeKey disables a key for good
+func (h *APIKeyHandler) RevokeKey(c *fiber.Ctx) error {
+	keyID := middleware.ParamUUID(c, "id")
+
+	if err := h.keyRepo.Revoke(c.UserContext(), keyID); err != nil {
+		return repositoryError(c, err, "API key not found or already revoked", "Failed to revoke API key")
+	}
+	h.keyCache.Forget(keyID)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func invalidScope(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":   "Invalid scope",
+		"details": "scope must be " + models.APIKeyScopeIngest + " or " + models.APIKeyScopeRead,
+	})
+}
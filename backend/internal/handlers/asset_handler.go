@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/assets"
+	"github.com/ngocp/user-tracker/internal/stats"
+)
+
+type AssetHandler struct {
+	cache *assets.Cache
+}
+
+// NewAssetHandler creates the replay asset proxy; cache is nil when it is disabled
+func NewAssetHandler(cache *assets.Cache) *AssetHandler {
+	return &AssetHandler{cache: cache}
+}
+
+// GetAsset serves ?url= from ?project='s asset cache (the default project without
+// one), fetching and caching it on a miss, so replays can load page assets through
+// the API instead of from the site
+func (h *AssetHandler) GetAsset(c *fiber.Ctx) error {
+	if h.cache == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Asset proxy is not configured",
+		})
+	}
+
+	rawURL := c.Query("url")
+	if rawURL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "url is required",
+		})
+	}
+
+	asset, data, hit, err := h.cache.Get(c.UserContext(), c.Query("project", stats.DefaultProject), rawURL)
+	if err != nil {
+		switch {
+		case errors.Is(err, assets.ErrNotAllowed):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "Asset URL not allowed",
+				"details": "Only http(s) URLs on ASSET_PROXY_DOMAINS are proxied",
+			})
+		case errors.Is(err, assets.ErrTooLarge), errors.Is(err, assets.ErrUnsupportedType):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error":   "Asset cannot be cached",
+				"details": err.Error(),
+			})
+		}
+		log.Printf("Failed to get asset %s: %v", rawURL, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   "Failed to fetch asset",
+			"details": err.Error(),
+		})
+	}
+
+	cacheStatus := "miss"
+	if hit {
+		cacheStatus = "hit"
+	}
+	c.Set("X-Asset-Cache", cacheStatus)
+	c.Set(fiber.HeaderContentType, asset.ContentType)
+	c.Set(fiber.HeaderCacheControl, "private, max-age=86400")
+	// Assets come from other sites; keep scripts in SVGs from running on this origin
+	c.Set(fiber.HeaderContentSecurityPolicy, "sandbox; default-src 'none'; style-src 'unsafe-inline'")
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return c.Send(data)
+}
+
+// GetUsage lists each project's cached asset count and size against the quota
+func (h *AssetHandler) GetUsage(c *fiber.Ctx) error {
+	if h.cache == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Asset proxy is not configured",
+		})
+	}
+
+	usage, err := h.cache.Usage(c.UserContext())
+	if err != nil {
+		log.Printf("Failed to get asset cache usage: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get asset cache usage",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": usage,
+	})
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/stats"
+)
+
+type CatalogHandler struct {
+	catalogRepo *repository.CatalogRepository
+}
+
+func NewCatalogHandler(catalogRepo *repository.CatalogRepository) *CatalogHandler {
+	return &CatalogHandler{catalogRepo: catalogRepo}
+}
+
+// GetCatalog lists the event types observed in ?project= (the default project without
+// one), most frequent first, with the event_data keys seen on each. ?event_type=
+// narrows it to one type.
+func (h *CatalogHandler) GetCatalog(c *fiber.Ctx) error {
+	project := c.Query("project", stats.DefaultProject)
+
+	events, err := h.catalogRepo.List(c.UserContext(), project, c.Query("event_type"))
+	if err != nil {
+		log.Printf("Failed to get event catalog: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get event catalog",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"project": project,
+		"data":    events,
+	})
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// statusClientClosedRequest is returned when the client went away mid-query; nobody
+// reads the response, but it keeps access logs distinguishable from server errors
+const statusClientClosedRequest = 499
+
+// repositoryError maps a repository error to a response: 404 when the record does
+// not exist, 499 when the client disconnected, 504 when the request timed out, and
+// 500 (with the error logged) for everything else
+func repositoryError(c *fiber.Ctx, err error, notFoundMessage, failureMessage string) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": notFoundMessage,
+		})
+	}
+	if errors.Is(err, context.Canceled) {
+		return c.Status(statusClientClosedRequest).JSON(fiber.Map{
+			"error": failureMessage,
+		})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return c.Status(fiber.StatusGatewayTimeout).JSON(fiber.Map{
+			"error":   failureMessage,
+			"details": "Request timed out",
+		})
+	}
+
+	log.Printf("%s: %v", failureMessage, err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": failureMessage,
+	})
+}
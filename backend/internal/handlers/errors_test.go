@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+func TestRepositoryErrorStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"not found", repository.ErrNotFound, fiber.StatusNotFound},
+		{"wrapped not found", fmt.Errorf("failed to get session: %w", repository.ErrNotFound), fiber.StatusNotFound},
+		{"ending unknown session", fmt.Errorf("failed to update session end time: %w", repository.ErrNotFound), fiber.StatusNotFound},
+		{"database failure", errors.New("connection refused"), fiber.StatusInternalServerError},
+		{"wrapped database failure", fmt.Errorf("failed to get session: %w", errors.New("timeout")), fiber.StatusInternalServerError},
+		{"client disconnected", fmt.Errorf("failed to get session: %w", context.Canceled), statusClientClosedRequest},
+		{"request timed out", fmt.Errorf("failed to get session: %w", context.DeadlineExceeded), fiber.StatusGatewayTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				return repositoryError(c, tt.err, "Session not found", "Failed to get session")
+			})
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
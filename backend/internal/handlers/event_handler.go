@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/eventschema"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/pagination"
+	"github.com/ngocp/user-tracker/internal/redact"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/stats"
+	"github.com/ngocp/user-tracker/internal/visibility"
+)
+
+// maxEventWindow bounds a single events query so data syncs stay incremental
+const maxEventWindow = 7 * 24 * time.Hour
+
+type EventHandler struct {
+	eventRepo  *repository.EventRepository
+	schemaRepo *repository.EventSchemaRepository
+}
+
+func NewEventHandler(eventRepo *repository.EventRepository, schemaRepo *repository.EventSchemaRepository) *EventHandler {
+	return &EventHandler{
+		eventRepo:  eventRepo,
+		schemaRepo: schemaRepo,
+	}
+}
+
+// ListEvents returns events across all sessions in a mandatory [from, to) window,
+// paginated with an opaque keyset cursor. With ?typed=true the event_data fields
+// declared in the event schemas of ?project= are returned coerced in typed_data, with
+// a warning for each value that could not be.
+func (h *EventHandler) ListEvents(c *fiber.Ctx) error {
+	from, err := time.Parse(time.RFC3339, c.Query("from"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "from is required and must be an RFC3339 timestamp",
+		})
+	}
+
+	to, err := time.Parse(time.RFC3339, c.Query("to"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "to is required and must be an RFC3339 timestamp",
+		})
+	}
+
+	if !to.After(from) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "to must be after from",
+		})
+	}
+
+	if to.Sub(from) > maxEventWindow {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("time window cannot exceed %v", maxEventWindow),
+		})
+	}
+
+	limit := c.QueryInt("limit", 1000)
+	if limit < 1 || limit > 10000 {
+		limit = 1000
+	}
+
+	filter := repository.EventWindowFilter{
+		From:    from,
+		To:      to,
+		PageURL: c.Query("page_url"),
+		Limit:   limit,
+	}
+
+	var ok bool
+	if filter.FramePath, ok = frameQuery(c); !ok {
+		return invalidFrame(c)
+	}
+
+	if types := c.Query("types"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				filter.EventTypes = append(filter.EventTypes, t)
+			}
+		}
+	}
+
+	if token := c.Query("cursor"); token != "" {
+		cursor, err := pagination.Decode(token)
+		if err == nil {
+			filter.AfterEventID, err = cursor.Int64ID()
+		}
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+		filter.AfterTimestamp = cursor.Timestamp
+	}
+
+	events, err := h.eventRepo.ListByTimeWindow(c.UserContext(), filter)
+	if err != nil {
+		log.Printf("Failed to list events: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list events",
+		})
+	}
+
+	visibility.Events(middleware.RoleFromContext(c), events)
+	if redactedView(c) {
+		redact.Events(events)
+	}
+
+	var warnings []models.CoercionWarning
+	if c.QueryBool("typed", false) {
+		schemas, err := h.schemaRepo.List(c.UserContext(), c.Query("project", stats.DefaultProject))
+		if err != nil {
+			log.Printf("Failed to list event schemas: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to list events",
+			})
+		}
+		warnings = eventschema.New(schemas).Apply(events)
+	}
+
+	var nextCursor string
+	if len(events) == limit {
+		last := events[len(events)-1]
+		nextCursor = pagination.Cursor{Timestamp: last.Timestamp, ID: strconv.FormatInt(last.EventID, 10)}.Encode()
+	}
+
+	response := fiber.Map{
+		"data":        events,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	}
+	if warnings != nil {
+		response["warnings"] = warnings
+	}
+	return c.JSON(response)
+}
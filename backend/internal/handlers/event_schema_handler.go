@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/eventschema"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/stats"
+)
+
+type EventSchemaHandler struct {
+	schemaRepo *repository.EventSchemaRepository
+}
+
+func NewEventSchemaHandler(schemaRepo *repository.EventSchemaRepository) *EventSchemaHandler {
+	return &EventSchemaHandler{schemaRepo: schemaRepo}
+}
+
+// ListSchemas lists the event schemas of ?project= (the default project without one)
+func (h *EventSchemaHandler) ListSchemas(c *fiber.Ctx) error {
+	project := c.Query("project", stats.DefaultProject)
+
+	schemas, err := h.schemaRepo.List(c.UserContext(), project)
+	if err != nil {
+		log.Printf("Failed to list event schemas: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list event schemas",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"project": project,
+		"data":    schemas,
+	})
+}
+
+// PutSchema declares the event_data field types of an event type, replacing its
+// previous schema
+func (h *EventSchemaHandler) PutSchema(c *fiber.Ctx) error {
+	var req models.PutEventSchemaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.Project == "" {
+		req.Project = stats.DefaultProject
+	}
+	if err := validateEventSchema(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid event schema",
+			"details": err.Error(),
+		})
+	}
+
+	schema, err := h.schemaRepo.Put(c.UserContext(), req.Project, req.EventType, req.Fields)
+	if err != nil {
+		log.Printf("Failed to put event schema: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save event schema",
+		})
+	}
+
+	return c.JSON(schema)
+}
+
+// DeleteSchema removes the schema of ?event_type= in ?project=
+func (h *EventSchemaHandler) DeleteSchema(c *fiber.Ctx) error {
+	eventType := c.Query("event_type")
+	if eventType == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "event_type is required",
+		})
+	}
+
+	if err := h.schemaRepo.Delete(c.UserContext(), c.Query("project", stats.DefaultProject), eventType); err != nil {
+		return repositoryError(c, err, "Event schema not found", "Failed to delete event schema")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func validateEventSchema(req *models.PutEventSchemaRequest) error {
+	if len(req.Project) > 100 {
+		return fmt.Errorf("project must be at most 100 characters")
+	}
+	if req.EventType == "" || len(req.EventType) > 50 {
+		return fmt.Errorf("event_type must be 1-50 characters")
+	}
+	if len(req.Fields) == 0 {
+		return fmt.Errorf("fields must declare at least one field")
+	}
+	for field, t := range req.Fields {
+		if field == "" || len(field) > 255 {
+			return fmt.Errorf("field names must be 1-255 characters")
+		}
+		if !eventschema.IsType(t) {
+			return fmt.Errorf("field %q has type %q; use one of %s", field, t, strings.Join(eventschema.Types(), ", "))
+		}
+	}
+	return nil
+}
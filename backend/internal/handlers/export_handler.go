@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/encrypt"
+	"github.com/ngocp/user-tracker/internal/exporter"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/storage"
+	"github.com/ngocp/user-tracker/internal/visibility"
+)
+
+const (
+	// exportPageSize is the number of sessions fetched per keyset query
+	exportPageSize = 500
+	// exportWriteTimeout bounds how long a client may stall reading one page
+	exportWriteTimeout = 30 * time.Second
+)
+
+// ExportJobConfig controls asynchronous export jobs
+type ExportJobConfig struct {
+	// RequireEncryption rejects export jobs without a recipient public key
+	RequireEncryption bool
+	// URLTTL is the lifetime of signed download URLs
+	URLTTL time.Duration
+}
+
+type ExportHandler struct {
+	sessionRepo  *repository.SessionRepository
+	exportRepo   *repository.ExportRepository
+	scheduleRepo *repository.ExportScheduleRepository
+	store        storage.Store
+	urlSigner    storage.URLSigner
+	jobConfig    ExportJobConfig
+}
+
+// NewExportHandler creates the export handler. store is optional; export jobs and
+// schedules are rejected without it.
+func NewExportHandler(
+	sessionRepo *repository.SessionRepository,
+	exportRepo *repository.ExportRepository,
+	scheduleRepo *repository.ExportScheduleRepository,
+	store storage.Store,
+	jobConfig ExportJobConfig,
+) *ExportHandler {
+	signer, _ := store.(storage.URLSigner)
+	return &ExportHandler{
+		sessionRepo:  sessionRepo,
+		exportRepo:   exportRepo,
+		scheduleRepo: scheduleRepo,
+		store:        store,
+		urlSigner:    signer,
+		jobConfig:    jobConfig,
+	}
+}
+
+// ExportSessions streams every session started in [from, to) as NDJSON, oldest first.
+// The next page is only queried once the previous one has been flushed to the client,
+// so a slow reader throttles the export instead of buffering it in memory.
+func (h *ExportHandler) ExportSessions(c *fiber.Ctx) error {
+	from, err := time.Parse(time.RFC3339, c.Query("from"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "from is required and must be an RFC3339 timestamp",
+		})
+	}
+
+	to, err := time.Parse(time.RFC3339, c.Query("to"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "to is required and must be an RFC3339 timestamp",
+		})
+	}
+
+	if !to.After(from) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "to must be after from",
+		})
+	}
+
+	conn := c.Context().Conn()
+	role := middleware.RoleFromContext(c)
+
+	// The body is written after the handler returns; keep the concurrency slot until then
+	release := middleware.HoldConcurrencySlot(c)
+
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer release()
+		encoder := json.NewEncoder(w)
+		var after *time.Time
+		var afterID uuid.UUID
+		var total int
+
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), exportWriteTimeout)
+			sessions, err := h.sessionRepo.ListRange(ctx, from, to, nil, after, afterID, exportPageSize)
+			cancel()
+			if err != nil {
+				log.Printf("Failed to export sessions after %d rows: %v", total, err)
+				encoder.Encode(fiber.Map{"error": "Failed to export sessions"})
+				w.Flush()
+				return
+			}
+
+			visibility.Sessions(role, sessions)
+			for _, session := range sessions {
+				if err := encoder.Encode(session); err != nil {
+					log.Printf("Session export aborted after %d rows: %v", total, err)
+					return
+				}
+			}
+			total += len(sessions)
+
+			// The server's write deadline covers the whole response; extend it per page
+			if conn != nil {
+				conn.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+			}
+			if err := w.Flush(); err != nil {
+				log.Printf("Session export aborted after %d rows: %v", total, err)
+				return
+			}
+
+			if len(sessions) < exportPageSize {
+				return
+			}
+			last := sessions[len(sessions)-1]
+			after, afterID = &last.StartedAt, last.SessionID
+		}
+	})
+
+	return nil
+}
+
+// CreateExport queues an export job that writes sessions or events in [from, to) to
+// blob storage. With an encryption block the bundle is sealed for the given age or
+// gpg public key, so only the key holder can read it.
+func (h *ExportHandler) CreateExport(c *fiber.Ctx) error {
+	if h.store == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Blob storage is not configured; use the streaming export instead",
+		})
+	}
+
+	var req models.CreateExportRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Format == "" {
+		req.Format = models.ExportFormatNDJSON
+	}
+	if msg, details := validateExportTarget(req.Kind, req.Format); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg, "details": details})
+	}
+	if req.From.IsZero() || !req.To.After(req.From) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "from and to are required and to must be after from",
+		})
+	}
+
+	job := &models.ExportJob{
+		Kind:       req.Kind,
+		Format:     req.Format,
+		From:       req.From,
+		To:         req.To,
+		Role:       string(middleware.RoleFromContext(c)),
+		Encryption: encrypt.MethodNone,
+	}
+	key, msg, details := h.parseExportKey(req.Encryption)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg, "details": details})
+	}
+	if key != nil {
+		job.Encryption, job.PublicKey, job.KeyFingerprint = key.method, &key.publicKey, &key.fingerprint
+	}
+
+	created, err := h.exportRepo.Create(c.UserContext(), job)
+	if err != nil {
+		log.Printf("Failed to create export job: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create export job",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(created)
+}
+
+// validateExportTarget checks the kind and format of an export, returning an error
+// message and details when either is unsupported
+func validateExportTarget(kind, format string) (string, string) {
+	if !slices.Contains(exporter.SupportedKinds, kind) {
+		return "Unsupported export kind", "Supported kinds: " + strings.Join(exporter.SupportedKinds, ", ")
+	}
+	if !slices.Contains(exporter.SupportedFormats, format) {
+		return "Unsupported export format", "Supported formats: " + strings.Join(exporter.SupportedFormats, ", ")
+	}
+	return "", ""
+}
+
+// exportKey is a validated recipient key as stored on export jobs and schedules
+type exportKey struct {
+	method      string
+	publicKey   string
+	fingerprint string
+}
+
+// parseExportKey validates the requested encryption. It returns nil for unencrypted
+// exports, or an error message and details when the key is invalid or encryption is
+// required but missing.
+func (h *ExportHandler) parseExportKey(req *models.ExportEncryption) (*exportKey, string, string) {
+	if req == nil || req.Method == "" || req.Method == encrypt.MethodNone {
+		if h.jobConfig.RequireEncryption {
+			return nil, "Export encryption is required", "Provide encryption.method (age or gpg) and encryption.public_key"
+		}
+		return nil, "", ""
+	}
+
+	recipient, err := encrypt.ParseRecipient(req.Method, req.PublicKey)
+	if err != nil {
+		return nil, "Invalid encryption key", err.Error()
+	}
+	return &exportKey{
+		method:      recipient.Method,
+		publicKey:   strings.TrimSpace(req.PublicKey),
+		fingerprint: recipient.Fingerprint,
+	}, "", ""
+}
+
+func (h *ExportHandler) GetExport(c *fiber.Ctx) error {
+	jobID := middleware.ParamUUID(c, "id")
+
+	job, err := h.exportRepo.GetByID(c.UserContext(), jobID)
+	if err != nil {
+		return repositoryError(c, err, "Export job not found", "Failed to get export job")
+	}
+
+	return c.JSON(job)
+}
+
+// DownloadExport redirects to a signed URL for a completed export, or proxies the
+// bundle when the store cannot sign URLs
+func (h *ExportHandler) DownloadExport(c *fiber.Ctx) error {
+	jobID := middleware.ParamUUID(c, "id")
+
+	job, err := h.exportRepo.GetByID(c.UserContext(), jobID)
+	if err != nil {
+		return repositoryError(c, err, "Export job not found", "Failed to get export job")
+	}
+	if job.Status != models.ExportStatusCompleted || job.ObjectKey == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   "Export is not ready",
+			"details": "Export status is " + string(job.Status),
+		})
+	}
+	if h.store == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Blob storage is not configured",
+		})
+	}
+
+	if h.urlSigner != nil {
+		url, err := h.urlSigner.SignedURL(c.UserContext(), *job.ObjectKey, h.jobConfig.URLTTL)
+		if err != nil {
+			log.Printf("Failed to sign export URL for %s: %v", job.JobID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to sign export URL",
+			})
+		}
+		return c.Redirect(url, fiber.StatusFound)
+	}
+
+	data, err := h.store.Get(c.UserContext(), *job.ObjectKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Export bundle no longer exists",
+			})
+		}
+		log.Printf("Failed to read export %s: %v", job.JobID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to read export",
+		})
+	}
+
+	contentType := "application/gzip"
+	if job.Encryption != encrypt.MethodNone {
+		contentType = fiber.MIMEOctetStream
+	}
+	c.Attachment(path.Base(*job.ObjectKey))
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.Send(data)
+}
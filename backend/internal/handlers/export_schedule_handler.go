@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/encrypt"
+	"github.com/ngocp/user-tracker/internal/exporter"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// scheduleRunHistory is the number of recent runs returned with a schedule
+const scheduleRunHistory = 20
+
+// CreateSchedule defines a recurring export, e.g. a daily events CSV or a weekly
+// sessions export, run by the export scheduler on a cron expression
+func (h *ExportHandler) CreateSchedule(c *fiber.Ctx) error {
+	if h.store == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Blob storage is not configured",
+		})
+	}
+
+	var req models.CreateExportScheduleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Name == "" || req.Cron == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "name and cron are required",
+		})
+	}
+	if req.Format == "" {
+		req.Format = models.ExportFormatNDJSON
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if msg, details := validateExportTarget(req.Kind, req.Format); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg, "details": details})
+	}
+
+	nextRunAt, err := exporter.NextRun(req.Cron, req.Timezone, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid schedule",
+			"details": err.Error(),
+		})
+	}
+
+	schedule := &models.ExportSchedule{
+		Name:       req.Name,
+		Cron:       req.Cron,
+		Timezone:   req.Timezone,
+		Kind:       req.Kind,
+		Format:     req.Format,
+		Role:       string(middleware.RoleFromContext(c)),
+		Encryption: encrypt.MethodNone,
+		NotifyURL:  req.NotifyURL,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+		NextRunAt:  nextRunAt,
+	}
+
+	if req.Window != "" {
+		window, err := time.ParseDuration(req.Window)
+		if err != nil || window <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid window",
+				"details": "window must be a positive duration, e.g. 24h",
+			})
+		}
+		seconds := int64(window / time.Second)
+		schedule.WindowSeconds = &seconds
+	}
+
+	key, msg, details := h.parseExportKey(req.Encryption)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg, "details": details})
+	}
+	if key != nil {
+		schedule.Encryption, schedule.PublicKey, schedule.KeyFingerprint = key.method, &key.publicKey, &key.fingerprint
+	}
+
+	created, err := h.scheduleRepo.Create(c.UserContext(), schedule)
+	if err != nil {
+		log.Printf("Failed to create export schedule: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create export schedule",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+func (h *ExportHandler) ListSchedules(c *fiber.Ctx) error {
+	schedules, err := h.scheduleRepo.List(c.UserContext())
+	if err != nil {
+		log.Printf("Failed to list export schedules: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list export schedules",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"schedules": schedules,
+	})
+}
+
+// GetSchedule returns a schedule with its recent runs, newest first
+func (h *ExportHandler) GetSchedule(c *fiber.Ctx) error {
+	scheduleID := middleware.ParamUUID(c, "id")
+
+	schedule, err := h.scheduleRepo.GetByID(c.UserContext(), scheduleID)
+	if err != nil {
+		return repositoryError(c, err, "Export schedule not found", "Failed to get export schedule")
+	}
+
+	limit := c.QueryInt("runs", scheduleRunHistory)
+	if limit <= 0 || limit > 500 {
+		limit = scheduleRunHistory
+	}
+	runs, err := h.exportRepo.ListBySchedule(c.UserContext(), scheduleID, limit)
+	if err != nil {
+		log.Printf("Failed to list runs of export schedule %s: %v", scheduleID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get export schedule runs",
+		})
+	}
+
+	return c.JSON(models.ExportScheduleDetail{ExportSchedule: *schedule, Runs: runs})
+}
+
+// UpdateSchedule changes a schedule's name, cron, timezone, notify URL or enabled flag.
+// The next run is recomputed from now when the timing changes or the schedule is
+// re-enabled, so runs missed while disabled are not caught up.
+func (h *ExportHandler) UpdateSchedule(c *fiber.Ctx) error {
+	scheduleID := middleware.ParamUUID(c, "id")
+
+	var req models.UpdateExportScheduleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	schedule, err := h.scheduleRepo.GetByID(c.UserContext(), scheduleID)
+	if err != nil {
+		return repositoryError(c, err, "Export schedule not found", "Failed to get export schedule")
+	}
+
+	reschedule := false
+	if req.Name != nil {
+		schedule.Name = *req.Name
+	}
+	if req.Cron != nil {
+		schedule.Cron = *req.Cron
+		reschedule = true
+	}
+	if req.Timezone != nil {
+		schedule.Timezone = *req.Timezone
+		reschedule = true
+	}
+	if req.NotifyURL != nil {
+		schedule.NotifyURL = req.NotifyURL
+	}
+	if req.Enabled != nil {
+		reschedule = reschedule || (*req.Enabled && !schedule.Enabled)
+		schedule.Enabled = *req.Enabled
+	}
+
+	if reschedule {
+		nextRunAt, err := exporter.NextRun(schedule.Cron, schedule.Timezone, time.Now())
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid schedule",
+				"details": err.Error(),
+			})
+		}
+		schedule.NextRunAt = nextRunAt
+	}
+
+	updated, err := h.scheduleRepo.Update(c.UserContext(), schedule)
+	if err != nil {
+		return repositoryError(c, err, "Export schedule not found", "Failed to update export schedule")
+	}
+
+	return c.JSON(updated)
+}
+
+// DeleteSchedule removes a schedule; its past runs are kept
+func (h *ExportHandler) DeleteSchedule(c *fiber.Ctx) error {
+	scheduleID := middleware.ParamUUID(c, "id")
+
+	if err := h.scheduleRepo.Delete(c.UserContext(), scheduleID); err != nil {
+		return repositoryError(c, err, "Export schedule not found", "Failed to delete export schedule")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
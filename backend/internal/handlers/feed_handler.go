@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// Problem session feed bounds
+const (
+	defaultFeedHours = 24
+	maxFeedHours     = 7 * 24
+	maxFeedLimit     = 200
+)
+
+// FeedConfig sets what counts as a problem: clicks with click_count of at least
+// RageClickThreshold are rage clicks, and a minute scoring at least SpikeScore is a
+// frustration spike
+type FeedConfig struct {
+	RageClickThreshold int
+	SpikeScore         int
+}
+
+type FeedHandler struct {
+	feedRepo *repository.FeedRepository
+	config   FeedConfig
+}
+
+func NewFeedHandler(feedRepo *repository.FeedRepository, config FeedConfig) *FeedHandler {
+	return &FeedHandler{
+		feedRepo: feedRepo,
+		config:   config,
+	}
+}
+
+// GetProblemSessions lists the most recent sessions with errors, rage clicks or
+// frustration spikes in the last ?hours=, each annotated with the reasons it is listed
+func (h *FeedHandler) GetProblemSessions(c *fiber.Ctx) error {
+	hours := c.QueryInt("hours", defaultFeedHours)
+	if hours < 1 || hours > maxFeedHours {
+		hours = defaultFeedHours
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > maxFeedLimit {
+		limit = 50
+	}
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	sessions, err := h.feedRepo.ProblemSessions(c.UserContext(), since, h.config.RageClickThreshold, limit)
+	if err != nil {
+		log.Printf("Failed to list problem sessions: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list problem sessions",
+		})
+	}
+
+	for _, session := range sessions {
+		session.Reasons = h.reasons(session)
+	}
+	if sessions == nil {
+		sessions = []*models.ProblemSession{}
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  sessions,
+		"hours": hours,
+	})
+}
+
+func (h *FeedHandler) reasons(s *models.ProblemSession) []models.ProblemReason {
+	var reasons []models.ProblemReason
+	if s.ErrorCount > 0 {
+		reasons = append(reasons, models.ProblemReason{
+			Type:   models.ProblemReasonErrors,
+			Count:  s.ErrorCount,
+			Detail: s.FirstError,
+		})
+	}
+	if s.RageClickCount > 0 {
+		reasons = append(reasons, models.ProblemReason{
+			Type:   models.ProblemReasonRageClicks,
+			Count:  s.RageClickCount,
+			Detail: s.TopRageTarget,
+		})
+	}
+	if s.PeakScore >= h.config.SpikeScore {
+		peakAt := s.PeakAt
+		reasons = append(reasons, models.ProblemReason{
+			Type:  models.ProblemReasonFrustrationSpike,
+			Score: s.PeakScore,
+			At:    &peakAt,
+		})
+	}
+	return reasons
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// frameQuery returns the ?frame= filter of event reads ("" for all frames) and whether
+// it is a valid frame path
+func frameQuery(c *fiber.Ctx) (string, bool) {
+	frame := c.Query("frame")
+	return frame, frame == "" || models.ValidFramePath(frame)
+}
+
+func invalidFrame(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":   "Invalid frame",
+		"details": "frame must be a path from the top document, e.g. main>iframe#checkout",
+	})
+}
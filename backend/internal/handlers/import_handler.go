@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/importer"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/storage"
+)
+
+type ImportHandler struct {
+	importRepo *repository.ImportRepository
+	store      storage.Store
+}
+
+func NewImportHandler(importRepo *repository.ImportRepository, store storage.Store) *ImportHandler {
+	return &ImportHandler{
+		importRepo: importRepo,
+		store:      store,
+	}
+}
+
+// CreateImport queues a bulk import. The body is either the export itself or, with a
+// JSON content type, an object_key pointing at it in blob storage. The source query
+// parameter selects the format: native NDJSON or a FullStory/Hotjar export.
+func (h *ImportHandler) CreateImport(c *fiber.Ctx) error {
+	source := c.Query("source", importer.SourceNDJSON)
+
+	var payload []byte
+	var objectKey *string
+
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		var req models.CreateImportRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+		if req.ObjectKey == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "object_key is required",
+			})
+		}
+		if h.store == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Blob storage is not configured; upload NDJSON instead",
+			})
+		}
+		if req.Source != "" {
+			source = req.Source
+		}
+		objectKey = &req.ObjectKey
+	} else {
+		if len(c.Body()) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Request body must contain the records to import",
+			})
+		}
+		// fasthttp reuses the body buffer after the handler returns
+		payload = append([]byte(nil), c.Body()...)
+	}
+
+	if !importer.IsSupportedSource(source) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Unsupported import source",
+			"details": "Supported sources: " + strings.Join(importer.SupportedSources(), ", "),
+		})
+	}
+
+	job, err := h.importRepo.Create(c.UserContext(), source, payload, objectKey)
+	if err != nil {
+		log.Printf("Failed to create import job: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create import job",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+func (h *ImportHandler) GetImport(c *fiber.Ctx) error {
+	jobID := middleware.ParamUUID(c, "id")
+
+	job, err := h.importRepo.GetByID(c.UserContext(), jobID)
+	if err != nil {
+		return repositoryError(c, err, "Import job not found", "Failed to get import job")
+	}
+
+	return c.JSON(job)
+}
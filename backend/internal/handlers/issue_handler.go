@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+type IssueHandler struct {
+	issueRepo  *repository.IssueRepository
+	markerRepo *repository.MarkerRepository
+}
+
+func NewIssueHandler(issueRepo *repository.IssueRepository, markerRepo *repository.MarkerRepository) *IssueHandler {
+	return &IssueHandler{
+		issueRepo:  issueRepo,
+		markerRepo: markerRepo,
+	}
+}
+
+func (h *IssueHandler) ListIssues(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	offset := c.QueryInt("offset", 0)
+	trendDays := c.QueryInt("trend_days", 7)
+
+	if limit > 100 {
+		limit = 100
+	}
+	if trendDays < 1 || trendDays > 90 {
+		trendDays = 7
+	}
+
+	issues, err := h.issueRepo.List(c.UserContext(), limit, offset)
+	if err != nil {
+		log.Printf("Failed to list issues: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list issues",
+		})
+	}
+
+	for _, issue := range issues {
+		trend, err := h.issueRepo.GetTrend(c.UserContext(), issue.IssueID, trendDays)
+		if err != nil {
+			log.Printf("Failed to get trend for issue %d: %v", issue.IssueID, err)
+			continue
+		}
+		issue.Trend = trend
+	}
+
+	total, err := h.issueRepo.Count(c.UserContext())
+	if err != nil {
+		log.Printf("Failed to count issues: %v", err)
+		total = 0
+	}
+
+	return c.JSON(fiber.Map{
+		"data":   issues,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (h *IssueHandler) GetIssue(c *fiber.Ctx) error {
+	issueID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid issue ID",
+		})
+	}
+
+	issue, err := h.issueRepo.GetByID(c.UserContext(), issueID)
+	if err != nil {
+		return repositoryError(c, err, "Issue not found", "Failed to get issue")
+	}
+
+	trend, err := h.issueRepo.GetTrend(c.UserContext(), issueID, 30)
+	if err != nil {
+		log.Printf("Failed to get trend for issue %d: %v", issueID, err)
+	}
+	issue.Trend = trend
+
+	sessionIDs, err := h.issueRepo.ListSessionIDs(c.UserContext(), issueID, 50)
+	if err != nil {
+		log.Printf("Failed to list sessions for issue %d: %v", issueID, err)
+	}
+
+	// Deploys around the issue's lifetime help correlate it with a release
+	markers, err := h.markerRepo.ListBetween(c.UserContext(), "", issue.FirstSeenAt.Add(-24*time.Hour), issue.LastSeenAt)
+	if err != nil {
+		log.Printf("Failed to list markers for issue %d: %v", issueID, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"issue":    issue,
+		"sessions": sessionIDs,
+		"markers":  markers,
+	})
+}
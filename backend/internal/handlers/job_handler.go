@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// Job types under which imports and exports are reported by GET /jobs/:id
+const (
+	jobTypeImport = "import"
+	jobTypeExport = "export"
+)
+
+type JobHandler struct {
+	jobRepo    *repository.JobRepository
+	importRepo *repository.ImportRepository
+	exportRepo *repository.ExportRepository
+}
+
+func NewJobHandler(jobRepo *repository.JobRepository, importRepo *repository.ImportRepository, exportRepo *repository.ExportRepository) *JobHandler {
+	return &JobHandler{
+		jobRepo:    jobRepo,
+		importRepo: importRepo,
+		exportRepo: exportRepo,
+	}
+}
+
+// GetJob reports the status and progress of any long-running task by ID: generic
+// background jobs, imports and exports. The feature-specific record is returned as
+// the job's result.
+func (h *JobHandler) GetJob(c *fiber.Ctx) error {
+	jobID := middleware.ParamUUID(c, "id")
+
+	job, err := h.findJob(c, jobID)
+	if err != nil {
+		return repositoryError(c, err, "Job not found", "Failed to get job")
+	}
+
+	return c.JSON(job)
+}
+
+func (h *JobHandler) findJob(c *fiber.Ctx, jobID uuid.UUID) (*models.Job, error) {
+	job, err := h.jobRepo.GetByID(c.UserContext(), jobID)
+	if !errors.Is(err, repository.ErrNotFound) {
+		return job, err
+	}
+
+	imp, err := h.importRepo.GetByID(c.UserContext(), jobID)
+	if err == nil {
+		return importAsJob(imp), nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	exp, err := h.exportRepo.GetByID(c.UserContext(), jobID)
+	if err != nil {
+		return nil, err
+	}
+	return exportAsJob(exp), nil
+}
+
+func importAsJob(imp *models.ImportJob) *models.Job {
+	result, _ := json.Marshal(imp)
+	return &models.Job{
+		JobID:       imp.JobID,
+		Type:        jobTypeImport,
+		Status:      models.JobStatus(imp.Status),
+		Progress:    models.JobProgress{Done: imp.LinesProcessed},
+		Result:      result,
+		Error:       imp.Error,
+		Attempts:    1,
+		MaxAttempts: 1,
+		CreatedAt:   imp.CreatedAt,
+		StartedAt:   imp.StartedAt,
+		FinishedAt:  imp.FinishedAt,
+	}
+}
+
+func exportAsJob(exp *models.ExportJob) *models.Job {
+	result, _ := json.Marshal(exp)
+	return &models.Job{
+		JobID:       exp.JobID,
+		Type:        jobTypeExport,
+		Status:      models.JobStatus(exp.Status),
+		Progress:    models.JobProgress{Done: exp.RowsExported},
+		Result:      result,
+		Error:       exp.Error,
+		Attempts:    1,
+		MaxAttempts: 1,
+		CreatedAt:   exp.CreatedAt,
+		StartedAt:   exp.StartedAt,
+		FinishedAt:  exp.FinishedAt,
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"log"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// maxExternalIDLength matches the external_id column
+const maxExternalIDLength = 255
+
+type LinkHandler struct {
+	linkRepo *repository.LinkRepository
+}
+
+func NewLinkHandler(linkRepo *repository.LinkRepository) *LinkHandler {
+	return &LinkHandler{linkRepo: linkRepo}
+}
+
+// invalidLinkType answers 400 for a type that is not one of models.LinkTypes
+func invalidLinkType(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":   "Invalid type",
+		"details": "Use " + strings.Join(models.LinkTypes, ", "),
+	})
+}
+
+// CreateLink attaches an external reference, e.g. a Zendesk ticket, to the session.
+// Linking the same reference again is idempotent and updates its URL.
+func (h *LinkHandler) CreateLink(c *fiber.Ctx) error {
+	sessionID := middleware.ParamUUID(c, "id")
+
+	var req models.CreateSessionLinkRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	req.Type = strings.ToLower(strings.TrimSpace(req.Type))
+	if !slices.Contains(models.LinkTypes, req.Type) {
+		return invalidLinkType(c)
+	}
+	req.ExternalID = strings.TrimSpace(req.ExternalID)
+	if req.ExternalID == "" || len(req.ExternalID) > maxExternalIDLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid external_id",
+			"details": "external_id must be 1-255 characters",
+		})
+	}
+	if req.URL != nil && *req.URL != "" {
+		if u, err := url.Parse(*req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid url",
+				"details": "url must be an http(s) URL",
+			})
+		}
+	} else {
+		req.URL = nil
+	}
+
+	link, created, err := h.linkRepo.Create(c.UserContext(), sessionID, &req)
+	if err != nil {
+		return repositoryError(c, err, "Session not found", "Failed to create session link")
+	}
+
+	status := fiber.StatusOK
+	if created {
+		status = fiber.StatusCreated
+	}
+	return c.Status(status).JSON(link)
+}
+
+// ListLinks returns the external references attached to the session
+func (h *LinkHandler) ListLinks(c *fiber.Ctx) error {
+	sessionID := middleware.ParamUUID(c, "id")
+
+	links, err := h.linkRepo.ListBySession(c.UserContext(), sessionID)
+	if err != nil {
+		log.Printf("Failed to list session links: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list session links",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": links,
+	})
+}
+
+// DeleteLink detaches an external reference from the session
+func (h *LinkHandler) DeleteLink(c *fiber.Ctx) error {
+	sessionID := middleware.ParamUUID(c, "id")
+	linkID, err := strconv.ParseInt(c.Params("linkId"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid link ID",
+		})
+	}
+
+	if err := h.linkRepo.Delete(c.UserContext(), sessionID, linkID); err != nil {
+		return repositoryError(c, err, "Session link not found", "Failed to delete session link")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// LookupLinks is the reverse lookup: the sessions linked to ?type=&external_id=,
+// newest first, so an integration can list the replays attached to a ticket
+func (h *LinkHandler) LookupLinks(c *fiber.Ctx) error {
+	linkType := strings.ToLower(c.Query("type"))
+	if !slices.Contains(models.LinkTypes, linkType) {
+		return invalidLinkType(c)
+	}
+	externalID := strings.TrimSpace(c.Query("external_id"))
+	if externalID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "external_id is required",
+		})
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	links, err := h.linkRepo.ListByExternal(c.UserContext(), linkType, externalID, limit)
+	if err != nil {
+		log.Printf("Failed to look up session links: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to look up session links",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": links,
+	})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/liveness"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// livenessWriteTimeout bounds each liveness stream update, including its session read
+const livenessWriteTimeout = 10 * time.Second
+
+type LivenessHandler struct {
+	sessionRepo *repository.SessionRepository
+	tracker     *liveness.Tracker
+	interval    time.Duration
+	maxStream   time.Duration
+}
+
+// NewLivenessHandler creates the handler. Streams send an update every interval and
+// close after maxStream, which EventSource clients reconnect from on their own, so
+// shutdown never waits on an open dashboard.
+func NewLivenessHandler(sessionRepo *repository.SessionRepository, tracker *liveness.Tracker, interval, maxStream time.Duration) *LivenessHandler {
+	return &LivenessHandler{
+		sessionRepo: sessionRepo,
+		tracker:     tracker,
+		interval:    interval,
+		maxStream:   maxStream,
+	}
+}
+
+// Heartbeat records that a tab of the session is still open. The tracker sends one
+// periodically for as long as the page is loaded, whether or not the visitor is
+// interacting with it.
+func (h *LivenessHandler) Heartbeat(c *fiber.Ctx) error {
+	sessionID := middleware.ParamUUID(c, "id")
+
+	if err := h.tracker.Heartbeat(c.UserContext(), sessionID); err != nil {
+		log.Printf("Failed to record heartbeat of session %s: %v", sessionID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record heartbeat",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetLiveness reports whether the session is still being recorded, how long ago its
+// last events arrived and whether its tabs are still sending heartbeats
+func (h *LivenessHandler) GetLiveness(c *fiber.Ctx) error {
+	session, err := h.sessionRepo.GetByID(c.UserContext(), middleware.ParamUUID(c, "id"))
+	if err != nil {
+		return repositoryError(c, err, "Session not found", "Failed to get session")
+	}
+
+	status, err := h.tracker.Get(c.UserContext(), session)
+	if err != nil {
+		log.Printf("Failed to get liveness of session %s: %v", session.SessionID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get session liveness",
+		})
+	}
+
+	return c.JSON(status)
+}
+
+// StreamLiveness sends the session's liveness as a server-sent "liveness" event
+// every interval, so the dashboard can flip a session from LIVE to ENDED as it
+// happens. The stream closes after maxStream or when the client goes away.
+func (h *LivenessHandler) StreamLiveness(c *fiber.Ctx) error {
+	sessionID := middleware.ParamUUID(c, "id")
+
+	// Fail with a normal status before the stream starts when the session is unknown
+	if _, err := h.sessionRepo.GetByID(c.UserContext(), sessionID); err != nil {
+		return repositoryError(c, err, "Session not found", "Failed to get session")
+	}
+
+	conn := c.Context().Conn()
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	// Keep reverse proxies from buffering the stream
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		deadline := time.After(h.maxStream)
+
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), livenessWriteTimeout)
+			session, err := h.sessionRepo.GetByID(ctx, sessionID)
+			if err == nil {
+				status, getErr := h.tracker.Get(ctx, session)
+				if err = getErr; err == nil {
+					var data []byte
+					if data, err = json.Marshal(status); err == nil {
+						fmt.Fprintf(w, "event: liveness\ndata: %s\n\n", data)
+					}
+				}
+			}
+			cancel()
+			if err != nil {
+				log.Printf("Failed to stream liveness of session %s: %v", sessionID, err)
+				fmt.Fprintf(w, "event: error\ndata: {\"error\":\"Failed to get session liveness\"}\n\n")
+			}
+
+			// The server's write deadline covers the whole response; extend it per update
+			if conn != nil {
+				conn.SetWriteDeadline(time.Now().Add(h.interval + livenessWriteTimeout))
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+
+			select {
+			case <-deadline:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+	return nil
+}
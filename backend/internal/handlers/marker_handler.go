@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+type MarkerHandler struct {
+	markerRepo *repository.MarkerRepository
+}
+
+func NewMarkerHandler(markerRepo *repository.MarkerRepository) *MarkerHandler {
+	return &MarkerHandler{
+		markerRepo: markerRepo,
+	}
+}
+
+func (h *MarkerHandler) CreateMarker(c *fiber.Ctx) error {
+	var req models.CreateMarkerRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.Project == "" {
+		req.Project = "default"
+	}
+	if req.Kind == "" {
+		req.Kind = "deploy"
+	}
+
+	marker, err := h.markerRepo.Create(c.UserContext(), &req)
+	if err != nil {
+		log.Printf("Failed to create marker: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create marker",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(marker)
+}
+
+func (h *MarkerHandler) ListMarkers(c *fiber.Ctx) error {
+	to := time.Now()
+	from := to.Add(-30 * 24 * time.Hour)
+
+	if v := c.Query("from"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid from timestamp, expected RFC3339",
+			})
+		}
+		from = parsed
+	}
+	if v := c.Query("to"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid to timestamp, expected RFC3339",
+			})
+		}
+		to = parsed
+	}
+
+	markers, err := h.markerRepo.ListBetween(c.UserContext(), c.Query("project"), from, to)
+	if err != nil {
+		log.Printf("Failed to list markers: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list markers",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": markers,
+	})
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/canary"
+	"github.com/ngocp/user-tracker/internal/malware"
+	"github.com/ngocp/user-tracker/internal/queue"
+	"github.com/ngocp/user-tracker/internal/stats"
+)
+
+// scalingMetricValues maps ?metric= names to single scaling values
+var scalingMetricValues = map[string]func(m *queue.ScalingMetrics) float64{
+	"backlog":              func(m *queue.ScalingMetrics) float64 { return float64(m.Backlog) },
+	"backlog_per_consumer": func(m *queue.ScalingMetrics) float64 { return m.BacklogPerConsumer },
+	"lag":                  func(m *queue.ScalingMetrics) float64 { return float64(m.Lag) },
+	"pending":              func(m *queue.ScalingMetrics) float64 { return float64(m.Pending) },
+	"oldest_pending_age": func(m *queue.ScalingMetrics) float64 {
+		return max(m.OldestPendingAgeSeconds, m.OldestUnreadAgeSeconds)
+	},
+}
+
+type MetricsHandler struct {
+	eventQueue   *queue.EventQueue
+	processor    *queue.EventProcessor
+	activeWithin time.Duration
+	scanGuard    *malware.Guard
+	drops        *stats.DropCounter
+	canary       *canary.Canary
+}
+
+// NewMetricsHandler creates the metrics handler; consumers idle for longer than
+// activeWithin are not counted as active replicas' workers. scanGuard, drops and probe
+// may be nil.
+func NewMetricsHandler(eventQueue *queue.EventQueue, processor *queue.EventProcessor, activeWithin time.Duration, scanGuard *malware.Guard, drops *stats.DropCounter, probe *canary.Canary) *MetricsHandler {
+	return &MetricsHandler{
+		eventQueue:   eventQueue,
+		processor:    processor,
+		activeWithin: activeWithin,
+		scanGuard:    scanGuard,
+		drops:        drops,
+		canary:       probe,
+	}
+}
+
+// GetScaling reports the event stream backlog for autoscalers. With ?metric=<name> it
+// returns only {"metric": name, "value": v}, for KEDA's metrics-api scaler
+// (valueLocation "value") or an HPA external metrics adapter.
+func (h *MetricsHandler) GetScaling(c *fiber.Ctx) error {
+	metrics, err := h.eventQueue.GetScalingMetrics(c.UserContext(), h.activeWithin)
+	if err != nil {
+		log.Printf("Failed to get scaling metrics: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get scaling metrics",
+		})
+	}
+
+	name := c.Query("metric")
+	if name == "" {
+		return c.JSON(metrics)
+	}
+
+	value, ok := scalingMetricValues[name]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Unknown metric",
+			"details": "Use backlog, backlog_per_consumer, lag, pending or oldest_pending_age",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"metric": name,
+		"value":  value(metrics),
+	})
+}
+
+// GetProcessor reports the distribution of events per message, messages and sessions
+// per read batch, and insert duration per session batch in this instance's processor
+func (h *MetricsHandler) GetProcessor(c *fiber.Ctx) error {
+	return c.JSON(h.processor.BatchMetrics())
+}
+
+// GetScanning reports this instance's upload malware scan outcomes since it started
+func (h *MetricsHandler) GetScanning(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"enabled": h.scanGuard != nil,
+		"stats":   h.scanGuard.Stats(),
+	})
+}
+
+// GetDrops reports the events this instance dropped in degrade mode since it started,
+// per project and reason
+func (h *MetricsHandler) GetDrops(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"degrade_mode": h.drops != nil,
+		"data":         h.drops.Snapshot(),
+	})
+}
+
+// GetCanary reports the synthetic ingest probes: end-to-end latency of the last
+// successful probe, failures and the last error
+func (h *MetricsHandler) GetCanary(c *fiber.Ctx) error {
+	return c.JSON(h.canary.Status())
+}
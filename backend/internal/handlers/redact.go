@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/redact"
+)
+
+// redactedView reports whether the caller asked for the privacy preview (?redacted=true),
+// which applies the same masking third parties with share links get
+func redactedView(c *fiber.Ctx) bool {
+	return c.QueryBool("redacted", false)
+}
+
+// screenshotDataURL encodes a screenshot as a data URL, pixelated when redacted
+func screenshotDataURL(screenshot *models.Screenshot, redacted bool) (string, error) {
+	format, data := screenshot.ImageFormat, screenshot.ImageData
+	if redacted {
+		var err error
+		if data, err = redact.Screenshot(data); err != nil {
+			return "", err
+		}
+		format = "png"
+	}
+	return fmt.Sprintf("data:image/%s;base64,%s", format, base64.StdEncoding.EncodeToString(data)), nil
+}
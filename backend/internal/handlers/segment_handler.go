@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/queue"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/stats"
+	"github.com/ngocp/user-tracker/internal/urlgroup"
+	"github.com/ngocp/user-tracker/internal/validation"
+)
+
+// Bounds of Segment payloads; event types are stored in a VARCHAR(50) and identities
+// become part of the session fingerprint
+const (
+	maxSegmentBatch     = 500
+	maxSegmentEventName = 50
+	maxSegmentIdentity  = 200
+	maxSegmentMessageID = 100
+)
+
+// segmentTypes are the message types mapped onto sessions and events
+var segmentTypes = map[string]bool{
+	models.SegmentTypeTrack:    true,
+	models.SegmentTypePage:     true,
+	models.SegmentTypeScreen:   true,
+	models.SegmentTypeIdentify: true,
+}
+
+// segmentPageURL stands in for the page of sessions started by calls without one,
+// such as track calls from Segment's server libraries
+const segmentPageURL = "about:blank"
+
+// SegmentHandler accepts Segment-spec calls on /v1/*, so sites instrumented with
+// analytics.js can send them here by changing the API host. The write key is the
+// public key of a tracker key.
+type SegmentHandler struct {
+	keyRepo       *repository.TrackerKeyRepository
+	sessionRepo   *repository.SessionRepository
+	eventQueue    queue.Queue
+	ingestStats   *stats.IngestCounters
+	sessionWindow time.Duration
+	domainPolicy  *validation.DomainPolicy
+	urlRules      *urlgroup.Cache
+	deduper       *queue.BatchDeduper
+}
+
+// NewSegmentHandler creates the handler. Calls of an anonymousId continue its session
+// while it was active within sessionWindow. Page URLs go through domainPolicy and
+// urlRules like those sent to /track, and deduper skips messages whose messageId
+// was already applied.
+func NewSegmentHandler(keyRepo *repository.TrackerKeyRepository, sessionRepo *repository.SessionRepository, eventQueue queue.Queue, ingestStats *stats.IngestCounters, sessionWindow time.Duration, domainPolicy *validation.DomainPolicy, urlRules *urlgroup.Cache, deduper *queue.BatchDeduper) *SegmentHandler {
+	return &SegmentHandler{
+		keyRepo:       keyRepo,
+		sessionRepo:   sessionRepo,
+		eventQueue:    eventQueue,
+		ingestStats:   ingestStats,
+		sessionWindow: sessionWindow,
+		domainPolicy:  domainPolicy,
+		urlRules:      urlRules,
+		deduper:       deduper,
+	}
+}
+
+// Batch handles POST /v1/batch
+func (h *SegmentHandler) Batch(c *fiber.Ctx) error {
+	var req models.SegmentBatchRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+	}
+	if len(req.Batch) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "batch cannot be empty",
+			"details": "At least one message must be provided",
+		})
+	}
+	if len(req.Batch) > maxSegmentBatch {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Batch too large",
+			"details": fmt.Sprintf("A batch may carry at most %d messages", maxSegmentBatch),
+		})
+	}
+
+	writeKey := req.WriteKey
+	if writeKey == "" {
+		writeKey = req.Batch[0].WriteKey
+	}
+	return h.ingest(c, writeKey, req.Batch)
+}
+
+// Message returns the handler of a single-call endpoint such as POST /v1/track,
+// which takes the message type from the path when the body omits it
+func (h *SegmentHandler) Message(messageType string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var msg models.SegmentMessage
+		if err := c.BodyParser(&msg); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+		}
+		if msg.Type == "" {
+			msg.Type = messageType
+		}
+		return h.ingest(c, msg.WriteKey, []models.SegmentMessage{msg})
+	}
+}
+
+// ingest authenticates the write key, then queues the messages as events of the
+// session of each anonymousId
+func (h *SegmentHandler) ingest(c *fiber.Ctx, bodyWriteKey string, messages []models.SegmentMessage) error {
+	key, err := h.authenticate(c, bodyWriteKey)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return nil
+	}
+
+	if key.Sandbox {
+		c.SetUserContext(stats.NewProjectContext(c.UserContext(), stats.SandboxProject))
+	}
+	ctx := c.UserContext()
+	project := stats.ProjectFromContext(ctx)
+
+	h.ingestStats.Add(ctx, project, stats.StageReceived, len(messages))
+	defer func() {
+		if status := c.Response().StatusCode(); status >= 400 && status < 500 {
+			h.ingestStats.Add(ctx, project, stats.StageRejected, len(messages))
+		}
+	}()
+
+	// Group the messages by visitor, keeping the order they were sent in. Calls of
+	// types without a mapping, such as group and alias, are skipped.
+	var identities []string
+	var skipped int
+	byIdentity := make(map[string][]models.SegmentMessage)
+	for i, msg := range messages {
+		if !segmentTypes[msg.Type] {
+			skipped++
+			continue
+		}
+		if details := validateSegmentMessage(msg); details != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid message",
+				"details": fmt.Sprintf("Message at index %d %s", i, details),
+			})
+		}
+		// Calls without a page, such as those of server libraries, are not checked
+		if pageURL := segmentPageURLOf(msg, ""); pageURL != "" && !h.domainPolicy.Allows(pageURL) && h.domainPolicy.Rejects() {
+			log.Printf("[Segment] Rejected message[%d] from unregistered domain: %s", i, pageURL)
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "Page URL not allowed",
+				"details": fmt.Sprintf("Message at index %d has a page URL outside the registered domains", i),
+			})
+		}
+		identity := segmentIdentity(msg)
+		if _, ok := byIdentity[identity]; !ok {
+			identities = append(identities, identity)
+		}
+		byIdentity[identity] = append(byIdentity[identity], msg)
+	}
+
+	// When a visitor fails, the messages of those before it stay claimed, so the
+	// library's retry of the batch only applies the rest
+	var queued, duplicates int
+	for _, identity := range identities {
+		n, dup, err := h.ingestVisitor(ctx, key, identity, byIdentity[identity])
+		duplicates += dup
+		if err != nil {
+			log.Printf("[Segment] Failed to ingest messages of %s for tracker key %s: %v", identity, key.KeyID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to queue events",
+			})
+		}
+		queued += n
+	}
+
+	h.ingestStats.Add(ctx, project, stats.StageEnqueued, queued)
+	if duplicates > 0 {
+		h.ingestStats.Add(ctx, project, stats.StageDuplicate, duplicates)
+	}
+	if skipped > 0 {
+		h.ingestStats.Add(ctx, project, stats.StageRejected, skipped)
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// ingestVisitor applies one visitor's messages to their session and queues the
+// resulting events, returning how many were queued and how many messages were
+// skipped as already applied. The messageIds it claims are released on failure.
+func (h *SegmentHandler) ingestVisitor(ctx context.Context, key *models.TrackerKey, identity string, messages []models.SegmentMessage) (queued, duplicates int, err error) {
+	var fresh []models.SegmentMessage
+	for _, msg := range messages {
+		if !h.deduper.Claim(ctx, key.KeyID, msg.MessageID) {
+			duplicates++
+			continue
+		}
+		fresh = append(fresh, msg)
+	}
+	if len(fresh) == 0 {
+		return 0, duplicates, nil
+	}
+	defer func() {
+		if err != nil {
+			for _, msg := range fresh {
+				h.deduper.Release(ctx, key.KeyID, msg.MessageID)
+			}
+		}
+	}()
+
+	session, err := h.resolveSession(ctx, key, identity, fresh[0])
+	if err != nil {
+		return 0, duplicates, err
+	}
+
+	var events []models.EventData
+	for _, msg := range fresh {
+		if msg.Type == models.SegmentTypeIdentify {
+			if err := h.identify(ctx, session, msg); err != nil {
+				return 0, duplicates, err
+			}
+			continue
+		}
+		event := segmentEvent(msg, session.PageURL)
+		if segmentPageURLOf(msg, "") != "" {
+			checkPageDomain(h.domainPolicy, &event)
+		}
+		events = append(events, event)
+	}
+
+	if len(events) == 0 {
+		return 0, duplicates, nil
+	}
+	if err := h.urlRules.Stamp(ctx, key.KeyID, events); err != nil {
+		log.Printf("[Segment] Failed to normalize page URLs for session %s: %v", session.SessionID, err)
+	}
+	if err := h.eventQueue.Enqueue(ctx, session.SessionID, events); err != nil {
+		return 0, duplicates, err
+	}
+	return len(events), duplicates, nil
+}
+
+// resolveSession continues the visitor's session when it was recently active, or
+// starts one from the context of their first message
+func (h *SegmentHandler) resolveSession(ctx context.Context, key *models.TrackerKey, identity string, first models.SegmentMessage) (*models.Session, error) {
+	fingerprint := "segment:" + key.KeyID.String() + ":" + identity
+
+	session, err := h.sessionRepo.FindResumable(ctx, fingerprint, h.sessionWindow, key.Sandbox)
+	if err != nil {
+		return nil, err
+	}
+	if session != nil {
+		return session, nil
+	}
+
+	sdk := segmentSDK(first)
+	req := &models.CreateSessionRequest{
+		Fingerprint:  &fingerprint,
+		PageURL:      segmentPageURLOf(first, segmentPageURL),
+		Referrer:     optionalString(first.Context.Page.Referrer),
+		UserAgent:    optionalString(first.Context.UserAgent),
+		ScreenWidth:  first.Context.Screen.Width,
+		ScreenHeight: first.Context.Screen.Height,
+		UserID:       optionalString(first.UserID),
+		Metadata:     map[string]interface{}{"source": "segment"},
+		SDK:          &sdk,
+		Sandbox:      key.Sandbox,
+	}
+	return h.sessionRepo.Create(ctx, req)
+}
+
+// identify attributes the session to the message's userId and keeps its traits in
+// the session metadata
+func (h *SegmentHandler) identify(ctx context.Context, session *models.Session, msg models.SegmentMessage) error {
+	if msg.UserID != "" && (session.UserID == nil || *session.UserID != msg.UserID) {
+		if err := h.sessionRepo.SetUserID(ctx, session.SessionID, msg.UserID); err != nil {
+			return err
+		}
+		session.UserID = &msg.UserID
+	}
+
+	traits := msg.Traits
+	if len(traits) == 0 {
+		traits = msg.Context.Traits
+	}
+	if len(traits) == 0 {
+		return nil
+	}
+	_, err := h.sessionRepo.MergeMetadata(ctx, session.SessionID, map[string]interface{}{"traits": traits}, nil, maxMetadataBytes)
+	if errors.Is(err, repository.ErrMetadataTooLarge) {
+		log.Printf("[Segment] Dropped traits of session %s: metadata would exceed %d bytes", session.SessionID, maxMetadataBytes)
+		return nil
+	}
+	return err
+}
+
+// authenticate resolves the write key, sent as the Basic auth username like
+// Segment's libraries do or in the body, to an active tracker key. On failure it
+// writes the response and returns a nil key.
+func (h *SegmentHandler) authenticate(c *fiber.Ctx, bodyWriteKey string) (*models.TrackerKey, error) {
+	writeKey := bodyWriteKey
+	if auth := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(auth, "Basic ") {
+		if decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "Basic ")); err == nil {
+			writeKey, _, _ = strings.Cut(string(decoded), ":")
+		}
+	}
+	if writeKey == "" {
+		return nil, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "Write key is required",
+			"details": "Send a tracker key's public key as the Basic auth username or the writeKey field",
+		})
+	}
+
+	key, err := h.keyRepo.GetActiveByPublicKey(c.UserContext(), writeKey)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unknown or revoked write key",
+		})
+	}
+	if err != nil {
+		return nil, repositoryError(c, err, "Unknown or revoked write key", "Failed to verify write key")
+	}
+
+	origin := c.Get(fiber.HeaderOrigin)
+	if !validation.NewDomainPolicy(key.AllowedOrigins, validation.DomainModeReject).Allows(origin) {
+		return nil, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "Origin not allowed for this write key",
+			"details": "Origin: " + origin,
+		})
+	}
+
+	return key, nil
+}
+
+// validateSegmentMessage returns why msg cannot be ingested, or "" when it can
+func validateSegmentMessage(msg models.SegmentMessage) string {
+	if msg.Type == models.SegmentTypeTrack {
+		if msg.Event == "" {
+			return "has no event name"
+		}
+		if len(msg.Event) > maxSegmentEventName {
+			return fmt.Sprintf("has an event name longer than %d characters", maxSegmentEventName)
+		}
+	}
+
+	if len(msg.MessageID) > maxSegmentMessageID {
+		return fmt.Sprintf("has a messageId longer than %d characters", maxSegmentMessageID)
+	}
+
+	identity := segmentIdentity(msg)
+	if identity == "" {
+		return "has neither anonymousId nor userId"
+	}
+	if len(identity) > maxSegmentIdentity {
+		return fmt.Sprintf("has an anonymousId or userId longer than %d characters", maxSegmentIdentity)
+	}
+	return ""
+}
+
+// segmentIdentity is the visitor a message belongs to: the anonymousId analytics.js
+// keeps per browser, or the userId of calls from server libraries
+func segmentIdentity(msg models.SegmentMessage) string {
+	if msg.AnonymousID != "" {
+		return "anon:" + msg.AnonymousID
+	}
+	if msg.UserID != "" {
+		return "user:" + msg.UserID
+	}
+	return ""
+}
+
+// segmentEvent maps a track, page or screen call onto an event. Track calls become
+// custom events named after the call; page and screen calls become navigations.
+func segmentEvent(msg models.SegmentMessage, fallbackURL string) models.EventData {
+	timestamp := time.Now()
+	if msg.Timestamp != nil && !msg.Timestamp.IsZero() {
+		timestamp = *msg.Timestamp
+	}
+	pageURL := segmentPageURLOf(msg, fallbackURL)
+	sdk := segmentSDK(msg)
+
+	event := models.EventData{
+		Timestamp: timestamp,
+		PageURL:   pageURL,
+		SDK:       &sdk,
+	}
+	if msg.Type == models.SegmentTypeTrack {
+		event.EventType = models.EventType(msg.Event)
+		event.EventData = msg.Properties
+		return event
+	}
+
+	event.EventType = models.EventTypeNavigation
+	data := map[string]interface{}{"to": pageURL, "segment_type": msg.Type}
+	if msg.Name != "" {
+		data["name"] = msg.Name
+	}
+	if msg.Category != "" {
+		data["category"] = msg.Category
+	}
+	if msg.Context.Page.Title != "" {
+		data["title"] = msg.Context.Page.Title
+	}
+	if len(msg.Properties) > 0 {
+		data["properties"] = msg.Properties
+	}
+	event.EventData = data
+	return event
+}
+
+// segmentPageURLOf returns the page a message was sent from, taken from its context
+// or, for page calls, its properties
+func segmentPageURLOf(msg models.SegmentMessage, fallback string) string {
+	if msg.Context.Page.URL != "" {
+		return msg.Context.Page.URL
+	}
+	if u, ok := msg.Properties["url"].(string); ok && u != "" {
+		return u
+	}
+	return fallback
+}
+
+// segmentSDK identifies the sending library as "<name>/<version>", like the
+// X-Tracker-SDK header of our own SDKs
+func segmentSDK(msg models.SegmentMessage) string {
+	lib := msg.Context.Library
+	if lib.Name == "" {
+		return "segment"
+	}
+	if lib.Version == "" {
+		return lib.Name
+	}
+	return lib.Name + "/" + lib.Version
+}
+
+// optionalString returns nil for an empty s
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -1,25 +1,77 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/export"
+	"github.com/ngocp/user-tracker/internal/middleware"
 	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/redact"
+	"github.com/ngocp/user-tracker/internal/replayformat"
 	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/visibility"
 )
 
+// Limits for PATCH /sessions/:id/metadata
+const (
+	maxMetadataKeysPerUpdate = 50
+	maxMetadataValueBytes    = 1024
+	maxMetadataBytes         = 16 * 1024
+)
+
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
 type SessionHandler struct {
-	sessionRepo *repository.SessionRepository
-	eventRepo   *repository.EventRepository
+	sessionRepo  *repository.SessionRepository
+	eventRepo    *repository.EventRepository
+	markerRepo   *repository.MarkerRepository
+	resumeWindow time.Duration
+	// estimateAbove is the count from which list totals are estimated; 0 counts exactly
+	estimateAbove int64
 }
 
-func NewSessionHandler(sessionRepo *repository.SessionRepository, eventRepo *repository.EventRepository) *SessionHandler {
+// NewSessionHandler creates the handler. Session and event totals at or above
+// estimateAbove are estimated from planner statistics unless the request asks for
+// ?exact=true; 0 always counts exactly.
+func NewSessionHandler(sessionRepo *repository.SessionRepository, eventRepo *repository.EventRepository, markerRepo *repository.MarkerRepository, resumeWindow time.Duration, estimateAbove int64) *SessionHandler {
 	return &SessionHandler{
-		sessionRepo: sessionRepo,
-		eventRepo:   eventRepo,
+		sessionRepo:   sessionRepo,
+		eventRepo:     eventRepo,
+		markerRepo:    markerRepo,
+		resumeWindow:  resumeWindow,
+		estimateAbove: estimateAbove,
+	}
+}
+
+// countThreshold returns the estimate threshold for this request; ?exact=true
+// disables estimation
+func (h *SessionHandler) countThreshold(c *fiber.Ctx) int64 {
+	if c.QueryBool("exact", false) {
+		return 0
 	}
+	return h.estimateAbove
+}
+
+// applySessionConsent records the request's consent on the new session. It reports
+// true when the consent does not allow tracking, in which case no session is created.
+func applySessionConsent(c *fiber.Ctx, req *models.CreateSessionRequest) bool {
+	policy, raw := middleware.ConsentFromContext(c)
+	if raw == "" {
+		return false
+	}
+	state := policy.State()
+	req.ConsentString = &raw
+	req.ConsentState = &state
+	return !policy.Events
 }
 
 func (h *SessionHandler) CreateSession(c *fiber.Ctx) error {
@@ -36,7 +88,18 @@ func (h *SessionHandler) CreateSession(c *fiber.Ctx) error {
 		})
 	}
 
-	session, err := h.sessionRepo.Create(c.Context(), &req)
+	if sdk := middleware.SDKFromContext(c); sdk != "" {
+		req.SDK = &sdk
+	}
+	req.Sandbox = middleware.SandboxFromContext(c)
+
+	if denied := applySessionConsent(c, &req); denied {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Tracking not permitted by consent",
+		})
+	}
+
+	session, err := h.sessionRepo.Create(c.UserContext(), &req)
 	if err != nil {
 		log.Printf("Failed to create session: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -47,22 +110,77 @@ func (h *SessionHandler) CreateSession(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusCreated).JSON(session)
 }
 
-func (h *SessionHandler) GetSession(c *fiber.Ctx) error {
-	sessionID, err := uuid.Parse(c.Params("id"))
-	if err != nil {
+// ResumeSession returns the fingerprint's open session if it was active within the
+// resume window, otherwise it creates a new session
+func (h *SessionHandler) ResumeSession(c *fiber.Ctx) error {
+	var req models.CreateSessionRequest
+	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid session ID",
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.PageURL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "page_url is required",
+		})
+	}
+
+	if sdk := middleware.SDKFromContext(c); sdk != "" {
+		req.SDK = &sdk
+	}
+	req.Sandbox = middleware.SandboxFromContext(c)
+
+	if denied := applySessionConsent(c, &req); denied {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Tracking not permitted by consent",
 		})
 	}
 
-	session, err := h.sessionRepo.GetByID(c.Context(), sessionID)
+	if req.Fingerprint == nil || *req.Fingerprint == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "fingerprint is required",
+		})
+	}
+
+	session, err := h.sessionRepo.FindResumable(c.UserContext(), *req.Fingerprint, h.resumeWindow, req.Sandbox)
 	if err != nil {
-		log.Printf("Failed to get session: %v", err)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Session not found",
+		log.Printf("Failed to find resumable session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to resume session",
+		})
+	}
+
+	if session != nil {
+		return c.JSON(fiber.Map{
+			"session": session,
+			"resumed": true,
+		})
+	}
+
+	session, err = h.sessionRepo.Create(c.UserContext(), &req)
+	if err != nil {
+		log.Printf("Failed to create session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create session",
 		})
 	}
 
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"session": session,
+		"resumed": false,
+	})
+}
+
+func (h *SessionHandler) GetSession(c *fiber.Ctx) error {
+	sessionID := middleware.ParamUUID(c, "id")
+
+	session, err := h.sessionRepo.GetByID(c.UserContext(), sessionID)
+	if err != nil {
+		return repositoryError(c, err, "Session not found", "Failed to get session")
+	}
+
+	visibility.Session(middleware.RoleFromContext(c), session)
 	return c.JSON(session)
 }
 
@@ -74,7 +192,7 @@ func (h *SessionHandler) ListSessions(c *fiber.Ctx) error {
 		limit = 100
 	}
 
-	sessions, err := h.sessionRepo.List(c.Context(), limit, offset)
+	sessions, err := h.sessionRepo.List(c.UserContext(), limit, offset)
 	if err != nil {
 		log.Printf("Failed to list sessions: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -82,27 +200,48 @@ func (h *SessionHandler) ListSessions(c *fiber.Ctx) error {
 		})
 	}
 
-	total, err := h.sessionRepo.Count(c.Context())
+	total, estimated, err := h.sessionRepo.Count(c.UserContext(), h.countThreshold(c))
 	if err != nil {
 		log.Printf("Failed to count sessions: %v", err)
 		total = 0
 	}
 
+	// Compact mode drops metadata and device details for infinite-scroll lists
+	if c.Query("mode") == "compact" {
+		compact := make([]models.CompactSession, len(sessions))
+		for i, s := range sessions {
+			compact[i] = models.CompactSession{
+				SessionID:       s.SessionID,
+				StartedAt:       s.StartedAt,
+				DurationSeconds: s.DurationSeconds,
+				PagesVisited:    s.PagesVisited,
+				ClickCount:      s.ClickCount,
+				InputCount:      s.InputCount,
+				ScreenshotCount: s.ScreenshotCount,
+			}
+		}
+		return c.JSON(fiber.Map{
+			"data":            compact,
+			"total":           total,
+			"total_estimated": estimated,
+			"limit":           limit,
+			"offset":          offset,
+			"mode":            "compact",
+		})
+	}
+
+	visibility.SessionSummaries(middleware.RoleFromContext(c), sessions)
 	return c.JSON(fiber.Map{
-		"data":  sessions,
-		"total": total,
-		"limit": limit,
-		"offset": offset,
+		"data":            sessions,
+		"total":           total,
+		"total_estimated": estimated,
+		"limit":           limit,
+		"offset":          offset,
 	})
 }
 
 func (h *SessionHandler) GetSessionEvents(c *fiber.Ctx) error {
-	sessionID, err := uuid.Parse(c.Params("id"))
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid session ID",
-		})
-	}
+	sessionID := middleware.ParamUUID(c, "id")
 
 	limitStr := c.Query("limit", "1000")
 	limit, err := strconv.Atoi(limitStr)
@@ -110,7 +249,42 @@ func (h *SessionHandler) GetSessionEvents(c *fiber.Ctx) error {
 		limit = 1000
 	}
 
-	events, err := h.eventRepo.GetBySessionID(c.Context(), sessionID, limit)
+	frame, ok := frameQuery(c)
+	if !ok {
+		return invalidFrame(c)
+	}
+
+	// ?fields= selects only the named columns, e.g. cursor positions for replay
+	var fields []string
+	if value := c.Query("fields"); value != "" {
+		fields, err = repository.ParseEventFields(value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   err.Error(),
+				"details": "Use a comma-separated list of: " + strings.Join(repository.EventFieldNames(), ", "),
+			})
+		}
+		if c.Query("group_by") == "tab" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "fields cannot be combined with group_by",
+			})
+		}
+	}
+
+	// Accept: application/x-tracker-replay selects the compact binary format
+	binary := strings.Contains(c.Get(fiber.HeaderAccept), replayformat.ContentType)
+	if binary && (fields != nil || c.Query("group_by") != "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The replay format cannot be combined with fields or group_by",
+		})
+	}
+
+	var events []*models.Event
+	if fields != nil {
+		events, err = h.eventRepo.GetBySessionIDFields(c.UserContext(), sessionID, frame, fields, limit)
+	} else {
+		events, err = h.eventRepo.GetBySessionID(c.UserContext(), sessionID, frame, limit)
+	}
 	if err != nil {
 		log.Printf("Failed to get events: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -118,35 +292,168 @@ func (h *SessionHandler) GetSessionEvents(c *fiber.Ctx) error {
 		})
 	}
 
-	total, err := h.eventRepo.CountBySessionID(c.Context(), sessionID)
+	visibility.Events(middleware.RoleFromContext(c), events)
+	if redactedView(c) {
+		redact.Events(events)
+	}
+
+	total, estimated, err := h.eventRepo.CountBySessionID(c.UserContext(), sessionID, frame, h.countThreshold(c))
 	if err != nil {
 		log.Printf("Failed to count events: %v", err)
 		total = 0
 	}
 
+	if binary {
+		var body bytes.Buffer
+		if err := replayformat.Encode(&body, sessionID, events); err != nil {
+			log.Printf("Failed to encode events: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get events",
+			})
+		}
+		c.Set(fiber.HeaderContentType, replayformat.ContentType)
+		c.Set(fiber.HeaderVary, fiber.HeaderAccept)
+		c.Set("X-Total-Count", strconv.FormatInt(total, 10))
+		c.Set("X-Total-Estimated", strconv.FormatBool(estimated))
+		return c.Send(body.Bytes())
+	}
+
+	// Attach deploy markers that fall within the session's timeline
+	var markers []*models.Marker
+	if session, err := h.sessionRepo.GetByID(c.UserContext(), sessionID); err == nil {
+		end := session.LastActivityAt
+		if session.EndedAt != nil {
+			end = *session.EndedAt
+		}
+		markers, err = h.markerRepo.ListBetween(c.UserContext(), "", session.StartedAt, end)
+		if err != nil {
+			log.Printf("Failed to list markers: %v", err)
+		}
+	}
+
+	if c.Query("group_by") == "tab" {
+		return c.JSON(fiber.Map{
+			"tabs":            models.GroupEventsByTab(events),
+			"total":           total,
+			"total_estimated": estimated,
+			"markers":         markers,
+		})
+	}
+
+	if fields != nil {
+		return c.JSON(fiber.Map{
+			"data":            repository.ProjectEvents(events, fields),
+			"fields":          fields,
+			"total":           total,
+			"total_estimated": estimated,
+			"markers":         markers,
+		})
+	}
+
 	return c.JSON(fiber.Map{
-		"data":  events,
-		"total": total,
+		"data":            events,
+		"total":           total,
+		"total_estimated": estimated,
+		"markers":         markers,
 	})
 }
 
 func (h *SessionHandler) EndSession(c *fiber.Ctx) error {
-	sessionID, err := uuid.Parse(c.Params("id"))
+	sessionID := middleware.ParamUUID(c, "id")
+
+	err := h.sessionRepo.UpdateEndTime(c.UserContext(), sessionID)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid session ID",
-		})
+		return repositoryError(c, err, "Session not found", "Failed to end session")
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Session ended successfully",
+	})
+}
+
+func (h *SessionHandler) ExportTestCase(c *fiber.Ctx) error {
+	sessionID := middleware.ParamUUID(c, "id")
+
+	session, err := h.sessionRepo.GetByID(c.UserContext(), sessionID)
+	if err != nil {
+		return repositoryError(c, err, "Session not found", "Failed to get session")
 	}
 
-	err = h.sessionRepo.UpdateEndTime(c.Context(), sessionID)
+	events, err := h.eventRepo.GetBySessionID(c.UserContext(), sessionID, "", 10000)
 	if err != nil {
-		log.Printf("Failed to end session: %v", err)
+		log.Printf("Failed to get events: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to end session",
+			"error": "Failed to get events",
 		})
 	}
 
+	visibility.Events(middleware.RoleFromContext(c), events)
+	script := export.PlaywrightScript(session, events)
+
+	c.Set("Content-Type", "application/javascript; charset=utf-8")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"session-%s.spec.ts\"", sessionID))
+	return c.SendString(script)
+}
+
+// UpdateMetadata merges the body's keys into the session's metadata, so SDKs can attach
+// properties discovered after the session started. A null value removes the key.
+func (h *SessionHandler) UpdateMetadata(c *fiber.Ctx) error {
+	sessionID := middleware.ParamUUID(c, "id")
+
+	var body map[string]interface{}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"details": "Expected a JSON object of metadata keys",
+		})
+	}
+	if len(body) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No metadata keys provided",
+		})
+	}
+	if len(body) > maxMetadataKeysPerUpdate {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Too many metadata keys",
+			"details": fmt.Sprintf("At most %d keys may be updated at once", maxMetadataKeysPerUpdate),
+		})
+	}
+
+	set := make(map[string]interface{}, len(body))
+	var remove []string
+	for key, value := range body {
+		if !metadataKeyPattern.MatchString(key) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid metadata key",
+				"details": fmt.Sprintf("Key %q must be 1-64 letters, digits, '_', '-' or '.'", key),
+			})
+		}
+		if value == nil {
+			remove = append(remove, key)
+			continue
+		}
+		if encoded, _ := json.Marshal(value); len(encoded) > maxMetadataValueBytes {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Metadata value too large",
+				"details": fmt.Sprintf("Value of %q exceeds %d bytes", key, maxMetadataValueBytes),
+			})
+		}
+		set[key] = value
+	}
+
+	metadata, err := h.sessionRepo.MergeMetadata(c.UserContext(), sessionID, set, remove, maxMetadataBytes)
+	if errors.Is(err, repository.ErrMetadataTooLarge) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error":   "Session metadata too large",
+			"details": fmt.Sprintf("Merged metadata may not exceed %d bytes", maxMetadataBytes),
+		})
+	}
+	if err != nil {
+		return repositoryError(c, err, "Session not found", "Failed to update session metadata")
+	}
+
 	return c.JSON(fiber.Map{
-		"message": "Session ended successfully",
+		"session_id": sessionID,
+		"metadata":   metadata,
 	})
 }
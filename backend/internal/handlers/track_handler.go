@@ -1,47 +1,160 @@
 package handlers
 
 import (
-	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
 	"log"
+	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/archive"
+	"github.com/ngocp/user-tracker/internal/assets"
+	"github.com/ngocp/user-tracker/internal/imagecheck"
+	"github.com/ngocp/user-tracker/internal/imagediff"
+	"github.com/ngocp/user-tracker/internal/liveness"
+	"github.com/ngocp/user-tracker/internal/logpolicy"
+	"github.com/ngocp/user-tracker/internal/malware"
+	"github.com/ngocp/user-tracker/internal/middleware"
 	"github.com/ngocp/user-tracker/internal/models"
 	"github.com/ngocp/user-tracker/internal/queue"
+	"github.com/ngocp/user-tracker/internal/redact"
 	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/sessioncheck"
+	"github.com/ngocp/user-tracker/internal/shaping"
+	"github.com/ngocp/user-tracker/internal/stats"
+	"github.com/ngocp/user-tracker/internal/storage"
+	"github.com/ngocp/user-tracker/internal/urlgroup"
+	"github.com/ngocp/user-tracker/internal/validation"
 )
 
+// Screenshot delivery modes for GetScreenshot
+const (
+	ScreenshotDeliveryProxy    = "proxy"
+	ScreenshotDeliveryRedirect = "redirect"
+	ScreenshotDeliveryJSON     = "json"
+)
+
+// tabIDPattern bounds the client-generated tab_id of events, and batchIDPattern the
+// batch_id of a /track request
+var (
+	tabIDPattern   = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	batchIDPattern = tabIDPattern
+)
+
+// Screenshot diff defaults; both can be overridden per request
+const (
+	defaultDiffThreshold = 1.0
+	defaultDiffTolerance = 16
+	maxScreenshotDiffs   = 500
+)
+
+// ScreenshotURLConfig controls whether screenshots in blob storage are served via
+// pre-signed URLs instead of being proxied through the API
+type ScreenshotURLConfig struct {
+	// Delivery is the default mode; clients may override it with ?delivery=
+	Delivery string
+	TTL      time.Duration
+}
+
+// TrackHandlerDeps holds what the track handler writes to and consults. Apart from
+// EventQueue every field is optional; a nil one disables what it is used for.
+type TrackHandlerDeps struct {
+	EventQueue queue.Queue
+	// Processor persists batches of up to SyncMaxEvents events sent with ?sync=true;
+	// 0 disables sync mode
+	Processor     *queue.EventProcessor
+	SyncMaxEvents int
+	// BlobStore is used to issue signed screenshot URLs when it supports them, as
+	// ScreenshotURLs configures
+	ScreenshotRepo *repository.ScreenshotRepository
+	BlobStore      storage.Store
+	ScreenshotURLs ScreenshotURLConfig
+	DomainPolicy   *validation.DomainPolicy
+	IngestStats    *stats.IngestCounters
+	Archiver       *archive.Archiver
+	// Drops enables degrade mode: batches that cannot be queued are dropped and
+	// counted instead of failing
+	Drops *stats.DropCounter
+	// BodyLog decides which request bodies are logged
+	BodyLog *logpolicy.Policy
+	// Shaper drops mousemove and scroll events beyond its rate ceiling as throttled
+	Shaper *shaping.Shaper
+	// URLRules normalizes page URLs
+	URLRules *urlgroup.Cache
+	// Rejections keeps rejected batches for the admin API
+	Rejections *stats.RejectionLog
+	// AssetCache is queued the assets a screenshot's page referenced
+	AssetCache *assets.Cache
+	// Liveness marks the session of an accepted batch live
+	Liveness *liveness.Tracker
+	// Deduper acknowledges batches whose batch_id it has seen without storing them
+	Deduper *queue.BatchDeduper
+	// SessionCheck refuses or flags batches for sessions it does not know
+	SessionCheck *sessioncheck.Checker
+}
+
 type TrackHandler struct {
-	eventQueue     *queue.EventQueue
+	eventQueue     queue.Queue
+	processor      *queue.EventProcessor
+	syncMaxEvents  int
 	screenshotRepo *repository.ScreenshotRepository
+	urlSigner      storage.URLSigner
+	urlConfig      ScreenshotURLConfig
+	domainPolicy   *validation.DomainPolicy
+	ingestStats    *stats.IngestCounters
+	archiver       *archive.Archiver
+	drops          *stats.DropCounter
+	bodyLog        *logpolicy.Policy
+	shaper         *shaping.Shaper
+	urlRules       *urlgroup.Cache
+	rejections     *stats.RejectionLog
+	assetCache     *assets.Cache
+	liveness       *liveness.Tracker
+	deduper        *queue.BatchDeduper
+	sessionCheck   *sessioncheck.Checker
 }
 
-func NewTrackHandler(eventQueue *queue.EventQueue, screenshotRepo *repository.ScreenshotRepository) *TrackHandler {
+func NewTrackHandler(deps TrackHandlerDeps) *TrackHandler {
+	signer, _ := deps.BlobStore.(storage.URLSigner)
 	return &TrackHandler{
-		eventQueue:     eventQueue,
-		screenshotRepo: screenshotRepo,
+		eventQueue:     deps.EventQueue,
+		processor:      deps.Processor,
+		syncMaxEvents:  deps.SyncMaxEvents,
+		screenshotRepo: deps.ScreenshotRepo,
+		urlSigner:      signer,
+		urlConfig:      deps.ScreenshotURLs,
+		domainPolicy:   deps.DomainPolicy,
+		ingestStats:    deps.IngestStats,
+		archiver:       deps.Archiver,
+		drops:          deps.Drops,
+		bodyLog:        deps.BodyLog,
+		shaper:         deps.Shaper,
+		urlRules:       deps.URLRules,
+		rejections:     deps.Rejections,
+		assetCache:     deps.AssetCache,
+		liveness:       deps.Liveness,
+		deduper:        deps.Deduper,
+		sessionCheck:   deps.SessionCheck,
 	}
 }
 
 func (h *TrackHandler) TrackEvents(c *fiber.Ctx) error {
-	// Log raw request body for debugging (read before parsing)
-	rawBody := string(c.Body())
-	if len(rawBody) > 0 {
-		bodyPreview := rawBody
-		if len(bodyPreview) > 500 {
-			bodyPreview = bodyPreview[:500] + "..."
-		}
-		log.Printf("[TrackEvents] Raw request body: %s", bodyPreview)
-	} else {
+	// Bodies carry what visitors typed, so they are only logged as the policy allows
+	if body, ok := h.bodyLog.Body(c.Body()); ok {
+		log.Printf("[TrackEvents] Request body (%s): %s", h.bodyLog.Mode(), body)
+	} else if len(c.Body()) == 0 {
 		log.Printf("[TrackEvents] Warning: Request body is empty")
 	}
 
 	var req models.TrackEventRequest
 	if err := c.BodyParser(&req); err != nil {
-		log.Printf("[TrackEvents] BodyParser error: %v", err)
-		log.Printf("[TrackEvents] Full raw body: %s", rawBody)
+		log.Printf("[TrackEvents] BodyParser error: %v (%d bytes)", err, len(c.Body()))
+		defer h.recordRejection(c, 0)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   "Invalid request body",
 			"details": err.Error(),
@@ -49,16 +162,31 @@ func (h *TrackHandler) TrackEvents(c *fiber.Ctx) error {
 	}
 
 	log.Printf("[TrackEvents] Parsed request - SessionID: %s, Events count: %d", req.SessionID, len(req.Events))
+
+	// Events of sandbox keys are counted, queued and persisted under their own project
+	if middleware.SandboxFromContext(c) {
+		c.SetUserContext(stats.NewProjectContext(c.UserContext(), stats.SandboxProject))
+	}
+	project := stats.ProjectFromContext(c.UserContext())
+
+	// Every parsed event is counted as received, and as rejected if validation fails
+	h.ingestStats.Add(c.UserContext(), project, stats.StageReceived, len(req.Events))
+	defer func() {
+		if status := c.Response().StatusCode(); status >= 400 && status < 500 {
+			h.ingestStats.Add(c.UserContext(), project, stats.StageRejected, len(req.Events))
+			h.recordRejection(c, len(req.Events))
+		}
+	}()
 	if len(req.Events) > 0 {
 		firstEvent := req.Events[0]
-		log.Printf("[TrackEvents] First event - Type: %s, PageURL: %s, Timestamp: %v (Zero: %v)", 
-			firstEvent.EventType, firstEvent.PageURL, firstEvent.Timestamp, firstEvent.Timestamp.IsZero())
-		
+		log.Printf("[TrackEvents] First event - Type: %s, PageURL: %s, Timestamp: %v (Zero: %v)",
+			firstEvent.EventType, redact.URL(firstEvent.PageURL), firstEvent.Timestamp, firstEvent.Timestamp.IsZero())
+
 		// Validate timestamp - check if it's zero (not parsed correctly)
 		if firstEvent.Timestamp.IsZero() {
 			log.Printf("[TrackEvents] Warning: First event has zero timestamp - may indicate parsing issue")
 		}
-		
+
 		// Validate required fields
 		if firstEvent.PageURL == "" {
 			log.Printf("[TrackEvents] Warning: First event has empty page_url")
@@ -76,6 +204,13 @@ func (h *TrackHandler) TrackEvents(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.BatchID != "" && !batchIDPattern.MatchString(req.BatchID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid batch ID",
+			"details": fmt.Sprintf("batch_id %q must be 1-64 letters, digits, '-' or '_'", req.BatchID),
+		})
+	}
+
 	if len(req.Events) == 0 {
 		log.Printf("[TrackEvents] Validation error: events array is empty")
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -107,6 +242,35 @@ func (h *TrackHandler) TrackEvents(c *fiber.Ctx) error {
 				"details": fmt.Sprintf("Event at index %d has empty page_url", i),
 			})
 		}
+		if event.TTL != nil && *event.TTL <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid event TTL",
+				"details": fmt.Sprintf("Event at index %d has ttl %d; it must be a positive number of seconds", i, *event.TTL),
+			})
+		}
+		if event.TabID != nil && !tabIDPattern.MatchString(*event.TabID) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid tab ID",
+				"details": fmt.Sprintf("Event at index %d has tab_id %q; use 1-64 letters, digits, '-' or '_'", i, *event.TabID),
+			})
+		}
+		if event.FramePath != nil && !models.ValidFramePath(*event.FramePath) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid frame path",
+				"details": fmt.Sprintf("Event at index %d has frame_path %q; expected a path from the top document such as main>iframe#checkout", i, *event.FramePath),
+			})
+		}
+	}
+
+	// Reject or flag events whose page_url is outside the registered domains
+	for i := range req.Events {
+		if !checkPageDomain(h.domainPolicy, &req.Events[i]) {
+			log.Printf("[TrackEvents] Rejected event[%d] from unregistered domain: %s", i, req.Events[i].PageURL)
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "Page URL not allowed",
+				"details": fmt.Sprintf("Event at index %d has page_url outside the registered domains", i),
+			})
+		}
 	}
 
 	sessionID, err := uuid.Parse(req.SessionID)
@@ -118,19 +282,198 @@ func (h *TrackHandler) TrackEvents(c *fiber.Ctx) error {
 		})
 	}
 
+	// Reject or flag events of sessions that were never created, e.g. a mistyped ID
+	if !h.sessionCheck.Known(c.UserContext(), sessionID) {
+		if h.sessionCheck.Rejects() {
+			log.Printf("[TrackEvents] Rejected %d events for unknown session %s", len(req.Events), sessionID)
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   "Session not found",
+				"details": fmt.Sprintf("Session %s does not exist; create it before sending events", sessionID),
+			})
+		}
+		log.Printf("[TrackEvents] Warning: %d events for unknown session %s", len(req.Events), sessionID)
+		for i := range req.Events {
+			if req.Events[i].EventData == nil {
+				req.Events[i].EventData = make(map[string]interface{})
+			}
+			req.Events[i].EventData["unknown_session"] = true
+		}
+	}
+
+	// Drop or strip events the visitor's consent does not cover
+	policy, _ := middleware.ConsentFromContext(c)
+	var dropped int
+	req.Events, dropped = policy.Apply(req.Events)
+	if dropped > 0 {
+		h.ingestStats.Add(c.UserContext(), project, stats.StageRejected, dropped)
+	}
+	if len(req.Events) == 0 {
+		log.Printf("[TrackEvents] Dropped %d events for session %s without tracking consent", dropped, sessionID)
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "Events dropped by consent",
+			"count":   0,
+			"dropped": dropped,
+		})
+	}
+
+	// Enforce the mousemove/scroll rate ceiling whatever throttle the SDK uses
+	var throttled int
+	req.Events, throttled = h.shaper.Apply(req.Events)
+	if throttled > 0 {
+		h.ingestStats.Add(c.UserContext(), project, stats.StageThrottled, throttled)
+	}
+
+	// Stamp every event with the SDK that sent the batch
+	if sdk := middleware.SDKFromContext(c); sdk != "" {
+		for i := range req.Events {
+			req.Events[i].SDK = &sdk
+		}
+	}
+
+	// Group page URLs with the rules of the token's tracker key, or the global rules
+	keyID, _ := middleware.TrackerKeyFromContext(c)
+	if err := h.urlRules.Stamp(c.UserContext(), keyID, req.Events); err != nil {
+		log.Printf("[TrackEvents] Failed to normalize page URLs for session %s: %v", sessionID, err)
+	}
+
+	// Sync requests are refused before the batch is claimed, so that the corrected
+	// retry of a refused batch is not taken for a duplicate
+	sync := c.QueryBool("sync", false)
+	if sync {
+		if h.syncMaxEvents <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Sync mode is disabled",
+				"details": "Send without ?sync=true to queue the events",
+			})
+		}
+		if len(req.Events) > h.syncMaxEvents {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error":   "Too many events for sync mode",
+				"details": fmt.Sprintf("Sync mode accepts at most %d events per request, got %d", h.syncMaxEvents, len(req.Events)),
+			})
+		}
+	}
+
+	// A batch sent again after a lost response is acknowledged without storing it twice
+	if !h.deduper.Claim(c.UserContext(), sessionID, req.BatchID) {
+		h.ingestStats.Add(c.UserContext(), project, stats.StageDuplicate, len(req.Events))
+		log.Printf("[TrackEvents] Ignored duplicate batch %s of session %s (request %s)", req.BatchID, sessionID, middleware.RequestIDFromContext(c))
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":   "Duplicate batch ignored",
+			"count":     0,
+			"batch_id":  req.BatchID,
+			"duplicate": true,
+		})
+	}
+
+	if sync {
+		return h.trackSync(c, sessionID, req.BatchID, req.Events)
+	}
+
 	// Enqueue events to Redis for async processing
-	err = h.eventQueue.Enqueue(c.Context(), sessionID, req.Events)
+	err = h.eventQueue.Enqueue(c.UserContext(), sessionID, req.Events)
 	if err != nil {
-		log.Printf("[TrackEvents] Failed to queue events: %v", err)
+		log.Printf("[TrackEvents] Failed to queue events for session %s (request %s): %v", sessionID, middleware.RequestIDFromContext(c), err)
+		h.deduper.Release(c.UserContext(), sessionID, req.BatchID)
+		if h.drops != nil {
+			return h.dropEvents(c, stats.DropEnqueueFailed, len(req.Events))
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to queue events",
+			"error":      "Failed to queue events",
+			"request_id": middleware.RequestIDFromContext(c),
 		})
 	}
 
-	log.Printf("[TrackEvents] Successfully queued %d events for session %s", len(req.Events), sessionID)
+	h.ingestStats.Add(c.UserContext(), project, stats.StageEnqueued, len(req.Events))
+	h.archiver.Append(sessionID, req.Events)
+	h.liveness.Event(c.UserContext(), sessionID)
+	log.Printf("[TrackEvents] Successfully queued %d events for session %s (request %s)", len(req.Events), sessionID, middleware.RequestIDFromContext(c))
 	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
-		"message": "Events queued successfully",
-		"count":   len(req.Events),
+		"message":   "Events queued successfully",
+		"count":     len(req.Events),
+		"throttled": throttled,
+	})
+}
+
+// checkPageDomain reports whether policy lets event's page_url in. An event outside
+// the registered domains is refused when the policy rejects, and marked with
+// origin_mismatch when it only flags.
+func checkPageDomain(policy *validation.DomainPolicy, event *models.EventData) bool {
+	if policy.Allows(event.PageURL) {
+		return true
+	}
+	if policy.Rejects() {
+		return false
+	}
+	if event.EventData == nil {
+		event.EventData = make(map[string]interface{})
+	}
+	event.EventData["origin_mismatch"] = true
+	return true
+}
+
+// recordRejection keeps the 4xx response just sent in the rejection log of the
+// request's tracker key
+func (h *TrackHandler) recordRejection(c *fiber.Ctx, events int) {
+	if h.rejections == nil {
+		return
+	}
+
+	var body struct {
+		Error   string `json:"error"`
+		Details string `json:"details"`
+	}
+	_ = json.Unmarshal(c.Response().Body(), &body)
+	keyID, _ := middleware.TrackerKeyFromContext(c)
+	h.rejections.Record(c.UserContext(), keyID, stats.Rejection{
+		At:        time.Now().UTC(),
+		Status:    c.Response().StatusCode(),
+		Error:     body.Error,
+		Details:   body.Details,
+		Events:    events,
+		SDK:       middleware.SDKFromContext(c),
+		RequestID: middleware.RequestIDFromContext(c),
+	})
+}
+
+// DropRateLimited answers rate-limited /track requests in degrade mode: the batch is
+// counted as dropped and acknowledged so SDKs do not retry it during an incident
+func (h *TrackHandler) DropRateLimited(c *fiber.Ctx) error {
+	var batch struct {
+		Events []json.RawMessage `json:"events"`
+	}
+	_ = json.Unmarshal(c.Body(), &batch)
+	return h.dropEvents(c, stats.DropRateLimited, len(batch.Events))
+}
+
+// dropEvents counts n dropped events and acknowledges the request with 202
+func (h *TrackHandler) dropEvents(c *fiber.Ctx, reason string, n int) error {
+	h.drops.Record(stats.ProjectFromContext(c.UserContext()), reason, n)
+	log.Printf("[TrackEvents] Degrade mode: dropped %d events (%s, request %s)", n, reason, middleware.RequestIDFromContext(c))
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Events dropped",
+		"count":   0,
+		"dropped": n,
+		"reason":  reason,
+	})
+}
+
+// trackSync persists a small batch before responding and returns the assigned event
+// IDs, for tests and low-volume server-side senders
+func (h *TrackHandler) trackSync(c *fiber.Ctx, sessionID uuid.UUID, batchID string, events []models.EventData) error {
+	eventIDs, err := h.processor.Persist(c.UserContext(), sessionID, events)
+	if err != nil {
+		h.deduper.Release(c.UserContext(), sessionID, batchID)
+		return repositoryError(c, err, "Session not found", "Failed to store events")
+	}
+
+	h.archiver.Append(sessionID, events)
+	h.liveness.Event(c.UserContext(), sessionID)
+	log.Printf("[TrackEvents] Stored %d events synchronously for session %s (request %s)", len(events), sessionID, middleware.RequestIDFromContext(c))
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":   "Events stored successfully",
+		"count":     len(events),
+		"event_ids": eventIDs,
 	})
 }
 
@@ -148,14 +491,55 @@ func (h *TrackHandler) UploadScreenshot(c *fiber.Ctx) error {
 		})
 	}
 
-	screenshot, err := h.screenshotRepo.Create(c.Context(), &req)
+	if policy, _ := middleware.ConsentFromContext(c); !policy.Screenshots {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Screenshots not permitted by consent",
+		})
+	}
+
+	if !h.domainPolicy.Allows(req.PageURL) {
+		if h.domainPolicy.Rejects() {
+			log.Printf("Rejected screenshot from unregistered domain: %s", req.PageURL)
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Page URL not allowed",
+			})
+		}
+		log.Printf("Warning: screenshot for session %s has page_url outside the registered domains: %s", req.SessionID, req.PageURL)
+	}
+
+	screenshot, err := h.screenshotRepo.Create(c.UserContext(), &req)
 	if err != nil {
+		if errors.Is(err, imagecheck.ErrInvalidImage) {
+			log.Printf("Rejected screenshot upload: %v", err)
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error":   "Invalid image",
+				"details": err.Error(),
+			})
+		}
+		if errors.Is(err, malware.ErrInfected) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error": "Upload rejected by malware scan",
+			})
+		}
+		if errors.Is(err, malware.ErrScanFailed) {
+			log.Printf("Rejected screenshot upload: %v", err)
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "Malware scan unavailable, try again later",
+			})
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Session not found",
+			})
+		}
 		log.Printf("Failed to save screenshot: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to save screenshot",
 		})
 	}
 
+	h.assetCache.Enqueue(stats.ProjectFromContext(c.UserContext()), req.PageURL, req.Assets)
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message":       "Screenshot uploaded successfully",
 		"screenshot_id": screenshot.ScreenshotID,
@@ -171,12 +555,49 @@ func (h *TrackHandler) GetScreenshot(c *fiber.Ctx) error {
 		})
 	}
 
-	screenshot, err := h.screenshotRepo.GetByID(c.Context(), id)
+	// Session-scoped access tokens only reach that session's screenshots
+	if scoped, ok := middleware.SessionScopeFromContext(c); ok {
+		meta, err := h.screenshotRepo.GetMetadataByID(c.UserContext(), id)
+		if err != nil {
+			return repositoryError(c, err, "Screenshot not found", "Failed to get screenshot")
+		}
+		if meta.SessionID != scoped {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Access token does not grant access to this session",
+			})
+		}
+	}
+
+	// Signed URLs bypass the API, so redacted previews are always proxied
+	redacted := redactedView(c)
+	delivery := c.Query("delivery", h.urlConfig.Delivery)
+	if h.urlSigner != nil && !redacted && (delivery == ScreenshotDeliveryRedirect || delivery == ScreenshotDeliveryJSON) {
+		meta, err := h.screenshotRepo.GetMetadataByID(c.UserContext(), id)
+		if err != nil {
+			return repositoryError(c, err, "Screenshot not found", "Failed to get screenshot")
+		}
+
+		// Legacy rows still in the database fall through to proxying
+		if meta.StorageKey != nil {
+			return h.sendSignedURL(c, meta, delivery)
+		}
+	}
+
+	screenshot, err := h.screenshotRepo.GetByID(c.UserContext(), id)
 	if err != nil {
-		log.Printf("Failed to get screenshot: %v", err)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Screenshot not found",
-		})
+		return repositoryError(c, err, "Screenshot not found", "Failed to get screenshot")
+	}
+
+	if redacted {
+		data, err := redact.Screenshot(screenshot.ImageData)
+		if err != nil {
+			log.Printf("Failed to redact screenshot %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to redact screenshot",
+			})
+		}
+		c.Set("Content-Type", "image/png")
+		return c.Send(data)
 	}
 
 	// Return image data as base64 or raw bytes
@@ -184,18 +605,166 @@ func (h *TrackHandler) GetScreenshot(c *fiber.Ctx) error {
 	return c.Send(screenshot.ImageData)
 }
 
-func (h *TrackHandler) GetSessionScreenshots(c *fiber.Ctx) error {
-	sessionID, err := uuid.Parse(c.Params("id"))
+// GetScreenshotAt returns the screenshot nearest to replay timestamp t so the player can
+// fetch a single frame instead of the whole set
+func (h *TrackHandler) GetScreenshotAt(c *fiber.Ctx) error {
+	sessionID := middleware.ParamUUID(c, "id")
+
+	at, err := time.Parse(time.RFC3339Nano, c.Query("t"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid session ID",
+			"error": "t is required and must be an RFC3339 timestamp",
 		})
 	}
 
 	includeData := c.QueryBool("include_data", false)
 
+	screenshot, err := h.screenshotRepo.GetNearest(c.UserContext(), sessionID, at, c.Query("page_url"), includeData)
+	if err != nil {
+		return repositoryError(c, err, "Screenshot not found", "Failed to get nearest screenshot")
+	}
+
+	response := models.ScreenshotResponse{
+		ScreenshotID: screenshot.ScreenshotID,
+		SessionID:    screenshot.SessionID,
+		PageURL:      screenshot.PageURL,
+		Timestamp:    screenshot.Timestamp,
+		ImageFormat:  screenshot.ImageFormat,
+		ImageWidth:   screenshot.ImageWidth,
+		ImageHeight:  screenshot.ImageHeight,
+		FileSize:     screenshot.FileSize,
+	}
+	redacted := redactedView(c)
+	if redacted {
+		response.PageURL = redact.URL(response.PageURL)
+	}
 	if includeData {
-		screenshots, err := h.screenshotRepo.GetBySessionIDWithData(c.Context(), sessionID)
+		response.DataURL, err = screenshotDataURL(screenshot, redacted)
+		if err != nil {
+			log.Printf("Failed to encode screenshot %d: %v", screenshot.ScreenshotID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to encode screenshot",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"data":      response,
+		"offset_ms": screenshot.Timestamp.Sub(at).Milliseconds(),
+	})
+}
+
+// GetScreenshotDiffs compares each screenshot of a session with the previous one and
+// reports the share of changed pixels. Pairs above threshold (percent) are marked
+// changed; tolerance (0-255) ignores small per-channel differences such as JPEG noise.
+// Images are decoded one at a time so only two are held in memory.
+func (h *TrackHandler) GetScreenshotDiffs(c *fiber.Ctx) error {
+	sessionID := middleware.ParamUUID(c, "id")
+
+	threshold := c.QueryFloat("threshold", defaultDiffThreshold)
+	tolerance := c.QueryInt("tolerance", defaultDiffTolerance)
+	if threshold < 0 || threshold > 100 || tolerance < 0 || tolerance > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "threshold must be 0-100 and tolerance 0-255",
+		})
+	}
+	limit := c.QueryInt("limit", maxScreenshotDiffs)
+	if limit <= 0 || limit > maxScreenshotDiffs {
+		limit = maxScreenshotDiffs
+	}
+
+	screenshots, err := h.screenshotRepo.GetBySessionID(c.UserContext(), sessionID)
+	if err != nil {
+		log.Printf("Failed to get screenshots: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get screenshots",
+		})
+	}
+	if len(screenshots) > limit+1 {
+		screenshots = screenshots[:limit+1]
+	}
+
+	diffs := make([]models.ScreenshotDiff, 0, len(screenshots))
+	var prev image.Image
+	for i, meta := range screenshots {
+		var current image.Image
+		screenshot, err := h.screenshotRepo.GetByID(c.UserContext(), meta.ScreenshotID)
+		if err == nil {
+			current, err = imagediff.Decode(screenshot.ImageData)
+		}
+		if err != nil {
+			log.Printf("Failed to load screenshot %d for diff: %v", meta.ScreenshotID, err)
+		}
+
+		if i > 0 {
+			from := screenshots[i-1]
+			diff := models.ScreenshotDiff{
+				FromScreenshotID: from.ScreenshotID,
+				ToScreenshotID:   meta.ScreenshotID,
+				FromTimestamp:    from.Timestamp,
+				ToTimestamp:      meta.Timestamp,
+				PageURL:          meta.PageURL,
+				PageChanged:      from.PageURL != meta.PageURL,
+			}
+			if prev == nil || current == nil {
+				diff.Error = "screenshot could not be decoded"
+			} else {
+				result := imagediff.Compare(prev, current, uint8(tolerance))
+				diff.DiffPercent = result.Percent
+				diff.Changed = result.Percent > threshold
+				if result.Region != nil {
+					diff.Region = &models.ScreenshotRegion{
+						X:      result.Region.X,
+						Y:      result.Region.Y,
+						Width:  result.Region.Width,
+						Height: result.Region.Height,
+					}
+				}
+			}
+			diffs = append(diffs, diff)
+		}
+		prev = current
+	}
+
+	return c.JSON(fiber.Map{
+		"data":      diffs,
+		"threshold": threshold,
+		"tolerance": tolerance,
+	})
+}
+
+func (h *TrackHandler) sendSignedURL(c *fiber.Ctx, screenshot *models.Screenshot, delivery string) error {
+	url, err := h.urlSigner.SignedURL(c.UserContext(), *screenshot.StorageKey, h.urlConfig.TTL)
+	if err != nil {
+		log.Printf("Failed to sign screenshot URL: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create screenshot URL",
+		})
+	}
+
+	expiresAt := time.Now().Add(h.urlConfig.TTL)
+	log.Printf("[Audit] Issued signed URL for screenshot %d (session %s) to %s, expires %s",
+		screenshot.ScreenshotID, screenshot.SessionID, c.IP(), expiresAt.Format(time.RFC3339))
+
+	if delivery == ScreenshotDeliveryJSON {
+		return c.JSON(fiber.Map{
+			"url":        url,
+			"expires_at": expiresAt,
+		})
+	}
+
+	c.Set("Cache-Control", "no-store")
+	return c.Redirect(url, fiber.StatusFound)
+}
+
+func (h *TrackHandler) GetSessionScreenshots(c *fiber.Ctx) error {
+	sessionID := middleware.ParamUUID(c, "id")
+
+	includeData := c.QueryBool("include_data", false)
+	redacted := redactedView(c)
+
+	if includeData {
+		screenshots, err := h.screenshotRepo.GetBySessionIDWithData(c.UserContext(), sessionID)
 		if err != nil {
 			log.Printf("Failed to get screenshots: %v", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -206,6 +775,13 @@ func (h *TrackHandler) GetSessionScreenshots(c *fiber.Ctx) error {
 		// Convert to response format with data URLs
 		responses := make([]models.ScreenshotResponse, len(screenshots))
 		for i, ss := range screenshots {
+			dataURL, err := screenshotDataURL(ss, redacted)
+			if err != nil {
+				log.Printf("Failed to encode screenshot %d: %v", ss.ScreenshotID, err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to encode screenshot",
+				})
+			}
 			responses[i] = models.ScreenshotResponse{
 				ScreenshotID: ss.ScreenshotID,
 				SessionID:    ss.SessionID,
@@ -215,7 +791,10 @@ func (h *TrackHandler) GetSessionScreenshots(c *fiber.Ctx) error {
 				ImageWidth:   ss.ImageWidth,
 				ImageHeight:  ss.ImageHeight,
 				FileSize:     ss.FileSize,
-				DataURL:      fmt.Sprintf("data:image/%s;base64,%s", ss.ImageFormat, base64.StdEncoding.EncodeToString(ss.ImageData)),
+				DataURL:      dataURL,
+			}
+			if redacted {
+				responses[i].PageURL = redact.URL(responses[i].PageURL)
 			}
 		}
 
@@ -224,7 +803,7 @@ func (h *TrackHandler) GetSessionScreenshots(c *fiber.Ctx) error {
 		})
 	}
 
-	screenshots, err := h.screenshotRepo.GetBySessionID(c.Context(), sessionID)
+	screenshots, err := h.screenshotRepo.GetBySessionID(c.UserContext(), sessionID)
 	if err != nil {
 		log.Printf("Failed to get screenshots: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -232,6 +811,12 @@ func (h *TrackHandler) GetSessionScreenshots(c *fiber.Ctx) error {
 		})
 	}
 
+	if redacted {
+		for _, ss := range screenshots {
+			ss.PageURL = redact.URL(ss.PageURL)
+		}
+	}
+
 	return c.JSON(fiber.Map{
 		"data": screenshots,
 	})
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/queue"
+	"github.com/redis/go-redis/v9"
+)
+
+// recordingQueue counts the events enqueued on it
+type recordingQueue struct {
+	queue.Queue
+	enqueued int
+}
+
+func (q *recordingQueue) Enqueue(ctx context.Context, sessionID uuid.UUID, events []models.EventData) error {
+	q.enqueued += len(events)
+	return nil
+}
+
+func TestTrackRefusedSyncBatchCanBeRetried(t *testing.T) {
+	tests := []struct {
+		name          string
+		syncMaxEvents int
+		status        int
+	}{
+		{"sync mode disabled", 0, fiber.StatusBadRequest},
+		{"too many events for sync mode", 1, fiber.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+			eventQueue := &recordingQueue{}
+			h := &TrackHandler{
+				eventQueue:    eventQueue,
+				syncMaxEvents: tt.syncMaxEvents,
+				deduper:       queue.NewBatchDeduper(client, time.Hour),
+			}
+			app := fiber.New()
+			app.Post("/track", h.TrackEvents)
+
+			event := models.EventData{EventType: models.EventTypeClick, PageURL: "https://example.com/", Timestamp: time.Now()}
+			body, _ := json.Marshal(models.TrackEventRequest{
+				SessionID: uuid.NewString(),
+				BatchID:   "batch-1",
+				Events:    []models.EventData{event, event},
+			})
+			send := func(target string) int {
+				req := httptest.NewRequest("POST", target, strings.NewReader(string(body)))
+				req.Header.Set("Content-Type", "application/json")
+				resp, err := app.Test(req)
+				if err != nil {
+					t.Fatalf("request failed: %v", err)
+				}
+				return resp.StatusCode
+			}
+
+			if status := send("/track?sync=true"); status != tt.status {
+				t.Fatalf("sync request status = %d, want %d", status, tt.status)
+			}
+			if status := send("/track"); status != fiber.StatusAccepted {
+				t.Fatalf("retry status = %d, want %d", status, fiber.StatusAccepted)
+			}
+			if eventQueue.enqueued != 2 {
+				t.Errorf("retry enqueued %d events, want 2", eventQueue.enqueued)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/shaping"
+	"github.com/ngocp/user-tracker/internal/trackertoken"
+	"github.com/ngocp/user-tracker/internal/validation"
+)
+
+// maxThrottleMs bounds the per-key throttles
+const maxThrottleMs = 60000
+
+// maxMaskSelectors bounds the mask selectors baked into a key's tracker script
+const maxMaskSelectors = 100
+
+type TrackerKeyHandler struct {
+	keyRepo   *repository.TrackerKeyRepository
+	keyCache  *trackertoken.KeyCache
+	signer    *trackertoken.Signer
+	throttles shaping.Throttles
+	shaper    *shaping.Shaper
+}
+
+// NewTrackerKeyHandler creates the handler. throttles are advertised to SDKs whose key
+// sets none; no advertised throttle is below what shaper enforces.
+func NewTrackerKeyHandler(keyRepo *repository.TrackerKeyRepository, keyCache *trackertoken.KeyCache, signer *trackertoken.Signer, throttles shaping.Throttles, shaper *shaping.Shaper) *TrackerKeyHandler {
+	return &TrackerKeyHandler{
+		keyRepo:   keyRepo,
+		keyCache:  keyCache,
+		signer:    signer,
+		throttles: throttles,
+		shaper:    shaper,
+	}
+}
+
+// GetConfig returns the tracker settings for the key in ?public_key=, or the server
+// defaults without one
+func (h *TrackerKeyHandler) GetConfig(c *fiber.Ctx) error {
+	throttles := h.throttles
+	if publicKey := c.Query("public_key"); publicKey != "" {
+		key, err := h.keyRepo.GetActiveByPublicKey(c.UserContext(), publicKey)
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unknown or revoked public key",
+			})
+		}
+		if err != nil {
+			return repositoryError(c, err, "Unknown or revoked public key", "Failed to get tracker config")
+		}
+		if key.MouseMoveThrottleMs != nil {
+			throttles.MouseMove = time.Duration(*key.MouseMoveThrottleMs) * time.Millisecond
+		}
+		if key.ScrollThrottleMs != nil {
+			throttles.Scroll = time.Duration(*key.ScrollThrottleMs) * time.Millisecond
+		}
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(throttles.AtLeast(h.shaper.Min()).Millis())
+}
+
+// IssueToken exchanges a public key for a short-lived tracker token. The request
+// Origin must be one of the key's allowed origins, and the token is bound to it.
+func (h *TrackerKeyHandler) IssueToken(c *fiber.Ctx) error {
+	if h.signer == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Tracker tokens are disabled",
+		})
+	}
+
+	var req models.TrackerTokenRequest
+	if err := c.BodyParser(&req); err != nil || req.PublicKey == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"details": "public_key is required",
+		})
+	}
+
+	key, err := h.keyRepo.GetActiveByPublicKey(c.UserContext(), req.PublicKey)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unknown or revoked public key",
+		})
+	}
+	if err != nil {
+		return repositoryError(c, err, "Unknown or revoked public key", "Failed to issue tracker token")
+	}
+
+	origin := c.Get(fiber.HeaderOrigin)
+	if !validation.NewDomainPolicy(key.AllowedOrigins, validation.DomainModeReject).Allows(origin) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "Origin not allowed for this public key",
+			"details": "Origin: " + origin,
+		})
+	}
+
+	token, expiresAt, err := h.signer.Issue(key.KeyID, origin, time.Now())
+	if err != nil {
+		log.Printf("Failed to issue tracker token: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to issue tracker token",
+		})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(models.TrackerTokenResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		ExpiresIn: int64(h.signer.TTL().Seconds()),
+	})
+}
+
+// CreateKey registers a tracker key and returns its generated public key
+func (h *TrackerKeyHandler) CreateKey(c *fiber.Ctx) error {
+	var req models.CreateTrackerKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid name",
+			"details": "name must be 1-255 characters",
+		})
+	}
+	origins := []string{}
+	for _, origin := range req.AllowedOrigins {
+		if origin = strings.ToLower(strings.TrimSpace(origin)); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	req.AllowedOrigins = origins
+	if err := validateThrottles(&req.TrackerKeyThrottles); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid throttle",
+			"details": err.Error(),
+		})
+	}
+
+	key, err := h.keyRepo.Create(c.UserContext(), &req)
+	if err != nil {
+		log.Printf("Failed to create tracker key: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create tracker key",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(key)
+}
+
+// ListKeys lists all tracker keys, revoked ones included
+func (h *TrackerKeyHandler) ListKeys(c *fiber.Ctx) error {
+	keys, err := h.keyRepo.List(c.UserContext())
+	if err != nil {
+		log.Printf("Failed to list tracker keys: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list tracker keys",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": keys,
+	})
+}
+
+// RotateKey replaces the key's public key; tokens issued under the old one stop
+// working, so update the snippet before or right after rotating
+func (h *TrackerKeyHandler) RotateKey(c *fiber.Ctx) error {
+	keyID := middleware.ParamUUID(c, "id")
+
+	key, err := h.keyRepo.Rotate(c.UserContext(), keyID)
+	if err != nil {
+		return repositoryError(c, err, "Tracker key not found or revoked", "Failed to rotate tracker key")
+	}
+	h.keyCache.Forget(keyID)
+
+	return c.JSON(key)
+}
+
+// SetThrottles replaces the mousemove and scroll throttles advertised to the key's SDKs
+func (h *TrackerKeyHandler) SetThrottles(c *fiber.Ctx) error {
+	keyID := middleware.ParamUUID(c, "id")
+
+	var req models.TrackerKeyThrottles
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if err := validateThrottles(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid throttle",
+			"details": err.Error(),
+		})
+	}
+
+	key, err := h.keyRepo.SetThrottles(c.UserContext(), keyID, &req)
+	if err != nil {
+		return repositoryError(c, err, "Tracker key not found or revoked", "Failed to update tracker key")
+	}
+
+	return c.JSON(key)
+}
+
+// SetRecording replaces the sample rate and mask selectors baked into the key's served
+// tracker script. Cached copies of the script keep the old settings until they expire;
+// versioned script URLs change with the settings.
+func (h *TrackerKeyHandler) SetRecording(c *fiber.Ctx) error {
+	keyID := middleware.ParamUUID(c, "id")
+
+	var req models.TrackerKeyRecording
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.SampleRate < 0 || req.SampleRate > 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid sample_rate",
+			"details": "sample_rate must be between 0 and 1",
+		})
+	}
+	selectors := []string{}
+	for _, selector := range req.MaskSelectors {
+		if selector = strings.TrimSpace(selector); selector != "" {
+			selectors = append(selectors, selector)
+		}
+	}
+	if len(selectors) > maxMaskSelectors {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Too many mask_selectors",
+			"details": fmt.Sprintf("at most %d selectors are allowed", maxMaskSelectors),
+		})
+	}
+	req.MaskSelectors = selectors
+
+	key, err := h.keyRepo.SetRecording(c.UserContext(), keyID, &req)
+	if err != nil {
+		return repositoryError(c, err, "Tracker key not found or revoked", "Failed to update tracker key")
+	}
+
+	return c.JSON(key)
+}
+
+// SetSandbox marks the key as a sandbox key or not: {"sandbox": true}. Sessions created
+// with its tokens from then on (within the key cache TTL on other instances) follow.
+func (h *TrackerKeyHandler) SetSandbox(c *fiber.Ctx) error {
+	keyID := middleware.ParamUUID(c, "id")
+
+	var req struct {
+		Sandbox *bool `json:"sandbox"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Sandbox == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"details": "sandbox is required",
+		})
+	}
+
+	key, err := h.keyRepo.SetSandbox(c.UserContext(), keyID, *req.Sandbox)
+	if err != nil {
+		return repositoryError(c, err, "Tracker key not found or revoked", "Failed to update tracker key")
+	}
+	h.keyCache.Forget(keyID)
+
+	return c.JSON(key)
+}
+
+func validateThrottles(t *models.TrackerKeyThrottles) error {
+	for name, ms := range map[string]*int{"mousemove_throttle_ms": t.MouseMoveThrottleMs, "scroll_throttle_ms": t.ScrollThrottleMs} {
+		if ms != nil && (*ms < 0 || *ms > maxThrottleMs) {
+			return fmt.Errorf("%s must be between 0 and %d", name, maxThrottleMs)
+		}
+	}
+	return nil
+}
+
+// RevokeKey disables a key and every token issued under it
+func (h *TrackerKeyHandler) RevokeKey(c *fiber.Ctx) error {
+	keyID := middleware.ParamUUID(c, "id")
+
+	if err := h.keyRepo.Revoke(c.UserContext(), keyID); err != nil {
+		return repositoryError(c, err, "Tracker key not found or already revoked", "Failed to revoke tracker key")
+	}
+	h.keyCache.Forget(keyID)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
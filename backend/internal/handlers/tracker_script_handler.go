@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// Cache lifetimes of served tracker scripts. A versioned URL always serves the same
+// script, so it is cached for good; the plain URL is re-checked every few minutes.
+const (
+	scriptCacheControl          = "public, max-age=300"
+	versionedScriptCacheControl = "public, max-age=31536000, immutable"
+)
+
+// TrackerScriptHandler serves the tracker SDK bundle with a tracker key's settings
+// baked in, so self-hosters embed one script tag instead of publishing the SDK to a CDN
+type TrackerScriptHandler struct {
+	keyRepo *repository.TrackerKeyRepository
+	bundle  []byte
+	apiURL  string
+}
+
+// trackerScriptConfig is the configuration passed to UserTracker.init
+type trackerScriptConfig struct {
+	APIURL        string   `json:"apiUrl"`
+	PublicKey     string   `json:"publicKey"`
+	SampleRate    float64  `json:"sampleRate"`
+	MaskSelectors []string `json:"maskSelectors"`
+}
+
+// NewTrackerScriptHandler loads the built SDK bundle from bundlePath; without it the
+// script routes answer 404. apiURL is the API base baked into scripts; empty uses the
+// /api/v1 base of the host the script was requested from.
+func NewTrackerScriptHandler(keyRepo *repository.TrackerKeyRepository, bundlePath, apiURL string) *TrackerScriptHandler {
+	bundle, err := os.ReadFile(bundlePath)
+	if err != nil {
+		log.Printf("[TrackerScript] Tracker bundle not loaded, scripts are not served: %v", err)
+		bundle = nil
+	}
+	return &TrackerScriptHandler{
+		keyRepo: keyRepo,
+		bundle:  bundle,
+		apiURL:  apiURL,
+	}
+}
+
+// render returns the key's script and its version, a hash of the bundle and settings
+func (h *TrackerScriptHandler) render(c *fiber.Ctx, key *models.TrackerKey) ([]byte, string, error) {
+	apiURL := h.apiURL
+	if apiURL == "" {
+		apiURL = c.BaseURL() + "/api/v1"
+	}
+	config, err := json.Marshal(trackerScriptConfig{
+		APIURL:        apiURL,
+		PublicKey:     key.PublicKey,
+		SampleRate:    key.SampleRate,
+		MaskSelectors: key.MaskSelectors,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Options the page sets on window.UserTrackerOptions (e.g. userId) override the
+	// baked-in ones
+	script := make([]byte, 0, len(h.bundle)+len(config)+200)
+	script = append(script, h.bundle...)
+	script = append(script, "\n;(function(){var c="...)
+	script = append(script, config...)
+	script = append(script, ",o=window.UserTrackerOptions||{};for(var k in o)c[k]=o[k];window.UserTracker&&window.UserTracker.init(c);})();\n"...)
+
+	sum := sha256.Sum256(script)
+	return script, hex.EncodeToString(sum[:8]), nil
+}
+
+func (h *TrackerScriptHandler) scriptURL(c *fiber.Ctx, key *models.TrackerKey) string {
+	return c.BaseURL() + "/t/" + key.PublicKey + "/tracker.js"
+}
+
+// GetScript serves the tracker script of the key whose public key is :project_key.
+// With ?v= matching the current version it is cached for a year; a stale version is
+// answered with the current script, uncached.
+func (h *TrackerScriptHandler) GetScript(c *fiber.Ctx) error {
+	if h.bundle == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Tracker script is not available",
+		})
+	}
+
+	key, err := h.keyRepo.GetActiveByPublicKey(c.UserContext(), c.Params("project_key"))
+	if err != nil {
+		return repositoryError(c, err, "Unknown or revoked project key", "Failed to get tracker script")
+	}
+
+	script, version, err := h.render(c, key)
+	if err != nil {
+		log.Printf("Failed to render tracker script: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get tracker script",
+		})
+	}
+
+	etag := `"` + version + `"`
+	switch v := c.Query("v"); {
+	case v == version:
+		c.Set(fiber.HeaderCacheControl, versionedScriptCacheControl)
+	case v != "":
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	default:
+		c.Set(fiber.HeaderCacheControl, scriptCacheControl)
+	}
+	c.Set(fiber.HeaderETag, etag)
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/javascript; charset=utf-8")
+	return c.Send(script)
+}
+
+// GetScriptURL returns the key's script URL, its current versioned URL and a script
+// tag to embed. The version changes with the SDK bundle and the key's settings.
+func (h *TrackerScriptHandler) GetScriptURL(c *fiber.Ctx) error {
+	if h.bundle == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Tracker script is not available",
+		})
+	}
+
+	key, err := h.keyRepo.GetByID(c.UserContext(), middleware.ParamUUID(c, "id"))
+	if err == nil && key.RevokedAt != nil {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		return repositoryError(c, err, "Tracker key not found or revoked", "Failed to get tracker script")
+	}
+
+	_, version, err := h.render(c, key)
+	if err != nil {
+		log.Printf("Failed to render tracker script: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get tracker script",
+		})
+	}
+
+	url := h.scriptURL(c, key)
+	versioned := url + "?v=" + version
+	return c.JSON(fiber.Map{
+		"url":           url,
+		"versioned_url": versioned,
+		"version":       version,
+		"snippet":       `<script async src="` + versioned + `"></script>`,
+	})
+}
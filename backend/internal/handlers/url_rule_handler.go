@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/urlgroup"
+)
+
+type URLRuleHandler struct {
+	ruleRepo *repository.URLRuleRepository
+	cache    *urlgroup.Cache
+}
+
+func NewURLRuleHandler(ruleRepo *repository.URLRuleRepository, cache *urlgroup.Cache) *URLRuleHandler {
+	return &URLRuleHandler{
+		ruleRepo: ruleRepo,
+		cache:    cache,
+	}
+}
+
+// CreateRule adds a URL grouping rule. It applies to events ingested from now on,
+// within the rule cache TTL on other instances.
+func (h *URLRuleHandler) CreateRule(c *fiber.Ctx) error {
+	var req models.CreateURLRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	params := []string{}
+	for _, param := range req.StripParams {
+		if param = strings.TrimSpace(param); param != "" {
+			params = append(params, param)
+		}
+	}
+	req.StripParams = params
+	if req.Pattern != nil && *req.Pattern == "" {
+		req.Pattern = nil
+	}
+	if req.Pattern == nil && len(req.StripParams) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid rule",
+			"details": "Set pattern, strip_params or both",
+		})
+	}
+	if req.Pattern != nil {
+		if _, err := regexp.Compile(*req.Pattern); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid pattern",
+				"details": err.Error(),
+			})
+		}
+	}
+
+	rule, err := h.ruleRepo.Create(c.UserContext(), &req)
+	if err != nil {
+		return repositoryError(c, err, "Tracker key not found", "Failed to create url rule")
+	}
+	h.cache.Forget()
+
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// ListRules lists all rules in the order they are applied
+func (h *URLRuleHandler) ListRules(c *fiber.Ctx) error {
+	rules, err := h.ruleRepo.List(c.UserContext())
+	if err != nil {
+		log.Printf("Failed to list url rules: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list url rules",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": rules,
+	})
+}
+
+// PreviewRules normalizes ?url= with the current rules of ?key_id= (global rules
+// without one), so rules can be checked before events are ingested with them
+func (h *URLRuleHandler) PreviewRules(c *fiber.Ctx) error {
+	pageURL := c.Query("url")
+	if pageURL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "url is required",
+		})
+	}
+	keyID := uuid.Nil
+	if raw := c.Query("key_id"); raw != "" {
+		var err error
+		if keyID, err = uuid.Parse(raw); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid key_id",
+			})
+		}
+	}
+
+	stored, err := h.ruleRepo.ListFor(c.UserContext(), keyID)
+	if err != nil {
+		log.Printf("Failed to list url rules: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list url rules",
+		})
+	}
+	rules, err := urlgroup.Compile(stored)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to compile url rules",
+			"details": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"url":            pageURL,
+		"normalized_url": rules.Normalize(pageURL),
+		"rules":          len(stored),
+	})
+}
+
+// DeleteRule removes a rule; events already ingested keep their normalized URL
+func (h *URLRuleHandler) DeleteRule(c *fiber.Ctx) error {
+	ruleID := middleware.ParamUUID(c, "id")
+
+	if err := h.ruleRepo.Delete(c.UserContext(), ruleID); err != nil {
+		return repositoryError(c, err, "URL rule not found", "Failed to delete url rule")
+	}
+	h.cache.Forget()
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,204 @@
+package v2
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// DTOs in this file define the v2 response shapes. They are mapped from the shared
+// models so storage changes do not leak into the public contract, and v1 responses
+// (which serialize the models directly) stay frozen.
+
+type Dimensions struct {
+	Width  *int `json:"width,omitempty"`
+	Height *int `json:"height,omitempty"`
+}
+
+type Device struct {
+	Type     *string    `json:"type,omitempty"`
+	Browser  *string    `json:"browser,omitempty"`
+	OS       *string    `json:"os,omitempty"`
+	Screen   Dimensions `json:"screen"`
+	Viewport Dimensions `json:"viewport"`
+	// ViewportHistory lists viewport changes after Viewport, in time order
+	ViewportHistory []models.ViewportChange `json:"viewport_history,omitempty"`
+}
+
+type Location struct {
+	Country *string `json:"country,omitempty"`
+	City    *string `json:"city,omitempty"`
+}
+
+type Session struct {
+	ID              uuid.UUID              `json:"id"`
+	UserID          *string                `json:"user_id,omitempty"`
+	Fingerprint     *string                `json:"fingerprint,omitempty"`
+	StartedAt       time.Time              `json:"started_at"`
+	EndedAt         *time.Time             `json:"ended_at,omitempty"`
+	LastActivityAt  time.Time              `json:"last_activity_at"`
+	DurationSeconds float64                `json:"duration_seconds"`
+	Active          bool                   `json:"active"`
+	EntryURL        string                 `json:"entry_url"`
+	Referrer        *string                `json:"referrer,omitempty"`
+	UserAgent       *string                `json:"user_agent,omitempty"`
+	Device          Device                 `json:"device"`
+	Location        Location               `json:"location"`
+	Metadata        map[string]interface{} `json:"metadata,omitempty"`
+	Liveness        *Liveness              `json:"liveness,omitempty"`
+}
+
+// Liveness tells whether a session is still being recorded, from its tabs' latest
+// events and heartbeats rather than from ended_at
+type Liveness struct {
+	Status              string     `json:"status"`
+	Heartbeating        bool       `json:"heartbeating"`
+	LastEventAt         *time.Time `json:"last_event_at,omitempty"`
+	LastEventSecondsAgo *float64   `json:"last_event_seconds_ago,omitempty"`
+	LastHeartbeatAt     *time.Time `json:"last_heartbeat_at,omitempty"`
+}
+
+type Target struct {
+	Element  *string `json:"element,omitempty"`
+	Selector *string `json:"selector,omitempty"`
+	Tag      *string `json:"tag,omitempty"`
+	ID       *string `json:"id,omitempty"`
+	Class    *string `json:"class,omitempty"`
+}
+
+type Point struct {
+	X *float64 `json:"x,omitempty"`
+	Y *float64 `json:"y,omitempty"`
+}
+
+type Input struct {
+	Value  *string `json:"value,omitempty"`
+	Masked bool    `json:"masked"`
+}
+
+type Event struct {
+	ID         int64                  `json:"id"`
+	SessionID  uuid.UUID              `json:"session_id"`
+	Type       models.EventType       `json:"type"`
+	Timestamp  time.Time              `json:"timestamp"`
+	PageURL    string                 `json:"page_url"`
+	Target     *Target                `json:"target,omitempty"`
+	Viewport   *Point                 `json:"viewport,omitempty"`
+	Normalized *Point                 `json:"normalized,omitempty"`
+	Screen     *Point                 `json:"screen,omitempty"`
+	Scroll     *Point                 `json:"scroll,omitempty"`
+	Input      *Input                 `json:"input,omitempty"`
+	Key        *string                `json:"key,omitempty"`
+	Button     *int                   `json:"button,omitempty"`
+	ClickCount *int                   `json:"click_count,omitempty"`
+	TabID      *string                `json:"tab_id,omitempty"`
+	FramePath  *string                `json:"frame_path,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+func toSession(s *models.Session) Session {
+	end := s.LastActivityAt
+	if s.EndedAt != nil {
+		end = *s.EndedAt
+	}
+
+	return Session{
+		ID:              s.SessionID,
+		UserID:          s.UserID,
+		Fingerprint:     s.Fingerprint,
+		StartedAt:       s.StartedAt,
+		EndedAt:         s.EndedAt,
+		LastActivityAt:  s.LastActivityAt,
+		DurationSeconds: end.Sub(s.StartedAt).Seconds(),
+		Active:          s.EndedAt == nil,
+		EntryURL:        s.PageURL,
+		Referrer:        s.Referrer,
+		UserAgent:       s.UserAgent,
+		Device: Device{
+			Type:            s.DeviceType,
+			Browser:         s.Browser,
+			OS:              s.OS,
+			Screen:          Dimensions{Width: s.ScreenWidth, Height: s.ScreenHeight},
+			Viewport:        Dimensions{Width: s.ViewportWidth, Height: s.ViewportHeight},
+			ViewportHistory: s.ViewportHistory,
+		},
+		Location: Location{Country: s.Country, City: s.City},
+		Metadata: s.Metadata,
+	}
+}
+
+// withLiveness sets the session's liveness, which then decides whether it is active
+func withLiveness(session Session, l *models.SessionLiveness) Session {
+	if l == nil {
+		return session
+	}
+	session.Active = l.Status == models.LivenessLive
+	session.Liveness = &Liveness{
+		Status:              l.Status,
+		Heartbeating:        l.Heartbeating,
+		LastEventAt:         l.LastEventAt,
+		LastEventSecondsAgo: l.LastEventSecondsAgo,
+		LastHeartbeatAt:     l.LastHeartbeatAt,
+	}
+	return session
+}
+
+func toSessions(sessions []*models.Session) []Session {
+	result := make([]Session, len(sessions))
+	for i, s := range sessions {
+		result[i] = toSession(s)
+	}
+	return result
+}
+
+func toEvent(e *models.Event) Event {
+	event := Event{
+		ID:         e.EventID,
+		SessionID:  e.SessionID,
+		Type:       e.EventType,
+		Timestamp:  e.Timestamp,
+		PageURL:    e.PageURL,
+		Viewport:   toPoint(e.ViewportX, e.ViewportY),
+		Normalized: toPoint(e.NormX, e.NormY),
+		Screen:     toPoint(e.ScreenX, e.ScreenY),
+		Scroll:     toPoint(e.ScrollX, e.ScrollY),
+		Key:        e.KeyPressed,
+		Button:     e.MouseButton,
+		ClickCount: e.ClickCount,
+		TabID:      e.TabID,
+		FramePath:  e.FramePath,
+		Data:       e.EventData,
+	}
+
+	if e.TargetElement != nil || e.TargetSelector != nil || e.TargetTag != nil || e.TargetID != nil || e.TargetClass != nil {
+		event.Target = &Target{
+			Element:  e.TargetElement,
+			Selector: e.TargetSelector,
+			Tag:      e.TargetTag,
+			ID:       e.TargetID,
+			Class:    e.TargetClass,
+		}
+	}
+
+	if e.InputValue != nil || e.InputMasked {
+		event.Input = &Input{Value: e.InputValue, Masked: e.InputMasked}
+	}
+
+	return event
+}
+
+func toEvents(events []*models.Event) []Event {
+	result := make([]Event, len(events))
+	for i, e := range events {
+		result[i] = toEvent(e)
+	}
+	return result
+}
+
+func toPoint(x, y *float64) *Point {
+	if x == nil && y == nil {
+		return nil
+	}
+	return &Point{X: x, Y: y}
+}
@@ -0,0 +1,46 @@
+package v2
+
+import "github.com/gofiber/fiber/v2"
+
+// Version is reported in every v2 envelope
+const Version = "v2"
+
+// Envelope wraps every successful v2 response
+type Envelope struct {
+	Data       interface{} `json:"data"`
+	Meta       Meta        `json:"meta"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+type Meta struct {
+	APIVersion string `json:"api_version"`
+}
+
+type Pagination struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// ErrorBody is the v2 error shape: a stable machine-readable code plus a message
+type ErrorBody struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func respond(c *fiber.Ctx, data interface{}, pagination *Pagination) error {
+	return c.JSON(Envelope{
+		Data:       data,
+		Meta:       Meta{APIVersion: Version},
+		Pagination: pagination,
+	})
+}
+
+func respondError(c *fiber.Ctx, status int, code, message string) error {
+	return c.Status(status).JSON(ErrorBody{
+		Error: ErrorDetail{Code: code, Message: message},
+	})
+}
@@ -0,0 +1,161 @@
+package v2
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/liveness"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/pagination"
+	"github.com/ngocp/user-tracker/internal/redact"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/visibility"
+)
+
+type SessionHandler struct {
+	sessionRepo *repository.SessionRepository
+	eventRepo   *repository.EventRepository
+	liveness    *liveness.Tracker
+}
+
+// NewSessionHandler creates the handler. With livenessTracker set, sessions carry
+// their liveness and are active while it is live; nil falls back to ended_at.
+func NewSessionHandler(sessionRepo *repository.SessionRepository, eventRepo *repository.EventRepository, livenessTracker *liveness.Tracker) *SessionHandler {
+	return &SessionHandler{
+		sessionRepo: sessionRepo,
+		eventRepo:   eventRepo,
+		liveness:    livenessTracker,
+	}
+}
+
+// sessionsWithLiveness maps sessions to their v2 shape with their liveness. Liveness
+// is best effort: when it cannot be read, sessions fall back to ended_at.
+func (h *SessionHandler) sessionsWithLiveness(c *fiber.Ctx, sessions []*models.Session) []Session {
+	result := toSessions(sessions)
+	if h.liveness == nil {
+		return result
+	}
+	statuses, err := h.liveness.GetMany(c.UserContext(), sessions)
+	if err != nil {
+		log.Printf("Failed to get session liveness: %v", err)
+		return result
+	}
+	for i, s := range sessions {
+		result[i] = withLiveness(result[i], statuses[s.SessionID])
+	}
+	return result
+}
+
+// ListSessions returns sessions newest first with cursor pagination
+func (h *SessionHandler) ListSessions(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	var cursor *pagination.Cursor
+	var afterID uuid.UUID
+	if token := c.Query("cursor"); token != "" {
+		decoded, err := pagination.Decode(token)
+		if err == nil {
+			afterID, err = uuid.Parse(decoded.ID)
+		}
+		if err != nil {
+			return respondError(c, fiber.StatusBadRequest, "invalid_cursor", "Invalid cursor")
+		}
+		cursor = &decoded
+	}
+
+	sessions, err := h.sessionRepo.ListPage(c.UserContext(), cursorTime(cursor), afterID, limit)
+	if err != nil {
+		log.Printf("Failed to list sessions: %v", err)
+		return respondError(c, fiber.StatusInternalServerError, "internal_error", "Failed to list sessions")
+	}
+
+	visibility.Sessions(middleware.RoleFromContext(c), sessions)
+
+	page := &Pagination{}
+	if len(sessions) == limit {
+		last := sessions[len(sessions)-1]
+		page.NextCursor = pagination.Cursor{Timestamp: last.StartedAt, ID: last.SessionID.String()}.Encode()
+		page.HasMore = true
+	}
+
+	return respond(c, h.sessionsWithLiveness(c, sessions), page)
+}
+
+func (h *SessionHandler) GetSession(c *fiber.Ctx) error {
+	sessionID := middleware.ParamUUID(c, "id")
+
+	session, err := h.sessionRepo.GetByID(c.UserContext(), sessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return respondError(c, fiber.StatusNotFound, "not_found", "Session not found")
+		}
+		log.Printf("Failed to get session: %v", err)
+		return respondError(c, fiber.StatusInternalServerError, "internal_error", "Failed to get session")
+	}
+
+	visibility.Session(middleware.RoleFromContext(c), session)
+	return respond(c, h.sessionsWithLiveness(c, []*models.Session{session})[0], nil)
+}
+
+// GetSessionEvents returns a session's events in replay order with cursor pagination
+func (h *SessionHandler) GetSessionEvents(c *fiber.Ctx) error {
+	sessionID := middleware.ParamUUID(c, "id")
+
+	limit := c.QueryInt("limit", 1000)
+	if limit < 1 || limit > 10000 {
+		limit = 1000
+	}
+
+	var cursor *pagination.Cursor
+	var afterID int64
+	if token := c.Query("cursor"); token != "" {
+		decoded, err := pagination.Decode(token)
+		if err == nil {
+			afterID, err = decoded.Int64ID()
+		}
+		if err != nil {
+			return respondError(c, fiber.StatusBadRequest, "invalid_cursor", "Invalid cursor")
+		}
+		cursor = &decoded
+	}
+
+	frame := c.Query("frame")
+	if frame != "" && !models.ValidFramePath(frame) {
+		return respondError(c, fiber.StatusBadRequest, "invalid_frame", "Invalid frame path")
+	}
+
+	events, err := h.eventRepo.GetBySessionIDAfter(c.UserContext(), sessionID, frame, cursorTime(cursor), afterID, limit)
+	if err != nil {
+		log.Printf("Failed to get events: %v", err)
+		return respondError(c, fiber.StatusInternalServerError, "internal_error", "Failed to get events")
+	}
+
+	visibility.Events(middleware.RoleFromContext(c), events)
+	if c.QueryBool("redacted", false) {
+		redact.Events(events)
+	}
+
+	page := &Pagination{}
+	if len(events) == limit {
+		last := events[len(events)-1]
+		page.NextCursor = pagination.Cursor{Timestamp: last.Timestamp, ID: strconv.FormatInt(last.EventID, 10)}.Encode()
+		page.HasMore = true
+	}
+
+	return respond(c, toEvents(events), page)
+}
+
+func cursorTime(cursor *pagination.Cursor) *time.Time {
+	if cursor == nil {
+		return nil
+	}
+	return &cursor.Timestamp
+}
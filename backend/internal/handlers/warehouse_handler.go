@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/exporter"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/stats"
+	"github.com/ngocp/user-tracker/internal/warehouse"
+)
+
+// defaultWarehouseDelay holds rows back long enough for late events to arrive
+const defaultWarehouseDelay = time.Hour
+
+type WarehouseHandler struct {
+	warehouseRepo *repository.WarehouseRepository
+}
+
+func NewWarehouseHandler(warehouseRepo *repository.WarehouseRepository) *WarehouseHandler {
+	return &WarehouseHandler{warehouseRepo: warehouseRepo}
+}
+
+// parseWarehouseDelay reads a connector delay; it returns the error message for an
+// invalid one
+func parseWarehouseDelay(s string) (int, string) {
+	delay, err := time.ParseDuration(s)
+	if err != nil || delay < 0 {
+		return 0, "delay must be a non-negative duration, e.g. 1h"
+	}
+	return int(delay / time.Second), ""
+}
+
+// CreateConnector adds a connector loading a project's sessions and events into
+// BigQuery or Snowflake on a cron schedule. Its first run loads everything the
+// project has; later runs continue from where it left off.
+func (h *WarehouseHandler) CreateConnector(c *fiber.Ctx) error {
+	var req models.CreateWarehouseConnectorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.Cron == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "name and cron are required",
+		})
+	}
+	if len(req.Name) > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid name",
+			"details": "name must be 1-255 characters",
+		})
+	}
+	if req.Project == "" {
+		req.Project = stats.DefaultProject
+	}
+	if req.Project != stats.DefaultProject && req.Project != stats.SandboxProject {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid project",
+			"details": "Use default or sandbox",
+		})
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if err := warehouse.Validate(req.Kind, req.Config, req.Credentials); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid connector",
+			"details": err.Error(),
+		})
+	}
+
+	delaySeconds := int(defaultWarehouseDelay / time.Second)
+	if req.Delay != "" {
+		var msg string
+		if delaySeconds, msg = parseWarehouseDelay(req.Delay); msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid delay", "details": msg})
+		}
+	}
+
+	nextRunAt, err := exporter.NextRun(req.Cron, req.Timezone, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid schedule",
+			"details": err.Error(),
+		})
+	}
+
+	connector, err := h.warehouseRepo.Create(c.UserContext(), &models.WarehouseConnector{
+		Name:         req.Name,
+		Kind:         req.Kind,
+		Project:      req.Project,
+		Config:       req.Config,
+		Credentials:  req.Credentials,
+		Cron:         req.Cron,
+		Timezone:     req.Timezone,
+		DelaySeconds: delaySeconds,
+		Enabled:      req.Enabled == nil || *req.Enabled,
+		NextRunAt:    nextRunAt,
+	})
+	if err != nil {
+		log.Printf("Failed to create warehouse connector: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create warehouse connector",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(connector)
+}
+
+// ListConnectors lists warehouse connectors with their cursors and last run; their
+// credentials are never returned
+func (h *WarehouseHandler) ListConnectors(c *fiber.Ctx) error {
+	connectors, err := h.warehouseRepo.List(c.UserContext())
+	if err != nil {
+		log.Printf("Failed to list warehouse connectors: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list warehouse connectors",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": connectors,
+	})
+}
+
+func (h *WarehouseHandler) GetConnector(c *fiber.Ctx) error {
+	connector, err := h.warehouseRepo.GetByID(c.UserContext(), middleware.ParamUUID(c, "id"))
+	if err != nil {
+		return repositoryError(c, err, "Warehouse connector not found", "Failed to get warehouse connector")
+	}
+
+	return c.JSON(connector)
+}
+
+// UpdateConnector changes the fields that are set. Config and credentials are checked
+// together, as the connector would use them; a new config applies the table layout
+// again on the next run. The next run is recomputed when the timing changes or the
+// connector is re-enabled.
+func (h *WarehouseHandler) UpdateConnector(c *fiber.Ctx) error {
+	var req models.UpdateWarehouseConnectorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	connector, err := h.warehouseRepo.GetByID(c.UserContext(), middleware.ParamUUID(c, "id"))
+	if err != nil {
+		return repositoryError(c, err, "Warehouse connector not found", "Failed to get warehouse connector")
+	}
+
+	reschedule := false
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 255 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid name",
+				"details": "name must be 1-255 characters",
+			})
+		}
+		connector.Name = name
+	}
+	if req.Config != nil {
+		connector.Config = req.Config
+	}
+	if req.Credentials != nil {
+		connector.Credentials = *req.Credentials
+	}
+	if req.Cron != nil {
+		connector.Cron = *req.Cron
+		reschedule = true
+	}
+	if req.Timezone != nil {
+		connector.Timezone = *req.Timezone
+		reschedule = true
+	}
+	if req.Delay != nil {
+		var msg string
+		if connector.DelaySeconds, msg = parseWarehouseDelay(*req.Delay); msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid delay", "details": msg})
+		}
+	}
+	if req.Enabled != nil {
+		reschedule = reschedule || (*req.Enabled && !connector.Enabled)
+		connector.Enabled = *req.Enabled
+	}
+
+	if err := warehouse.Validate(connector.Kind, connector.Config, connector.Credentials); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid connector",
+			"details": err.Error(),
+		})
+	}
+	if reschedule {
+		nextRunAt, err := exporter.NextRun(connector.Cron, connector.Timezone, time.Now())
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid schedule",
+				"details": err.Error(),
+			})
+		}
+		connector.NextRunAt = nextRunAt
+	}
+
+	updated, err := h.warehouseRepo.Update(c.UserContext(), connector)
+	if err != nil {
+		return repositoryError(c, err, "Warehouse connector not found", "Failed to update warehouse connector")
+	}
+
+	return c.JSON(updated)
+}
+
+// ResetConnector clears the connector's cursors so its next run loads the project's
+// sessions and events again from the start, into tables created anew if they were
+// dropped. Rows already in the warehouse are not removed.
+func (h *WarehouseHandler) ResetConnector(c *fiber.Ctx) error {
+	connector, err := h.warehouseRepo.ResetCursors(c.UserContext(), middleware.ParamUUID(c, "id"))
+	if err != nil {
+		return repositoryError(c, err, "Warehouse connector not found", "Failed to reset warehouse connector")
+	}
+
+	return c.JSON(connector)
+}
+
+// DeleteConnector removes a connector; the warehouse tables are left as they are
+func (h *WarehouseHandler) DeleteConnector(c *fiber.Ctx) error {
+	if err := h.warehouseRepo.Delete(c.UserContext(), middleware.ParamUUID(c, "id")); err != nil {
+		return repositoryError(c, err, "Warehouse connector not found", "Failed to delete warehouse connector")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
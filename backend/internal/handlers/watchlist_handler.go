@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/middleware"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/visibility"
+)
+
+// maxWatchIdentityLength matches the identity column
+const maxWatchIdentityLength = 255
+
+type WatchlistHandler struct {
+	watchlistRepo *repository.WatchlistRepository
+}
+
+func NewWatchlistHandler(watchlistRepo *repository.WatchlistRepository) *WatchlistHandler {
+	return &WatchlistHandler{watchlistRepo: watchlistRepo}
+}
+
+// Subscribe watches a user_id or fingerprint; its sessions started from now on are
+// pinned and announced. Subscribing again updates the label and notify URL.
+// Fingerprints are identifiers, so only roles that may see them can watch one.
+func (h *WatchlistHandler) Subscribe(c *fiber.Ctx) error {
+	var req models.CreateWatchSubscriptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	req.Identity = strings.TrimSpace(req.Identity)
+	switch req.IdentityType {
+	case models.WatchIdentityUserID:
+	case models.WatchIdentityFingerprint:
+		if !middleware.RoleFromContext(c).Policy().Identifiers {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Watching fingerprints requires the admin role",
+			})
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid identity_type",
+			"details": "Use user_id or fingerprint",
+		})
+	}
+	if req.Identity == "" || len(req.Identity) > maxWatchIdentityLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid identity",
+			"details": "identity must be 1-255 characters",
+		})
+	}
+	if req.NotifyURL != nil && *req.NotifyURL != "" {
+		if u, err := url.Parse(*req.NotifyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid notify_url",
+				"details": "notify_url must be an http(s) URL",
+			})
+		}
+	} else {
+		req.NotifyURL = nil
+	}
+
+	sub, created, err := h.watchlistRepo.Subscribe(c.UserContext(), &req)
+	if err != nil {
+		log.Printf("Failed to create watch subscription: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create watch subscription",
+		})
+	}
+
+	status := fiber.StatusOK
+	if created {
+		status = fiber.StatusCreated
+	}
+	return c.Status(status).JSON(sub)
+}
+
+// ListSubscriptions lists watch subscriptions; fingerprint identities are hidden from
+// roles that may not see identifiers
+func (h *WatchlistHandler) ListSubscriptions(c *fiber.Ctx) error {
+	subs, err := h.watchlistRepo.List(c.UserContext())
+	if err != nil {
+		log.Printf("Failed to list watch subscriptions: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list watch subscriptions",
+		})
+	}
+
+	identifiers := middleware.RoleFromContext(c).Policy().Identifiers
+	for _, sub := range subs {
+		if sub.IdentityType == models.WatchIdentityFingerprint && !identifiers {
+			sub.Identity = nil
+		}
+	}
+	if subs == nil {
+		subs = []*models.WatchSubscription{}
+	}
+
+	return c.JSON(fiber.Map{
+		"data": subs,
+	})
+}
+
+// Unsubscribe deletes a subscription and unpins its sessions
+func (h *WatchlistHandler) Unsubscribe(c *fiber.Ctx) error {
+	subscriptionID := middleware.ParamUUID(c, "id")
+
+	if err := h.watchlistRepo.Delete(c.UserContext(), subscriptionID); err != nil {
+		return repositoryError(c, err, "Watch subscription not found", "Failed to delete watch subscription")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListSessions returns the pinned sessions, newest first, optionally for one
+// ?subscription_id=
+func (h *WatchlistHandler) ListSessions(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	var subscriptionID *uuid.UUID
+	if raw := c.Query("subscription_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid subscription_id",
+				"details": err.Error(),
+			})
+		}
+		subscriptionID = &id
+	}
+
+	watched, err := h.watchlistRepo.ListSessions(c.UserContext(), subscriptionID, limit)
+	if err != nil {
+		log.Printf("Failed to list watched sessions: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list watched sessions",
+		})
+	}
+
+	role := middleware.RoleFromContext(c)
+	for _, ws := range watched {
+		visibility.Session(role, ws.Session)
+	}
+	if watched == nil {
+		watched = []*models.WatchedSession{}
+	}
+
+	return c.JSON(fiber.Map{
+		"data": watched,
+	})
+}
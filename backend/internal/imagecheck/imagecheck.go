@@ -0,0 +1,78 @@
+package imagecheck
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// ErrInvalidImage is wrapped by every validation failure so callers can map it to a 4xx
+var ErrInvalidImage = errors.New("invalid image")
+
+// Limits bounds what an uploaded screenshot may look like
+type Limits struct {
+	MaxWidth  int
+	MaxHeight int
+	// MaxPixels guards against decompression bombs: small files that declare huge canvases
+	MaxPixels int
+	// MaxBytes is the maximum encoded size per format ("png", "jpeg")
+	MaxBytes map[string]int
+}
+
+// DefaultLimits accepts screenshots up to 8K resolution
+var DefaultLimits = Limits{
+	MaxWidth:  7680,
+	MaxHeight: 16384,
+	MaxPixels: 7680 * 8640,
+	MaxBytes: map[string]int{
+		"png":  10 * 1024 * 1024,
+		"jpeg": 5 * 1024 * 1024,
+	},
+}
+
+// Info is what was learned from the image header
+type Info struct {
+	Format string
+	Width  int
+	Height int
+}
+
+// Validate decodes only the image header and checks format, size and dimensions.
+// declaredFormat may be empty when the client did not state one.
+func Validate(data []byte, declaredFormat string, limits Limits) (*Info, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: unrecognized image data: %v", ErrInvalidImage, err)
+	}
+
+	maxBytes, ok := limits.MaxBytes[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported format %s", ErrInvalidImage, format)
+	}
+
+	if declaredFormat != "" && declaredFormat != format {
+		return nil, fmt.Errorf("%w: declared %s but data is %s", ErrInvalidImage, declaredFormat, format)
+	}
+
+	if len(data) > maxBytes {
+		return nil, fmt.Errorf("%w: %s exceeds %d bytes", ErrInvalidImage, format, maxBytes)
+	}
+
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("%w: invalid dimensions %dx%d", ErrInvalidImage, config.Width, config.Height)
+	}
+
+	if config.Width > limits.MaxWidth || config.Height > limits.MaxHeight ||
+		config.Width*config.Height > limits.MaxPixels {
+		return nil, fmt.Errorf("%w: dimensions %dx%d exceed limits", ErrInvalidImage, config.Width, config.Height)
+	}
+
+	return &Info{
+		Format: format,
+		Width:  config.Width,
+		Height: config.Height,
+	}, nil
+}
@@ -0,0 +1,86 @@
+// Package imagediff measures how much two screenshots differ pixel by pixel.
+package imagediff
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Region is the bounding box of the changed pixels
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Result describes the difference between two images
+type Result struct {
+	// Percent is the share of pixels that changed, 0-100, over the larger of the two canvases
+	Percent float64 `json:"diff_percent"`
+	// Region is nil when no pixel changed
+	Region *Region `json:"region,omitempty"`
+}
+
+// Decode decodes a PNG or JPEG screenshot
+func Decode(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+// Compare counts the pixels whose color differs by more than tolerance (0-255) on any
+// channel, so JPEG noise does not register as change. Pixels outside the overlap of
+// two differently sized images count as changed.
+func Compare(a, b image.Image, tolerance uint8) Result {
+	ab, bb := a.Bounds(), b.Bounds()
+	width, height := max(ab.Dx(), bb.Dx()), max(ab.Dy(), bb.Dy())
+	overlapW, overlapH := min(ab.Dx(), bb.Dx()), min(ab.Dy(), bb.Dy())
+
+	total := width * height
+	if total == 0 {
+		return Result{}
+	}
+
+	limit := uint32(tolerance) * 0x101
+	changed := 0
+	minX, minY, maxX, maxY := width, height, -1, -1
+	mark := func(x, y int) {
+		changed++
+		minX, minY = min(minX, x), min(minY, y)
+		maxX, maxY = max(maxX, x), max(maxY, y)
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x >= overlapW || y >= overlapH {
+				mark(x, y)
+				continue
+			}
+			r1, g1, b1, a1 := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			if absDiff(r1, r2) > limit || absDiff(g1, g2) > limit ||
+				absDiff(b1, b2) > limit || absDiff(a1, a2) > limit {
+				mark(x, y)
+			}
+		}
+	}
+
+	result := Result{Percent: float64(changed) * 100 / float64(total)}
+	if changed > 0 {
+		result.Region = &Region{X: minX, Y: minY, Width: maxX - minX + 1, Height: maxY - minY + 1}
+	}
+	return result
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,219 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// accessLogSessionGap ends a visitor's session after this long without a page view,
+// the inactivity timeout web analytics tools commonly use
+const accessLogSessionGap = 30 * time.Minute
+
+// accessLogLine matches the combined log format; the trailing referer and user agent
+// are optional so common log format lines are read too
+var accessLogLine = regexp.MustCompile(`^(\S+) \S+ (\S+) \[([^\]]+)\] "([^"]*)" (\d{3}) \S+(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?`)
+
+const accessLogTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// accessLogAssets are the extensions of requests that are not page views
+var accessLogAssets = map[string]bool{
+	".css": true, ".js": true, ".mjs": true, ".map": true, ".json": true, ".xml": true, ".txt": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".webp": true, ".avif": true, ".ico": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".otf": true, ".eot": true,
+	".mp4": true, ".webm": true, ".mp3": true, ".pdf": true, ".zip": true, ".gz": true,
+}
+
+// accessLogBots are user agent substrings of crawlers and monitors
+var accessLogBots = []string{"bot", "crawl", "spider", "slurp", "curl/", "wget/", "python-requests", "go-http-client", "headless"}
+
+// AccessLogConverter reads web server access logs in the combined log format. Page
+// views (successful GET requests other than static assets and bots) are grouped per
+// IP and user agent into sessions, split after accessLogSessionGap of inactivity,
+// with a navigation event per view. This gives pages without the SDK baseline
+// analytics. Logs carry no host, so page URLs are the request paths.
+type AccessLogConverter struct{}
+
+// accessLogView is one page view parsed from a log line
+type accessLogView struct {
+	at        time.Time
+	target    string
+	status    int
+	referrer  string
+	user      string
+	userAgent string
+}
+
+func (c AccessLogConverter) Convert(payload []byte) ([]models.ImportRecord, *models.MappingReport, error) {
+	report := newMappingReport()
+
+	// Views of each visitor, keyed by IP and user agent, in order of first appearance
+	var visitors []string
+	views := make(map[string][]accessLogView)
+
+	scanner := bufio.NewScanner(bytes.NewReader(payload))
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		report.RecordsIn++
+
+		view, ip, reason := parseAccessLogLine(line)
+		if reason != "" {
+			report.DroppedRecords[reason]++
+			continue
+		}
+
+		visitor := ip + "\x00" + view.userAgent
+		if _, ok := views[visitor]; !ok {
+			visitors = append(visitors, visitor)
+		}
+		views[visitor] = append(views[visitor], view)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("invalid access log after %d lines: %w", report.RecordsIn, err)
+	}
+
+	var sessions, events []models.ImportRecord
+	for _, visitor := range visitors {
+		visits := views[visitor]
+		// Lines of concurrent requests are not always logged in order
+		sort.SliceStable(visits, func(i, j int) bool { return visits[i].at.Before(visits[j].at) })
+
+		start := 0
+		for i := 1; i <= len(visits); i++ {
+			if i < len(visits) && visits[i].at.Sub(visits[i-1].at) <= accessLogSessionGap {
+				continue
+			}
+			session, sessionEvents := accessLogSession(visitor, visits[start:i])
+			sessions = append(sessions, session)
+			events = append(events, sessionEvents...)
+			start = i
+		}
+	}
+
+	report.SessionsOut = int64(len(sessions))
+	report.EventsOut = int64(len(events))
+	return append(sessions, events...), report, nil
+}
+
+// parseAccessLogLine returns the page view of a line and the client IP, or the reason
+// the line is not imported
+func parseAccessLogLine(line string) (accessLogView, string, string) {
+	m := accessLogLine.FindStringSubmatch(line)
+	if m == nil {
+		return accessLogView{}, "", "malformed line"
+	}
+
+	at, err := time.Parse(accessLogTimeLayout, m[3])
+	if err != nil {
+		return accessLogView{}, "", "invalid time"
+	}
+	status, _ := strconv.Atoi(m[5])
+	view := accessLogView{
+		at:        at.UTC(),
+		status:    status,
+		user:      logField(m[2]),
+		referrer:  logField(m[6]),
+		userAgent: logField(m[7]),
+	}
+
+	method, rest, _ := strings.Cut(m[4], " ")
+	target, _, _ := strings.Cut(rest, " ")
+	switch {
+	case method != "GET":
+		return view, "", "not a GET request"
+	case !strings.HasPrefix(target, "/"):
+		return view, "", "invalid request target"
+	case status >= 400:
+		return view, "", "error status"
+	case isAccessLogAsset(target):
+		return view, "", "static asset"
+	case isAccessLogBot(view.userAgent):
+		return view, "", "bot user agent"
+	}
+	view.target = target
+	return view, m[1], ""
+}
+
+// accessLogSession builds the session of consecutive page views of a visitor, with
+// its ID derived from the visitor and start so re-imports do not duplicate it
+func accessLogSession(visitor string, visits []accessLogView) (models.ImportRecord, []models.ImportRecord) {
+	first, last := visits[0], visits[len(visits)-1]
+	sessionID := derivedSessionID("access_log", visitor+"\x00"+first.at.Format(time.RFC3339Nano))
+
+	session := &models.ImportedSession{
+		SessionID:      sessionID,
+		StartedAt:      first.at,
+		EndedAt:        &last.at,
+		LastActivityAt: &last.at,
+	}
+	session.PageURL = first.target
+	session.Referrer = stringPtr(first.referrer)
+	session.UserAgent = stringPtr(first.userAgent)
+	session.Metadata = map[string]interface{}{
+		"import_source": "access_log",
+		"page_views":    len(visits),
+	}
+	for _, v := range visits {
+		if v.user != "" {
+			session.UserID = stringPtr(v.user)
+			break
+		}
+	}
+
+	events := make([]models.ImportRecord, 0, len(visits))
+	from := ""
+	for _, v := range visits {
+		data := map[string]interface{}{"to": v.target, "status": v.status}
+		if from != "" {
+			data["from"] = from
+		}
+		events = append(events, models.ImportRecord{
+			Type:      "event",
+			SessionID: sessionID.String(),
+			Event: &models.EventData{
+				Timestamp: v.at,
+				EventType: models.EventTypeNavigation,
+				PageURL:   v.target,
+				EventData: data,
+			},
+		})
+		from = v.target
+	}
+
+	return models.ImportRecord{Type: "session", Session: session}, events
+}
+
+// logField returns "" for the "-" servers log in place of a missing value
+func logField(value string) string {
+	if value == "-" {
+		return ""
+	}
+	return strings.ReplaceAll(value, `\"`, `"`)
+}
+
+func isAccessLogAsset(target string) bool {
+	p, _, _ := strings.Cut(target, "?")
+	return accessLogAssets[strings.ToLower(path.Ext(p))]
+}
+
+func isAccessLogBot(userAgent string) bool {
+	ua := strings.ToLower(userAgent)
+	for _, bot := range accessLogBots {
+		if strings.Contains(ua, bot) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package importer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// SourceNDJSON is the native import format (see models.ImportRecord)
+const SourceNDJSON = "ndjson"
+
+// Converter maps a third-party export into import records. Sessions are emitted
+// before the events that reference them.
+type Converter interface {
+	Convert(payload []byte) ([]models.ImportRecord, *models.MappingReport, error)
+}
+
+var converters = map[string]Converter{
+	"access_log": AccessLogConverter{},
+	"fullstory":  FullStoryConverter{},
+	"hotjar":     HotjarConverter{},
+}
+
+// importNamespace derives stable session IDs from third-party identifiers so
+// re-importing the same export does not duplicate sessions
+var importNamespace = uuid.MustParse("0f8b6a52-3f0e-4a57-9c1e-6a2d1f3c9b7e")
+
+// IsSupportedSource reports whether the worker can process imports from source
+func IsSupportedSource(source string) bool {
+	_, ok := converters[source]
+	return ok || source == SourceNDJSON
+}
+
+// SupportedSources lists the accepted import sources
+func SupportedSources() []string {
+	sources := []string{SourceNDJSON}
+	for name := range converters {
+		sources = append(sources, name)
+	}
+	sort.Strings(sources[1:])
+	return sources
+}
+
+func newMappingReport() *models.MappingReport {
+	return &models.MappingReport{
+		DroppedRecords:     make(map[string]int64),
+		DroppedFields:      make(map[string]int64),
+		UnmappedEventTypes: make(map[string]int64),
+	}
+}
+
+func derivedSessionID(source, externalID string) uuid.UUID {
+	return uuid.NewSHA1(importNamespace, []byte(source+":"+externalID))
+}
+
+// timeLayouts are the timestamp formats seen in third-party exports
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"01/02/2006 15:04:05",
+	"01/02/2006 15:04",
+	"Jan 2, 2006 3:04 PM",
+	"Jan 2, 2006 15:04",
+}
+
+func parseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time: %q", value)
+}
+
+// parseDuration accepts plain seconds, Go durations ("1m30s") and clock format ("01:02:03")
+func parseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d, nil
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("unrecognized duration: %q", value)
+	}
+	var total time.Duration
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("unrecognized duration: %q", value)
+		}
+		total = total*60 + time.Duration(n)
+	}
+	return total * time.Second, nil
+}
+
+func stringPtr(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
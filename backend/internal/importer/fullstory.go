@@ -0,0 +1,214 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// FullStoryConverter reads FullStory Data Export bundles: a JSON array (or NDJSON)
+// of event rows, each carrying its page and user context
+type FullStoryConverter struct{}
+
+var fullStoryEventTypes = map[string]models.EventType{
+	"click":    models.EventTypeClick,
+	"navigate": models.EventTypeNavigation,
+	"load":     models.EventTypeNavigation,
+	"change":   models.EventTypeChange,
+	"error":    models.EventTypeError,
+}
+
+// fullStoryMappedFields are the columns carried over; anything else is reported as dropped
+var fullStoryMappedFields = map[string]bool{
+	"IndvId": true, "SessionId": true, "UserAppKey": true,
+	"EventStart": true, "EventType": true, "EventTargetText": true, "EventTargetSelectorTok": true,
+	"EventModFrustrated": true, "EventModDead": true, "EventModError": true,
+	"PageUrl": true, "PageRefererUrl": true, "PageUserAgent": true, "PageBrowser": true,
+	"PageDevice": true, "PageOperatingSystem": true, "PageCity": true, "PageCountry": true,
+	"PageScreenWidth": true, "PageScreenHeight": true, "PageViewportWidth": true, "PageViewportHeight": true,
+}
+
+// fsRow is one FullStory export row with typed accessors
+type fsRow map[string]interface{}
+
+func (r fsRow) str(key string) string {
+	switch v := r[key].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
+
+func (r fsRow) int(key string) *int {
+	n, err := strconv.Atoi(r.str(key))
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+func (r fsRow) flag(key string) bool {
+	s := r.str(key)
+	return s == "true" || s == "1"
+}
+
+func (c FullStoryConverter) Convert(payload []byte) ([]models.ImportRecord, *models.MappingReport, error) {
+	rows, err := decodeFullStoryRows(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := newMappingReport()
+	sessions := make(map[uuid.UUID]*models.ImportedSession)
+	var order []uuid.UUID
+	var events []models.ImportRecord
+
+	for _, row := range rows {
+		report.RecordsIn++
+
+		for key := range row {
+			if !fullStoryMappedFields[key] {
+				report.DroppedFields[key]++
+			}
+		}
+
+		indvID, fsSessionID := row.str("IndvId"), row.str("SessionId")
+		if indvID == "" || fsSessionID == "" {
+			report.DroppedRecords["missing IndvId or SessionId"]++
+			continue
+		}
+		timestamp, err := parseTime(row.str("EventStart"))
+		if err != nil {
+			report.DroppedRecords["invalid EventStart"]++
+			continue
+		}
+		pageURL := row.str("PageUrl")
+		if pageURL == "" {
+			report.DroppedRecords["missing PageUrl"]++
+			continue
+		}
+		fsType := row.str("EventType")
+		eventType, ok := fullStoryEventTypes[fsType]
+		if !ok {
+			report.UnmappedEventTypes[fsType]++
+			continue
+		}
+
+		sessionID := derivedSessionID("fullstory", indvID+":"+fsSessionID)
+		session, ok := sessions[sessionID]
+		if !ok {
+			session = newFullStorySession(sessionID, indvID, fsSessionID, row, pageURL, timestamp)
+			sessions[sessionID] = session
+			order = append(order, sessionID)
+		}
+		if timestamp.Before(session.StartedAt) {
+			session.StartedAt = timestamp
+			session.PageURL = pageURL
+		}
+		if timestamp.After(*session.LastActivityAt) {
+			last := timestamp
+			session.LastActivityAt = &last
+		}
+
+		event := &models.EventData{
+			Timestamp:      timestamp,
+			EventType:      eventType,
+			PageURL:        pageURL,
+			TargetElement:  stringPtr(row.str("EventTargetText")),
+			TargetSelector: stringPtr(row.str("EventTargetSelectorTok")),
+		}
+		data := map[string]interface{}{}
+		for key, name := range map[string]string{
+			"EventModFrustrated": "frustrated",
+			"EventModDead":       "dead_click",
+			"EventModError":      "error_click",
+		} {
+			if row.flag(key) {
+				data[name] = true
+			}
+		}
+		if len(data) > 0 {
+			event.EventData = data
+		}
+
+		events = append(events, models.ImportRecord{Type: "event", SessionID: sessionID.String(), Event: event})
+	}
+
+	records := make([]models.ImportRecord, 0, len(order)+len(events))
+	for _, id := range order {
+		records = append(records, models.ImportRecord{Type: "session", Session: sessions[id]})
+	}
+	records = append(records, events...)
+
+	report.SessionsOut = int64(len(order))
+	report.EventsOut = int64(len(events))
+	return records, report, nil
+}
+
+func newFullStorySession(sessionID uuid.UUID, indvID, fsSessionID string, row fsRow, pageURL string, at time.Time) *models.ImportedSession {
+	last := at
+	session := &models.ImportedSession{
+		SessionID:      sessionID,
+		StartedAt:      at,
+		LastActivityAt: &last,
+		Country:        stringPtr(row.str("PageCountry")),
+		City:           stringPtr(row.str("PageCity")),
+	}
+	session.PageURL = pageURL
+	session.UserID = stringPtr(row.str("UserAppKey"))
+	session.Fingerprint = stringPtr("fullstory:" + indvID)
+	session.Referrer = stringPtr(row.str("PageRefererUrl"))
+	session.UserAgent = stringPtr(row.str("PageUserAgent"))
+	session.Browser = stringPtr(row.str("PageBrowser"))
+	session.DeviceType = stringPtr(strings.ToLower(row.str("PageDevice")))
+	session.OS = stringPtr(row.str("PageOperatingSystem"))
+	session.ScreenWidth = row.int("PageScreenWidth")
+	session.ScreenHeight = row.int("PageScreenHeight")
+	session.ViewportWidth = row.int("PageViewportWidth")
+	session.ViewportHeight = row.int("PageViewportHeight")
+	session.Metadata = map[string]interface{}{
+		"import_source":        "fullstory",
+		"fullstory_indv_id":    indvID,
+		"fullstory_session_id": fsSessionID,
+	}
+	return session
+}
+
+// decodeFullStoryRows accepts either a JSON array of rows or one row per line
+func decodeFullStoryRows(payload []byte) ([]fsRow, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	if trimmed := bytes.TrimSpace(payload); len(trimmed) > 0 && trimmed[0] == '[' {
+		var rows []fsRow
+		if err := decoder.Decode(&rows); err != nil {
+			return nil, fmt.Errorf("invalid FullStory export: %w", err)
+		}
+		return rows, nil
+	}
+
+	var rows []fsRow
+	for {
+		var row fsRow
+		err := decoder.Decode(&row)
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid FullStory export after %d rows: %w", len(rows), err)
+		}
+		rows = append(rows, row)
+	}
+}
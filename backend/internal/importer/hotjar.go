@@ -0,0 +1,140 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// HotjarConverter reads the Hotjar recordings list CSV export. Hotjar does not export
+// raw interactions, so each row becomes a session with navigation events for its
+// entry and exit pages.
+type HotjarConverter struct{}
+
+// hotjarColumns maps the header variants Hotjar has used to our field names
+var hotjarColumns = map[string]string{
+	"recording id": "id", "recording": "id", "id": "id",
+	"user": "user", "user id": "user", "user_id": "user",
+	"date": "date", "start time": "date", "created": "date",
+	"duration": "duration",
+	"country":  "country",
+	"device":   "device", "device type": "device",
+	"browser": "browser",
+	"os":      "os", "operating system": "os",
+	"entry page": "entry", "entry url": "entry", "landing page": "entry", "start page": "entry",
+	"exit page": "exit", "exit url": "exit",
+	"referrer": "referrer", "referrer url": "referrer",
+	"pages": "pages", "page count": "pages",
+	"actions": "actions",
+}
+
+func (c HotjarConverter) Convert(payload []byte) ([]models.ImportRecord, *models.MappingReport, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(payload, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Hotjar export: missing header: %w", err)
+	}
+
+	report := newMappingReport()
+	fields := make([]string, len(header))
+	for i, name := range header {
+		fields[i] = hotjarColumns[strings.ToLower(strings.TrimSpace(name))]
+	}
+
+	var sessions, events []models.ImportRecord
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid Hotjar export after %d rows: %w", report.RecordsIn, err)
+		}
+		report.RecordsIn++
+
+		row := make(map[string]string)
+		for i, value := range values {
+			value = strings.TrimSpace(value)
+			if i >= len(fields) || fields[i] == "" {
+				if value != "" && i < len(header) {
+					report.DroppedFields[header[i]]++
+				}
+				continue
+			}
+			row[fields[i]] = value
+		}
+
+		if row["id"] == "" {
+			report.DroppedRecords["missing recording id"]++
+			continue
+		}
+		startedAt, err := parseTime(row["date"])
+		if err != nil {
+			report.DroppedRecords["invalid date"]++
+			continue
+		}
+		entry := row["entry"]
+		if entry == "" {
+			report.DroppedRecords["missing entry page"]++
+			continue
+		}
+
+		sessionID := derivedSessionID("hotjar", row["id"])
+		session := &models.ImportedSession{
+			SessionID: sessionID,
+			StartedAt: startedAt,
+			Country:   stringPtr(row["country"]),
+		}
+		session.PageURL = entry
+		session.UserID = stringPtr(row["user"])
+		session.Referrer = stringPtr(row["referrer"])
+		session.DeviceType = stringPtr(strings.ToLower(row["device"]))
+		session.Browser = stringPtr(row["browser"])
+		session.OS = stringPtr(row["os"])
+		session.Metadata = map[string]interface{}{
+			"import_source":       "hotjar",
+			"hotjar_recording_id": row["id"],
+		}
+		// Aggregate counts have no event equivalent; keep them for reference
+		for _, key := range []string{"pages", "actions"} {
+			if row[key] != "" {
+				session.Metadata["hotjar_"+key] = row[key]
+			}
+		}
+
+		endedAt := startedAt
+		if row["duration"] != "" {
+			duration, err := parseDuration(row["duration"])
+			if err != nil {
+				report.DroppedFields["Duration"]++
+			} else {
+				endedAt = startedAt.Add(duration)
+				session.EndedAt = &endedAt
+			}
+		}
+
+		sessions = append(sessions, models.ImportRecord{Type: "session", Session: session})
+		events = append(events, models.ImportRecord{
+			Type:      "event",
+			SessionID: sessionID.String(),
+			Event:     &models.EventData{Timestamp: startedAt, EventType: models.EventTypeNavigation, PageURL: entry},
+		})
+		if exit := row["exit"]; exit != "" && exit != entry {
+			events = append(events, models.ImportRecord{
+				Type:      "event",
+				SessionID: sessionID.String(),
+				Event:     &models.EventData{Timestamp: endedAt, EventType: models.EventTypeNavigation, PageURL: exit},
+			})
+		}
+	}
+
+	report.SessionsOut = int64(len(sessions))
+	report.EventsOut = int64(len(events))
+	return append(sessions, events...), report, nil
+}
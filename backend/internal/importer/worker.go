@@ -0,0 +1,302 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/storage"
+)
+
+// maxLineSize bounds a single NDJSON record
+const maxLineSize = 1024 * 1024
+
+// WorkerConfig holds configuration for the import worker
+type WorkerConfig struct {
+	PollInterval  time.Duration
+	BatchSize     int
+	ProgressEvery int64
+}
+
+// Worker claims pending import jobs and loads their NDJSON records one job at a time
+type Worker struct {
+	importRepo  *repository.ImportRepository
+	sessionRepo *repository.SessionRepository
+	eventRepo   *repository.EventRepository
+	store       storage.Store
+	config      WorkerConfig
+	stopChan    chan struct{}
+	wg          sync.WaitGroup
+}
+
+// run holds the state of a single job while it is being imported
+type run struct {
+	job      *models.ImportJob
+	pending  map[uuid.UUID][]models.EventData
+	buffered int
+	progress models.ImportProgress
+}
+
+// NewWorker creates a new import worker. store is optional and only needed for
+// imports that reference an object key.
+func NewWorker(
+	importRepo *repository.ImportRepository,
+	sessionRepo *repository.SessionRepository,
+	eventRepo *repository.EventRepository,
+	store storage.Store,
+	config WorkerConfig,
+) *Worker {
+	return &Worker{
+		importRepo:  importRepo,
+		sessionRepo: sessionRepo,
+		eventRepo:   eventRepo,
+		store:       store,
+		config:      config,
+		stopChan:    make(chan struct{}),
+	}
+}
+
+// Start runs the polling loop in the background
+func (w *Worker) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go w.loop(ctx)
+}
+
+// Stop stops the worker; a job in progress is marked failed at the next line
+func (w *Worker) Stop() {
+	close(w.stopChan)
+	w.wg.Wait()
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	defer w.wg.Done()
+
+	log.Printf("[Importer] Started, poll interval: %v", w.config.PollInterval)
+
+	ticker := time.NewTicker(w.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopChan:
+			log.Println("[Importer] Stopped")
+			return
+		case <-ticker.C:
+			w.drain(ctx)
+		}
+	}
+}
+
+// drain processes pending jobs until none are left or the worker is stopped
+func (w *Worker) drain(ctx context.Context) {
+	for !w.stopped() {
+		job, payload, err := w.importRepo.ClaimNext(ctx)
+		if err != nil {
+			log.Printf("[Importer] Error claiming job: %v", err)
+			return
+		}
+		if job == nil {
+			return
+		}
+
+		log.Printf("[Importer] Processing job %s", job.JobID)
+		status := models.ImportStatusCompleted
+		var jobErr *string
+		if err := w.process(ctx, job, payload); err != nil {
+			log.Printf("[Importer] Job %s failed: %v", job.JobID, err)
+			status = models.ImportStatusFailed
+			msg := err.Error()
+			jobErr = &msg
+		}
+
+		if err := w.importRepo.Finish(ctx, job.JobID, status, jobErr); err != nil {
+			log.Printf("[Importer] Error finishing job %s: %v", job.JobID, err)
+		}
+	}
+}
+
+func (w *Worker) stopped() bool {
+	select {
+	case <-w.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *Worker) process(ctx context.Context, job *models.ImportJob, payload []byte) error {
+	if payload == nil {
+		if job.ObjectKey == nil || w.store == nil {
+			return fmt.Errorf("import has no payload and blob storage is not configured")
+		}
+		data, err := w.store.Get(ctx, *job.ObjectKey)
+		if err != nil {
+			return fmt.Errorf("failed to read import object %s: %w", *job.ObjectKey, err)
+		}
+		payload = data
+	}
+
+	r := &run{job: job, pending: make(map[uuid.UUID][]models.EventData)}
+
+	if converter, ok := converters[job.Source]; ok {
+		return w.processConverted(ctx, r, converter, payload)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(payload))
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	var line int64
+	for scanner.Scan() {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		line++
+
+		var record models.ImportRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			err = fmt.Errorf("invalid JSON: %w", err)
+			if stopErr := w.step(ctx, r, line, nil, err); stopErr != nil {
+				return stopErr
+			}
+			continue
+		}
+		if err := w.step(ctx, r, line, &record, nil); err != nil {
+			return err
+		}
+	}
+
+	w.flush(ctx, r)
+	w.report(ctx, r)
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read NDJSON after line %d: %w", line, err)
+	}
+	return nil
+}
+
+// processConverted maps a third-party export to records, stores the mapping report
+// and imports the records like NDJSON lines
+func (w *Worker) processConverted(ctx context.Context, r *run, converter Converter, payload []byte) error {
+	records, mapping, err := converter.Convert(payload)
+	if err != nil {
+		return err
+	}
+
+	if err := w.importRepo.SetMappingReport(ctx, r.job.JobID, mapping); err != nil {
+		log.Printf("[Importer] Error storing mapping report for job %s: %v", r.job.JobID, err)
+	}
+	log.Printf("[Importer] Job %s: converted %d %s records into %d sessions and %d events",
+		r.job.JobID, mapping.RecordsIn, r.job.Source, mapping.SessionsOut, mapping.EventsOut)
+
+	for i := range records {
+		if err := w.step(ctx, r, int64(i+1), &records[i], nil); err != nil {
+			return err
+		}
+	}
+
+	w.flush(ctx, r)
+	w.report(ctx, r)
+	return nil
+}
+
+// step imports one record and periodically flushes events and reports progress.
+// It returns an error only when the worker is stopping.
+func (w *Worker) step(ctx context.Context, r *run, line int64, record *models.ImportRecord, parseErr error) error {
+	if w.stopped() {
+		w.flush(ctx, r)
+		w.report(ctx, r)
+		return fmt.Errorf("interrupted by shutdown after %d records", line-1)
+	}
+
+	r.progress.LinesProcessed++
+	err := parseErr
+	if err == nil {
+		err = w.importRecord(ctx, r, record)
+	}
+	if err != nil {
+		r.progress.LinesFailed++
+		log.Printf("[Importer] Job %s record %d: %v", r.job.JobID, line, err)
+	}
+
+	if r.buffered >= w.config.BatchSize {
+		w.flush(ctx, r)
+	}
+	if line%w.config.ProgressEvery == 0 {
+		w.flush(ctx, r)
+		w.report(ctx, r)
+	}
+	return nil
+}
+
+// importRecord imports a session immediately and buffers events for batch insertion
+func (w *Worker) importRecord(ctx context.Context, r *run, record *models.ImportRecord) error {
+	switch record.Type {
+	case "session":
+		s := record.Session
+		if s == nil || s.SessionID == uuid.Nil || s.StartedAt.IsZero() || s.PageURL == "" {
+			return fmt.Errorf("session record requires session_id, started_at and page_url")
+		}
+		// Events for this session may already be buffered; keep insertion order
+		w.flush(ctx, r)
+		inserted, err := w.sessionRepo.Import(ctx, s)
+		if err != nil {
+			return err
+		}
+		if inserted {
+			r.progress.SessionsImported++
+		}
+		return nil
+
+	case "event":
+		sessionID, err := uuid.Parse(record.SessionID)
+		if err != nil {
+			return fmt.Errorf("invalid session_id: %s", record.SessionID)
+		}
+		e := record.Event
+		if e == nil || e.Timestamp.IsZero() || e.EventType == "" || e.PageURL == "" {
+			return fmt.Errorf("event record requires timestamp, event_type and page_url")
+		}
+		r.pending[sessionID] = append(r.pending[sessionID], *e)
+		r.buffered++
+		return nil
+
+	default:
+		return fmt.Errorf("unknown record type: %q", record.Type)
+	}
+}
+
+// flush writes buffered events; a failed batch counts all of its lines as failed
+func (w *Worker) flush(ctx context.Context, r *run) {
+	for sessionID, events := range r.pending {
+		if err := w.eventRepo.CreateBatch(ctx, sessionID, events); err != nil {
+			log.Printf("[Importer] Job %s: failed to import %d events for session %s: %v",
+				r.job.JobID, len(events), sessionID, err)
+			r.progress.LinesFailed += int64(len(events))
+			continue
+		}
+		r.progress.EventsImported += int64(len(events))
+	}
+	r.pending = make(map[uuid.UUID][]models.EventData)
+	r.buffered = 0
+}
+
+// report persists the progress accumulated since the last report
+func (w *Worker) report(ctx context.Context, r *run) {
+	if r.progress == (models.ImportProgress{}) {
+		return
+	}
+	if err := w.importRepo.AddProgress(ctx, r.job.JobID, r.progress); err != nil {
+		log.Printf("[Importer] Error reporting progress for job %s: %v", r.job.JobID, err)
+		return
+	}
+	r.progress = models.ImportProgress{}
+}
@@ -0,0 +1,229 @@
+package issues
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// ClustererConfig holds configuration for the issue clustering job
+type ClustererConfig struct {
+	Interval time.Duration
+	// Lookback is how far back a session's signals are grouped with new ones, and how
+	// far back the first pass after startup reaches
+	Lookback           time.Duration
+	RageClickThreshold int
+}
+
+// Clusterer periodically groups error and rage click signals into issues
+type Clusterer struct {
+	issueRepo *repository.IssueRepository
+	config    ClustererConfig
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+	lastRun   time.Time
+}
+
+// signature identifies a group of sessions that failed the same way
+type signature struct {
+	errorMessage string
+	pageURL      string
+	selector     string
+}
+
+// sessionPage collects the signals of one session on one page
+type sessionPage struct {
+	sessionID uuid.UUID
+	pageURL   string
+	errors    map[string]time.Time
+	selectors map[string]time.Time
+}
+
+var numberPattern = regexp.MustCompile(`\d+`)
+
+// windowOverlap is how far each pass reaches back before the end of the previous one.
+// ingested_at is the start of the inserting transaction, so events committed just
+// after a pass can carry an earlier time; recording occurrences is idempotent.
+const windowOverlap = time.Minute
+
+// NewClusterer creates a new issue clusterer
+func NewClusterer(issueRepo *repository.IssueRepository, config ClustererConfig) *Clusterer {
+	return &Clusterer{
+		issueRepo: issueRepo,
+		config:    config,
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// Start runs the clustering loop in the background
+func (c *Clusterer) Start(ctx context.Context) {
+	c.lastRun = time.Now().Add(-c.config.Lookback)
+
+	c.wg.Add(1)
+	go c.run(ctx)
+}
+
+// Stop stops the clustering loop and waits for the current pass to finish
+func (c *Clusterer) Stop() {
+	close(c.stopChan)
+	c.wg.Wait()
+}
+
+func (c *Clusterer) run(ctx context.Context) {
+	defer c.wg.Done()
+
+	log.Printf("[Clusterer] Started, interval: %v", c.config.Interval)
+
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			log.Println("[Clusterer] Stopped")
+			return
+		case <-ticker.C:
+			c.cluster(ctx)
+		}
+	}
+}
+
+// cluster processes the sessions with signals stored since the previous pass, along
+// with their signals of the lookback before it, so a session's signatures on a page
+// do not depend on which pass each signal arrived in
+func (c *Clusterer) cluster(ctx context.Context) {
+	until := time.Now()
+
+	signals, err := c.issueRepo.ListSignals(ctx, until.Add(-c.config.Lookback), c.lastRun.Add(-windowOverlap), until, c.config.RageClickThreshold)
+	if err != nil {
+		log.Printf("[Clusterer] Error listing signals: %v", err)
+		return
+	}
+
+	// Group signals per session and page
+	pages := make(map[string]*sessionPage)
+	for _, s := range signals {
+		key := s.SessionID.String() + "|" + s.PageURL
+		page, ok := pages[key]
+		if !ok {
+			page = &sessionPage{
+				sessionID: s.SessionID,
+				pageURL:   s.PageURL,
+				errors:    make(map[string]time.Time),
+				selectors: make(map[string]time.Time),
+			}
+			pages[key] = page
+		}
+
+		if s.EventType == models.EventTypeError {
+			page.errors[normalizeMessage(s.ErrorMessage)] = s.Timestamp
+		} else if s.TargetSelector != nil {
+			page.selectors[*s.TargetSelector] = s.Timestamp
+		}
+	}
+
+	recorded := 0
+	for _, page := range pages {
+		for sig, occurredAt := range page.signatures() {
+			if err := c.issueRepo.RecordOccurrence(ctx, sig.toIssue(), page.sessionID, occurredAt); err != nil {
+				log.Printf("[Clusterer] Error recording occurrence for session %s: %v", page.sessionID, err)
+				continue
+			}
+			recorded++
+		}
+		for _, sig := range page.superseded() {
+			if err := c.issueRepo.RemoveOccurrence(ctx, sig.fingerprint(), page.sessionID); err != nil {
+				log.Printf("[Clusterer] Error removing superseded occurrence for session %s: %v", page.sessionID, err)
+			}
+		}
+	}
+
+	c.lastRun = until
+
+	if recorded > 0 {
+		log.Printf("[Clusterer] Recorded %d issue occurrences from %d signals", recorded, len(signals))
+	}
+}
+
+// signatures combines every error with every rage-clicked selector on the page.
+// A page with only errors or only rage clicks yields one signature per signal.
+func (p *sessionPage) signatures() map[signature]time.Time {
+	result := make(map[signature]time.Time)
+
+	errors := p.errors
+	if len(errors) == 0 {
+		errors = map[string]time.Time{"": {}}
+	}
+	selectors := p.selectors
+	if len(selectors) == 0 {
+		selectors = map[string]time.Time{"": {}}
+	}
+
+	for message, errorAt := range errors {
+		for selector, clickAt := range selectors {
+			occurredAt := errorAt
+			if clickAt.After(occurredAt) {
+				occurredAt = clickAt
+			}
+			result[signature{errorMessage: message, pageURL: p.pageURL, selector: selector}] = occurredAt
+		}
+	}
+
+	return result
+}
+
+// superseded returns the error-only and click-only signatures a page with both errors
+// and rage clicks no longer yields, which an earlier pass may have recorded before
+// the page's other signals arrived
+func (p *sessionPage) superseded() []signature {
+	if len(p.errors) == 0 || len(p.selectors) == 0 {
+		return nil
+	}
+
+	var result []signature
+	for message := range p.errors {
+		result = append(result, signature{errorMessage: message, pageURL: p.pageURL})
+	}
+	for selector := range p.selectors {
+		result = append(result, signature{pageURL: p.pageURL, selector: selector})
+	}
+	return result
+}
+
+func (s signature) fingerprint() string {
+	sum := sha256.Sum256([]byte(s.errorMessage + "\x00" + s.pageURL + "\x00" + s.selector))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s signature) toIssue() *models.Issue {
+	issue := &models.Issue{
+		Fingerprint: s.fingerprint(),
+		PageURL:     s.pageURL,
+	}
+	if s.errorMessage != "" {
+		issue.ErrorMessage = &s.errorMessage
+	}
+	if s.selector != "" {
+		issue.TargetSelector = &s.selector
+	}
+	return issue
+}
+
+// normalizeMessage strips volatile parts (numbers, whitespace) from an error message
+// so that e.g. "timeout after 3012ms" and "timeout after 2990ms" cluster together
+func normalizeMessage(message *string) string {
+	if message == nil {
+		return ""
+	}
+	normalized := numberPattern.ReplaceAllString(*message, "N")
+	return strings.Join(strings.Fields(normalized), " ")
+}
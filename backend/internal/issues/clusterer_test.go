@@ -0,0 +1,39 @@
+package issues
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionPageSupersedesPartialSignatures(t *testing.T) {
+	errorAt := time.Now()
+	clickAt := errorAt.Add(time.Second)
+	page := &sessionPage{
+		pageURL:   "https://example.com/checkout",
+		errors:    map[string]time.Time{"payment failed": errorAt},
+		selectors: map[string]time.Time{},
+	}
+
+	// With only the error so far the page yields the error-only signature
+	errorOnly := signature{errorMessage: "payment failed", pageURL: page.pageURL}
+	if _, ok := page.signatures()[errorOnly]; !ok || len(page.superseded()) != 0 {
+		t.Fatalf("error-only page: signatures = %v, superseded = %v", page.signatures(), page.superseded())
+	}
+
+	// Once the rage click arrives the combined signature replaces both partial ones
+	page.selectors["#pay"] = clickAt
+	combined := signature{errorMessage: "payment failed", pageURL: page.pageURL, selector: "#pay"}
+	sigs := page.signatures()
+	if len(sigs) != 1 || !sigs[combined].Equal(clickAt) {
+		t.Errorf("signatures = %v, want only %v at the click", sigs, combined)
+	}
+
+	superseded := map[signature]bool{}
+	for _, sig := range page.superseded() {
+		superseded[sig] = true
+	}
+	clickOnly := signature{pageURL: page.pageURL, selector: "#pay"}
+	if len(superseded) != 2 || !superseded[errorOnly] || !superseded[clickOnly] {
+		t.Errorf("superseded = %v, want %v and %v", page.superseded(), errorOnly, clickOnly)
+	}
+}
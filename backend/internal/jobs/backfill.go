@@ -0,0 +1,63 @@
+// Package jobs implements the handlers of generic background job types.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/migration"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/queue"
+)
+
+// TypeBackfill runs a registered data backfill in throttled batches
+const TypeBackfill = "backfill"
+
+// BackfillPayload selects the backfill and its batching. Throttle is a Go duration.
+type BackfillPayload struct {
+	Name      string `json:"name"`
+	BatchSize int    `json:"batch_size,omitempty"`
+	Throttle  string `json:"throttle,omitempty"`
+}
+
+// BackfillResult is stored as the result of a completed backfill job
+type BackfillResult struct {
+	RowsUpdated int64 `json:"rows_updated"`
+}
+
+// Backfill returns the handler for backfill jobs against databaseURL. Progress is the
+// number of rows updated so far; a retried job resumes where the last attempt stopped
+// because backfill statements skip rows they already updated.
+func Backfill(databaseURL string) queue.JobHandler {
+	return func(ctx context.Context, job *models.Job, progress queue.JobProgressFunc) (interface{}, error) {
+		var payload BackfillPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return nil, fmt.Errorf("invalid backfill payload: %w", err)
+		}
+
+		backfill, ok := migration.Backfills[payload.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown backfill %q", payload.Name)
+		}
+
+		config := migration.BackfillConfig{
+			BatchSize: payload.BatchSize,
+			OnBatch:   func(total int64) { progress(total, nil) },
+		}
+		if payload.Throttle != "" {
+			throttle, err := time.ParseDuration(payload.Throttle)
+			if err != nil {
+				return nil, fmt.Errorf("invalid backfill throttle: %w", err)
+			}
+			config.Throttle = throttle
+		}
+
+		rows, err := migration.RunBackfill(ctx, databaseURL, backfill, config)
+		if err != nil {
+			return nil, err
+		}
+		return BackfillResult{RowsUpdated: rows}, nil
+	}
+}
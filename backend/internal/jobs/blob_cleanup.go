@@ -0,0 +1,152 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/queue"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/storage"
+)
+
+// TypeBlobCleanup finds and deletes screenshot objects in blob storage that no
+// screenshot row references
+const TypeBlobCleanup = "blob_cleanup"
+
+// Defaults of a blob cleanup: listed keys are looked up batchSize at a time, and
+// objects younger than minAge are left alone because their row may not be committed
+// yet
+const (
+	defaultBlobBatchSize = 500
+	defaultBlobMinAge    = time.Hour
+	maxReportedBlobKeys  = 100
+)
+
+// BlobCleanupPayload configures a blob cleanup. With DryRun orphaned objects are only
+// reported. MinAge and Throttle are Go durations; Throttle is slept between batches.
+type BlobCleanupPayload struct {
+	DryRun    bool   `json:"dry_run"`
+	BatchSize int    `json:"batch_size,omitempty"`
+	MinAge    string `json:"min_age,omitempty"`
+	Throttle  string `json:"throttle,omitempty"`
+}
+
+// BlobCleanupResult is the report stored as the result of a completed cleanup. Keys
+// lists the first orphaned keys found.
+type BlobCleanupResult struct {
+	DryRun        bool     `json:"dry_run"`
+	Scanned       int64    `json:"scanned"`
+	Orphaned      int64    `json:"orphaned"`
+	OrphanedBytes int64    `json:"orphaned_bytes"`
+	Deleted       int64    `json:"deleted"`
+	Keys          []string `json:"keys"`
+}
+
+// BlobCleanup returns the handler for blob cleanup jobs. Foreign keys cascade the
+// deletes of screenshot rows but cannot reach their objects, so rows removed with
+// their session, or objects stored before an insert failed, leave objects behind.
+// The handler lists the store's screenshot objects and checks them against the
+// screenshots table a batch at a time. Progress is the number of objects listed; a
+// retried job lists again and finds what is left.
+func BlobCleanup(screenshotRepo *repository.ScreenshotRepository, store storage.Store) queue.JobHandler {
+	return func(ctx context.Context, job *models.Job, progress queue.JobProgressFunc) (interface{}, error) {
+		var payload BlobCleanupPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return nil, fmt.Errorf("invalid blob cleanup payload: %w", err)
+		}
+		batchSize := payload.BatchSize
+		if batchSize <= 0 {
+			batchSize = defaultBlobBatchSize
+		}
+		minAge := defaultBlobMinAge
+		if payload.MinAge != "" {
+			var err error
+			if minAge, err = time.ParseDuration(payload.MinAge); err != nil {
+				return nil, fmt.Errorf("invalid blob cleanup min_age: %w", err)
+			}
+		}
+		var throttle time.Duration
+		if payload.Throttle != "" {
+			var err error
+			if throttle, err = time.ParseDuration(payload.Throttle); err != nil {
+				return nil, fmt.Errorf("invalid blob cleanup throttle: %w", err)
+			}
+		}
+
+		lister, ok := store.(storage.Lister)
+		if !ok {
+			return nil, errors.New("blob storage is not configured or cannot list objects")
+		}
+
+		result := BlobCleanupResult{DryRun: payload.DryRun, Keys: []string{}}
+		sizes := make(map[string]int64, batchSize)
+		cutoff := time.Now().Add(-minAge)
+
+		// check looks up the batch of listed objects and deletes the unreferenced ones
+		check := func() error {
+			keys := make([]string, 0, len(sizes))
+			for key := range sizes {
+				keys = append(keys, key)
+			}
+			orphaned, err := screenshotRepo.UnreferencedStorageKeys(ctx, keys)
+			if err != nil {
+				return err
+			}
+
+			for _, key := range orphaned {
+				result.Orphaned++
+				result.OrphanedBytes += sizes[key]
+				if len(result.Keys) < maxReportedBlobKeys {
+					result.Keys = append(result.Keys, key)
+				}
+				if payload.DryRun {
+					continue
+				}
+				if err := store.Delete(ctx, key); err != nil {
+					return fmt.Errorf("failed to delete orphaned blob %s: %w", key, err)
+				}
+				result.Deleted++
+			}
+			clear(sizes)
+			progress(result.Scanned, nil)
+
+			if throttle > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(throttle):
+				}
+			}
+			return nil
+		}
+
+		err := lister.List(ctx, repository.ScreenshotKeyPrefix, func(object storage.ObjectInfo) error {
+			result.Scanned++
+			if object.ModifiedAt.After(cutoff) {
+				return nil
+			}
+			sizes[object.Key] = object.Size
+			if len(sizes) < batchSize {
+				return nil
+			}
+			return check()
+		})
+		if err == nil && len(sizes) > 0 {
+			err = check()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Orphaned > 0 {
+			log.Printf("[Integrity] %d of %d screenshot objects have no row (%d bytes), %d deleted (dry run: %v)",
+				result.Orphaned, result.Scanned, result.OrphanedBytes, result.Deleted, payload.DryRun)
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,153 @@
+// Package liveness tracks whether sessions are still being recorded from when their
+// tabs last sent events and heartbeats. ended_at alone cannot tell: it is only set
+// when the tracker gets to end the session on unload, and a tab that crashed or lost
+// its connection never does.
+package liveness
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	keyPrefix = "session:live:"
+	// keyTTL bounds how long an abandoned session's times are kept; older sessions
+	// fall back to their last_activity_at
+	keyTTL = 24 * time.Hour
+
+	fieldEvent     = "event"
+	fieldHeartbeat = "heartbeat"
+)
+
+// Tracker keeps the time each session last sent events and heartbeats in a Redis
+// hash. A session is live while either is more recent than the timeout. A nil
+// *Tracker records nothing.
+type Tracker struct {
+	redis   *redis.Client
+	timeout time.Duration
+}
+
+// NewTracker creates a tracker backed by client. timeout should leave room for a few
+// missed heartbeats, as browsers throttle timers in background tabs.
+func NewTracker(client *redis.Client, timeout time.Duration) *Tracker {
+	return &Tracker{redis: client, timeout: timeout}
+}
+
+// Timeout is how long after its last event or heartbeat a session counts as live
+func (t *Tracker) Timeout() time.Duration {
+	return t.timeout
+}
+
+func key(sessionID uuid.UUID) string {
+	return keyPrefix + sessionID.String()
+}
+
+// Event records that events of sessionID were received now. Failures are logged
+// only: liveness must never fail ingestion.
+func (t *Tracker) Event(ctx context.Context, sessionID uuid.UUID) {
+	if t == nil {
+		return
+	}
+	if err := t.touch(ctx, sessionID, fieldEvent); err != nil {
+		log.Printf("[Liveness] Failed to record events of session %s: %v", sessionID, err)
+	}
+}
+
+// Heartbeat records that a tab of sessionID is still open
+func (t *Tracker) Heartbeat(ctx context.Context, sessionID uuid.UUID) error {
+	return t.touch(ctx, sessionID, fieldHeartbeat)
+}
+
+func (t *Tracker) touch(ctx context.Context, sessionID uuid.UUID, field string) error {
+	pipe := t.redis.Pipeline()
+	pipe.HSet(ctx, key(sessionID), field, time.Now().UnixMilli())
+	pipe.Expire(ctx, key(sessionID), keyTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record session %s: %w", field, err)
+	}
+	return nil
+}
+
+// Get returns the liveness of session
+func (t *Tracker) Get(ctx context.Context, session *models.Session) (*models.SessionLiveness, error) {
+	liveness, err := t.GetMany(ctx, []*models.Session{session})
+	if err != nil {
+		return nil, err
+	}
+	return liveness[session.SessionID], nil
+}
+
+// GetMany returns the liveness of each of sessions, keyed by session ID, in one round
+// trip
+func (t *Tracker) GetMany(ctx context.Context, sessions []*models.Session) (map[uuid.UUID]*models.SessionLiveness, error) {
+	pipe := t.redis.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(sessions))
+	for i, session := range sessions {
+		cmds[i] = pipe.HMGet(ctx, key(session.SessionID), fieldEvent, fieldHeartbeat)
+	}
+	if len(sessions) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, fmt.Errorf("failed to get session liveness: %w", err)
+		}
+	}
+
+	now := time.Now()
+	result := make(map[uuid.UUID]*models.SessionLiveness, len(sessions))
+	for i, session := range sessions {
+		values := cmds[i].Val()
+		result[session.SessionID] = t.evaluate(session, millis(values[0]), millis(values[1]), now)
+	}
+	return result, nil
+}
+
+// evaluate derives a session's liveness at now. Heartbeats win over ended_at: a
+// session resumed in another tab keeps recording after the first tab ended it.
+func (t *Tracker) evaluate(session *models.Session, lastEvent, lastHeartbeat *time.Time, now time.Time) *models.SessionLiveness {
+	if !session.LastActivityAt.IsZero() && (lastEvent == nil || session.LastActivityAt.After(*lastEvent)) {
+		activity := session.LastActivityAt
+		lastEvent = &activity
+	}
+
+	liveness := &models.SessionLiveness{
+		SessionID:       session.SessionID,
+		Status:          models.LivenessEnded,
+		LastEventAt:     lastEvent,
+		LastHeartbeatAt: lastHeartbeat,
+		Heartbeating:    lastHeartbeat != nil && now.Sub(*lastHeartbeat) <= t.timeout,
+		CheckedAt:       now,
+	}
+	if lastEvent != nil {
+		ago := now.Sub(*lastEvent).Seconds()
+		if ago < 0 {
+			ago = 0
+		}
+		liveness.LastEventSecondsAgo = &ago
+	}
+
+	recentEvent := lastEvent != nil && now.Sub(*lastEvent) <= t.timeout
+	if liveness.Heartbeating || (recentEvent && session.EndedAt == nil) {
+		liveness.Status = models.LivenessLive
+	}
+	return liveness
+}
+
+// millis parses a time stored as Unix milliseconds; it returns nil for a missing field
+func millis(value interface{}) *time.Time {
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil
+	}
+	at := time.UnixMilli(ms)
+	return &at
+}
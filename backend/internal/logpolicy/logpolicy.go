@@ -0,0 +1,77 @@
+// Package logpolicy decides whether and how request bodies appear in logs. Ingest
+// bodies carry what visitors typed, so by default they are not logged at all.
+package logpolicy
+
+import (
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/ngocp/user-tracker/internal/redact"
+)
+
+// Body logging modes
+const (
+	BodyOff      = "off"
+	BodyRedacted = "redacted"
+	BodyFull     = "full"
+)
+
+// Policy controls request body logging. A nil *Policy logs no bodies.
+type Policy struct {
+	mode     string
+	percent  int
+	maxBytes int
+}
+
+// New creates a policy that logs percent (0-100) of request bodies in mode, truncated
+// to maxBytes (0 for no limit). It returns nil when mode is BodyOff or percent is not
+// positive.
+func New(mode string, percent int, maxBytes int) (*Policy, error) {
+	switch mode {
+	case BodyOff, "":
+		return nil, nil
+	case BodyRedacted, BodyFull:
+	default:
+		return nil, fmt.Errorf("unknown body logging mode %q (use off, redacted or full)", mode)
+	}
+	if percent <= 0 {
+		return nil, nil
+	}
+	return &Policy{
+		mode:     mode,
+		percent:  min(percent, 100),
+		maxBytes: maxBytes,
+	}, nil
+}
+
+// Mode returns the body logging mode
+func (p *Policy) Mode() string {
+	if p == nil {
+		return BodyOff
+	}
+	return p.mode
+}
+
+// Body returns body as it may be logged, or false when this request's body is not to
+// be logged. In redacted mode a body that is not valid JSON is summarized by its size
+// only, since it cannot be masked.
+func (p *Policy) Body(body []byte) (string, bool) {
+	if p == nil || len(body) == 0 {
+		return "", false
+	}
+	if p.percent < 100 && rand.IntN(100) >= p.percent {
+		return "", false
+	}
+
+	if p.mode == BodyRedacted {
+		masked, err := redact.Body(body)
+		if err != nil {
+			return fmt.Sprintf("<%d bytes, not JSON>", len(body)), true
+		}
+		body = masked
+	}
+	if p.maxBytes > 0 && len(body) > p.maxBytes {
+		return string(body[:p.maxBytes]) + "...", true
+	}
+	return string(body), true
+}
@@ -0,0 +1,86 @@
+package malware
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is the INSTREAM chunk size; clamd's StreamMaxLength still bounds the
+// total upload
+const clamdChunkSize = 64 * 1024
+
+// ClamAV scans with clamd's INSTREAM command over a unix or TCP socket
+type ClamAV struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+func newClamAV(address string, timeout time.Duration) (*ClamAV, error) {
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "unix" && u.Scheme != "tcp") {
+		return nil, fmt.Errorf("invalid clamd address %q: use unix:///path or tcp://host:port", address)
+	}
+	addr := u.Host
+	if u.Scheme == "unix" {
+		addr = u.Path
+	}
+	return &ClamAV{network: u.Scheme, address: addr, timeout: timeout}, nil
+}
+
+// Scan streams data to clamd and parses its "stream: OK" or "stream: <sig> FOUND" reply
+func (s *ClamAV) Scan(ctx context.Context, data []byte) (Verdict, error) {
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Verdict{}, fmt.Errorf("failed to send clamd command: %w", err)
+	}
+	size := make([]byte, 4)
+	for start := 0; start < len(data); start += clamdChunkSize {
+		chunk := data[start:min(start+clamdChunkSize, len(data))]
+		binary.BigEndian.PutUint32(size, uint32(len(chunk)))
+		if _, err := conn.Write(append(size, chunk...)); err != nil {
+			return Verdict{}, fmt.Errorf("failed to stream upload to clamd: %w", err)
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return Verdict{}, fmt.Errorf("failed to finish clamd stream: %w", err)
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return parseClamdReply(string(bytes.TrimRight(reply, "\x00\n")))
+}
+
+func parseClamdReply(reply string) (Verdict, error) {
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case result == "OK":
+		return Verdict{}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return Verdict{Infected: true, Signature: strings.TrimSuffix(result, " FOUND")}, nil
+	default:
+		return Verdict{}, fmt.Errorf("clamd error: %s", reply)
+	}
+}
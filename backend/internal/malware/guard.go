@@ -0,0 +1,120 @@
+package malware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/storage"
+)
+
+// Stats counts scan outcomes since the process started
+type Stats struct {
+	Scanned     int64 `json:"scanned"`
+	Clean       int64 `json:"clean"`
+	Infected    int64 `json:"infected"`
+	Failed      int64 `json:"failed"`
+	FailedOpen  int64 `json:"failed_open"`
+	Quarantined int64 `json:"quarantined"`
+}
+
+// Guard scans uploads before persistence. Infected uploads are rejected and, when a
+// quarantine store is configured, copied there with a JSON note for review. When the
+// scanner fails, the upload is rejected unless the guard fails open.
+// A nil *Guard accepts everything.
+type Guard struct {
+	scanner    Scanner
+	failOpen   bool
+	quarantine storage.Store
+	prefix     string
+
+	scanned, clean, infected, failed, failedOpen, quarantined atomic.Int64
+}
+
+// NewGuard returns nil when scanner is nil. quarantine may be nil to only reject.
+func NewGuard(scanner Scanner, failOpen bool, quarantine storage.Store, prefix string) *Guard {
+	if scanner == nil {
+		return nil
+	}
+	return &Guard{
+		scanner:    scanner,
+		failOpen:   failOpen,
+		quarantine: quarantine,
+		prefix:     prefix,
+	}
+}
+
+// Check scans data. It returns an error wrapping ErrInfected or ErrScanFailed when the
+// upload must not be stored; source describes the upload in logs and quarantine notes.
+func (g *Guard) Check(ctx context.Context, data []byte, contentType, source string) error {
+	if g == nil {
+		return nil
+	}
+
+	g.scanned.Add(1)
+	verdict, err := g.scanner.Scan(ctx, data)
+	if err != nil {
+		g.failed.Add(1)
+		if g.failOpen {
+			g.failedOpen.Add(1)
+			log.Printf("[Malware] Scan of %s failed, accepting upload (fail open): %v", source, err)
+			return nil
+		}
+		return fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+	if !verdict.Infected {
+		g.clean.Add(1)
+		return nil
+	}
+
+	g.infected.Add(1)
+	log.Printf("[Malware] Rejected %s: %s", source, verdict.Signature)
+	g.quarantineUpload(ctx, data, contentType, source, verdict.Signature)
+	return fmt.Errorf("%w: %s", ErrInfected, verdict.Signature)
+}
+
+// quarantineUpload keeps the rejected bytes and a note for later review. Failures are
+// logged only: the upload is rejected either way.
+func (g *Guard) quarantineUpload(ctx context.Context, data []byte, contentType, source, signature string) {
+	if g.quarantine == nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	key := fmt.Sprintf("%s/%s/%s", g.prefix, now.Format("2006-01-02"), uuid.New())
+	if err := g.quarantine.Put(ctx, key, data, contentType); err != nil {
+		log.Printf("[Malware] Failed to quarantine %s: %v", source, err)
+		return
+	}
+	note, _ := json.Marshal(map[string]interface{}{
+		"source":       source,
+		"signature":    signature,
+		"content_type": contentType,
+		"size":         len(data),
+		"scanned_at":   now,
+	})
+	if err := g.quarantine.Put(ctx, key+".json", note, "application/json"); err != nil {
+		log.Printf("[Malware] Failed to write quarantine note for %s: %v", key, err)
+	}
+	g.quarantined.Add(1)
+	log.Printf("[Malware] Quarantined %s as %s", source, key)
+}
+
+// Stats returns the outcome counters; zero for a nil guard
+func (g *Guard) Stats() Stats {
+	if g == nil {
+		return Stats{}
+	}
+	return Stats{
+		Scanned:     g.scanned.Load(),
+		Clean:       g.clean.Load(),
+		Infected:    g.infected.Load(),
+		Failed:      g.failed.Load(),
+		FailedOpen:  g.failedOpen.Load(),
+		Quarantined: g.quarantined.Load(),
+	}
+}
@@ -0,0 +1,62 @@
+package malware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPScanner POSTs the upload as application/octet-stream to a scanning API that
+// answers {"infected": bool, "signature": "..."}
+type HTTPScanner struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func newHTTPScanner(address, apiKey string, timeout time.Duration) (*HTTPScanner, error) {
+	if u, err := url.Parse(address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid scanning API URL %q", address)
+	}
+	return &HTTPScanner{
+		url:    address,
+		apiKey: apiKey,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (s *HTTPScanner) Scan(ctx context.Context, data []byte) (Verdict, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to create scan request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to call scanning API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return Verdict{}, fmt.Errorf("scanning API returned %d: %s", resp.StatusCode, body)
+	}
+
+	var result struct {
+		Infected  bool   `json:"infected"`
+		Signature string `json:"signature"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Verdict{}, fmt.Errorf("failed to decode scanning API response: %w", err)
+	}
+	return Verdict{Infected: result.Infected, Signature: result.Signature}, nil
+}
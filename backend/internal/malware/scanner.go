@@ -0,0 +1,61 @@
+// Package malware scans user-supplied uploads (screenshots, and later DOM snapshots)
+// with ClamAV or an external scanning API before they are persisted.
+package malware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Scanner backends
+const (
+	BackendClamAV = "clamav"
+	BackendHTTP   = "http"
+)
+
+var (
+	// ErrInfected is wrapped with the signature name when an upload is malicious
+	ErrInfected = errors.New("upload rejected by malware scan")
+	// ErrScanFailed is returned when the scanner could not give a verdict and the
+	// guard fails closed
+	ErrScanFailed = errors.New("malware scan failed")
+)
+
+// Verdict is a scanner's result for one upload
+type Verdict struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner inspects upload bytes
+type Scanner interface {
+	Scan(ctx context.Context, data []byte) (Verdict, error)
+}
+
+// Config selects and configures a scanner backend
+type Config struct {
+	// Backend is "clamav" or "http"; empty disables scanning
+	Backend string
+	// Address is the clamd socket ("unix:///run/clamav/clamd.ctl" or "tcp://host:3310")
+	// or the scanning API URL
+	Address string
+	// APIKey is sent as a bearer token to the scanning API
+	APIKey  string
+	Timeout time.Duration
+}
+
+// NewScanner creates the configured scanner, or nil when scanning is disabled
+func NewScanner(cfg Config) (Scanner, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case BackendClamAV:
+		return newClamAV(cfg.Address, cfg.Timeout)
+	case BackendHTTP:
+		return newHTTPScanner(cfg.Address, cfg.APIKey, cfg.Timeout)
+	default:
+		return nil, fmt.Errorf("unknown malware scanner backend %q", cfg.Backend)
+	}
+}
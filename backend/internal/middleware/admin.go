@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/visibility"
+)
+
+// AdminToken guards operator-only routes with a static bearer token.
+// With an empty token the routes are disabled entirely.
+func AdminToken(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token == "" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Admin API is disabled",
+			})
+		}
+
+		provided := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid admin token",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+const roleLocalsKey = "role"
+
+// APIKeyAuthenticator resolves an API key to its record, nil for unknown or revoked keys
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, secret string) (*models.APIKey, error)
+}
+
+// Role resolves the caller's visibility role from the bearer token: the admin token
+// grants admin, the viewer token or a read-scoped API key viewer, and anything else
+// defaultRole. Handlers read it with RoleFromContext.
+func Role(adminToken, viewerToken string, apiKeys APIKeyAuthenticator, defaultRole visibility.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role := defaultRole
+		provided := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		switch {
+		case provided == "":
+		case adminToken != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(adminToken)) == 1:
+			role = visibility.RoleAdmin
+		case viewerToken != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(viewerToken)) == 1:
+			role = visibility.RoleViewer
+		case apiKeys != nil && models.IsAPIKey(provided):
+			key, err := apiKeys.Authenticate(c.UserContext(), provided)
+			if err != nil {
+				log.Printf("[Role] Failed to check API key: %v", err)
+			} else if key != nil && key.Scope == models.APIKeyScopeRead {
+				role = visibility.RoleViewer
+			}
+		}
+
+		c.Locals(roleLocalsKey, role)
+		return c.Next()
+	}
+}
+
+// RoleFromContext returns the role resolved by the Role middleware, or RoleViewer
+func RoleFromContext(c *fiber.Ctx) visibility.Role {
+	if role, ok := c.Locals(roleLocalsKey).(visibility.Role); ok {
+		return role
+	}
+	return visibility.RoleViewer
+}
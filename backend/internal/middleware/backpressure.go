@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DepthGauge reports the ingest queue depth, its limit and whether it is over it
+type DepthGauge interface {
+	Exceeded() (depth, maxDepth int64, over bool)
+}
+
+// RejectWhenBackedUp answers 429 with a Retry-After header while the queue is deeper
+// than its limit, so SDKs hold their batches and send them once the processor has
+// caught up instead of losing them to stream trimming. The body carries the depth and
+// limit for tuning SDK retry delays.
+func RejectWhenBackedUp(gauge DepthGauge, retryAfter time.Duration) fiber.Handler {
+	seconds := strconv.Itoa(int((retryAfter + time.Second - 1) / time.Second))
+	return func(c *fiber.Ctx) error {
+		depth, maxDepth, over := gauge.Exceeded()
+		if !over {
+			return c.Next()
+		}
+
+		c.Set(fiber.HeaderRetryAfter, seconds)
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":       "Event queue is backed up",
+			"details":     "Retry after the Retry-After delay",
+			"queue_depth": depth,
+			"max_depth":   maxDepth,
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CancelOnDisconnect gives GET requests a user context (c.UserContext()) that is
+// cancelled when the client closes the connection or after timeout, so abandoned
+// dashboard queries stop consuming database time. The connection is checked every
+// pollInterval. Other methods are left alone: ingest writes should finish even if
+// the SDK gives up waiting.
+func CancelOnDisconnect(timeout, pollInterval time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet {
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithCancel(c.UserContext())
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(c.UserContext(), timeout)
+		}
+		defer cancel()
+
+		if conn := c.Context().Conn(); conn != nil && pollInterval > 0 {
+			go watchDisconnect(ctx, cancel, conn, pollInterval)
+		}
+
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
+
+// watchDisconnect cancels once conn is closed by the peer, until ctx is done
+func watchDisconnect(ctx context.Context, cancel context.CancelFunc, conn net.Conn, pollInterval time.Duration) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if peerClosed(conn) {
+				cancel()
+				return
+			}
+		}
+	}
+}
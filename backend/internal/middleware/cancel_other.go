@@ -0,0 +1,11 @@
+//go:build !unix
+
+package middleware
+
+import "net"
+
+// peerClosed cannot peek at sockets on this platform; requests are then only
+// cancelled by their timeout
+func peerClosed(conn net.Conn) bool {
+	return false
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package middleware
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// peerClosed peeks at the socket without consuming data: a zero-byte read means the
+// client closed the connection. Pipelined request bytes are left in place.
+func peerClosed(conn net.Conn) bool {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+
+	closed := false
+	raw.Read(func(fd uintptr) bool {
+		var buf [1]byte
+		n, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		switch {
+		case err == nil:
+			closed = n == 0
+		case errors.Is(err, syscall.EAGAIN), errors.Is(err, syscall.EWOULDBLOCK), errors.Is(err, syscall.EINTR):
+		default:
+			closed = true
+		}
+		// Report done so the runtime poller never blocks waiting for data
+		return true
+	})
+	return closed
+}
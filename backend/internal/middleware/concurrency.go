@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const concurrencySlotLocalsKey = "concurrency_slot"
+
+// ConcurrencyConfig configures ConcurrencyLimit. Requests wait up to Wait for one of
+// Limit slots before being rejected with 503. Filter reports whether a request needs a
+// slot; nil limits every request.
+type ConcurrencyConfig struct {
+	Name   string
+	Limit  int
+	Wait   time.Duration
+	Filter func(c *fiber.Ctx) bool
+}
+
+// concurrencySlot is the slot a request holds; release is safe to call more than once
+type concurrencySlot struct {
+	release func()
+	held    bool
+}
+
+// ConcurrencyLimit bounds the in-flight requests of heavy endpoints so they cannot
+// exhaust the database connections ingestion needs. Routes sharing the returned
+// handler share its slots. A limit <= 0 disables it.
+func ConcurrencyLimit(config ConcurrencyConfig) fiber.Handler {
+	if config.Limit <= 0 {
+		return func(c *fiber.Ctx) error { return c.Next() }
+	}
+
+	slots := make(chan struct{}, config.Limit)
+	retryAfter := strconv.Itoa(max(int(config.Wait/time.Second), 1))
+
+	return func(c *fiber.Ctx) error {
+		if config.Filter != nil && !config.Filter(c) {
+			return c.Next()
+		}
+
+		if !acquireSlot(slots, config.Wait) {
+			log.Printf("Concurrency limit of %d reached for %s, rejecting %s", config.Limit, config.Name, c.Path())
+			c.Set(fiber.HeaderRetryAfter, retryAfter)
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error":   "Too many concurrent requests",
+				"details": "Limit of " + strconv.Itoa(config.Limit) + " concurrent " + config.Name + " requests reached",
+			})
+		}
+
+		var once sync.Once
+		slot := &concurrencySlot{release: func() { once.Do(func() { <-slots }) }}
+		c.Locals(concurrencySlotLocalsKey, slot)
+
+		err := c.Next()
+		if !slot.held {
+			slot.release()
+		}
+		return err
+	}
+}
+
+func acquireSlot(slots chan struct{}, wait time.Duration) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// HoldConcurrencySlot keeps the request's ConcurrencyLimit slot after the handler
+// returns, for handlers that stream their body; the caller must call release when
+// the stream ends. Without a slot it returns a no-op.
+func HoldConcurrencySlot(c *fiber.Ctx) (release func()) {
+	slot, ok := c.Locals(concurrencySlotLocalsKey).(*concurrencySlot)
+	if !ok {
+		return func() {}
+	}
+	slot.held = true
+	return slot.release
+}
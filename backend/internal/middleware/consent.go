@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/consent"
+)
+
+// ConsentHeader carries the visitor's TCF v2 or GPP consent string
+const ConsentHeader = "X-Tracker-Consent"
+
+const (
+	consentLocalsKey       = "consent"
+	consentStringLocalsKey = "consent_string"
+)
+
+// Consent decodes the consent string from the X-Tracker-Consent header, falling back
+// to a "consent" field in the JSON body, and stores the resulting policy for handlers
+// to apply per event. Requests without one get consent.Granted unless required.
+func Consent(required bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		raw := c.Get(ConsentHeader)
+		if raw == "" {
+			var body struct {
+				Consent string `json:"consent"`
+			}
+			if json.Unmarshal(c.Body(), &body) == nil {
+				raw = body.Consent
+			}
+		}
+
+		if raw == "" {
+			if required {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":   "Consent string is required",
+					"details": "Send the TCF or GPP consent string in the " + ConsentHeader + " header",
+				})
+			}
+			return c.Next()
+		}
+
+		policy, err := consent.Parse(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid consent string",
+				"details": err.Error(),
+			})
+		}
+
+		c.Locals(consentLocalsKey, policy)
+		c.Locals(consentStringLocalsKey, raw)
+		return c.Next()
+	}
+}
+
+// ConsentFromContext returns the policy decoded by the Consent middleware and the raw
+// consent string. Without one it returns consent.Granted and "".
+func ConsentFromContext(c *fiber.Ctx) (consent.Policy, string) {
+	policy, ok := c.Locals(consentLocalsKey).(consent.Policy)
+	if !ok {
+		return consent.Granted, ""
+	}
+	raw, _ := c.Locals(consentStringLocalsKey).(string)
+	return policy, raw
+}
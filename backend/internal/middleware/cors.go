@@ -17,7 +17,8 @@ func CORS(origins string) fiber.Handler {
 	config := cors.Config{
 		AllowOrigins:     allowOrigins,
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,X-Tracker-SDK,X-Tracker-Token,X-Request-ID",
+		ExposeHeaders:    "X-Total-Count,X-Total-Estimated,X-Request-ID",
 		AllowCredentials: false,
 		MaxAge:           86400,
 	}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/drain"
+)
+
+// RejectWhenDraining answers 503 with a Retry-After header once the instance is
+// draining, so SDKs resend to another instance behind the load balancer.
+func RejectWhenDraining(state *drain.State, retryAfter time.Duration) fiber.Handler {
+	seconds := strconv.Itoa(int((retryAfter + time.Second - 1) / time.Second))
+	return func(c *fiber.Ctx) error {
+		if !state.Draining() {
+			return c.Next()
+		}
+
+		c.Set(fiber.HeaderRetryAfter, seconds)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error":   "Server is draining",
+			"details": "Retry against another instance",
+		})
+	}
+}
@@ -9,7 +9,7 @@ import (
 
 func Logger() fiber.Handler {
 	return logger.New(logger.Config{
-		Format:     "[${time}] ${status} - ${latency} ${method} ${path}\n",
+		Format:     "[${time}] ${status} - ${latency} ${method} ${path} ${locals:requestid}\n",
 		TimeFormat: time.RFC3339,
 		TimeZone:   "Local",
 	})
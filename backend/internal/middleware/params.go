@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// UUIDParam validates that the named path param is a UUID and stores the parsed
+// value in the request context, so handlers can read it with ParamUUID.
+// label names the resource in the error message, e.g. "session ID".
+func UUIDParam(name, label string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := uuid.Parse(c.Params(name))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid " + label,
+				"details": "Expected UUID format, got: " + c.Params(name),
+			})
+		}
+
+		c.Locals(localsKey(name), id)
+		return c.Next()
+	}
+}
+
+// ParamUUID returns the UUID parsed by UUIDParam for the named path param
+func ParamUUID(c *fiber.Ctx, name string) uuid.UUID {
+	id, _ := c.Locals(localsKey(name)).(uuid.UUID)
+	return id
+}
+
+func localsKey(name string) string {
+	return "param:" + name
+}
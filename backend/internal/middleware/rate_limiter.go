@@ -7,17 +7,22 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 )
 
-func RateLimiter(max int, duration time.Duration) fiber.Handler {
+// RateLimiter allows max requests per client IP within duration. Requests over the
+// limit get 429, or are passed to limitReached when it is not nil.
+func RateLimiter(max int, duration time.Duration, limitReached fiber.Handler) fiber.Handler {
+	if limitReached == nil {
+		limitReached = func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Rate limit exceeded. Please try again later.",
+			})
+		}
+	}
 	return limiter.New(limiter.Config{
 		Max:        max,
 		Expiration: duration,
 		KeyGenerator: func(c *fiber.Ctx) string {
 			return c.IP()
 		},
-		LimitReached: func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "Rate limit exceeded. Please try again later.",
-			})
-		},
+		LimitReached: limitReached,
 	})
 }
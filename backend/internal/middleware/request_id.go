@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/ngocp/user-tracker/internal/requestid"
+)
+
+const requestIDLocalsKey = "requestid"
+
+// RequestID assigns every request a correlation ID: the X-Request-ID header set by the
+// client or a proxy when it is well-formed, a new UUID otherwise. The ID is echoed in
+// the response header and carried by c.UserContext(), so it reaches queued messages
+// and the worker logs of their processing.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		c.Set(requestid.Header, id)
+		c.Locals(requestIDLocalsKey, id)
+		c.SetUserContext(requestid.NewContext(c.UserContext(), id))
+		return c.Next()
+	}
+}
+
+// RequestIDFromContext returns the ID assigned by the RequestID middleware, or ""
+func RequestIDFromContext(c *fiber.Ctx) string {
+	id, _ := c.Locals(requestIDLocalsKey).(string)
+	return id
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"encoding/json"
+	"regexp"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SDKHeader identifies the client SDK as "<name>/<version>", e.g. "tracker-js/1.0.0"
+const SDKHeader = "X-Tracker-SDK"
+
+const sdkLocalsKey = "sdk"
+
+var sdkPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,50}/[A-Za-z0-9.+_-]{1,40}$`)
+
+// SDK captures the client SDK identifier from the X-Tracker-SDK header, falling back
+// to an "sdk" field in the JSON body for transports that cannot set headers
+// (e.g. navigator.sendBeacon). When required, requests without one are rejected.
+func SDK(required bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		sdk := c.Get(SDKHeader)
+		if sdk == "" {
+			var body struct {
+				SDK string `json:"sdk"`
+			}
+			if json.Unmarshal(c.Body(), &body) == nil {
+				sdk = body.SDK
+			}
+		}
+
+		if sdk == "" {
+			if required {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":   "SDK identifier is required",
+					"details": "Send the " + SDKHeader + " header as <name>/<version>",
+				})
+			}
+			return c.Next()
+		}
+
+		if !sdkPattern.MatchString(sdk) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid SDK identifier",
+				"details": "Expected <name>/<version>, got: " + sdk,
+			})
+		}
+
+		c.Locals(sdkLocalsKey, sdk)
+		return c.Next()
+	}
+}
+
+// SDKFromContext returns the SDK identifier captured by the SDK middleware, or ""
+func SDKFromContext(c *fiber.Ctx) string {
+	sdk, _ := c.Locals(sdkLocalsKey).(string)
+	return sdk
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/accesstoken"
+	"github.com/ngocp/user-tracker/internal/visibility"
+)
+
+// AccessTokenQuery carries a scoped access token where headers cannot be set, e.g. in
+// an <img> src or an iframe share link
+const AccessTokenQuery = "access_token"
+
+const sessionScopeLocalsKey = "session_scope"
+
+// SessionScope verifies a scoped access token ("st_..." bearer token or ?access_token=)
+// on session read routes. The token must grant session:read for the session in the
+// named UUID path param; with an empty param the handler checks the scope itself via
+// SessionScopeFromContext. Token holders always get the viewer role. Requests without
+// a scoped token pass through unchanged.
+func SessionScope(signer *accesstoken.Signer, param string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Query(AccessTokenQuery)
+		if bearer := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); accesstoken.IsToken(bearer) {
+			token = bearer
+		}
+		if token == "" {
+			return c.Next()
+		}
+
+		if signer == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Access tokens are disabled",
+			})
+		}
+		claims, err := signer.Verify(token, time.Now())
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   "Invalid access token",
+				"details": err.Error(),
+			})
+		}
+
+		sessionID, ok := claims.SessionRead()
+		if !ok || (param != "" && ParamUUID(c, param) != sessionID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Access token does not grant access to this session",
+			})
+		}
+
+		c.Locals(roleLocalsKey, visibility.RoleViewer)
+		c.Locals(sessionScopeLocalsKey, sessionID)
+		return c.Next()
+	}
+}
+
+// SessionScopeFromContext returns the session a verified scoped access token is
+// limited to, if the request carried one
+func SessionScopeFromContext(c *fiber.Ctx) (uuid.UUID, bool) {
+	sessionID, ok := c.Locals(sessionScopeLocalsKey).(uuid.UUID)
+	return sessionID, ok
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/trackertoken"
+)
+
+// TrackerTokenHeader carries the short-lived token from POST /track/token
+const TrackerTokenHeader = "X-Tracker-Token"
+
+const (
+	trackerKeyLocalsKey     = "tracker_key"
+	trackerSandboxLocalsKey = "tracker_sandbox"
+)
+
+// TrackerKeyChecker reports whether a tracker key still accepts tokens issued at
+// issuedAt, i.e. it was neither revoked nor rotated since, and whether a key that
+// passed Accepts is a sandbox key
+type TrackerKeyChecker interface {
+	Accepts(ctx context.Context, keyID uuid.UUID, issuedAt time.Time) (bool, error)
+	Sandbox(keyID uuid.UUID) bool
+}
+
+// TrackerToken verifies the tracker token from the X-Tracker-Token header, falling
+// back to a "tracker_token" field in the JSON body for navigator.sendBeacon. Tokens
+// must be correctly signed, unexpired, sent from the origin they were issued to, and
+// belong to a key that was not revoked or rotated since. When required, requests
+// without a token are rejected; with a nil signer tokens are ignored. Server-side
+// callers may send an ingest-scoped API key as bearer token instead of a token.
+func TrackerToken(signer *trackertoken.Signer, keys TrackerKeyChecker, apiKeys APIKeyAuthenticator, required bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if provided := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); apiKeys != nil && models.IsAPIKey(provided) {
+			return ingestAPIKey(c, apiKeys, provided)
+		}
+		if signer == nil {
+			return c.Next()
+		}
+
+		token := c.Get(TrackerTokenHeader)
+		if token == "" {
+			var body struct {
+				TrackerToken string `json:"tracker_token"`
+			}
+			if json.Unmarshal(c.Body(), &body) == nil {
+				token = body.TrackerToken
+			}
+		}
+
+		if token == "" {
+			if required {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error":   "Tracker token is required",
+					"details": "Exchange the public key at POST /api/v1/track/token and send the token in the " + TrackerTokenHeader + " header",
+				})
+			}
+			return c.Next()
+		}
+
+		claims, err := signer.Verify(token, time.Now())
+		if err != nil {
+			details := "Exchange the public key for a new token"
+			if !errors.Is(err, trackertoken.ErrExpired) && !errors.Is(err, trackertoken.ErrUnknownSecret) {
+				details = err.Error()
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   "Invalid tracker token",
+				"details": details,
+			})
+		}
+
+		if claims.Origin != "" && c.Get(fiber.HeaderOrigin) != claims.Origin {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "Tracker token was issued to another origin",
+				"details": "Expected origin " + claims.Origin,
+			})
+		}
+
+		ok, err := keys.Accepts(c.UserContext(), claims.KeyID, claims.Issued())
+		if err != nil {
+			log.Printf("[TrackerToken] Failed to check tracker key %s: %v", claims.KeyID, err)
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "Failed to verify tracker token",
+			})
+		}
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   "Invalid tracker token",
+				"details": "The tracker key was revoked or rotated",
+			})
+		}
+
+		c.Locals(trackerKeyLocalsKey, claims.KeyID)
+		c.Locals(trackerSandboxLocalsKey, keys.Sandbox(claims.KeyID))
+		return c.Next()
+	}
+}
+
+// ingestAPIKey lets the request through when secret is an unrevoked ingest-scoped key
+func ingestAPIKey(c *fiber.Ctx, apiKeys APIKeyAuthenticator, secret string) error {
+	key, err := apiKeys.Authenticate(c.UserContext(), secret)
+	if err != nil {
+		log.Printf("[TrackerToken] Failed to check API key: %v", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Failed to verify API key",
+		})
+	}
+	if key == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "Invalid API key",
+			"details": "The API key is unknown, revoked or was rotated",
+		})
+	}
+	if key.Scope != models.APIKeyScopeIngest {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "API key may not send events",
+			"details": "Scope: " + key.Scope,
+		})
+	}
+	return c.Next()
+}
+
+// TrackerKeyFromContext returns the tracker key of the verified token, if any
+func TrackerKeyFromContext(c *fiber.Ctx) (uuid.UUID, bool) {
+	keyID, ok := c.Locals(trackerKeyLocalsKey).(uuid.UUID)
+	return keyID, ok
+}
+
+// SandboxFromContext reports whether the verified token belongs to a sandbox key
+func SandboxFromContext(c *fiber.Ctx) bool {
+	sandbox, _ := c.Locals(trackerSandboxLocalsKey).(bool)
+	return sandbox
+}
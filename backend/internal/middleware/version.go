@@ -0,0 +1,11 @@
+package middleware
+
+import "github.com/gofiber/fiber/v2"
+
+// APIVersion tags every response of a route group with the API version that served it
+func APIVersion(version string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set("X-API-Version", version)
+		return c.Next()
+	}
+}
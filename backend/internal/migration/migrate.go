@@ -1,10 +1,13 @@
 package migration
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"path/filepath"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
@@ -56,6 +59,77 @@ func RunMigrations(databaseURL string, migrationsPath string) error {
 	return nil
 }
 
+// advisoryLockKey identifies the startup migration lock; any constant shared by all
+// replicas works
+const advisoryLockKey int64 = 0x75745f6d69677261 // "ut_migra"
+
+// lockPollInterval is how often a waiting replica retries the advisory lock
+const lockPollInterval = 500 * time.Millisecond
+
+// ErrLockTimeout is returned when another process holds the migration lock for longer
+// than the caller is willing to wait
+var ErrLockTimeout = errors.New("timed out waiting for migration lock")
+
+// RunMigrationsLocked runs RunMigrations while holding a Postgres advisory lock, so
+// replicas starting together apply migrations one at a time instead of racing. Replicas
+// that waited find nothing left to apply. It waits at most lockTimeout for the lock.
+func RunMigrationsLocked(databaseURL string, migrationsPath string, lockTimeout time.Duration) error {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+
+	// Session-level advisory locks belong to a connection, so hold one for the duration
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get lock connection: %w", err)
+	}
+	defer conn.Close()
+
+	if err := acquireLock(ctx, conn); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockKey); err != nil {
+			log.Printf("Warning: failed to release migration lock: %v", err)
+		}
+	}()
+
+	return RunMigrations(databaseURL, migrationsPath)
+}
+
+// acquireLock polls pg_try_advisory_lock until it succeeds or ctx expires
+func acquireLock(ctx context.Context, conn *sql.Conn) error {
+	waiting := false
+	for {
+		var acquired bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", advisoryLockKey).Scan(&acquired); err != nil {
+			if ctx.Err() != nil {
+				return ErrLockTimeout
+			}
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if acquired {
+			return nil
+		}
+
+		if !waiting {
+			log.Println("Another process is running migrations, waiting for lock...")
+			waiting = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return ErrLockTimeout
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
 // GetMigrationVersion returns the current migration version
 func GetMigrationVersion(databaseURL string, migrationsPath string) (uint, bool, error) {
 	db, err := sql.Open("postgres", databaseURL)
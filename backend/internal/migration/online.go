@@ -0,0 +1,166 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Index describes an index built online with CreateIndexConcurrently.
+// Definition is everything after the table name, e.g. "(session_id, stream_id) WHERE stream_id IS NOT NULL".
+type Index struct {
+	Name       string
+	Table      string
+	Definition string
+	Unique     bool
+}
+
+// CreateIndexConcurrently builds index without blocking writes. CREATE INDEX
+// CONCURRENTLY cannot run inside a transaction, so it cannot be part of a regular
+// migration file: run it from a command and ship the plain CREATE INDEX IF NOT EXISTS
+// in the migration for fresh installs. An invalid index left behind by an interrupted
+// build is dropped and rebuilt; a valid one is left alone. TimescaleDB hypertables do
+// not support concurrent builds.
+func CreateIndexConcurrently(ctx context.Context, databaseURL string, index Index) error {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	var valid bool
+	err = db.QueryRowContext(ctx, `
+		SELECT i.indisvalid
+		FROM pg_class c
+		JOIN pg_index i ON i.indexrelid = c.oid
+		WHERE c.relname = $1
+	`, index.Name).Scan(&valid)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return fmt.Errorf("failed to inspect index %s: %w", index.Name, err)
+	case valid:
+		log.Printf("Index %s already exists", index.Name)
+		return nil
+	default:
+		log.Printf("Dropping invalid index %s left by an interrupted build", index.Name)
+		if _, err := db.ExecContext(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+pq.QuoteIdentifier(index.Name)); err != nil {
+			return fmt.Errorf("failed to drop invalid index %s: %w", index.Name, err)
+		}
+	}
+
+	unique := ""
+	if index.Unique {
+		unique = "UNIQUE "
+	}
+	stmt := fmt.Sprintf("CREATE %sINDEX CONCURRENTLY IF NOT EXISTS %s ON %s %s",
+		unique, pq.QuoteIdentifier(index.Name), pq.QuoteIdentifier(index.Table), index.Definition)
+
+	start := time.Now()
+	if _, err := db.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("failed to create index %s: %w", index.Name, err)
+	}
+
+	log.Printf("Created index %s in %v", index.Name, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// Backfill is a data migration run in small batches outside a schema migration, so
+// large tables are updated without long locks or one huge transaction. Statement
+// updates at most $1 rows and must stop matching rows once they are updated, so
+// the runner can repeat it until it affects nothing.
+type Backfill struct {
+	Name        string
+	Description string
+	Statement   string
+}
+
+// BackfillConfig throttles a backfill. Each batch runs in its own transaction and is
+// followed by a Throttle pause. MaxBatches of 0 runs until the backfill is done.
+// OnBatch, when set, is called with the running total after every batch.
+type BackfillConfig struct {
+	BatchSize  int
+	Throttle   time.Duration
+	MaxBatches int
+	OnBatch    func(total int64)
+}
+
+// Backfills are the registered backfills runnable with "migrate -command backfill"
+var Backfills = map[string]Backfill{
+	"event-sdk": {
+		Name:        "event-sdk",
+		Description: "Copy sessions.sdk onto events recorded before events carried their own SDK",
+		Statement: `
+			UPDATE events e SET sdk = s.sdk
+			FROM sessions s
+			WHERE s.session_id = e.session_id
+				AND (e.timestamp, e.event_id) IN (
+					SELECT ev.timestamp, ev.event_id
+					FROM events ev
+					JOIN sessions ss ON ss.session_id = ev.session_id
+					WHERE ev.sdk IS NULL AND ss.sdk IS NOT NULL
+					LIMIT $1
+				)
+		`,
+	},
+}
+
+// BackfillNames returns the registered backfill names in order
+func BackfillNames() []string {
+	names := make([]string, 0, len(Backfills))
+	for name := range Backfills {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RunBackfill repeats the backfill statement until it updates no rows, ctx is
+// cancelled or MaxBatches is reached, and returns the number of rows updated
+func RunBackfill(ctx context.Context, databaseURL string, backfill Backfill, config BackfillConfig) (int64, error) {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1000
+	}
+
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	var total int64
+	for batch := 1; config.MaxBatches == 0 || batch <= config.MaxBatches; batch++ {
+		result, err := db.ExecContext(ctx, backfill.Statement, config.BatchSize)
+		if err != nil {
+			return total, fmt.Errorf("backfill %s failed at batch %d: %w", backfill.Name, batch, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("backfill %s failed at batch %d: %w", backfill.Name, batch, err)
+		}
+
+		total += n
+		if n == 0 {
+			log.Printf("Backfill %s complete: %d rows", backfill.Name, total)
+			return total, nil
+		}
+		log.Printf("Backfill %s batch %d: %d rows (%d total)", backfill.Name, batch, n, total)
+		if config.OnBatch != nil {
+			config.OnBatch(total)
+		}
+
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-time.After(config.Throttle):
+		}
+	}
+
+	log.Printf("Backfill %s stopped after %d batches: %d rows", backfill.Name, config.MaxBatches, total)
+	return total, nil
+}
@@ -0,0 +1,421 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Column types as reported by information_schema.columns.data_type
+const (
+	typeUUID        = "uuid"
+	typeVarchar     = "character varying"
+	typeText        = "text"
+	typeInteger     = "integer"
+	typeBigint      = "bigint"
+	typeBoolean     = "boolean"
+	typeDouble      = "double precision"
+	typeTimestamptz = "timestamp with time zone"
+	typeJSONB       = "jsonb"
+	typeBytea       = "bytea"
+	typeArray       = "ARRAY"
+)
+
+// ColumnSpec is a column the server reads or writes, with the type its models expect
+type ColumnSpec struct {
+	Name string
+	Type string
+	// Migration is the version that adds the column or gives it this type
+	Migration uint
+}
+
+// TableSpec lists the columns and indexes of a table the server depends on
+type TableSpec struct {
+	Name      string
+	Migration uint
+	Columns   []ColumnSpec
+	// Indexes maps index names to the migration that creates them
+	Indexes map[string]uint
+}
+
+// RequiredSchema is the schema this server's repositories are written against. Keep it
+// in step with migrations that add, retype or index columns the code relies on.
+var RequiredSchema = []TableSpec{
+	{
+		Name:      "sessions",
+		Migration: 1,
+		Columns: []ColumnSpec{
+			{"session_id", typeUUID, 1},
+			{"user_id", typeVarchar, 1},
+			{"fingerprint", typeVarchar, 1},
+			{"started_at", typeTimestamptz, 1},
+			{"ended_at", typeTimestamptz, 1},
+			{"last_activity_at", typeTimestamptz, 1},
+			{"page_url", typeText, 1},
+			{"screen_width", typeInteger, 1},
+			{"screen_height", typeInteger, 1},
+			{"viewport_width", typeInteger, 1},
+			{"viewport_height", typeInteger, 1},
+			{"metadata", typeJSONB, 1},
+			{"sdk", typeVarchar, 7},
+			{"consent_string", typeText, 14},
+			{"consent_state", typeVarchar, 14},
+			{"viewport_history", typeJSONB, 23},
+			{"sandbox", typeBoolean, 30},
+			{"updated_at", typeTimestamptz, 1},
+		},
+		Indexes: map[string]uint{
+			"idx_sessions_started_at":            1,
+			"idx_sessions_fingerprint":           1,
+			"idx_sessions_sdk":                   7,
+			"idx_sessions_started_at_dimensions": 10,
+			"idx_sessions_sandbox":               30,
+			"idx_sessions_updated_at":            39,
+		},
+	},
+	{
+		Name:      "events",
+		Migration: 1,
+		Columns: []ColumnSpec{
+			{"event_id", typeBigint, 1},
+			{"session_id", typeUUID, 1},
+			{"timestamp", typeTimestamptz, 1},
+			{"event_type", typeVarchar, 1},
+			{"target_element", typeText, 2},
+			{"page_url", typeText, 1},
+			{"viewport_x", typeDouble, 26},
+			{"viewport_y", typeDouble, 26},
+			{"screen_x", typeDouble, 26},
+			{"screen_y", typeDouble, 26},
+			{"scroll_x", typeDouble, 26},
+			{"scroll_y", typeDouble, 26},
+			{"input_masked", typeBoolean, 1},
+			{"event_data", typeJSONB, 1},
+			{"sdk", typeVarchar, 7},
+			{"stream_id", typeVarchar, 11},
+			{"expires_at", typeTimestamptz, 18},
+			{"norm_x", typeDouble, 22},
+			{"norm_y", typeDouble, 22},
+			{"tab_id", typeVarchar, 24},
+			{"frame_path", typeVarchar, 25},
+			{"normalized_url", typeText, 28},
+			{"ingested_at", typeTimestamptz, 38},
+		},
+		Indexes: map[string]uint{
+			"idx_events_session_id":  1,
+			"idx_events_type":        1,
+			"idx_events_stream_id":   11,
+			"idx_events_expires_at":  18,
+			"idx_events_ingested_at": 38,
+		},
+	},
+	{
+		Name:      "screenshots",
+		Migration: 1,
+		Columns: []ColumnSpec{
+			{"screenshot_id", typeBigint, 1},
+			{"session_id", typeUUID, 1},
+			{"timestamp", typeTimestamptz, 1},
+			{"image_data", typeBytea, 1},
+			{"storage_key", typeText, 6},
+		},
+		Indexes: map[string]uint{
+			"idx_screenshots_session_id":  1,
+			"idx_screenshots_storage_key": 40,
+		},
+	},
+	{
+		Name:      "ingest_stats",
+		Migration: 12,
+		Columns: []ColumnSpec{
+			{"project", typeVarchar, 12},
+			{"bucket", typeTimestamptz, 12},
+			{"stage", typeVarchar, 12},
+			{"count", typeBigint, 12},
+		},
+	},
+	{
+		Name:      "jobs",
+		Migration: 17,
+		Columns: []ColumnSpec{
+			{"job_id", typeUUID, 17},
+			{"status", typeVarchar, 17},
+			{"payload", typeJSONB, 17},
+			{"run_after", typeTimestamptz, 17},
+		},
+		Indexes: map[string]uint{
+			"idx_jobs_pending": 17,
+		},
+	},
+	{
+		Name:      "tracker_keys",
+		Migration: 21,
+		Columns: []ColumnSpec{
+			{"key_id", typeUUID, 21},
+			{"public_key", typeVarchar, 21},
+			{"allowed_origins", typeArray, 21},
+			{"tokens_not_before", typeTimestamptz, 21},
+			{"mousemove_throttle_ms", typeInteger, 27},
+			{"scroll_throttle_ms", typeInteger, 27},
+			{"sandbox", typeBoolean, 30},
+			{"sample_rate", typeDouble, 37},
+			{"mask_selectors", typeArray, 37},
+		},
+	},
+	{
+		Name:      "url_rules",
+		Migration: 28,
+		Columns: []ColumnSpec{
+			{"rule_id", typeUUID, 28},
+			{"key_id", typeUUID, 28},
+			{"position", typeInteger, 28},
+			{"strip_params", typeArray, 28},
+			{"pattern", typeText, 28},
+			{"replacement", typeText, 28},
+		},
+		Indexes: map[string]uint{
+			"idx_url_rules_key": 28,
+		},
+	},
+	{
+		Name:      "alert_rules",
+		Migration: 29,
+		Columns: []ColumnSpec{
+			{"rule_id", typeUUID, 29},
+			{"metric", typeVarchar, 29},
+			{"threshold", typeDouble, 29},
+			{"window_seconds", typeInteger, 29},
+			{"state", typeVarchar, 29},
+			{"last_value", typeDouble, 29},
+			{"last_evaluated_at", typeTimestamptz, 29},
+		},
+	},
+	{
+		Name:      "alert_events",
+		Migration: 29,
+		Columns: []ColumnSpec{
+			{"event_id", typeBigint, 29},
+			{"rule_id", typeUUID, 29},
+			{"state", typeVarchar, 29},
+			{"notified_at", typeTimestamptz, 29},
+		},
+		Indexes: map[string]uint{
+			"idx_alert_events_rule": 29,
+		},
+	},
+	{
+		Name:      "event_catalog",
+		Migration: 31,
+		Columns: []ColumnSpec{
+			{"project", typeVarchar, 31},
+			{"event_type", typeVarchar, 31},
+			{"data_key", typeVarchar, 31},
+			{"count", typeBigint, 31},
+			{"first_seen_at", typeTimestamptz, 31},
+			{"last_seen_at", typeTimestamptz, 31},
+		},
+	},
+	{
+		Name:      "event_schemas",
+		Migration: 32,
+		Columns: []ColumnSpec{
+			{"project", typeVarchar, 32},
+			{"event_type", typeVarchar, 32},
+			{"field", typeVarchar, 32},
+			{"type", typeVarchar, 32},
+		},
+	},
+	{
+		Name:      "warehouse_connectors",
+		Migration: 33,
+		Columns: []ColumnSpec{
+			{"connector_id", typeUUID, 33},
+			{"kind", typeVarchar, 33},
+			{"project", typeVarchar, 33},
+			{"config", typeJSONB, 33},
+			{"credentials", typeText, 33},
+			{"next_run_at", typeTimestamptz, 33},
+			{"locked_until", typeTimestamptz, 33},
+			{"schema_version", typeInteger, 33},
+			{"sessions_cursor_at", typeTimestamptz, 33},
+			{"sessions_cursor_id", typeUUID, 33},
+			{"events_cursor_at", typeTimestamptz, 33},
+			{"events_cursor_id", typeBigint, 33},
+		},
+		Indexes: map[string]uint{
+			"idx_warehouse_connectors_due": 33,
+		},
+	},
+	{
+		Name:      "replay_assets",
+		Migration: 34,
+		Columns: []ColumnSpec{
+			{"project", typeVarchar, 34},
+			{"url_hash", typeVarchar, 34},
+			{"url", typeText, 34},
+			{"storage_key", typeText, 34},
+			{"content_type", typeVarchar, 34},
+			{"size_bytes", typeBigint, 34},
+			{"last_used_at", typeTimestamptz, 34},
+		},
+		Indexes: map[string]uint{
+			"idx_replay_assets_lru": 34,
+		},
+	},
+	{
+		Name:      "api_keys",
+		Migration: 35,
+		Columns: []ColumnSpec{
+			{"key_id", typeUUID, 35},
+			{"name", typeVarchar, 35},
+			{"scope", typeVarchar, 35},
+			{"key_prefix", typeVarchar, 35},
+			{"key_hash", typeVarchar, 35},
+			{"last_used_at", typeTimestamptz, 35},
+			{"revoked_at", typeTimestamptz, 35},
+		},
+		Indexes: map[string]uint{
+			// Backs the unique key_hash, which every API key request is looked up by
+			"api_keys_key_hash_key": 35,
+		},
+	},
+}
+
+// SchemaProblem is one difference between the database and RequiredSchema
+type SchemaProblem struct {
+	Table     string `json:"table"`
+	Column    string `json:"column,omitempty"`
+	Index     string `json:"index,omitempty"`
+	Expected  string `json:"expected,omitempty"`
+	Actual    string `json:"actual,omitempty"`
+	Migration uint   `json:"migration"`
+}
+
+func (p SchemaProblem) String() string {
+	switch {
+	case p.Index != "":
+		return fmt.Sprintf("%s: index %s is missing (migration %06d)", p.Table, p.Index, p.Migration)
+	case p.Column == "":
+		return fmt.Sprintf("%s: table is missing (migration %06d)", p.Table, p.Migration)
+	case p.Actual == "":
+		return fmt.Sprintf("%s.%s: column is missing (migration %06d)", p.Table, p.Column, p.Migration)
+	default:
+		return fmt.Sprintf("%s.%s: type is %s, expected %s (migration %06d)", p.Table, p.Column, p.Actual, p.Expected, p.Migration)
+	}
+}
+
+// SchemaReport lists every problem found by CheckSchema
+type SchemaReport struct {
+	Problems []SchemaProblem `json:"problems"`
+}
+
+// OK reports whether the schema matched
+func (r *SchemaReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// String formats the report for the startup log, one problem per line
+func (r *SchemaReport) String() string {
+	if r.OK() {
+		return "schema matches"
+	}
+	lines := []string{fmt.Sprintf("schema check found %d problems:", len(r.Problems))}
+	for _, p := range r.Problems {
+		lines = append(lines, "  - "+p.String())
+	}
+	lines = append(lines, "apply the listed migrations (AUTO_MIGRATE=true or migrate up) or repair them by hand; a dirty version must be forced back first")
+	return strings.Join(lines, "\n")
+}
+
+// CheckSchema compares the tables, columns, column types and indexes of the database's
+// current schema with tables
+func CheckSchema(ctx context.Context, databaseURL string, tables []TableSpec) (*SchemaReport, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	columns := make(map[string]map[string]string)
+	rows, err := db.QueryContext(ctx, `
+		SELECT table_name, column_name, data_type
+		FROM information_schema.columns
+		WHERE table_schema = current_schema()
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, column, dataType string
+		if err := rows.Scan(&table, &column, &dataType); err != nil {
+			return nil, fmt.Errorf("failed to scan column: %w", err)
+		}
+		if columns[table] == nil {
+			columns[table] = make(map[string]string)
+		}
+		columns[table][column] = dataType
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+
+	indexes := make(map[string]bool)
+	indexRows, err := db.QueryContext(ctx, "SELECT indexname FROM pg_indexes WHERE schemaname = current_schema()")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	defer indexRows.Close()
+	for indexRows.Next() {
+		var name string
+		if err := indexRows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan index: %w", err)
+		}
+		indexes[name] = true
+	}
+	if err := indexRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+
+	return compareSchema(tables, columns, indexes), nil
+}
+
+// compareSchema reports the specs missing from or typed differently in the actual
+// columns (table -> column -> type) and indexes
+func compareSchema(tables []TableSpec, columns map[string]map[string]string, indexes map[string]bool) *SchemaReport {
+	report := &SchemaReport{Problems: []SchemaProblem{}}
+	for _, table := range tables {
+		actual, ok := columns[table.Name]
+		if !ok {
+			report.Problems = append(report.Problems, SchemaProblem{Table: table.Name, Migration: table.Migration})
+			continue
+		}
+
+		for _, column := range table.Columns {
+			dataType, ok := actual[column.Name]
+			if !ok || dataType != column.Type {
+				report.Problems = append(report.Problems, SchemaProblem{
+					Table:     table.Name,
+					Column:    column.Name,
+					Expected:  column.Type,
+					Actual:    dataType,
+					Migration: column.Migration,
+				})
+			}
+		}
+
+		names := make([]string, 0, len(table.Indexes))
+		for name := range table.Indexes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !indexes[name] {
+				report.Problems = append(report.Problems, SchemaProblem{Table: table.Name, Index: name, Migration: table.Indexes[name]})
+			}
+		}
+	}
+	return report
+}
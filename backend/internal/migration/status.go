@@ -0,0 +1,116 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// Migration is one migration shipped with the server
+type Migration struct {
+	Version uint   `json:"version"`
+	Name    string `json:"name"`
+}
+
+// Status compares the schema version applied to the database with the migrations
+// shipped with the server. Behind means the server expects a newer schema than the
+// database has; Ahead means the database was migrated by a newer server (or by a
+// migration this server does not know).
+type Status struct {
+	Version   uint        `json:"version"`
+	Dirty     bool        `json:"dirty"`
+	Latest    uint        `json:"latest"`
+	Available int         `json:"available"`
+	Pending   []Migration `json:"pending"`
+	Behind    bool        `json:"behind"`
+	Ahead     bool        `json:"ahead"`
+}
+
+// StatusChecker reports the migration status of one database
+type StatusChecker struct {
+	databaseURL    string
+	migrationsPath string
+}
+
+// NewStatusChecker creates a checker for the migrations in migrationsPath
+func NewStatusChecker(databaseURL string, migrationsPath string) *StatusChecker {
+	return &StatusChecker{
+		databaseURL:    databaseURL,
+		migrationsPath: migrationsPath,
+	}
+}
+
+// Status reads the applied version and lists the migrations not yet applied
+func (sc *StatusChecker) Status() (*Status, error) {
+	available, err := ListMigrations(sc.migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	version, dirty, err := GetMigrationVersion(sc.databaseURL, sc.migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Version:   version,
+		Dirty:     dirty,
+		Available: len(available),
+		Pending:   []Migration{},
+	}
+
+	known := version == 0
+	for _, m := range available {
+		if m.Version > version {
+			status.Pending = append(status.Pending, m)
+		}
+		if m.Version == version {
+			known = true
+		}
+		status.Latest = m.Version
+	}
+	status.Behind = len(status.Pending) > 0
+	status.Ahead = version > status.Latest || !known
+
+	return status, nil
+}
+
+// Schema checks the database against RequiredSchema
+func (sc *StatusChecker) Schema(ctx context.Context) (*SchemaReport, error) {
+	return CheckSchema(ctx, sc.databaseURL, RequiredSchema)
+}
+
+// ListMigrations returns the up migrations in migrationsPath in version order
+func ListMigrations(migrationsPath string) ([]Migration, error) {
+	absPath, err := filepath.Abs(migrationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	src, err := source.Open(fmt.Sprintf("file://%s", absPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open migrations: %w", err)
+	}
+	defer src.Close()
+
+	var migrations []Migration
+	version, err := src.First()
+	for err == nil {
+		name := ""
+		if r, identifier, readErr := src.ReadUp(version); readErr == nil {
+			r.Close()
+			name = identifier
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name})
+		version, err = src.Next(version)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	return migrations, nil
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Metrics an alert rule can watch
+const (
+	// AlertMetricQueueDepth is the ingest stream backlog; the window is not used
+	AlertMetricQueueDepth = "queue_depth"
+	// AlertMetricErrorRate is error events as a fraction of all events in the window
+	AlertMetricErrorRate = "error_rate"
+	// AlertMetricSessionsPerMinute is sessions started in the window per minute
+	AlertMetricSessionsPerMinute = "sessions_per_minute"
+	// AlertMetricGoalConversion is the fraction of sessions started in the window that
+	// visited the rule's goal URL
+	AlertMetricGoalConversion = "goal_conversion"
+	// AlertMetricStreamLength is the number of entries kept in the event stream,
+	// processed or not; the window is not used
+	AlertMetricStreamLength = "stream_length"
+)
+
+// Comparators between an alert metric and its threshold
+const (
+	AlertComparatorGT  = "gt"
+	AlertComparatorGTE = "gte"
+	AlertComparatorLT  = "lt"
+	AlertComparatorLTE = "lte"
+)
+
+// Alert rule states
+const (
+	AlertStateOK     = "ok"
+	AlertStateFiring = "firing"
+)
+
+// AlertRule fires while Metric compared with Threshold by Comparator holds
+type AlertRule struct {
+	RuleID         uuid.UUID  `json:"rule_id"`
+	Name           string     `json:"name"`
+	Metric         string     `json:"metric"`
+	Comparator     string     `json:"comparator"`
+	Threshold      float64    `json:"threshold"`
+	WindowSeconds  int        `json:"window_seconds"`
+	GoalURL        *string    `json:"goal_url,omitempty"`
+	NotifyURL      *string    `json:"notify_url,omitempty"`
+	Enabled        bool       `json:"enabled"`
+	State          string     `json:"state"`
+	StateChangedAt *time.Time `json:"state_changed_at,omitempty"`
+	// LastValue is nil when the metric had no data at the last evaluation
+	LastValue       *float64   `json:"last_value"`
+	LastEvaluatedAt *time.Time `json:"last_evaluated_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// Window returns the rule's trailing window
+func (r *AlertRule) Window() time.Duration {
+	return time.Duration(r.WindowSeconds) * time.Second
+}
+
+// CreateAlertRuleRequest is the body of POST /alerts
+type CreateAlertRuleRequest struct {
+	Name          string  `json:"name"`
+	Metric        string  `json:"metric"`
+	Comparator    string  `json:"comparator"`
+	Threshold     float64 `json:"threshold"`
+	WindowSeconds int     `json:"window_seconds"`
+	GoalURL       *string `json:"goal_url,omitempty"`
+	NotifyURL     *string `json:"notify_url,omitempty"`
+}
+
+// AlertEvent records a rule changing state, and whether it was announced
+type AlertEvent struct {
+	EventID     int64      `json:"event_id"`
+	RuleID      uuid.UUID  `json:"rule_id"`
+	RuleName    string     `json:"rule_name"`
+	State       string     `json:"state"`
+	Value       *float64   `json:"value"`
+	Threshold   float64    `json:"threshold"`
+	CreatedAt   time.Time  `json:"created_at"`
+	NotifiedAt  *time.Time `json:"notified_at,omitempty"`
+	NotifyError *string    `json:"notify_error,omitempty"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// SDKUsage is the traffic attributed to one client SDK identifier
+type SDKUsage struct {
+	SDK        string    `json:"sdk"`
+	Sessions   int64     `json:"sessions"`
+	Events     int64     `json:"events"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// AnalyticsOverview holds the dashboard's headline KPIs for a time window
+type AnalyticsOverview struct {
+	From               time.Time        `json:"from"`
+	To                 time.Time        `json:"to"`
+	Sessions           int64            `json:"sessions"`
+	UniqueVisitors     int64            `json:"unique_visitors"`
+	AvgDurationSeconds float64          `json:"avg_duration_seconds"`
+	SinglePageSessions int64            `json:"single_page_sessions"`
+	BounceRate         float64          `json:"bounce_rate"`
+	TopPages           []PageStat       `json:"top_pages"`
+	TopErrors          []ErrorStat      `json:"top_errors"`
+	Devices            map[string]int64 `json:"devices"`
+}
+
+// PageStat is the number of sessions that visited a page. PageURL is the normalized
+// URL where URL rules grouped it.
+type PageStat struct {
+	PageURL  string `json:"page_url"`
+	Sessions int64  `json:"sessions"`
+	Events   int64  `json:"events"`
+}
+
+// ErrorStat is an error message with its occurrence and affected session counts
+type ErrorStat struct {
+	Message     string `json:"message"`
+	Occurrences int64  `json:"occurrences"`
+	Sessions    int64  `json:"sessions"`
+}
+
+// BreakdownRow is the traffic and engagement for one value of a session dimension
+type BreakdownRow struct {
+	Value               string  `json:"value"`
+	Sessions            int64   `json:"sessions"`
+	UniqueVisitors      int64   `json:"unique_visitors"`
+	AvgDurationSeconds  float64 `json:"avg_duration_seconds"`
+	AvgEventsPerSession float64 `json:"avg_events_per_session"`
+	SinglePageSessions  int64   `json:"single_page_sessions"`
+	BounceRate          float64 `json:"bounce_rate"`
+}
+
+// IngestStatBucket holds the number of events seen at each ingest stage in one hour
+type IngestStatBucket struct {
+	Project string           `json:"project"`
+	Bucket  time.Time        `json:"bucket"`
+	Stages  map[string]int64 `json:"stages"`
+}
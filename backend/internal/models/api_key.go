@@ -0,0 +1,47 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// API key scopes: ingest keys may only send events, read keys may only read
+const (
+	APIKeyScopeIngest = "ingest"
+	APIKeyScopeRead   = "read"
+)
+
+// APIKeyPrefix starts every API key, telling them apart from other bearer tokens
+const APIKeyPrefix = "utk_"
+
+// IsAPIKey reports whether token looks like an API key rather than another bearer token
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// ValidAPIKeyScope reports whether scope names an API key scope
+func ValidAPIKeyScope(scope string) bool {
+	return scope == APIKeyScopeIngest || scope == APIKeyScopeRead
+}
+
+// APIKey is a secret key for server-side callers, sent as a bearer token. Key is only
+// set in the responses to create and rotate; afterwards the key is known by Prefix.
+type APIKey struct {
+	KeyID      uuid.UUID  `json:"key_id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	Prefix     string     `json:"prefix"`
+	Key        string     `json:"key,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// CreateAPIKeyRequest is the body of POST /admin/api-keys
+type CreateAPIKeyRequest struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// ReplayAsset is a cached copy of a stylesheet, image or font a page referenced
+type ReplayAsset struct {
+	Project     string    `json:"project"`
+	URLHash     string    `json:"url_hash"`
+	URL         string    `json:"url"`
+	StorageKey  string    `json:"-"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	FetchedAt   time.Time `json:"fetched_at"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+}
+
+// AssetUsage is the size of a project's asset cache against its quota
+type AssetUsage struct {
+	Project    string `json:"project"`
+	Assets     int64  `json:"assets"`
+	SizeBytes  int64  `json:"size_bytes"`
+	QuotaBytes int64  `json:"quota_bytes"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// builtinEventTypes are the event types the SDK records on its own; any other type was
+// sent by the site as a custom event
+var builtinEventTypes = map[EventType]bool{
+	EventTypeClick:      true,
+	EventTypeInput:      true,
+	EventTypeScroll:     true,
+	EventTypeMouseMove:  true,
+	EventTypeNavigation: true,
+	EventTypeResize:     true,
+	EventTypeFocus:      true,
+	EventTypeBlur:       true,
+	EventTypeChange:     true,
+	EventTypeSubmit:     true,
+	EventTypeKeyPress:   true,
+	EventTypeError:      true,
+}
+
+// IsCustomEventType reports whether t is not one of the SDK's own event types
+func IsCustomEventType(t EventType) bool {
+	return !builtinEventTypes[t]
+}
+
+// CatalogEvent is an event type observed in a project, with the top-level event_data
+// keys seen on it
+type CatalogEvent struct {
+	Project     string       `json:"project"`
+	EventType   string       `json:"event_type"`
+	Custom      bool         `json:"custom"`
+	Count       int64        `json:"count"`
+	FirstSeenAt time.Time    `json:"first_seen_at"`
+	LastSeenAt  time.Time    `json:"last_seen_at"`
+	Keys        []CatalogKey `json:"keys"`
+}
+
+// CatalogKey is an event_data key with the number of events it was seen on
+type CatalogKey struct {
+	Key         string    `json:"key"`
+	Count       int64     `json:"count"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// CatalogEntry is one row of the event catalog: an event type (Key empty) or one of
+// its event_data keys
+type CatalogEntry struct {
+	Project     string
+	EventType   string
+	Key         string
+	Count       int64
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+}
@@ -24,33 +24,48 @@ const (
 )
 
 type Event struct {
-	EventID        int64                  `json:"event_id" db:"event_id"`
-	SessionID      uuid.UUID              `json:"session_id" db:"session_id"`
-	Timestamp      time.Time              `json:"timestamp" db:"timestamp"`
-	EventType      EventType              `json:"event_type" db:"event_type"`
-	TargetElement  *string                `json:"target_element,omitempty" db:"target_element"`
-	TargetSelector *string                `json:"target_selector,omitempty" db:"target_selector"`
-	TargetTag      *string                `json:"target_tag,omitempty" db:"target_tag"`
-	TargetID       *string                `json:"target_id,omitempty" db:"target_id"`
-	TargetClass    *string                `json:"target_class,omitempty" db:"target_class"`
-	PageURL        string                 `json:"page_url" db:"page_url"`
-	ViewportX      *float64               `json:"viewport_x,omitempty" db:"viewport_x"`
-	ViewportY      *float64               `json:"viewport_y,omitempty" db:"viewport_y"`
-	ScreenX        *float64               `json:"screen_x,omitempty" db:"screen_x"`
-	ScreenY        *float64               `json:"screen_y,omitempty" db:"screen_y"`
-	ScrollX        *float64               `json:"scroll_x,omitempty" db:"scroll_x"`
-	ScrollY        *float64               `json:"scroll_y,omitempty" db:"scroll_y"`
-	InputValue     *string                `json:"input_value,omitempty" db:"input_value"`
-	InputMasked    bool                   `json:"input_masked" db:"input_masked"`
-	KeyPressed     *string                `json:"key_pressed,omitempty" db:"key_pressed"`
-	MouseButton    *int                   `json:"mouse_button,omitempty" db:"mouse_button"`
-	ClickCount     *int                   `json:"click_count,omitempty" db:"click_count"`
-	EventData      map[string]interface{} `json:"event_data,omitempty" db:"event_data"`
+	EventID        int64     `json:"event_id" db:"event_id"`
+	SessionID      uuid.UUID `json:"session_id" db:"session_id"`
+	Timestamp      time.Time `json:"timestamp" db:"timestamp"`
+	EventType      EventType `json:"event_type" db:"event_type"`
+	TargetElement  *string   `json:"target_element,omitempty" db:"target_element"`
+	TargetSelector *string   `json:"target_selector,omitempty" db:"target_selector"`
+	TargetTag      *string   `json:"target_tag,omitempty" db:"target_tag"`
+	TargetID       *string   `json:"target_id,omitempty" db:"target_id"`
+	TargetClass    *string   `json:"target_class,omitempty" db:"target_class"`
+	PageURL        string    `json:"page_url" db:"page_url"`
+	ViewportX      *float64  `json:"viewport_x,omitempty" db:"viewport_x"`
+	ViewportY      *float64  `json:"viewport_y,omitempty" db:"viewport_y"`
+	ScreenX        *float64  `json:"screen_x,omitempty" db:"screen_x"`
+	ScreenY        *float64  `json:"screen_y,omitempty" db:"screen_y"`
+	ScrollX        *float64  `json:"scroll_x,omitempty" db:"scroll_x"`
+	ScrollY        *float64  `json:"scroll_y,omitempty" db:"scroll_y"`
+	// NormX/NormY are ViewportX/ViewportY as a fraction of the viewport size at the time
+	NormX       *float64               `json:"norm_x,omitempty" db:"norm_x"`
+	NormY       *float64               `json:"norm_y,omitempty" db:"norm_y"`
+	InputValue  *string                `json:"input_value,omitempty" db:"input_value"`
+	InputMasked bool                   `json:"input_masked" db:"input_masked"`
+	KeyPressed  *string                `json:"key_pressed,omitempty" db:"key_pressed"`
+	MouseButton *int                   `json:"mouse_button,omitempty" db:"mouse_button"`
+	ClickCount  *int                   `json:"click_count,omitempty" db:"click_count"`
+	EventData   map[string]interface{} `json:"event_data,omitempty" db:"event_data"`
+	SDK         *string                `json:"sdk,omitempty" db:"sdk"`
+	ExpiresAt   *time.Time             `json:"expires_at,omitempty" db:"expires_at"`
+	TabID       *string                `json:"tab_id,omitempty" db:"tab_id"`
+	FramePath   *string                `json:"frame_path,omitempty" db:"frame_path"`
+	// NormalizedURL is PageURL after the URL grouping rules, nil when they left it unchanged
+	NormalizedURL *string `json:"normalized_url,omitempty" db:"normalized_url"`
+	// TypedData holds the event_data fields declared in the project's event schema,
+	// coerced to their types, when requested; nil for values that failed to coerce
+	TypedData map[string]interface{} `json:"typed_data,omitempty" db:"-"`
 }
 
+// TrackEventRequest is a /track batch. BatchID, when set, identifies the batch across
+// retries so a batch sent twice is only stored once.
 type TrackEventRequest struct {
-	SessionID      string                 `json:"session_id" validate:"required"`
-	Events         []EventData            `json:"events" validate:"required,min=1"`
+	SessionID string      `json:"session_id" validate:"required"`
+	BatchID   string      `json:"batch_id,omitempty"`
+	Events    []EventData `json:"events" validate:"required,min=1"`
 }
 
 type EventData struct {
@@ -74,4 +89,32 @@ type EventData struct {
 	MouseButton    *int                   `json:"mouse_button,omitempty"`
 	ClickCount     *int                   `json:"click_count,omitempty"`
 	EventData      map[string]interface{} `json:"event_data,omitempty"`
+	SDK            *string                `json:"sdk,omitempty"`
+	// TabID identifies the browser tab, for sessions open in several tabs at once
+	TabID *string `json:"tab_id,omitempty"`
+	// FramePath locates the document inside embedded frames, e.g. "main>iframe#checkout";
+	// omitted for the top document
+	FramePath *string `json:"frame_path,omitempty"`
+	// TTL asks for the event to be deleted this many seconds after its timestamp,
+	// ahead of the global retention policy
+	TTL *int64 `json:"ttl,omitempty"`
+
+	// NormalizedURL is set at ingest from the URL grouping rules; whatever clients send
+	// is overwritten
+	NormalizedURL *string `json:"normalized_url,omitempty"`
+
+	// StreamID is the queue message the event arrived in; set by the processor, not clients
+	StreamID string `json:"-"`
+	// NormX/NormY are computed at write time by NormalizeCoordinates, not sent by clients
+	NormX *float64 `json:"-"`
+	NormY *float64 `json:"-"`
+}
+
+// ExpiresAt returns when the event expires according to its TTL, or nil
+func (e *EventData) ExpiresAt() *time.Time {
+	if e.TTL == nil {
+		return nil
+	}
+	expiresAt := e.Timestamp.Add(time.Duration(*e.TTL) * time.Second)
+	return &expiresAt
 }
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// EventSchema declares the types of event_data fields of one event type in an ingest
+// project. Events read with ?typed=true get these fields coerced in typed_data.
+type EventSchema struct {
+	Project   string            `json:"project"`
+	EventType string            `json:"event_type"`
+	Fields    map[string]string `json:"fields"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// PutEventSchemaRequest is the body of PUT /admin/event-schemas
+type PutEventSchemaRequest struct {
+	Project   string            `json:"project"`
+	EventType string            `json:"event_type"`
+	Fields    map[string]string `json:"fields"`
+}
+
+// CoercionWarning reports an event_data value that could not be coerced to the type
+// its schema declares; the field is null in typed_data
+type CoercionWarning struct {
+	EventID   int64       `json:"event_id"`
+	EventType string      `json:"event_type"`
+	Field     string      `json:"field"`
+	Type      string      `json:"type"`
+	Value     interface{} `json:"value"`
+	Error     string      `json:"error"`
+}
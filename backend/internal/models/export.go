@@ -0,0 +1,124 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ExportStatus string
+
+const (
+	ExportStatusPending   ExportStatus = "pending"
+	ExportStatusRunning   ExportStatus = "running"
+	ExportStatusCompleted ExportStatus = "completed"
+	ExportStatusFailed    ExportStatus = "failed"
+)
+
+// Export kinds and formats
+const (
+	ExportKindSessions = "sessions"
+	ExportKindEvents   = "events"
+
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatCSV    = "csv"
+)
+
+// ExportJob tracks an asynchronous export written to blob storage. The public key
+// itself is never returned; KeyFingerprint identifies which key the bundle is sealed for.
+type ExportJob struct {
+	JobID          uuid.UUID    `json:"job_id" db:"job_id"`
+	ScheduleID     *uuid.UUID   `json:"schedule_id,omitempty" db:"schedule_id"`
+	Status         ExportStatus `json:"status" db:"status"`
+	Kind           string       `json:"kind" db:"kind"`
+	Format         string       `json:"format" db:"format"`
+	From           time.Time    `json:"from" db:"range_from"`
+	To             time.Time    `json:"to" db:"range_to"`
+	Role           string       `json:"role" db:"role"`
+	Encryption     string       `json:"encryption" db:"encryption"`
+	PublicKey      *string      `json:"-" db:"public_key"`
+	KeyFingerprint *string      `json:"key_fingerprint,omitempty" db:"key_fingerprint"`
+	ObjectKey      *string      `json:"object_key,omitempty" db:"object_key"`
+	RowsExported   int64        `json:"rows_exported" db:"rows_exported"`
+	BytesWritten   int64        `json:"bytes_written" db:"bytes_written"`
+	Error          *string      `json:"error,omitempty" db:"error"`
+	CreatedAt      time.Time    `json:"created_at" db:"created_at"`
+	StartedAt      *time.Time   `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt     *time.Time   `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// ExportEncryption names the method and recipient public key an export is sealed with:
+// an "age1..." recipient for age, or an ASCII-armored public key for gpg
+type ExportEncryption struct {
+	Method    string `json:"method"`
+	PublicKey string `json:"public_key"`
+}
+
+// CreateExportRequest queues an export of sessions or events in [From, To)
+type CreateExportRequest struct {
+	Kind       string            `json:"kind"`
+	Format     string            `json:"format,omitempty"`
+	From       time.Time         `json:"from"`
+	To         time.Time         `json:"to"`
+	Encryption *ExportEncryption `json:"encryption,omitempty"`
+}
+
+// ExportResult is what the export worker records for a finished job
+type ExportResult struct {
+	ObjectKey    *string
+	RowsExported int64
+	BytesWritten int64
+}
+
+// ExportSchedule queues an export job on a cron schedule. Each run exports the window
+// ending at its scheduled time.
+type ExportSchedule struct {
+	ScheduleID          uuid.UUID     `json:"schedule_id" db:"schedule_id"`
+	Name                string        `json:"name" db:"name"`
+	Cron                string        `json:"cron" db:"cron"`
+	Timezone            string        `json:"timezone" db:"timezone"`
+	Kind                string        `json:"kind" db:"kind"`
+	Format              string        `json:"format" db:"format"`
+	WindowSeconds       *int64        `json:"window_seconds,omitempty" db:"window_seconds"`
+	Role                string        `json:"role" db:"role"`
+	Encryption          string        `json:"encryption" db:"encryption"`
+	PublicKey           *string       `json:"-" db:"public_key"`
+	KeyFingerprint      *string       `json:"key_fingerprint,omitempty" db:"key_fingerprint"`
+	NotifyURL           *string       `json:"notify_url,omitempty" db:"notify_url"`
+	Enabled             bool          `json:"enabled" db:"enabled"`
+	NextRunAt           time.Time     `json:"next_run_at" db:"next_run_at"`
+	LastRunAt           *time.Time    `json:"last_run_at,omitempty" db:"last_run_at"`
+	LastStatus          *ExportStatus `json:"last_status,omitempty" db:"last_status"`
+	ConsecutiveFailures int           `json:"consecutive_failures" db:"consecutive_failures"`
+	CreatedAt           time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// CreateExportScheduleRequest defines a recurring export. Window is a Go duration
+// ("24h"); empty exports the interval since the previous run.
+type CreateExportScheduleRequest struct {
+	Name       string            `json:"name"`
+	Cron       string            `json:"cron"`
+	Timezone   string            `json:"timezone,omitempty"`
+	Kind       string            `json:"kind"`
+	Format     string            `json:"format,omitempty"`
+	Window     string            `json:"window,omitempty"`
+	Encryption *ExportEncryption `json:"encryption,omitempty"`
+	NotifyURL  *string           `json:"notify_url,omitempty"`
+	Enabled    *bool             `json:"enabled,omitempty"`
+}
+
+// UpdateExportScheduleRequest changes the fields that are set
+type UpdateExportScheduleRequest struct {
+	Name      *string `json:"name,omitempty"`
+	Cron      *string `json:"cron,omitempty"`
+	Timezone  *string `json:"timezone,omitempty"`
+	NotifyURL *string `json:"notify_url,omitempty"`
+	Enabled   *bool   `json:"enabled,omitempty"`
+}
+
+// ExportScheduleDetail is a schedule with its most recent runs
+type ExportScheduleDetail struct {
+	ExportSchedule
+	Runs []*ExportJob `json:"runs"`
+}
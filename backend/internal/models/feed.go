@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reasons a session appears in the problem sessions feed
+const (
+	ProblemReasonErrors           = "errors"
+	ProblemReasonRageClicks       = "rage_clicks"
+	ProblemReasonFrustrationSpike = "frustration_spike"
+)
+
+// ProblemSession is a recent session with errors, rage clicks or a frustration spike.
+// The frustration score of a minute is 3 per error plus 2 per rage click; PeakScore is
+// the session's highest minute.
+type ProblemSession struct {
+	SessionID      uuid.UUID       `json:"session_id"`
+	UserID         *string         `json:"user_id,omitempty"`
+	StartedAt      time.Time       `json:"started_at"`
+	PageURL        string          `json:"page_url"`
+	DeviceType     *string         `json:"device_type,omitempty"`
+	Browser        *string         `json:"browser,omitempty"`
+	LastSignalAt   time.Time       `json:"last_signal_at"`
+	ErrorCount     int             `json:"error_count"`
+	RageClickCount int             `json:"rage_click_count"`
+	FirstError     *string         `json:"-"`
+	TopRageTarget  *string         `json:"-"`
+	PeakScore      int             `json:"peak_frustration_score"`
+	PeakAt         time.Time       `json:"-"`
+	Reasons        []ProblemReason `json:"reasons"`
+}
+
+// ProblemReason annotates why a session is in the feed
+type ProblemReason struct {
+	Type   string     `json:"type"`
+	Count  int        `json:"count,omitempty"`
+	Score  int        `json:"score,omitempty"`
+	Detail *string    `json:"detail,omitempty"`
+	At     *time.Time `json:"at,omitempty"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+)
+
+// TopFrame is the first segment of every frame path: the top-level document. Events
+// without a frame_path belong to it.
+const TopFrame = "main"
+
+// FramePathSeparator separates the frames of a frame path
+const FramePathSeparator = ">"
+
+const (
+	maxFramePathLength = 255
+	maxFrameDepth      = 10
+)
+
+// frameSegmentPattern allows selector-like segments such as "iframe#checkout" or
+// "iframe.widget:nth-of-type(2)"
+var frameSegmentPattern = regexp.MustCompile(`^[A-Za-z0-9_.#:()-]{1,64}$`)
+
+// ValidFramePath reports whether path is a frame path starting at the top document,
+// e.g. "main" or "main>iframe#checkout"
+func ValidFramePath(path string) bool {
+	if len(path) > maxFramePathLength {
+		return false
+	}
+	segments := strings.Split(path, FramePathSeparator)
+	if segments[0] != TopFrame || len(segments) > maxFrameDepth {
+		return false
+	}
+	for _, segment := range segments {
+		if !frameSegmentPattern.MatchString(segment) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ImportStatus string
+
+const (
+	ImportStatusPending   ImportStatus = "pending"
+	ImportStatusRunning   ImportStatus = "running"
+	ImportStatusCompleted ImportStatus = "completed"
+	ImportStatusFailed    ImportStatus = "failed"
+)
+
+// ImportJob tracks the progress of a bulk historical import
+type ImportJob struct {
+	JobID            uuid.UUID      `json:"job_id" db:"job_id"`
+	Status           ImportStatus   `json:"status" db:"status"`
+	Source           string         `json:"source" db:"source"`
+	ObjectKey        *string        `json:"object_key,omitempty" db:"object_key"`
+	LinesProcessed   int64          `json:"lines_processed" db:"lines_processed"`
+	LinesFailed      int64          `json:"lines_failed" db:"lines_failed"`
+	SessionsImported int64          `json:"sessions_imported" db:"sessions_imported"`
+	EventsImported   int64          `json:"events_imported" db:"events_imported"`
+	MappingReport    *MappingReport `json:"mapping_report,omitempty" db:"mapping_report"`
+	Error            *string        `json:"error,omitempty" db:"error"`
+	CreatedAt        time.Time      `json:"created_at" db:"created_at"`
+	StartedAt        *time.Time     `json:"started_at,omitempty" db:"started_at"`
+	FinishedAt       *time.Time     `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// ImportProgress is the counter delta reported by the import worker
+type ImportProgress struct {
+	LinesProcessed   int64
+	LinesFailed      int64
+	SessionsImported int64
+	EventsImported   int64
+}
+
+// CreateImportRequest points an import at an NDJSON object in blob storage
+type CreateImportRequest struct {
+	ObjectKey string `json:"object_key"`
+	Source    string `json:"source,omitempty"`
+}
+
+// ImportRecord is one NDJSON line of an import: either a session or an event.
+// Sessions must appear before the events that reference them.
+type ImportRecord struct {
+	Type      string           `json:"type"`
+	Session   *ImportedSession `json:"session,omitempty"`
+	SessionID string           `json:"session_id,omitempty"`
+	Event     *EventData       `json:"event,omitempty"`
+}
+
+// ImportedSession is a historical session with its original ID and timing
+type ImportedSession struct {
+	CreateSessionRequest
+	SessionID      uuid.UUID  `json:"session_id"`
+	StartedAt      time.Time  `json:"started_at"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"`
+	LastActivityAt *time.Time `json:"last_activity_at,omitempty"`
+	Country        *string    `json:"country,omitempty"`
+	City           *string    `json:"city,omitempty"`
+}
+
+// MappingReport summarizes what a third-party export converter could not carry over
+type MappingReport struct {
+	RecordsIn          int64            `json:"records_in"`
+	SessionsOut        int64            `json:"sessions_out"`
+	EventsOut          int64            `json:"events_out"`
+	DroppedRecords     map[string]int64 `json:"dropped_records,omitempty"`
+	DroppedFields      map[string]int64 `json:"dropped_fields,omitempty"`
+	UnmappedEventTypes map[string]int64 `json:"unmapped_event_types,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Issue struct {
+	IssueID         int64        `json:"issue_id" db:"issue_id"`
+	Fingerprint     string       `json:"fingerprint" db:"fingerprint"`
+	ErrorMessage    *string      `json:"error_message,omitempty" db:"error_message"`
+	PageURL         string       `json:"page_url" db:"page_url"`
+	TargetSelector  *string      `json:"target_selector,omitempty" db:"target_selector"`
+	FirstSeenAt     time.Time    `json:"first_seen_at" db:"first_seen_at"`
+	LastSeenAt      time.Time    `json:"last_seen_at" db:"last_seen_at"`
+	OccurrenceCount int          `json:"occurrence_count" db:"occurrence_count"`
+	Trend           []TrendPoint `json:"trend,omitempty"`
+}
+
+// TrendPoint is the number of occurrences in one time bucket
+type TrendPoint struct {
+	Bucket time.Time `json:"bucket"`
+	Count  int64     `json:"count"`
+}
+
+// IssueSignal is a single error or rage click event used for clustering
+type IssueSignal struct {
+	SessionID      uuid.UUID
+	Timestamp      time.Time
+	EventType      EventType
+	PageURL        string
+	ErrorMessage   *string
+	TargetSelector *string
+}
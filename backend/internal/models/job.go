@@ -0,0 +1,42 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+// JobProgress counts the units of work done; Total is nil when unknown
+type JobProgress struct {
+	Done  int64  `json:"done"`
+	Total *int64 `json:"total,omitempty"`
+}
+
+// Job is a long-running background task. Generic jobs live in the jobs table; imports
+// and exports are presented in the same shape so clients can poll any of them.
+type Job struct {
+	JobID       uuid.UUID       `json:"job_id" db:"job_id"`
+	Type        string          `json:"type" db:"type"`
+	Status      JobStatus       `json:"status" db:"status"`
+	Payload     json.RawMessage `json:"payload,omitempty" db:"payload"`
+	Progress    JobProgress     `json:"progress"`
+	Result      json.RawMessage `json:"result,omitempty" db:"result"`
+	Error       *string         `json:"error,omitempty" db:"error"`
+	Attempts    int             `json:"attempts" db:"attempts"`
+	MaxAttempts int             `json:"max_attempts" db:"max_attempts"`
+	RunAfter    *time.Time      `json:"run_after,omitempty" db:"run_after"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty" db:"started_at"`
+	UpdatedAt   *time.Time      `json:"updated_at,omitempty" db:"updated_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty" db:"finished_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// External systems a session can be linked to
+const (
+	LinkTypeZendesk  = "zendesk"
+	LinkTypeJira     = "jira"
+	LinkTypeIntercom = "intercom"
+)
+
+// LinkTypes lists the supported link types
+var LinkTypes = []string{LinkTypeZendesk, LinkTypeJira, LinkTypeIntercom}
+
+// SessionLink attaches an external reference, such as a support ticket, to a session
+type SessionLink struct {
+	LinkID     int64     `json:"link_id"`
+	SessionID  uuid.UUID `json:"session_id"`
+	Type       string    `json:"type"`
+	ExternalID string    `json:"external_id"`
+	URL        *string   `json:"url,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CreateSessionLinkRequest is the body of POST /sessions/:id/links
+type CreateSessionLinkRequest struct {
+	Type       string  `json:"type"`
+	ExternalID string  `json:"external_id"`
+	URL        *string `json:"url,omitempty"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session liveness statuses
+const (
+	LivenessLive  = "live"
+	LivenessEnded = "ended"
+)
+
+// SessionLiveness tells whether a session is still being recorded. LastEventAt is
+// when the server last received events for it, or its last_activity_at once no newer
+// record is kept; LastHeartbeatAt is when one of its tabs last sent a heartbeat.
+type SessionLiveness struct {
+	SessionID           uuid.UUID  `json:"session_id"`
+	Status              string     `json:"status"`
+	Heartbeating        bool       `json:"heartbeating"`
+	LastEventAt         *time.Time `json:"last_event_at,omitempty"`
+	LastEventSecondsAgo *float64   `json:"last_event_seconds_ago,omitempty"`
+	LastHeartbeatAt     *time.Time `json:"last_heartbeat_at,omitempty"`
+	CheckedAt           time.Time  `json:"checked_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+type Marker struct {
+	MarkerID    int64                  `json:"marker_id" db:"marker_id"`
+	Project     string                 `json:"project" db:"project"`
+	Kind        string                 `json:"kind" db:"kind"`
+	Version     *string                `json:"version,omitempty" db:"version"`
+	Description *string                `json:"description,omitempty" db:"description"`
+	Timestamp   time.Time              `json:"timestamp" db:"timestamp"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty" db:"metadata"`
+	CreatedAt   time.Time              `json:"created_at" db:"created_at"`
+}
+
+type CreateMarkerRequest struct {
+	Project     string                 `json:"project"`
+	Kind        string                 `json:"kind"`
+	Version     *string                `json:"version,omitempty"`
+	Description *string                `json:"description,omitempty"`
+	Timestamp   *time.Time             `json:"timestamp,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
@@ -12,6 +12,7 @@ type Screenshot struct {
 	PageURL      string    `json:"page_url" db:"page_url"`
 	Timestamp    time.Time `json:"timestamp" db:"timestamp"`
 	ImageData    []byte    `json:"-" db:"image_data"`
+	StorageKey   *string   `json:"-" db:"storage_key"`
 	ImageFormat  string    `json:"image_format" db:"image_format"`
 	ImageWidth   *int      `json:"image_width,omitempty" db:"image_width"`
 	ImageHeight  *int      `json:"image_height,omitempty" db:"image_height"`
@@ -38,4 +39,29 @@ type UploadScreenshotRequest struct {
 	ImageData string    `json:"image_data" validate:"required"`
 	Width     *int      `json:"width,omitempty"`
 	Height    *int      `json:"height,omitempty"`
+	// Assets lists the stylesheets and images the page referenced, absolute or
+	// relative to PageURL, for the replay asset cache
+	Assets []string `json:"assets,omitempty"`
+}
+
+// ScreenshotDiff compares one screenshot with the previous one in the same session
+type ScreenshotDiff struct {
+	FromScreenshotID int64     `json:"from_screenshot_id"`
+	ToScreenshotID   int64     `json:"to_screenshot_id"`
+	FromTimestamp    time.Time `json:"from_timestamp"`
+	ToTimestamp      time.Time `json:"to_timestamp"`
+	PageURL          string    `json:"page_url"`
+	PageChanged      bool      `json:"page_changed"`
+	DiffPercent      float64   `json:"diff_percent"`
+	Changed          bool      `json:"changed"`
+	// Region bounds the changed pixels in the later screenshot
+	Region *ScreenshotRegion `json:"region,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+type ScreenshotRegion struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
 }
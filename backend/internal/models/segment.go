@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Segment message types accepted by the /v1 compatibility endpoints
+const (
+	SegmentTypeTrack    = "track"
+	SegmentTypePage     = "page"
+	SegmentTypeScreen   = "screen"
+	SegmentTypeIdentify = "identify"
+)
+
+// SegmentMessage is one call of the Segment spec, as sent by analytics.js and the
+// Segment server libraries
+type SegmentMessage struct {
+	Type        string                 `json:"type"`
+	MessageID   string                 `json:"messageId"`
+	AnonymousID string                 `json:"anonymousId"`
+	UserID      string                 `json:"userId"`
+	Event       string                 `json:"event"`
+	Name        string                 `json:"name"`
+	Category    string                 `json:"category"`
+	Properties  map[string]interface{} `json:"properties"`
+	Traits      map[string]interface{} `json:"traits"`
+	Context     SegmentContext         `json:"context"`
+	Timestamp   *time.Time             `json:"timestamp"`
+	WriteKey    string                 `json:"writeKey"`
+}
+
+// SegmentContext holds the parts of a message's context mapped onto sessions
+type SegmentContext struct {
+	Page struct {
+		URL      string `json:"url"`
+		Referrer string `json:"referrer"`
+		Title    string `json:"title"`
+	} `json:"page"`
+	Screen struct {
+		Width  *int `json:"width"`
+		Height *int `json:"height"`
+	} `json:"screen"`
+	Library struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"library"`
+	UserAgent string                 `json:"userAgent"`
+	Traits    map[string]interface{} `json:"traits"`
+}
+
+// SegmentBatchRequest is the body of POST /v1/batch
+type SegmentBatchRequest struct {
+	Batch    []SegmentMessage `json:"batch"`
+	WriteKey string           `json:"writeKey"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// TabTimeline is the part of a session's timeline recorded in one browser tab
+type TabTimeline struct {
+	// TabID is nil for events from SDKs that do not send tab_id
+	TabID      *string   `json:"tab_id"`
+	EventCount int       `json:"event_count"`
+	FirstEvent time.Time `json:"first_event_at"`
+	LastEvent  time.Time `json:"last_event_at"`
+	Events     []*Event  `json:"events"`
+}
+
+// GroupEventsByTab splits time-ordered events into one timeline per tab, ordered by
+// each tab's first event
+func GroupEventsByTab(events []*Event) []*TabTimeline {
+	tabs := []*TabTimeline{}
+	byTab := make(map[string]*TabTimeline)
+	for _, event := range events {
+		key := ""
+		if event.TabID != nil {
+			key = "tab:" + *event.TabID
+		}
+
+		tab, ok := byTab[key]
+		if !ok {
+			tab = &TabTimeline{TabID: event.TabID, FirstEvent: event.Timestamp}
+			byTab[key] = tab
+			tabs = append(tabs, tab)
+		}
+		tab.Events = append(tab.Events, event)
+		tab.EventCount++
+		tab.LastEvent = event.Timestamp
+	}
+	return tabs
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TrackerKey is a public key the tracker snippet exchanges for short-lived tracker
+// tokens. Rotating it replaces the public key and invalidates the tokens issued so
+// far; revoking it stops both.
+type TrackerKey struct {
+	KeyID           uuid.UUID `json:"key_id"`
+	Name            string    `json:"name"`
+	PublicKey       string    `json:"public_key"`
+	AllowedOrigins  []string  `json:"allowed_origins"`
+	TokensNotBefore time.Time `json:"tokens_not_before"`
+	// Sandbox keys create sandbox sessions, left out of analytics and purged nightly
+	Sandbox bool `json:"sandbox"`
+	// Throttles advertised to SDKs using this key; nil uses the server default
+	MouseMoveThrottleMs *int       `json:"mousemove_throttle_ms"`
+	ScrollThrottleMs    *int       `json:"scroll_throttle_ms"`
+	RevokedAt           *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	// Recording settings baked into the served tracker script
+	TrackerKeyRecording
+}
+
+// CreateTrackerKeyRequest is the body of POST /admin/tracker-keys
+type CreateTrackerKeyRequest struct {
+	Name           string   `json:"name"`
+	AllowedOrigins []string `json:"allowed_origins"`
+	Sandbox        bool     `json:"sandbox"`
+	TrackerKeyThrottles
+}
+
+// TrackerKeyThrottles is the body of PUT /admin/tracker-keys/:id/throttles; null
+// resets a throttle to the server default
+type TrackerKeyThrottles struct {
+	MouseMoveThrottleMs *int `json:"mousemove_throttle_ms"`
+	ScrollThrottleMs    *int `json:"scroll_throttle_ms"`
+}
+
+// TrackerKeyRecording is the body of PUT /admin/tracker-keys/:id/recording: the share
+// of visitors the served tracker script records, from 0 to 1, and CSS selectors of
+// inputs it masks besides the built-in sensitive ones
+type TrackerKeyRecording struct {
+	SampleRate    float64  `json:"sample_rate"`
+	MaskSelectors []string `json:"mask_selectors"`
+}
+
+// TrackerTokenRequest is the body of POST /track/token
+type TrackerTokenRequest struct {
+	PublicKey string `json:"public_key"`
+}
+
+// TrackerTokenResponse carries a signed tracker token; the SDK should exchange its
+// public key again before ExpiresAt
+type TrackerTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	ExpiresIn int64     `json:"expires_in"`
+}
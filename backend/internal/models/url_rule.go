@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// URLRule rewrites page URLs at ingest into events.normalized_url, so page analytics
+// group URLs that differ only in IDs or tracking parameters. A rule strips query
+// parameters, replaces Pattern matches with Replacement, or both, in that order.
+type URLRule struct {
+	RuleID uuid.UUID `json:"rule_id"`
+	// KeyID is the tracker key (project) the rule applies to; nil applies it to all
+	KeyID       *uuid.UUID `json:"key_id"`
+	Position    int        `json:"position"`
+	StripParams []string   `json:"strip_params"`
+	Pattern     *string    `json:"pattern"`
+	Replacement string     `json:"replacement"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// CreateURLRuleRequest is the body of POST /admin/url-rules
+type CreateURLRuleRequest struct {
+	KeyID       *uuid.UUID `json:"key_id"`
+	Position    int        `json:"position"`
+	StripParams []string   `json:"strip_params"`
+	Pattern     *string    `json:"pattern"`
+	Replacement string     `json:"replacement"`
+}
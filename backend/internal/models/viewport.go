@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// Viewport is a browser viewport size in CSS pixels
+type Viewport struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Valid reports whether both dimensions are known
+func (v Viewport) Valid() bool {
+	return v.Width > 0 && v.Height > 0
+}
+
+// ViewportChange is an entry of a session's viewport history: the viewport size from
+// Timestamp on
+type ViewportChange struct {
+	Timestamp time.Time `json:"timestamp"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+}
+
+// ViewportChanges returns the viewport changes reported by resize events among events
+func ViewportChanges(events []EventData) []ViewportChange {
+	var changes []ViewportChange
+	for i := range events {
+		if v, ok := events[i].ResizedViewport(); ok {
+			changes = append(changes, ViewportChange{Timestamp: events[i].Timestamp.UTC(), Width: v.Width, Height: v.Height})
+		}
+	}
+	return changes
+}
+
+// ResizedViewport returns the viewport a resize event reports in its event_data
+// ({"width": ..., "height": ...})
+func (e *EventData) ResizedViewport() (Viewport, bool) {
+	if e.EventType != EventTypeResize {
+		return Viewport{}, false
+	}
+	width, okW := e.EventData["width"].(float64)
+	height, okH := e.EventData["height"].(float64)
+	v := Viewport{Width: int(width), Height: int(height)}
+	return v, okW && okH && v.Valid()
+}
+
+// NormalizeCoordinates sets NormX/NormY of events with viewport coordinates to their
+// position within the viewport, clamped to [0,1]. events must be in time order and
+// start in viewport; resize events among them update it for the events that follow.
+// Events are left unnormalized while the viewport is unknown.
+func NormalizeCoordinates(events []EventData, viewport Viewport) {
+	for i := range events {
+		event := &events[i]
+		if resized, ok := event.ResizedViewport(); ok {
+			viewport = resized
+			continue
+		}
+		if !viewport.Valid() {
+			continue
+		}
+		event.NormX = normalize(event.ViewportX, viewport.Width)
+		event.NormY = normalize(event.ViewportY, viewport.Height)
+	}
+}
+
+func normalize(coord *float64, size int) *float64 {
+	if coord == nil {
+		return nil
+	}
+	n := min(max(*coord/float64(size), 0), 1)
+	return &n
+}
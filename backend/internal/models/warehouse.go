@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Warehouses a connector can load into
+const (
+	WarehouseBigQuery  = "bigquery"
+	WarehouseSnowflake = "snowflake"
+)
+
+// Outcomes of a warehouse connector run
+const (
+	WarehouseRunSucceeded = "succeeded"
+	WarehouseRunFailed    = "failed"
+)
+
+// WarehouseConnector loads a project's sessions and events into a warehouse on a cron
+// schedule. Each run continues after the cursors of the previous one.
+type WarehouseConnector struct {
+	ConnectorID uuid.UUID         `json:"connector_id"`
+	Name        string            `json:"name"`
+	Kind        string            `json:"kind"`
+	Project     string            `json:"project"`
+	Config      map[string]string `json:"config"`
+	Credentials string            `json:"-"`
+	Cron        string            `json:"cron"`
+	Timezone    string            `json:"timezone"`
+	// DelaySeconds holds back rows younger than the delay for a later run
+	DelaySeconds  int       `json:"delay_seconds"`
+	Enabled       bool      `json:"enabled"`
+	NextRunAt     time.Time `json:"next_run_at"`
+	SchemaVersion int       `json:"schema_version"`
+	// SessionsAt and SessionsID are the update time and ID of the last session loaded
+	SessionsAt *time.Time `json:"sessions_cursor_at,omitempty"`
+	SessionsID *uuid.UUID `json:"sessions_cursor_id,omitempty"`
+	// EventsAt and EventsID are the ingest time and ID of the last event loaded
+	EventsAt *time.Time `json:"events_cursor_at,omitempty"`
+	EventsID *int64     `json:"events_cursor_id,omitempty"`
+	// SessionsLoaded and EventsLoaded count the rows loaded since the connector was created
+	SessionsLoaded      int64      `json:"sessions_loaded"`
+	EventsLoaded        int64      `json:"events_loaded"`
+	LastRunAt           *time.Time `json:"last_run_at,omitempty"`
+	LastStatus          *string    `json:"last_status,omitempty"`
+	LastError           *string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// Delay returns how long rows are held back before they are loaded
+func (c *WarehouseConnector) Delay() time.Duration {
+	return time.Duration(c.DelaySeconds) * time.Second
+}
+
+// CreateWarehouseConnectorRequest defines a connector. Delay is a Go duration ("1h");
+// Credentials is the service account key JSON (BigQuery) or PEM private key (Snowflake).
+type CreateWarehouseConnectorRequest struct {
+	Name        string            `json:"name"`
+	Kind        string            `json:"kind"`
+	Project     string            `json:"project,omitempty"`
+	Config      map[string]string `json:"config"`
+	Credentials string            `json:"credentials"`
+	Cron        string            `json:"cron"`
+	Timezone    string            `json:"timezone,omitempty"`
+	Delay       string            `json:"delay,omitempty"`
+	Enabled     *bool             `json:"enabled,omitempty"`
+}
+
+// UpdateWarehouseConnectorRequest changes the fields that are set. A new Config
+// replaces the old one.
+type UpdateWarehouseConnectorRequest struct {
+	Name        *string           `json:"name,omitempty"`
+	Config      map[string]string `json:"config,omitempty"`
+	Credentials *string           `json:"credentials,omitempty"`
+	Cron        *string           `json:"cron,omitempty"`
+	Timezone    *string           `json:"timezone,omitempty"`
+	Delay       *string           `json:"delay,omitempty"`
+	Enabled     *bool             `json:"enabled,omitempty"`
+}
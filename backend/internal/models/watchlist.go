@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Identity types a watchlist subscription can match
+const (
+	WatchIdentityUserID      = "user_id"
+	WatchIdentityFingerprint = "fingerprint"
+)
+
+// WatchSubscription pins new sessions of one user_id or fingerprint
+type WatchSubscription struct {
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	IdentityType   string    `json:"identity_type"`
+	Identity       *string   `json:"identity,omitempty"`
+	Label          *string   `json:"label,omitempty"`
+	NotifyURL      *string   `json:"notify_url,omitempty"`
+	Enabled        bool      `json:"enabled"`
+	SessionCount   int64     `json:"session_count"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// CreateWatchSubscriptionRequest is the body of POST /watchlist
+type CreateWatchSubscriptionRequest struct {
+	IdentityType string  `json:"identity_type"`
+	Identity     string  `json:"identity"`
+	Label        *string `json:"label,omitempty"`
+	NotifyURL    *string `json:"notify_url,omitempty"`
+}
+
+// WatchedSession is a session pinned by a subscription, with its notification state
+type WatchedSession struct {
+	SubscriptionID uuid.UUID  `json:"subscription_id"`
+	Label          *string    `json:"label,omitempty"`
+	MatchedAt      time.Time  `json:"matched_at"`
+	NotifiedAt     *time.Time `json:"notified_at,omitempty"`
+	NotifyAttempts int        `json:"notify_attempts"`
+	NotifyError    *string    `json:"notify_error,omitempty"`
+	Session        *Session   `json:"session"`
+}
+
+// WatchMatch is a newly pinned session awaiting notification
+type WatchMatch struct {
+	Subscription WatchSubscription
+	Session      Session
+	Attempts     int
+}
@@ -0,0 +1,46 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor is an opaque keyset position: the sort timestamp plus a tie-breaking ID
+type Cursor struct {
+	Timestamp time.Time
+	ID        string
+}
+
+// Encode serializes the cursor into a URL-safe token
+func (c Cursor) Encode() string {
+	raw := fmt.Sprintf("%d:%s", c.Timestamp.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Decode parses a token produced by Encode
+func Decode(token string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("malformed cursor: %w", err)
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return Cursor{}, fmt.Errorf("malformed cursor")
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("malformed cursor timestamp: %w", err)
+	}
+
+	return Cursor{Timestamp: time.Unix(0, nanos), ID: parts[1]}, nil
+}
+
+// Int64ID parses the cursor ID as an integer key
+func (c Cursor) Int64ID() (int64, error) {
+	return strconv.ParseInt(c.ID, 10, 64)
+}
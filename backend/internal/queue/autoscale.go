@@ -0,0 +1,125 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Autoscaling defaults used when ProcessorConfig leaves them unset
+const (
+	DefaultScaleInterval = 15 * time.Second
+	DefaultScaleBacklog  = 1000
+)
+
+// autoscaling reports whether the worker count follows the backlog
+func (ep *EventProcessor) autoscaling() bool {
+	return ep.config.MaxWorkers > ep.config.WorkerCount
+}
+
+// maxWorkers is the most workers the processor ever runs
+func (ep *EventProcessor) maxWorkers() int {
+	if ep.autoscaling() {
+		return ep.config.MaxWorkers
+	}
+	return ep.config.WorkerCount
+}
+
+// ActiveWorkers returns the number of workers currently reading the queue
+func (ep *EventProcessor) ActiveWorkers() int {
+	ep.workersMu.Lock()
+	defer ep.workersMu.Unlock()
+	return len(ep.workers)
+}
+
+// autoscale adjusts the worker count to the backlog every ScaleInterval until the
+// processor stops. The backlog (undelivered plus unacknowledged messages) is used
+// rather than the stream length, which also counts processed entries kept until
+// trimming.
+func (ep *EventProcessor) autoscale(ctx context.Context) {
+	defer ep.wg.Done()
+
+	interval := ep.config.ScaleInterval
+	if interval <= 0 {
+		interval = DefaultScaleInterval
+	}
+	log.Printf("[Autoscaler] Started, %d-%d workers, every %v", ep.config.WorkerCount, ep.config.MaxWorkers, interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ep.stopChan:
+			log.Println("[Autoscaler] Stopped")
+			return
+		case <-ticker.C:
+			ep.rescale(ctx)
+		}
+	}
+}
+
+// rescale starts every worker the backlog calls for at once, so spikes drain quickly,
+// but retires only one per interval, so a briefly empty stream does not shed the
+// workers the next wave needs. Nothing changes while the health gate holds reads back.
+func (ep *EventProcessor) rescale(ctx context.Context) {
+	if paused, _ := ep.gate.Paused(); paused {
+		return
+	}
+
+	backlog, err := ep.queue.GetBacklog(ctx)
+	if err != nil {
+		log.Printf("[Autoscaler] Error getting queue backlog: %v", err)
+		return
+	}
+	target := targetWorkers(backlog, ep.config.ScaleBacklog, ep.config.WorkerCount, ep.config.MaxWorkers)
+
+	ep.workersMu.Lock()
+	defer ep.workersMu.Unlock()
+
+	// Stop may have closed stopChan since the tick; started workers would never be
+	// waited for
+	select {
+	case <-ep.stopChan:
+		return
+	default:
+	}
+
+	current := len(ep.workers)
+	switch {
+	case target > current:
+		for id := current; id < target; id++ {
+			w := &Worker{
+				id:        id,
+				processor: ep,
+				queue:     ep.streams[id%len(ep.streams)],
+				stopChan:  make(chan struct{}),
+			}
+			ep.workers = append(ep.workers, w)
+			ep.wg.Add(1)
+			go w.Run(ctx)
+		}
+		log.Printf("[Autoscaler] Backlog %d: scaled up from %d to %d workers", backlog, current, target)
+	case target < current:
+		last := ep.workers[current-1]
+		ep.workers = ep.workers[:current-1]
+		close(last.stopChan)
+		log.Printf("[Autoscaler] Backlog %d: scaled down from %d to %d workers", backlog, current, current-1)
+	}
+}
+
+// targetWorkers returns one worker per perWorker messages of backlog, rounded up and
+// kept within [low, high]
+func targetWorkers(backlog, perWorker int64, low, high int) int {
+	if perWorker <= 0 {
+		perWorker = DefaultScaleBacklog
+	}
+	target := int((backlog + perWorker - 1) / perWorker)
+	if target < low {
+		return low
+	}
+	if target > high {
+		return high
+	}
+	return target
+}
@@ -0,0 +1,98 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Backpressure samples the queue backlog every interval so ingest can turn batches
+// away once the processor falls behind by more than maxDepth messages, instead of
+// piling them into a stream that trims its oldest entries at MaxLen. Requests read
+// the last sample and never wait on Redis. A nil *Backpressure never pushes back.
+type Backpressure struct {
+	queue    Queue
+	maxDepth int64
+	interval time.Duration
+	depth    atomic.Int64
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewBackpressure creates a sampler for q; Start begins sampling
+func NewBackpressure(q Queue, maxDepth int64, interval time.Duration) *Backpressure {
+	return &Backpressure{
+		queue:    q,
+		maxDepth: maxDepth,
+		interval: interval,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start takes a first sample and keeps sampling in the background until Stop
+func (b *Backpressure) Start(ctx context.Context) {
+	if b == nil {
+		return
+	}
+	b.sample(ctx)
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-b.stopChan:
+				return
+			case <-ticker.C:
+				b.sample(ctx)
+			}
+		}
+	}()
+
+	log.Printf("[Backpressure] Started, max depth: %d, interval: %v", b.maxDepth, b.interval)
+}
+
+// Stop ends sampling
+func (b *Backpressure) Stop() {
+	if b == nil {
+		return
+	}
+	close(b.stopChan)
+	b.wg.Wait()
+	log.Println("[Backpressure] Stopped")
+}
+
+// sample reads the backlog. A failed read keeps the previous sample: when Redis is
+// down enqueuing fails on its own.
+func (b *Backpressure) sample(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, b.interval)
+	defer cancel()
+
+	depth, err := b.queue.GetBacklog(ctx)
+	if err != nil {
+		log.Printf("[Backpressure] Failed to get queue backlog: %v", err)
+		return
+	}
+	if previous := b.depth.Swap(depth); (previous > b.maxDepth) != (depth > b.maxDepth) {
+		if depth > b.maxDepth {
+			log.Printf("[Backpressure] Queue backlog %d is over %d, rejecting event batches", depth, b.maxDepth)
+		} else {
+			log.Printf("[Backpressure] Queue backlog %d is back under %d, accepting event batches", depth, b.maxDepth)
+		}
+	}
+}
+
+// Exceeded returns the last sampled backlog and limit, and whether the backlog is
+// over the limit
+func (b *Backpressure) Exceeded() (depth, maxDepth int64, over bool) {
+	if b == nil {
+		return 0, 0, false
+	}
+	depth = b.depth.Load()
+	return depth, b.maxDepth, depth > b.maxDepth
+}
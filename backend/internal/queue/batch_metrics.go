@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/stats"
+)
+
+// BatchMetrics are the processor's batch size and insert latency distributions since
+// the process started, for tuning BatchSize and WorkerCount. InsertRetries counts
+// retried inserts and RetriesExhausted the session batches left pending after their
+// last attempt. WorkerCount is the number of workers running now, which the
+// autoscaler moves up to MaxWorkers.
+type BatchMetrics struct {
+	EventsPerMessage stats.HistogramSnapshot `json:"events_per_message"`
+	MessagesPerBatch stats.HistogramSnapshot `json:"messages_per_batch"`
+	SessionsPerBatch stats.HistogramSnapshot `json:"sessions_per_batch"`
+	InsertDurationMs stats.HistogramSnapshot `json:"insert_duration_ms"`
+	InsertAttempts   stats.HistogramSnapshot `json:"insert_attempts"`
+	InsertRetries    int64                   `json:"insert_retries"`
+	RetriesExhausted int64                   `json:"retries_exhausted"`
+	BatchSize        int64                   `json:"batch_size"`
+	WorkerCount      int                     `json:"worker_count"`
+	MaxWorkers       int                     `json:"max_workers"`
+	SessionShards    int                     `json:"session_shards"`
+	StreamShards     int                     `json:"stream_shards"`
+	MaxRetries       int                     `json:"max_retries"`
+	RetryDelayMs     int64                   `json:"retry_delay_ms"`
+	// Paused is set while the health gate holds consumption back
+	Paused      bool       `json:"paused"`
+	PausedSince *time.Time `json:"paused_since,omitempty"`
+	// Breaker is the write circuit breaker's state, BreakerOpenedAt set unless closed
+	Breaker         string     `json:"breaker"`
+	BreakerOpenedAt *time.Time `json:"breaker_opened_at,omitempty"`
+}
+
+// batchHistograms holds the histograms behind BatchMetrics. A read batch is one
+// XREADGROUP result; an insert is one CreateBatch call for a session within it.
+type batchHistograms struct {
+	eventsPerMessage *stats.Histogram
+	messagesPerBatch *stats.Histogram
+	sessionsPerBatch *stats.Histogram
+	insertDuration   *stats.Histogram
+	insertAttempts   *stats.Histogram
+	retries          atomic.Int64
+	retriesExhausted atomic.Int64
+}
+
+func newBatchHistograms() *batchHistograms {
+	counts := []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+	return &batchHistograms{
+		eventsPerMessage: stats.NewHistogram(counts...),
+		messagesPerBatch: stats.NewHistogram(counts...),
+		sessionsPerBatch: stats.NewHistogram(counts...),
+		insertDuration:   stats.NewHistogram(1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000),
+		insertAttempts:   stats.NewHistogram(1, 2, 3, 4, 5, 10),
+	}
+}
+
+// observeBatch records one read batch's message, session and per-message event counts
+func (h *batchHistograms) observeBatch(messages []StreamMessage, sessions int) {
+	h.messagesPerBatch.Observe(float64(len(messages)))
+	h.sessionsPerBatch.Observe(float64(sessions))
+	for _, msg := range messages {
+		h.eventsPerMessage.Observe(float64(len(msg.QueuedEvent.Events)))
+	}
+}
+
+func (h *batchHistograms) observeInsert(elapsed time.Duration) {
+	h.insertDuration.Observe(float64(elapsed) / float64(time.Millisecond))
+}
+
+// observeAttempts records how many inserts one session batch took, retries included
+func (h *batchHistograms) observeAttempts(attempts int) {
+	h.insertAttempts.Observe(float64(attempts))
+}
+
+// BatchMetrics returns the batch size and insert latency distributions of this
+// process's workers
+func (ep *EventProcessor) BatchMetrics() *BatchMetrics {
+	paused, since := ep.gate.Paused()
+	metrics := &BatchMetrics{
+		EventsPerMessage: ep.histograms.eventsPerMessage.Snapshot(),
+		MessagesPerBatch: ep.histograms.messagesPerBatch.Snapshot(),
+		SessionsPerBatch: ep.histograms.sessionsPerBatch.Snapshot(),
+		InsertDurationMs: ep.histograms.insertDuration.Snapshot(),
+		InsertAttempts:   ep.histograms.insertAttempts.Snapshot(),
+		InsertRetries:    ep.histograms.retries.Load(),
+		RetriesExhausted: ep.histograms.retriesExhausted.Load(),
+		BatchSize:        ep.config.BatchSize,
+		WorkerCount:      ep.ActiveWorkers(),
+		MaxWorkers:       ep.maxWorkers(),
+		SessionShards:    ep.config.SessionShards,
+		StreamShards:     len(ep.streams),
+		MaxRetries:       ep.config.MaxRetries,
+		RetryDelayMs:     ep.config.RetryDelay.Milliseconds(),
+		Paused:           paused,
+	}
+	if paused {
+		metrics.PausedSince = &since
+	}
+	var openedAt time.Time
+	metrics.Breaker, openedAt = ep.breaker.State()
+	if metrics.Breaker != BreakerClosed {
+		metrics.BreakerOpenedAt = &openedAt
+	}
+	return metrics
+}
@@ -0,0 +1,163 @@
+package queue
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// Circuit breaker states, as reported in BatchMetrics
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// circuitBreaker stops workers from reading while database writes keep failing.
+// Unlike the HealthGate, which pings the database, it reacts to the writes themselves,
+// e.g. a full disk or a locked table that pings do not notice. failures consecutive
+// retryable CreateBatch errors open it; messages already read stay pending in the
+// stream. After cooldown one worker is let through as a probe (half-open): its writes
+// close the breaker or open it again. A nil *circuitBreaker is always closed.
+type circuitBreaker struct {
+	failures int
+	cooldown time.Duration
+
+	mu          sync.Mutex
+	state       string
+	consecutive int
+	openedAt    time.Time
+	// changed is closed and replaced whenever the state changes, waking waiters
+	changed chan struct{}
+}
+
+// newCircuitBreaker returns nil, a breaker that never opens, when failures < 1
+func newCircuitBreaker(failures int, cooldown time.Duration) *circuitBreaker {
+	if failures < 1 {
+		return nil
+	}
+	return &circuitBreaker{
+		failures: failures,
+		cooldown: cooldown,
+		state:    BreakerClosed,
+		changed:  make(chan struct{}),
+	}
+}
+
+// Wait returns at once while the breaker is closed. While it is open it blocks until
+// the cooldown has passed; the first worker then becomes the probe and probe is true.
+// Others wait for the probe's outcome. It returns ok false when stop is closed first.
+func (b *circuitBreaker) Wait(stop <-chan struct{}) (probe, ok bool) {
+	if b == nil {
+		return false, true
+	}
+	for {
+		b.mu.Lock()
+		var timer <-chan time.Time
+		switch b.state {
+		case BreakerClosed:
+			b.mu.Unlock()
+			return false, true
+		case BreakerOpen:
+			remaining := b.cooldown - time.Since(b.openedAt)
+			if remaining <= 0 {
+				b.setState(BreakerHalfOpen)
+				b.mu.Unlock()
+				log.Printf("[CircuitBreaker] Half-open after %v, probing database writes", b.cooldown)
+				return true, true
+			}
+			timer = time.After(remaining)
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-stop:
+			return false, false
+		case <-changed:
+		case <-timer:
+		}
+	}
+}
+
+// record feeds the outcome of one CreateBatch call to the breaker. Errors that are
+// not retryable mean the database answered, so they count as successes here.
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil || !repository.IsRetryable(err) {
+		b.consecutive = 0
+		if b.state != BreakerClosed {
+			log.Printf("[CircuitBreaker] Closed after %v, database writes succeed again", time.Since(b.openedAt).Round(time.Second))
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+
+	b.consecutive++
+	switch {
+	case b.state == BreakerHalfOpen:
+		log.Printf("[CircuitBreaker] Probe failed, open again for %v: %v", b.cooldown, err)
+		b.open()
+	case b.state == BreakerClosed && b.consecutive >= b.failures:
+		log.Printf("[CircuitBreaker] Open for %v after %d consecutive failed writes, pausing event consumption: %v", b.cooldown, b.consecutive, err)
+		b.open()
+	}
+}
+
+// probeDone ends a probe that wrote nothing, e.g. because the stream was empty; with
+// no failure seen the breaker closes
+func (b *circuitBreaker) probeDone() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen {
+		log.Println("[CircuitBreaker] Closed, probe read nothing to write")
+		b.consecutive = 0
+		b.setState(BreakerClosed)
+	}
+}
+
+// Tripped reports whether the breaker is open, so writes should not be attempted
+func (b *circuitBreaker) Tripped() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == BreakerOpen
+}
+
+// State returns the breaker state and, unless closed, when it opened
+func (b *circuitBreaker) State() (string, time.Time) {
+	if b == nil {
+		return BreakerClosed, time.Time{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerClosed {
+		return BreakerClosed, time.Time{}
+	}
+	return b.state, b.openedAt
+}
+
+// open must be called with mu held
+func (b *circuitBreaker) open() {
+	b.openedAt = time.Now()
+	b.setState(BreakerOpen)
+}
+
+// setState must be called with mu held
+func (b *circuitBreaker) setState(state string) {
+	b.state = state
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
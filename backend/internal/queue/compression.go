@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Payload compression modes selectable with QUEUE_COMPRESSION. Compressed entries
+// carry their encoding in an "encoding" field next to "data", so readers decode
+// entries of any mode and the setting can change while the stream holds entries.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// DefaultCompressMinBytes is the payload size below which entries are stored as is;
+// small batches gain little and cost the processor a decode
+const DefaultCompressMinBytes = 1024
+
+// maxDecodedPayload bounds the size a compressed entry may expand to
+const maxDecodedPayload = 64 * 1024 * 1024
+
+// CheckCompression returns an error unless mode names a compression mode
+func CheckCompression(mode string) error {
+	switch mode {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	}
+	return fmt.Errorf("unknown compression %q; use %q, %q or %q", mode, CompressionNone, CompressionGzip, CompressionZstd)
+}
+
+// The zstd encoder and decoder are safe for concurrent EncodeAll/DecodeAll calls and
+// expensive to create, so one of each is shared
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func zstdCodec() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxDecodedPayload))
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+// entryValues returns the stream entry fields holding a serialized QueuedEvent,
+// compressed when the queue is configured to and the payload is large enough
+func (eq *EventQueue) entryValues(data []byte) (map[string]interface{}, error) {
+	if eq.compression == CompressionNone || len(data) < eq.compressMinBytes {
+		return map[string]interface{}{"data": string(data)}, nil
+	}
+
+	compressed, err := compressPayload(eq.compression, data)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"data":     string(compressed),
+		"encoding": eq.compression,
+	}, nil
+}
+
+func compressPayload(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case CompressionZstd:
+		encoder, _, err := zstdCodec()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		return encoder.EncodeAll(data, make([]byte, 0, len(data)/4)), nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to gzip payload: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip payload: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown compression %q", encoding)
+}
+
+// entryPayload returns the serialized QueuedEvent of a stream entry, decompressing it
+// as its encoding field says
+func entryPayload(values map[string]interface{}) ([]byte, error) {
+	data, ok := values["data"].(string)
+	if !ok {
+		return nil, fmt.Errorf("entry has no data")
+	}
+
+	encoding, _ := values["encoding"].(string)
+	switch encoding {
+	case "", CompressionNone:
+		return []byte(data), nil
+	case CompressionZstd:
+		_, decoder, err := zstdCodec()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+		payload, err := decoder.DecodeAll([]byte(data), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress zstd payload: %w", err)
+		}
+		return payload, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader([]byte(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress gzip payload: %w", err)
+		}
+		payload, err := io.ReadAll(io.LimitReader(zr, maxDecodedPayload+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress gzip payload: %w", err)
+		}
+		if len(payload) > maxDecodedPayload {
+			return nil, fmt.Errorf("gzip payload expands beyond %d bytes", maxDecodedPayload)
+		}
+		return payload, nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q", encoding)
+}
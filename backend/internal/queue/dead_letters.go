@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// deadLetterPage is how many dead-letter entries are read per XRANGE while filtering
+const deadLetterPage = 500
+
+// DeadLetter is a message set aside by DeadLetter, as stored on a dead-letter stream.
+// ID is its entry on that stream and MessageID the ID it had on the event stream.
+type DeadLetter struct {
+	ID          string      `json:"id"`
+	Stream      string      `json:"stream"`
+	MessageID   string      `json:"message_id"`
+	Error       string      `json:"error"`
+	FailedAt    string      `json:"failed_at"`
+	QueuedEvent QueuedEvent `json:"queued_event"`
+}
+
+// DeadLetterFilter selects dead letters by session and by when they were
+// dead-lettered; empty fields match everything
+type DeadLetterFilter struct {
+	SessionID string
+	From      time.Time
+	To        time.Time
+}
+
+// ListDeadLetters returns up to limit dead letters matching filter, oldest first
+// across all shards and the priority lane; limit 0 returns all of them
+func (eq *EventQueue) ListDeadLetters(ctx context.Context, filter DeadLetterFilter, limit int) ([]DeadLetter, error) {
+	start, end := "-", "+"
+	if !filter.From.IsZero() {
+		start = strconv.FormatInt(filter.From.UnixMilli(), 10)
+	}
+	if !filter.To.IsZero() {
+		end = strconv.FormatInt(filter.To.UnixMilli(), 10)
+	}
+
+	var letters []DeadLetter
+	for _, stream := range eq.lanes() {
+		found, err := stream.readDeadLetters(ctx, filter.SessionID, start, end, limit)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, found...)
+	}
+
+	slices.SortStableFunc(letters, func(a, b DeadLetter) int {
+		return compareStreamIDs(a.ID, b.ID)
+	})
+	if limit > 0 && len(letters) > limit {
+		letters = letters[:limit]
+	}
+	return letters, nil
+}
+
+// readDeadLetters pages through one dead-letter stream in [start, end], keeping the
+// entries of sessionID (all when empty) until limit are found
+func (eq *EventQueue) readDeadLetters(ctx context.Context, sessionID, start, end string, limit int) ([]DeadLetter, error) {
+	key := eq.DeadLetterKey()
+	var letters []DeadLetter
+	for {
+		msgs, err := eq.redis.XRangeN(ctx, key, start, end, deadLetterPage).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dead-letter stream: %w", err)
+		}
+		for _, msg := range msgs {
+			letter, ok := toDeadLetter(key, msg)
+			if !ok || (sessionID != "" && letter.QueuedEvent.SessionID != sessionID) {
+				continue
+			}
+			letters = append(letters, letter)
+			if limit > 0 && len(letters) == limit {
+				return letters, nil
+			}
+		}
+		if len(msgs) < deadLetterPage {
+			return letters, nil
+		}
+		start = "(" + msgs[len(msgs)-1].ID
+	}
+}
+
+// toDeadLetter decodes a dead-letter stream entry; malformed entries are skipped
+func toDeadLetter(stream string, msg redis.XMessage) (DeadLetter, bool) {
+	data, err := entryPayload(msg.Values)
+	if err != nil {
+		return DeadLetter{}, false
+	}
+	letter := DeadLetter{ID: msg.ID, Stream: stream}
+	if err := json.Unmarshal(data, &letter.QueuedEvent); err != nil {
+		return DeadLetter{}, false
+	}
+	letter.MessageID, _ = msg.Values["message_id"].(string)
+	letter.Error, _ = msg.Values["error"].(string)
+	letter.FailedAt, _ = msg.Values["failed_at"].(string)
+	return letter, true
+}
+
+// Requeue adds dead letters back to the event stream as new messages, on the shard of
+// their session or the priority lane they came from, and deletes each from its dead-letter stream in the same
+// transaction. It returns how many were requeued before any error.
+func (eq *EventQueue) Requeue(ctx context.Context, letters []DeadLetter) (int, error) {
+	for i, letter := range letters {
+		data, err := json.Marshal(letter.QueuedEvent)
+		if err != nil {
+			return i, fmt.Errorf("failed to marshal event: %w", err)
+		}
+
+		values, err := eq.entryValues(data)
+		if err != nil {
+			return i, err
+		}
+
+		stream := eq.streamFor(letter.QueuedEvent.SessionID)
+		if eq.priority != nil && letter.Stream == eq.priority.DeadLetterKey() {
+			stream = eq.priority
+		}
+		pipe := eq.redis.TxPipeline()
+		pipe.XAdd(ctx, stream.xadd(stream.streamKey, values))
+		pipe.XDel(ctx, letter.Stream, letter.ID)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return i, fmt.Errorf("failed to requeue dead letter %s: %w", letter.ID, err)
+		}
+	}
+	return len(letters), nil
+}
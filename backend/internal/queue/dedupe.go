@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const batchKeyPrefix = "track:batch:"
+
+// BatchDeduper remembers the client-supplied IDs of queued /track batches for a TTL,
+// so a batch the SDK sends again after a network error is acknowledged without being
+// queued twice. The Segment endpoints use it for messageIds, scoped by tracker key
+// instead of session. A nil *BatchDeduper lets every batch through.
+type BatchDeduper struct {
+	redis *redis.Client
+	ttl   time.Duration
+}
+
+// NewBatchDeduper creates a deduper backed by client. ttl should cover the SDK's
+// longest retry delay.
+func NewBatchDeduper(client *redis.Client, ttl time.Duration) *BatchDeduper {
+	return &BatchDeduper{redis: client, ttl: ttl}
+}
+
+func batchKey(sessionID uuid.UUID, batchID string) string {
+	return batchKeyPrefix + sessionID.String() + ":" + batchID
+}
+
+// Claim reports whether batchID of sessionID has not been seen within the TTL,
+// marking it seen. Batches without an ID are always new. When Redis fails the batch
+// is let through: a possible duplicate beats losing events.
+func (d *BatchDeduper) Claim(ctx context.Context, sessionID uuid.UUID, batchID string) bool {
+	if d == nil || batchID == "" {
+		return true
+	}
+	claimed, err := d.redis.SetNX(ctx, batchKey(sessionID, batchID), time.Now().Unix(), d.ttl).Result()
+	if err != nil {
+		log.Printf("[BatchDeduper] Failed to claim batch %s of session %s, accepting it: %v", batchID, sessionID, err)
+		return true
+	}
+	return claimed
+}
+
+// Release forgets batchID of sessionID, so a batch that could not be queued is
+// accepted when the SDK sends it again
+func (d *BatchDeduper) Release(ctx context.Context, sessionID uuid.UUID, batchID string) {
+	if d == nil || batchID == "" {
+		return
+	}
+	if err := d.redis.Del(ctx, batchKey(sessionID, batchID)).Err(); err != nil {
+		log.Printf("[BatchDeduper] Failed to release batch %s of session %s: %v", batchID, sessionID, err)
+	}
+}
@@ -2,63 +2,161 @@ package queue
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/catalog"
+	"github.com/ngocp/user-tracker/internal/cdc"
 	"github.com/ngocp/user-tracker/internal/models"
 	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/requestid"
+	"github.com/ngocp/user-tracker/internal/stats"
 )
 
+// maxErrorBackoff caps the delay between reads after consecutive errors
+const maxErrorBackoff = 30 * time.Second
+
+// DefaultInsertRetries is the default MaxRetries: how often a batch whose insert
+// failed transiently is retried
+const DefaultInsertRetries = 3
+
 // ProcessorConfig holds configuration for the event processor
 type ProcessorConfig struct {
-	WorkerCount       int
-	BatchSize         int64
-	ProcessInterval   time.Duration
-	ShutdownTimeout   time.Duration
-	MaxRetries        int
-	RetryDelay        time.Duration
+	// WorkerCount is the number of workers reading the queue; on a sharded queue it is
+	// raised to the shard count so every shard is read, and workers are spread evenly
+	WorkerCount int
+	BatchSize   int64
+	// BlockTimeout bounds each blocking read, and so how long Stop waits for an idle
+	// worker and how late an idle worker sees the priority lane
+	BlockTimeout time.Duration
+	// ConsumerPrefix keeps consumer names unique when several processes share a group
+	ConsumerPrefix  string
+	ShutdownTimeout time.Duration
+	// MaxRetries is how often a transiently failed insert is retried, with RetryDelay
+	// as the first backoff; RetryDelay is also the first backoff after a failed read
+	MaxRetries     int
+	RetryDelay     time.Duration
+	PublishTimeout time.Duration
+	// SessionShards is the number of writer goroutines sessions are routed to by hash,
+	// so one session's batches are never written by two workers at once; 0 lets each
+	// worker write the sessions it read
+	SessionShards int
+	// Every ReclaimInterval (0 disables it) messages pending for longer than
+	// ReclaimMinIdle are claimed and processed again; those delivered more than
+	// MaxDeliveries times are dead-lettered instead (0 retries them forever)
+	ReclaimInterval time.Duration
+	ReclaimMinIdle  time.Duration
+	MaxDeliveries   int
+	// With MaxWorkers above WorkerCount, every ScaleInterval the worker count is set to
+	// one worker per ScaleBacklog messages, between the two (see autoscale.go)
+	MaxWorkers    int
+	ScaleInterval time.Duration
+	ScaleBacklog  int64
+	// BreakerFailures consecutive failed writes (0 disables it) stop reads for
+	// BreakerCooldown before a probe (see breaker.go)
+	BreakerFailures int
+	BreakerCooldown time.Duration
 }
 
 // EventProcessor processes events from the queue in the background
 type EventProcessor struct {
-	queue      *EventQueue
+	queue      Queue
 	eventRepo  *repository.EventRepository
+	publisher  cdc.Publisher
+	stats      *stats.IngestCounters
+	shadow     *Shadow
+	catalog    *catalog.Recorder
+	histograms *batchHistograms
+	shards     *sessionShards
+	gate       *HealthGate
+	breaker    *circuitBreaker
 	config     ProcessorConfig
-	workers    []*Worker
-	stopChan   chan struct{}
-	wg         sync.WaitGroup
+	streams    []Queue
+	priority   Queue
+	// workers is guarded by workersMu once the autoscaler runs
+	workers   []*Worker
+	workersMu sync.Mutex
+	stopChan  chan struct{}
+	stopOnce  sync.Once
+	stopReads context.CancelFunc
+	readCtx   context.Context
+	wg        sync.WaitGroup
+	// consumers holds the names this processor has read as, and inFlight the messages
+	// of batches being processed, for Backlog
+	consumers sync.Map
+	inFlight  atomic.Int64
 }
 
-// Worker represents a single processing worker
+// Worker represents a single processing worker. queue is the stream it reads, one
+// shard of a sharded queue.
 type Worker struct {
-	id         int
-	processor  *EventProcessor
-	stopChan   chan struct{}
+	id        int
+	processor *EventProcessor
+	queue     Queue
+	stopChan  chan struct{}
 }
 
-// NewEventProcessor creates a new event processor
+// NewEventProcessor creates a new event processor.
+// publisher is optional; when set, every persisted batch is published to it.
+// ingestStats is optional and counts persisted and failed events.
+// shadow is optional; when set, sampled batches are also written through the shadow path.
+// eventCatalog is optional and records the types and event_data keys of persisted events.
+// gate is optional; when set, workers stop reading while it is closed and the
+// processor starts and stops it.
 func NewEventProcessor(
-	queue *EventQueue,
+	queue Queue,
 	eventRepo *repository.EventRepository,
+	publisher cdc.Publisher,
+	ingestStats *stats.IngestCounters,
+	shadow *Shadow,
+	eventCatalog *catalog.Recorder,
+	gate *HealthGate,
 	config ProcessorConfig,
 ) *EventProcessor {
+	streams := []Queue{queue}
+	if sharded, ok := queue.(ShardedQueue); ok {
+		streams = sharded.Shards()
+	}
+	var priority Queue
+	if lanes, ok := queue.(PriorityQueue); ok {
+		priority = lanes.Priority()
+	}
+	if config.WorkerCount < len(streams) {
+		log.Printf("[EventProcessor] Raising worker count from %d to %d, one per stream shard", config.WorkerCount, len(streams))
+		config.WorkerCount = len(streams)
+	}
+
 	workers := make([]*Worker, config.WorkerCount)
 	for i := 0; i < config.WorkerCount; i++ {
 		workers[i] = &Worker{
-			id:        i,
-			stopChan:  make(chan struct{}),
+			id:       i,
+			queue:    streams[i%len(streams)],
+			stopChan: make(chan struct{}),
 		}
 	}
 
 	processor := &EventProcessor{
-		queue:     queue,
-		eventRepo: eventRepo,
-		config:    config,
-		workers:   workers,
-		stopChan:  make(chan struct{}),
+		queue:      queue,
+		eventRepo:  eventRepo,
+		publisher:  publisher,
+		stats:      ingestStats,
+		shadow:     shadow,
+		catalog:    eventCatalog,
+		histograms: newBatchHistograms(),
+		shards:     newSessionShards(config.SessionShards),
+		gate:       gate,
+		breaker:    newCircuitBreaker(config.BreakerFailures, config.BreakerCooldown),
+		config:     config,
+		streams:    streams,
+		priority:   priority,
+		workers:    workers,
+		stopChan:   make(chan struct{}),
 	}
 
 	// Set processor reference in workers
@@ -76,7 +174,19 @@ func (ep *EventProcessor) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to create consumer group: %w", err)
 	}
 
-	log.Printf("[EventProcessor] Starting %d workers", ep.config.WorkerCount)
+	log.Printf("[EventProcessor] Starting %d workers on stream %s (%d shards), group %s",
+		ep.config.WorkerCount, ep.queue.StreamKey(), len(ep.streams), ep.queue.ConsumerGroup())
+	if ep.priority != nil {
+		log.Printf("[EventProcessor] Reading priority stream %s first", ep.priority.StreamKey())
+	}
+
+	// Reads get their own context so Stop can abandon a blocking read without
+	// cancelling database writes for messages already read
+	ep.readCtx, ep.stopReads = context.WithCancel(ctx)
+
+	// Shards run on ctx like the workers, so writes of messages already read finish
+	ep.shards.start(ctx)
+	ep.gate.Start(ctx)
 
 	// Start all workers
 	for _, worker := range ep.workers {
@@ -84,16 +194,81 @@ func (ep *EventProcessor) Start(ctx context.Context) error {
 		go worker.Run(ctx)
 	}
 
+	// Add and retire workers with the backlog
+	if ep.autoscaling() {
+		ep.wg.Add(1)
+		go ep.autoscale(ctx)
+	}
+
+	// Reclaim messages left pending by consumers that died, on a worker of its own per
+	// stream shard and for the priority lane
+	reclaimed := ep.streams
+	if ep.priority != nil {
+		reclaimed = append(append([]Queue{}, ep.streams...), ep.priority)
+	}
+	for i, stream := range reclaimed {
+		claimer, ok := stream.(StaleClaimer)
+		if !ok || ep.config.ReclaimInterval <= 0 {
+			continue
+		}
+		reclaimer := &Worker{
+			id:        ep.maxWorkers() + i,
+			processor: ep,
+			queue:     stream,
+			stopChan:  make(chan struct{}),
+		}
+		name := "reclaimer"
+		switch {
+		case stream == ep.priority:
+			name = "reclaimer-priority"
+		case len(ep.streams) > 1:
+			name = fmt.Sprintf("reclaimer-%d", i)
+		}
+		ep.consumers.Store(ep.consumerName(name), struct{}{})
+		ep.wg.Add(1)
+		go ep.reclaim(ctx, claimer, reclaimer, ep.consumerName(name))
+	}
+
 	// Monitor queue depth
 	go ep.monitorQueue(ctx)
 
 	return nil
 }
 
+// StopReading stops workers and reclaimers from taking further messages. Batches
+// already read are still processed; Stop then waits for them.
+func (ep *EventProcessor) StopReading() {
+	ep.stopOnce.Do(func() {
+		close(ep.stopChan)
+		if ep.stopReads != nil {
+			ep.stopReads()
+		}
+		ep.gate.Stop()
+	})
+}
+
+// Backlog returns the messages this processor has taken and not finished: those
+// pending to its own consumers, or, when the queue cannot count them per consumer,
+// those of the batches being processed. Unlike the queue's backlog it leaves out
+// messages other instances will process, so a drain can wait for it to clear.
+func (ep *EventProcessor) Backlog(ctx context.Context) (int64, error) {
+	counter, ok := ep.queue.(ConsumerPending)
+	if !ok {
+		return ep.inFlight.Load(), nil
+	}
+
+	var names []string
+	ep.consumers.Range(func(name, _ any) bool {
+		names = append(names, name.(string))
+		return true
+	})
+	return counter.GetConsumerPending(ctx, names)
+}
+
 // Stop gracefully stops all workers
 func (ep *EventProcessor) Stop(ctx context.Context) error {
 	log.Println("[EventProcessor] Stopping workers...")
-	close(ep.stopChan)
+	ep.StopReading()
 
 	// Create timeout context for shutdown
 	shutdownCtx, cancel := context.WithTimeout(ctx, ep.config.ShutdownTimeout)
@@ -103,6 +278,7 @@ func (ep *EventProcessor) Stop(ctx context.Context) error {
 	done := make(chan struct{})
 	go func() {
 		ep.wg.Wait()
+		ep.shards.stop()
 		close(done)
 	}()
 
@@ -116,79 +292,160 @@ func (ep *EventProcessor) Stop(ctx context.Context) error {
 	}
 }
 
-// Run starts the worker's processing loop
+// Run starts the worker's processing loop. It reads continuously with a blocking
+// XREADGROUP, so new messages are picked up immediately and an idle worker only
+// wakes once per BlockTimeout. Read errors back off exponentially. While the health
+// gate is closed the worker does not read at all. A worker retired by the autoscaler
+// finishes the batch it read before returning.
 func (w *Worker) Run(ctx context.Context) {
 	defer w.processor.wg.Done()
 
-	consumerName := fmt.Sprintf("worker-%d", w.id)
+	consumerName := w.processor.consumerName(fmt.Sprintf("worker-%d", w.id))
+	w.processor.consumers.Store(consumerName, struct{}{})
 	log.Printf("[Worker-%d] Started", w.id)
 
-	ticker := time.NewTicker(w.processor.config.ProcessInterval)
-	defer ticker.Stop()
-
+	var backoff time.Duration
 	for {
 		select {
 		case <-w.processor.stopChan:
 			log.Printf("[Worker-%d] Stopped", w.id)
 			return
-		case <-ticker.C:
-			w.processMessages(ctx, consumerName)
+		case <-w.stopChan:
+			log.Printf("[Worker-%d] Retired", w.id)
+			return
+		default:
 		}
+
+		if !w.processor.gate.Wait(w.processor.stopChan) {
+			log.Printf("[Worker-%d] Stopped", w.id)
+			return
+		}
+		probe, ok := w.processor.breaker.Wait(w.processor.stopChan)
+		if !ok {
+			log.Printf("[Worker-%d] Stopped", w.id)
+			return
+		}
+
+		err := w.processMessages(ctx, consumerName)
+		if probe {
+			w.processor.breaker.probeDone()
+		}
+		if err != nil {
+			if w.processor.readCtx.Err() != nil {
+				continue
+			}
+
+			backoff = nextBackoff(backoff, w.processor.config.RetryDelay)
+			log.Printf("[Worker-%d] Error reading messages, retrying in %v: %v", w.id, backoff, err)
+
+			select {
+			case <-w.processor.stopChan:
+			case <-w.stopChan:
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+	}
+}
+
+// consumerName prefixes name with ConsumerPrefix, keeping it unique across processes
+func (ep *EventProcessor) consumerName(name string) string {
+	if prefix := ep.config.ConsumerPrefix; prefix != "" {
+		return prefix + "-" + name
 	}
+	return name
 }
 
-// processMessages reads and processes a batch of messages
-func (w *Worker) processMessages(ctx context.Context, consumerName string) {
+// nextBackoff doubles the previous delay, starting at initial and capped at maxErrorBackoff
+func nextBackoff(previous, initial time.Duration) time.Duration {
+	if previous == 0 {
+		if initial <= 0 {
+			initial = time.Second
+		}
+		return initial
+	}
+	if next := previous * 2; next < maxErrorBackoff {
+		return next
+	}
+	return maxErrorBackoff
+}
+
+// processMessages blocks for the next batch of messages and processes it.
+// It returns an error only when reading from the stream fails.
+func (w *Worker) processMessages(ctx context.Context, consumerName string) error {
+	// Messages waiting on the priority lane are taken first, without blocking, so
+	// they do not queue behind the regular backlog
+	if priority := w.processor.priority; priority != nil {
+		messages, err := priority.ReadEvents(w.processor.readCtx, consumerName, w.processor.config.BatchSize, -1)
+		if err != nil {
+			return err
+		}
+		if len(messages) > 0 {
+			w.on(priority).processBatch(ctx, messages)
+			return nil
+		}
+	}
+
 	// Read messages from queue
-	messages, err := w.processor.queue.ReadEvents(ctx, consumerName, w.processor.config.BatchSize)
+	messages, err := w.queue.ReadEvents(w.processor.readCtx, consumerName, w.processor.config.BatchSize, w.processor.config.BlockTimeout)
 	if err != nil {
-		log.Printf("[Worker-%d] Error reading messages: %v", w.id, err)
-		return
+		return err
 	}
 
 	if len(messages) == 0 {
-		return
+		return nil
 	}
 
+	w.processBatch(ctx, messages)
+	return nil
+}
+
+// on returns a copy of w that acknowledges and dead-letters on queue, for messages
+// the worker read from a stream other than its own
+func (w *Worker) on(queue Queue) *Worker {
+	lane := *w
+	lane.queue = queue
+	return &lane
+}
+
+// processBatch persists messages, grouped by session, and acknowledges those processed
+func (w *Worker) processBatch(ctx context.Context, messages []StreamMessage) {
 	log.Printf("[Worker-%d] Processing %d messages", w.id, len(messages))
+	w.processor.inFlight.Add(int64(len(messages)))
+	defer w.processor.inFlight.Add(-int64(len(messages)))
 
 	// Group messages by session for batch processing
 	sessionBatches := make(map[string][]StreamMessage)
 	for _, msg := range messages {
 		sessionBatches[msg.QueuedEvent.SessionID] = append(sessionBatches[msg.QueuedEvent.SessionID], msg)
 	}
+	w.processor.histograms.observeBatch(messages, len(sessionBatches))
 
-	// Process each session's events
+	// Process each session's events, on its shard when sessions are sharded
 	var processedIDs []string
-	for sessionIDStr, batch := range sessionBatches {
-		sessionID, err := uuid.Parse(sessionIDStr)
-		if err != nil {
-			log.Printf("[Worker-%d] Invalid session ID: %s, error: %v", w.id, sessionIDStr, err)
-			continue
+	if shards := w.processor.shards; shards != nil {
+		var done sync.WaitGroup
+		jobs := make([]*sessionJob, 0, len(sessionBatches))
+		for sessionIDStr, batch := range sessionBatches {
+			job := &sessionJob{worker: w, sessionID: sessionIDStr, messages: batch, done: &done}
+			jobs = append(jobs, job)
+			done.Add(1)
+			shards.dispatch(job)
 		}
-
-		// Collect all events for this session
-		var allEvents []models.EventData
-		var messageIDs []string
-		for _, msg := range batch {
-			allEvents = append(allEvents, msg.QueuedEvent.Events...)
-			messageIDs = append(messageIDs, msg.ID)
+		done.Wait()
+		for _, job := range jobs {
+			processedIDs = append(processedIDs, job.processed...)
 		}
-
-		// Batch insert to database
-		if err := w.processor.eventRepo.CreateBatch(ctx, sessionID, allEvents); err != nil {
-			log.Printf("[Worker-%d] Error inserting events for session %s: %v", w.id, sessionIDStr, err)
-			// TODO: Implement retry logic or dead letter queue
-			continue
+	} else {
+		for sessionIDStr, batch := range sessionBatches {
+			processedIDs = append(processedIDs, w.processSession(ctx, sessionIDStr, batch)...)
 		}
-
-		// Mark as successfully processed
-		processedIDs = append(processedIDs, messageIDs...)
 	}
 
 	// Acknowledge all successfully processed messages
 	if len(processedIDs) > 0 {
-		if err := w.processor.queue.Acknowledge(ctx, processedIDs...); err != nil {
+		if err := w.queue.Acknowledge(ctx, processedIDs...); err != nil {
 			log.Printf("[Worker-%d] Error acknowledging messages: %v", w.id, err)
 		} else {
 			log.Printf("[Worker-%d] Successfully processed %d messages", w.id, len(processedIDs))
@@ -196,33 +453,291 @@ func (w *Worker) processMessages(ctx context.Context, consumerName string) {
 	}
 }
 
-// monitorQueue periodically logs queue metrics
-func (ep *EventProcessor) monitorQueue(ctx context.Context) {
-	ticker := time.NewTicker(30 * time.Second)
+// reclaim claims messages pending for longer than ReclaimMinIdle every ReclaimInterval
+// and processes them on w
+func (ep *EventProcessor) reclaim(ctx context.Context, claimer StaleClaimer, w *Worker, consumerName string) {
+	defer ep.wg.Done()
+
+	log.Printf("[Reclaimer] Started on stream %s, interval: %v, min idle: %v, max deliveries: %d",
+		w.queue.StreamKey(), ep.config.ReclaimInterval, ep.config.ReclaimMinIdle, ep.config.MaxDeliveries)
+
+	ticker := time.NewTicker(ep.config.ReclaimInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ep.stopChan:
+			log.Println("[Reclaimer] Stopped")
 			return
 		case <-ticker.C:
-			depth, err := ep.queue.GetQueueDepth(ctx)
-			if err != nil {
-				log.Printf("[Monitor] Error getting queue depth: %v", err)
-				continue
+			// Stale messages wait too while the database is down or writes fail
+			if paused, _ := ep.gate.Paused(); !paused && !ep.breaker.Tripped() {
+				ep.reclaimStale(ctx, claimer, w, consumerName)
+			}
+		}
+	}
+}
+
+// reclaimStale walks the whole pending entries list once, a batch at a time. Messages
+// over MaxDeliveries have failed, or crashed their consumer, too often to try again and
+// are dead-lettered; the rest are processed like freshly read ones.
+func (ep *EventProcessor) reclaimStale(ctx context.Context, claimer StaleClaimer, w *Worker, consumerName string) {
+	start := "0-0"
+	for {
+		messages, next, err := claimer.ClaimStale(ep.readCtx, consumerName, ep.config.ReclaimMinIdle, start, ep.config.BatchSize)
+		if err != nil {
+			if ep.readCtx.Err() == nil {
+				log.Printf("[Reclaimer] Error claiming stale messages: %v", err)
+			}
+			return
+		}
+
+		var retry, exhausted []StreamMessage
+		for _, msg := range messages {
+			if ep.config.MaxDeliveries > 0 && msg.DeliveryCount > ep.config.MaxDeliveries {
+				exhausted = append(exhausted, msg)
+			} else {
+				retry = append(retry, msg)
 			}
+		}
+		if len(exhausted) > 0 {
+			log.Printf("[Reclaimer] %d stale messages exceeded %d deliveries (request %s)", len(exhausted), ep.config.MaxDeliveries, requestIDs(exhausted))
+			w.deadLetter(ctx, exhausted, fmt.Errorf("not acknowledged after %d deliveries", ep.config.MaxDeliveries))
+		}
+		if len(retry) > 0 {
+			log.Printf("[Reclaimer] Claimed %d stale messages idle for over %v", len(retry), ep.config.ReclaimMinIdle)
+			w.processBatch(ctx, retry)
+		}
+
+		if next == "0-0" {
+			return
+		}
+		start = next
+
+		select {
+		case <-ep.stopChan:
+			return
+		default:
+		}
+	}
+}
+
+// processSession persists one session's messages from a read batch and returns the
+// IDs of the messages to acknowledge
+func (w *Worker) processSession(ctx context.Context, sessionIDStr string, batch []StreamMessage) []string {
+	requests := requestIDs(batch)
+	sessionID, err := uuid.Parse(sessionIDStr)
+	if err != nil {
+		log.Printf("[Worker-%d] Invalid session ID: %s (request %s), error: %v", w.id, sessionIDStr, requests, err)
+		w.deadLetter(ctx, batch, fmt.Errorf("invalid session ID %q: %w", sessionIDStr, err))
+		return nil
+	}
+	// The shadow path and publisher log with the request IDs from the context. All
+	// messages of a session share its project.
+	project := messageProject(batch[0])
+	sessionCtx := requestid.NewContext(ctx, requests)
+
+	// Collect all events for this session
+	var allEvents []models.EventData
+	var messageIDs []string
+	for _, msg := range batch {
+		for _, event := range msg.QueuedEvent.Events {
+			event.StreamID = msg.ID
+			allEvents = append(allEvents, event)
+		}
+		messageIDs = append(messageIDs, msg.ID)
+	}
+
+	// Writes are not attempted while the circuit breaker is open; the messages stay
+	// pending and are reclaimed once it closes
+	if w.processor.breaker.Tripped() {
+		return nil
+	}
 
-			pending, err := ep.queue.GetPendingCount(ctx)
+	// Batch insert to database. Transient failures are retried; permanent ones are
+	// dead-lettered, and batches still failing after MaxRetries stay pending for replay
+	attempts, err := w.insert(ctx, sessionID, allEvents)
+	w.processor.histograms.observeAttempts(attempts)
+	if err != nil {
+		w.processor.stats.Add(ctx, project, stats.StagePersistFailed, len(allEvents))
+		if repository.IsRetryable(err) {
+			w.processor.histograms.retriesExhausted.Add(1)
+			log.Printf("[Worker-%d] Error inserting events for session %s (request %s) after %d attempts, leaving %d messages pending (delivery %d): %v",
+				w.id, sessionIDStr, requests, attempts, len(messageIDs), maxDeliveryCount(batch), err)
+			return nil
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			// Events of a session that was never created or has been deleted cannot be
+			// stored; they are kept in the dead-letter stream instead
+			log.Printf("[Worker-%d] Unknown session %s (request %s), dead-lettering %d events", w.id, sessionIDStr, requests, len(allEvents))
+		} else {
+			log.Printf("[Worker-%d] Permanent error inserting events for session %s (request %s): %v", w.id, sessionIDStr, requests, err)
+		}
+		w.deadLetter(ctx, batch, err)
+		return nil
+	}
+
+	w.processor.stats.Add(ctx, project, stats.StagePersisted, len(allEvents))
+	w.processor.catalog.Observe(project, allEvents)
+	log.Printf("[Worker-%d] Inserted %d events for session %s (request %s)", w.id, len(allEvents), sessionIDStr, requests)
+
+	w.publish(sessionCtx, sessionID, allEvents)
+
+	if w.processor.shadow.Sampled(sessionID) {
+		w.processor.shadow.Run(sessionCtx, sessionID, messageIDs, allEvents)
+	}
+
+	return messageIDs
+}
+
+// insert writes a session's events, retrying transient failures up to MaxRetries times
+// with exponential backoff starting at RetryDelay, and returns the number of attempts
+// made. Retries stop early when the processor is stopping or the circuit breaker opens.
+func (w *Worker) insert(ctx context.Context, sessionID uuid.UUID, events []models.EventData) (int, error) {
+	var backoff time.Duration
+	for attempt := 1; ; attempt++ {
+		insertStart := time.Now()
+		err := w.processor.eventRepo.CreateBatch(ctx, sessionID, events)
+		w.processor.histograms.observeInsert(time.Since(insertStart))
+		w.processor.breaker.record(err)
+		if err == nil || !repository.IsRetryable(err) || attempt > w.processor.config.MaxRetries || w.processor.breaker.Tripped() {
+			return attempt, err
+		}
+
+		backoff = nextBackoff(backoff, w.processor.config.RetryDelay)
+		w.processor.histograms.retries.Add(1)
+		log.Printf("[Worker-%d] Retryable error inserting events for session %s, attempt %d of %d, retrying in %v: %v",
+			w.id, sessionID, attempt, w.processor.config.MaxRetries+1, backoff, err)
+		select {
+		case <-w.processor.stopChan:
+			return attempt, err
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// maxDeliveryCount returns the highest delivery count in batch; it is 0 for messages
+// read fresh from the stream, which have not been claimed again yet
+func maxDeliveryCount(batch []StreamMessage) int {
+	highest := 0
+	for _, msg := range batch {
+		if msg.DeliveryCount > highest {
+			highest = msg.DeliveryCount
+		}
+	}
+	return highest
+}
+
+// deadLetter moves messages that can never be processed to the dead-letter stream
+func (w *Worker) deadLetter(ctx context.Context, messages []StreamMessage, reason error) {
+	if err := w.queue.DeadLetter(ctx, messages, reason); err != nil {
+		log.Printf("[Worker-%d] Error dead-lettering %d messages (request %s): %v", w.id, len(messages), requestIDs(messages), err)
+		return
+	}
+	events := make(map[string]int)
+	for _, msg := range messages {
+		events[messageProject(msg)] += len(msg.QueuedEvent.Events)
+	}
+	for project, n := range events {
+		w.processor.stats.Add(ctx, project, stats.StageDeadLettered, n)
+	}
+	log.Printf("[Worker-%d] Dead-lettered %d messages to %s (request %s)", w.id, len(messages), w.queue.DeadLetterKey(), requestIDs(messages))
+}
+
+// messageProject returns the ingest stats project a message is counted under
+func messageProject(msg StreamMessage) string {
+	if msg.QueuedEvent.Project != "" {
+		return msg.QueuedEvent.Project
+	}
+	return stats.DefaultProject
+}
+
+// requestIDs lists the distinct request IDs of messages for log lines, "-" when none
+// was recorded (messages queued before request IDs, or by replay and import)
+func requestIDs(messages []StreamMessage) string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, msg := range messages {
+		id := msg.QueuedEvent.RequestID
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return requestOrNone(strings.Join(ids, ","))
+}
+
+func requestOrNone(id string) string {
+	if id == "" {
+		return "-"
+	}
+	return id
+}
+
+// publish emits the persisted events to the CDC publisher, if one is configured.
+// Failures are logged only: the events are already stored and must still be acknowledged.
+func (w *Worker) publish(ctx context.Context, sessionID uuid.UUID, events []models.EventData) {
+	if err := w.processor.publish(ctx, sessionID, events); err != nil {
+		log.Printf("[Worker-%d] %v", w.id, err)
+	}
+}
+
+func (ep *EventProcessor) publish(ctx context.Context, sessionID uuid.UUID, events []models.EventData) error {
+	if ep.publisher == nil {
+		return nil
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, ep.config.PublishTimeout)
+	defer cancel()
+
+	if err := ep.publisher.Publish(publishCtx, cdc.NewEnvelope(sessionID, events)); err != nil {
+		return fmt.Errorf("error publishing CDC batch for session %s (request %s): %w", sessionID, requestOrNone(requestid.FromContext(ctx)), err)
+	}
+	return nil
+}
+
+// Persist writes events directly, bypassing the stream, and returns their event IDs.
+// The events are counted (under the project carried by ctx) and published like queued
+// ones; they are not shadowed, since shadow comparisons key on stream message IDs.
+func (ep *EventProcessor) Persist(ctx context.Context, sessionID uuid.UUID, events []models.EventData) ([]int64, error) {
+	project := stats.ProjectFromContext(ctx)
+	ids, err := ep.eventRepo.CreateBatchReturningIDs(ctx, sessionID, events)
+	if err != nil {
+		ep.stats.Add(ctx, project, stats.StagePersistFailed, len(events))
+		return nil, err
+	}
+	ep.stats.Add(ctx, project, stats.StagePersisted, len(events))
+	ep.catalog.Observe(project, events)
+
+	if err := ep.publish(ctx, sessionID, events); err != nil {
+		log.Printf("[EventProcessor] %v", err)
+	}
+	return ids, nil
+}
+
+// monitorQueue periodically logs the queue backlog
+func (ep *EventProcessor) monitorQueue(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ep.stopChan:
+			return
+		case <-ticker.C:
+			backlog, err := ep.queue.GetBacklog(ctx)
 			if err != nil {
-				log.Printf("[Monitor] Error getting pending count: %v", err)
+				log.Printf("[Monitor] Error getting queue backlog: %v", err)
 				continue
 			}
 
-			log.Printf("[Monitor] Queue depth: %d, Pending: %d", depth, pending)
+			log.Printf("[Monitor] Queue backlog: %d", backlog)
 
 			// Alert if queue is growing too large
-			if depth > 10000 {
-				log.Printf("[Monitor] WARNING: Queue depth exceeded 10,000 messages!")
+			if backlog > 10000 {
+				log.Printf("[Monitor] WARNING: Queue backlog exceeded 10,000 messages!")
 			}
 		}
 	}
@@ -3,94 +3,370 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/requestid"
+	"github.com/ngocp/user-tracker/internal/stats"
 	"github.com/redis/go-redis/v9"
 )
 
+// Defaults used when QueueConfig leaves a field empty
 const (
-	EventStreamKey = "events:stream"
-	ConsumerGroup  = "event-processors"
+	DefaultStreamKey     = "events:stream"
+	DefaultConsumerGroup = "event-processors"
+	DefaultMaxLen        = 100000
+	DefaultMaxAge        = 24 * time.Hour
 )
 
-// EventQueue handles queuing and dequeuing of tracking events
+// Stream trimming modes selectable with QUEUE_TRIM_MODE. Trimming drops the oldest
+// entries whether or not they were processed; TrimNone keeps everything, trading
+// Redis memory for never losing events, and relies on stream_length alerts instead.
+const (
+	TrimMaxLen = "maxlen"
+	TrimMinID  = "minid"
+	TrimNone   = "none"
+)
+
+// CheckTrimMode returns an error unless mode names a trimming mode
+func CheckTrimMode(mode string) error {
+	switch mode {
+	case TrimMaxLen, TrimMinID, TrimNone:
+		return nil
+	}
+	return fmt.Errorf("unknown trim mode %q; use %q, %q or %q", mode, TrimMaxLen, TrimMinID, TrimNone)
+}
+
+// QueueConfig names the Redis stream and consumer group of a pipeline. Distinct names
+// let independent pipelines or blue/green processor deployments share one Redis.
+// ShardCount above 1 spreads events over that many streams, StreamKey:0 to
+// StreamKey:N-1, each with its own consumer group. TrimMode (default TrimMaxLen)
+// bounds each stream, and its dead-letter stream, to about MaxLen entries, to entries
+// younger than MaxAge (TrimMinID), or not at all (TrimNone). Compression (default
+// CompressionNone) compresses payloads of at least CompressMinBytes (default
+// DefaultCompressMinBytes). Events of PriorityTypes are queued on a priority lane,
+// StreamKey:priority, which workers read before their own stream (see priority.go).
+type QueueConfig struct {
+	StreamKey        string
+	ConsumerGroup    string
+	MaxLen           int64
+	MaxRetries       int
+	ShardCount       int
+	TrimMode         string
+	MaxAge           time.Duration
+	Compression      string
+	CompressMinBytes int
+	PriorityTypes    []string
+}
+
+// errSharded is returned by per-message methods of a sharded queue, whose message IDs
+// only mean something within one shard
+var errSharded = errors.New("queue is sharded; read and acknowledge through its shards")
+
+// EventQueue handles queuing and dequeuing of tracking events. A sharded queue routes
+// each session's events to one of its shards by a hash of the session ID, so a
+// session's batches stay in order on one stream; its counts cover all shards, and its
+// messages are read through Shards. Its priority lane is a single further stream.
 type EventQueue struct {
-	redis      *redis.Client
-	streamKey  string
-	maxRetries int
+	redis            *redis.Client
+	streamKey        string
+	consumerGroup    string
+	maxLen           int64
+	maxRetries       int
+	trimMode         string
+	maxAge           time.Duration
+	compression      string
+	compressMinBytes int
+	shards           []*EventQueue
+	priority         *EventQueue
+	priorityTypes    map[models.EventType]bool
 }
 
-// QueuedEvent represents an event in the queue with its session
+// QueuedEvent represents an event in the queue with its session. RequestID is the
+// correlation ID of the ingest request that queued it, if any, and Project the ingest
+// stats project when it is not the default one.
 type QueuedEvent struct {
 	SessionID string             `json:"session_id"`
+	RequestID string             `json:"request_id,omitempty"`
+	Project   string             `json:"project,omitempty"`
 	Events    []models.EventData `json:"events"`
 	QueuedAt  time.Time          `json:"queued_at"`
 }
 
-// NewEventQueue creates a new event queue
-func NewEventQueue(redisClient *RedisClient, maxRetries int) *EventQueue {
-	return &EventQueue{
-		redis:      redisClient.GetClient(),
-		streamKey:  EventStreamKey,
-		maxRetries: maxRetries,
+// NewEventQueue creates a new event queue, filling unset config fields with defaults
+func NewEventQueue(redisClient *RedisClient, config QueueConfig) *EventQueue {
+	if config.StreamKey == "" {
+		config.StreamKey = DefaultStreamKey
+	}
+	if config.ConsumerGroup == "" {
+		config.ConsumerGroup = DefaultConsumerGroup
+	}
+	if config.MaxLen <= 0 {
+		config.MaxLen = DefaultMaxLen
+	}
+	if config.TrimMode == "" {
+		config.TrimMode = TrimMaxLen
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = DefaultMaxAge
+	}
+	if config.Compression == "" {
+		config.Compression = CompressionNone
+	}
+	if config.CompressMinBytes <= 0 {
+		config.CompressMinBytes = DefaultCompressMinBytes
+	}
+
+	eq := &EventQueue{
+		redis:            redisClient.GetClient(),
+		streamKey:        config.StreamKey,
+		consumerGroup:    config.ConsumerGroup,
+		maxLen:           config.MaxLen,
+		maxRetries:       config.MaxRetries,
+		trimMode:         config.TrimMode,
+		maxAge:           config.MaxAge,
+		compression:      config.Compression,
+		compressMinBytes: config.CompressMinBytes,
+	}
+	if config.ShardCount > 1 {
+		shards := make([]*EventQueue, config.ShardCount)
+		for i := range shards {
+			shard := *eq
+			shard.streamKey = fmt.Sprintf("%s:%d", config.StreamKey, i)
+			shards[i] = &shard
+		}
+		eq.shards = shards
+	}
+	eq.priority = newPriorityLane(eq, config.PriorityTypes)
+	return eq
+}
+
+// Shards returns one single-stream queue per shard, or the queue itself when it is not
+// sharded
+func (eq *EventQueue) Shards() []Queue {
+	streams := eq.streams()
+	shards := make([]Queue, len(streams))
+	for i, shard := range streams {
+		shards[i] = shard
+	}
+	return shards
+}
+
+// streams returns the queues of the individual streams behind eq
+func (eq *EventQueue) streams() []*EventQueue {
+	if eq.shards == nil {
+		return []*EventQueue{eq}
+	}
+	return eq.shards
+}
+
+// streamFor returns the queue of the stream holding sessionID's events
+func (eq *EventQueue) streamFor(sessionID string) *EventQueue {
+	if eq.shards == nil {
+		return eq
+	}
+	return eq.shards[shardIndex(sessionID, len(eq.shards))]
+}
+
+// sumStreams adds up count over the streams behind eq, the priority lane included
+func (eq *EventQueue) sumStreams(ctx context.Context, count func(*EventQueue, context.Context) (int64, error)) (int64, error) {
+	var total int64
+	for _, stream := range eq.lanes() {
+		n, err := count(stream, ctx)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// StreamKey returns the name of the Redis stream backing the queue
+func (eq *EventQueue) StreamKey() string {
+	return eq.streamKey
+}
+
+// TrimPolicy describes how the streams are trimmed, for logs
+func (eq *EventQueue) TrimPolicy() string {
+	switch eq.trimMode {
+	case TrimMinID:
+		return fmt.Sprintf("entries older than %v", eq.maxAge)
+	case TrimNone:
+		return "never"
 	}
+	return fmt.Sprintf("about %d entries", eq.maxLen)
 }
 
-// Enqueue adds events to the Redis stream
+// xadd returns XADD arguments adding values to stream under the trimming policy.
+// Trimming is approximate, which lets Redis drop whole macro nodes cheaply.
+func (eq *EventQueue) xadd(stream string, values map[string]interface{}) *redis.XAddArgs {
+	args := &redis.XAddArgs{Stream: stream, Values: values}
+	switch eq.trimMode {
+	case TrimMaxLen:
+		args.MaxLen = eq.maxLen
+		args.Approx = true
+	case TrimMinID:
+		args.MinID = strconv.FormatInt(time.Now().Add(-eq.maxAge).UnixMilli(), 10)
+		args.Approx = true
+	}
+	return args
+}
+
+// ConsumerGroup returns the consumer group the queue reads as
+func (eq *EventQueue) ConsumerGroup() string {
+	return eq.consumerGroup
+}
+
+// Enqueue adds events to the Redis stream, tagged with the request ID and ingest stats
+// project carried by ctx. Events of priority types go to the priority lane instead;
+// when a batch has both kinds, the two messages are added in one transaction.
 func (eq *EventQueue) Enqueue(ctx context.Context, sessionID uuid.UUID, events []models.EventData) error {
+	urgent, rest := eq.splitPriority(events)
+
+	var adds []*redis.XAddArgs
+	if len(urgent) > 0 {
+		args, err := eq.priority.enqueueArgs(ctx, sessionID, urgent)
+		if err != nil {
+			return err
+		}
+		adds = append(adds, args)
+	}
+	if len(rest) > 0 || len(urgent) == 0 {
+		args, err := eq.streamFor(sessionID.String()).enqueueArgs(ctx, sessionID, rest)
+		if err != nil {
+			return err
+		}
+		adds = append(adds, args)
+	}
+
+	if len(adds) == 1 {
+		if _, err := eq.redis.XAdd(ctx, adds[0]).Result(); err != nil {
+			return fmt.Errorf("failed to add event to stream: %w", err)
+		}
+		return nil
+	}
+	pipe := eq.redis.TxPipeline()
+	for _, args := range adds {
+		pipe.XAdd(ctx, args)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to add event to stream: %w", err)
+	}
+	return nil
+}
+
+// enqueueArgs returns the XADD arguments adding a session's events to eq's stream
+func (eq *EventQueue) enqueueArgs(ctx context.Context, sessionID uuid.UUID, events []models.EventData) (*redis.XAddArgs, error) {
 	queuedEvent := QueuedEvent{
 		SessionID: sessionID.String(),
+		RequestID: requestid.FromContext(ctx),
 		Events:    events,
 		QueuedAt:  time.Now(),
 	}
+	if project := stats.ProjectFromContext(ctx); project != stats.DefaultProject {
+		queuedEvent.Project = project
+	}
 
 	// Serialize the event
 	data, err := json.Marshal(queuedEvent)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
 	}
 
-	// Add to Redis stream
-	args := &redis.XAddArgs{
-		Stream: eq.streamKey,
-		MaxLen: 100000, // Keep max 100k messages to prevent unbounded growth
-		Approx: true,   // Use approximate trimming for better performance
-		Values: map[string]interface{}{
-			"data": string(data),
-		},
+	values, err := eq.entryValues(data)
+	if err != nil {
+		return nil, err
 	}
 
-	if _, err := eq.redis.XAdd(ctx, args).Result(); err != nil {
-		return fmt.Errorf("failed to add event to stream: %w", err)
+	// Add to Redis stream, trimming it to prevent unbounded growth
+	return eq.xadd(eq.streamKey, values), nil
+}
+
+// DeadLetterKey returns the name of the stream holding messages that failed permanently
+func (eq *EventQueue) DeadLetterKey() string {
+	return eq.streamKey + ":dead"
+}
+
+// DeadLetter copies messages to the dead-letter stream along with reason and
+// acknowledges them, in one transaction, so they are not delivered again
+func (eq *EventQueue) DeadLetter(ctx context.Context, messages []StreamMessage, reason error) error {
+	if len(messages) == 0 {
+		return nil
 	}
+	if eq.shards != nil {
+		return errSharded
+	}
+
+	failedAt := time.Now().UTC().Format(time.RFC3339)
+	pipe := eq.redis.TxPipeline()
+	ids := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		data, err := json.Marshal(msg.QueuedEvent)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		values, err := eq.entryValues(data)
+		if err != nil {
+			return err
+		}
+		values["message_id"] = msg.ID
+		values["error"] = reason.Error()
+		values["failed_at"] = failedAt
+		pipe.XAdd(ctx, eq.xadd(eq.DeadLetterKey(), values))
+		ids = append(ids, msg.ID)
+	}
+	pipe.XAck(ctx, eq.streamKey, eq.consumerGroup, ids...)
 
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to dead-letter messages: %w", err)
+	}
 	return nil
 }
 
 // CreateConsumerGroup creates the consumer group for processing events
 // This should be called once at startup
 func (eq *EventQueue) CreateConsumerGroup(ctx context.Context) error {
+	if eq.priority != nil {
+		if err := eq.priority.CreateConsumerGroup(ctx); err != nil {
+			return err
+		}
+	}
+	for _, shard := range eq.shards {
+		if err := shard.CreateConsumerGroup(ctx); err != nil {
+			return err
+		}
+	}
+	if eq.shards != nil {
+		return nil
+	}
+
 	// Try to create the consumer group
 	// If it already exists, ignore the error
-	err := eq.redis.XGroupCreateMkStream(ctx, eq.streamKey, ConsumerGroup, "0").Err()
+	err := eq.redis.XGroupCreateMkStream(ctx, eq.streamKey, eq.consumerGroup, "0").Err()
 	if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
 		return fmt.Errorf("failed to create consumer group: %w", err)
 	}
 	return nil
 }
 
-// ReadEvents reads a batch of events from the stream for processing
-func (eq *EventQueue) ReadEvents(ctx context.Context, consumerName string, count int64) ([]StreamMessage, error) {
+// ReadEvents reads a batch of events from the stream for processing, blocking for up
+// to block when the stream is empty; with a negative block it returns at once
+func (eq *EventQueue) ReadEvents(ctx context.Context, consumerName string, count int64, block time.Duration) ([]StreamMessage, error) {
+	if eq.shards != nil {
+		return nil, errSharded
+	}
+
 	// Read from the consumer group
 	streams, err := eq.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
-		Group:    ConsumerGroup,
+		Group:    eq.consumerGroup,
 		Consumer: consumerName,
 		Streams:  []string{eq.streamKey, ">"},
 		Count:    count,
-		Block:    1 * time.Second, // Block for 1 second if no messages
+		Block:    block,
 	}).Result()
 
 	if err != nil {
@@ -105,27 +381,111 @@ func (eq *EventQueue) ReadEvents(ctx context.Context, consumerName string, count
 		return []StreamMessage{}, nil
 	}
 
-	// Convert to our StreamMessage type
-	messages := make([]StreamMessage, 0, len(streams[0].Messages))
-	for _, msg := range streams[0].Messages {
-		dataStr, ok := msg.Values["data"].(string)
-		if !ok {
+	return toStreamMessages(streams[0].Messages), nil
+}
+
+// ClaimStale transfers up to count messages pending for longer than minIdle, whoever
+// read them, to consumerName, scanning the pending entries from start. It returns the
+// claimed messages with their delivery counts (claiming counts as a delivery) and the
+// cursor to continue from, "0-0" once the whole list was scanned. Claimed entries that
+// cannot be decoded are acknowledged, since no consumer could ever process them.
+func (eq *EventQueue) ClaimStale(ctx context.Context, consumerName string, minIdle time.Duration, start string, count int64) ([]StreamMessage, string, error) {
+	if eq.shards != nil {
+		return nil, "", errSharded
+	}
+	msgs, next, err := eq.redis.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   eq.streamKey,
+		Group:    eq.consumerGroup,
+		Consumer: consumerName,
+		MinIdle:  minIdle,
+		Start:    start,
+		Count:    count,
+	}).Result()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to claim stale messages: %w", err)
+	}
+	if len(msgs) == 0 {
+		return []StreamMessage{}, next, nil
+	}
+
+	messages := toStreamMessages(msgs)
+	if len(messages) < len(msgs) {
+		decoded := make(map[string]bool, len(messages))
+		for _, msg := range messages {
+			decoded[msg.ID] = true
+		}
+		var malformed []string
+		for _, msg := range msgs {
+			if !decoded[msg.ID] {
+				malformed = append(malformed, msg.ID)
+			}
+		}
+		if err := eq.Acknowledge(ctx, malformed...); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// The consumer may also hold entries in this range it claimed earlier, so the range
+	// is read in full rather than capped at the number just claimed
+	pending, err := eq.redis.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   eq.streamKey,
+		Group:    eq.consumerGroup,
+		Start:    msgs[0].ID,
+		End:      msgs[len(msgs)-1].ID,
+		Count:    eq.maxLen,
+		Consumer: consumerName,
+	}).Result()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get delivery counts: %w", err)
+	}
+	deliveries := make(map[string]int, len(pending))
+	for _, entry := range pending {
+		deliveries[entry.ID] = int(entry.RetryCount)
+	}
+	for i := range messages {
+		messages[i].DeliveryCount = deliveries[messages[i].ID]
+	}
+
+	return messages, next, nil
+}
+
+// ReadRange returns up to count messages with IDs in [start, end] without consuming
+// them from the consumer group. "-" and "+" denote the stream's first and last IDs;
+// prefix start with "(" to make it exclusive.
+func (eq *EventQueue) ReadRange(ctx context.Context, start, end string, count int64) ([]StreamMessage, error) {
+	if eq.shards != nil {
+		return nil, errSharded
+	}
+	msgs, err := eq.redis.XRangeN(ctx, eq.streamKey, start, end, count).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stream range: %w", err)
+	}
+	return toStreamMessages(msgs), nil
+}
+
+// toStreamMessages decodes raw stream entries, decompressing them as needed and
+// skipping malformed ones
+func toStreamMessages(msgs []redis.XMessage) []StreamMessage {
+	messages := make([]StreamMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		data, err := entryPayload(msg.Values)
+		if err != nil {
 			continue
 		}
 
 		var queuedEvent QueuedEvent
-		if err := json.Unmarshal([]byte(dataStr), &queuedEvent); err != nil {
+		if err := json.Unmarshal(data, &queuedEvent); err != nil {
 			continue
 		}
 
 		messages = append(messages, StreamMessage{
-			ID:           msg.ID,
-			QueuedEvent:  queuedEvent,
-			DeliveryCount: 0, // Will be tracked by Redis
+			ID:            msg.ID,
+			QueuedEvent:   queuedEvent,
+			DeliveryCount: 0, // Filled in by ClaimStale
 		})
 	}
 
-	return messages, nil
+	return messages
 }
 
 // Acknowledge marks messages as successfully processed
@@ -133,8 +493,11 @@ func (eq *EventQueue) Acknowledge(ctx context.Context, messageIDs ...string) err
 	if len(messageIDs) == 0 {
 		return nil
 	}
+	if eq.shards != nil {
+		return errSharded
+	}
 
-	if err := eq.redis.XAck(ctx, eq.streamKey, ConsumerGroup, messageIDs...).Err(); err != nil {
+	if err := eq.redis.XAck(ctx, eq.streamKey, eq.consumerGroup, messageIDs...).Err(); err != nil {
 		return fmt.Errorf("failed to acknowledge messages: %w", err)
 	}
 
@@ -143,6 +506,10 @@ func (eq *EventQueue) Acknowledge(ctx context.Context, messageIDs ...string) err
 
 // GetQueueDepth returns the current number of messages in the stream
 func (eq *EventQueue) GetQueueDepth(ctx context.Context) (int64, error) {
+	return eq.sumStreams(ctx, (*EventQueue).streamDepth)
+}
+
+func (eq *EventQueue) streamDepth(ctx context.Context) (int64, error) {
 	length, err := eq.redis.XLen(ctx, eq.streamKey).Result()
 	if err != nil {
 		return 0, fmt.Errorf("failed to get queue depth: %w", err)
@@ -152,7 +519,11 @@ func (eq *EventQueue) GetQueueDepth(ctx context.Context) (int64, error) {
 
 // GetPendingCount returns the number of pending (unacknowledged) messages
 func (eq *EventQueue) GetPendingCount(ctx context.Context) (int64, error) {
-	pending, err := eq.redis.XPending(ctx, eq.streamKey, ConsumerGroup).Result()
+	return eq.sumStreams(ctx, (*EventQueue).streamPending)
+}
+
+func (eq *EventQueue) streamPending(ctx context.Context) (int64, error) {
+	pending, err := eq.redis.XPending(ctx, eq.streamKey, eq.consumerGroup).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return 0, nil
@@ -162,7 +533,52 @@ func (eq *EventQueue) GetPendingCount(ctx context.Context) (int64, error) {
 	return pending.Count, nil
 }
 
-// StreamMessage represents a message from the Redis stream
+// GetBacklog returns the messages the consumer group has yet to finish: entries not
+// yet delivered plus delivered but unacknowledged ones
+func (eq *EventQueue) GetBacklog(ctx context.Context) (int64, error) {
+	return eq.sumStreams(ctx, (*EventQueue).streamBacklog)
+}
+
+func (eq *EventQueue) streamBacklog(ctx context.Context) (int64, error) {
+	groups, err := eq.redis.XInfoGroups(ctx, eq.streamKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get consumer group info: %w", err)
+	}
+	for _, group := range groups {
+		if group.Name != eq.consumerGroup {
+			continue
+		}
+		lag := group.Lag
+		if lag < 0 {
+			// Redis cannot always compute the lag, e.g. after entries were trimmed
+			lag = 0
+		}
+		return lag + group.Pending, nil
+	}
+	return 0, nil
+}
+
+// GetConsumerPending returns the entries pending to consumerNames across every stream
+func (eq *EventQueue) GetConsumerPending(ctx context.Context, consumerNames []string) (int64, error) {
+	return eq.sumStreams(ctx, func(stream *EventQueue, ctx context.Context) (int64, error) {
+		return stream.streamConsumerPending(ctx, consumerNames)
+	})
+}
+
+func (eq *EventQueue) streamConsumerPending(ctx context.Context, consumerNames []string) (int64, error) {
+	pending, err := eq.redis.XPending(ctx, eq.streamKey, eq.consumerGroup).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pending entries: %w", err)
+	}
+	var total int64
+	for _, name := range consumerNames {
+		total += pending.Consumers[name]
+	}
+	return total, nil
+}
+
+// StreamMessage represents a message from the Redis stream. DeliveryCount is only
+// known for messages returned by ClaimStale.
 type StreamMessage struct {
 	ID            string
 	QueuedEvent   QueuedEvent
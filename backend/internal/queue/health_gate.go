@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// HealthGate pauses event consumption while the database is unhealthy. Reading on
+// would only fail every insert, burning retries and redeliveries until messages are
+// dead-lettered for an outage. The check runs every interval; failures consecutive
+// failed checks close the gate and the first successful one opens it again. A nil
+// *HealthGate is always open.
+type HealthGate struct {
+	check    func(ctx context.Context) error
+	interval time.Duration
+	failures int
+	warmup   time.Duration
+
+	mu          sync.Mutex
+	paused      bool
+	pausedSince time.Time
+	// open is closed while the gate is open; a new one is made when it closes
+	open chan struct{}
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewHealthGate creates a gate around check, e.g. the database ping. Workers resume
+// at random within warmup of the database recovering, so they do not all hit it at
+// once.
+func NewHealthGate(check func(ctx context.Context) error, interval time.Duration, failures int, warmup time.Duration) *HealthGate {
+	if failures < 1 {
+		failures = 1
+	}
+	open := make(chan struct{})
+	close(open)
+	return &HealthGate{
+		check:    check,
+		interval: interval,
+		failures: failures,
+		warmup:   warmup,
+		open:     open,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start runs the health check in the background until Stop
+func (g *HealthGate) Start(ctx context.Context) {
+	if g == nil {
+		return
+	}
+	g.wg.Add(1)
+	go g.run(ctx)
+	log.Printf("[HealthGate] Started, interval: %v, failures: %d, warm-up: %v", g.interval, g.failures, g.warmup)
+}
+
+// Stop ends the health check; workers still waiting are released by their own stop
+func (g *HealthGate) Stop() {
+	if g == nil {
+		return
+	}
+	close(g.stopChan)
+	g.wg.Wait()
+	log.Println("[HealthGate] Stopped")
+}
+
+func (g *HealthGate) run(ctx context.Context) {
+	defer g.wg.Done()
+
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	failed := 0
+	for {
+		select {
+		case <-g.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, g.interval)
+		err := g.check(checkCtx)
+		cancel()
+		if err != nil {
+			failed++
+			if failed >= g.failures {
+				g.pause(err)
+			}
+			continue
+		}
+		failed = 0
+		g.resume()
+	}
+}
+
+func (g *HealthGate) pause(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		return
+	}
+	g.paused = true
+	g.pausedSince = time.Now()
+	g.open = make(chan struct{})
+	log.Printf("[HealthGate] Database unhealthy, pausing event consumption: %v", err)
+}
+
+func (g *HealthGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return
+	}
+	g.paused = false
+	close(g.open)
+	log.Printf("[HealthGate] Database healthy again after %v, resuming event consumption", time.Since(g.pausedSince).Round(time.Second))
+}
+
+// Wait returns at once while the gate is open. Otherwise it blocks until the gate
+// opens and then for a random share of the warm-up. It returns false when stop is
+// closed first.
+func (g *HealthGate) Wait(stop <-chan struct{}) bool {
+	if g == nil {
+		return true
+	}
+	g.mu.Lock()
+	paused, open := g.paused, g.open
+	g.mu.Unlock()
+	if !paused {
+		return true
+	}
+
+	select {
+	case <-stop:
+		return false
+	case <-open:
+	}
+	if g.warmup > 0 {
+		select {
+		case <-stop:
+			return false
+		case <-time.After(rand.N(g.warmup)):
+		}
+	}
+	return true
+}
+
+// Paused reports whether consumption is paused, and since when
+func (g *HealthGate) Paused() (bool, time.Time) {
+	if g == nil {
+		return false, time.Time{}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused, g.pausedSince
+}
@@ -0,0 +1,148 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/redis/go-redis/v9"
+)
+
+// Defaults for the background job stream
+const (
+	DefaultJobStreamKey     = "jobs:stream"
+	DefaultJobConsumerGroup = "job-runners"
+	DefaultJobMaxAttempts   = 3
+)
+
+// JobQueue queues generic background jobs. The jobs table holds each job's state;
+// the Redis stream only carries job IDs to wake a runner, so a lost message delays a
+// job until the runner's sweeper re-sends it but never loses it.
+type JobQueue struct {
+	redis         *redis.Client
+	jobRepo       *repository.JobRepository
+	streamKey     string
+	consumerGroup string
+	maxLen        int64
+}
+
+// NewJobQueue creates a job queue, filling unset config fields with defaults
+func NewJobQueue(redisClient *RedisClient, jobRepo *repository.JobRepository, config QueueConfig) *JobQueue {
+	if config.StreamKey == "" {
+		config.StreamKey = DefaultJobStreamKey
+	}
+	if config.ConsumerGroup == "" {
+		config.ConsumerGroup = DefaultJobConsumerGroup
+	}
+	if config.MaxLen <= 0 {
+		config.MaxLen = DefaultMaxLen
+	}
+
+	return &JobQueue{
+		redis:         redisClient.GetClient(),
+		jobRepo:       jobRepo,
+		streamKey:     config.StreamKey,
+		consumerGroup: config.ConsumerGroup,
+		maxLen:        config.MaxLen,
+	}
+}
+
+// Enqueue stores a new job of jobType and wakes a runner. payload is marshalled as
+// the job's JSON payload; maxAttempts <= 0 uses DefaultJobMaxAttempts.
+func (jq *JobQueue) Enqueue(ctx context.Context, jobType string, payload interface{}, maxAttempts int) (*models.Job, error) {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultJobMaxAttempts
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job payload: %w", err)
+	}
+
+	job, err := jq.jobRepo.Create(ctx, jobType, data, maxAttempts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The job is stored; if the message is lost the sweeper sends it again
+	if err := jq.send(ctx, job.JobID); err != nil {
+		log.Printf("[JobQueue] Job %s stored but not sent, the sweeper will retry: %v", job.JobID, err)
+	}
+	return job, nil
+}
+
+// send adds a wake-up message for the job to the stream
+func (jq *JobQueue) send(ctx context.Context, jobID uuid.UUID) error {
+	err := jq.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: jq.streamKey,
+		MaxLen: jq.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"job_id": jobID.String(),
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to add job to stream: %w", err)
+	}
+	return nil
+}
+
+// CreateConsumerGroup creates the runners' consumer group if it does not exist
+func (jq *JobQueue) CreateConsumerGroup(ctx context.Context) error {
+	err := jq.redis.XGroupCreateMkStream(ctx, jq.streamKey, jq.consumerGroup, "0").Err()
+	if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+	return nil
+}
+
+// jobMessage is a decoded stream entry
+type jobMessage struct {
+	ID    string
+	JobID uuid.UUID
+}
+
+// read blocks for up to block for the next job messages. Malformed entries are
+// acknowledged and skipped.
+func (jq *JobQueue) read(ctx context.Context, consumerName string, count int64, block time.Duration) ([]jobMessage, error) {
+	streams, err := jq.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    jq.consumerGroup,
+		Consumer: consumerName,
+		Streams:  []string{jq.streamKey, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read from job stream: %w", err)
+	}
+	if len(streams) == 0 {
+		return nil, nil
+	}
+
+	var messages []jobMessage
+	for _, msg := range streams[0].Messages {
+		raw, _ := msg.Values["job_id"].(string)
+		jobID, err := uuid.Parse(raw)
+		if err != nil {
+			jq.ack(ctx, msg.ID)
+			continue
+		}
+		messages = append(messages, jobMessage{ID: msg.ID, JobID: jobID})
+	}
+	return messages, nil
+}
+
+func (jq *JobQueue) ack(ctx context.Context, messageIDs ...string) error {
+	if err := jq.redis.XAck(ctx, jq.streamKey, jq.consumerGroup, messageIDs...).Err(); err != nil {
+		return fmt.Errorf("failed to acknowledge job messages: %w", err)
+	}
+	return nil
+}
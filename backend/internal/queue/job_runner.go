@@ -0,0 +1,280 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// maxJobRetryDelay caps the delay before a failed job is retried
+const maxJobRetryDelay = 10 * time.Minute
+
+// JobHandler runs one job of a registered type. It reports progress through progress
+// and returns a result that is stored as the job's JSON result. ctx is cancelled when
+// the runner stops; the job is then released and retried later without counting the
+// attempt.
+type JobHandler func(ctx context.Context, job *models.Job, progress JobProgressFunc) (interface{}, error)
+
+// JobProgressFunc records done units of work out of total; total may be nil when unknown
+type JobProgressFunc func(done int64, total *int64)
+
+// RunnerConfig holds configuration for the job runner. Running jobs heartbeat every
+// StaleAfter/3 and are requeued once silent for StaleAfter. The sweeper runs every
+// SweepInterval and re-sends messages of due jobs not picked up within ResendAfter.
+type RunnerConfig struct {
+	Concurrency    int
+	BlockTimeout   time.Duration
+	ConsumerPrefix string
+	SweepInterval  time.Duration
+	StaleAfter     time.Duration
+	ResendAfter    time.Duration
+	RetryDelay     time.Duration
+}
+
+// JobRunner executes generic background jobs read from the job stream
+type JobRunner struct {
+	queue    *JobQueue
+	jobRepo  *repository.JobRepository
+	handlers map[string]JobHandler
+	config   RunnerConfig
+	stopChan chan struct{}
+	runCtx   context.Context
+	stopRuns context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewJobRunner creates a job runner; register handlers before calling Start
+func NewJobRunner(queue *JobQueue, config RunnerConfig) *JobRunner {
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	return &JobRunner{
+		queue:    queue,
+		jobRepo:  queue.jobRepo,
+		handlers: make(map[string]JobHandler),
+		config:   config,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Register sets the handler for jobType
+func (jr *JobRunner) Register(jobType string, handler JobHandler) {
+	jr.handlers[jobType] = handler
+}
+
+// Start starts the runner's workers and sweeper in the background
+func (jr *JobRunner) Start(ctx context.Context) error {
+	if err := jr.queue.CreateConsumerGroup(ctx); err != nil {
+		return err
+	}
+
+	log.Printf("[JobRunner] Starting %d workers on stream %s, group %s",
+		jr.config.Concurrency, jr.queue.streamKey, jr.queue.consumerGroup)
+
+	jr.runCtx, jr.stopRuns = context.WithCancel(ctx)
+	for i := 0; i < jr.config.Concurrency; i++ {
+		jr.wg.Add(1)
+		go jr.work(i)
+	}
+	jr.wg.Add(1)
+	go jr.sweep()
+
+	return nil
+}
+
+// Stop interrupts running jobs, releases them for a later retry and waits for the
+// workers to exit
+func (jr *JobRunner) Stop() {
+	close(jr.stopChan)
+	if jr.stopRuns != nil {
+		jr.stopRuns()
+	}
+	jr.wg.Wait()
+	log.Println("[JobRunner] Stopped")
+}
+
+func (jr *JobRunner) stopped() bool {
+	select {
+	case <-jr.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+func (jr *JobRunner) work(id int) {
+	defer jr.wg.Done()
+
+	consumerName := fmt.Sprintf("job-worker-%d", id)
+	if jr.config.ConsumerPrefix != "" {
+		consumerName = jr.config.ConsumerPrefix + "-" + consumerName
+	}
+
+	var backoff time.Duration
+	for !jr.stopped() {
+		messages, err := jr.queue.read(jr.runCtx, consumerName, 1, jr.config.BlockTimeout)
+		if err != nil {
+			if jr.runCtx.Err() != nil {
+				continue
+			}
+			backoff = nextBackoff(backoff, jr.config.RetryDelay)
+			log.Printf("[JobRunner] Error reading jobs, retrying in %v: %v", backoff, err)
+			select {
+			case <-jr.stopChan:
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+
+		for _, msg := range messages {
+			jr.run(msg)
+		}
+	}
+}
+
+// run claims and executes the job of one message. The message is acknowledged in any
+// case: the job's row, not the message, decides whether it runs again.
+func (jr *JobRunner) run(msg jobMessage) {
+	// Bookkeeping outlives runCtx so interrupted jobs can still be released
+	ctx := context.Background()
+	defer func() {
+		if err := jr.queue.ack(ctx, msg.ID); err != nil {
+			log.Printf("[JobRunner] %v", err)
+		}
+	}()
+
+	job, err := jr.jobRepo.Claim(ctx, msg.JobID)
+	if err != nil {
+		log.Printf("[JobRunner] Error claiming job %s: %v", msg.JobID, err)
+		return
+	}
+	if job == nil {
+		return
+	}
+
+	handler, ok := jr.handlers[job.Type]
+	if !ok {
+		jr.fail(ctx, job, fmt.Errorf("no handler registered for job type %q", job.Type))
+		return
+	}
+
+	log.Printf("[JobRunner] Running %s job %s (attempt %d/%d)", job.Type, job.JobID, job.Attempts, job.MaxAttempts)
+
+	stopHeartbeat := jr.heartbeat(ctx, job)
+	progress := func(done int64, total *int64) {
+		if err := jr.jobRepo.SetProgress(ctx, job.JobID, done, total); err != nil {
+			log.Printf("[JobRunner] %v", err)
+		}
+	}
+	result, err := handler(jr.runCtx, job, progress)
+	stopHeartbeat()
+
+	if err != nil {
+		if jr.runCtx.Err() != nil {
+			log.Printf("[JobRunner] Job %s interrupted by shutdown, releasing", job.JobID)
+			if err := jr.jobRepo.Release(ctx, job.JobID); err != nil {
+				log.Printf("[JobRunner] %v", err)
+			}
+			return
+		}
+		jr.fail(ctx, job, err)
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		jr.fail(ctx, job, fmt.Errorf("failed to marshal job result: %w", err))
+		return
+	}
+	if err := jr.jobRepo.Complete(ctx, job.JobID, data); err != nil {
+		log.Printf("[JobRunner] %v", err)
+		return
+	}
+	log.Printf("[JobRunner] Job %s completed", job.JobID)
+}
+
+// fail records a failed attempt, scheduling a retry with exponential delay
+func (jr *JobRunner) fail(ctx context.Context, job *models.Job, jobErr error) {
+	delay := jr.config.RetryDelay << (job.Attempts - 1)
+	if delay <= 0 || delay > maxJobRetryDelay {
+		delay = maxJobRetryDelay
+	}
+
+	status, err := jr.jobRepo.Fail(ctx, job.JobID, jobErr.Error(), delay)
+	if err != nil {
+		log.Printf("[JobRunner] %v", err)
+		return
+	}
+	if status == models.JobStatusFailed {
+		log.Printf("[JobRunner] Job %s failed after %d attempts: %v", job.JobID, job.Attempts, jobErr)
+		return
+	}
+	log.Printf("[JobRunner] Job %s attempt %d failed, retrying in %v: %v", job.JobID, job.Attempts, delay, jobErr)
+}
+
+// heartbeat keeps a running job from being requeued as stale until the returned
+// function is called
+func (jr *JobRunner) heartbeat(ctx context.Context, job *models.Job) func() {
+	interval := jr.config.StaleAfter / 3
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := jr.jobRepo.Heartbeat(ctx, job.JobID); err != nil {
+					log.Printf("[JobRunner] %v", err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// sweep periodically requeues jobs of crashed runners and re-sends messages for due
+// jobs: retries whose delay has passed and jobs whose message was lost
+func (jr *JobRunner) sweep() {
+	defer jr.wg.Done()
+
+	ticker := time.NewTicker(jr.config.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-jr.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		if n, err := jr.jobRepo.RequeueStale(jr.runCtx, jr.config.StaleAfter); err != nil {
+			log.Printf("[JobRunner] %v", err)
+		} else if n > 0 {
+			log.Printf("[JobRunner] Requeued %d stale jobs", n)
+		}
+
+		ids, err := jr.jobRepo.MarkDue(jr.runCtx, jr.config.ResendAfter, 100)
+		if err != nil {
+			log.Printf("[JobRunner] %v", err)
+			continue
+		}
+		for _, id := range ids {
+			if err := jr.queue.send(jr.runCtx, id); err != nil {
+				log.Printf("[JobRunner] %v", err)
+			}
+		}
+	}
+}
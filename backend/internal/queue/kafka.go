@@ -0,0 +1,549 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/requestid"
+	"github.com/ngocp/user-tracker/internal/stats"
+	"github.com/segmentio/kafka-go"
+)
+
+// Defaults used when KafkaConfig leaves a field empty
+const (
+	DefaultKafkaTopic             = "events"
+	DefaultKafkaPartitions        = 6
+	DefaultKafkaReplicationFactor = 1
+)
+
+// kafkaDeadSuffix names the dead-letter topic after the queue's, e.g. events.dead
+const kafkaDeadSuffix = ".dead"
+
+// kafkaFetchLinger is how long a read waits for each further message once it has
+// one, so a batch is filled from what the reader has already fetched
+const kafkaFetchLinger = 10 * time.Millisecond
+
+// KafkaConfig names the Kafka topic and consumer group of a pipeline. Partitions and
+// ReplicationFactor are only used when the topics do not exist yet. Compression
+// (default CompressionNone) applies to produced message batches.
+type KafkaConfig struct {
+	Brokers           []string
+	Topic             string
+	ConsumerGroup     string
+	Partitions        int
+	ReplicationFactor int
+	Compression       string
+}
+
+// KafkaQueue carries events over a Kafka topic. Each session's batches are keyed by
+// session ID, so they stay in order on one partition. The process reads through one
+// member of the consumer group, shared by its workers; Kafka spreads partitions over
+// processes, not workers.
+//
+// Kafka only commits an offset per partition, so a message counts as pending from
+// being read until it and every message before it on its partition are
+// acknowledged. Pending messages are kept in memory: ClaimStale hands those idle
+// for too long to the reclaimer, like the pending entries of a Redis stream, and
+// those of a process that dies are delivered again from the committed offset.
+type KafkaQueue struct {
+	client        *kafka.Client
+	writer        *kafka.Writer
+	deadWriter    *kafka.Writer
+	brokers       []string
+	topic         string
+	consumerGroup string
+	partitions    int
+	replication   int
+
+	// fetchMu lets one worker read at a time, so offsets are recorded in the order
+	// the reader returns them
+	fetchMu sync.Mutex
+	mu      sync.Mutex
+	reader  *kafka.Reader
+	offsets *offsetTracker
+	// commitMu keeps commits in order, so a slower one cannot move an offset back
+	commitMu sync.Mutex
+}
+
+// NewKafkaQueue creates a queue on config.Topic, filling unset config fields with
+// defaults. Nothing is sent to the brokers until the queue is used.
+func NewKafkaQueue(config KafkaConfig) *KafkaQueue {
+	if config.Topic == "" {
+		config.Topic = DefaultKafkaTopic
+	}
+	if config.ConsumerGroup == "" {
+		config.ConsumerGroup = DefaultConsumerGroup
+	}
+	if config.Partitions <= 0 {
+		config.Partitions = DefaultKafkaPartitions
+	}
+	if config.ReplicationFactor <= 0 {
+		config.ReplicationFactor = DefaultKafkaReplicationFactor
+	}
+
+	var compression kafka.Compression
+	switch config.Compression {
+	case CompressionGzip:
+		compression = kafka.Gzip
+	case CompressionZstd:
+		compression = kafka.Zstd
+	}
+	newWriter := func(topic string) *kafka.Writer {
+		return &kafka.Writer{
+			Addr:         kafka.TCP(config.Brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			Compression:  compression,
+			// Enqueue waits for its own write, so batching only delays ingest
+			BatchTimeout: time.Millisecond,
+		}
+	}
+
+	return &KafkaQueue{
+		client:        &kafka.Client{Addr: kafka.TCP(config.Brokers...)},
+		writer:        newWriter(config.Topic),
+		deadWriter:    newWriter(config.Topic + kafkaDeadSuffix),
+		brokers:       config.Brokers,
+		topic:         config.Topic,
+		consumerGroup: config.ConsumerGroup,
+		partitions:    config.Partitions,
+		replication:   config.ReplicationFactor,
+		offsets:       newOffsetTracker(),
+	}
+}
+
+func (kq *KafkaQueue) StreamKey() string {
+	return kq.topic
+}
+
+func (kq *KafkaQueue) ConsumerGroup() string {
+	return kq.consumerGroup
+}
+
+// DeadLetterKey returns the name of the topic holding messages that failed permanently
+func (kq *KafkaQueue) DeadLetterKey() string {
+	return kq.topic + kafkaDeadSuffix
+}
+
+// Enqueue adds events to the topic, keyed by session ID and tagged with the request ID
+// and ingest stats project carried by ctx
+func (kq *KafkaQueue) Enqueue(ctx context.Context, sessionID uuid.UUID, events []models.EventData) error {
+	queuedEvent := QueuedEvent{
+		SessionID: sessionID.String(),
+		RequestID: requestid.FromContext(ctx),
+		Events:    events,
+		QueuedAt:  time.Now(),
+	}
+	if project := stats.ProjectFromContext(ctx); project != stats.DefaultProject {
+		queuedEvent.Project = project
+	}
+
+	data, err := json.Marshal(queuedEvent)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	if err := kq.writer.WriteMessages(ctx, kafka.Message{Key: []byte(queuedEvent.SessionID), Value: data}); err != nil {
+		return fmt.Errorf("failed to add event to topic: %w", err)
+	}
+	return nil
+}
+
+// CreateConsumerGroup creates the topic and its dead-letter topic unless they exist.
+// The consumer group itself is joined on the first read, so instances that only
+// ingest are never assigned partitions.
+func (kq *KafkaQueue) CreateConsumerGroup(ctx context.Context) error {
+	resp, err := kq.client.CreateTopics(ctx, &kafka.CreateTopicsRequest{
+		Topics: []kafka.TopicConfig{
+			{Topic: kq.topic, NumPartitions: kq.partitions, ReplicationFactor: kq.replication},
+			{Topic: kq.DeadLetterKey(), NumPartitions: 1, ReplicationFactor: kq.replication},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create topics: %w", err)
+	}
+	for topic, err := range resp.Errors {
+		if err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+			return fmt.Errorf("failed to create topic %s: %w", topic, err)
+		}
+	}
+	return nil
+}
+
+// consumer returns the group member the process reads through, joining the group on
+// first use
+func (kq *KafkaQueue) consumer() *kafka.Reader {
+	kq.mu.Lock()
+	defer kq.mu.Unlock()
+
+	if kq.reader == nil {
+		kq.reader = kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     kq.brokers,
+			GroupID:     kq.consumerGroup,
+			Topic:       kq.topic,
+			StartOffset: kafka.FirstOffset,
+			MaxBytes:    10 << 20,
+			// Offsets are committed as messages are acknowledged, see Acknowledge
+			CommitInterval: 0,
+		})
+	}
+	return kq.reader
+}
+
+// ReadEvents reads up to count messages, blocking for up to block (0 waits until ctx
+// is done) while none are available; with a negative block it returns at once.
+// consumerName only labels logs: all workers share the process's group member.
+func (kq *KafkaQueue) ReadEvents(ctx context.Context, consumerName string, count int64, block time.Duration) ([]StreamMessage, error) {
+	reader := kq.consumer()
+	kq.fetchMu.Lock()
+	defer kq.fetchMu.Unlock()
+
+	wait := block
+	if wait < 0 {
+		wait = kafkaFetchLinger
+	}
+	messages := []StreamMessage{}
+	for int64(len(messages)) < count {
+		fetchCtx, cancel := ctx, context.CancelFunc(func() {})
+		if wait > 0 {
+			fetchCtx, cancel = context.WithTimeout(ctx, wait)
+		}
+		msg, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				break
+			}
+			return nil, fmt.Errorf("failed to read from topic: %w", err)
+		}
+
+		var queuedEvent QueuedEvent
+		if err := json.Unmarshal(msg.Value, &queuedEvent); err != nil {
+			// Nothing could ever process it, and leaving it pending would hold back
+			// the partition's offset
+			log.Printf("[KafkaQueue] Skipping malformed message at %s: %v", kafkaMessageID(msg), err)
+			kq.mu.Lock()
+			kq.offsets.skip(msg)
+			kq.mu.Unlock()
+			continue
+		}
+
+		kq.mu.Lock()
+		id := kq.offsets.add(msg, queuedEvent, time.Now())
+		kq.mu.Unlock()
+		messages = append(messages, StreamMessage{ID: id, QueuedEvent: queuedEvent})
+		wait = kafkaFetchLinger
+	}
+	return messages, nil
+}
+
+// Acknowledge marks messages as processed and commits each partition's offset as far
+// as every message before it is acknowledged
+func (kq *KafkaQueue) Acknowledge(ctx context.Context, messageIDs ...string) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	kq.commitMu.Lock()
+	defer kq.commitMu.Unlock()
+
+	kq.mu.Lock()
+	commits := kq.offsets.ack(messageIDs)
+	reader := kq.reader
+	kq.mu.Unlock()
+	if len(commits) == 0 || reader == nil {
+		return nil
+	}
+
+	msgs := make([]kafka.Message, 0, len(commits))
+	for partition, next := range commits {
+		// The group commits the offset after the message's
+		msgs = append(msgs, kafka.Message{Topic: kq.topic, Partition: partition, Offset: next - 1})
+	}
+	if err := reader.CommitMessages(ctx, msgs...); err != nil {
+		return fmt.Errorf("failed to acknowledge messages: %w", err)
+	}
+
+	kq.mu.Lock()
+	for partition, next := range commits {
+		kq.offsets.committedTo(partition, next)
+	}
+	kq.mu.Unlock()
+	return nil
+}
+
+// DeadLetter copies messages to the dead-letter topic along with reason, then
+// acknowledges them. Kafka cannot do both atomically, so a failure in between leaves
+// copies of messages that are delivered again.
+func (kq *KafkaQueue) DeadLetter(ctx context.Context, messages []StreamMessage, reason error) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	failedAt := time.Now().UTC().Format(time.RFC3339)
+	letters := make([]kafka.Message, 0, len(messages))
+	ids := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		data, err := json.Marshal(msg.QueuedEvent)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		letters = append(letters, kafka.Message{
+			Key:   []byte(msg.QueuedEvent.SessionID),
+			Value: data,
+			Headers: []kafka.Header{
+				{Key: "message_id", Value: []byte(msg.ID)},
+				{Key: "error", Value: []byte(reason.Error())},
+				{Key: "failed_at", Value: []byte(failedAt)},
+			},
+		})
+		ids = append(ids, msg.ID)
+	}
+	if err := kq.deadWriter.WriteMessages(ctx, letters...); err != nil {
+		return fmt.Errorf("failed to dead-letter messages: %w", err)
+	}
+	return kq.Acknowledge(ctx, ids...)
+}
+
+// ClaimStale hands up to count of the process's pending messages read more than
+// minIdle ago to consumerName, counting it as a delivery. Only messages read by this
+// process are known; start is ignored and the cursor is "0-0" once none are left.
+func (kq *KafkaQueue) ClaimStale(ctx context.Context, consumerName string, minIdle time.Duration, start string, count int64) ([]StreamMessage, string, error) {
+	kq.mu.Lock()
+	defer kq.mu.Unlock()
+
+	claimed, more := kq.offsets.claimStale(time.Now(), minIdle, int(count))
+	next := "0-0"
+	if more {
+		next = claimed[len(claimed)-1].ID
+	}
+	return claimed, next, nil
+}
+
+// GetConsumerPending returns the messages this process has read and not yet
+// acknowledged. All workers share the process's group member, so consumerNames only
+// matter to queues that track consumers apart.
+func (kq *KafkaQueue) GetConsumerPending(ctx context.Context, consumerNames []string) (int64, error) {
+	kq.mu.Lock()
+	defer kq.mu.Unlock()
+	return int64(len(kq.offsets.pending)), nil
+}
+
+// GetQueueDepth returns the number of messages the topic retains
+func (kq *KafkaQueue) GetQueueDepth(ctx context.Context) (int64, error) {
+	offsets, err := kq.listOffsets(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get queue depth: %w", err)
+	}
+	var depth int64
+	for _, p := range offsets {
+		depth += p.LastOffset - p.FirstOffset
+	}
+	return depth, nil
+}
+
+// GetBacklog returns the messages past the consumer group's committed offsets, read
+// or not
+func (kq *KafkaQueue) GetBacklog(ctx context.Context) (int64, error) {
+	offsets, err := kq.listOffsets(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get backlog: %w", err)
+	}
+	partitions := make([]int, 0, len(offsets))
+	for _, p := range offsets {
+		partitions = append(partitions, p.Partition)
+	}
+	resp, err := kq.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: kq.consumerGroup,
+		Topics:  map[string][]int{kq.topic: partitions},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get committed offsets: %w", err)
+	}
+	if resp.Error != nil {
+		return 0, fmt.Errorf("failed to get committed offsets: %w", resp.Error)
+	}
+	committed := make(map[int]int64)
+	for _, p := range resp.Topics[kq.topic] {
+		committed[p.Partition] = p.CommittedOffset
+	}
+
+	var backlog int64
+	for _, p := range offsets {
+		// Without a commit the group starts from the first retained message
+		from, ok := committed[p.Partition]
+		if !ok || from < p.FirstOffset {
+			from = p.FirstOffset
+		}
+		if p.LastOffset > from {
+			backlog += p.LastOffset - from
+		}
+	}
+	return backlog, nil
+}
+
+// listOffsets returns the first and next offset of every partition of the topic
+func (kq *KafkaQueue) listOffsets(ctx context.Context) ([]kafka.PartitionOffsets, error) {
+	meta, err := kq.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{kq.topic}})
+	if err != nil {
+		return nil, err
+	}
+	var requests []kafka.OffsetRequest
+	for _, topic := range meta.Topics {
+		if topic.Name != kq.topic {
+			continue
+		}
+		if topic.Error != nil {
+			return nil, topic.Error
+		}
+		for _, p := range topic.Partitions {
+			requests = append(requests, kafka.FirstOffsetOf(p.ID), kafka.LastOffsetOf(p.ID))
+		}
+	}
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	resp, err := kq.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{kq.topic: requests},
+	})
+	if err != nil {
+		return nil, err
+	}
+	offsets := resp.Topics[kq.topic]
+	for _, p := range offsets {
+		if p.Error != nil {
+			return nil, p.Error
+		}
+	}
+	return offsets, nil
+}
+
+// Close leaves the consumer group, so its partitions move to other processes at once,
+// and flushes the writers
+func (kq *KafkaQueue) Close() error {
+	kq.mu.Lock()
+	reader := kq.reader
+	kq.reader = nil
+	kq.mu.Unlock()
+
+	var errs []error
+	if reader != nil {
+		errs = append(errs, reader.Close())
+	}
+	errs = append(errs, kq.writer.Close(), kq.deadWriter.Close())
+	return errors.Join(errs...)
+}
+
+func kafkaMessageID(msg kafka.Message) string {
+	return fmt.Sprintf("%d-%d", msg.Partition, msg.Offset)
+}
+
+// offsetTracker follows the messages a process has read but not acknowledged, and
+// for each partition the offset up to which everything read is acknowledged: as far
+// as the consumer group may commit
+type offsetTracker struct {
+	pending   map[string]*pendingMessage
+	read      map[int]int64 // offset after the last message read, per partition
+	committed map[int]int64 // offset last committed, per partition
+}
+
+type pendingMessage struct {
+	partition  int
+	offset     int64
+	message    StreamMessage
+	readAt     time.Time
+	deliveries int
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		pending:   make(map[string]*pendingMessage),
+		read:      make(map[int]int64),
+		committed: make(map[int]int64),
+	}
+}
+
+// add records msg as read and pending, returning its message ID
+func (t *offsetTracker) add(msg kafka.Message, queuedEvent QueuedEvent, now time.Time) string {
+	id := kafkaMessageID(msg)
+	t.pending[id] = &pendingMessage{
+		partition:  msg.Partition,
+		offset:     msg.Offset,
+		message:    StreamMessage{ID: id, QueuedEvent: queuedEvent},
+		readAt:     now,
+		deliveries: 1,
+	}
+	t.skip(msg)
+	return id
+}
+
+// skip records msg as read without keeping it pending. A partition's messages are
+// read in offset order, so an offset below the last one read means the partition
+// was assigned again and is read from its committed offset, which msg is at.
+func (t *offsetTracker) skip(msg kafka.Message) {
+	if msg.Offset < t.read[msg.Partition] {
+		t.committed[msg.Partition] = msg.Offset
+	}
+	t.read[msg.Partition] = msg.Offset + 1
+}
+
+// ack drops the pending messages ids and returns, for each partition whose position
+// moved past its last commit, the offset to commit. Unknown IDs are ignored.
+func (t *offsetTracker) ack(ids []string) map[int]int64 {
+	touched := make(map[int]bool)
+	for _, id := range ids {
+		if msg, ok := t.pending[id]; ok {
+			delete(t.pending, id)
+			touched[msg.partition] = true
+		}
+	}
+
+	commits := make(map[int]int64)
+	for partition := range touched {
+		next := t.read[partition]
+		for _, msg := range t.pending {
+			if msg.partition == partition && msg.offset < next {
+				next = msg.offset
+			}
+		}
+		if committed, ok := t.committed[partition]; !ok || next > committed {
+			commits[partition] = next
+		}
+	}
+	return commits
+}
+
+// committedTo records that partition was committed up to next
+func (t *offsetTracker) committedTo(partition int, next int64) {
+	if next > t.committed[partition] {
+		t.committed[partition] = next
+	}
+}
+
+// claimStale returns up to count pending messages read before now-minIdle with their
+// delivery counts, as delivered again now, and whether more are left
+func (t *offsetTracker) claimStale(now time.Time, minIdle time.Duration, count int) ([]StreamMessage, bool) {
+	var claimed []StreamMessage
+	for _, msg := range t.pending {
+		if now.Sub(msg.readAt) < minIdle {
+			continue
+		}
+		if len(claimed) == count {
+			return claimed, true
+		}
+		msg.readAt = now
+		msg.deliveries++
+		message := msg.message
+		message.DeliveryCount = msg.deliveries
+		claimed = append(claimed, message)
+	}
+	return claimed, false
+}
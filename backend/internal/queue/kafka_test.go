@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestOffsetTrackerCommitsAcknowledgedPrefix(t *testing.T) {
+	tracker := newOffsetTracker()
+	now := time.Now()
+	var ids []string
+	for offset := int64(0); offset < 3; offset++ {
+		ids = append(ids, tracker.add(kafka.Message{Partition: 2, Offset: offset}, QueuedEvent{}, now))
+	}
+
+	// Acknowledging out of order must not commit past the message still pending
+	if commits := tracker.ack([]string{ids[1]}); commits[2] != 0 {
+		t.Errorf("ack(%s) commits = %v, want partition 2 at 0", ids[1], commits)
+	}
+	tracker.committedTo(2, 0)
+	if commits := tracker.ack([]string{ids[1]}); len(commits) != 0 {
+		t.Errorf("second ack(%s) commits = %v, want none", ids[1], commits)
+	}
+	if commits := tracker.ack([]string{ids[0]}); commits[2] != 2 {
+		t.Errorf("ack(%s) commits = %v, want partition 2 at 2", ids[0], commits)
+	}
+	tracker.committedTo(2, 2)
+	if commits := tracker.ack([]string{ids[2]}); commits[2] != 3 {
+		t.Errorf("ack(%s) commits = %v, want partition 2 at 3", ids[2], commits)
+	}
+}
+
+func TestOffsetTrackerSkipsMalformedMessages(t *testing.T) {
+	tracker := newOffsetTracker()
+	tracker.skip(kafka.Message{Partition: 0, Offset: 0})
+	id := tracker.add(kafka.Message{Partition: 0, Offset: 1}, QueuedEvent{}, time.Now())
+
+	if commits := tracker.ack([]string{id}); commits[0] != 2 {
+		t.Errorf("ack commits = %v, want partition 0 at 2", commits)
+	}
+}
+
+func TestOffsetTrackerFollowsReassignedPartition(t *testing.T) {
+	tracker := newOffsetTracker()
+	now := time.Now()
+	for offset := int64(0); offset < 5; offset++ {
+		tracker.add(kafka.Message{Partition: 0, Offset: offset}, QueuedEvent{}, now)
+	}
+	tracker.committedTo(0, 5)
+
+	// The partition came back and is read again from offset 3, as committed elsewhere
+	id := tracker.add(kafka.Message{Partition: 0, Offset: 3}, QueuedEvent{}, now)
+	for _, stale := range []string{"0-0", "0-1", "0-2", "0-4"} {
+		tracker.ack([]string{stale})
+	}
+	if commits := tracker.ack([]string{id}); commits[0] != 4 {
+		t.Errorf("ack(%s) commits = %v, want partition 0 at 4", id, commits)
+	}
+}
+
+func TestOffsetTrackerClaimStale(t *testing.T) {
+	tracker := newOffsetTracker()
+	start := time.Now()
+	tracker.add(kafka.Message{Partition: 0, Offset: 0}, QueuedEvent{SessionID: "a"}, start)
+	tracker.add(kafka.Message{Partition: 1, Offset: 0}, QueuedEvent{SessionID: "b"}, start.Add(time.Minute))
+
+	claimed, more := tracker.claimStale(start.Add(90*time.Second), time.Minute, 10)
+	if len(claimed) != 1 || more {
+		t.Fatalf("claimStale = %+v, %v; want the one idle message", claimed, more)
+	}
+	if claimed[0].ID != "0-0" || claimed[0].QueuedEvent.SessionID != "a" || claimed[0].DeliveryCount != 2 {
+		t.Errorf("claimed %+v, want 0-0 of session a delivered twice", claimed[0])
+	}
+
+	// A claim resets the idle time
+	claimed, _ = tracker.claimStale(start.Add(100*time.Second), time.Minute, 10)
+	if len(claimed) != 0 {
+		t.Errorf("claimStale right after a claim = %+v, want none", claimed)
+	}
+
+	claimed, more = tracker.claimStale(start.Add(10*time.Minute), time.Minute, 1)
+	if len(claimed) != 1 || !more {
+		t.Errorf("claimStale with count 1 = %+v, %v; want one message and more left", claimed, more)
+	}
+}
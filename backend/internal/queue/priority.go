@@ -0,0 +1,74 @@
+package queue
+
+import (
+	"strings"
+
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// priorityStreamSuffix names the priority lane's stream after the queue's, e.g.
+// events:stream:priority
+const priorityStreamSuffix = ":priority"
+
+// newPriorityLane returns the single-stream queue of eq's priority lane, or nil when
+// types names no event type
+func newPriorityLane(eq *EventQueue, types []string) *EventQueue {
+	priorityTypes := make(map[models.EventType]bool)
+	for _, t := range types {
+		if t = strings.TrimSpace(t); t != "" {
+			priorityTypes[models.EventType(t)] = true
+		}
+	}
+	if len(priorityTypes) == 0 {
+		return nil
+	}
+
+	lane := *eq
+	lane.streamKey = eq.streamKey + priorityStreamSuffix
+	lane.shards = nil
+	eq.priorityTypes = priorityTypes
+	return &lane
+}
+
+// Priority returns the queue of the priority lane, or nil when priority types are not
+// configured
+func (eq *EventQueue) Priority() Queue {
+	if eq.priority == nil {
+		return nil
+	}
+	return eq.priority
+}
+
+// PriorityTypes lists the event types routed to the priority lane, for logs
+func (eq *EventQueue) PriorityTypes() []string {
+	types := make([]string, 0, len(eq.priorityTypes))
+	for t := range eq.priorityTypes {
+		types = append(types, string(t))
+	}
+	return types
+}
+
+// splitPriority separates the events of priority types from the others, keeping
+// their order within each
+func (eq *EventQueue) splitPriority(events []models.EventData) (urgent, rest []models.EventData) {
+	if eq.priority == nil {
+		return nil, events
+	}
+	for _, event := range events {
+		if eq.priorityTypes[event.EventType] {
+			urgent = append(urgent, event)
+		} else {
+			rest = append(rest, event)
+		}
+	}
+	return urgent, rest
+}
+
+// lanes returns the queues of every stream behind eq: its shards, or eq itself, and
+// the priority lane
+func (eq *EventQueue) lanes() []*EventQueue {
+	if eq.priority == nil {
+		return eq.streams()
+	}
+	return append(append([]*EventQueue{}, eq.streams()...), eq.priority)
+}
@@ -0,0 +1,93 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// Queue backends selectable with QUEUE_BACKEND
+const (
+	BackendRedis = "redis"
+	BackendKafka = "kafka"
+)
+
+// Queue carries tracked events from ingest to the event processor. Messages are read
+// by named consumers of one consumer group and stay pending until acknowledged or
+// dead-lettered. EventQueue implements it on Redis Streams, KafkaQueue on a Kafka
+// topic.
+type Queue interface {
+	// Enqueue adds a session's events, tagged with the request ID and ingest stats
+	// project carried by ctx
+	Enqueue(ctx context.Context, sessionID uuid.UUID, events []models.EventData) error
+	// CreateConsumerGroup prepares the consumer group; it is called once at startup
+	CreateConsumerGroup(ctx context.Context) error
+	// ReadEvents returns up to count messages not yet delivered to the group, blocking
+	// for up to block when there are none
+	ReadEvents(ctx context.Context, consumerName string, count int64, block time.Duration) ([]StreamMessage, error)
+	// Acknowledge marks messages as processed
+	Acknowledge(ctx context.Context, messageIDs ...string) error
+	// DeadLetter sets messages aside with reason and acknowledges them
+	DeadLetter(ctx context.Context, messages []StreamMessage, reason error) error
+	// GetBacklog returns the messages the group has yet to finish, read or not
+	GetBacklog(ctx context.Context) (int64, error)
+	// GetQueueDepth returns the number of messages kept, processed or not
+	GetQueueDepth(ctx context.Context) (int64, error)
+
+	StreamKey() string
+	ConsumerGroup() string
+	DeadLetterKey() string
+}
+
+// StaleClaimer is implemented by queues whose unacknowledged messages stay with the
+// consumer that read them until another one claims them, like Redis Streams. The
+// processor's reclaimer only runs on such queues.
+type StaleClaimer interface {
+	ClaimStale(ctx context.Context, consumerName string, minIdle time.Duration, start string, count int64) ([]StreamMessage, string, error)
+}
+
+// ConsumerPending is implemented by queues that can count the messages read by given
+// consumers and not yet acknowledged, so an instance can tell its own unfinished work
+// from the group's
+type ConsumerPending interface {
+	GetConsumerPending(ctx context.Context, consumerNames []string) (int64, error)
+}
+
+// ShardedQueue is implemented by queues spread over several streams. Each shard is
+// read, acknowledged and dead-lettered on its own; the processor balances its workers
+// across them.
+type ShardedQueue interface {
+	Shards() []Queue
+}
+
+// PriorityQueue is implemented by queues with a priority lane: a stream of its own for
+// urgent events, which workers read before their regular stream. Priority returns nil
+// when the lane is not configured.
+type PriorityQueue interface {
+	Priority() Queue
+}
+
+var (
+	_ Queue           = (*EventQueue)(nil)
+	_ StaleClaimer    = (*EventQueue)(nil)
+	_ ShardedQueue    = (*EventQueue)(nil)
+	_ PriorityQueue   = (*EventQueue)(nil)
+	_ ConsumerPending = (*EventQueue)(nil)
+
+	_ Queue           = (*KafkaQueue)(nil)
+	_ StaleClaimer    = (*KafkaQueue)(nil)
+	_ ConsumerPending = (*KafkaQueue)(nil)
+)
+
+// CheckBackend returns an error unless backend names a known queue backend
+func CheckBackend(backend string) error {
+	switch backend {
+	case BackendRedis, BackendKafka:
+		return nil
+	default:
+		return fmt.Errorf("unknown queue backend %q; use %q or %q", backend, BackendRedis, BackendKafka)
+	}
+}
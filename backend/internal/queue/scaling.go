@@ -0,0 +1,164 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ScalingMetrics describes the event stream backlog for autoscalers. Backlog is the
+// number of messages the consumer group has yet to finish (Lag + Pending); ages are
+// measured from the time a message was added to the stream. For a sharded queue the
+// counts are summed and the ages are the oldest over all shards. The priority lane is
+// counted like a shard; PriorityBacklog is its share of Backlog.
+type ScalingMetrics struct {
+	Stream                  string           `json:"stream"`
+	ConsumerGroup           string           `json:"consumer_group"`
+	Shards                  int              `json:"shards"`
+	QueueDepth              int64            `json:"queue_depth"`
+	Lag                     int64            `json:"lag"`
+	Pending                 int64            `json:"pending"`
+	Backlog                 int64            `json:"backlog"`
+	Consumers               int              `json:"consumers"`
+	ActiveConsumers         int              `json:"active_consumers"`
+	PendingPerConsumer      map[string]int64 `json:"pending_per_consumer"`
+	BacklogPerConsumer      float64          `json:"backlog_per_consumer"`
+	OldestPendingAgeSeconds float64          `json:"oldest_pending_age_seconds"`
+	OldestUnreadAgeSeconds  float64          `json:"oldest_unread_age_seconds"`
+	PriorityBacklog         *int64           `json:"priority_backlog,omitempty"`
+}
+
+// GetScalingMetrics collects backlog metrics for the queue's consumer group. Consumers
+// idle for longer than activeWithin are not counted as active.
+func (eq *EventQueue) GetScalingMetrics(ctx context.Context, activeWithin time.Duration) (*ScalingMetrics, error) {
+	if eq.shards == nil && eq.priority == nil {
+		return eq.streamScalingMetrics(ctx, activeWithin)
+	}
+
+	metrics := &ScalingMetrics{
+		Stream:             eq.streamKey,
+		ConsumerGroup:      eq.consumerGroup,
+		Shards:             len(eq.streams()),
+		PendingPerConsumer: make(map[string]int64),
+	}
+	for _, shard := range eq.lanes() {
+		m, err := shard.streamScalingMetrics(ctx, activeWithin)
+		if err != nil {
+			return nil, fmt.Errorf("stream %s: %w", shard.streamKey, err)
+		}
+		if shard == eq.priority {
+			metrics.PriorityBacklog = &m.Backlog
+		}
+		metrics.QueueDepth += m.QueueDepth
+		metrics.Lag += m.Lag
+		metrics.Pending += m.Pending
+		metrics.Backlog += m.Backlog
+		// Every consumer reads a single shard, so consumers do not overlap. Workers read
+		// the priority lane besides their shard and are already counted.
+		if shard != eq.priority {
+			metrics.Consumers += m.Consumers
+			metrics.ActiveConsumers += m.ActiveConsumers
+		}
+		for name, pending := range m.PendingPerConsumer {
+			metrics.PendingPerConsumer[name] += pending
+		}
+		metrics.OldestPendingAgeSeconds = max(metrics.OldestPendingAgeSeconds, m.OldestPendingAgeSeconds)
+		metrics.OldestUnreadAgeSeconds = max(metrics.OldestUnreadAgeSeconds, m.OldestUnreadAgeSeconds)
+	}
+	if metrics.ActiveConsumers > 0 {
+		metrics.BacklogPerConsumer = float64(metrics.Backlog) / float64(metrics.ActiveConsumers)
+	} else {
+		metrics.BacklogPerConsumer = float64(metrics.Backlog)
+	}
+	return metrics, nil
+}
+
+// streamScalingMetrics collects backlog metrics for a single stream
+func (eq *EventQueue) streamScalingMetrics(ctx context.Context, activeWithin time.Duration) (*ScalingMetrics, error) {
+	now := time.Now()
+	metrics := &ScalingMetrics{
+		Stream:             eq.streamKey,
+		ConsumerGroup:      eq.consumerGroup,
+		Shards:             1,
+		PendingPerConsumer: make(map[string]int64),
+	}
+
+	depth, err := eq.streamDepth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics.QueueDepth = depth
+
+	groups, err := eq.redis.XInfoGroups(ctx, eq.streamKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consumer group info: %w", err)
+	}
+	var lastDelivered string
+	for _, group := range groups {
+		if group.Name != eq.consumerGroup {
+			continue
+		}
+		metrics.Lag = max(group.Lag, 0)
+		metrics.Pending = group.Pending
+		lastDelivered = group.LastDeliveredID
+	}
+	metrics.Backlog = metrics.Lag + metrics.Pending
+
+	consumers, err := eq.redis.XInfoConsumers(ctx, eq.streamKey, eq.consumerGroup).Result()
+	if err != nil && err != redis.Nil && !strings.HasPrefix(err.Error(), "NOGROUP") {
+		return nil, fmt.Errorf("failed to get consumer info: %w", err)
+	}
+	metrics.Consumers = len(consumers)
+	for _, consumer := range consumers {
+		metrics.PendingPerConsumer[consumer.Name] = consumer.Pending
+		if consumer.Idle <= activeWithin {
+			metrics.ActiveConsumers++
+		}
+	}
+	if metrics.ActiveConsumers > 0 {
+		metrics.BacklogPerConsumer = float64(metrics.Backlog) / float64(metrics.ActiveConsumers)
+	} else {
+		metrics.BacklogPerConsumer = float64(metrics.Backlog)
+	}
+
+	if metrics.Pending > 0 {
+		pending, err := eq.redis.XPending(ctx, eq.streamKey, eq.consumerGroup).Result()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("failed to get pending summary: %w", err)
+		}
+		if pending != nil {
+			metrics.OldestPendingAgeSeconds = messageAge(pending.Lower, now)
+		}
+	}
+
+	if metrics.Lag > 0 && lastDelivered != "" {
+		// The oldest unread message is the first one after the group's last delivered ID
+		next, err := eq.redis.XRangeN(ctx, eq.streamKey, "("+lastDelivered, "+", 1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read oldest unread message: %w", err)
+		}
+		if len(next) > 0 {
+			metrics.OldestUnreadAgeSeconds = messageAge(next[0].ID, now)
+		}
+	}
+
+	return metrics, nil
+}
+
+// messageAge returns the seconds since the stream entry ID's millisecond timestamp
+func messageAge(id string, now time.Time) float64 {
+	msPart, _, _ := strings.Cut(id, "-")
+	ms, err := strconv.ParseInt(msPart, 10, 64)
+	if err != nil || ms <= 0 {
+		return 0
+	}
+	age := now.Sub(time.UnixMilli(ms)).Seconds()
+	if age < 0 {
+		return 0
+	}
+	return age
+}
@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/requestid"
+	"github.com/ngocp/user-tracker/internal/stats"
+)
+
+// Shadow forwards a sample of persisted batches to the candidate write path and
+// compares its output with the primary rows, to validate processor changes before
+// rollout. Sampling is by session so a sampled session is shadowed in full.
+// A nil *Shadow disables shadowing.
+type Shadow struct {
+	repo    *repository.ShadowRepository
+	stats   *stats.IngestCounters
+	percent int
+}
+
+// NewShadow creates a shadow runner for percent (0-100) of sessions. It returns nil
+// when percent is not positive.
+func NewShadow(repo *repository.ShadowRepository, ingestStats *stats.IngestCounters, percent int) *Shadow {
+	if percent <= 0 {
+		return nil
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	return &Shadow{
+		repo:    repo,
+		stats:   ingestStats,
+		percent: percent,
+	}
+}
+
+// Sampled reports whether sessionID falls in the shadowed percentage
+func (s *Shadow) Sampled(sessionID uuid.UUID) bool {
+	if s == nil {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write(sessionID[:])
+	return int(h.Sum32()%100) < s.percent
+}
+
+// Run writes events through the shadow path and compares the result with the rows
+// the primary path inserted for streamIDs. Matching shadow rows are removed;
+// mismatches are logged and kept. Shadow failures never affect the primary path.
+func (s *Shadow) Run(ctx context.Context, sessionID uuid.UUID, streamIDs []string, events []models.EventData) {
+	if err := s.repo.CopyBatch(ctx, sessionID, events); err != nil {
+		log.Printf("[Shadow] Write failed for session %s (request %s): %v", sessionID, requestOrNone(requestid.FromContext(ctx)), err)
+		s.stats.Add(ctx, stats.DefaultProject, stats.StageShadowFailed, len(events))
+		return
+	}
+
+	primary, shadow, err := s.repo.Compare(ctx, sessionID, streamIDs)
+	if err != nil {
+		log.Printf("[Shadow] Compare failed for session %s (request %s): %v", sessionID, requestOrNone(requestid.FromContext(ctx)), err)
+		s.stats.Add(ctx, stats.DefaultProject, stats.StageShadowFailed, len(events))
+		return
+	}
+
+	if !digestsEqual(primary, shadow) {
+		log.Printf("[Shadow] MISMATCH for session %s (request %s), messages %v: primary %+v, shadow %+v",
+			sessionID, requestOrNone(requestid.FromContext(ctx)), streamIDs, *primary, *shadow)
+		s.stats.Add(ctx, stats.DefaultProject, stats.StageShadowMismatched, len(events))
+		return
+	}
+
+	s.stats.Add(ctx, stats.DefaultProject, stats.StageShadowMatched, len(events))
+	if err := s.repo.DeleteBatch(ctx, sessionID, streamIDs); err != nil {
+		log.Printf("[Shadow] Cleanup failed for session %s (request %s): %v", sessionID, requestOrNone(requestid.FromContext(ctx)), err)
+	}
+}
+
+func digestsEqual(a, b *repository.EventDigest) bool {
+	if a.Rows != b.Rows || a.EventTypes != b.EventTypes || a.Clicks != b.Clicks || a.Checksum != b.Checksum {
+		return false
+	}
+	if a.LastActivity == nil || b.LastActivity == nil {
+		return a.LastActivity == b.LastActivity
+	}
+	return a.LastActivity.Equal(*b.LastActivity)
+}
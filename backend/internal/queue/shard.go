@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+)
+
+// sessionShards routes each session's batches to one writer goroutine chosen by a hash
+// of the session ID. Workers still read from the stream concurrently, but a hot
+// session's writes are serialized on its shard instead of contending for the
+// session's rows across workers.
+type sessionShards struct {
+	channels []chan *sessionJob
+	wg       sync.WaitGroup
+}
+
+// sessionJob is one session's messages from a worker's read batch. The shard runs it
+// on behalf of worker, which waits for done before acknowledging.
+type sessionJob struct {
+	worker    *Worker
+	sessionID string
+	messages  []StreamMessage
+	processed []string
+	done      *sync.WaitGroup
+}
+
+// newSessionShards creates count shards; it returns nil when count is not positive
+func newSessionShards(count int) *sessionShards {
+	if count <= 0 {
+		return nil
+	}
+	shards := &sessionShards{channels: make([]chan *sessionJob, count)}
+	for i := range shards.channels {
+		shards.channels[i] = make(chan *sessionJob, 16)
+	}
+	return shards
+}
+
+// start launches one writer goroutine per shard
+func (s *sessionShards) start(ctx context.Context) {
+	if s == nil {
+		return
+	}
+	for _, jobs := range s.channels {
+		s.wg.Add(1)
+		go func(jobs chan *sessionJob) {
+			defer s.wg.Done()
+			for job := range jobs {
+				job.processed = job.worker.processSession(ctx, job.sessionID, job.messages)
+				job.done.Done()
+			}
+		}(jobs)
+	}
+}
+
+// dispatch queues job on its session's shard
+func (s *sessionShards) dispatch(job *sessionJob) {
+	s.channels[shardIndex(job.sessionID, len(s.channels))] <- job
+}
+
+// shardIndex picks one of count shards for sessionID. Writer goroutines and stream
+// shards both use it, so a session always lands on the same one.
+func shardIndex(sessionID string, count int) int {
+	h := fnv.New32a()
+	h.Write([]byte(sessionID))
+	return int(h.Sum32() % uint32(count))
+}
+
+// stop closes the shards once no worker dispatches any more and waits for the jobs
+// already queued
+func (s *sessionShards) stop() {
+	if s == nil {
+		return
+	}
+	for _, jobs := range s.channels {
+		close(jobs)
+	}
+	s.wg.Wait()
+}
@@ -0,0 +1,185 @@
+// Package redact applies the masking rules used for privacy previews: what a viewer
+// without access to personal data would see of a recording.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// Mask replaces redacted text
+const Mask = "***"
+
+// PixelBlock is the edge length of the squares screenshots are pixelated into
+const PixelBlock = 16
+
+var (
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	numberPattern = regexp.MustCompile(`\d[\d\s().-]{5,}\d`)
+)
+
+// Text masks email addresses and long digit runs (phone, card and account numbers)
+func Text(s string) string {
+	s = emailPattern.ReplaceAllString(s, Mask)
+	return numberPattern.ReplaceAllString(s, Mask)
+}
+
+// URL drops the query string and fragment, which often carry tokens and emails
+func URL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return Mask
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.User = nil
+	return u.String()
+}
+
+// Event masks an event in place: input values and keys are removed, free text in the
+// target element and event data is scrubbed and the page URL is stripped
+func Event(e *models.Event) {
+	if e.InputValue != nil {
+		e.InputValue = nil
+		e.InputMasked = true
+	}
+	e.KeyPressed = nil
+	e.PageURL = URL(e.PageURL)
+	if e.TargetElement != nil {
+		text := Text(*e.TargetElement)
+		e.TargetElement = &text
+	}
+	e.EventData = data(e.EventData)
+}
+
+// Events masks every event in place
+func Events(events []*models.Event) {
+	for _, e := range events {
+		Event(e)
+	}
+}
+
+// data scrubs string values of event data, recursing into nested objects
+func data(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		switch v := v.(type) {
+		case string:
+			out[k] = Text(v)
+		case map[string]interface{}:
+			out[k] = data(v)
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// sensitiveKeys are JSON keys whose values Body removes entirely
+var sensitiveKeys = map[string]bool{
+	"input_value":   true,
+	"key_pressed":   true,
+	"password":      true,
+	"token":         true,
+	"access_token":  true,
+	"authorization": true,
+	"cookie":        true,
+	"secret":        true,
+	"email":         true,
+	"phone":         true,
+	"image_data":    true,
+	"data_url":      true,
+}
+
+// Body masks a JSON request body for logging: values of sensitive keys such as
+// input_value and password are replaced with Mask, URLs are stripped like URL and other
+// strings are scrubbed like Text. Bodies that are not valid JSON are returned as an error.
+func Body(body []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, fmt.Errorf("failed to parse body: %w", err)
+	}
+	return json.Marshal(value("", v))
+}
+
+func value(key string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = value(k, child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = value(key, child)
+		}
+		return v
+	case string:
+		lower := strings.ToLower(key)
+		switch {
+		case sensitiveKeys[lower]:
+			return Mask
+		case lower == "url" || strings.HasSuffix(lower, "_url"):
+			return URL(v)
+		}
+		return Text(v)
+	case nil:
+		return nil
+	default:
+		if sensitiveKeys[strings.ToLower(key)] {
+			return Mask
+		}
+		return v
+	}
+}
+
+// Screenshot pixelates an image into PixelBlock squares so layout stays visible but
+// text and faces do not, and returns it as PNG
+func Screenshot(imageData []byte) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode screenshot: %w", err)
+	}
+
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for by := 0; by < bounds.Dy(); by += PixelBlock {
+		for bx := 0; bx < bounds.Dx(); bx += PixelBlock {
+			block := image.Rect(bx, by, min(bx+PixelBlock, bounds.Dx()), min(by+PixelBlock, bounds.Dy()))
+
+			var r, g, b, a, n uint64
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					cr, cg, cb, ca := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			avg := color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)}
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				for x := block.Min.X; x < block.Max.X; x++ {
+					dst.Set(x, y, avg)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, fmt.Errorf("failed to encode screenshot: %w", err)
+	}
+	return buf.Bytes(), nil
+}
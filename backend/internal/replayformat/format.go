@@ -0,0 +1,386 @@
+// Package replayformat encodes session events in the compact binary replay format
+// served for Accept: application/x-tracker-replay.
+//
+// All integers are varints as in encoding/binary: "uvarint" is unsigned, "svarint"
+// is zigzag-signed. A stream is
+//
+//	magic      "TRPL"
+//	version    1 byte (1)
+//	session    16 bytes, the session UUID
+//	count      uvarint, number of events
+//	events     count records
+//
+// Each record is
+//
+//	mask       uvarint, which optional fields follow (bit n = field n below)
+//	timestamp  svarint, microseconds since the previous event (the first: since the Unix epoch)
+//	event_id   svarint, difference to the previous event_id (the first: the id)
+//	event_type ref
+//	page_url   ref
+//	optional fields present in mask, in bit order:
+//	  0 target_element ref    8 screen_y   svarint   16 mouse_button uvarint
+//	  1 target_selector ref   9 scroll_x   svarint   17 click_count  uvarint
+//	  2 target_tag ref       10 scroll_y   svarint   18 event_data   string (JSON)
+//	  3 target_id ref        11 norm_x     uvarint   19 sdk          ref
+//	  4 target_class ref     12 norm_y     uvarint   20 tab_id       ref
+//	  5 viewport_x svarint   13 input_value string   21 frame_path   ref
+//	  6 viewport_y svarint   14 input_masked (no value: the bit is the flag)
+//	  7 screen_x svarint     15 key_pressed ref
+//
+// Coordinates are in hundredths of a pixel and normalized coordinates in millionths.
+// A string is a uvarint byte length followed by UTF-8 bytes. A ref deduplicates
+// repeated strings: uvarint 0 is followed by a string, which is appended to the
+// stream's string table; n > 0 refers to table entry n-1.
+package replayformat
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// ContentType is the media type of the format
+const ContentType = "application/x-tracker-replay"
+
+// Version is the format version written by Encode
+const Version = 1
+
+const magic = "TRPL"
+
+// Fixed-point scales of coordinates
+const (
+	coordinateScale = 100
+	normalizedScale = 1_000_000
+)
+
+// Optional field bits of a record's mask
+const (
+	bitTargetElement = iota
+	bitTargetSelector
+	bitTargetTag
+	bitTargetID
+	bitTargetClass
+	bitViewportX
+	bitViewportY
+	bitScreenX
+	bitScreenY
+	bitScrollX
+	bitScrollY
+	bitNormX
+	bitNormY
+	bitInputValue
+	bitInputMasked
+	bitKeyPressed
+	bitMouseButton
+	bitClickCount
+	bitEventData
+	bitSDK
+	bitTabID
+	bitFramePath
+)
+
+// ErrInvalid is returned by Decode for streams that are not in the replay format
+var ErrInvalid = errors.New("invalid replay stream")
+
+type encoder struct {
+	w       *bufio.Writer
+	buf     [binary.MaxVarintLen64]byte
+	strings map[string]uint64
+}
+
+// Encode writes the events of sessionID to w
+func Encode(w io.Writer, sessionID uuid.UUID, events []*models.Event) error {
+	e := &encoder{w: bufio.NewWriter(w), strings: make(map[string]uint64)}
+
+	e.w.WriteString(magic)
+	e.w.WriteByte(Version)
+	e.w.Write(sessionID[:])
+	e.uvarint(uint64(len(events)))
+
+	var lastTime, lastID int64
+	for _, ev := range events {
+		var mask uint64
+		set := func(bit int, present bool) {
+			if present {
+				mask |= 1 << bit
+			}
+		}
+		set(bitTargetElement, ev.TargetElement != nil)
+		set(bitTargetSelector, ev.TargetSelector != nil)
+		set(bitTargetTag, ev.TargetTag != nil)
+		set(bitTargetID, ev.TargetID != nil)
+		set(bitTargetClass, ev.TargetClass != nil)
+		set(bitViewportX, ev.ViewportX != nil)
+		set(bitViewportY, ev.ViewportY != nil)
+		set(bitScreenX, ev.ScreenX != nil)
+		set(bitScreenY, ev.ScreenY != nil)
+		set(bitScrollX, ev.ScrollX != nil)
+		set(bitScrollY, ev.ScrollY != nil)
+		set(bitNormX, ev.NormX != nil)
+		set(bitNormY, ev.NormY != nil)
+		set(bitInputValue, ev.InputValue != nil)
+		set(bitInputMasked, ev.InputMasked)
+		set(bitKeyPressed, ev.KeyPressed != nil)
+		set(bitMouseButton, ev.MouseButton != nil)
+		set(bitClickCount, ev.ClickCount != nil)
+		set(bitEventData, len(ev.EventData) > 0)
+		set(bitSDK, ev.SDK != nil)
+		set(bitTabID, ev.TabID != nil)
+		set(bitFramePath, ev.FramePath != nil)
+
+		micros := ev.Timestamp.UnixMicro()
+		e.uvarint(mask)
+		e.svarint(micros - lastTime)
+		e.svarint(ev.EventID - lastID)
+		lastTime, lastID = micros, ev.EventID
+
+		e.ref(string(ev.EventType))
+		e.ref(ev.PageURL)
+		e.optRef(ev.TargetElement)
+		e.optRef(ev.TargetSelector)
+		e.optRef(ev.TargetTag)
+		e.optRef(ev.TargetID)
+		e.optRef(ev.TargetClass)
+		for _, c := range []*float64{ev.ViewportX, ev.ViewportY, ev.ScreenX, ev.ScreenY, ev.ScrollX, ev.ScrollY} {
+			if c != nil {
+				e.svarint(int64(math.Round(*c * coordinateScale)))
+			}
+		}
+		for _, n := range []*float64{ev.NormX, ev.NormY} {
+			if n != nil {
+				e.uvarint(uint64(math.Round(math.Max(*n, 0) * normalizedScale)))
+			}
+		}
+		if ev.InputValue != nil {
+			e.string(*ev.InputValue)
+		}
+		e.optRef(ev.KeyPressed)
+		for _, n := range []*int{ev.MouseButton, ev.ClickCount} {
+			if n != nil {
+				e.uvarint(uint64(max(*n, 0)))
+			}
+		}
+		if len(ev.EventData) > 0 {
+			data, err := json.Marshal(ev.EventData)
+			if err != nil {
+				return fmt.Errorf("failed to encode event data: %w", err)
+			}
+			e.string(string(data))
+		}
+		e.optRef(ev.SDK)
+		e.optRef(ev.TabID)
+		e.optRef(ev.FramePath)
+	}
+
+	return e.w.Flush()
+}
+
+func (e *encoder) uvarint(v uint64) {
+	n := binary.PutUvarint(e.buf[:], v)
+	e.w.Write(e.buf[:n])
+}
+
+func (e *encoder) svarint(v int64) {
+	n := binary.PutVarint(e.buf[:], v)
+	e.w.Write(e.buf[:n])
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.w.WriteString(s)
+}
+
+func (e *encoder) ref(s string) {
+	if index, ok := e.strings[s]; ok {
+		e.uvarint(index + 1)
+		return
+	}
+	e.strings[s] = uint64(len(e.strings))
+	e.uvarint(0)
+	e.string(s)
+}
+
+func (e *encoder) optRef(s *string) {
+	if s != nil {
+		e.ref(*s)
+	}
+}
+
+type decoder struct {
+	r       *bufio.Reader
+	strings []string
+	err     error
+}
+
+// Decode reads a stream written by Encode. Coordinates come back rounded to the
+// format's precision; the session ID is set on every event.
+func Decode(r io.Reader) (uuid.UUID, []*models.Event, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+
+	var header [len(magic) + 1 + 16]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil || string(header[:len(magic)]) != magic {
+		return uuid.Nil, nil, ErrInvalid
+	}
+	if header[len(magic)] != Version {
+		return uuid.Nil, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalid, header[len(magic)])
+	}
+	sessionID, _ := uuid.FromBytes(header[len(magic)+1:])
+
+	count := d.uvarint()
+	if d.err != nil {
+		return uuid.Nil, nil, d.err
+	}
+
+	var events []*models.Event
+	var lastTime, lastID int64
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		ev := &models.Event{SessionID: sessionID}
+		mask := d.uvarint()
+		has := func(bit int) bool { return mask&(1<<bit) != 0 }
+
+		lastTime += d.svarint()
+		lastID += d.svarint()
+		ev.Timestamp = time.UnixMicro(lastTime).UTC()
+		ev.EventID = lastID
+
+		ev.EventType = models.EventType(d.ref())
+		ev.PageURL = d.ref()
+		ev.TargetElement = d.optRef(has(bitTargetElement))
+		ev.TargetSelector = d.optRef(has(bitTargetSelector))
+		ev.TargetTag = d.optRef(has(bitTargetTag))
+		ev.TargetID = d.optRef(has(bitTargetID))
+		ev.TargetClass = d.optRef(has(bitTargetClass))
+		ev.ViewportX = d.optCoordinate(has(bitViewportX))
+		ev.ViewportY = d.optCoordinate(has(bitViewportY))
+		ev.ScreenX = d.optCoordinate(has(bitScreenX))
+		ev.ScreenY = d.optCoordinate(has(bitScreenY))
+		ev.ScrollX = d.optCoordinate(has(bitScrollX))
+		ev.ScrollY = d.optCoordinate(has(bitScrollY))
+		ev.NormX = d.optNormalized(has(bitNormX))
+		ev.NormY = d.optNormalized(has(bitNormY))
+		if has(bitInputValue) {
+			s := d.string()
+			ev.InputValue = &s
+		}
+		ev.InputMasked = has(bitInputMasked)
+		ev.KeyPressed = d.optRef(has(bitKeyPressed))
+		ev.MouseButton = d.optInt(has(bitMouseButton))
+		ev.ClickCount = d.optInt(has(bitClickCount))
+		if has(bitEventData) {
+			if err := json.Unmarshal([]byte(d.string()), &ev.EventData); err != nil && d.err == nil {
+				d.err = fmt.Errorf("%w: event data: %v", ErrInvalid, err)
+			}
+		}
+		ev.SDK = d.optRef(has(bitSDK))
+		ev.TabID = d.optRef(has(bitTabID))
+		ev.FramePath = d.optRef(has(bitFramePath))
+
+		events = append(events, ev)
+	}
+	if d.err != nil {
+		return uuid.Nil, nil, d.err
+	}
+
+	return sessionID, events, nil
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		d.err = fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.fail(err)
+	}
+	return v
+}
+
+func (d *decoder) svarint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.fail(err)
+	}
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		d.fail(err)
+		return ""
+	}
+	return string(buf)
+}
+
+func (d *decoder) ref() string {
+	index := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if index == 0 {
+		s := d.string()
+		d.strings = append(d.strings, s)
+		return s
+	}
+	if index > uint64(len(d.strings)) {
+		d.fail(fmt.Errorf("string ref %d out of range", index))
+		return ""
+	}
+	return d.strings[index-1]
+}
+
+func (d *decoder) optRef(present bool) *string {
+	if !present {
+		return nil
+	}
+	s := d.ref()
+	return &s
+}
+
+func (d *decoder) optCoordinate(present bool) *float64 {
+	if !present {
+		return nil
+	}
+	v := float64(d.svarint()) / coordinateScale
+	return &v
+}
+
+func (d *decoder) optNormalized(present bool) *float64 {
+	if !present {
+		return nil
+	}
+	v := float64(d.uvarint()) / normalizedScale
+	return &v
+}
+
+func (d *decoder) optInt(present bool) *int {
+	if !present {
+		return nil
+	}
+	v := int(d.uvarint())
+	return &v
+}
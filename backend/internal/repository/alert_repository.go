@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type AlertRepository struct {
+	db *Database
+}
+
+func NewAlertRepository(db *Database) *AlertRepository {
+	return &AlertRepository{db: db}
+}
+
+const alertRuleColumns = `rule_id, name, metric, comparator, threshold, window_seconds, goal_url,
+	notify_url, enabled, state, state_changed_at, last_value, last_evaluated_at, created_at, updated_at`
+
+func scanAlertRule(row pgx.Row) (*models.AlertRule, error) {
+	r := &models.AlertRule{}
+	err := row.Scan(&r.RuleID, &r.Name, &r.Metric, &r.Comparator, &r.Threshold, &r.WindowSeconds, &r.GoalURL,
+		&r.NotifyURL, &r.Enabled, &r.State, &r.StateChangedAt, &r.LastValue, &r.LastEvaluatedAt, &r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+// CreateRule adds an alert rule in the ok state
+func (r *AlertRepository) CreateRule(ctx context.Context, req *models.CreateAlertRuleRequest) (*models.AlertRule, error) {
+	rule, err := scanAlertRule(r.db.Pool.QueryRow(ctx,
+		`INSERT INTO alert_rules (name, metric, comparator, threshold, window_seconds, goal_url, notify_url)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+alertRuleColumns,
+		req.Name, req.Metric, req.Comparator, req.Threshold, req.WindowSeconds, req.GoalURL, req.NotifyURL,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create alert rule: %w", err)
+	}
+	return rule, nil
+}
+
+// ListRules returns all alert rules, firing ones first
+func (r *AlertRepository) ListRules(ctx context.Context) ([]*models.AlertRule, error) {
+	rows, err := r.db.Pool.Query(ctx, `SELECT `+alertRuleColumns+` FROM alert_rules
+		ORDER BY state = 'firing' DESC, created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alert rules: %w", err)
+	}
+	return collectAlertRules(rows)
+}
+
+func collectAlertRules(rows pgx.Rows) ([]*models.AlertRule, error) {
+	defer rows.Close()
+
+	rules := []*models.AlertRule{}
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan alert rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// GetRule returns an alert rule
+func (r *AlertRepository) GetRule(ctx context.Context, ruleID uuid.UUID) (*models.AlertRule, error) {
+	rule, err := scanAlertRule(r.db.Pool.QueryRow(ctx,
+		`SELECT `+alertRuleColumns+` FROM alert_rules WHERE rule_id = $1`, ruleID,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alert rule: %w", notFoundOr(err))
+	}
+	return rule, nil
+}
+
+// SetRuleEnabled pauses or resumes evaluating a rule. Pausing resets it to ok
+// without an alert event.
+func (r *AlertRepository) SetRuleEnabled(ctx context.Context, ruleID uuid.UUID, enabled bool) (*models.AlertRule, error) {
+	rule, err := scanAlertRule(r.db.Pool.QueryRow(ctx,
+		`UPDATE alert_rules SET enabled = $2, updated_at = NOW(),
+			state = CASE WHEN $2 THEN state ELSE 'ok' END
+		WHERE rule_id = $1
+		RETURNING `+alertRuleColumns,
+		ruleID, enabled,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update alert rule: %w", notFoundOr(err))
+	}
+	return rule, nil
+}
+
+// DeleteRule removes a rule and its history
+func (r *AlertRepository) DeleteRule(ctx context.Context, ruleID uuid.UUID) error {
+	tag, err := r.db.Pool.Exec(ctx, `DELETE FROM alert_rules WHERE rule_id = $1`, ruleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete alert rule: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete alert rule: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// ClaimDue returns the enabled rules not evaluated within interval and marks them
+// evaluated now, so with several instances each rule is evaluated by one of them
+func (r *AlertRepository) ClaimDue(ctx context.Context, interval time.Duration) ([]*models.AlertRule, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		UPDATE alert_rules SET last_evaluated_at = NOW()
+		WHERE rule_id IN (
+			SELECT rule_id FROM alert_rules
+			WHERE enabled
+				AND (last_evaluated_at IS NULL OR last_evaluated_at <= NOW() - $1 * INTERVAL '1 millisecond')
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+alertRuleColumns,
+		interval.Milliseconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim due alert rules: %w", err)
+	}
+	return collectAlertRules(rows)
+}
+
+// RecordEvaluation stores the value a rule was evaluated to. When state differs from
+// the rule's current state the change is recorded and returned as an alert event;
+// otherwise the returned event is nil.
+func (r *AlertRepository) RecordEvaluation(ctx context.Context, rule *models.AlertRule, value *float64, state string) (*models.AlertEvent, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Only the state the rule is known to be in may change, so a concurrent pause or
+	// evaluation is not overwritten
+	tag, err := tx.Exec(ctx, `
+		UPDATE alert_rules SET last_value = $2, state = $3,
+			state_changed_at = CASE WHEN state <> $3 THEN NOW() ELSE state_changed_at END
+		WHERE rule_id = $1 AND state = $4 AND enabled
+	`, rule.RuleID, value, state, rule.State)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record alert evaluation: %w", err)
+	}
+	if tag.RowsAffected() == 0 || state == rule.State {
+		return nil, tx.Commit(ctx)
+	}
+
+	event := &models.AlertEvent{RuleID: rule.RuleID, RuleName: rule.Name, State: state, Value: value, Threshold: rule.Threshold}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO alert_events (rule_id, state, value, threshold)
+		VALUES ($1, $2, $3, $4)
+		RETURNING event_id, created_at
+	`, rule.RuleID, state, value, rule.Threshold).Scan(&event.EventID, &event.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record alert event: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit alert evaluation: %w", err)
+	}
+	return event, nil
+}
+
+// RecordNotification stores the outcome of announcing an alert event
+func (r *AlertRepository) RecordNotification(ctx context.Context, eventID int64, notifyErr error) error {
+	var errStr *string
+	if notifyErr != nil {
+		s := notifyErr.Error()
+		errStr = &s
+	}
+
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE alert_events SET
+			notify_error = $2,
+			notified_at = CASE WHEN $2::text IS NULL THEN NOW() END
+		WHERE event_id = $1
+	`, eventID, errStr)
+	if err != nil {
+		return fmt.Errorf("failed to record alert notification: %w", err)
+	}
+	return nil
+}
+
+// ListEvents returns the latest state changes, newest first, optionally of one rule
+func (r *AlertRepository) ListEvents(ctx context.Context, ruleID *uuid.UUID, limit int) ([]*models.AlertEvent, error) {
+	f := newQueryFilter()
+	if ruleID != nil {
+		f.where("e.rule_id = ?", *ruleID)
+	}
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT e.event_id, e.rule_id, r.name, e.state, e.value, e.threshold, e.created_at,
+			e.notified_at, e.notify_error
+		FROM alert_events e
+		JOIN alert_rules r ON r.rule_id = e.rule_id
+		WHERE `+f.clause()+`
+		ORDER BY e.created_at DESC, e.event_id DESC
+		LIMIT `+f.param(limit), f.values()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alert events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*models.AlertEvent{}
+	for rows.Next() {
+		e := &models.AlertEvent{}
+		if err := rows.Scan(&e.EventID, &e.RuleID, &e.RuleName, &e.State, &e.Value, &e.Threshold, &e.CreatedAt,
+			&e.NotifiedAt, &e.NotifyError); err != nil {
+			return nil, fmt.Errorf("failed to scan alert event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// ErrorRate returns error events as a fraction of all events since since, or nil
+// without events. Like the other alert metrics it leaves out sandbox sessions.
+func (r *AlertRepository) ErrorRate(ctx context.Context, since time.Time) (*float64, error) {
+	var rate *float64
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE event_type = 'error')::float8 / NULLIF(COUNT(*), 0)
+		FROM events
+		WHERE timestamp >= $1 AND `+notSandboxEvent+`
+	`, since).Scan(&rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get error rate: %w", err)
+	}
+	return rate, nil
+}
+
+// SessionsStarted counts sessions started since since
+func (r *AlertRepository) SessionsStarted(ctx context.Context, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM sessions WHERE started_at >= $1 AND NOT sandbox`, since).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+	return count, nil
+}
+
+// GoalConversion returns the fraction of sessions started since since with an event
+// on goalURL (compared with the normalized URL), or nil without sessions
+func (r *AlertRepository) GoalConversion(ctx context.Context, since time.Time, goalURL string) (*float64, error) {
+	var rate *float64
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE EXISTS (
+			SELECT 1 FROM events e
+			WHERE e.session_id = s.session_id AND e.timestamp >= $1
+				AND COALESCE(e.normalized_url, e.page_url) = $2
+		))::float8 / NULLIF(COUNT(*), 0)
+		FROM sessions s
+		WHERE s.started_at >= $1 AND NOT s.sandbox
+	`, since, goalURL).Scan(&rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get goal conversion: %w", err)
+	}
+	return rate, nil
+}
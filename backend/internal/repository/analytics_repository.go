@@ -0,0 +1,290 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// Metrics supported by Timeseries
+const (
+	MetricSessions = "sessions"
+	MetricEvents   = "events"
+	MetricErrors   = "errors"
+)
+
+// notSandboxEvent excludes events of sandbox sessions from analytics
+const notSandboxEvent = "session_id NOT IN (SELECT session_id FROM sessions WHERE sandbox)"
+
+// timeseriesSources selects the timestamps counted for each metric in [$1, $2)
+var timeseriesSources = map[string]string{
+	MetricSessions: "SELECT started_at AS ts FROM sessions WHERE started_at >= $1 AND started_at < $2 AND NOT sandbox",
+	MetricEvents:   "SELECT timestamp AS ts FROM events WHERE timestamp >= $1 AND timestamp < $2 AND " + notSandboxEvent,
+	MetricErrors:   "SELECT timestamp AS ts FROM events WHERE event_type = 'error' AND timestamp >= $1 AND timestamp < $2 AND " + notSandboxEvent,
+}
+
+// IsTimeseriesMetric reports whether metric can be passed to Timeseries
+func IsTimeseriesMetric(metric string) bool {
+	_, ok := timeseriesSources[metric]
+	return ok
+}
+
+// breakdownColumns maps each breakdown dimension to its sessions column
+var breakdownColumns = map[string]string{
+	"country":     "country",
+	"browser":     "browser",
+	"os":          "os",
+	"device_type": "device_type",
+}
+
+// IsBreakdownDimension reports whether dimension can be passed to Breakdown
+func IsBreakdownDimension(dimension string) bool {
+	_, ok := breakdownColumns[dimension]
+	return ok
+}
+
+type AnalyticsRepository struct {
+	db *Database
+}
+
+func NewAnalyticsRepository(db *Database) *AnalyticsRepository {
+	return &AnalyticsRepository{db: db}
+}
+
+// SDKVersions counts sessions and events per SDK identifier over the last `days` days.
+// Sessions created before SDK tracking are reported under an empty SDK.
+func (r *AnalyticsRepository) SDKVersions(ctx context.Context, days int) ([]*models.SDKUsage, error) {
+	query := `
+		SELECT COALESCE(s.sdk, '') AS sdk, COUNT(*) AS sessions,
+			COALESCE(SUM(e.events), 0) AS events, MAX(s.last_activity_at) AS last_seen_at
+		FROM sessions s
+		LEFT JOIN (
+			SELECT session_id, COUNT(*) AS events
+			FROM events
+			WHERE timestamp >= NOW() - make_interval(days => $1)
+			GROUP BY session_id
+		) e ON e.session_id = s.session_id
+		WHERE s.started_at >= NOW() - make_interval(days => $1) AND NOT s.sandbox
+		GROUP BY COALESCE(s.sdk, '')
+		ORDER BY sessions DESC
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, days)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sdk versions: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []*models.SDKUsage
+	for rows.Next() {
+		u := &models.SDKUsage{}
+		if err := rows.Scan(&u.SDK, &u.Sessions, &u.Events, &u.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan sdk usage: %w", err)
+		}
+		usage = append(usage, u)
+	}
+
+	return usage, nil
+}
+
+// Overview computes headline KPIs for sessions started in [from, to). Sessions with
+// at most one distinct page count as single-page (bounced) sessions. Pages are told
+// apart by normalized URL, so URLs grouped by the URL rules count as one.
+func (r *AnalyticsRepository) Overview(ctx context.Context, from, to time.Time, topN int) (*models.AnalyticsOverview, error) {
+	overview := &models.AnalyticsOverview{
+		From:      from,
+		To:        to,
+		TopPages:  []models.PageStat{},
+		TopErrors: []models.ErrorStat{},
+		Devices:   make(map[string]int64),
+	}
+
+	err := r.db.Pool.QueryRow(ctx, `
+		WITH window_sessions AS (
+			SELECT s.session_id,
+				COALESCE(s.user_id, s.fingerprint, s.session_id::text) AS visitor,
+				EXTRACT(EPOCH FROM (COALESCE(s.ended_at, s.last_activity_at) - s.started_at)) AS duration,
+				(SELECT COUNT(DISTINCT COALESCE(e.normalized_url, e.page_url)) FROM events e WHERE e.session_id = s.session_id) AS pages
+			FROM sessions s
+			WHERE s.started_at >= $1 AND s.started_at < $2 AND NOT s.sandbox
+		)
+		SELECT COUNT(*), COUNT(DISTINCT visitor), COALESCE(AVG(duration), 0),
+			COUNT(*) FILTER (WHERE pages <= 1)
+		FROM window_sessions
+	`, from, to).Scan(
+		&overview.Sessions, &overview.UniqueVisitors, &overview.AvgDurationSeconds,
+		&overview.SinglePageSessions,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session kpis: %w", err)
+	}
+	if overview.Sessions > 0 {
+		overview.BounceRate = float64(overview.SinglePageSessions) / float64(overview.Sessions)
+	}
+
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT COALESCE(normalized_url, page_url) AS page, COUNT(DISTINCT session_id) AS sessions, COUNT(*) AS events
+		FROM events
+		WHERE timestamp >= $1 AND timestamp < $2 AND `+notSandboxEvent+`
+		GROUP BY page
+		ORDER BY sessions DESC, events DESC
+		LIMIT $3
+	`, from, to, topN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top pages: %w", err)
+	}
+	for rows.Next() {
+		var page models.PageStat
+		if err := rows.Scan(&page.PageURL, &page.Sessions, &page.Events); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan top page: %w", err)
+		}
+		overview.TopPages = append(overview.TopPages, page)
+	}
+	rows.Close()
+
+	rows, err = r.db.Pool.Query(ctx, `
+		SELECT COALESCE(event_data->>'message', target_element, 'Unknown error') AS message,
+			COUNT(*) AS occurrences, COUNT(DISTINCT session_id) AS sessions
+		FROM events
+		WHERE event_type = 'error' AND timestamp >= $1 AND timestamp < $2 AND `+notSandboxEvent+`
+		GROUP BY message
+		ORDER BY occurrences DESC
+		LIMIT $3
+	`, from, to, topN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top errors: %w", err)
+	}
+	for rows.Next() {
+		var stat models.ErrorStat
+		if err := rows.Scan(&stat.Message, &stat.Occurrences, &stat.Sessions); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan top error: %w", err)
+		}
+		overview.TopErrors = append(overview.TopErrors, stat)
+	}
+	rows.Close()
+
+	rows, err = r.db.Pool.Query(ctx, `
+		SELECT COALESCE(NULLIF(device_type, ''), 'unknown') AS device, COUNT(*)
+		FROM sessions
+		WHERE started_at >= $1 AND started_at < $2 AND NOT sandbox
+		GROUP BY device
+	`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device split: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var device string
+		var count int64
+		if err := rows.Scan(&device, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan device split: %w", err)
+		}
+		overview.Devices[device] = count
+	}
+
+	return overview, nil
+}
+
+// Timeseries counts a metric per interval ("hour" or "day") bucket in [from, to).
+// Buckets without data are returned with a zero count.
+func (r *AnalyticsRepository) Timeseries(ctx context.Context, metric, interval string, from, to time.Time) ([]models.TrendPoint, error) {
+	source, ok := timeseriesSources[metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric: %s", metric)
+	}
+	if interval != "hour" && interval != "day" {
+		return nil, fmt.Errorf("unknown interval: %s", interval)
+	}
+
+	query := `
+		WITH counts AS (
+			SELECT date_trunc($3, ts) AS bucket, COUNT(*) AS count
+			FROM (` + source + `) m
+			GROUP BY bucket
+		)
+		SELECT b.bucket, COALESCE(counts.count, 0)
+		FROM generate_series(date_trunc($3, $1::timestamptz), $2::timestamptz, ('1 ' || $3)::interval) AS b(bucket)
+		LEFT JOIN counts ON counts.bucket = b.bucket
+		WHERE b.bucket < $2
+		ORDER BY b.bucket ASC
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, from, to, interval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s timeseries: %w", metric, err)
+	}
+	defer rows.Close()
+
+	points := []models.TrendPoint{}
+	for rows.Next() {
+		var point models.TrendPoint
+		if err := rows.Scan(&point.Bucket, &point.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan timeseries point: %w", err)
+		}
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// Breakdown groups sessions started in [from, to) by a dimension, returning the top
+// `limit` values by session count. Missing values are grouped as "unknown".
+func (r *AnalyticsRepository) Breakdown(ctx context.Context, dimension string, from, to time.Time, limit int) ([]models.BreakdownRow, error) {
+	column, ok := breakdownColumns[dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown dimension: %s", dimension)
+	}
+
+	query := `
+		WITH window_sessions AS (
+			SELECT s.session_id,
+				COALESCE(NULLIF(s.` + column + `, ''), 'unknown') AS value,
+				COALESCE(s.user_id, s.fingerprint, s.session_id::text) AS visitor,
+				EXTRACT(EPOCH FROM (COALESCE(s.ended_at, s.last_activity_at) - s.started_at)) AS duration
+			FROM sessions s
+			WHERE s.started_at >= $1 AND s.started_at < $2 AND NOT s.sandbox
+		), session_events AS (
+			SELECT e.session_id, COUNT(*) AS events, COUNT(DISTINCT COALESCE(e.normalized_url, e.page_url)) AS pages
+			FROM events e
+			JOIN window_sessions w ON w.session_id = e.session_id
+			WHERE e.timestamp >= $1
+			GROUP BY e.session_id
+		)
+		SELECT w.value, COUNT(*), COUNT(DISTINCT w.visitor),
+			COALESCE(AVG(w.duration), 0), COALESCE(AVG(COALESCE(se.events, 0)), 0),
+			COUNT(*) FILTER (WHERE COALESCE(se.pages, 0) <= 1)
+		FROM window_sessions w
+		LEFT JOIN session_events se ON se.session_id = w.session_id
+		GROUP BY w.value
+		ORDER BY COUNT(*) DESC, w.value ASC
+		LIMIT $3
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s breakdown: %w", dimension, err)
+	}
+	defer rows.Close()
+
+	breakdown := []models.BreakdownRow{}
+	for rows.Next() {
+		var row models.BreakdownRow
+		err := rows.Scan(
+			&row.Value, &row.Sessions, &row.UniqueVisitors,
+			&row.AvgDurationSeconds, &row.AvgEventsPerSession, &row.SinglePageSessions,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan breakdown row: %w", err)
+		}
+		if row.Sessions > 0 {
+			row.BounceRate = float64(row.SinglePageSessions) / float64(row.Sessions)
+		}
+		breakdown = append(breakdown, row)
+	}
+
+	return breakdown, nil
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// apiKeyPrefixLen is how much of a key is kept in clear to identify it
+const apiKeyPrefixLen = 12
+
+type APIKeyRepository struct {
+	db *Database
+}
+
+func NewAPIKeyRepository(db *Database) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+const apiKeyColumns = `key_id, name, scope, key_prefix, last_used_at, revoked_at, created_at, updated_at`
+
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	k := &models.APIKey{}
+	err := row.Scan(&k.KeyID, &k.Name, &k.Scope, &k.Prefix, &k.LastUsedAt, &k.RevokedAt, &k.CreatedAt, &k.UpdatedAt)
+	return k, err
+}
+
+// HashAPIKey returns the stored form of an API key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAPIKey generates a random "utk_" prefixed secret key
+func newAPIKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return models.APIKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// Create registers an API key and returns it with its secret, which is not stored
+func (r *APIKeyRepository) Create(ctx context.Context, req *models.CreateAPIKeyRequest) (*models.APIKey, error) {
+	secret, err := newAPIKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	key, err := scanAPIKey(r.db.Pool.QueryRow(ctx,
+		`INSERT INTO api_keys (name, scope, key_prefix, key_hash)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+apiKeyColumns,
+		req.Name, req.Scope, secret[:apiKeyPrefixLen], HashAPIKey(secret),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+	key.Key = secret
+	return key, nil
+}
+
+// List returns all API keys, revoked ones included, newest first
+func (r *APIKeyRepository) List(ctx context.Context) ([]*models.APIKey, error) {
+	rows, err := r.db.Pool.Query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetActiveByKey returns the unrevoked key with this secret
+func (r *APIKeyRepository) GetActiveByKey(ctx context.Context, secret string) (*models.APIKey, error) {
+	key, err := scanAPIKey(r.db.Pool.QueryRow(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`, HashAPIKey(secret),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", notFoundOr(err))
+	}
+	return key, nil
+}
+
+// Rotate replaces the secret of an unrevoked key; the old secret stops working at once
+func (r *APIKeyRepository) Rotate(ctx context.Context, keyID uuid.UUID) (*models.APIKey, error) {
+	secret, err := newAPIKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	key, err := scanAPIKey(r.db.Pool.QueryRow(ctx,
+		`UPDATE api_keys SET key_prefix = $2, key_hash = $3, updated_at = NOW()
+		WHERE key_id = $1 AND revoked_at IS NULL
+		RETURNING `+apiKeyColumns,
+		keyID, secret[:apiKeyPrefixLen], HashAPIKey(secret),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate API key: %w", notFoundOr(err))
+	}
+	key.Key = secret
+	return key, nil
+}
+
+// SetScope changes what an unrevoked key may do
+func (r *APIKeyRepository) SetScope(ctx context.Context, keyID uuid.UUID, scope string) (*models.APIKey, error) {
+	key, err := scanAPIKey(r.db.Pool.QueryRow(ctx,
+		`UPDATE api_keys SET scope = $2, updated_at = NOW()
+		WHERE key_id = $1 AND revoked_at IS NULL
+		RETURNING `+apiKeyColumns,
+		keyID, scope,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update API key scope: %w", notFoundOr(err))
+	}
+	return key, nil
+}
+
+// TouchLastUsed records that the key was just used
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, keyID uuid.UUID) error {
+	if _, err := r.db.Pool.Exec(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE key_id = $1`, keyID); err != nil {
+		return fmt.Errorf("failed to update API key last use: %w", err)
+	}
+	return nil
+}
+
+// Revoke disables a key for good
+func (r *APIKeyRepository) Revoke(ctx context.Context, keyID uuid.UUID) error {
+	tag, err := r.db.Pool.Exec(ctx,
+		`UPDATE api_keys SET revoked_at = NOW(), updated_at = NOW()
+		WHERE key_id = $1 AND revoked_at IS NULL`,
+		keyID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to revoke API key: %w", ErrNotFound)
+	}
+	return nil
+}
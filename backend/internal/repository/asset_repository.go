@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type AssetRepository struct {
+	db *Database
+}
+
+func NewAssetRepository(db *Database) *AssetRepository {
+	return &AssetRepository{db: db}
+}
+
+const replayAssetColumns = `project, url_hash, url, storage_key, content_type, size_bytes, fetched_at, last_used_at`
+
+func scanReplayAsset(row pgx.Row) (*models.ReplayAsset, error) {
+	a := &models.ReplayAsset{}
+	err := row.Scan(&a.Project, &a.URLHash, &a.URL, &a.StorageKey, &a.ContentType, &a.SizeBytes, &a.FetchedAt, &a.LastUsedAt)
+	return a, err
+}
+
+// Get returns a cached asset of project and marks it used now
+func (r *AssetRepository) Get(ctx context.Context, project, urlHash string) (*models.ReplayAsset, error) {
+	asset, err := scanReplayAsset(r.db.Pool.QueryRow(ctx, `
+		UPDATE replay_assets SET last_used_at = NOW()
+		WHERE project = $1 AND url_hash = $2
+		RETURNING `+replayAssetColumns,
+		project, urlHash,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replay asset: %w", notFoundOr(err))
+	}
+	return asset, nil
+}
+
+// Exists reports whether project has the asset cached, without marking it used
+func (r *AssetRepository) Exists(ctx context.Context, project, urlHash string) (bool, error) {
+	var exists bool
+	err := r.db.Pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM replay_assets WHERE project = $1 AND url_hash = $2)`, project, urlHash,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check replay asset: %w", err)
+	}
+	return exists, nil
+}
+
+// Save records a fetched asset, replacing an earlier copy of the same URL
+func (r *AssetRepository) Save(ctx context.Context, a *models.ReplayAsset) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO replay_assets (project, url_hash, url, storage_key, content_type, size_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (project, url_hash) DO UPDATE SET
+			storage_key = EXCLUDED.storage_key, content_type = EXCLUDED.content_type,
+			size_bytes = EXCLUDED.size_bytes, fetched_at = NOW(), last_used_at = NOW()
+	`, a.Project, a.URLHash, a.URL, a.StorageKey, a.ContentType, a.SizeBytes)
+	if err != nil {
+		return fmt.Errorf("failed to save replay asset: %w", err)
+	}
+	return nil
+}
+
+// Delete removes an asset's record; its blob is removed by the caller
+func (r *AssetRepository) Delete(ctx context.Context, project, urlHash string) error {
+	if _, err := r.db.Pool.Exec(ctx, `DELETE FROM replay_assets WHERE project = $1 AND url_hash = $2`, project, urlHash); err != nil {
+		return fmt.Errorf("failed to delete replay asset: %w", err)
+	}
+	return nil
+}
+
+// SizeBytes returns the total size of project's cached assets
+func (r *AssetRepository) SizeBytes(ctx context.Context, project string) (int64, error) {
+	var size int64
+	err := r.db.Pool.QueryRow(ctx,
+		`SELECT COALESCE(SUM(size_bytes), 0) FROM replay_assets WHERE project = $1`, project,
+	).Scan(&size)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get replay asset usage: %w", err)
+	}
+	return size, nil
+}
+
+// LeastRecentlyUsed returns up to limit of project's assets, least recently used first
+func (r *AssetRepository) LeastRecentlyUsed(ctx context.Context, project string, limit int) ([]*models.ReplayAsset, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT `+replayAssetColumns+`
+		FROM replay_assets
+		WHERE project = $1
+		ORDER BY last_used_at ASC
+		LIMIT $2
+	`, project, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replay assets: %w", err)
+	}
+	defer rows.Close()
+
+	assets := []*models.ReplayAsset{}
+	for rows.Next() {
+		asset, err := scanReplayAsset(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan replay asset: %w", err)
+		}
+		assets = append(assets, asset)
+	}
+	return assets, rows.Err()
+}
+
+// Usage returns the number and total size of cached assets per project
+func (r *AssetRepository) Usage(ctx context.Context) ([]*models.AssetUsage, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT project, COUNT(*), SUM(size_bytes)
+		FROM replay_assets
+		GROUP BY project
+		ORDER BY project
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replay asset usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []*models.AssetUsage{}
+	for rows.Next() {
+		u := &models.AssetUsage{}
+		if err := rows.Scan(&u.Project, &u.Assets, &u.SizeBytes); err != nil {
+			return nil, fmt.Errorf("failed to scan replay asset usage: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type CatalogRepository struct {
+	db *Database
+}
+
+func NewCatalogRepository(db *Database) *CatalogRepository {
+	return &CatalogRepository{db: db}
+}
+
+// Add adds the counts of entries to the catalog, widening the first/last seen range
+// of entries already there
+func (r *CatalogRepository) Add(ctx context.Context, entries []models.CatalogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, e := range entries {
+		batch.Queue(`
+			INSERT INTO event_catalog (project, event_type, data_key, count, first_seen_at, last_seen_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (project, event_type, data_key) DO UPDATE SET
+				count = event_catalog.count + EXCLUDED.count,
+				first_seen_at = LEAST(event_catalog.first_seen_at, EXCLUDED.first_seen_at),
+				last_seen_at = GREATEST(event_catalog.last_seen_at, EXCLUDED.last_seen_at)
+		`, e.Project, e.EventType, e.Key, e.Count, e.FirstSeenAt, e.LastSeenAt)
+	}
+
+	if err := r.db.Pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to update event catalog: %w", err)
+	}
+	return nil
+}
+
+// List returns the event types of project, most frequent first, each with its
+// event_data keys by frequency. A non-empty eventType returns only that type.
+func (r *CatalogRepository) List(ctx context.Context, project, eventType string) ([]*models.CatalogEvent, error) {
+	f := newQueryFilter().where("project = ?", project)
+	if eventType != "" {
+		f.where("event_type = ?", eventType)
+	}
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT event_type, data_key, count, first_seen_at, last_seen_at
+		FROM event_catalog
+		WHERE `+f.clause()+`
+		ORDER BY event_type ASC, data_key = '' DESC, count DESC, data_key ASC
+	`, f.values()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event catalog: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*models.CatalogEvent{}
+	var current *models.CatalogEvent
+	for rows.Next() {
+		var key models.CatalogKey
+		var eventType string
+		if err := rows.Scan(&eventType, &key.Key, &key.Count, &key.FirstSeenAt, &key.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan catalog entry: %w", err)
+		}
+		if current == nil || current.EventType != eventType {
+			current = &models.CatalogEvent{
+				Project:   project,
+				EventType: eventType,
+				Custom:    models.IsCustomEventType(models.EventType(eventType)),
+				Keys:      []models.CatalogKey{},
+			}
+			events = append(events, current)
+		}
+		if key.Key == "" {
+			current.Count = key.Count
+			current.FirstSeenAt = key.FirstSeenAt
+			current.LastSeenAt = key.LastSeenAt
+			continue
+		}
+		current.Keys = append(current.Keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list event catalog: %w", err)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Count > events[j].Count
+	})
+	return events, nil
+}
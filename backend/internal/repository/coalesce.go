@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// coalesceTimeout bounds a coalesced read, which no single caller can cancel
+const coalesceTimeout = 30 * time.Second
+
+// counted is a count result passed through coalesce
+type counted struct {
+	count     int64
+	estimated bool
+}
+
+// coalesce runs fn once for concurrent calls with the same key and hands its result
+// to every caller, so several dashboards opening the same session run each query
+// once. The query is detached from the caller that started it, so that caller going
+// away does not fail the others. Handlers mask results in place, so callers of a
+// shared result each get a copy from clone.
+func coalesce[T any](ctx context.Context, group *singleflight.Group, key string, fn func(ctx context.Context) (T, error), clone func(T) T) (T, error) {
+	v, err, shared := group.Do(key, func() (interface{}, error) {
+		readCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), coalesceTimeout)
+		defer cancel()
+		return fn(readCtx)
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	result := v.(T)
+	if shared && clone != nil {
+		result = clone(result)
+	}
+	return result, nil
+}
+
+// cloneEach returns a slice of shallow copies of items. Masking replaces fields
+// rather than writing through them, so shallow copies keep callers apart.
+func cloneEach[T any](items []*T) []*T {
+	if items == nil {
+		return nil
+	}
+	copies := make([]*T, len(items))
+	for i, item := range items {
+		c := *item
+		copies[i] = &c
+	}
+	return copies
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// estimateRows returns the planner's row estimate for query, without running it
+func (db *Database) estimateRows(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	var plan []byte
+	if err := db.Pool.QueryRow(ctx, "EXPLAIN (FORMAT JSON) "+query, args...).Scan(&plan); err != nil {
+		return 0, fmt.Errorf("failed to explain count: %w", err)
+	}
+
+	var explained []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explained); err != nil || len(explained) == 0 {
+		return 0, fmt.Errorf("failed to parse query plan: %v", err)
+	}
+	return int64(explained[0].Plan.Rows), nil
+}
+
+// tableRows returns the row count of table from the statistics in pg_class, or -1
+// when the table has not been analyzed yet
+func (db *Database) tableRows(ctx context.Context, table string) (int64, error) {
+	var rows float64
+	err := db.Pool.QueryRow(ctx, "SELECT reltuples FROM pg_class WHERE oid = to_regclass($1)", table).Scan(&rows)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read table statistics: %w", notFoundOr(err))
+	}
+	return int64(rows), nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrNotFound is returned when a lookup matches no rows. Any other error returned by
+// a repository means the query itself failed.
+var ErrNotFound = errors.New("not found")
+
+// notFoundOr maps pgx.ErrNoRows to ErrNotFound and returns other errors unchanged
+func notFoundOr(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// missingParentOr maps a foreign key violation, i.e. a referenced row such as the
+// session that does not exist, to ErrNotFound and returns other errors unchanged
+func missingParentOr(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return ErrNotFound
+	}
+	return err
+}
+
+// retryableCodes are SQLSTATE codes and classes of failures that may succeed when the
+// same statement is retried: lost connections, deadlocks, serialization failures,
+// lock timeouts, exhausted resources and server restarts
+var retryableCodes = []string{"08", "40001", "40P01", "53", "55P03", "57P01", "57P02", "57P03", "58030"}
+
+// IsRetryable reports whether err is transient, so the write that failed may succeed
+// on retry. Other database errors (constraint violations, invalid data) fail the
+// same way every time. Errors that are not from the database count as retryable only
+// when they are network failures, timeouts or cancellations.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		for _, code := range retryableCodes {
+			if strings.HasPrefix(pgErr.Code, code) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, context.Canceled) ||
+		pgconn.Timeout(err) ||
+		pgconn.SafeToRetry(err)
+}
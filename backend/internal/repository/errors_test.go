@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestNotFoundOr(t *testing.T) {
+	if err := notFoundOr(pgx.ErrNoRows); !errors.Is(err, ErrNotFound) {
+		t.Errorf("pgx.ErrNoRows mapped to %v, want ErrNotFound", err)
+	}
+
+	if err := notFoundOr(fmt.Errorf("scan: %w", pgx.ErrNoRows)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("wrapped pgx.ErrNoRows mapped to %v, want ErrNotFound", err)
+	}
+
+	other := errors.New("connection reset")
+	if err := notFoundOr(other); errors.Is(err, ErrNotFound) || err != other {
+		t.Errorf("unrelated error mapped to %v, want it unchanged", err)
+	}
+}
+
+func TestMissingParentOr(t *testing.T) {
+	fk := &pgconn.PgError{Code: "23503"}
+	if err := missingParentOr(fmt.Errorf("insert: %w", fk)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("foreign key violation mapped to %v, want ErrNotFound", err)
+	}
+
+	unique := &pgconn.PgError{Code: "23505"}
+	if err := missingParentOr(unique); err != error(unique) {
+		t.Errorf("unique violation mapped to %v, want it unchanged", err)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"deadlock", &pgconn.PgError{Code: "40P01"}, true},
+		{"serialization failure", fmt.Errorf("insert: %w", &pgconn.PgError{Code: "40001"}), true},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, true},
+		{"connection reset", &net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{"unexpected EOF", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"timeout", context.DeadlineExceeded, true},
+		{"foreign key violation", &pgconn.PgError{Code: "23503"}, false},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"invalid text representation", &pgconn.PgError{Code: "22P02"}, false},
+		{"not found", ErrNotFound, false},
+		{"other", errors.New("failed to marshal event data"), false},
+		{"nil", nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetryable(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
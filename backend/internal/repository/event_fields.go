@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// eventField is an event field that can be selected on its own
+type eventField struct {
+	column string
+	// dest returns the Event field the column scans into
+	dest func(e *models.Event) interface{}
+}
+
+// eventFields maps the JSON names of Event to their columns, for ?fields= projection
+var eventFields = map[string]eventField{
+	"event_id":        {"event_id", func(e *models.Event) interface{} { return &e.EventID }},
+	"session_id":      {"session_id", func(e *models.Event) interface{} { return &e.SessionID }},
+	"timestamp":       {"timestamp", func(e *models.Event) interface{} { return &e.Timestamp }},
+	"event_type":      {"event_type", func(e *models.Event) interface{} { return &e.EventType }},
+	"target_element":  {"target_element", func(e *models.Event) interface{} { return &e.TargetElement }},
+	"target_selector": {"target_selector", func(e *models.Event) interface{} { return &e.TargetSelector }},
+	"target_tag":      {"target_tag", func(e *models.Event) interface{} { return &e.TargetTag }},
+	"target_id":       {"target_id", func(e *models.Event) interface{} { return &e.TargetID }},
+	"target_class":    {"target_class", func(e *models.Event) interface{} { return &e.TargetClass }},
+	"page_url":        {"page_url", func(e *models.Event) interface{} { return &e.PageURL }},
+	"viewport_x":      {"viewport_x::float8", func(e *models.Event) interface{} { return &e.ViewportX }},
+	"viewport_y":      {"viewport_y::float8", func(e *models.Event) interface{} { return &e.ViewportY }},
+	"screen_x":        {"screen_x::float8", func(e *models.Event) interface{} { return &e.ScreenX }},
+	"screen_y":        {"screen_y::float8", func(e *models.Event) interface{} { return &e.ScreenY }},
+	"scroll_x":        {"scroll_x::float8", func(e *models.Event) interface{} { return &e.ScrollX }},
+	"scroll_y":        {"scroll_y::float8", func(e *models.Event) interface{} { return &e.ScrollY }},
+	"norm_x":          {"norm_x", func(e *models.Event) interface{} { return &e.NormX }},
+	"norm_y":          {"norm_y", func(e *models.Event) interface{} { return &e.NormY }},
+	"input_value":     {"input_value", func(e *models.Event) interface{} { return &e.InputValue }},
+	"input_masked":    {"input_masked", func(e *models.Event) interface{} { return &e.InputMasked }},
+	"key_pressed":     {"key_pressed", func(e *models.Event) interface{} { return &e.KeyPressed }},
+	"mouse_button":    {"mouse_button", func(e *models.Event) interface{} { return &e.MouseButton }},
+	"click_count":     {"click_count", func(e *models.Event) interface{} { return &e.ClickCount }},
+	"event_data":      {"event_data", func(e *models.Event) interface{} { return &e.EventData }},
+	"sdk":             {"sdk", func(e *models.Event) interface{} { return &e.SDK }},
+	"expires_at":      {"expires_at", func(e *models.Event) interface{} { return &e.ExpiresAt }},
+	"tab_id":          {"tab_id", func(e *models.Event) interface{} { return &e.TabID }},
+	"frame_path":      {"frame_path", func(e *models.Event) interface{} { return &e.FramePath }},
+	"normalized_url":  {"normalized_url", func(e *models.Event) interface{} { return &e.NormalizedURL }},
+}
+
+// ParseEventFields splits a comma-separated ?fields= value into known event fields,
+// dropping duplicates. It returns an error naming the first unknown field.
+func ParseEventFields(value string) ([]string, error) {
+	var fields []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, ok := eventFields[name]; !ok {
+			return nil, fmt.Errorf("unknown event field: %s", name)
+		}
+		seen[name] = true
+		fields = append(fields, name)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no event fields given")
+	}
+	return fields, nil
+}
+
+// EventFieldNames lists the fields accepted by ParseEventFields
+func EventFieldNames() []string {
+	names := make([]string, 0, len(eventFields))
+	for name := range eventFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetBySessionIDFields is GetBySessionID reading only fields (from ParseEventFields);
+// the other Event fields are left zero
+func (r *EventRepository) GetBySessionIDFields(ctx context.Context, sessionID uuid.UUID, frame string, fields []string, limit int) ([]*models.Event, error) {
+	key := fmt.Sprintf("fields:%s:%s:%d:%s", sessionID, frame, limit, strings.Join(fields, ","))
+	return coalesce(ctx, &r.reads, key, func(ctx context.Context) ([]*models.Event, error) {
+		return r.getBySessionIDFields(ctx, sessionID, frame, fields, limit)
+	}, cloneEach[models.Event])
+}
+
+func (r *EventRepository) getBySessionIDFields(ctx context.Context, sessionID uuid.UUID, frame string, fields []string, limit int) ([]*models.Event, error) {
+	columns := make([]string, len(fields))
+	for i, name := range fields {
+		columns[i] = eventFields[name].column
+	}
+
+	f := newQueryFilter().where("session_id = ?", sessionID)
+	whereFramePath(f, frame)
+	query := `
+		SELECT ` + strings.Join(columns, ", ") + `
+		FROM events
+		WHERE ` + f.clause() + `
+		ORDER BY timestamp ASC
+		LIMIT ` + f.param(limit)
+
+	rows, err := r.db.Pool.Query(ctx, query, f.values()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*models.Event{}
+	for rows.Next() {
+		event := &models.Event{}
+		dest := make([]interface{}, len(fields))
+		for i, name := range fields {
+			dest[i] = eventFields[name].dest(event)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+
+	return events, nil
+}
+
+// ProjectEvents returns each event as an object holding only fields
+func ProjectEvents(events []*models.Event, fields []string) []map[string]interface{} {
+	projected := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		m := make(map[string]interface{}, len(fields))
+		for _, name := range fields {
+			m[name] = eventFields[name].dest(event)
+		}
+		projected[i] = m
+	}
+	return projected
+}
@@ -2,140 +2,303 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/ngocp/user-tracker/internal/models"
+	"golang.org/x/sync/singleflight"
 )
 
+// eventColumns is the column list read by scanEvents. Coordinates are cast to float8
+// so databases still on INTEGER coordinate columns (before migration 000026) can be
+// read during a rolling upgrade.
+const eventColumns = `event_id, session_id, timestamp, event_type, target_element,
+	target_selector, target_tag, target_id, target_class, page_url,
+	viewport_x::float8, viewport_y::float8, screen_x::float8, screen_y::float8, scroll_x::float8, scroll_y::float8,
+	input_value, input_masked, key_pressed, mouse_button, click_count, event_data, sdk, expires_at,
+	norm_x, norm_y, tab_id, frame_path, normalized_url`
+
+// whereFramePath keeps events of frame and the frames nested in it; "main" also
+// matches events without a frame_path and an empty frame matches everything
+func whereFramePath(f *queryFilter, frame string) {
+	switch frame {
+	case "":
+	case models.TopFrame:
+		f.where("frame_path IS NULL OR frame_path = ? OR starts_with(frame_path, ?)", frame, frame+models.FramePathSeparator)
+	default:
+		f.where("frame_path = ? OR starts_with(frame_path, ?)", frame, frame+models.FramePathSeparator)
+	}
+}
+
+// maxViewportHistory caps a session's viewport history; the oldest changes are dropped
+const maxViewportHistory = 500
+
 type EventRepository struct {
 	db *Database
+	// reads coalesces concurrent identical dashboard reads
+	reads singleflight.Group
 }
 
 func NewEventRepository(db *Database) *EventRepository {
 	return &EventRepository{db: db}
 }
 
-// roundFloat64ToInt rounds a float64 pointer to int pointer
-func roundFloat64ToInt(f *float64) *int {
-	if f == nil {
-		return nil
+// scanEvents reads event rows selected with eventColumns
+// eventDests returns the scan destinations of eventColumns in event
+func eventDests(event *models.Event) []interface{} {
+	return []interface{}{
+		&event.EventID, &event.SessionID, &event.Timestamp, &event.EventType,
+		&event.TargetElement, &event.TargetSelector, &event.TargetTag,
+		&event.TargetID, &event.TargetClass, &event.PageURL,
+		&event.ViewportX, &event.ViewportY, &event.ScreenX, &event.ScreenY,
+		&event.ScrollX, &event.ScrollY, &event.InputValue, &event.InputMasked,
+		&event.KeyPressed, &event.MouseButton, &event.ClickCount, &event.EventData,
+		&event.SDK, &event.ExpiresAt, &event.NormX, &event.NormY, &event.TabID, &event.FramePath,
+		&event.NormalizedURL,
 	}
-	rounded := int(math.Round(*f))
-	return &rounded
 }
 
-// intToFloat64 converts an int pointer to float64 pointer
-func intToFloat64(i *int) *float64 {
-	if i == nil {
-		return nil
+func scanEvents(rows pgx.Rows) ([]*models.Event, error) {
+	var events []*models.Event
+	for rows.Next() {
+		event := &models.Event{}
+		err := rows.Scan(eventDests(event)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
 	}
-	f := float64(*i)
-	return &f
+
+	return events, nil
 }
 
 func (r *EventRepository) CreateBatch(ctx context.Context, sessionID uuid.UUID, events []models.EventData) error {
+	_, err := r.writeBatch(ctx, sessionID, events, nil)
+	return err
+}
+
+// CreateBatchReturningIDs inserts events like CreateBatch and returns their assigned
+// event IDs in input order
+func (r *EventRepository) CreateBatchReturningIDs(ctx context.Context, sessionID uuid.UUID, events []models.EventData) ([]int64, error) {
+	return r.writeBatch(ctx, sessionID, events, nil)
+}
+
+// ReplaceFromStream re-applies replayed stream messages: rows previously inserted from
+// streamIDs are deleted and events inserted in their place, in one transaction, so
+// replaying the same messages any number of times leaves a single copy
+func (r *EventRepository) ReplaceFromStream(ctx context.Context, sessionID uuid.UUID, streamIDs []string, events []models.EventData) error {
+	_, err := r.writeBatch(ctx, sessionID, events, streamIDs)
+	return err
+}
+
+// writeBatch inserts events in one transaction and returns their event IDs. Events
+// of a session that does not exist are refused with ErrNotFound before anything is
+// written; the sessions foreign key still catches a session deleted in the meantime.
+func (r *EventRepository) writeBatch(ctx context.Context, sessionID uuid.UUID, events []models.EventData, replaceStreamIDs []string) ([]int64, error) {
 	if len(events) == 0 {
-		return nil
+		return nil, nil
 	}
 
+	viewport, err := r.viewportAt(ctx, sessionID, events[0].Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	models.NormalizeCoordinates(events, viewport)
+
 	batch := &pgx.Batch{}
+	if len(replaceStreamIDs) > 0 {
+		batch.Queue(
+			"DELETE FROM events WHERE session_id = $1 AND stream_id = ANY($2)",
+			sessionID, replaceStreamIDs,
+		)
+	}
+
 	query := `
 		INSERT INTO events (
 			session_id, timestamp, event_type, target_element, target_selector,
 			target_tag, target_id, target_class, page_url, viewport_x, viewport_y,
 			screen_x, screen_y, scroll_x, scroll_y, input_value, input_masked,
-			key_pressed, mouse_button, click_count, event_data
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+			key_pressed, mouse_button, click_count, event_data, sdk, stream_id, expires_at,
+			norm_x, norm_y, tab_id, frame_path, normalized_url
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, NULLIF($23, ''), $24, $25, $26, $27, $28, $29)
+		RETURNING event_id
 	`
 
 	for _, event := range events {
-		// Round float64 values to int for database (columns are INTEGER)
-		viewportX := roundFloat64ToInt(event.ViewportX)
-		viewportY := roundFloat64ToInt(event.ViewportY)
-		screenX := roundFloat64ToInt(event.ScreenX)
-		screenY := roundFloat64ToInt(event.ScreenY)
-		scrollX := roundFloat64ToInt(event.ScrollX)
-		scrollY := roundFloat64ToInt(event.ScrollY)
-
 		batch.Queue(query,
 			sessionID, event.Timestamp, event.EventType,
 			event.TargetElement, event.TargetSelector, event.TargetTag,
 			event.TargetID, event.TargetClass, event.PageURL,
-			viewportX, viewportY, screenX, screenY,
-			scrollX, scrollY, event.InputValue, event.InputMasked,
+			event.ViewportX, event.ViewportY, event.ScreenX, event.ScreenY,
+			event.ScrollX, event.ScrollY, event.InputValue, event.InputMasked,
 			event.KeyPressed, event.MouseButton, event.ClickCount, event.EventData,
+			event.SDK, event.StreamID, event.ExpiresAt(),
+			event.NormX, event.NormY, event.TabID, event.FramePath, event.NormalizedURL,
 		)
 	}
 
-	br := r.db.Pool.SendBatch(ctx, batch)
-	defer br.Close()
+	// Bump the session's activity once per batch instead of once per event row
+	lastActivity := events[0].Timestamp
+	for _, event := range events[1:] {
+		if event.Timestamp.After(lastActivity) {
+			lastActivity = event.Timestamp
+		}
+	}
+	batch.Queue(`
+		UPDATE sessions
+		SET last_activity_at = GREATEST(last_activity_at, $2), updated_at = NOW()
+		WHERE session_id = $1
+	`, sessionID, lastActivity)
+
+	// Merge resize events into the session's viewport history. Entries are
+	// deduplicated so replaying a batch leaves the history unchanged.
+	changes := models.ViewportChanges(events)
+	if len(changes) > 0 {
+		batch.Queue(`
+			UPDATE sessions
+			SET viewport_history = (
+				SELECT COALESCE(jsonb_agg(entry ORDER BY ts), '[]'::jsonb)
+				FROM (
+					SELECT DISTINCT entry, (entry->>'timestamp')::timestamptz AS ts
+					FROM jsonb_array_elements(viewport_history || $2::jsonb) AS entry
+					ORDER BY ts DESC
+					LIMIT $3
+				) latest
+			)
+			WHERE session_id = $1
+		`, sessionID, changes, maxViewportHistory)
+	}
 
-	for i := 0; i < len(events); i++ {
-		_, err := br.Exec()
-		if err != nil {
-			return fmt.Errorf("failed to insert event %d: %w", i, err)
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	br := tx.SendBatch(ctx, batch)
+
+	if len(replaceStreamIDs) > 0 {
+		if _, err := br.Exec(); err != nil {
+			br.Close()
+			return nil, fmt.Errorf("failed to delete replayed events: %w", err)
+		}
+	}
+
+	ids := make([]int64, len(events))
+	for i := range events {
+		if err := br.QueryRow().Scan(&ids[i]); err != nil {
+			br.Close()
+			return nil, fmt.Errorf("failed to insert event %d: %w", i, missingParentOr(err))
+		}
+	}
+
+	if _, err := br.Exec(); err != nil {
+		br.Close()
+		return nil, fmt.Errorf("failed to update session activity: %w", err)
+	}
+
+	if len(changes) > 0 {
+		if _, err := br.Exec(); err != nil {
+			br.Close()
+			return nil, fmt.Errorf("failed to update viewport history: %w", err)
 		}
 	}
 
-	return nil
+	if err := br.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close batch: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit events: %w", err)
+	}
+
+	return ids, nil
 }
 
-func (r *EventRepository) GetBySessionID(ctx context.Context, sessionID uuid.UUID, limit int) ([]*models.Event, error) {
+// viewportAt returns the session's viewport at ts: the size reported by the last
+// resize event before ts, or else the initial viewport from session creation. It is
+// zero when neither is known, and ErrNotFound when the session does not exist.
+func (r *EventRepository) viewportAt(ctx context.Context, sessionID uuid.UUID, ts time.Time) (models.Viewport, error) {
 	query := `
-		SELECT event_id, session_id, timestamp, event_type, target_element,
-			target_selector, target_tag, target_id, target_class, page_url,
-			viewport_x, viewport_y, screen_x, screen_y, scroll_x, scroll_y,
-			input_value, input_masked, key_pressed, mouse_button, click_count, event_data
-		FROM events
-		WHERE session_id = $1
-		ORDER BY timestamp ASC
-		LIMIT $2
+		SELECT COALESCE(resize.width, s.viewport_width, 0), COALESCE(resize.height, s.viewport_height, 0)
+		FROM sessions s
+		LEFT JOIN LATERAL (
+			SELECT (e.event_data->>'width')::numeric::int AS width, (e.event_data->>'height')::numeric::int AS height
+			FROM events e
+			WHERE e.session_id = s.session_id AND e.event_type = 'resize' AND e.timestamp <= $2
+				AND jsonb_typeof(e.event_data->'width') = 'number'
+				AND jsonb_typeof(e.event_data->'height') = 'number'
+			ORDER BY e.timestamp DESC
+			LIMIT 1
+		) resize ON TRUE
+		WHERE s.session_id = $1
 	`
 
-	rows, err := r.db.Pool.Query(ctx, query, sessionID, limit)
+	var v models.Viewport
+	err := r.db.Pool.QueryRow(ctx, query, sessionID, ts).Scan(&v.Width, &v.Height)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return v, fmt.Errorf("session %s does not exist: %w", sessionID, ErrNotFound)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get events: %w", err)
+		return v, fmt.Errorf("failed to get session viewport: %w", err)
 	}
-	defer rows.Close()
+	return v, nil
+}
 
-	var events []*models.Event
-	for rows.Next() {
-		event := &models.Event{}
-		// Scan into temporary int pointers for database INTEGER columns
-		var viewportX, viewportY, screenX, screenY, scrollX, scrollY *int
-		err := rows.Scan(
-			&event.EventID, &event.SessionID, &event.Timestamp, &event.EventType,
-			&event.TargetElement, &event.TargetSelector, &event.TargetTag,
-			&event.TargetID, &event.TargetClass, &event.PageURL,
-			&viewportX, &viewportY, &screenX, &screenY,
-			&scrollX, &scrollY, &event.InputValue, &event.InputMasked,
-			&event.KeyPressed, &event.MouseButton, &event.ClickCount, &event.EventData,
+// DeleteExpired deletes up to limit events whose TTL has passed and returns how many
+// were deleted
+func (r *EventRepository) DeleteExpired(ctx context.Context, limit int) (int64, error) {
+	tag, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM events
+		WHERE (event_id, timestamp) IN (
+			SELECT event_id, timestamp FROM events
+			WHERE expires_at IS NOT NULL AND expires_at <= NOW()
+			LIMIT $1
 		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan event: %w", err)
-		}
-		// Convert int pointers to float64 pointers
-		event.ViewportX = intToFloat64(viewportX)
-		event.ViewportY = intToFloat64(viewportY)
-		event.ScreenX = intToFloat64(screenX)
-		event.ScreenY = intToFloat64(screenY)
-		event.ScrollX = intToFloat64(scrollX)
-		event.ScrollY = intToFloat64(scrollY)
-		events = append(events, event)
+	`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired events: %w", err)
 	}
+	return tag.RowsAffected(), nil
+}
 
-	return events, nil
+// GetBySessionID returns a session's first limit events, optionally only those of
+// frame (see whereFramePath). Concurrent identical calls share one query.
+func (r *EventRepository) GetBySessionID(ctx context.Context, sessionID uuid.UUID, frame string, limit int) ([]*models.Event, error) {
+	return coalesce(ctx, &r.reads, fmt.Sprintf("events:%s:%s:%d", sessionID, frame, limit), func(ctx context.Context) ([]*models.Event, error) {
+		return r.getBySessionID(ctx, sessionID, frame, limit)
+	}, cloneEach[models.Event])
+}
+
+func (r *EventRepository) getBySessionID(ctx context.Context, sessionID uuid.UUID, frame string, limit int) ([]*models.Event, error) {
+	f := newQueryFilter().where("session_id = ?", sessionID)
+	whereFramePath(f, frame)
+	query := `
+		SELECT ` + eventColumns + `
+		FROM events
+		WHERE ` + f.clause() + `
+		ORDER BY timestamp ASC
+		LIMIT ` + f.param(limit)
+
+	rows, err := r.db.Pool.Query(ctx, query, f.values()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	defer rows.Close()
+
+	return scanEvents(rows)
 }
 
 func (r *EventRepository) GetBySessionIDPaginated(ctx context.Context, sessionID uuid.UUID, limit, offset int) ([]*models.Event, error) {
 	query := `
-		SELECT event_id, session_id, timestamp, event_type, target_element,
-			target_selector, target_tag, target_id, target_class, page_url,
-			viewport_x, viewport_y, screen_x, screen_y, scroll_x, scroll_y,
-			input_value, input_masked, key_pressed, mouse_button, click_count, event_data
+		SELECT ` + eventColumns + `
 		FROM events
 		WHERE session_id = $1
 		ORDER BY timestamp ASC
@@ -148,43 +311,170 @@ func (r *EventRepository) GetBySessionIDPaginated(ctx context.Context, sessionID
 	}
 	defer rows.Close()
 
-	var events []*models.Event
-	for rows.Next() {
-		event := &models.Event{}
-		// Scan into temporary int pointers for database INTEGER columns
-		var viewportX, viewportY, screenX, screenY, scrollX, scrollY *int
-		err := rows.Scan(
-			&event.EventID, &event.SessionID, &event.Timestamp, &event.EventType,
-			&event.TargetElement, &event.TargetSelector, &event.TargetTag,
-			&event.TargetID, &event.TargetClass, &event.PageURL,
-			&viewportX, &viewportY, &screenX, &screenY,
-			&scrollX, &scrollY, &event.InputValue, &event.InputMasked,
-			&event.KeyPressed, &event.MouseButton, &event.ClickCount, &event.EventData,
-		)
+	return scanEvents(rows)
+}
+
+// GetBySessionIDAfter returns a session's events after the (timestamp, event_id) keyset
+// position. A nil after starts from the first event; a non-empty frame keeps only that
+// frame's events.
+func (r *EventRepository) GetBySessionIDAfter(ctx context.Context, sessionID uuid.UUID, frame string, after *time.Time, afterID int64, limit int) ([]*models.Event, error) {
+	f := newQueryFilter().where("session_id = ?", sessionID)
+	if after != nil {
+		f.where("(timestamp, event_id) > (?, ?)", *after, afterID)
+	}
+	whereFramePath(f, frame)
+	query := `
+		SELECT ` + eventColumns + `
+		FROM events
+		WHERE ` + f.clause() + `
+		ORDER BY timestamp ASC, event_id ASC
+		LIMIT ` + f.param(limit)
+
+	rows, err := r.db.Pool.Query(ctx, query, f.values()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	defer rows.Close()
+
+	return scanEvents(rows)
+}
+
+// CountBySessionID counts a session's events, optionally only those of frame. When
+// the planner estimates estimateAbove rows or more, the estimate is returned instead
+// and estimated is true; estimateAbove <= 0 always counts exactly. Concurrent
+// identical calls share one query.
+func (r *EventRepository) CountBySessionID(ctx context.Context, sessionID uuid.UUID, frame string, estimateAbove int64) (int64, bool, error) {
+	result, err := coalesce(ctx, &r.reads, fmt.Sprintf("count:%s:%s:%d", sessionID, frame, estimateAbove), func(ctx context.Context) (counted, error) {
+		count, estimated, err := r.countBySessionID(ctx, sessionID, frame, estimateAbove)
+		return counted{count, estimated}, err
+	}, nil)
+	return result.count, result.estimated, err
+}
+
+func (r *EventRepository) countBySessionID(ctx context.Context, sessionID uuid.UUID, frame string, estimateAbove int64) (count int64, estimated bool, err error) {
+	f := newQueryFilter().where("session_id = ?", sessionID)
+	whereFramePath(f, frame)
+
+	if estimateAbove > 0 {
+		rows, err := r.db.estimateRows(ctx, "SELECT 1 FROM events WHERE "+f.clause(), f.values()...)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan event: %w", err)
+			return 0, false, err
+		}
+		if rows >= estimateAbove {
+			return rows, true, nil
 		}
-		// Convert int pointers to float64 pointers
-		event.ViewportX = intToFloat64(viewportX)
-		event.ViewportY = intToFloat64(viewportY)
-		event.ScreenX = intToFloat64(screenX)
-		event.ScreenY = intToFloat64(screenY)
-		event.ScrollX = intToFloat64(scrollX)
-		event.ScrollY = intToFloat64(scrollY)
-		events = append(events, event)
 	}
 
-	return events, nil
+	err = r.db.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM events WHERE "+f.clause(), f.values()...).Scan(&count)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to count events: %w", err)
+	}
+	return count, false, nil
 }
 
-func (r *EventRepository) CountBySessionID(ctx context.Context, sessionID uuid.UUID) (int64, error) {
-	var count int64
-	err := r.db.Pool.QueryRow(ctx,
-		"SELECT COUNT(*) FROM events WHERE session_id = $1",
-		sessionID,
-	).Scan(&count)
+// EventWindowFilter selects events across all sessions within a time window
+type EventWindowFilter struct {
+	From       time.Time
+	To         time.Time
+	EventTypes []string
+	PageURL    string
+	// FramePath keeps only events of that frame and the frames nested in it
+	FramePath string
+	// Sandbox, when set, keeps only events of sandbox (true) or live (false) sessions
+	Sandbox *bool
+	// AfterTimestamp/AfterEventID form the keyset cursor; zero values start from From
+	AfterTimestamp time.Time
+	AfterEventID   int64
+	Limit          int
+}
+
+// ListByTimeWindow returns events ordered by (timestamp, event_id)
+func (r *EventRepository) ListByTimeWindow(ctx context.Context, filter EventWindowFilter) ([]*models.Event, error) {
+	f := newQueryFilter().where("timestamp >= ? AND timestamp < ?", filter.From, filter.To)
+	if len(filter.EventTypes) > 0 {
+		f.where("event_type = ANY(?)", filter.EventTypes)
+	}
+	if filter.PageURL != "" {
+		f.where("page_url = ?", filter.PageURL)
+	}
+	if !filter.AfterTimestamp.IsZero() {
+		f.where("(timestamp, event_id) > (?, ?)", filter.AfterTimestamp, filter.AfterEventID)
+	}
+	if filter.Sandbox != nil {
+		f.where("session_id IN (SELECT session_id FROM sessions WHERE sandbox = ?)", *filter.Sandbox)
+	}
+	whereFramePath(f, filter.FramePath)
+	query := `
+		SELECT ` + eventColumns + `
+		FROM events
+		WHERE ` + f.clause() + `
+		ORDER BY timestamp ASC, event_id ASC
+		LIMIT ` + f.param(filter.Limit)
+
+	rows, err := r.db.Pool.Query(ctx, query, f.values()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer rows.Close()
+
+	return scanEvents(rows)
+}
+
+// IngestWindowFilter selects events in the order they were stored
+type IngestWindowFilter struct {
+	// To excludes events stored at or after it
+	To time.Time
+	// Sandbox, when set, keeps only events of sandbox (true) or live (false) sessions
+	Sandbox *bool
+	// AfterIngestedAt/AfterEventID form the keyset cursor; zero values start from the
+	// oldest event
+	AfterIngestedAt time.Time
+	AfterEventID    int64
+	Limit           int
+}
+
+// IngestedEvent is an event with the time it was stored
+type IngestedEvent struct {
+	*models.Event
+	IngestedAt time.Time
+}
+
+// ListByIngestTime returns events ordered by (ingested_at, event_id) for incremental
+// sync. Unlike the client timestamp, ingest time only moves forward, so a cursor on
+// it also picks up events that arrive late or are imported with historical
+// timestamps.
+func (r *EventRepository) ListByIngestTime(ctx context.Context, filter IngestWindowFilter) ([]IngestedEvent, error) {
+	f := newQueryFilter().where("ingested_at < ?", filter.To)
+	if !filter.AfterIngestedAt.IsZero() {
+		f.where("(ingested_at, event_id) > (?, ?)", filter.AfterIngestedAt, filter.AfterEventID)
+	}
+	if filter.Sandbox != nil {
+		f.where("session_id IN (SELECT session_id FROM sessions WHERE sandbox = ?)", *filter.Sandbox)
+	}
+	query := `
+		SELECT ` + eventColumns + `, ingested_at
+		FROM events
+		WHERE ` + f.clause() + `
+		ORDER BY ingested_at ASC, event_id ASC
+		LIMIT ` + f.param(filter.Limit)
+
+	rows, err := r.db.Pool.Query(ctx, query, f.values()...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to count events: %w", err)
+		return nil, fmt.Errorf("failed to list events: %w", err)
 	}
-	return count, nil
+	defer rows.Close()
+
+	var events []IngestedEvent
+	for rows.Next() {
+		event := IngestedEvent{Event: &models.Event{}}
+		if err := rows.Scan(append(eventDests(event.Event), &event.IngestedAt)...); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+
+	return events, nil
 }
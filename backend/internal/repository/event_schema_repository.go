@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type EventSchemaRepository struct {
+	db *Database
+}
+
+func NewEventSchemaRepository(db *Database) *EventSchemaRepository {
+	return &EventSchemaRepository{db: db}
+}
+
+// List returns the event schemas of project by event type
+func (r *EventSchemaRepository) List(ctx context.Context, project string) ([]*models.EventSchema, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT event_type, field, type, updated_at
+		FROM event_schemas
+		WHERE project = $1
+		ORDER BY event_type, field
+	`, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event schemas: %w", err)
+	}
+	defer rows.Close()
+
+	schemas := []*models.EventSchema{}
+	var current *models.EventSchema
+	for rows.Next() {
+		var eventType, field, fieldType string
+		var updatedAt time.Time
+		if err := rows.Scan(&eventType, &field, &fieldType, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event schema field: %w", err)
+		}
+		if current == nil || current.EventType != eventType {
+			current = &models.EventSchema{Project: project, EventType: eventType, Fields: make(map[string]string)}
+			schemas = append(schemas, current)
+		}
+		current.Fields[field] = fieldType
+		if updatedAt.After(current.UpdatedAt) {
+			current.UpdatedAt = updatedAt
+		}
+	}
+	return schemas, rows.Err()
+}
+
+// Put replaces the declared fields of an event type in project
+func (r *EventSchemaRepository) Put(ctx context.Context, project, eventType string, fields map[string]string) (*models.EventSchema, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM event_schemas WHERE project = $1 AND event_type = $2`, project, eventType); err != nil {
+		return nil, fmt.Errorf("failed to replace event schema: %w", err)
+	}
+
+	schema := &models.EventSchema{Project: project, EventType: eventType, Fields: fields}
+	for field, fieldType := range fields {
+		err := tx.QueryRow(ctx, `
+			INSERT INTO event_schemas (project, event_type, field, type)
+			VALUES ($1, $2, $3, $4)
+			RETURNING updated_at
+		`, project, eventType, field, fieldType).Scan(&schema.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to replace event schema: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit event schema: %w", err)
+	}
+	return schema, nil
+}
+
+// Delete removes the schema of an event type in project
+func (r *EventSchemaRepository) Delete(ctx context.Context, project, eventType string) error {
+	tag, err := r.db.Pool.Exec(ctx, `DELETE FROM event_schemas WHERE project = $1 AND event_type = $2`, project, eventType)
+	if err != nil {
+		return fmt.Errorf("failed to delete event schema: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete event schema: %w", ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type ExportRepository struct {
+	db *Database
+}
+
+func NewExportRepository(db *Database) *ExportRepository {
+	return &ExportRepository{db: db}
+}
+
+const exportJobColumns = `job_id, schedule_id, status, kind, format, range_from, range_to, role, encryption, public_key,
+	key_fingerprint, object_key, rows_exported, bytes_written, error, created_at, started_at, finished_at`
+
+func scanExportJob(row pgx.Row) (*models.ExportJob, error) {
+	job := &models.ExportJob{}
+	err := row.Scan(
+		&job.JobID, &job.ScheduleID, &job.Status, &job.Kind, &job.Format, &job.From, &job.To, &job.Role, &job.Encryption, &job.PublicKey,
+		&job.KeyFingerprint, &job.ObjectKey, &job.RowsExported, &job.BytesWritten, &job.Error, &job.CreatedAt, &job.StartedAt, &job.FinishedAt,
+	)
+	return job, err
+}
+
+// Create queues an export job; job.ScheduleID, Kind, Format, From, To, Role, Encryption,
+// PublicKey and KeyFingerprint are stored
+func (r *ExportRepository) Create(ctx context.Context, job *models.ExportJob) (*models.ExportJob, error) {
+	query := `
+		INSERT INTO export_jobs (schedule_id, kind, format, range_from, range_to, role, encryption, public_key, key_fingerprint)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING ` + exportJobColumns
+
+	created, err := scanExportJob(r.db.Pool.QueryRow(ctx, query,
+		job.ScheduleID, job.Kind, job.Format, job.From, job.To, job.Role, job.Encryption, job.PublicKey, job.KeyFingerprint,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export job: %w", err)
+	}
+	return created, nil
+}
+
+func (r *ExportRepository) GetByID(ctx context.Context, jobID uuid.UUID) (*models.ExportJob, error) {
+	query := `SELECT ` + exportJobColumns + ` FROM export_jobs WHERE job_id = $1`
+
+	job, err := scanExportJob(r.db.Pool.QueryRow(ctx, query, jobID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export job: %w", notFoundOr(err))
+	}
+	return job, nil
+}
+
+// ClaimNext marks the oldest pending job as running and returns it. Returns nil, nil
+// when no job is pending.
+func (r *ExportRepository) ClaimNext(ctx context.Context) (*models.ExportJob, error) {
+	query := `
+		UPDATE export_jobs SET status = 'running', started_at = NOW()
+		WHERE job_id = (
+			SELECT job_id FROM export_jobs
+			WHERE status = 'pending'
+			ORDER BY created_at ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + exportJobColumns
+
+	job, err := scanExportJob(r.db.Pool.QueryRow(ctx, query))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim export job: %w", err)
+	}
+	return job, nil
+}
+
+// Finish records the final status and, for completed jobs, where the bundle was written
+func (r *ExportRepository) Finish(ctx context.Context, jobID uuid.UUID, status models.ExportStatus, result models.ExportResult, jobErr *string) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE export_jobs SET status = $2, object_key = $3, rows_exported = $4, bytes_written = $5,
+			error = $6, finished_at = NOW()
+		WHERE job_id = $1
+	`, jobID, status, result.ObjectKey, result.RowsExported, result.BytesWritten, jobErr)
+	if err != nil {
+		return fmt.Errorf("failed to finish export job: %w", err)
+	}
+	return nil
+}
+
+// ListBySchedule returns a schedule's most recent runs, newest first
+func (r *ExportRepository) ListBySchedule(ctx context.Context, scheduleID uuid.UUID, limit int) ([]*models.ExportJob, error) {
+	query := `SELECT ` + exportJobColumns + `
+		FROM export_jobs
+		WHERE schedule_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2`
+
+	rows, err := r.db.Pool.Query(ctx, query, scheduleID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list export runs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []*models.ExportJob{}
+	for rows.Next() {
+		job, err := scanExportJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan export job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type ExportScheduleRepository struct {
+	db *Database
+}
+
+func NewExportScheduleRepository(db *Database) *ExportScheduleRepository {
+	return &ExportScheduleRepository{db: db}
+}
+
+const exportScheduleColumns = `schedule_id, name, cron, timezone, kind, format, window_seconds, role, encryption,
+	public_key, key_fingerprint, notify_url, enabled, next_run_at, last_run_at, last_status, consecutive_failures,
+	created_at, updated_at`
+
+func scanExportSchedule(row pgx.Row) (*models.ExportSchedule, error) {
+	s := &models.ExportSchedule{}
+	err := row.Scan(
+		&s.ScheduleID, &s.Name, &s.Cron, &s.Timezone, &s.Kind, &s.Format, &s.WindowSeconds, &s.Role, &s.Encryption,
+		&s.PublicKey, &s.KeyFingerprint, &s.NotifyURL, &s.Enabled, &s.NextRunAt, &s.LastRunAt, &s.LastStatus, &s.ConsecutiveFailures,
+		&s.CreatedAt, &s.UpdatedAt,
+	)
+	return s, err
+}
+
+func (r *ExportScheduleRepository) Create(ctx context.Context, s *models.ExportSchedule) (*models.ExportSchedule, error) {
+	query := `
+		INSERT INTO export_schedules (name, cron, timezone, kind, format, window_seconds, role, encryption,
+			public_key, key_fingerprint, notify_url, enabled, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING ` + exportScheduleColumns
+
+	created, err := scanExportSchedule(r.db.Pool.QueryRow(ctx, query,
+		s.Name, s.Cron, s.Timezone, s.Kind, s.Format, s.WindowSeconds, s.Role, s.Encryption,
+		s.PublicKey, s.KeyFingerprint, s.NotifyURL, s.Enabled, s.NextRunAt,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export schedule: %w", err)
+	}
+	return created, nil
+}
+
+func (r *ExportScheduleRepository) GetByID(ctx context.Context, scheduleID uuid.UUID) (*models.ExportSchedule, error) {
+	query := `SELECT ` + exportScheduleColumns + ` FROM export_schedules WHERE schedule_id = $1`
+
+	s, err := scanExportSchedule(r.db.Pool.QueryRow(ctx, query, scheduleID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export schedule: %w", notFoundOr(err))
+	}
+	return s, nil
+}
+
+func (r *ExportScheduleRepository) List(ctx context.Context) ([]*models.ExportSchedule, error) {
+	query := `SELECT ` + exportScheduleColumns + ` FROM export_schedules ORDER BY created_at ASC`
+	return r.query(ctx, query)
+}
+
+// ListDue returns enabled schedules whose next run is at or before now
+func (r *ExportScheduleRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]*models.ExportSchedule, error) {
+	query := `SELECT ` + exportScheduleColumns + `
+		FROM export_schedules
+		WHERE enabled AND next_run_at <= $1
+		ORDER BY next_run_at ASC
+		LIMIT $2`
+	return r.query(ctx, query, now, limit)
+}
+
+func (r *ExportScheduleRepository) query(ctx context.Context, query string, args ...interface{}) ([]*models.ExportSchedule, error) {
+	rows, err := r.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list export schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []*models.ExportSchedule{}
+	for rows.Next() {
+		s, err := scanExportSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan export schedule: %w", err)
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// Update saves the schedule's editable fields: name, cron, timezone, notify URL,
+// enabled flag and next run
+func (r *ExportScheduleRepository) Update(ctx context.Context, s *models.ExportSchedule) (*models.ExportSchedule, error) {
+	query := `
+		UPDATE export_schedules SET name = $2, cron = $3, timezone = $4, notify_url = $5, enabled = $6,
+			next_run_at = $7, updated_at = NOW()
+		WHERE schedule_id = $1
+		RETURNING ` + exportScheduleColumns
+
+	updated, err := scanExportSchedule(r.db.Pool.QueryRow(ctx, query,
+		s.ScheduleID, s.Name, s.Cron, s.Timezone, s.NotifyURL, s.Enabled, s.NextRunAt,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update export schedule: %w", notFoundOr(err))
+	}
+	return updated, nil
+}
+
+func (r *ExportScheduleRepository) Delete(ctx context.Context, scheduleID uuid.UUID) error {
+	tag, err := r.db.Pool.Exec(ctx, "DELETE FROM export_schedules WHERE schedule_id = $1", scheduleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete export schedule: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete export schedule: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// QueueRun moves the schedule from its run at runAt to nextRunAt and queues job for
+// that run, in one transaction. It returns false without queueing anything when the
+// run was already taken, e.g. by another replica's scheduler.
+func (r *ExportScheduleRepository) QueueRun(ctx context.Context, scheduleID uuid.UUID, runAt, nextRunAt time.Time, job *models.ExportJob) (bool, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE export_schedules SET next_run_at = $3, last_run_at = $2
+		WHERE schedule_id = $1 AND next_run_at = $2 AND enabled
+	`, scheduleID, runAt, nextRunAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to advance export schedule: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO export_jobs (schedule_id, kind, format, range_from, range_to, role, encryption, public_key, key_fingerprint)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, scheduleID, job.Kind, job.Format, job.From, job.To, job.Role, job.Encryption, job.PublicKey, job.KeyFingerprint)
+	if err != nil {
+		return false, fmt.Errorf("failed to queue scheduled export: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit scheduled export: %w", err)
+	}
+	return true, nil
+}
+
+// RecordResult stores the outcome of a scheduled run and returns the updated schedule;
+// consecutive_failures resets on success
+func (r *ExportScheduleRepository) RecordResult(ctx context.Context, scheduleID uuid.UUID, status models.ExportStatus) (*models.ExportSchedule, error) {
+	query := `
+		UPDATE export_schedules SET last_status = $2,
+			consecutive_failures = CASE WHEN $2 = 'failed' THEN consecutive_failures + 1 ELSE 0 END
+		WHERE schedule_id = $1
+		RETURNING ` + exportScheduleColumns
+
+	s, err := scanExportSchedule(r.db.Pool.QueryRow(ctx, query, scheduleID, status))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record export schedule result: %w", notFoundOr(err))
+	}
+	return s, nil
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type FeedRepository struct {
+	db *Database
+}
+
+func NewFeedRepository(db *Database) *FeedRepository {
+	return &FeedRepository{db: db}
+}
+
+// ProblemSessions returns the sessions with error events or rage clicks
+// (click_count >= rageClickThreshold) since since, most recent signal first, with
+// their counts and peak per-minute frustration score
+func (r *FeedRepository) ProblemSessions(ctx context.Context, since time.Time, rageClickThreshold, limit int) ([]*models.ProblemSession, error) {
+	query := `
+		WITH signals AS (
+			SELECT session_id, timestamp, event_type,
+				CASE WHEN event_type = 'error' THEN 3 ELSE 2 END AS weight,
+				CASE WHEN event_type = 'error'
+					THEN COALESCE(event_data->>'message', target_element)
+					ELSE COALESCE(target_selector, target_element)
+				END AS detail
+			FROM events
+			WHERE timestamp >= $1
+				AND (event_type = 'error' OR (event_type = 'click' AND click_count >= $2))
+		),
+		per_session AS (
+			SELECT session_id,
+				COUNT(*) FILTER (WHERE event_type = 'error') AS error_count,
+				COUNT(*) FILTER (WHERE event_type = 'click') AS rage_click_count,
+				(array_agg(detail ORDER BY timestamp) FILTER (WHERE event_type = 'error'))[1] AS first_error,
+				mode() WITHIN GROUP (ORDER BY detail) FILTER (WHERE event_type = 'click') AS top_rage_target,
+				MAX(timestamp) AS last_signal_at
+			FROM signals
+			GROUP BY session_id
+			ORDER BY last_signal_at DESC
+			LIMIT $3
+		),
+		peaks AS (
+			SELECT DISTINCT ON (session_id) session_id, minute, score
+			FROM (
+				SELECT session_id, date_trunc('minute', timestamp) AS minute, SUM(weight) AS score
+				FROM signals
+				WHERE session_id IN (SELECT session_id FROM per_session)
+				GROUP BY session_id, minute
+			) m
+			ORDER BY session_id, score DESC, minute ASC
+		)
+		SELECT s.session_id, s.user_id, s.started_at, s.page_url, s.device_type, s.browser,
+			p.last_signal_at, p.error_count, p.rage_click_count, p.first_error, p.top_rage_target,
+			pk.score, pk.minute
+		FROM per_session p
+		JOIN peaks pk ON pk.session_id = p.session_id
+		JOIN sessions s ON s.session_id = p.session_id
+		ORDER BY p.last_signal_at DESC
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, since, rageClickThreshold, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list problem sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*models.ProblemSession
+	for rows.Next() {
+		s := &models.ProblemSession{}
+		err := rows.Scan(
+			&s.SessionID, &s.UserID, &s.StartedAt, &s.PageURL, &s.DeviceType, &s.Browser,
+			&s.LastSignalAt, &s.ErrorCount, &s.RageClickCount, &s.FirstError, &s.TopRageTarget,
+			&s.PeakScore, &s.PeakAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan problem session: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type ImportRepository struct {
+	db *Database
+}
+
+func NewImportRepository(db *Database) *ImportRepository {
+	return &ImportRepository{db: db}
+}
+
+const importJobColumns = `job_id, status, source, object_key, lines_processed, lines_failed,
+	sessions_imported, events_imported, mapping_report, error, created_at, started_at, finished_at`
+
+func scanImportJob(row pgx.Row) (*models.ImportJob, error) {
+	job := &models.ImportJob{}
+	err := row.Scan(
+		&job.JobID, &job.Status, &job.Source, &job.ObjectKey, &job.LinesProcessed, &job.LinesFailed,
+		&job.SessionsImported, &job.EventsImported, &job.MappingReport, &job.Error, &job.CreatedAt, &job.StartedAt, &job.FinishedAt,
+	)
+	return job, err
+}
+
+// Create queues an import job. Exactly one of payload and objectKey should be set.
+func (r *ImportRepository) Create(ctx context.Context, source string, payload []byte, objectKey *string) (*models.ImportJob, error) {
+	query := `
+		INSERT INTO import_jobs (source, payload, object_key)
+		VALUES ($1, $2, $3)
+		RETURNING ` + importJobColumns
+
+	job, err := scanImportJob(r.db.Pool.QueryRow(ctx, query, source, payload, objectKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create import job: %w", err)
+	}
+	return job, nil
+}
+
+func (r *ImportRepository) GetByID(ctx context.Context, jobID uuid.UUID) (*models.ImportJob, error) {
+	query := `SELECT ` + importJobColumns + ` FROM import_jobs WHERE job_id = $1`
+
+	job, err := scanImportJob(r.db.Pool.QueryRow(ctx, query, jobID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import job: %w", notFoundOr(err))
+	}
+	return job, nil
+}
+
+// ClaimNext marks the oldest pending job as running and returns it with its inline
+// payload (nil for object-store imports). Returns nil, nil when no job is pending.
+func (r *ImportRepository) ClaimNext(ctx context.Context) (*models.ImportJob, []byte, error) {
+	query := `
+		UPDATE import_jobs SET status = 'running', started_at = NOW()
+		WHERE job_id = (
+			SELECT job_id FROM import_jobs
+			WHERE status = 'pending'
+			ORDER BY created_at ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + importJobColumns + `, payload`
+
+	job := &models.ImportJob{}
+	var payload []byte
+	err := r.db.Pool.QueryRow(ctx, query).Scan(
+		&job.JobID, &job.Status, &job.Source, &job.ObjectKey, &job.LinesProcessed, &job.LinesFailed,
+		&job.SessionsImported, &job.EventsImported, &job.MappingReport, &job.Error, &job.CreatedAt, &job.StartedAt, &job.FinishedAt,
+		&payload,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to claim import job: %w", err)
+	}
+	return job, payload, nil
+}
+
+// AddProgress increments the job's counters by delta
+func (r *ImportRepository) AddProgress(ctx context.Context, jobID uuid.UUID, delta models.ImportProgress) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE import_jobs SET
+			lines_processed = lines_processed + $2,
+			lines_failed = lines_failed + $3,
+			sessions_imported = sessions_imported + $4,
+			events_imported = events_imported + $5
+		WHERE job_id = $1
+	`, jobID, delta.LinesProcessed, delta.LinesFailed, delta.SessionsImported, delta.EventsImported)
+	if err != nil {
+		return fmt.Errorf("failed to update import progress: %w", err)
+	}
+	return nil
+}
+
+// SetMappingReport stores the converter's report of dropped and unmappable data
+func (r *ImportRepository) SetMappingReport(ctx context.Context, jobID uuid.UUID, report *models.MappingReport) error {
+	_, err := r.db.Pool.Exec(ctx, "UPDATE import_jobs SET mapping_report = $2 WHERE job_id = $1", jobID, report)
+	if err != nil {
+		return fmt.Errorf("failed to store mapping report: %w", err)
+	}
+	return nil
+}
+
+// Finish records the final status and drops the inline payload, which is no longer needed
+func (r *ImportRepository) Finish(ctx context.Context, jobID uuid.UUID, status models.ImportStatus, jobErr *string) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE import_jobs SET status = $2, error = $3, finished_at = NOW(), payload = NULL
+		WHERE job_id = $1
+	`, jobID, status, jobErr)
+	if err != nil {
+		return fmt.Errorf("failed to finish import job: %w", err)
+	}
+	return nil
+}
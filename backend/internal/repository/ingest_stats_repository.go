@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type IngestStatsRepository struct {
+	db *Database
+}
+
+func NewIngestStatsRepository(db *Database) *IngestStatsRepository {
+	return &IngestStatsRepository{db: db}
+}
+
+// Upsert stores the running per-stage totals of one project and hour bucket
+func (r *IngestStatsRepository) Upsert(ctx context.Context, project string, bucket time.Time, counts map[string]int64) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for stage, count := range counts {
+		batch.Queue(`
+			INSERT INTO ingest_stats (project, bucket, stage, count, updated_at)
+			VALUES ($1, $2, $3, $4, NOW())
+			ON CONFLICT (project, bucket, stage) DO UPDATE SET
+				count = EXCLUDED.count,
+				updated_at = NOW()
+		`, project, bucket, stage, count)
+	}
+
+	if err := r.db.Pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to upsert ingest stats: %w", err)
+	}
+	return nil
+}
+
+// List returns hourly per-stage counts in [from, to), oldest first. An empty
+// project returns all projects.
+func (r *IngestStatsRepository) List(ctx context.Context, project string, from, to time.Time) ([]*models.IngestStatBucket, error) {
+	f := newQueryFilter().where("bucket >= ? AND bucket < ?", from, to)
+	if project != "" {
+		f.where("project = ?", project)
+	}
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT project, bucket, stage, count
+		FROM ingest_stats
+		WHERE `+f.clause()+`
+		ORDER BY bucket ASC, project ASC
+	`, f.values()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingest stats: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := []*models.IngestStatBucket{}
+	var current *models.IngestStatBucket
+	for rows.Next() {
+		var p, stage string
+		var bucket time.Time
+		var count int64
+		if err := rows.Scan(&p, &bucket, &stage, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan ingest stat: %w", err)
+		}
+		if current == nil || current.Project != p || !current.Bucket.Equal(bucket) {
+			current = &models.IngestStatBucket{Project: p, Bucket: bucket, Stages: make(map[string]int64)}
+			buckets = append(buckets, current)
+		}
+		current.Stages[stage] = count
+	}
+
+	return buckets, nil
+}
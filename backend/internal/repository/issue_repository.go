@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type IssueRepository struct {
+	db *Database
+}
+
+func NewIssueRepository(db *Database) *IssueRepository {
+	return &IssueRepository{db: db}
+}
+
+// ListSignals returns the error events and rage clicks (click_count >= rageClickThreshold)
+// of every session with a signal stored in the (since, until] window, going back to
+// from. A session's earlier signals are included so that an error and a rage click
+// on the same page are grouped whichever window each arrived in. Windows are on
+// ingest time rather than the client timestamp, so events that sat in the queue are
+// not skipped.
+func (r *IssueRepository) ListSignals(ctx context.Context, from, since, until time.Time, rageClickThreshold int) ([]*models.IssueSignal, error) {
+	query := `
+		SELECT session_id, timestamp, event_type, page_url,
+			COALESCE(event_data->>'message', target_element) AS error_message,
+			COALESCE(target_selector, target_element) AS target_selector
+		FROM events
+		WHERE ingested_at > $1 AND ingested_at <= $3
+			AND (event_type = 'error' OR (event_type = 'click' AND click_count >= $4))
+			AND session_id IN (
+				SELECT session_id FROM events
+				WHERE ingested_at > $2 AND ingested_at <= $3
+					AND (event_type = 'error' OR (event_type = 'click' AND click_count >= $4))
+			)
+		ORDER BY timestamp ASC
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, from, since, until, rageClickThreshold)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list issue signals: %w", err)
+	}
+	defer rows.Close()
+
+	var signals []*models.IssueSignal
+	for rows.Next() {
+		signal := &models.IssueSignal{}
+		err := rows.Scan(
+			&signal.SessionID, &signal.Timestamp, &signal.EventType, &signal.PageURL,
+			&signal.ErrorMessage, &signal.TargetSelector,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan issue signal: %w", err)
+		}
+		signals = append(signals, signal)
+	}
+
+	return signals, nil
+}
+
+// RecordOccurrence upserts the issue for a fingerprint and links the session to it.
+// Recording the same session twice for an issue is a no-op, so overlapping windows
+// can be clustered again.
+func (r *IssueRepository) RecordOccurrence(ctx context.Context, issue *models.Issue, sessionID uuid.UUID, occurredAt time.Time) error {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var issueID int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO issues (fingerprint, error_message, page_url, target_selector, first_seen_at, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (fingerprint) DO UPDATE SET
+			first_seen_at = LEAST(issues.first_seen_at, EXCLUDED.first_seen_at),
+			last_seen_at = GREATEST(issues.last_seen_at, EXCLUDED.last_seen_at),
+			updated_at = NOW()
+		RETURNING issue_id
+	`, issue.Fingerprint, issue.ErrorMessage, issue.PageURL, issue.TargetSelector, occurredAt).Scan(&issueID)
+	if err != nil {
+		return fmt.Errorf("failed to upsert issue: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO issue_occurrences (issue_id, session_id, occurred_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (issue_id, session_id) DO NOTHING
+	`, issueID, sessionID, occurredAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert issue occurrence: %w", err)
+	}
+
+	if tag.RowsAffected() > 0 {
+		_, err = tx.Exec(ctx,
+			"UPDATE issues SET occurrence_count = occurrence_count + 1 WHERE issue_id = $1",
+			issueID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update occurrence count: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit issue occurrence: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveOccurrence unlinks the session from the issue with fingerprint, if it was
+// linked, and deletes the issue once no session is left. The clusterer uses it when a
+// signature it recorded is superseded by a combined one.
+func (r *IssueRepository) RemoveOccurrence(ctx context.Context, fingerprint string, sessionID uuid.UUID) error {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var issueID int64
+	err = tx.QueryRow(ctx, `
+		DELETE FROM issue_occurrences o
+		USING issues i
+		WHERE o.issue_id = i.issue_id AND i.fingerprint = $1 AND o.session_id = $2
+		RETURNING o.issue_id
+	`, fingerprint, sessionID).Scan(&issueID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete issue occurrence: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE issues SET occurrence_count = occurrence_count - 1, updated_at = NOW() WHERE issue_id = $1",
+		issueID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update occurrence count: %w", err)
+	}
+	_, err = tx.Exec(ctx, "DELETE FROM issues WHERE issue_id = $1 AND occurrence_count <= 0", issueID)
+	if err != nil {
+		return fmt.Errorf("failed to delete empty issue: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit issue occurrence removal: %w", err)
+	}
+
+	return nil
+}
+
+func (r *IssueRepository) List(ctx context.Context, limit, offset int) ([]*models.Issue, error) {
+	query := `
+		SELECT issue_id, fingerprint, error_message, page_url, target_selector,
+			first_seen_at, last_seen_at, occurrence_count
+		FROM issues
+		ORDER BY last_seen_at DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list issues: %w", err)
+	}
+	defer rows.Close()
+
+	var issues []*models.Issue
+	for rows.Next() {
+		issue := &models.Issue{}
+		err := rows.Scan(
+			&issue.IssueID, &issue.Fingerprint, &issue.ErrorMessage, &issue.PageURL,
+			&issue.TargetSelector, &issue.FirstSeenAt, &issue.LastSeenAt, &issue.OccurrenceCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan issue: %w", err)
+		}
+		issues = append(issues, issue)
+	}
+
+	return issues, nil
+}
+
+func (r *IssueRepository) GetByID(ctx context.Context, issueID int64) (*models.Issue, error) {
+	query := `
+		SELECT issue_id, fingerprint, error_message, page_url, target_selector,
+			first_seen_at, last_seen_at, occurrence_count
+		FROM issues
+		WHERE issue_id = $1
+	`
+
+	issue := &models.Issue{}
+	err := r.db.Pool.QueryRow(ctx, query, issueID).Scan(
+		&issue.IssueID, &issue.Fingerprint, &issue.ErrorMessage, &issue.PageURL,
+		&issue.TargetSelector, &issue.FirstSeenAt, &issue.LastSeenAt, &issue.OccurrenceCount,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get issue: %w", notFoundOr(err))
+	}
+
+	return issue, nil
+}
+
+// GetTrend returns daily occurrence counts for an issue over the last `days` days
+func (r *IssueRepository) GetTrend(ctx context.Context, issueID int64, days int) ([]models.TrendPoint, error) {
+	query := `
+		SELECT date_trunc('day', occurred_at) AS bucket, COUNT(*)
+		FROM issue_occurrences
+		WHERE issue_id = $1 AND occurred_at >= NOW() - make_interval(days => $2)
+		GROUP BY bucket
+		ORDER BY bucket ASC
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, issueID, days)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get issue trend: %w", err)
+	}
+	defer rows.Close()
+
+	var trend []models.TrendPoint
+	for rows.Next() {
+		var point models.TrendPoint
+		if err := rows.Scan(&point.Bucket, &point.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan trend point: %w", err)
+		}
+		trend = append(trend, point)
+	}
+
+	return trend, nil
+}
+
+// ListSessionIDs returns the most recent sessions affected by an issue
+func (r *IssueRepository) ListSessionIDs(ctx context.Context, issueID int64, limit int) ([]uuid.UUID, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT session_id
+		FROM issue_occurrences
+		WHERE issue_id = $1
+		ORDER BY occurred_at DESC
+		LIMIT $2
+	`, issueID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list issue sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessionIDs []uuid.UUID
+	for rows.Next() {
+		var sessionID uuid.UUID
+		if err := rows.Scan(&sessionID); err != nil {
+			return nil, fmt.Errorf("failed to scan issue session: %w", err)
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+
+	return sessionIDs, nil
+}
+
+func (r *IssueRepository) Count(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM issues").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count issues: %w", err)
+	}
+	return count, nil
+}
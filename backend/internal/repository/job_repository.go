@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type JobRepository struct {
+	db *Database
+}
+
+func NewJobRepository(db *Database) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+const jobColumns = `job_id, type, status, payload, progress_done, progress_total, result, error,
+	attempts, max_attempts, run_after, created_at, started_at, updated_at, finished_at`
+
+func scanJob(row pgx.Row) (*models.Job, error) {
+	job := &models.Job{}
+	var payload, result []byte
+	err := row.Scan(
+		&job.JobID, &job.Type, &job.Status, &payload, &job.Progress.Done, &job.Progress.Total, &result, &job.Error,
+		&job.Attempts, &job.MaxAttempts, &job.RunAfter, &job.CreatedAt, &job.StartedAt, &job.UpdatedAt, &job.FinishedAt,
+	)
+	job.Payload, job.Result = payload, result
+	return job, err
+}
+
+// Create inserts a pending job marked as queued now; the caller sends its stream message
+func (r *JobRepository) Create(ctx context.Context, jobType string, payload json.RawMessage, maxAttempts int) (*models.Job, error) {
+	query := `
+		INSERT INTO jobs (type, payload, max_attempts, queued_at)
+		VALUES ($1, $2, $3, NOW())
+		RETURNING ` + jobColumns
+
+	job, err := scanJob(r.db.Pool.QueryRow(ctx, query, jobType, []byte(payload), maxAttempts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+	return job, nil
+}
+
+func (r *JobRepository) GetByID(ctx context.Context, jobID uuid.UUID) (*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE job_id = $1`
+
+	job, err := scanJob(r.db.Pool.QueryRow(ctx, query, jobID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", notFoundOr(err))
+	}
+	return job, nil
+}
+
+// Claim marks a pending, due job as running and counts the attempt. It returns nil,
+// nil when the job is not claimable, e.g. a duplicate stream message for a job another
+// runner already took.
+func (r *JobRepository) Claim(ctx context.Context, jobID uuid.UUID) (*models.Job, error) {
+	query := `
+		UPDATE jobs SET status = 'running', attempts = attempts + 1, started_at = NOW(), updated_at = NOW()
+		WHERE job_id = $1 AND status = 'pending' AND run_after <= NOW()
+		RETURNING ` + jobColumns
+
+	job, err := scanJob(r.db.Pool.QueryRow(ctx, query, jobID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	return job, nil
+}
+
+// SetProgress records progress and doubles as the running job's heartbeat
+func (r *JobRepository) SetProgress(ctx context.Context, jobID uuid.UUID, done int64, total *int64) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE jobs SET progress_done = $2, progress_total = COALESCE($3, progress_total), updated_at = NOW()
+		WHERE job_id = $1
+	`, jobID, done, total)
+	if err != nil {
+		return fmt.Errorf("failed to update job progress: %w", err)
+	}
+	return nil
+}
+
+// Heartbeat marks a running job as alive without changing its progress
+func (r *JobRepository) Heartbeat(ctx context.Context, jobID uuid.UUID) error {
+	_, err := r.db.Pool.Exec(ctx, "UPDATE jobs SET updated_at = NOW() WHERE job_id = $1 AND status = 'running'", jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update job heartbeat: %w", err)
+	}
+	return nil
+}
+
+// Release returns a running job to pending without counting the attempt, for jobs
+// interrupted by a runner shutting down
+func (r *JobRepository) Release(ctx context.Context, jobID uuid.UUID) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE jobs SET status = 'pending', attempts = GREATEST(attempts - 1, 0), queued_at = NULL, run_after = NOW(), updated_at = NOW()
+		WHERE job_id = $1 AND status = 'running'
+	`, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to release job: %w", err)
+	}
+	return nil
+}
+
+// Complete marks a job completed with its result
+func (r *JobRepository) Complete(ctx context.Context, jobID uuid.UUID, result json.RawMessage) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE jobs SET status = 'completed', result = $2, error = NULL, updated_at = NOW(), finished_at = NOW()
+		WHERE job_id = $1
+	`, jobID, []byte(result))
+	if err != nil {
+		return fmt.Errorf("failed to complete job: %w", err)
+	}
+	return nil
+}
+
+// Fail records a failed attempt. With attempts left the job returns to pending and
+// becomes due after retryAfter; otherwise it is marked failed.
+func (r *JobRepository) Fail(ctx context.Context, jobID uuid.UUID, jobErr string, retryAfter time.Duration) (models.JobStatus, error) {
+	var status models.JobStatus
+	err := r.db.Pool.QueryRow(ctx, `
+		UPDATE jobs SET
+			status = CASE WHEN attempts < max_attempts THEN 'pending' ELSE 'failed' END,
+			run_after = NOW() + $3 * INTERVAL '1 millisecond',
+			queued_at = NULL,
+			error = $2,
+			updated_at = NOW(),
+			finished_at = CASE WHEN attempts < max_attempts THEN NULL ELSE NOW() END
+		WHERE job_id = $1
+		RETURNING status
+	`, jobID, jobErr, retryAfter.Milliseconds()).Scan(&status)
+	if err != nil {
+		return "", fmt.Errorf("failed to record job failure: %w", err)
+	}
+	return status, nil
+}
+
+// RequeueStale returns running jobs without a heartbeat for staleAfter to pending, so
+// jobs of a crashed runner are picked up again
+func (r *JobRepository) RequeueStale(ctx context.Context, staleAfter time.Duration) (int64, error) {
+	tag, err := r.db.Pool.Exec(ctx, `
+		UPDATE jobs SET status = 'pending', queued_at = NULL, run_after = NOW()
+		WHERE status = 'running' AND updated_at < NOW() - $1 * INTERVAL '1 millisecond'
+	`, staleAfter.Milliseconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue stale jobs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// MarkDue returns the IDs of due pending jobs that have no stream message, or whose
+// message was sent more than resendAfter ago, and marks them queued now
+func (r *JobRepository) MarkDue(ctx context.Context, resendAfter time.Duration, limit int) ([]uuid.UUID, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		UPDATE jobs SET queued_at = NOW()
+		WHERE job_id IN (
+			SELECT job_id FROM jobs
+			WHERE status = 'pending' AND run_after <= NOW()
+				AND (queued_at IS NULL OR queued_at < NOW() - $1 * INTERVAL '1 millisecond')
+			ORDER BY run_after ASC
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING job_id
+	`, resendAfter.Milliseconds(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark due jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan job ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type LinkRepository struct {
+	db *Database
+}
+
+func NewLinkRepository(db *Database) *LinkRepository {
+	return &LinkRepository{db: db}
+}
+
+const sessionLinkColumns = `link_id, session_id, link_type, external_id, url, created_at`
+
+func scanSessionLink(row pgx.Row) (*models.SessionLink, error) {
+	link := &models.SessionLink{}
+	err := row.Scan(&link.LinkID, &link.SessionID, &link.Type, &link.ExternalID, &link.URL, &link.CreatedAt)
+	return link, err
+}
+
+func collectSessionLinks(rows pgx.Rows) ([]*models.SessionLink, error) {
+	defer rows.Close()
+
+	links := []*models.SessionLink{}
+	for rows.Next() {
+		link, err := scanSessionLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session link: %w", err)
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// Create links the session to an external reference. Linking the same reference
+// again updates its URL. It reports whether the link is new; ErrNotFound means the
+// session does not exist.
+func (r *LinkRepository) Create(ctx context.Context, sessionID uuid.UUID, req *models.CreateSessionLinkRequest) (*models.SessionLink, bool, error) {
+	query := `
+		INSERT INTO session_links AS l (session_id, link_type, external_id, url)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (session_id, link_type, external_id) DO UPDATE SET
+			url = COALESCE(EXCLUDED.url, l.url)
+		RETURNING ` + sessionLinkColumns + `, (xmax = 0)`
+
+	link := &models.SessionLink{}
+	var created bool
+	err := r.db.Pool.QueryRow(ctx, query, sessionID, req.Type, req.ExternalID, req.URL).Scan(
+		&link.LinkID, &link.SessionID, &link.Type, &link.ExternalID, &link.URL, &link.CreatedAt, &created,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create session link: %w", missingParentOr(err))
+	}
+	return link, created, nil
+}
+
+// ListBySession returns a session's links, oldest first
+func (r *LinkRepository) ListBySession(ctx context.Context, sessionID uuid.UUID) ([]*models.SessionLink, error) {
+	rows, err := r.db.Pool.Query(ctx,
+		`SELECT `+sessionLinkColumns+` FROM session_links WHERE session_id = $1 ORDER BY created_at ASC`,
+		sessionID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list session links: %w", err)
+	}
+	return collectSessionLinks(rows)
+}
+
+// ListByExternal returns the links to an external reference, newest first
+func (r *LinkRepository) ListByExternal(ctx context.Context, linkType, externalID string, limit int) ([]*models.SessionLink, error) {
+	rows, err := r.db.Pool.Query(ctx,
+		`SELECT `+sessionLinkColumns+` FROM session_links
+		WHERE link_type = $1 AND external_id = $2
+		ORDER BY created_at DESC
+		LIMIT $3`,
+		linkType, externalID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up session links: %w", err)
+	}
+	return collectSessionLinks(rows)
+}
+
+// Delete removes one of the session's links
+func (r *LinkRepository) Delete(ctx context.Context, sessionID uuid.UUID, linkID int64) error {
+	tag, err := r.db.Pool.Exec(ctx, "DELETE FROM session_links WHERE session_id = $1 AND link_id = $2", sessionID, linkID)
+	if err != nil {
+		return fmt.Errorf("failed to delete session link: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete session link: %w", ErrNotFound)
+	}
+	return nil
+}
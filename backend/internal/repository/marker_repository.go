@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type MarkerRepository struct {
+	db *Database
+}
+
+func NewMarkerRepository(db *Database) *MarkerRepository {
+	return &MarkerRepository{db: db}
+}
+
+func (r *MarkerRepository) Create(ctx context.Context, req *models.CreateMarkerRequest) (*models.Marker, error) {
+	timestamp := time.Now()
+	if req.Timestamp != nil {
+		timestamp = *req.Timestamp
+	}
+
+	query := `
+		INSERT INTO markers (project, kind, version, description, timestamp, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING marker_id, created_at
+	`
+
+	marker := &models.Marker{
+		Project:     req.Project,
+		Kind:        req.Kind,
+		Version:     req.Version,
+		Description: req.Description,
+		Timestamp:   timestamp,
+		Metadata:    req.Metadata,
+	}
+
+	err := r.db.Pool.QueryRow(ctx, query,
+		req.Project, req.Kind, req.Version, req.Description, timestamp, req.Metadata,
+	).Scan(&marker.MarkerID, &marker.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create marker: %w", err)
+	}
+
+	return marker, nil
+}
+
+// ListBetween returns markers in [from, to]; an empty project matches all projects
+func (r *MarkerRepository) ListBetween(ctx context.Context, project string, from, to time.Time) ([]*models.Marker, error) {
+	f := newQueryFilter().where("timestamp BETWEEN ? AND ?", from, to)
+	if project != "" {
+		f.where("project = ?", project)
+	}
+	query := `
+		SELECT marker_id, project, kind, version, description, timestamp, metadata, created_at
+		FROM markers
+		WHERE ` + f.clause() + `
+		ORDER BY timestamp ASC
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, f.values()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list markers: %w", err)
+	}
+	defer rows.Close()
+
+	var markers []*models.Marker
+	for rows.Next() {
+		marker := &models.Marker{}
+		err := rows.Scan(
+			&marker.MarkerID, &marker.Project, &marker.Kind, &marker.Version,
+			&marker.Description, &marker.Timestamp, &marker.Metadata, &marker.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan marker: %w", err)
+		}
+		markers = append(markers, marker)
+	}
+
+	return markers, nil
+}
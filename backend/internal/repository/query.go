@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"strconv"
+	"strings"
+)
+
+// queryFilter builds the WHERE conditions of queries whose filters are optional.
+// Values are always bound as numbered parameters and never written into the SQL, so
+// only condition text from code (column names, operators) may be concatenated.
+type queryFilter struct {
+	conditions []string
+	args       []interface{}
+}
+
+// newQueryFilter starts a filter after args, the parameters the rest of the query
+// already uses as $1..$n
+func newQueryFilter(args ...interface{}) *queryFilter {
+	return &queryFilter{args: args}
+}
+
+// param binds value and returns its placeholder, for use outside the WHERE clause
+// (e.g. LIMIT)
+func (f *queryFilter) param(value interface{}) string {
+	f.args = append(f.args, value)
+	return "$" + strconv.Itoa(len(f.args))
+}
+
+// where adds a condition, ANDed with the others. Each "?" in condition is bound to the
+// next of values; write "??" for a literal "?" such as the jsonb operator. It panics
+// when the placeholders and values do not match, which is a programming error.
+func (f *queryFilter) where(condition string, values ...interface{}) *queryFilter {
+	var b strings.Builder
+	next := 0
+	for i := 0; i < len(condition); i++ {
+		if condition[i] != '?' {
+			b.WriteByte(condition[i])
+			continue
+		}
+		if i+1 < len(condition) && condition[i+1] == '?' {
+			b.WriteByte('?')
+			i++
+			continue
+		}
+		if next == len(values) {
+			panic("queryFilter: more placeholders than values in " + condition)
+		}
+		b.WriteString(f.param(values[next]))
+		next++
+	}
+	if next != len(values) {
+		panic("queryFilter: more values than placeholders in " + condition)
+	}
+
+	f.conditions = append(f.conditions, b.String())
+	return f
+}
+
+// clause returns the conditions joined with AND, or TRUE when there are none, so it
+// can always follow WHERE or AND
+func (f *queryFilter) clause() string {
+	if len(f.conditions) == 0 {
+		return "TRUE"
+	}
+	return "(" + strings.Join(f.conditions, ") AND (") + ")"
+}
+
+// values returns the bound parameters in placeholder order
+func (f *queryFilter) values() []interface{} {
+	return f.args
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQueryFilterNumbersPlaceholders(t *testing.T) {
+	f := newQueryFilter().
+		where("timestamp >= ? AND timestamp < ?", 1, 2).
+		where("page_url = ?", "https://example.com/?q='x'")
+	limit := f.param(50)
+
+	if got, want := f.clause(), "(timestamp >= $1 AND timestamp < $2) AND (page_url = $3)"; got != want {
+		t.Errorf("clause() = %q, want %q", got, want)
+	}
+	if limit != "$4" {
+		t.Errorf("param() = %q, want $4", limit)
+	}
+	want := []interface{}{1, 2, "https://example.com/?q='x'", 50}
+	if got := f.values(); !reflect.DeepEqual(got, want) {
+		t.Errorf("values() = %v, want %v", got, want)
+	}
+}
+
+func TestQueryFilterContinuesAfterQueryArgs(t *testing.T) {
+	f := newQueryFilter(true, "at").where("session_id = ?", "id")
+
+	if got, want := f.clause(), "(session_id = $3)"; got != want {
+		t.Errorf("clause() = %q, want %q", got, want)
+	}
+	if got := len(f.values()); got != 3 {
+		t.Errorf("len(values()) = %d, want 3", got)
+	}
+}
+
+func TestQueryFilterEmpty(t *testing.T) {
+	f := newQueryFilter()
+	if got := f.clause(); got != "TRUE" {
+		t.Errorf("clause() = %q, want TRUE", got)
+	}
+	if got := f.values(); len(got) != 0 {
+		t.Errorf("values() = %v, want none", got)
+	}
+}
+
+func TestQueryFilterEscapedQuestionMark(t *testing.T) {
+	f := newQueryFilter().where("event_data ?? ?", "key")
+	if got, want := f.clause(), "(event_data ? $1)"; got != want {
+		t.Errorf("clause() = %q, want %q", got, want)
+	}
+}
+
+func TestQueryFilterPanicsOnMismatch(t *testing.T) {
+	for name, fn := range map[string]func(){
+		"missing value": func() { newQueryFilter().where("a = ? AND b = ?", 1) },
+		"extra value":   func() { newQueryFilter().where("a = ?", 1, 2) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: where did not panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestWhereFramePath(t *testing.T) {
+	tests := []struct {
+		frame  string
+		clause string
+		values []interface{}
+	}{
+		{"", "TRUE", nil},
+		{"main", "(frame_path IS NULL OR frame_path = $1 OR starts_with(frame_path, $2))", []interface{}{"main", "main>"}},
+		{"main>iframe#pay_1", "(frame_path = $1 OR starts_with(frame_path, $2))", []interface{}{"main>iframe#pay_1", "main>iframe#pay_1>"}},
+	}
+
+	for _, tt := range tests {
+		f := newQueryFilter()
+		whereFramePath(f, tt.frame)
+		if got := f.clause(); got != tt.clause {
+			t.Errorf("frame %q: clause() = %q, want %q", tt.frame, got, tt.clause)
+		}
+		if got := f.values(); len(got) != len(tt.values) || (len(got) > 0 && !reflect.DeepEqual(got, tt.values)) {
+			t.Errorf("frame %q: values() = %v, want %v", tt.frame, got, tt.values)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// Recomputed reports what RecomputeSession rebuilt for one session
+type Recomputed struct {
+	SessionID       uuid.UUID `json:"session_id"`
+	StartedAt       time.Time `json:"started_at"`
+	Events          int       `json:"events"`
+	LastActivityAt  time.Time `json:"last_activity_at"`
+	ViewportChanges int       `json:"viewport_changes"`
+	// NormalizedEvents is the number of events whose norm_x/norm_y changed
+	NormalizedEvents int64 `json:"normalized_events"`
+	StatsRefreshed   bool  `json:"stats_refreshed"`
+}
+
+// RecomputeSession rebuilds the data the write path derives from a session's raw
+// events, as if they were ingested again with the current code: last_activity_at,
+// viewport_history and every event's norm_x/norm_y. It returns ErrNotFound when the
+// session does not exist.
+func (r *EventRepository) RecomputeSession(ctx context.Context, sessionID uuid.UUID) (*Recomputed, error) {
+	var startedAt time.Time
+	var initial models.Viewport
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT started_at, COALESCE(viewport_width, 0), COALESCE(viewport_height, 0)
+		FROM sessions WHERE session_id = $1
+	`, sessionID).Scan(&startedAt, &initial.Width, &initial.Height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", notFoundOr(err))
+	}
+
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT event_id, timestamp, event_type, viewport_x::float8, viewport_y::float8, event_data
+		FROM events
+		WHERE session_id = $1
+		ORDER BY timestamp ASC, event_id ASC
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
+	var ids []int64
+	var events []models.EventData
+	for rows.Next() {
+		var id int64
+		var event models.EventData
+		if err := rows.Scan(&id, &event.Timestamp, &event.EventType, &event.ViewportX, &event.ViewportY, &event.EventData); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		ids = append(ids, id)
+		events = append(events, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+
+	result := &Recomputed{SessionID: sessionID, StartedAt: startedAt, Events: len(events), LastActivityAt: startedAt}
+	for _, event := range events {
+		if event.Timestamp.After(result.LastActivityAt) {
+			result.LastActivityAt = event.Timestamp
+		}
+	}
+
+	models.NormalizeCoordinates(events, initial)
+	changes := models.ViewportChanges(events)
+	if len(changes) > maxViewportHistory {
+		changes = changes[len(changes)-maxViewportHistory:]
+	}
+	if changes == nil {
+		changes = []models.ViewportChange{}
+	}
+	result.ViewportChanges = len(changes)
+
+	batch := &pgx.Batch{}
+	batch.Queue(`
+		UPDATE sessions
+		SET last_activity_at = $2, viewport_history = $3::jsonb, updated_at = NOW()
+		WHERE session_id = $1
+	`, sessionID, result.LastActivityAt, changes)
+	// Only rows whose value changes are written, so recomputing is cheap when nothing did
+	for i, event := range events {
+		batch.Queue(`
+			UPDATE events SET norm_x = $4, norm_y = $5
+			WHERE session_id = $1 AND event_id = $2 AND timestamp = $3
+				AND (norm_x::float8 IS DISTINCT FROM $4::float8 OR norm_y::float8 IS DISTINCT FROM $5::float8)
+		`, sessionID, ids[i], event.Timestamp, event.NormX, event.NormY)
+	}
+
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	br := tx.SendBatch(ctx, batch)
+	if _, err := br.Exec(); err != nil {
+		br.Close()
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+	for range events {
+		tag, err := br.Exec()
+		if err != nil {
+			br.Close()
+			return nil, fmt.Errorf("failed to update normalized coordinates: %w", err)
+		}
+		result.NormalizedEvents += tag.RowsAffected()
+	}
+	if err := br.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close batch: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit recompute: %w", err)
+	}
+
+	return result, nil
+}
+
+// RefreshSessionStats refreshes the session_stats continuous aggregate for the hour
+// bucket containing startedAt. It cannot run inside a transaction.
+func (r *EventRepository) RefreshSessionStats(ctx context.Context, startedAt time.Time) error {
+	bucket := startedAt.UTC().Truncate(time.Hour)
+	_, err := r.db.Pool.Exec(ctx, "CALL refresh_continuous_aggregate('session_stats', $1::timestamptz, $2::timestamptz)",
+		bucket, bucket.Add(time.Hour))
+	if err != nil {
+		return fmt.Errorf("failed to refresh session stats: %w", err)
+	}
+	return nil
+}
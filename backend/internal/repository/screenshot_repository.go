@@ -5,17 +5,28 @@ import (
 	"encoding/base64"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/imagecheck"
+	"github.com/ngocp/user-tracker/internal/malware"
 	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/storage"
 )
 
 type ScreenshotRepository struct {
-	db *Database
+	db          *Database
+	store       storage.Store
+	imageLimits imagecheck.Limits
+	scanGuard   *malware.Guard
 }
 
-func NewScreenshotRepository(db *Database) *ScreenshotRepository {
-	return &ScreenshotRepository{db: db}
+// NewScreenshotRepository creates the repository. When store is non-nil new screenshots
+// are written to blob storage; rows still holding image_data are read transparently.
+// Uploads are validated against imageLimits and, with a non-nil scanGuard, scanned
+// for malware before they are stored.
+func NewScreenshotRepository(db *Database, store storage.Store, imageLimits imagecheck.Limits, scanGuard *malware.Guard) *ScreenshotRepository {
+	return &ScreenshotRepository{db: db, store: store, imageLimits: imageLimits, scanGuard: scanGuard}
 }
 
 func (r *ScreenshotRepository) Create(ctx context.Context, req *models.UploadScreenshotRequest) (*models.Screenshot, error) {
@@ -24,17 +35,51 @@ func (r *ScreenshotRepository) Create(ctx context.Context, req *models.UploadScr
 		return nil, fmt.Errorf("invalid session ID: %w", err)
 	}
 
+	// Refuse screenshots of unknown sessions before the image is scanned and stored;
+	// the sessions foreign key still catches a session deleted in the meantime
+	var exists bool
+	if err := r.db.Pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM sessions WHERE session_id = $1)", sessionID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check session: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("session %s does not exist: %w", sessionID, ErrNotFound)
+	}
+
 	// Decode base64 image data
-	imageData, format, err := decodeImageData(req.ImageData)
+	imageData, declaredFormat, err := decodeImageData(req.ImageData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image data: %w", err)
 	}
 
+	// Trust the image header, not the client, for format and dimensions
+	info, err := imagecheck.Validate(imageData, declaredFormat, r.imageLimits)
+	if err != nil {
+		return nil, err
+	}
+	format := info.Format
+	width, height := info.Width, info.Height
+
+	if err := r.scanGuard.Check(ctx, imageData, "image/"+format, "screenshot for session "+sessionID.String()); err != nil {
+		return nil, err
+	}
+
 	fileSize := len(imageData)
 
+	// With blob storage enabled the bytes go to the store and the row keeps the key
+	var storageKey *string
+	dbImageData := imageData
+	if r.store != nil {
+		key := ScreenshotStorageKey(sessionID, uuid.New().String(), format)
+		if err := r.store.Put(ctx, key, imageData, "image/"+format); err != nil {
+			return nil, fmt.Errorf("failed to store screenshot: %w", err)
+		}
+		storageKey = &key
+		dbImageData = nil
+	}
+
 	query := `
-		INSERT INTO screenshots (session_id, page_url, timestamp, image_data, image_format, image_width, image_height, file_size)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO screenshots (session_id, page_url, timestamp, image_data, storage_key, image_format, image_width, image_height, file_size)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING screenshot_id, created_at
 	`
 
@@ -43,19 +88,23 @@ func (r *ScreenshotRepository) Create(ctx context.Context, req *models.UploadScr
 		PageURL:     req.PageURL,
 		Timestamp:   req.Timestamp,
 		ImageData:   imageData,
+		StorageKey:  storageKey,
 		ImageFormat: format,
-		ImageWidth:  req.Width,
-		ImageHeight: req.Height,
+		ImageWidth:  &width,
+		ImageHeight: &height,
 		FileSize:    &fileSize,
 	}
 
 	err = r.db.Pool.QueryRow(ctx, query,
-		sessionID, req.PageURL, req.Timestamp, imageData, format,
-		req.Width, req.Height, fileSize,
+		sessionID, req.PageURL, req.Timestamp, dbImageData, storageKey, format,
+		width, height, fileSize,
 	).Scan(&screenshot.ScreenshotID, &screenshot.CreatedAt)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to create screenshot: %w", err)
+		if storageKey != nil {
+			r.store.Delete(ctx, *storageKey)
+		}
+		return nil, fmt.Errorf("failed to create screenshot: %w", missingParentOr(err))
 	}
 
 	return screenshot, nil
@@ -63,7 +112,7 @@ func (r *ScreenshotRepository) Create(ctx context.Context, req *models.UploadScr
 
 func (r *ScreenshotRepository) GetByID(ctx context.Context, screenshotID int64) (*models.Screenshot, error) {
 	query := `
-		SELECT screenshot_id, session_id, page_url, timestamp, image_data,
+		SELECT screenshot_id, session_id, page_url, timestamp, image_data, storage_key,
 			image_format, image_width, image_height, file_size, created_at
 		FROM screenshots
 		WHERE screenshot_id = $1
@@ -72,13 +121,79 @@ func (r *ScreenshotRepository) GetByID(ctx context.Context, screenshotID int64)
 	screenshot := &models.Screenshot{}
 	err := r.db.Pool.QueryRow(ctx, query, screenshotID).Scan(
 		&screenshot.ScreenshotID, &screenshot.SessionID, &screenshot.PageURL,
-		&screenshot.Timestamp, &screenshot.ImageData, &screenshot.ImageFormat,
-		&screenshot.ImageWidth, &screenshot.ImageHeight, &screenshot.FileSize,
-		&screenshot.CreatedAt,
+		&screenshot.Timestamp, &screenshot.ImageData, &screenshot.StorageKey,
+		&screenshot.ImageFormat, &screenshot.ImageWidth, &screenshot.ImageHeight,
+		&screenshot.FileSize, &screenshot.CreatedAt,
 	)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to get screenshot: %w", err)
+		return nil, fmt.Errorf("failed to get screenshot: %w", notFoundOr(err))
+	}
+
+	if err := r.loadImageData(ctx, screenshot); err != nil {
+		return nil, err
+	}
+
+	return screenshot, nil
+}
+
+// GetMetadataByID returns a screenshot without loading its image bytes
+func (r *ScreenshotRepository) GetMetadataByID(ctx context.Context, screenshotID int64) (*models.Screenshot, error) {
+	query := `
+		SELECT screenshot_id, session_id, page_url, timestamp, storage_key,
+			image_format, image_width, image_height, file_size, created_at
+		FROM screenshots
+		WHERE screenshot_id = $1
+	`
+
+	screenshot := &models.Screenshot{}
+	err := r.db.Pool.QueryRow(ctx, query, screenshotID).Scan(
+		&screenshot.ScreenshotID, &screenshot.SessionID, &screenshot.PageURL,
+		&screenshot.Timestamp, &screenshot.StorageKey,
+		&screenshot.ImageFormat, &screenshot.ImageWidth, &screenshot.ImageHeight,
+		&screenshot.FileSize, &screenshot.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get screenshot: %w", notFoundOr(err))
+	}
+
+	return screenshot, nil
+}
+
+// GetNearest returns the session's screenshot closest in time to at, optionally limited
+// to one page_url. Image bytes are only loaded when withData is set.
+func (r *ScreenshotRepository) GetNearest(ctx context.Context, sessionID uuid.UUID, at time.Time, pageURL string, withData bool) (*models.Screenshot, error) {
+	f := newQueryFilter(withData, at).where("session_id = ?", sessionID)
+	if pageURL != "" {
+		f.where("page_url = ?", pageURL)
+	}
+	query := `
+		SELECT screenshot_id, session_id, page_url, timestamp,
+			CASE WHEN $1 THEN image_data END, storage_key,
+			image_format, image_width, image_height, file_size, created_at
+		FROM screenshots
+		WHERE ` + f.clause() + `
+		ORDER BY ABS(EXTRACT(EPOCH FROM (timestamp - $2::timestamptz))) ASC, timestamp DESC
+		LIMIT 1
+	`
+
+	screenshot := &models.Screenshot{}
+	err := r.db.Pool.QueryRow(ctx, query, f.values()...).Scan(
+		&screenshot.ScreenshotID, &screenshot.SessionID, &screenshot.PageURL,
+		&screenshot.Timestamp, &screenshot.ImageData, &screenshot.StorageKey,
+		&screenshot.ImageFormat, &screenshot.ImageWidth, &screenshot.ImageHeight,
+		&screenshot.FileSize, &screenshot.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nearest screenshot: %w", notFoundOr(err))
+	}
+
+	if withData {
+		if err := r.loadImageData(ctx, screenshot); err != nil {
+			return nil, err
+		}
 	}
 
 	return screenshot, nil
@@ -118,7 +233,7 @@ func (r *ScreenshotRepository) GetBySessionID(ctx context.Context, sessionID uui
 
 func (r *ScreenshotRepository) GetBySessionIDWithData(ctx context.Context, sessionID uuid.UUID) ([]*models.Screenshot, error) {
 	query := `
-		SELECT screenshot_id, session_id, page_url, timestamp, image_data,
+		SELECT screenshot_id, session_id, page_url, timestamp, image_data, storage_key,
 			image_format, image_width, image_height, file_size, created_at
 		FROM screenshots
 		WHERE session_id = $1
@@ -136,9 +251,48 @@ func (r *ScreenshotRepository) GetBySessionIDWithData(ctx context.Context, sessi
 		screenshot := &models.Screenshot{}
 		err := rows.Scan(
 			&screenshot.ScreenshotID, &screenshot.SessionID, &screenshot.PageURL,
-			&screenshot.Timestamp, &screenshot.ImageData, &screenshot.ImageFormat,
-			&screenshot.ImageWidth, &screenshot.ImageHeight, &screenshot.FileSize,
-			&screenshot.CreatedAt,
+			&screenshot.Timestamp, &screenshot.ImageData, &screenshot.StorageKey,
+			&screenshot.ImageFormat, &screenshot.ImageWidth, &screenshot.ImageHeight,
+			&screenshot.FileSize, &screenshot.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan screenshot: %w", err)
+		}
+		screenshots = append(screenshots, screenshot)
+	}
+	rows.Close()
+
+	for _, screenshot := range screenshots {
+		if err := r.loadImageData(ctx, screenshot); err != nil {
+			return nil, err
+		}
+	}
+
+	return screenshots, nil
+}
+
+// ListUnmigrated returns screenshots still stored in the database with IDs above afterID
+func (r *ScreenshotRepository) ListUnmigrated(ctx context.Context, afterID int64, limit int) ([]*models.Screenshot, error) {
+	query := `
+		SELECT screenshot_id, session_id, image_data, image_format
+		FROM screenshots
+		WHERE storage_key IS NULL AND image_data IS NOT NULL AND screenshot_id > $1
+		ORDER BY screenshot_id ASC
+		LIMIT $2
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unmigrated screenshots: %w", err)
+	}
+	defer rows.Close()
+
+	var screenshots []*models.Screenshot
+	for rows.Next() {
+		screenshot := &models.Screenshot{}
+		err := rows.Scan(
+			&screenshot.ScreenshotID, &screenshot.SessionID,
+			&screenshot.ImageData, &screenshot.ImageFormat,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan screenshot: %w", err)
@@ -149,26 +303,91 @@ func (r *ScreenshotRepository) GetBySessionIDWithData(ctx context.Context, sessi
 	return screenshots, nil
 }
 
-// decodeImageData decodes base64 image data and returns the raw bytes and format
+// MarkMigrated points a row at its blob and drops the in-database copy.
+// It returns false if the row was already migrated by someone else.
+func (r *ScreenshotRepository) MarkMigrated(ctx context.Context, screenshotID int64, storageKey string) (bool, error) {
+	tag, err := r.db.Pool.Exec(ctx, `
+		UPDATE screenshots
+		SET storage_key = $2, image_data = NULL
+		WHERE screenshot_id = $1 AND storage_key IS NULL
+	`, screenshotID, storageKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark screenshot migrated: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// loadImageData fetches the bytes from blob storage for rows that no longer hold them
+func (r *ScreenshotRepository) loadImageData(ctx context.Context, screenshot *models.Screenshot) error {
+	if screenshot.ImageData != nil || screenshot.StorageKey == nil {
+		return nil
+	}
+	if r.store == nil {
+		return fmt.Errorf("screenshot %d is in blob storage but no store is configured", screenshot.ScreenshotID)
+	}
+
+	data, err := r.store.Get(ctx, *screenshot.StorageKey)
+	if err != nil {
+		return fmt.Errorf("failed to load screenshot %d from blob storage: %w", screenshot.ScreenshotID, err)
+	}
+	screenshot.ImageData = data
+	return nil
+}
+
+// ScreenshotKeyPrefix starts the blob key of every screenshot
+const ScreenshotKeyPrefix = "screenshots/"
+
+// ScreenshotStorageKey builds the blob key for a screenshot
+func ScreenshotStorageKey(sessionID uuid.UUID, name, format string) string {
+	return fmt.Sprintf("%s%s/%s.%s", ScreenshotKeyPrefix, sessionID, name, format)
+}
+
+// UnreferencedStorageKeys returns the keys no screenshot row has as its storage_key
+func (r *ScreenshotRepository) UnreferencedStorageKeys(ctx context.Context, keys []string) ([]string, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT k.key
+		FROM unnest($1::text[]) AS k(key)
+		WHERE NOT EXISTS (SELECT 1 FROM screenshots s WHERE s.storage_key = k.key)
+	`, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up screenshot storage keys: %w", err)
+	}
+	defer rows.Close()
+
+	var unreferenced []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan screenshot storage key: %w", err)
+		}
+		unreferenced = append(unreferenced, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read screenshot storage keys: %w", err)
+	}
+	return unreferenced, nil
+}
+
+// decodeImageData decodes base64 image data and returns the raw bytes and the format
+// declared by the data URL ("" when the client did not declare one)
 func decodeImageData(dataURL string) ([]byte, string, error) {
 	// Handle data URL format: data:image/png;base64,xxxxx
 	if strings.HasPrefix(dataURL, "data:") {
 		parts := strings.SplitN(dataURL, ",", 2)
 		if len(parts) != 2 {
-			return nil, "", fmt.Errorf("invalid data URL format")
+			return nil, "", fmt.Errorf("%w: invalid data URL format", imagecheck.ErrInvalidImage)
 		}
 
 		// Extract format from data URL
-		format := "jpeg"
-		if strings.Contains(parts[0], "image/png") {
-			format = "png"
-		} else if strings.Contains(parts[0], "image/jpeg") || strings.Contains(parts[0], "image/jpg") {
+		mediaType := strings.TrimPrefix(strings.SplitN(parts[0], ";", 2)[0], "data:")
+		format := strings.TrimPrefix(mediaType, "image/")
+		if format == "jpg" {
 			format = "jpeg"
 		}
 
 		data, err := base64.StdEncoding.DecodeString(parts[1])
 		if err != nil {
-			return nil, "", fmt.Errorf("failed to decode base64: %w", err)
+			return nil, "", fmt.Errorf("%w: failed to decode base64: %v", imagecheck.ErrInvalidImage, err)
 		}
 
 		return data, format, nil
@@ -177,8 +396,8 @@ func decodeImageData(dataURL string) ([]byte, string, error) {
 	// Handle plain base64 without data URL prefix
 	data, err := base64.StdEncoding.DecodeString(dataURL)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to decode base64: %w", err)
+		return nil, "", fmt.Errorf("%w: failed to decode base64: %v", imagecheck.ErrInvalidImage, err)
 	}
 
-	return data, "jpeg", nil
+	return data, "", nil
 }
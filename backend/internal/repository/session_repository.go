@@ -2,14 +2,24 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/ngocp/user-tracker/internal/models"
+	"golang.org/x/sync/singleflight"
 )
 
+// ErrMetadataTooLarge is returned by MergeMetadata when the merged metadata would
+// exceed the size cap
+var ErrMetadataTooLarge = errors.New("session metadata too large")
+
 type SessionRepository struct {
 	db *Database
+	// reads coalesces concurrent identical dashboard reads
+	reads singleflight.Group
 }
 
 func NewSessionRepository(db *Database) *SessionRepository {
@@ -21,8 +31,8 @@ func (r *SessionRepository) Create(ctx context.Context, req *models.CreateSessio
 		INSERT INTO sessions (
 			user_id, fingerprint, page_url, referrer, user_agent,
 			screen_width, screen_height, viewport_width, viewport_height,
-			device_type, browser, os, metadata
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			device_type, browser, os, metadata, sdk, consent_string, consent_state, sandbox
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 		RETURNING session_id, started_at, last_activity_at, created_at, updated_at
 	`
 
@@ -40,12 +50,17 @@ func (r *SessionRepository) Create(ctx context.Context, req *models.CreateSessio
 		Browser:        req.Browser,
 		OS:             req.OS,
 		Metadata:       req.Metadata,
+		SDK:            req.SDK,
+		ConsentString:  req.ConsentString,
+		ConsentState:   req.ConsentState,
+		Sandbox:        req.Sandbox,
 	}
 
 	err := r.db.Pool.QueryRow(ctx, query,
 		req.UserID, req.Fingerprint, req.PageURL, req.Referrer, req.UserAgent,
 		req.ScreenWidth, req.ScreenHeight, req.ViewportWidth, req.ViewportHeight,
-		req.DeviceType, req.Browser, req.OS, req.Metadata,
+		req.DeviceType, req.Browser, req.OS, req.Metadata, req.SDK,
+		req.ConsentString, req.ConsentState, req.Sandbox,
 	).Scan(
 		&session.SessionID,
 		&session.StartedAt,
@@ -61,12 +76,53 @@ func (r *SessionRepository) Create(ctx context.Context, req *models.CreateSessio
 	return session, nil
 }
 
+// Import inserts a historical session keeping its original ID and timing.
+// It returns false when a session with that ID already exists.
+func (r *SessionRepository) Import(ctx context.Context, s *models.ImportedSession) (bool, error) {
+	lastActivity := s.StartedAt
+	if s.LastActivityAt != nil {
+		lastActivity = *s.LastActivityAt
+	} else if s.EndedAt != nil {
+		lastActivity = *s.EndedAt
+	}
+
+	tag, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO sessions (
+			session_id, started_at, ended_at, last_activity_at,
+			user_id, fingerprint, page_url, referrer, user_agent,
+			screen_width, screen_height, viewport_width, viewport_height,
+			device_type, browser, os, country, city, metadata, sdk
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+		ON CONFLICT (session_id) DO NOTHING
+	`,
+		s.SessionID, s.StartedAt, s.EndedAt, lastActivity,
+		s.UserID, s.Fingerprint, s.PageURL, s.Referrer, s.UserAgent,
+		s.ScreenWidth, s.ScreenHeight, s.ViewportWidth, s.ViewportHeight,
+		s.DeviceType, s.Browser, s.OS, s.Country, s.City, s.Metadata, s.SDK,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to import session: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetByID returns a session; concurrent calls for the same session share one query
 func (r *SessionRepository) GetByID(ctx context.Context, sessionID uuid.UUID) (*models.Session, error) {
+	return coalesce(ctx, &r.reads, "get:"+sessionID.String(), func(ctx context.Context) (*models.Session, error) {
+		return r.getByID(ctx, sessionID)
+	}, func(s *models.Session) *models.Session {
+		c := *s
+		return &c
+	})
+}
+
+func (r *SessionRepository) getByID(ctx context.Context, sessionID uuid.UUID) (*models.Session, error) {
 	query := `
 		SELECT session_id, user_id, fingerprint, started_at, ended_at, last_activity_at,
 			page_url, referrer, user_agent, screen_width, screen_height,
 			viewport_width, viewport_height, device_type, browser, os, country, city,
-			metadata, created_at, updated_at
+			metadata, sdk, consent_string, consent_state, created_at, updated_at, viewport_history
 		FROM sessions
 		WHERE session_id = $1
 	`
@@ -80,24 +136,33 @@ func (r *SessionRepository) GetByID(ctx context.Context, sessionID uuid.UUID) (*
 		&session.ViewportWidth, &session.ViewportHeight,
 		&session.DeviceType, &session.Browser, &session.OS,
 		&session.Country, &session.City, &session.Metadata,
-		&session.CreatedAt, &session.UpdatedAt,
+		&session.SDK, &session.ConsentString, &session.ConsentState, &session.CreatedAt, &session.UpdatedAt,
+		&session.ViewportHistory,
 	)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to get session: %w", err)
+		return nil, fmt.Errorf("failed to get session: %w", notFoundOr(err))
 	}
 
 	return session, nil
 }
 
+// List returns a page of session summaries, newest first; concurrent calls for the
+// same page share one query
 func (r *SessionRepository) List(ctx context.Context, limit, offset int) ([]*models.SessionSummary, error) {
+	return coalesce(ctx, &r.reads, fmt.Sprintf("list:%d:%d", limit, offset), func(ctx context.Context) ([]*models.SessionSummary, error) {
+		return r.list(ctx, limit, offset)
+	}, cloneEach[models.SessionSummary])
+}
+
+func (r *SessionRepository) list(ctx context.Context, limit, offset int) ([]*models.SessionSummary, error) {
 	query := `
 		SELECT
 			s.session_id, s.user_id, s.fingerprint, s.started_at, s.ended_at,
 			s.last_activity_at, s.page_url, s.referrer, s.user_agent,
 			s.screen_width, s.screen_height, s.viewport_width, s.viewport_height,
 			s.device_type, s.browser, s.os, s.country, s.city,
-			s.metadata, s.created_at, s.updated_at,
+			s.metadata, s.sdk, s.consent_string, s.consent_state, s.created_at, s.updated_at,
 			EXTRACT(EPOCH FROM (COALESCE(s.ended_at, s.last_activity_at) - s.started_at)) as duration_seconds,
 			COUNT(DISTINCT e.page_url) as pages_visited,
 			COUNT(*) FILTER (WHERE e.event_type = 'click') as click_count,
@@ -106,6 +171,7 @@ func (r *SessionRepository) List(ctx context.Context, limit, offset int) ([]*mod
 			COUNT(*) FILTER (WHERE e.event_type = 'mousemove') as mousemove_count,
 			COUNT(*) FILTER (WHERE e.event_type = 'navigation') as navigation_count,
 			COUNT(DISTINCT sc.screenshot_id) as screenshot_count,
+			COUNT(DISTINCT e.tab_id) as tab_count,
 			MAX(e.timestamp) as last_event_time
 		FROM sessions s
 		LEFT JOIN events e ON s.session_id = e.session_id
@@ -132,11 +198,125 @@ func (r *SessionRepository) List(ctx context.Context, limit, offset int) ([]*mod
 			&session.ViewportWidth, &session.ViewportHeight,
 			&session.DeviceType, &session.Browser, &session.OS,
 			&session.Country, &session.City, &session.Metadata,
-			&session.CreatedAt, &session.UpdatedAt,
+			&session.SDK, &session.ConsentString, &session.ConsentState, &session.CreatedAt, &session.UpdatedAt,
 			&session.DurationSeconds, &session.PagesVisited,
 			&session.ClickCount, &session.InputCount, &session.ScrollCount,
 			&session.MouseMoveCount, &session.NavigationCount,
-			&session.ScreenshotCount, &session.LastEventTime,
+			&session.ScreenshotCount, &session.TabCount, &session.LastEventTime,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// ListPage returns sessions newest first using keyset pagination on (started_at, session_id).
+// A nil after starts from the newest session.
+func (r *SessionRepository) ListPage(ctx context.Context, after *time.Time, afterID uuid.UUID, limit int) ([]*models.Session, error) {
+	f := newQueryFilter()
+	if after != nil {
+		f.where("(started_at, session_id) < (?, ?)", *after, afterID)
+	}
+	query := `
+		SELECT session_id, user_id, fingerprint, started_at, ended_at, last_activity_at,
+			page_url, referrer, user_agent, screen_width, screen_height,
+			viewport_width, viewport_height, device_type, browser, os, country, city,
+			metadata, sdk, consent_string, consent_state, created_at, updated_at
+		FROM sessions
+		WHERE ` + f.clause() + `
+		ORDER BY started_at DESC, session_id DESC
+		LIMIT ` + f.param(limit)
+
+	rows, err := r.db.Pool.Query(ctx, query, f.values()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		session := &models.Session{}
+		err := rows.Scan(
+			&session.SessionID, &session.UserID, &session.Fingerprint,
+			&session.StartedAt, &session.EndedAt, &session.LastActivityAt,
+			&session.PageURL, &session.Referrer, &session.UserAgent,
+			&session.ScreenWidth, &session.ScreenHeight,
+			&session.ViewportWidth, &session.ViewportHeight,
+			&session.DeviceType, &session.Browser, &session.OS,
+			&session.Country, &session.City, &session.Metadata,
+			&session.SDK, &session.ConsentString, &session.ConsentState, &session.CreatedAt, &session.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// ListRange returns sessions started in [from, to) oldest first, continuing after the
+// (after, afterID) keyset position when after is set. A set sandbox keeps only sandbox
+// (true) or live (false) sessions.
+func (r *SessionRepository) ListRange(ctx context.Context, from, to time.Time, sandbox *bool, after *time.Time, afterID uuid.UUID, limit int) ([]*models.Session, error) {
+	f := newQueryFilter().where("started_at >= ? AND started_at < ?", from, to)
+	if sandbox != nil {
+		f.where("sandbox = ?", *sandbox)
+	}
+	if after != nil {
+		f.where("(started_at, session_id) > (?, ?)", *after, afterID)
+	}
+	return r.listPage(ctx, f, "started_at", limit)
+}
+
+// ListUpdated returns sessions last updated before to, least recently updated first,
+// continuing after the (after, afterID) keyset position when after is set. A session
+// is listed again each time it changes. A set sandbox keeps only sandbox (true) or
+// live (false) sessions.
+func (r *SessionRepository) ListUpdated(ctx context.Context, to time.Time, sandbox *bool, after *time.Time, afterID uuid.UUID, limit int) ([]*models.Session, error) {
+	f := newQueryFilter().where("updated_at < ?", to)
+	if sandbox != nil {
+		f.where("sandbox = ?", *sandbox)
+	}
+	if after != nil {
+		f.where("(updated_at, session_id) > (?, ?)", *after, afterID)
+	}
+	return r.listPage(ctx, f, "updated_at", limit)
+}
+
+// listPage returns up to limit sessions matching f ordered by (orderBy, session_id)
+func (r *SessionRepository) listPage(ctx context.Context, f *queryFilter, orderBy string, limit int) ([]*models.Session, error) {
+	query := `
+		SELECT session_id, user_id, fingerprint, started_at, ended_at, last_activity_at,
+			page_url, referrer, user_agent, screen_width, screen_height,
+			viewport_width, viewport_height, device_type, browser, os, country, city,
+			metadata, sdk, consent_string, consent_state, created_at, updated_at
+		FROM sessions
+		WHERE ` + f.clause() + `
+		ORDER BY ` + orderBy + ` ASC, session_id ASC
+		LIMIT ` + f.param(limit)
+
+	rows, err := r.db.Pool.Query(ctx, query, f.values()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		session := &models.Session{}
+		err := rows.Scan(
+			&session.SessionID, &session.UserID, &session.Fingerprint,
+			&session.StartedAt, &session.EndedAt, &session.LastActivityAt,
+			&session.PageURL, &session.Referrer, &session.UserAgent,
+			&session.ScreenWidth, &session.ScreenHeight,
+			&session.ViewportWidth, &session.ViewportHeight,
+			&session.DeviceType, &session.Browser, &session.OS,
+			&session.Country, &session.City, &session.Metadata,
+			&session.SDK, &session.ConsentString, &session.ConsentState, &session.CreatedAt, &session.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan session: %w", err)
@@ -154,19 +334,206 @@ func (r *SessionRepository) UpdateEndTime(ctx context.Context, sessionID uuid.UU
 		WHERE session_id = $1 AND ended_at IS NULL
 	`
 
-	_, err := r.db.Pool.Exec(ctx, query, sessionID)
+	tag, err := r.db.Pool.Exec(ctx, query, sessionID)
 	if err != nil {
 		return fmt.Errorf("failed to update session end time: %w", err)
 	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	// Ending a session twice is fine; ending one that does not exist is not
+	exists, err := r.Exists(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("failed to update session end time: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// SetUserID attributes a session to an identified user
+func (r *SessionRepository) SetUserID(ctx context.Context, sessionID uuid.UUID, userID string) error {
+	query := `
+		UPDATE sessions
+		SET user_id = $2, updated_at = NOW()
+		WHERE session_id = $1
+	`
+
+	tag, err := r.db.Pool.Exec(ctx, query, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update session user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
 
 	return nil
 }
 
-func (r *SessionRepository) Count(ctx context.Context) (int64, error) {
-	var count int64
-	err := r.db.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM sessions").Scan(&count)
+// Exists reports whether a session with this ID exists
+func (r *SessionRepository) Exists(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	var exists bool
+	err := r.db.Pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM sessions WHERE session_id = $1)", sessionID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+	return exists, nil
+}
+
+// Delete removes a session; its events, screenshots and other child rows cascade
+func (r *SessionRepository) Delete(ctx context.Context, sessionID uuid.UUID) error {
+	tag, err := r.db.Pool.Exec(ctx, "DELETE FROM sessions WHERE session_id = $1", sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteSandbox deletes up to limit sandbox sessions started before before, with their
+// child rows, and returns how many were deleted and the storage keys of their
+// blob-stored screenshots. The cascade removes the screenshot rows but not their
+// objects, which the caller deletes from the store.
+func (r *SessionRepository) DeleteSandbox(ctx context.Context, before time.Time, limit int) (int64, []string, error) {
+	var deleted int64
+	var storageKeys []string
+	err := r.db.Pool.QueryRow(ctx, `
+		WITH doomed AS (
+			SELECT session_id FROM sessions
+			WHERE sandbox AND started_at < $1
+			LIMIT $2
+		), deleted AS (
+			DELETE FROM sessions
+			WHERE session_id IN (SELECT session_id FROM doomed)
+			RETURNING session_id
+		)
+		SELECT
+			(SELECT COUNT(*) FROM deleted),
+			ARRAY(
+				SELECT storage_key FROM screenshots
+				WHERE session_id IN (SELECT session_id FROM doomed) AND storage_key IS NOT NULL
+			)
+	`, before, limit).Scan(&deleted, &storageKeys)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to delete sandbox sessions: %w", err)
+	}
+	return deleted, storageKeys, nil
+}
+
+// MergeMetadata sets the keys of set and deletes the keys in remove in the session's
+// metadata, and returns the merged metadata. The update is refused with
+// ErrMetadataTooLarge when the merged JSON would exceed maxBytes.
+func (r *SessionRepository) MergeMetadata(ctx context.Context, sessionID uuid.UUID, set map[string]interface{}, remove []string, maxBytes int) (map[string]interface{}, error) {
+	if set == nil {
+		set = map[string]interface{}{}
+	}
+	if remove == nil {
+		remove = []string{}
+	}
+
+	query := `
+		WITH merged AS (
+			SELECT session_id, (COALESCE(metadata, '{}'::jsonb) || $2::jsonb) - $3::text[] AS metadata
+			FROM sessions
+			WHERE session_id = $1
+			FOR UPDATE
+		)
+		UPDATE sessions s
+		SET metadata = merged.metadata, updated_at = NOW()
+		FROM merged
+		WHERE s.session_id = merged.session_id AND octet_length(merged.metadata::text) <= $4
+		RETURNING s.metadata
+	`
+
+	var metadata map[string]interface{}
+	err := r.db.Pool.QueryRow(ctx, query, sessionID, set, remove, maxBytes).Scan(&metadata)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Either the session does not exist or the merge was refused for its size
+		if _, err := r.GetByID(ctx, sessionID); err != nil {
+			return nil, err
+		}
+		return nil, ErrMetadataTooLarge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update session metadata: %w", err)
+	}
+
+	return metadata, nil
+}
+
+// Count counts all sessions. When the table statistics put the count at
+// estimateAbove or more, the estimate is returned instead and estimated is true;
+// estimateAbove <= 0 always counts exactly. Concurrent identical calls share one query.
+func (r *SessionRepository) Count(ctx context.Context, estimateAbove int64) (int64, bool, error) {
+	result, err := coalesce(ctx, &r.reads, fmt.Sprintf("count:%d", estimateAbove), func(ctx context.Context) (counted, error) {
+		count, estimated, err := r.count(ctx, estimateAbove)
+		return counted{count, estimated}, err
+	}, nil)
+	return result.count, result.estimated, err
+}
+
+func (r *SessionRepository) count(ctx context.Context, estimateAbove int64) (count int64, estimated bool, err error) {
+	if estimateAbove > 0 {
+		rows, err := r.db.tableRows(ctx, "sessions")
+		if err != nil {
+			return 0, false, err
+		}
+		if rows >= estimateAbove {
+			return rows, true, nil
+		}
+	}
+
+	err = r.db.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM sessions").Scan(&count)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to count sessions: %w", err)
+	}
+	return count, false, nil
+}
+
+// FindResumable returns the most recent open session for a fingerprint whose last
+// activity falls within the resume window, touching its last_activity_at. Sandbox and
+// other sessions never resume each other.
+func (r *SessionRepository) FindResumable(ctx context.Context, fingerprint string, window time.Duration, sandbox bool) (*models.Session, error) {
+	query := `
+		UPDATE sessions
+		SET last_activity_at = NOW(), updated_at = NOW()
+		WHERE session_id = (
+			SELECT session_id
+			FROM sessions
+			WHERE fingerprint = $1
+				AND ended_at IS NULL
+				AND last_activity_at >= NOW() - $2::interval
+				AND sandbox = $3
+			ORDER BY last_activity_at DESC
+			LIMIT 1
+		)
+		RETURNING session_id, user_id, fingerprint, started_at, ended_at, last_activity_at,
+			page_url, referrer, user_agent, screen_width, screen_height,
+			viewport_width, viewport_height, device_type, browser, os, country, city,
+			metadata, sdk, consent_string, consent_state, sandbox, created_at, updated_at
+	`
+
+	session := &models.Session{}
+	err := r.db.Pool.QueryRow(ctx, query, fingerprint, window, sandbox).Scan(
+		&session.SessionID, &session.UserID, &session.Fingerprint,
+		&session.StartedAt, &session.EndedAt, &session.LastActivityAt,
+		&session.PageURL, &session.Referrer, &session.UserAgent,
+		&session.ScreenWidth, &session.ScreenHeight,
+		&session.ViewportWidth, &session.ViewportHeight,
+		&session.DeviceType, &session.Browser, &session.OS,
+		&session.Country, &session.City, &session.Metadata,
+		&session.SDK, &session.ConsentString, &session.ConsentState, &session.Sandbox, &session.CreatedAt, &session.UpdatedAt,
+	)
 	if err != nil {
-		return 0, fmt.Errorf("failed to count sessions: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find resumable session: %w", err)
 	}
-	return count, nil
+
+	return session, nil
 }
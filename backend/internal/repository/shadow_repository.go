@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// shadowColumns is the column list the COPY-based shadow writer fills
+var shadowColumns = []string{
+	"session_id", "timestamp", "event_type", "target_element", "target_selector",
+	"target_tag", "target_id", "target_class", "page_url", "viewport_x", "viewport_y",
+	"screen_x", "screen_y", "scroll_x", "scroll_y", "input_value", "input_masked",
+	"key_pressed", "mouse_button", "click_count", "event_data", "sdk", "stream_id",
+}
+
+// EventDigest summarizes the rows written for a set of stream messages. Two write
+// paths agree when their digests are equal.
+type EventDigest struct {
+	Rows         int64      `json:"rows"`
+	EventTypes   int64      `json:"event_types"`
+	Clicks       int64      `json:"clicks"`
+	LastActivity *time.Time `json:"last_activity,omitempty"`
+	Checksum     string     `json:"checksum"`
+}
+
+// ShadowRepository writes events through the candidate COPY-based path into
+// events_shadow and compares the result with the rows in events
+type ShadowRepository struct {
+	db *Database
+}
+
+func NewShadowRepository(db *Database) *ShadowRepository {
+	return &ShadowRepository{db: db}
+}
+
+// CopyBatch inserts events into events_shadow with COPY
+func (r *ShadowRepository) CopyBatch(ctx context.Context, sessionID uuid.UUID, events []models.EventData) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	rows := make([][]interface{}, len(events))
+	for i, event := range events {
+		var streamID *string
+		if event.StreamID != "" {
+			streamID = &event.StreamID
+		}
+		rows[i] = []interface{}{
+			sessionID, event.Timestamp, string(event.EventType),
+			event.TargetElement, event.TargetSelector, event.TargetTag,
+			event.TargetID, event.TargetClass, event.PageURL,
+			event.ViewportX, event.ViewportY,
+			event.ScreenX, event.ScreenY,
+			event.ScrollX, event.ScrollY,
+			event.InputValue, event.InputMasked,
+			event.KeyPressed, event.MouseButton, event.ClickCount, event.EventData,
+			event.SDK, streamID,
+		}
+	}
+
+	if _, err := r.db.Pool.CopyFrom(ctx, pgx.Identifier{"events_shadow"}, shadowColumns, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("failed to copy shadow events: %w", err)
+	}
+	return nil
+}
+
+// Compare digests the rows inserted from streamIDs in events (primary) and
+// events_shadow (shadow)
+func (r *ShadowRepository) Compare(ctx context.Context, sessionID uuid.UUID, streamIDs []string) (*EventDigest, *EventDigest, error) {
+	primary, err := r.digest(ctx, "events", sessionID, streamIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	shadow, err := r.digest(ctx, "events_shadow", sessionID, streamIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return primary, shadow, nil
+}
+
+// digest computes an EventDigest over table, which must be events or events_shadow.
+// The checksum covers every column both paths write, in a fixed order.
+func (r *ShadowRepository) digest(ctx context.Context, table string, sessionID uuid.UUID, streamIDs []string) (*EventDigest, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*), COUNT(DISTINCT event_type), COALESCE(SUM(click_count), 0), MAX(timestamp),
+			COALESCE(md5(string_agg(
+				concat_ws('|', stream_id, timestamp, event_type, target_element, target_selector,
+					target_tag, target_id, target_class, page_url, viewport_x, viewport_y,
+					screen_x, screen_y, scroll_x, scroll_y, input_value, input_masked,
+					key_pressed, mouse_button, click_count, event_data::text, sdk),
+				E'\n' ORDER BY stream_id, timestamp, event_type, page_url, event_data::text
+			)), '')
+		FROM %s
+		WHERE session_id = $1 AND stream_id = ANY($2)
+	`, table)
+
+	d := &EventDigest{}
+	err := r.db.Pool.QueryRow(ctx, query, sessionID, streamIDs).Scan(
+		&d.Rows, &d.EventTypes, &d.Clicks, &d.LastActivity, &d.Checksum,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to digest %s: %w", table, err)
+	}
+	return d, nil
+}
+
+// DeleteBatch removes the shadow rows inserted from streamIDs
+func (r *ShadowRepository) DeleteBatch(ctx context.Context, sessionID uuid.UUID, streamIDs []string) error {
+	_, err := r.db.Pool.Exec(ctx,
+		"DELETE FROM events_shadow WHERE session_id = $1 AND stream_id = ANY($2)",
+		sessionID, streamIDs,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete shadow events: %w", err)
+	}
+	return nil
+}
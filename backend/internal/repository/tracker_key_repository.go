@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type TrackerKeyRepository struct {
+	db *Database
+}
+
+func NewTrackerKeyRepository(db *Database) *TrackerKeyRepository {
+	return &TrackerKeyRepository{db: db}
+}
+
+const trackerKeyColumns = `key_id, name, public_key, allowed_origins, tokens_not_before, revoked_at,
+	created_at, updated_at, mousemove_throttle_ms, scroll_throttle_ms, sandbox, sample_rate, mask_selectors`
+
+func scanTrackerKey(row pgx.Row) (*models.TrackerKey, error) {
+	k := &models.TrackerKey{}
+	err := row.Scan(&k.KeyID, &k.Name, &k.PublicKey, &k.AllowedOrigins, &k.TokensNotBefore, &k.RevokedAt,
+		&k.CreatedAt, &k.UpdatedAt, &k.MouseMoveThrottleMs, &k.ScrollThrottleMs, &k.Sandbox, &k.SampleRate, &k.MaskSelectors)
+	return k, err
+}
+
+// newPublicKey generates a random "pk_" prefixed public key
+func newPublicKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "pk_" + hex.EncodeToString(buf), nil
+}
+
+// Create registers a tracker key with a freshly generated public key
+func (r *TrackerKeyRepository) Create(ctx context.Context, req *models.CreateTrackerKeyRequest) (*models.TrackerKey, error) {
+	publicKey, err := newPublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate public key: %w", err)
+	}
+
+	key, err := scanTrackerKey(r.db.Pool.QueryRow(ctx,
+		`INSERT INTO tracker_keys (name, public_key, allowed_origins, mousemove_throttle_ms, scroll_throttle_ms, sandbox)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+trackerKeyColumns,
+		req.Name, publicKey, req.AllowedOrigins, req.MouseMoveThrottleMs, req.ScrollThrottleMs, req.Sandbox,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracker key: %w", err)
+	}
+	return key, nil
+}
+
+// List returns all tracker keys, revoked ones included, newest first
+func (r *TrackerKeyRepository) List(ctx context.Context) ([]*models.TrackerKey, error) {
+	rows, err := r.db.Pool.Query(ctx, `SELECT `+trackerKeyColumns+` FROM tracker_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tracker keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*models.TrackerKey{}
+	for rows.Next() {
+		key, err := scanTrackerKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tracker key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetByID returns a tracker key, revoked or not
+func (r *TrackerKeyRepository) GetByID(ctx context.Context, keyID uuid.UUID) (*models.TrackerKey, error) {
+	key, err := scanTrackerKey(r.db.Pool.QueryRow(ctx,
+		`SELECT `+trackerKeyColumns+` FROM tracker_keys WHERE key_id = $1`, keyID,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tracker key: %w", notFoundOr(err))
+	}
+	return key, nil
+}
+
+// GetActiveByPublicKey returns the unrevoked key with this public key
+func (r *TrackerKeyRepository) GetActiveByPublicKey(ctx context.Context, publicKey string) (*models.TrackerKey, error) {
+	key, err := scanTrackerKey(r.db.Pool.QueryRow(ctx,
+		`SELECT `+trackerKeyColumns+` FROM tracker_keys WHERE public_key = $1 AND revoked_at IS NULL`, publicKey,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tracker key: %w", notFoundOr(err))
+	}
+	return key, nil
+}
+
+// Rotate replaces the public key of an unrevoked key and invalidates the tokens
+// issued under the old one
+func (r *TrackerKeyRepository) Rotate(ctx context.Context, keyID uuid.UUID) (*models.TrackerKey, error) {
+	publicKey, err := newPublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate public key: %w", err)
+	}
+
+	key, err := scanTrackerKey(r.db.Pool.QueryRow(ctx,
+		`UPDATE tracker_keys SET public_key = $2, tokens_not_before = NOW(), updated_at = NOW()
+		WHERE key_id = $1 AND revoked_at IS NULL
+		RETURNING `+trackerKeyColumns,
+		keyID, publicKey,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate tracker key: %w", notFoundOr(err))
+	}
+	return key, nil
+}
+
+// SetThrottles replaces the throttles advertised to SDKs using an unrevoked key
+func (r *TrackerKeyRepository) SetThrottles(ctx context.Context, keyID uuid.UUID, throttles *models.TrackerKeyThrottles) (*models.TrackerKey, error) {
+	key, err := scanTrackerKey(r.db.Pool.QueryRow(ctx,
+		`UPDATE tracker_keys SET mousemove_throttle_ms = $2, scroll_throttle_ms = $3, updated_at = NOW()
+		WHERE key_id = $1 AND revoked_at IS NULL
+		RETURNING `+trackerKeyColumns,
+		keyID, throttles.MouseMoveThrottleMs, throttles.ScrollThrottleMs,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update tracker key throttles: %w", notFoundOr(err))
+	}
+	return key, nil
+}
+
+// SetRecording replaces the recording settings of an unrevoked key
+func (r *TrackerKeyRepository) SetRecording(ctx context.Context, keyID uuid.UUID, recording *models.TrackerKeyRecording) (*models.TrackerKey, error) {
+	key, err := scanTrackerKey(r.db.Pool.QueryRow(ctx,
+		`UPDATE tracker_keys SET sample_rate = $2, mask_selectors = $3, updated_at = NOW()
+		WHERE key_id = $1 AND revoked_at IS NULL
+		RETURNING `+trackerKeyColumns,
+		keyID, recording.SampleRate, recording.MaskSelectors,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update tracker key recording: %w", notFoundOr(err))
+	}
+	return key, nil
+}
+
+// SetSandbox marks an unrevoked key as a sandbox key or not. Sessions already created
+// keep the flag they were created with.
+func (r *TrackerKeyRepository) SetSandbox(ctx context.Context, keyID uuid.UUID, sandbox bool) (*models.TrackerKey, error) {
+	key, err := scanTrackerKey(r.db.Pool.QueryRow(ctx,
+		`UPDATE tracker_keys SET sandbox = $2, updated_at = NOW()
+		WHERE key_id = $1 AND revoked_at IS NULL
+		RETURNING `+trackerKeyColumns,
+		keyID, sandbox,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update tracker key sandbox: %w", notFoundOr(err))
+	}
+	return key, nil
+}
+
+// Revoke disables a key; exchanging it and using its tokens fail from now on
+func (r *TrackerKeyRepository) Revoke(ctx context.Context, keyID uuid.UUID) error {
+	tag, err := r.db.Pool.Exec(ctx,
+		`UPDATE tracker_keys SET revoked_at = NOW(), updated_at = NOW()
+		WHERE key_id = $1 AND revoked_at IS NULL`,
+		keyID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke tracker key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to revoke tracker key: %w", ErrNotFound)
+	}
+	return nil
+}
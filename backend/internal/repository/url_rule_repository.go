@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type URLRuleRepository struct {
+	db *Database
+}
+
+func NewURLRuleRepository(db *Database) *URLRuleRepository {
+	return &URLRuleRepository{db: db}
+}
+
+const urlRuleColumns = `rule_id, key_id, position, strip_params, pattern, replacement, created_at`
+
+func scanURLRule(row pgx.Row) (*models.URLRule, error) {
+	r := &models.URLRule{}
+	err := row.Scan(&r.RuleID, &r.KeyID, &r.Position, &r.StripParams, &r.Pattern, &r.Replacement, &r.CreatedAt)
+	return r, err
+}
+
+// Create adds a rule; it returns ErrNotFound if the tracker key does not exist
+func (r *URLRuleRepository) Create(ctx context.Context, req *models.CreateURLRuleRequest) (*models.URLRule, error) {
+	rule, err := scanURLRule(r.db.Pool.QueryRow(ctx,
+		`INSERT INTO url_rules (key_id, position, strip_params, pattern, replacement)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+urlRuleColumns,
+		req.KeyID, req.Position, req.StripParams, req.Pattern, req.Replacement,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create url rule: %w", missingParentOr(err))
+	}
+	return rule, nil
+}
+
+// List returns every rule in the order they are applied: global rules, then each
+// key's rules, by position
+func (r *URLRuleRepository) List(ctx context.Context) ([]*models.URLRule, error) {
+	return r.query(ctx, `SELECT `+urlRuleColumns+` FROM url_rules
+		ORDER BY key_id NULLS FIRST, position, created_at`)
+}
+
+// ListFor returns the rules applied to events of a tracker key, in order: the global
+// rules, then the key's own. uuid.Nil selects the global rules only.
+func (r *URLRuleRepository) ListFor(ctx context.Context, keyID uuid.UUID) ([]*models.URLRule, error) {
+	return r.query(ctx, `SELECT `+urlRuleColumns+` FROM url_rules
+		WHERE key_id IS NULL OR key_id = $1
+		ORDER BY key_id NULLS FIRST, position, created_at`, keyID)
+}
+
+func (r *URLRuleRepository) query(ctx context.Context, query string, args ...interface{}) ([]*models.URLRule, error) {
+	rows, err := r.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list url rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []*models.URLRule{}
+	for rows.Next() {
+		rule, err := scanURLRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan url rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// Delete removes a rule
+func (r *URLRuleRepository) Delete(ctx context.Context, ruleID uuid.UUID) error {
+	tag, err := r.db.Pool.Exec(ctx, `DELETE FROM url_rules WHERE rule_id = $1`, ruleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete url rule: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete url rule: %w", ErrNotFound)
+	}
+	return nil
+}
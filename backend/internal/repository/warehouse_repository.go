@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type WarehouseRepository struct {
+	db *Database
+}
+
+func NewWarehouseRepository(db *Database) *WarehouseRepository {
+	return &WarehouseRepository{db: db}
+}
+
+const warehouseConnectorColumns = `connector_id, name, kind, project, config, credentials, cron, timezone,
+	delay_seconds, enabled, next_run_at, schema_version, sessions_cursor_at, sessions_cursor_id,
+	events_cursor_at, events_cursor_id, sessions_loaded, events_loaded, last_run_at, last_status,
+	last_error, consecutive_failures, created_at, updated_at`
+
+func scanWarehouseConnector(row pgx.Row) (*models.WarehouseConnector, error) {
+	c := &models.WarehouseConnector{}
+	err := row.Scan(&c.ConnectorID, &c.Name, &c.Kind, &c.Project, &c.Config, &c.Credentials, &c.Cron, &c.Timezone,
+		&c.DelaySeconds, &c.Enabled, &c.NextRunAt, &c.SchemaVersion, &c.SessionsAt, &c.SessionsID,
+		&c.EventsAt, &c.EventsID, &c.SessionsLoaded, &c.EventsLoaded, &c.LastRunAt, &c.LastStatus,
+		&c.LastError, &c.ConsecutiveFailures, &c.CreatedAt, &c.UpdatedAt)
+	return c, err
+}
+
+func collectWarehouseConnectors(rows pgx.Rows) ([]*models.WarehouseConnector, error) {
+	defer rows.Close()
+
+	connectors := []*models.WarehouseConnector{}
+	for rows.Next() {
+		c, err := scanWarehouseConnector(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan warehouse connector: %w", err)
+		}
+		connectors = append(connectors, c)
+	}
+	return connectors, rows.Err()
+}
+
+func (r *WarehouseRepository) Create(ctx context.Context, c *models.WarehouseConnector) (*models.WarehouseConnector, error) {
+	created, err := scanWarehouseConnector(r.db.Pool.QueryRow(ctx, `
+		INSERT INTO warehouse_connectors (name, kind, project, config, credentials, cron, timezone,
+			delay_seconds, enabled, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING `+warehouseConnectorColumns,
+		c.Name, c.Kind, c.Project, c.Config, c.Credentials, c.Cron, c.Timezone,
+		c.DelaySeconds, c.Enabled, c.NextRunAt,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create warehouse connector: %w", err)
+	}
+	return created, nil
+}
+
+func (r *WarehouseRepository) GetByID(ctx context.Context, connectorID uuid.UUID) (*models.WarehouseConnector, error) {
+	c, err := scanWarehouseConnector(r.db.Pool.QueryRow(ctx,
+		`SELECT `+warehouseConnectorColumns+` FROM warehouse_connectors WHERE connector_id = $1`, connectorID,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get warehouse connector: %w", notFoundOr(err))
+	}
+	return c, nil
+}
+
+func (r *WarehouseRepository) List(ctx context.Context) ([]*models.WarehouseConnector, error) {
+	rows, err := r.db.Pool.Query(ctx, `SELECT `+warehouseConnectorColumns+` FROM warehouse_connectors ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list warehouse connectors: %w", err)
+	}
+	return collectWarehouseConnectors(rows)
+}
+
+// Update saves the connector's editable fields: name, config, credentials, cron,
+// timezone, delay, enabled flag and next run. Changing the config applies the table
+// layout again on the next run.
+func (r *WarehouseRepository) Update(ctx context.Context, c *models.WarehouseConnector) (*models.WarehouseConnector, error) {
+	updated, err := scanWarehouseConnector(r.db.Pool.QueryRow(ctx, `
+		UPDATE warehouse_connectors SET
+			name = $2, config = $3, credentials = $4, cron = $5, timezone = $6, delay_seconds = $7,
+			enabled = $8, next_run_at = $9,
+			schema_version = CASE WHEN config = $3 THEN schema_version ELSE 0 END,
+			updated_at = NOW()
+		WHERE connector_id = $1
+		RETURNING `+warehouseConnectorColumns,
+		c.ConnectorID, c.Name, c.Config, c.Credentials, c.Cron, c.Timezone, c.DelaySeconds,
+		c.Enabled, c.NextRunAt,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update warehouse connector: %w", notFoundOr(err))
+	}
+	return updated, nil
+}
+
+func (r *WarehouseRepository) Delete(ctx context.Context, connectorID uuid.UUID) error {
+	tag, err := r.db.Pool.Exec(ctx, `DELETE FROM warehouse_connectors WHERE connector_id = $1`, connectorID)
+	if err != nil {
+		return fmt.Errorf("failed to delete warehouse connector: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete warehouse connector: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// ResetCursors makes the next run load the project's sessions and events from the
+// start, e.g. after the destination tables were dropped
+func (r *WarehouseRepository) ResetCursors(ctx context.Context, connectorID uuid.UUID) (*models.WarehouseConnector, error) {
+	c, err := scanWarehouseConnector(r.db.Pool.QueryRow(ctx, `
+		UPDATE warehouse_connectors SET
+			sessions_cursor_at = NULL, sessions_cursor_id = NULL,
+			events_cursor_at = NULL, events_cursor_id = NULL,
+			schema_version = 0, updated_at = NOW()
+		WHERE connector_id = $1
+		RETURNING `+warehouseConnectorColumns,
+		connectorID,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reset warehouse connector: %w", notFoundOr(err))
+	}
+	return c, nil
+}
+
+// ClaimDue returns up to limit enabled connectors whose next run is due and leases
+// them for lease, so with several instances each run is made by one of them. A lease
+// that expires, e.g. because its instance died, lets the connector be claimed again.
+func (r *WarehouseRepository) ClaimDue(ctx context.Context, lease time.Duration, limit int) ([]*models.WarehouseConnector, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		UPDATE warehouse_connectors SET locked_until = NOW() + $1 * INTERVAL '1 millisecond'
+		WHERE connector_id IN (
+			SELECT connector_id FROM warehouse_connectors
+			WHERE enabled AND next_run_at <= NOW()
+				AND (locked_until IS NULL OR locked_until < NOW())
+			ORDER BY next_run_at ASC
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+warehouseConnectorColumns,
+		lease.Milliseconds(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim due warehouse connectors: %w", err)
+	}
+	return collectWarehouseConnectors(rows)
+}
+
+// SetSchemaVersion records the table layout version applied to the destination
+func (r *WarehouseRepository) SetSchemaVersion(ctx context.Context, connectorID uuid.UUID, version int) error {
+	_, err := r.db.Pool.Exec(ctx,
+		`UPDATE warehouse_connectors SET schema_version = $2 WHERE connector_id = $1`, connectorID, version)
+	if err != nil {
+		return fmt.Errorf("failed to set warehouse schema version: %w", err)
+	}
+	return nil
+}
+
+// AdvanceSessions moves the sessions cursor past a loaded batch of n sessions ending
+// at (at, sessionID)
+func (r *WarehouseRepository) AdvanceSessions(ctx context.Context, connectorID uuid.UUID, at time.Time, sessionID uuid.UUID, n int) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE warehouse_connectors SET
+			sessions_cursor_at = $2, sessions_cursor_id = $3, sessions_loaded = sessions_loaded + $4
+		WHERE connector_id = $1
+	`, connectorID, at, sessionID, n)
+	if err != nil {
+		return fmt.Errorf("failed to advance warehouse sessions cursor: %w", err)
+	}
+	return nil
+}
+
+// AdvanceEvents moves the events cursor past a loaded batch of n events ending at
+// (at, eventID)
+func (r *WarehouseRepository) AdvanceEvents(ctx context.Context, connectorID uuid.UUID, at time.Time, eventID int64, n int) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE warehouse_connectors SET
+			events_cursor_at = $2, events_cursor_id = $3, events_loaded = events_loaded + $4
+		WHERE connector_id = $1
+	`, connectorID, at, eventID, n)
+	if err != nil {
+		return fmt.Errorf("failed to advance warehouse events cursor: %w", err)
+	}
+	return nil
+}
+
+// FinishRun releases the connector's lease and records the run's outcome; runErr is
+// nil when it succeeded
+func (r *WarehouseRepository) FinishRun(ctx context.Context, connectorID uuid.UUID, nextRunAt time.Time, runErr error) error {
+	status := models.WarehouseRunSucceeded
+	var errStr *string
+	if runErr != nil {
+		status = models.WarehouseRunFailed
+		s := runErr.Error()
+		errStr = &s
+	}
+
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE warehouse_connectors SET
+			locked_until = NULL, next_run_at = $2, last_run_at = NOW(), last_status = $3, last_error = $4,
+			consecutive_failures = CASE WHEN $4::text IS NULL THEN 0 ELSE consecutive_failures + 1 END
+		WHERE connector_id = $1
+	`, connectorID, nextRunAt, status, errStr)
+	if err != nil {
+		return fmt.Errorf("failed to finish warehouse connector run: %w", err)
+	}
+	return nil
+}
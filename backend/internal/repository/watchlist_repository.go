@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+type WatchlistRepository struct {
+	db *Database
+}
+
+func NewWatchlistRepository(db *Database) *WatchlistRepository {
+	return &WatchlistRepository{db: db}
+}
+
+const watchSubscriptionColumns = `w.subscription_id, w.identity_type, w.identity, w.label, w.notify_url, w.enabled,
+	w.created_at, w.updated_at`
+
+// watchedSessionColumns are the session fields returned with watched sessions
+const watchedSessionColumns = `s.session_id, s.user_id, s.fingerprint, s.started_at, s.ended_at, s.last_activity_at,
+	s.page_url, s.device_type, s.browser, s.os, s.country, s.city`
+
+func scanWatchSubscription(row pgx.Row, extra ...interface{}) (*models.WatchSubscription, error) {
+	w := &models.WatchSubscription{}
+	dest := append([]interface{}{
+		&w.SubscriptionID, &w.IdentityType, &w.Identity, &w.Label, &w.NotifyURL, &w.Enabled,
+		&w.CreatedAt, &w.UpdatedAt,
+	}, extra...)
+	return w, row.Scan(dest...)
+}
+
+func watchedSessionDest(s *models.Session) []interface{} {
+	return []interface{}{
+		&s.SessionID, &s.UserID, &s.Fingerprint, &s.StartedAt, &s.EndedAt, &s.LastActivityAt,
+		&s.PageURL, &s.DeviceType, &s.Browser, &s.OS, &s.Country, &s.City,
+	}
+}
+
+// Subscribe creates a subscription for the identity, or re-enables and updates the
+// existing one. It reports whether the subscription is new.
+func (r *WatchlistRepository) Subscribe(ctx context.Context, req *models.CreateWatchSubscriptionRequest) (*models.WatchSubscription, bool, error) {
+	query := `
+		INSERT INTO watch_subscriptions AS w (identity_type, identity, label, notify_url)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (identity_type, identity) DO UPDATE SET
+			label = COALESCE(EXCLUDED.label, w.label),
+			notify_url = COALESCE(EXCLUDED.notify_url, w.notify_url),
+			enabled = TRUE,
+			updated_at = NOW()
+		RETURNING ` + watchSubscriptionColumns + `, (xmax = 0)`
+
+	var created bool
+	sub, err := scanWatchSubscription(r.db.Pool.QueryRow(ctx, query, req.IdentityType, req.Identity, req.Label, req.NotifyURL), &created)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create watch subscription: %w", err)
+	}
+	return sub, created, nil
+}
+
+// List returns all subscriptions with the number of sessions each has pinned
+func (r *WatchlistRepository) List(ctx context.Context) ([]*models.WatchSubscription, error) {
+	query := `
+		SELECT ` + watchSubscriptionColumns + `,
+			(SELECT COUNT(*) FROM watched_sessions ws WHERE ws.subscription_id = w.subscription_id)
+		FROM watch_subscriptions w
+		ORDER BY w.created_at DESC
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list watch subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []*models.WatchSubscription
+	for rows.Next() {
+		var count int64
+		sub, err := scanWatchSubscription(rows, &count)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan watch subscription: %w", err)
+		}
+		sub.SessionCount = count
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// Delete removes a subscription and unpins its sessions
+func (r *WatchlistRepository) Delete(ctx context.Context, subscriptionID uuid.UUID) error {
+	tag, err := r.db.Pool.Exec(ctx, "DELETE FROM watch_subscriptions WHERE subscription_id = $1", subscriptionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete watch subscription: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete watch subscription: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// ListSessions returns pinned sessions, newest match first. A nil subscriptionID
+// lists the sessions of all subscriptions.
+func (r *WatchlistRepository) ListSessions(ctx context.Context, subscriptionID *uuid.UUID, limit int) ([]*models.WatchedSession, error) {
+	f := newQueryFilter()
+	if subscriptionID != nil {
+		f.where("ws.subscription_id = ?", *subscriptionID)
+	}
+	query := `
+		SELECT ws.subscription_id, w.label, ws.matched_at, ws.notified_at, ws.notify_attempts, ws.notify_error,
+			` + watchedSessionColumns + `
+		FROM watched_sessions ws
+		JOIN watch_subscriptions w ON w.subscription_id = ws.subscription_id
+		JOIN sessions s ON s.session_id = ws.session_id
+		WHERE ` + f.clause() + `
+		ORDER BY ws.matched_at DESC
+		LIMIT ` + f.param(limit)
+
+	rows, err := r.db.Pool.Query(ctx, query, f.values()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list watched sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var watched []*models.WatchedSession
+	for rows.Next() {
+		ws := &models.WatchedSession{Session: &models.Session{}}
+		dest := append([]interface{}{
+			&ws.SubscriptionID, &ws.Label, &ws.MatchedAt, &ws.NotifiedAt, &ws.NotifyAttempts, &ws.NotifyError,
+		}, watchedSessionDest(ws.Session)...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan watched session: %w", err)
+		}
+		watched = append(watched, ws)
+	}
+	return watched, rows.Err()
+}
+
+// PinNew pins sessions created within lookback that match an enabled subscription
+// made before the session, and returns how many were pinned
+func (r *WatchlistRepository) PinNew(ctx context.Context, lookback time.Duration) (int64, error) {
+	tag, err := r.db.Pool.Exec(ctx, `
+		INSERT INTO watched_sessions (subscription_id, session_id)
+		SELECT w.subscription_id, s.session_id
+		FROM watch_subscriptions w
+		JOIN sessions s ON
+			(w.identity_type = 'user_id' AND s.user_id = w.identity)
+			OR (w.identity_type = 'fingerprint' AND s.fingerprint = w.identity)
+		WHERE w.enabled
+			AND s.created_at >= w.created_at
+			AND s.created_at >= NOW() - $1 * INTERVAL '1 millisecond'
+		ON CONFLICT (subscription_id, session_id) DO NOTHING
+	`, lookback.Milliseconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to pin watched sessions: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListUnnotified returns pinned sessions not yet announced that have fewer than
+// maxAttempts failed notifications. Subscriptions without a notify URL are only
+// included when withoutURL is set, i.e. a default URL is configured.
+func (r *WatchlistRepository) ListUnnotified(ctx context.Context, maxAttempts int, withoutURL bool, limit int) ([]*models.WatchMatch, error) {
+	query := `
+		SELECT ` + watchSubscriptionColumns + `, ws.notify_attempts,
+			` + watchedSessionColumns + `
+		FROM watched_sessions ws
+		JOIN watch_subscriptions w ON w.subscription_id = ws.subscription_id
+		JOIN sessions s ON s.session_id = ws.session_id
+		WHERE ws.notified_at IS NULL AND ws.notify_attempts < $1
+			AND (w.notify_url IS NOT NULL OR $2)
+		ORDER BY ws.matched_at ASC
+		LIMIT $3
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, maxAttempts, withoutURL, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unnotified watched sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []*models.WatchMatch
+	for rows.Next() {
+		m := &models.WatchMatch{}
+		w := &m.Subscription
+		dest := append([]interface{}{
+			&w.SubscriptionID, &w.IdentityType, &w.Identity, &w.Label, &w.NotifyURL, &w.Enabled,
+			&w.CreatedAt, &w.UpdatedAt, &m.Attempts,
+		}, watchedSessionDest(&m.Session)...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan watched session: %w", err)
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// RecordNotification records a notification attempt; a nil notifyErr marks the
+// session as announced
+func (r *WatchlistRepository) RecordNotification(ctx context.Context, subscriptionID, sessionID uuid.UUID, notifyErr error) error {
+	var errStr *string
+	if notifyErr != nil {
+		s := notifyErr.Error()
+		errStr = &s
+	}
+
+	_, err := r.db.Pool.Exec(ctx, `
+		UPDATE watched_sessions SET
+			notify_attempts = notify_attempts + 1,
+			notify_error = $3,
+			notified_at = CASE WHEN $3::text IS NULL THEN NOW() END
+		WHERE subscription_id = $1 AND session_id = $2
+	`, subscriptionID, sessionID, errStr)
+	if err != nil {
+		return fmt.Errorf("failed to record watchlist notification: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+// Package requestid carries the correlation ID of an HTTP request through contexts and
+// queued messages, so background work can be traced back to the request behind it.
+package requestid
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// Header is the request and response header carrying the ID
+const Header = "X-Request-ID"
+
+// pattern bounds IDs accepted from clients and proxies, which end up in logs
+var pattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type contextKey struct{}
+
+// New returns a fresh request ID
+func New() string {
+	return uuid.NewString()
+}
+
+// Valid reports whether id may be used as a request ID
+func Valid(id string) bool {
+	return pattern.MatchString(id)
+}
+
+// NewContext returns ctx carrying id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, or ""
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,92 @@
+// Package retention deletes data ahead of the database's global retention policy.
+package retention
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// Expirer periodically deletes events whose SDK-provided TTL has passed. Each run
+// deletes in batches of batchSize until no expired events remain.
+type Expirer struct {
+	eventRepo *repository.EventRepository
+	interval  time.Duration
+	batchSize int
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewExpirer creates an event expirer
+func NewExpirer(eventRepo *repository.EventRepository, interval time.Duration, batchSize int) *Expirer {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	return &Expirer{
+		eventRepo: eventRepo,
+		interval:  interval,
+		batchSize: batchSize,
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// Start runs the expiry loop in the background
+func (e *Expirer) Start(ctx context.Context) {
+	e.wg.Add(1)
+	go e.run(ctx)
+}
+
+// Stop stops the loop, waiting for a running batch to finish
+func (e *Expirer) Stop() {
+	close(e.stopChan)
+	e.wg.Wait()
+}
+
+func (e *Expirer) run(ctx context.Context) {
+	defer e.wg.Done()
+
+	log.Printf("[Retention] Event expirer started, interval: %v", e.interval)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stopChan:
+			log.Println("[Retention] Event expirer stopped")
+			return
+		case <-ticker.C:
+			e.expire(ctx)
+		}
+	}
+}
+
+// expire deletes expired events batch by batch, yielding to Stop between batches
+func (e *Expirer) expire(ctx context.Context) {
+	var total int64
+	for {
+		n, err := e.eventRepo.DeleteExpired(ctx, e.batchSize)
+		if err != nil {
+			log.Printf("[Retention] %v", err)
+			break
+		}
+		total += n
+		if n < int64(e.batchSize) {
+			break
+		}
+
+		select {
+		case <-e.stopChan:
+			log.Printf("[Retention] Deleted %d expired events before stopping", total)
+			return
+		default:
+		}
+	}
+
+	if total > 0 {
+		log.Printf("[Retention] Deleted %d expired events", total)
+	}
+}
@@ -0,0 +1,112 @@
+package retention
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/cron"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/storage"
+)
+
+// SandboxPurger deletes sandbox sessions, with their events and screenshots, once
+// they are older than maxAge. Objects of blob-stored screenshots are deleted from the
+// store after their rows. It runs on a cron schedule, nightly by default; every
+// instance may run it, deleting twice is harmless.
+type SandboxPurger struct {
+	sessionRepo *repository.SessionRepository
+	store       storage.Store
+	schedule    *cron.Schedule
+	maxAge      time.Duration
+	batchSize   int
+	stopChan    chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewSandboxPurger creates a purger running at each time of schedule; store may be nil
+// when blob storage is not configured
+func NewSandboxPurger(sessionRepo *repository.SessionRepository, store storage.Store, schedule *cron.Schedule, maxAge time.Duration, batchSize int) *SandboxPurger {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	return &SandboxPurger{
+		sessionRepo: sessionRepo,
+		store:       store,
+		schedule:    schedule,
+		maxAge:      maxAge,
+		batchSize:   batchSize,
+		stopChan:    make(chan struct{}),
+	}
+}
+
+// Start runs the purge loop in the background
+func (p *SandboxPurger) Start(ctx context.Context) {
+	p.wg.Add(1)
+	go p.run(ctx)
+}
+
+// Stop stops the loop, waiting for a running batch to finish
+func (p *SandboxPurger) Stop() {
+	close(p.stopChan)
+	p.wg.Wait()
+}
+
+func (p *SandboxPurger) run(ctx context.Context) {
+	defer p.wg.Done()
+
+	for {
+		next := p.schedule.Next(time.Now())
+		log.Printf("[Retention] Next sandbox purge at %s", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-p.stopChan:
+			timer.Stop()
+			log.Println("[Retention] Sandbox purger stopped")
+			return
+		case <-timer.C:
+			p.purge(ctx)
+		}
+	}
+}
+
+// purge deletes old sandbox sessions batch by batch, yielding to Stop between batches
+func (p *SandboxPurger) purge(ctx context.Context) {
+	before := time.Now().Add(-p.maxAge)
+	var total int64
+	for {
+		n, storageKeys, err := p.sessionRepo.DeleteSandbox(ctx, before, p.batchSize)
+		if err != nil {
+			log.Printf("[Retention] %v", err)
+			break
+		}
+		p.deleteObjects(ctx, storageKeys)
+		total += n
+		if n < int64(p.batchSize) {
+			break
+		}
+
+		select {
+		case <-p.stopChan:
+			log.Printf("[Retention] Purged %d sandbox sessions before stopping", total)
+			return
+		default:
+		}
+	}
+	log.Printf("[Retention] Purged %d sandbox sessions started before %s", total, before.Format(time.RFC3339))
+}
+
+// deleteObjects removes the blobs of purged screenshots. A failed delete only leaves
+// an orphaned object, which the blob cleanup job finds.
+func (p *SandboxPurger) deleteObjects(ctx context.Context, storageKeys []string) {
+	if p.store == nil {
+		return
+	}
+	for _, key := range storageKeys {
+		if err := p.store.Delete(ctx, key); err != nil {
+			log.Printf("[Retention] Failed to delete screenshot blob %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Package sessioncheck verifies at ingest that events are sent for a session that
+// exists. Without it a mistyped or made-up session ID is queued like any other, and
+// its events only fail once the processor writes them.
+package sessioncheck
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/redis/go-redis/v9"
+)
+
+// Modes selectable with SESSION_CHECK_MODE
+const (
+	ModeOff    = "off"
+	ModeFlag   = "flag"
+	ModeReject = "reject"
+)
+
+const keyPrefix = "session:known:"
+
+// CheckMode returns an error unless mode names a check mode
+func CheckMode(mode string) error {
+	switch mode {
+	case ModeOff, ModeFlag, ModeReject:
+		return nil
+	}
+	return fmt.Errorf("unknown session check mode %q; use %q, %q or %q", mode, ModeOff, ModeFlag, ModeReject)
+}
+
+// Checker remembers the IDs of sessions found in the database in Redis for a TTL, so
+// a session costs one database lookup per TTL however many batches it sends. Unknown
+// IDs are not remembered, so made-up ones cannot grow the cache, and a session
+// created after a miss is found on the next batch. A nil *Checker knows every session.
+type Checker struct {
+	redis       *redis.Client
+	sessionRepo *repository.SessionRepository
+	ttl         time.Duration
+	mode        string
+}
+
+// NewChecker creates a checker backed by client; it returns nil in ModeOff
+func NewChecker(client *redis.Client, sessionRepo *repository.SessionRepository, ttl time.Duration, mode string) *Checker {
+	if mode == ModeOff {
+		return nil
+	}
+	return &Checker{redis: client, sessionRepo: sessionRepo, ttl: ttl, mode: mode}
+}
+
+// Rejects reports whether events of unknown sessions should be refused rather than
+// flagged
+func (c *Checker) Rejects() bool {
+	return c != nil && c.mode == ModeReject
+}
+
+func key(sessionID uuid.UUID) string {
+	return keyPrefix + sessionID.String()
+}
+
+// Known reports whether sessionID exists. When Redis or the database fails the
+// session counts as known: ingest must not fail on the check, and the processor
+// still dead-letters events of sessions that do not exist.
+func (c *Checker) Known(ctx context.Context, sessionID uuid.UUID) bool {
+	if c == nil {
+		return true
+	}
+
+	n, err := c.redis.Exists(ctx, key(sessionID)).Result()
+	if err == nil && n > 0 {
+		return true
+	}
+	if err != nil {
+		log.Printf("[SessionCheck] Failed to look up session %s in Redis: %v", sessionID, err)
+	}
+
+	exists, err := c.sessionRepo.Exists(ctx, sessionID)
+	if err != nil {
+		log.Printf("[SessionCheck] Failed to check session %s, accepting it: %v", sessionID, err)
+		return true
+	}
+	if !exists {
+		return false
+	}
+
+	if err := c.redis.Set(ctx, key(sessionID), time.Now().Unix(), c.ttl).Err(); err != nil {
+		log.Printf("[SessionCheck] Failed to remember session %s: %v", sessionID, err)
+	}
+	return true
+}
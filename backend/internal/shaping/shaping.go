@@ -0,0 +1,92 @@
+// Package shaping bounds the rate of high-frequency events (mousemove, scroll) the
+// server accepts, whatever throttle the SDK was configured with.
+package shaping
+
+import (
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// Throttles are the minimum intervals between two mousemove and two scroll events of
+// one tab. SDKs are told to send at most this often; Shaper enforces a floor.
+type Throttles struct {
+	MouseMove time.Duration
+	Scroll    time.Duration
+}
+
+// Millis is the form returned to SDKs by the tracker config endpoint
+func (t Throttles) Millis() map[string]int64 {
+	return map[string]int64{
+		"mousemove_throttle_ms": t.MouseMove.Milliseconds(),
+		"scroll_throttle_ms":    t.Scroll.Milliseconds(),
+	}
+}
+
+// AtLeast returns t with each interval raised to floor's where it is shorter
+func (t Throttles) AtLeast(floor Throttles) Throttles {
+	return Throttles{
+		MouseMove: max(t.MouseMove, floor.MouseMove),
+		Scroll:    max(t.Scroll, floor.Scroll),
+	}
+}
+
+// Shaper drops mousemove and scroll events that follow the previous kept event of the
+// same type, tab and frame by less than the minimum interval. Only events within one
+// batch are compared. A zero interval leaves that type alone.
+type Shaper struct {
+	min Throttles
+}
+
+// NewShaper creates a shaper enforcing min
+func NewShaper(min Throttles) *Shaper {
+	return &Shaper{min: min}
+}
+
+// Min returns the enforced intervals
+func (s *Shaper) Min() Throttles {
+	return s.min
+}
+
+type streamKey struct {
+	eventType models.EventType
+	tab       string
+	frame     string
+}
+
+// Apply filters a batch and returns the events to keep and how many were dropped.
+// Events are compared in batch order, which SDKs send in time order.
+func (s *Shaper) Apply(events []models.EventData) ([]models.EventData, int) {
+	if s == nil || (s.min.MouseMove <= 0 && s.min.Scroll <= 0) {
+		return events, 0
+	}
+
+	last := make(map[streamKey]time.Time)
+	kept := events[:0]
+	dropped := 0
+	for _, event := range events {
+		var interval time.Duration
+		switch event.EventType {
+		case models.EventTypeMouseMove:
+			interval = s.min.MouseMove
+		case models.EventTypeScroll:
+			interval = s.min.Scroll
+		}
+		if interval > 0 {
+			key := streamKey{eventType: event.EventType}
+			if event.TabID != nil {
+				key.tab = *event.TabID
+			}
+			if event.FramePath != nil {
+				key.frame = *event.FramePath
+			}
+			if prev, ok := last[key]; ok && event.Timestamp.Sub(prev) < interval && !event.Timestamp.Before(prev) {
+				dropped++
+				continue
+			}
+			last[key] = event.Timestamp
+		}
+		kept = append(kept, event)
+	}
+	return kept, dropped
+}
@@ -0,0 +1,152 @@
+package stats
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reasons events are dropped in degrade mode
+const (
+	DropEnqueueFailed = "enqueue_failed"
+	DropRateLimited   = "rate_limited"
+)
+
+// DropCount is the number of events dropped for one project and reason since the
+// process started
+type DropCount struct {
+	Project string `json:"project"`
+	Reason  string `json:"reason"`
+	Count   int64  `json:"count"`
+}
+
+type dropKey struct {
+	project string
+	reason  string
+}
+
+// DropCounter counts events the degrade mode dropped instead of failing ingest
+// requests. Counts are kept in memory, since Redis may be what is failing, and are
+// added to the ingest stats as StageDropped once Redis accepts them. A nil
+// *DropCounter means degrade mode is off.
+type DropCounter struct {
+	counters *IngestCounters
+	interval time.Duration
+
+	mu      sync.Mutex
+	totals  map[dropKey]int64
+	pending map[string]int64
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewDropCounter creates a counter that moves pending drops into counters every
+// interval. counters may be nil to keep drops in memory only.
+func NewDropCounter(counters *IngestCounters, interval time.Duration) *DropCounter {
+	return &DropCounter{
+		counters: counters,
+		interval: interval,
+		totals:   make(map[dropKey]int64),
+		pending:  make(map[string]int64),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Record counts n events of project dropped for reason
+func (d *DropCounter) Record(project, reason string, n int) {
+	if d == nil || n <= 0 {
+		return
+	}
+
+	d.mu.Lock()
+	d.totals[dropKey{project, reason}] += int64(n)
+	d.pending[project] += int64(n)
+	d.mu.Unlock()
+}
+
+// Snapshot returns the drop counts since the process started, sorted by project and reason
+func (d *DropCounter) Snapshot() []DropCount {
+	if d == nil {
+		return []DropCount{}
+	}
+
+	d.mu.Lock()
+	counts := make([]DropCount, 0, len(d.totals))
+	for key, count := range d.totals {
+		counts = append(counts, DropCount{Project: key.project, Reason: key.reason, Count: count})
+	}
+	d.mu.Unlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Project != counts[j].Project {
+			return counts[i].Project < counts[j].Project
+		}
+		return counts[i].Reason < counts[j].Reason
+	})
+	return counts
+}
+
+// Start runs the flush loop in the background
+func (d *DropCounter) Start(ctx context.Context) {
+	if d == nil {
+		return
+	}
+	d.wg.Add(1)
+	go d.run(ctx)
+}
+
+// Stop flushes one last time and stops the loop
+func (d *DropCounter) Stop() {
+	if d == nil {
+		return
+	}
+	close(d.stopChan)
+	d.wg.Wait()
+}
+
+func (d *DropCounter) run(ctx context.Context) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stopChan:
+			d.flush(ctx)
+			return
+		case <-ticker.C:
+			d.flush(ctx)
+		}
+	}
+}
+
+// flush adds pending drops to the ingest stats; counts Redis refuses stay pending
+// for the next tick
+func (d *DropCounter) flush(ctx context.Context) {
+	if d.counters == nil {
+		return
+	}
+
+	d.mu.Lock()
+	pending := make(map[string]int64, len(d.pending))
+	for project, n := range d.pending {
+		pending[project] = n
+	}
+	d.mu.Unlock()
+
+	for project, n := range pending {
+		if err := d.counters.incr(ctx, project, StageDropped, n); err != nil {
+			log.Printf("[IngestStats] Failed to count %d dropped events, retrying later: %v", n, err)
+			continue
+		}
+		d.mu.Lock()
+		if d.pending[project] -= n; d.pending[project] <= 0 {
+			delete(d.pending, project)
+		}
+		d.mu.Unlock()
+	}
+}
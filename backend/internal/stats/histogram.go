@@ -0,0 +1,101 @@
+package stats
+
+import (
+	"sort"
+	"sync"
+)
+
+// HistogramBucket is the number of observations less than or equal to LE
+type HistogramBucket struct {
+	LE    float64 `json:"le"`
+	Count uint64  `json:"count"`
+}
+
+// HistogramSnapshot is a histogram's state. Buckets are cumulative, as in Prometheus;
+// observations above the last bound are only in Count. Quantiles are the upper bound of
+// the bucket they fall in, capped at Max, so they overestimate by at most one bucket.
+type HistogramSnapshot struct {
+	Count   uint64            `json:"count"`
+	Sum     float64           `json:"sum"`
+	Mean    float64           `json:"mean"`
+	Max     float64           `json:"max"`
+	P50     float64           `json:"p50"`
+	P90     float64           `json:"p90"`
+	P99     float64           `json:"p99"`
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+// Histogram counts observations in fixed buckets. It is safe for concurrent use.
+type Histogram struct {
+	bounds []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+	max    float64
+}
+
+// NewHistogram creates a histogram with the given bucket upper bounds
+func NewHistogram(bounds ...float64) *Histogram {
+	sorted := append([]float64(nil), bounds...)
+	sort.Float64s(sorted)
+	return &Histogram{
+		bounds: sorted,
+		counts: make([]uint64, len(sorted)),
+	}
+}
+
+// Observe records one value
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+	if v > h.max || h.count == 1 {
+		h.max = v
+	}
+}
+
+// Snapshot returns the observations recorded so far
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := HistogramSnapshot{
+		Count:   h.count,
+		Sum:     h.sum,
+		Max:     h.max,
+		Buckets: make([]HistogramBucket, len(h.bounds)),
+	}
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		snapshot.Buckets[i] = HistogramBucket{LE: bound, Count: cumulative}
+	}
+	if h.count > 0 {
+		snapshot.Mean = h.sum / float64(h.count)
+		snapshot.P50 = h.quantile(snapshot.Buckets, 0.5)
+		snapshot.P90 = h.quantile(snapshot.Buckets, 0.9)
+		snapshot.P99 = h.quantile(snapshot.Buckets, 0.99)
+	}
+	return snapshot
+}
+
+func (h *Histogram) quantile(buckets []HistogramBucket, q float64) float64 {
+	rank := uint64(q * float64(h.count))
+	if rank == 0 {
+		rank = 1
+	}
+	for _, b := range buckets {
+		if b.Count >= rank {
+			return min(b.LE, h.max)
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,210 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/redis/go-redis/v9"
+)
+
+// Ingest pipeline stages counted per project and hour
+const (
+	StageReceived      = "received"
+	StageRejected      = "rejected"
+	StageEnqueued      = "enqueued"
+	StagePersisted     = "persisted"
+	StagePersistFailed = "persist_failed"
+	// Events moved to the dead-letter stream after a permanent persist failure
+	StageDeadLettered = "dead_lettered"
+	// Events dropped by the degrade mode instead of failing the request
+	StageDropped = "dropped"
+	// Mousemove and scroll events dropped for exceeding the server-side rate ceiling
+	StageThrottled = "throttled"
+	// Events of a batch the SDK sent again, ignored by their batch_id
+	StageDuplicate = "duplicate"
+
+	// Shadow ingestion outcomes, counted per sampled event
+	StageShadowMatched    = "shadow_matched"
+	StageShadowMismatched = "shadow_mismatched"
+	StageShadowFailed     = "shadow_failed"
+)
+
+// DefaultProject is used until events carry a project identifier
+const DefaultProject = "default"
+
+// SandboxProject counts events of sandbox tracker keys apart from DefaultProject, so
+// they stay out of usage figures
+const SandboxProject = "sandbox"
+
+type projectContextKey struct{}
+
+// NewProjectContext returns ctx carrying the project its ingest is counted under
+func NewProjectContext(ctx context.Context, project string) context.Context {
+	return context.WithValue(ctx, projectContextKey{}, project)
+}
+
+// ProjectFromContext returns the project carried by ctx, or DefaultProject
+func ProjectFromContext(ctx context.Context) string {
+	if project, ok := ctx.Value(projectContextKey{}).(string); ok && project != "" {
+		return project
+	}
+	return DefaultProject
+}
+
+const (
+	keyPrefix  = "ingest:stats:"
+	bucketsKey = "ingest:stats:buckets"
+	// keyTTL keeps a bucket's counters in Redis long enough for late increments and
+	// a final flush after the hour has closed
+	keyTTL = 48 * time.Hour
+)
+
+// IngestCounters counts events at each pipeline stage in Redis hashes keyed by
+// project and hour. A nil *IngestCounters is a no-op so counting stays optional.
+type IngestCounters struct {
+	redis *redis.Client
+}
+
+// NewIngestCounters creates counters backed by client
+func NewIngestCounters(client *redis.Client) *IngestCounters {
+	return &IngestCounters{redis: client}
+}
+
+// Add increments stage by n for project in the current hour. Failures are logged
+// only: counting must never fail ingestion.
+func (ic *IngestCounters) Add(ctx context.Context, project, stage string, n int) {
+	if ic == nil || n <= 0 {
+		return
+	}
+
+	if err := ic.incr(ctx, project, stage, int64(n)); err != nil {
+		log.Printf("[IngestStats] Failed to count %d %s events: %v", n, stage, err)
+	}
+}
+
+func (ic *IngestCounters) incr(ctx context.Context, project, stage string, n int64) error {
+	key := bucketKey(project, time.Now().UTC().Truncate(time.Hour))
+	pipe := ic.redis.Pipeline()
+	pipe.HIncrBy(ctx, key, stage, n)
+	pipe.Expire(ctx, key, keyTTL)
+	pipe.SAdd(ctx, bucketsKey, key)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func bucketKey(project string, bucket time.Time) string {
+	return fmt.Sprintf("%s%s:%d", keyPrefix, project, bucket.Unix())
+}
+
+func parseBucketKey(key string) (string, time.Time, error) {
+	rest := strings.TrimPrefix(key, keyPrefix)
+	i := strings.LastIndex(rest, ":")
+	if i < 0 {
+		return "", time.Time{}, fmt.Errorf("malformed stats key: %s", key)
+	}
+	var unix int64
+	if _, err := fmt.Sscanf(rest[i+1:], "%d", &unix); err != nil {
+		return "", time.Time{}, fmt.Errorf("malformed stats key: %s", key)
+	}
+	return rest[:i], time.Unix(unix, 0).UTC(), nil
+}
+
+// Flusher periodically copies the Redis counters into the ingest_stats table.
+// Counters are running totals per bucket, so every flush overwrites the row and
+// repeated flushes are idempotent.
+type Flusher struct {
+	redis     *redis.Client
+	statsRepo *repository.IngestStatsRepository
+	interval  time.Duration
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewFlusher creates a new counter flusher
+func NewFlusher(client *redis.Client, statsRepo *repository.IngestStatsRepository, interval time.Duration) *Flusher {
+	return &Flusher{
+		redis:     client,
+		statsRepo: statsRepo,
+		interval:  interval,
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// Start runs the flush loop in the background
+func (f *Flusher) Start(ctx context.Context) {
+	f.wg.Add(1)
+	go f.run(ctx)
+}
+
+// Stop flushes one last time and stops the loop
+func (f *Flusher) Stop() {
+	close(f.stopChan)
+	f.wg.Wait()
+}
+
+func (f *Flusher) run(ctx context.Context) {
+	defer f.wg.Done()
+
+	log.Printf("[IngestStats] Flusher started, interval: %v", f.interval)
+
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stopChan:
+			f.flush(ctx)
+			log.Println("[IngestStats] Flusher stopped")
+			return
+		case <-ticker.C:
+			f.flush(ctx)
+		}
+	}
+}
+
+// flush writes every tracked bucket and forgets buckets that closed over an hour ago
+func (f *Flusher) flush(ctx context.Context) {
+	keys, err := f.redis.SMembers(ctx, bucketsKey).Result()
+	if err != nil {
+		log.Printf("[IngestStats] Error listing buckets: %v", err)
+		return
+	}
+
+	cutoff := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+	for _, key := range keys {
+		project, bucket, err := parseBucketKey(key)
+		if err != nil {
+			log.Printf("[IngestStats] %v", err)
+			f.redis.SRem(ctx, bucketsKey, key)
+			continue
+		}
+
+		values, err := f.redis.HGetAll(ctx, key).Result()
+		if err != nil {
+			log.Printf("[IngestStats] Error reading %s: %v", key, err)
+			continue
+		}
+
+		counts := make(map[string]int64, len(values))
+		for stage, value := range values {
+			var n int64
+			if _, err := fmt.Sscanf(value, "%d", &n); err == nil {
+				counts[stage] = n
+			}
+		}
+
+		if err := f.statsRepo.Upsert(ctx, project, bucket, counts); err != nil {
+			log.Printf("[IngestStats] Error flushing %s: %v", key, err)
+			continue
+		}
+
+		if bucket.Before(cutoff) {
+			f.redis.SRem(ctx, bucketsKey, key)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const rejectionsKeyPrefix = "ingest:errors:"
+
+// Rejection is one ingest request refused with a 4xx, as the SDK saw it
+type Rejection struct {
+	At        time.Time `json:"at"`
+	Status    int       `json:"status"`
+	Error     string    `json:"error"`
+	Details   string    `json:"details,omitempty"`
+	Events    int       `json:"events"`
+	SDK       string    `json:"sdk,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// RejectionLog keeps the last rejected ingest requests of each tracker key in capped
+// Redis lists, so SDK developers can see why batches fail without server logs.
+// Requests without a tracker token are kept under uuid.Nil. A nil *RejectionLog
+// records nothing.
+type RejectionLog struct {
+	redis *redis.Client
+	size  int64
+	ttl   time.Duration
+}
+
+// NewRejectionLog creates a log keeping the last size rejections per key; a key's
+// list expires ttl after its last rejection
+func NewRejectionLog(client *redis.Client, size int, ttl time.Duration) *RejectionLog {
+	return &RejectionLog{redis: client, size: int64(size), ttl: ttl}
+}
+
+// Record adds r to the log of keyID. Failures are logged only: recording must never
+// change the response of the rejected request.
+func (l *RejectionLog) Record(ctx context.Context, keyID uuid.UUID, r Rejection) {
+	if l == nil {
+		return
+	}
+
+	payload, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("[IngestErrors] Failed to encode rejection: %v", err)
+		return
+	}
+
+	key := rejectionsKey(keyID)
+	pipe := l.redis.Pipeline()
+	pipe.LPush(ctx, key, payload)
+	pipe.LTrim(ctx, key, 0, l.size-1)
+	pipe.Expire(ctx, key, l.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[IngestErrors] Failed to record rejection: %v", err)
+	}
+}
+
+// List returns up to limit rejections of keyID, newest first
+func (l *RejectionLog) List(ctx context.Context, keyID uuid.UUID, limit int) ([]Rejection, error) {
+	rejections := []Rejection{}
+	if l == nil {
+		return rejections, nil
+	}
+
+	values, err := l.redis.LRange(ctx, rejectionsKey(keyID), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rejections: %w", err)
+	}
+	for _, value := range values {
+		var r Rejection
+		if err := json.Unmarshal([]byte(value), &r); err != nil {
+			continue
+		}
+		rejections = append(rejections, r)
+	}
+	return rejections, nil
+}
+
+// Size is the number of rejections kept per key
+func (l *RejectionLog) Size() int {
+	if l == nil {
+		return 0
+	}
+	return int(l.size)
+}
+
+func rejectionsKey(keyID uuid.UUID) string {
+	return rejectionsKeyPrefix + keyID.String()
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FilesystemStore keeps blobs as files under a root directory
+type FilesystemStore struct {
+	root string
+}
+
+// NewFilesystemStore creates the root directory if needed
+func NewFilesystemStore(root string) (*FilesystemStore, error) {
+	if root == "" {
+		return nil, fmt.Errorf("blob storage directory is required")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob storage directory: %w", err)
+	}
+	return &FilesystemStore{root: root}, nil
+}
+
+// Put writes the blob atomically via a temporary file
+func (fs *FilesystemStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to move blob into place: %w", err)
+	}
+
+	return nil
+}
+
+// Get reads a blob
+func (fs *FilesystemStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+
+	return data, nil
+}
+
+// Delete removes a blob; deleting a missing key is not an error
+func (fs *FilesystemStore) Delete(ctx context.Context, key string) error {
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+
+	return nil
+}
+
+// List walks the directory of prefix. Temporary files of writes in progress are
+// skipped.
+func (fs *FilesystemStore) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	dir := fs.root
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		var err error
+		if dir, err = fs.path(prefix[:i]); err != nil {
+			return err
+		}
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(fs.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		return fn(ObjectInfo{Key: key, Size: info.Size(), ModifiedAt: info.ModTime()})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list blobs: %w", err)
+	}
+	return nil
+}
+
+// path resolves a key inside the root, rejecting keys that escape it
+func (fs *FilesystemStore) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if cleaned == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid blob key: %q", key)
+	}
+	return filepath.Join(fs.root, cleaned), nil
+}
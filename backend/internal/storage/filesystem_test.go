@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestFilesystemStoreListsPrefix(t *testing.T) {
+	store, err := NewFilesystemStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, key := range []string{"screenshots/a/1.png", "screenshots/b/2.jpeg", "archives/a.jsonl"} {
+		if err := store.Put(ctx, key, []byte("x"), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A write still in progress is not an object yet
+	if err := os.WriteFile(filepath.Join(store.root, "screenshots/a/3.png.tmp"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	err = store.List(ctx, "screenshots/", func(object ObjectInfo) error {
+		keys = append(keys, object.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "screenshots/a/1.png" || keys[1] != "screenshots/b/2.jpeg" {
+		t.Errorf("List(screenshots/) = %v", keys)
+	}
+
+	if err := store.List(ctx, "missing/", func(ObjectInfo) error { return nil }); err != nil {
+		t.Errorf("List of a missing prefix: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned when a key does not exist in the store
+var ErrNotFound = errors.New("blob not found")
+
+// Store persists binary objects (screenshots, archives) outside the database
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Config selects and configures a blob storage backend
+type Config struct {
+	// Backend is "fs" or "s3"; empty disables blob storage
+	Backend string
+
+	// Filesystem backend
+	Dir string
+
+	// S3-compatible backend
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+}
+
+// New creates the store described by config, or nil when blob storage is disabled
+func New(config Config) (Store, error) {
+	switch config.Backend {
+	case "":
+		return nil, nil
+	case "fs":
+		return NewFilesystemStore(config.Dir)
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:        config.S3Endpoint,
+			Region:          config.S3Region,
+			Bucket:          config.S3Bucket,
+			AccessKeyID:     config.S3AccessKeyID,
+			SecretAccessKey: config.S3SecretAccessKey,
+		})
+	default:
+		return nil, fmt.Errorf("unknown blob storage backend: %s", config.Backend)
+	}
+}
+
+// URLSigner is implemented by stores that can hand out time-limited direct download URLs
+type URLSigner interface {
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// ObjectInfo describes a stored object as listed by a Lister
+type ObjectInfo struct {
+	Key        string
+	Size       int64
+	ModifiedAt time.Time
+}
+
+// Lister is implemented by stores that can enumerate their objects, e.g. to find
+// objects nothing references any more
+type Lister interface {
+	// List calls fn for every object whose key starts with prefix, stopping at the
+	// first error fn returns
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+}
@@ -0,0 +1,81 @@
+package trackertoken
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+type keyState struct {
+	revoked         bool
+	sandbox         bool
+	tokensNotBefore time.Time
+	fetchedAt       time.Time
+}
+
+// KeyCache answers whether a token's tracker key still accepts it, caching key state
+// for ttl so revocation and rotation take effect within ttl without a database query
+// per ingest request
+type KeyCache struct {
+	repo *repository.TrackerKeyRepository
+	ttl  time.Duration
+
+	mu   sync.Mutex
+	keys map[uuid.UUID]keyState
+}
+
+func NewKeyCache(repo *repository.TrackerKeyRepository, ttl time.Duration) *KeyCache {
+	return &KeyCache{
+		repo: repo,
+		ttl:  ttl,
+		keys: make(map[uuid.UUID]keyState),
+	}
+}
+
+// Accepts reports whether tokens of the key issued at issuedAt are still valid: the
+// key exists, is not revoked, and has not been rotated since
+func (k *KeyCache) Accepts(ctx context.Context, keyID uuid.UUID, issuedAt time.Time) (bool, error) {
+	k.mu.Lock()
+	state, ok := k.keys[keyID]
+	k.mu.Unlock()
+
+	if !ok || time.Since(state.fetchedAt) > k.ttl {
+		key, err := k.repo.GetByID(ctx, keyID)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			state = keyState{revoked: true}
+		case err != nil:
+			return false, err
+		default:
+			state = keyState{revoked: key.RevokedAt != nil, sandbox: key.Sandbox, tokensNotBefore: key.TokensNotBefore}
+		}
+		state.fetchedAt = time.Now()
+
+		k.mu.Lock()
+		k.keys[keyID] = state
+		k.mu.Unlock()
+	}
+
+	// Token timestamps have second precision
+	return !state.revoked && !issuedAt.Before(state.tokensNotBefore.Truncate(time.Second)), nil
+}
+
+// Sandbox reports whether the key is a sandbox key, as of the state cached by the last
+// Accepts; unknown keys are not
+func (k *KeyCache) Sandbox(keyID uuid.UUID) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.keys[keyID].sandbox
+}
+
+// Forget drops the cached state of a key after it was rotated or revoked through
+// this instance
+func (k *KeyCache) Forget(keyID uuid.UUID) {
+	k.mu.Lock()
+	delete(k.keys, keyID)
+	k.mu.Unlock()
+}
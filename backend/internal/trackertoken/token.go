@@ -0,0 +1,127 @@
+// Package trackertoken issues and verifies the short-lived signed tokens the tracker
+// SDK sends to ingest routes, so no long-lived secret has to live in the browser.
+package trackertoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMalformed     = errors.New("malformed tracker token")
+	ErrUnknownSecret = errors.New("tracker token signed with an unknown secret")
+	ErrSignature     = errors.New("invalid tracker token signature")
+	ErrExpired       = errors.New("tracker token expired")
+)
+
+// Claims are the signed contents of a token
+type Claims struct {
+	KeyID     uuid.UUID `json:"k"`
+	Origin    string    `json:"o,omitempty"`
+	IssuedAt  int64     `json:"iat"`
+	ExpiresAt int64     `json:"exp"`
+}
+
+// Issued returns the time the token was issued
+func (c *Claims) Issued() time.Time {
+	return time.Unix(c.IssuedAt, 0)
+}
+
+// Signer signs tokens with the current secret and verifies them against every
+// configured secret, so secrets can be rotated without invalidating live tokens.
+// Tokens are "<secret id>.<base64url claims>.<base64url HMAC-SHA256>".
+type Signer struct {
+	current string
+	secrets map[string][]byte
+	ttl     time.Duration
+}
+
+// NewSigner parses a comma-separated list of "id:secret" pairs; the first signs new
+// tokens, the others only verify. An empty spec returns nil: tracker tokens are disabled.
+func NewSigner(spec string, ttl time.Duration) (*Signer, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	s := &Signer{secrets: make(map[string][]byte), ttl: ttl}
+	for _, pair := range strings.Split(spec, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" || secret == "" || strings.Contains(id, ".") {
+			return nil, fmt.Errorf("invalid tracker token secret %q: expected id:secret", pair)
+		}
+		if _, dup := s.secrets[id]; dup {
+			return nil, fmt.Errorf("duplicate tracker token secret id %q", id)
+		}
+		s.secrets[id] = []byte(secret)
+		if s.current == "" {
+			s.current = id
+		}
+	}
+	return s, nil
+}
+
+// TTL returns how long issued tokens are valid
+func (s *Signer) TTL() time.Duration {
+	return s.ttl
+}
+
+// Issue signs a token for the tracker key, bound to the requesting page origin
+func (s *Signer) Issue(keyID uuid.UUID, origin string, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(s.ttl).Truncate(time.Second)
+	payload, err := json.Marshal(Claims{
+		KeyID:     keyID,
+		Origin:    origin,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to encode tracker token: %w", err)
+	}
+
+	signed := s.current + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + s.sign(s.current, signed), expiresAt, nil
+}
+
+// Verify checks the token's signature and expiry and returns its claims. Whether
+// the tracker key is still valid is up to the caller.
+func (s *Signer) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	if _, ok := s.secrets[parts[0]]; !ok {
+		return nil, ErrUnknownSecret
+	}
+
+	expected := s.sign(parts[0], parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return nil, ErrSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrMalformed
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrExpired
+	}
+	return &claims, nil
+}
+
+func (s *Signer) sign(secretID, signed string) string {
+	mac := hmac.New(sha256.New, s.secrets[secretID])
+	mac.Write([]byte(signed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,165 @@
+// Package urlgroup normalizes page URLs with the configured URL rules, so analytics
+// count /order/123 and /order/456?utm_source=x as the same page.
+package urlgroup
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// StripAll in a rule's strip_params removes the whole query string
+const StripAll = "*"
+
+// Rule rewrites a URL. Rules are applied in order, each to the output of the last.
+type Rule interface {
+	Apply(rawURL string) string
+}
+
+// RegexRule replaces every match of Pattern with Replacement, which may refer to
+// capture groups as $1 or ${name}
+type RegexRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+func (r RegexRule) Apply(rawURL string) string {
+	return r.Pattern.ReplaceAllString(rawURL, r.Replacement)
+}
+
+// StripParamsRule removes the named query parameters, or all of them with StripAll.
+// The remaining parameters are sorted so their order does not split a page.
+type StripParamsRule struct {
+	Params []string
+}
+
+func (r StripParamsRule) Apply(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+	query := u.Query()
+	for _, param := range r.Params {
+		if param == StripAll {
+			query = nil
+			break
+		}
+		query.Del(param)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Rules is an ordered list of rules
+type Rules []Rule
+
+// Compile turns stored rules into Rules; a rule that strips parameters and has a
+// pattern becomes two, stripping first
+func Compile(stored []*models.URLRule) (Rules, error) {
+	var rules Rules
+	for _, s := range stored {
+		if len(s.StripParams) > 0 {
+			rules = append(rules, StripParamsRule{Params: s.StripParams})
+		}
+		if s.Pattern != nil {
+			re, err := regexp.Compile(*s.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern in url rule %s: %w", s.RuleID, err)
+			}
+			rules = append(rules, RegexRule{Pattern: re, Replacement: s.Replacement})
+		}
+	}
+	return rules, nil
+}
+
+// Normalize applies the rules in order
+func (r Rules) Normalize(rawURL string) string {
+	for _, rule := range r {
+		rawURL = rule.Apply(rawURL)
+	}
+	return rawURL
+}
+
+type cachedRules struct {
+	rules     Rules
+	fetchedAt time.Time
+}
+
+// Cache holds the compiled rules of each tracker key for ttl, so rule changes apply
+// within ttl without a database query per ingest request
+type Cache struct {
+	repo *repository.URLRuleRepository
+	ttl  time.Duration
+
+	mu   sync.Mutex
+	keys map[uuid.UUID]cachedRules
+}
+
+func NewCache(repo *repository.URLRuleRepository, ttl time.Duration) *Cache {
+	return &Cache{
+		repo: repo,
+		ttl:  ttl,
+		keys: make(map[uuid.UUID]cachedRules),
+	}
+}
+
+// RulesFor returns the rules applied to events of keyID; uuid.Nil gets the global
+// rules only
+func (c *Cache) RulesFor(ctx context.Context, keyID uuid.UUID) (Rules, error) {
+	c.mu.Lock()
+	cached, ok := c.keys[keyID]
+	c.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) <= c.ttl {
+		return cached.rules, nil
+	}
+
+	stored, err := c.repo.ListFor(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := Compile(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.keys[keyID] = cachedRules{rules: rules, fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return rules, nil
+}
+
+// Stamp sets NormalizedURL on events whose page URL the rules of keyID change and
+// clears it on the others. A nil cache clears it on all of them.
+func (c *Cache) Stamp(ctx context.Context, keyID uuid.UUID, events []models.EventData) error {
+	for i := range events {
+		events[i].NormalizedURL = nil
+	}
+	if c == nil {
+		return nil
+	}
+
+	rules, err := c.RulesFor(ctx, keyID)
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		if normalized := rules.Normalize(events[i].PageURL); normalized != events[i].PageURL {
+			events[i].NormalizedURL = &normalized
+		}
+	}
+	return nil
+}
+
+// Forget drops every cached rule list after rules were changed through this instance
+func (c *Cache) Forget() {
+	c.mu.Lock()
+	c.keys = make(map[uuid.UUID]cachedRules)
+	c.mu.Unlock()
+}
@@ -0,0 +1,70 @@
+package validation
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Domain policy modes
+const (
+	DomainModeReject = "reject"
+	DomainModeFlag   = "flag"
+)
+
+// DomainPolicy checks that tracked page URLs belong to the registered domains
+type DomainPolicy struct {
+	domains []string
+	mode    string
+}
+
+// NewDomainPolicy creates a policy from a list of hosts. Entries may be exact hosts
+// ("example.com") or wildcards ("*.example.com", which also matches the apex).
+// An empty list allows every URL.
+func NewDomainPolicy(domains []string, mode string) *DomainPolicy {
+	var cleaned []string
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d != "" {
+			cleaned = append(cleaned, d)
+		}
+	}
+	if mode != DomainModeFlag {
+		mode = DomainModeReject
+	}
+	return &DomainPolicy{domains: cleaned, mode: mode}
+}
+
+// Enabled reports whether any domains are registered
+func (p *DomainPolicy) Enabled() bool {
+	return p != nil && len(p.domains) > 0
+}
+
+// Rejects reports whether mismatching URLs should be refused rather than flagged
+func (p *DomainPolicy) Rejects() bool {
+	return p.mode == DomainModeReject
+}
+
+// Allows reports whether pageURL's host is one of the registered domains
+func (p *DomainPolicy) Allows(pageURL string) bool {
+	if !p.Enabled() {
+		return true
+	}
+
+	u, err := url.Parse(pageURL)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+
+	for _, d := range p.domains {
+		if strings.HasPrefix(d, "*.") {
+			apex := d[2:]
+			if host == apex || strings.HasSuffix(host, "."+apex) {
+				return true
+			}
+		} else if host == d {
+			return true
+		}
+	}
+	return false
+}
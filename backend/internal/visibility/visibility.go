@@ -0,0 +1,95 @@
+// Package visibility decides which session and event fields each API role may see.
+// Handlers pass models through it right before serializing, so the rules live in
+// one place for sessions, events and exports.
+package visibility
+
+import (
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// Role is the caller's access level
+type Role string
+
+const (
+	RoleAdmin  Role = "admin"
+	RoleViewer Role = "viewer"
+)
+
+// Policy lists the sensitive fields a role may see
+type Policy struct {
+	// InputValues shows typed input values and pressed keys
+	InputValues bool
+	// Identifiers shows device fingerprints and client IP addresses
+	Identifiers bool
+}
+
+// Policies maps each role to its field policy; unknown roles get the viewer policy
+var Policies = map[Role]Policy{
+	RoleAdmin:  {InputValues: true, Identifiers: true},
+	RoleViewer: {},
+}
+
+// identifierMetadataKeys are session metadata keys holding client identifiers
+var identifierMetadataKeys = []string{"ip", "ip_address", "client_ip"}
+
+// ParseRole returns the role named s, or RoleViewer for anything unrecognized
+func ParseRole(s string) Role {
+	if _, ok := Policies[Role(s)]; ok {
+		return Role(s)
+	}
+	return RoleViewer
+}
+
+// Policy returns the role's field policy
+func (r Role) Policy() Policy {
+	if p, ok := Policies[r]; ok {
+		return p
+	}
+	return Policies[RoleViewer]
+}
+
+// Session hides the session fields the role may not see, in place
+func Session(role Role, s *models.Session) {
+	if s == nil || role.Policy().Identifiers {
+		return
+	}
+	s.Fingerprint = nil
+	if len(s.Metadata) > 0 {
+		metadata := make(map[string]interface{}, len(s.Metadata))
+		for k, v := range s.Metadata {
+			metadata[k] = v
+		}
+		for _, k := range identifierMetadataKeys {
+			delete(metadata, k)
+		}
+		s.Metadata = metadata
+	}
+}
+
+// Sessions applies Session to each session
+func Sessions(role Role, sessions []*models.Session) {
+	for _, s := range sessions {
+		Session(role, s)
+	}
+}
+
+// SessionSummaries applies Session to each summary
+func SessionSummaries(role Role, summaries []*models.SessionSummary) {
+	for _, s := range summaries {
+		Session(role, &s.Session)
+	}
+}
+
+// Events masks the event fields the role may not see, in place
+func Events(role Role, events []*models.Event) {
+	if role.Policy().InputValues {
+		return
+	}
+	for _, e := range events {
+		if e.InputValue != nil {
+			e.InputValue = nil
+			e.InputMasked = true
+		}
+		e.KeyPressed = nil
+	}
+}
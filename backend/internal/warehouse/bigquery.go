@@ -0,0 +1,399 @@
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	bigQueryAPI       = "https://bigquery.googleapis.com/bigquery/v2"
+	bigQueryUploadAPI = "https://bigquery.googleapis.com/upload/bigquery/v2"
+	bigQueryScope     = "https://www.googleapis.com/auth/bigquery"
+	googleTokenURI    = "https://oauth2.googleapis.com/token"
+
+	// bigQueryJobPoll is how often a load or merge job is polled until it is done
+	bigQueryJobPoll = 2 * time.Second
+)
+
+var bigQueryTypes = map[string]string{
+	TypeString:    "STRING",
+	TypeInteger:   "INT64",
+	TypeFloat:     "FLOAT64",
+	TypeBoolean:   "BOOL",
+	TypeTimestamp: "TIMESTAMP",
+	TypeJSON:      "JSON",
+}
+
+// serviceAccount is the part of a Google service account key file used to sign in
+type serviceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+	ProjectID    string `json:"project_id"`
+}
+
+// bigQuery loads batches with multipart load jobs of newline-delimited JSON, signing
+// in as a service account. Config: dataset (required), project_id (defaults to the
+// service account's), location and table_prefix.
+type bigQuery struct {
+	client  *http.Client
+	account serviceAccount
+	key     *rsa.PrivateKey
+
+	project  string
+	dataset  string
+	location string
+	prefix   string
+
+	token        string
+	tokenExpires time.Time
+}
+
+func newBigQuery(config map[string]string, credentials string) (*bigQuery, error) {
+	if err := requireConfig(config, "dataset"); err != nil {
+		return nil, err
+	}
+
+	var account serviceAccount
+	if err := json.Unmarshal([]byte(credentials), &account); err != nil {
+		return nil, fmt.Errorf("credentials must be a service account key file: %w", err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, errors.New("credentials must be a service account key file with client_email and private_key")
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = googleTokenURI
+	}
+	key, err := parsePrivateKey(account.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	bq := &bigQuery{
+		account:  account,
+		key:      key,
+		project:  config["project_id"],
+		dataset:  config["dataset"],
+		location: config["location"],
+		prefix:   config["table_prefix"],
+	}
+	if bq.project == "" {
+		bq.project = account.ProjectID
+	}
+	if bq.project == "" {
+		return nil, errors.New("config is missing project_id and the service account has none")
+	}
+	if !identifier(bq.dataset) {
+		return nil, fmt.Errorf("dataset %q is not a valid dataset ID", bq.dataset)
+	}
+	if bq.prefix != "" && !identifier(bq.prefix) {
+		return nil, fmt.Errorf("table_prefix %q may only contain letters, digits and underscores", bq.prefix)
+	}
+	return bq, nil
+}
+
+// accessToken returns an OAuth access token, exchanging a signed assertion for a new
+// one when the last is about to expire
+func (bq *bigQuery) accessToken(ctx context.Context) (string, error) {
+	if bq.token != "" && time.Now().Before(bq.tokenExpires) {
+		return bq.token, nil
+	}
+
+	now := time.Now()
+	assertion, err := signJWT(bq.key, map[string]interface{}{"kid": bq.account.PrivateKeyID}, map[string]interface{}{
+		"iss":   bq.account.ClientEmail,
+		"scope": bigQueryScope,
+		"aud":   bq.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, bq.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if _, err := doJSON(bq.client, req, &token); err != nil {
+		return "", fmt.Errorf("failed to get access token: %w", err)
+	}
+	bq.token = token.AccessToken
+	bq.tokenExpires = now.Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return bq.token, nil
+}
+
+// do sends an authorized JSON request to the BigQuery API
+func (bq *bigQuery) do(ctx context.Context, method, endpoint string, body, out interface{}) error {
+	token, err := bq.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := newJSONRequest(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	_, err = doJSON(bq.client, req, out)
+	return err
+}
+
+type bigQueryField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Mode string `json:"mode,omitempty"`
+}
+
+type bigQueryTable struct {
+	TableReference map[string]string `json:"tableReference,omitempty"`
+	Schema         struct {
+		Fields []bigQueryField `json:"fields"`
+	} `json:"schema"`
+	TimePartitioning map[string]string `json:"timePartitioning,omitempty"`
+}
+
+func (bq *bigQuery) tableURL(name string) string {
+	return fmt.Sprintf("%s/projects/%s/datasets/%s/tables/%s", bigQueryAPI,
+		url.PathEscape(bq.project), url.PathEscape(bq.dataset), url.PathEscape(name))
+}
+
+// EnsureTable creates the table partitioned by day, or appends the fields it lacks to
+// its schema; BigQuery only allows new fields to be nullable
+func (bq *bigQuery) EnsureTable(ctx context.Context, table Table) error {
+	name := bq.prefix + table.Name
+
+	// Existing fields are kept as they came, with nested fields and descriptions,
+	// since a patch replaces the whole schema
+	var existing struct {
+		Schema struct {
+			Fields []map[string]interface{} `json:"fields"`
+		} `json:"schema"`
+	}
+	err := bq.do(ctx, http.MethodGet, bq.tableURL(name), nil, &existing)
+	if statusOf(err) == http.StatusNotFound {
+		created := bigQueryTable{TableReference: map[string]string{
+			"projectId": bq.project, "datasetId": bq.dataset, "tableId": name,
+		}}
+		for _, col := range table.Columns {
+			created.Schema.Fields = append(created.Schema.Fields, bigQueryField{Name: col.Name, Type: bigQueryTypes[col.Type], Mode: "NULLABLE"})
+		}
+		if table.Partition != "" {
+			created.TimePartitioning = map[string]string{"type": "DAY", "field": table.Partition}
+		}
+		endpoint := fmt.Sprintf("%s/projects/%s/datasets/%s/tables", bigQueryAPI, url.PathEscape(bq.project), url.PathEscape(bq.dataset))
+		if err := bq.do(ctx, http.MethodPost, endpoint, created, nil); err != nil {
+			return fmt.Errorf("failed to create table %s: %w", name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get table %s: %w", name, err)
+	}
+
+	have := make(map[string]bool, len(existing.Schema.Fields))
+	for _, field := range existing.Schema.Fields {
+		if fieldName, ok := field["name"].(string); ok {
+			have[strings.ToLower(fieldName)] = true
+		}
+	}
+	fields := existing.Schema.Fields
+	for _, col := range table.Columns {
+		if !have[col.Name] {
+			fields = append(fields, map[string]interface{}{"name": col.Name, "type": bigQueryTypes[col.Type], "mode": "NULLABLE"})
+		}
+	}
+	if len(fields) == len(existing.Schema.Fields) {
+		return nil
+	}
+
+	patch := map[string]interface{}{"schema": map[string]interface{}{"fields": fields}}
+	if err := bq.do(ctx, http.MethodPatch, bq.tableURL(name), patch, nil); err != nil {
+		return fmt.Errorf("failed to add columns to table %s: %w", name, err)
+	}
+	return nil
+}
+
+type bigQueryJob struct {
+	Status struct {
+		State       string `json:"state"`
+		ErrorResult *struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"errorResult"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"status"`
+}
+
+// jobReference names a job of the connector's project and location
+func (bq *bigQuery) jobReference(jobID string) map[string]string {
+	ref := map[string]string{"projectId": bq.project, "jobId": jobID}
+	if bq.location != "" {
+		ref["location"] = bq.location
+	}
+	return ref
+}
+
+// Load uploads rows as a load job whose ID is derived from batchID; when a job with
+// that ID already exists the batch was sent before, and that job is awaited instead.
+// Rows of a keyed table are loaded into a table of their own and merged from there
+// by a query job named the same way.
+func (bq *bigQuery) Load(ctx context.Context, table Table, batchID string, rows []Row) error {
+	name := bq.prefix + table.Name
+	jobID := "tracker_" + batchID
+
+	data, err := ndjson(rows)
+	if err != nil {
+		return fmt.Errorf("failed to encode rows: %w", err)
+	}
+
+	load := map[string]interface{}{
+		"destinationTable": map[string]string{
+			"projectId": bq.project, "datasetId": bq.dataset, "tableId": name,
+		},
+		"sourceFormat":      "NEWLINE_DELIMITED_JSON",
+		"writeDisposition":  "WRITE_APPEND",
+		"createDisposition": "CREATE_NEVER",
+	}
+	loadInto := name
+	if table.Key != "" {
+		loadInto = bq.prefix + batchID
+		fields := make([]bigQueryField, len(table.Columns))
+		for i, col := range table.Columns {
+			fields[i] = bigQueryField{Name: col.Name, Type: bigQueryTypes[col.Type], Mode: "NULLABLE"}
+		}
+		load["destinationTable"] = map[string]string{
+			"projectId": bq.project, "datasetId": bq.dataset, "tableId": loadInto,
+		}
+		load["schema"] = map[string]interface{}{"fields": fields}
+		load["writeDisposition"] = "WRITE_TRUNCATE"
+		load["createDisposition"] = "CREATE_IF_NEEDED"
+	}
+	metadata, err := json.Marshal(map[string]interface{}{
+		"jobReference":  bq.jobReference(jobID),
+		"configuration": map[string]interface{}{"load": load},
+	})
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json; charset=UTF-8"}})
+	if err != nil {
+		return err
+	}
+	part.Write(metadata)
+	part, err = mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/octet-stream"}})
+	if err != nil {
+		return err
+	}
+	part.Write(data)
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	token, err := bq.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/projects/%s/jobs?uploadType=multipart", bigQueryUploadAPI, url.PathEscape(bq.project))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "multipart/related; boundary="+mw.Boundary())
+
+	if _, err := doJSON(bq.client, req, nil); err != nil && statusOf(err) != http.StatusConflict {
+		return fmt.Errorf("failed to start load job into %s: %w", loadInto, err)
+	}
+	if err := bq.awaitJob(ctx, jobID); err != nil || table.Key == "" {
+		return err
+	}
+	return bq.merge(ctx, table, loadInto, jobID+"_merge")
+}
+
+// merge upserts the rows of the load table into table with a query job named jobID,
+// then drops the load table
+func (bq *bigQuery) merge(ctx context.Context, table Table, loadInto, jobID string) error {
+	name := bq.prefix + table.Name
+	qualified := func(t string) string { return fmt.Sprintf("`%s.%s.%s`", bq.project, bq.dataset, t) }
+	job := map[string]interface{}{
+		"jobReference": bq.jobReference(jobID),
+		"configuration": map[string]interface{}{
+			"query": map[string]interface{}{
+				"query":        mergeStatement(table, qualified(name), qualified(loadInto)),
+				"useLegacySql": false,
+			},
+		},
+	}
+	endpoint := fmt.Sprintf("%s/projects/%s/jobs", bigQueryAPI, url.PathEscape(bq.project))
+	if err := bq.do(ctx, http.MethodPost, endpoint, job, nil); err != nil && statusOf(err) != http.StatusConflict {
+		return fmt.Errorf("failed to start merge job into %s: %w", name, err)
+	}
+	if err := bq.awaitJob(ctx, jobID); err != nil {
+		return err
+	}
+
+	if err := bq.do(ctx, http.MethodDelete, bq.tableURL(loadInto), nil, nil); err != nil && statusOf(err) != http.StatusNotFound {
+		log.Printf("[WarehouseSyncer] Failed to drop load table %s: %v", loadInto, err)
+	}
+	return nil
+}
+
+// awaitJob polls a job until it is done and returns its error, if any
+func (bq *bigQuery) awaitJob(ctx context.Context, jobID string) error {
+	endpoint := fmt.Sprintf("%s/projects/%s/jobs/%s", bigQueryAPI, url.PathEscape(bq.project), url.PathEscape(jobID))
+	if bq.location != "" {
+		endpoint += "?location=" + url.QueryEscape(bq.location)
+	}
+
+	ticker := time.NewTicker(bigQueryJobPoll)
+	defer ticker.Stop()
+	for {
+		var job bigQueryJob
+		if err := bq.do(ctx, http.MethodGet, endpoint, nil, &job); err != nil {
+			return fmt.Errorf("failed to get job %s: %w", jobID, err)
+		}
+		if job.Status.State == "DONE" {
+			if r := job.Status.ErrorResult; r != nil {
+				msg := r.Message
+				if len(job.Status.Errors) > 0 && job.Status.Errors[0].Message != msg {
+					msg += ": " + job.Status.Errors[0].Message
+				}
+				return fmt.Errorf("job %s failed (%s): %s", jobID, r.Reason, msg)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package warehouse
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/storage"
+)
+
+const (
+	// snowflakeStatementTimeout bounds each SQL statement, in seconds
+	snowflakeStatementTimeout = 600
+	// snowflakeStatementPoll is how often a statement still running is polled
+	snowflakeStatementPoll = 2 * time.Second
+)
+
+var snowflakeTypes = map[string]string{
+	TypeString:    "VARCHAR",
+	TypeInteger:   "NUMBER(38,0)",
+	TypeFloat:     "FLOAT",
+	TypeBoolean:   "BOOLEAN",
+	TypeTimestamp: "TIMESTAMP_TZ",
+	TypeJSON:      "VARIANT",
+}
+
+// snowflake loads batches by staging them in blob storage and running COPY INTO from
+// an external stage over it, through the SQL API with key-pair authentication.
+// Config: account, user, database, schema, warehouse and stage (required), role and
+// table_prefix.
+type snowflake struct {
+	client *http.Client
+	store  storage.Store
+	// stageDir is the store prefix batches are written under and stagePath the same
+	// location relative to the stage
+	stageDir  string
+	stagePath string
+
+	key         *rsa.PrivateKey
+	fingerprint string
+
+	account   string
+	user      string
+	database  string
+	schema    string
+	warehouse string
+	role      string
+	stage     string
+	prefix    string
+}
+
+func newSnowflake(config map[string]string, credentials string) (*snowflake, error) {
+	if err := requireConfig(config, "account", "user", "database", "schema", "warehouse", "stage"); err != nil {
+		return nil, err
+	}
+
+	key, err := parsePrivateKey(credentials)
+	if err != nil {
+		return nil, fmt.Errorf("credentials must be the user's PEM private key: %w", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+	sum := sha256.Sum256(publicKey)
+
+	sf := &snowflake{
+		key:         key,
+		fingerprint: "SHA256:" + base64.StdEncoding.EncodeToString(sum[:]),
+		account:     strings.ToLower(config["account"]),
+		user:        config["user"],
+		database:    config["database"],
+		schema:      config["schema"],
+		warehouse:   config["warehouse"],
+		role:        config["role"],
+		stage:       config["stage"],
+		prefix:      config["table_prefix"],
+	}
+	for _, part := range strings.Split(sf.stage, ".") {
+		if !identifier(part) {
+			return nil, fmt.Errorf("stage %q is not a valid stage name", sf.stage)
+		}
+	}
+	if sf.prefix != "" && !identifier(sf.prefix) {
+		return nil, fmt.Errorf("table_prefix %q may only contain letters, digits and underscores", sf.prefix)
+	}
+	for _, r := range sf.account {
+		if !(r == '-' || r == '_' || r == '.' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9') {
+			return nil, fmt.Errorf("account %q is not a valid account identifier", config["account"])
+		}
+	}
+	return sf, nil
+}
+
+// token signs a key-pair JWT. The issuer names the account without region or cloud
+// (the part before the first dot) and the user's public key fingerprint.
+func (sf *snowflake) token() (string, error) {
+	account := strings.ToUpper(strings.SplitN(sf.account, ".", 2)[0])
+	subject := account + "." + strings.ToUpper(sf.user)
+	now := time.Now()
+	return signJWT(sf.key, nil, map[string]interface{}{
+		"iss": subject + "." + sf.fingerprint,
+		"sub": subject,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	})
+}
+
+type snowflakeResult struct {
+	StatementHandle string     `json:"statementHandle"`
+	Message         string     `json:"message"`
+	Data            [][]string `json:"data"`
+}
+
+// exec runs one SQL statement and returns its result rows, waiting for statements
+// that are still running
+func (sf *snowflake) exec(ctx context.Context, statement string) ([][]string, error) {
+	base := "https://" + sf.account + ".snowflakecomputing.com/api/v2/statements"
+	body := map[string]interface{}{
+		"statement": statement,
+		"timeout":   snowflakeStatementTimeout,
+		"database":  sf.database,
+		"schema":    sf.schema,
+		"warehouse": sf.warehouse,
+	}
+	if sf.role != "" {
+		body["role"] = sf.role
+	}
+
+	endpoint := base + "?requestId=" + uuid.NewString()
+	method := http.MethodPost
+	for {
+		token, err := sf.token()
+		if err != nil {
+			return nil, err
+		}
+		req, err := newJSONRequest(ctx, method, endpoint, body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-Snowflake-Authorization-Token-Type", "KEYPAIR_JWT")
+
+		var result snowflakeResult
+		status, err := doJSON(sf.client, req, &result)
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusAccepted {
+			return result.Data, nil
+		}
+		if result.StatementHandle == "" {
+			return nil, errors.New("statement accepted without a handle")
+		}
+
+		// Still running: poll its handle
+		endpoint, method, body = base+"/"+result.StatementHandle, http.MethodGet, nil
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(snowflakeStatementPoll):
+		}
+	}
+}
+
+// EnsureTable creates the table, or adds the columns it lacks
+func (sf *snowflake) EnsureTable(ctx context.Context, table Table) error {
+	name := strings.ToUpper(sf.prefix + table.Name)
+
+	defs := make([]string, len(table.Columns))
+	for i, col := range table.Columns {
+		defs[i] = col.Name + " " + snowflakeTypes[col.Type]
+	}
+	if _, err := sf.exec(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", name, strings.Join(defs, ", "))); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", name, err)
+	}
+
+	rows, err := sf.exec(ctx, fmt.Sprintf(
+		"SELECT column_name FROM information_schema.columns WHERE table_schema = CURRENT_SCHEMA() AND table_name = '%s'", name))
+	if err != nil {
+		return fmt.Errorf("failed to read columns of table %s: %w", name, err)
+	}
+	have := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		if len(row) > 0 {
+			have[strings.ToUpper(row[0])] = true
+		}
+	}
+	for _, col := range table.Columns {
+		if have[strings.ToUpper(col.Name)] {
+			continue
+		}
+		if _, err := sf.exec(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", name, col.Name, snowflakeTypes[col.Type])); err != nil {
+			return fmt.Errorf("failed to add column %s to table %s: %w", col.Name, name, err)
+		}
+	}
+	return nil
+}
+
+// Load stages rows as <batchID>.ndjson and copies them in. COPY INTO skips files it
+// has loaded before, so a batch sent again after a lost response is not duplicated.
+// Rows of a keyed table are copied into a table of their own and merged from there,
+// which is as safe to repeat.
+func (sf *snowflake) Load(ctx context.Context, table Table, batchID string, rows []Row) error {
+	name := strings.ToUpper(sf.prefix + table.Name)
+	file := batchID + ".ndjson"
+	copyInto := name
+	if table.Key != "" {
+		copyInto = strings.ToUpper(sf.prefix + batchID)
+		if _, err := sf.exec(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s LIKE %s", copyInto, name)); err != nil {
+			return fmt.Errorf("failed to create load table %s: %w", copyInto, err)
+		}
+	}
+
+	data, err := ndjson(rows)
+	if err != nil {
+		return fmt.Errorf("failed to encode rows: %w", err)
+	}
+	key := path.Join(sf.stageDir, file)
+	if err := sf.store.Put(ctx, key, data, "application/x-ndjson"); err != nil {
+		return fmt.Errorf("failed to stage batch: %w", err)
+	}
+
+	_, err = sf.exec(ctx, fmt.Sprintf(
+		"COPY INTO %s FROM @%s/%s/ FILES = ('%s') FILE_FORMAT = (TYPE = JSON) MATCH_BY_COLUMN_NAME = CASE_INSENSITIVE",
+		copyInto, sf.stage, sf.stagePath, file))
+	if err != nil {
+		return fmt.Errorf("failed to copy batch into %s: %w", copyInto, err)
+	}
+	if table.Key != "" {
+		if _, err := sf.exec(ctx, mergeStatement(table, name, copyInto)); err != nil {
+			return fmt.Errorf("failed to merge batch into %s: %w", name, err)
+		}
+		if _, err := sf.exec(ctx, "DROP TABLE IF EXISTS "+copyInto); err != nil {
+			log.Printf("[WarehouseSyncer] Failed to drop load table %s: %v", copyInto, err)
+		}
+	}
+
+	// The rows are in; a leftover file is only skipped by later copies
+	if err := sf.store.Delete(ctx, key); err != nil {
+		log.Printf("[WarehouseSyncer] Failed to remove staged batch %s: %v", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package warehouse
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/exporter"
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/repository"
+	"github.com/ngocp/user-tracker/internal/stats"
+)
+
+// SyncerConfig configures the warehouse syncer
+type SyncerConfig struct {
+	// PollInterval is how often due connectors are claimed
+	PollInterval time.Duration
+	// Lease is how long a claimed connector is reserved for its run; a run still going
+	// when it expires may be started again by another instance
+	Lease time.Duration
+	// BatchSize is the number of rows per load
+	BatchSize int
+	// MaxRowsPerRun caps the rows of each table loaded by one run; a connector with
+	// more to load runs again after the next poll interval
+	MaxRowsPerRun int
+	// HTTPTimeout bounds each request to a warehouse API
+	HTTPTimeout time.Duration
+	Options
+}
+
+// Syncer runs due warehouse connectors: it applies the table layout when it changed,
+// then loads the sessions changed and events stored since each connector's cursors,
+// up to the connector's delay, and schedules its next run
+type Syncer struct {
+	repo        *repository.WarehouseRepository
+	sessionRepo *repository.SessionRepository
+	eventRepo   *repository.EventRepository
+	config      SyncerConfig
+	stopChan    chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewSyncer creates a warehouse syncer
+func NewSyncer(repo *repository.WarehouseRepository, sessionRepo *repository.SessionRepository, eventRepo *repository.EventRepository, config SyncerConfig) *Syncer {
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: config.HTTPTimeout}
+	}
+	return &Syncer{
+		repo:        repo,
+		sessionRepo: sessionRepo,
+		eventRepo:   eventRepo,
+		config:      config,
+		stopChan:    make(chan struct{}),
+	}
+}
+
+// Start runs the sync loop in the background
+func (s *Syncer) Start(ctx context.Context) {
+	s.wg.Add(1)
+	go s.run(ctx)
+}
+
+// Stop stops the loop after the current run. Safe to call on a nil syncer.
+func (s *Syncer) Stop() {
+	if s == nil {
+		return
+	}
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+func (s *Syncer) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	log.Printf("[WarehouseSyncer] Started, poll interval: %v", s.config.PollInterval)
+
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			log.Println("[WarehouseSyncer] Stopped")
+			return
+		case <-ticker.C:
+			s.syncDue(ctx)
+		}
+	}
+}
+
+// syncDue runs due connectors one at a time, claiming each just before its run, until
+// none is due or the syncer is stopped
+func (s *Syncer) syncDue(ctx context.Context) {
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		default:
+		}
+
+		connectors, err := s.repo.ClaimDue(ctx, s.config.Lease, 1)
+		if err != nil {
+			log.Printf("[WarehouseSyncer] %v", err)
+			return
+		}
+		if len(connectors) == 0 {
+			return
+		}
+		s.runConnector(ctx, connectors[0])
+	}
+}
+
+// runConnector syncs a claimed connector and records the run
+func (s *Syncer) runConnector(ctx context.Context, connector *models.WarehouseConnector) {
+	runCtx, cancel := context.WithTimeout(ctx, s.config.Lease)
+	more, runErr := s.sync(runCtx, connector)
+	cancel()
+
+	next, err := exporter.NextRun(connector.Cron, connector.Timezone, time.Now())
+	switch {
+	case err != nil:
+		// Keep the connector from being claimed on every poll until it is fixed
+		runErr, next = fmt.Errorf("invalid schedule: %w", err), time.Now().Add(24*time.Hour)
+	case more && runErr == nil:
+		next = time.Now().Add(s.config.PollInterval)
+	}
+
+	if runErr != nil {
+		log.Printf("[WarehouseSyncer] Connector %s (%s) failed: %v", connector.ConnectorID, connector.Name, runErr)
+	}
+	if err := s.repo.FinishRun(ctx, connector.ConnectorID, next, runErr); err != nil {
+		log.Printf("[WarehouseSyncer] %v", err)
+	}
+}
+
+// sync loads what connector has not loaded yet. It reports whether rows were left for
+// another run because of MaxRowsPerRun.
+func (s *Syncer) sync(ctx context.Context, connector *models.WarehouseConnector) (bool, error) {
+	loader, err := NewLoader(connector, s.config.Options)
+	if err != nil {
+		return false, err
+	}
+
+	if connector.SchemaVersion < SchemaVersion {
+		for _, table := range []Table{SessionsTable, EventsTable} {
+			if err := loader.EnsureTable(ctx, table); err != nil {
+				return false, err
+			}
+		}
+		if err := s.repo.SetSchemaVersion(ctx, connector.ConnectorID, SchemaVersion); err != nil {
+			return false, err
+		}
+	}
+
+	sandbox := connector.Project == stats.SandboxProject
+	until := time.Now().Add(-connector.Delay())
+
+	moreSessions, err := s.syncSessions(ctx, loader, connector, sandbox, until)
+	if err != nil {
+		return false, err
+	}
+	moreEvents, err := s.syncEvents(ctx, loader, connector, sandbox, until)
+	if err != nil {
+		return false, err
+	}
+	return moreSessions || moreEvents, nil
+}
+
+// syncSessions merges the sessions updated after the sessions cursor and before until
+// into the warehouse's, so a session loaded while still open is loaded again once it
+// ends, goes idle or gets a user ID or metadata
+func (s *Syncer) syncSessions(ctx context.Context, loader Loader, connector *models.WarehouseConnector, sandbox bool, until time.Time) (bool, error) {
+	after, afterID := connector.SessionsAt, uuid.Nil
+	if connector.SessionsID != nil {
+		afterID = *connector.SessionsID
+	}
+
+	loaded := 0
+	for loaded < s.config.MaxRowsPerRun {
+		sessions, err := s.sessionRepo.ListUpdated(ctx, until, &sandbox, after, afterID, s.config.BatchSize)
+		if err != nil {
+			return false, err
+		}
+		if len(sessions) == 0 {
+			return false, nil
+		}
+
+		rows := make([]Row, len(sessions))
+		for i, session := range sessions {
+			rows[i] = SessionRow(connector.Project, session)
+		}
+		first, last := sessions[0], sessions[len(sessions)-1]
+		id := batchID(connector.ConnectorID, SessionsTable,
+			first.UpdatedAt.Format(time.RFC3339Nano)+first.SessionID.String(),
+			last.UpdatedAt.Format(time.RFC3339Nano)+last.SessionID.String(), len(rows))
+		if err := loader.Load(ctx, SessionsTable, id, rows); err != nil {
+			return false, err
+		}
+
+		if err := s.repo.AdvanceSessions(ctx, connector.ConnectorID, last.UpdatedAt, last.SessionID, len(sessions)); err != nil {
+			return false, err
+		}
+		after, afterID = &last.UpdatedAt, last.SessionID
+		loaded += len(sessions)
+	}
+	return true, nil
+}
+
+// syncEvents loads the events stored after the events cursor and before until. The
+// cursor is on ingest time, so events that arrive late or are imported with
+// historical timestamps are loaded by the next run rather than skipped.
+func (s *Syncer) syncEvents(ctx context.Context, loader Loader, connector *models.WarehouseConnector, sandbox bool, until time.Time) (bool, error) {
+	filter := repository.IngestWindowFilter{To: until, Sandbox: &sandbox, Limit: s.config.BatchSize}
+	if connector.EventsAt != nil && connector.EventsID != nil {
+		filter.AfterIngestedAt, filter.AfterEventID = *connector.EventsAt, *connector.EventsID
+	}
+
+	loaded := 0
+	for loaded < s.config.MaxRowsPerRun {
+		events, err := s.eventRepo.ListByIngestTime(ctx, filter)
+		if err != nil {
+			return false, err
+		}
+		if len(events) == 0 {
+			return false, nil
+		}
+
+		rows := make([]Row, len(events))
+		for i, event := range events {
+			rows[i] = EventRow(connector.Project, event.Event)
+		}
+		first, last := events[0], events[len(events)-1]
+		id := batchID(connector.ConnectorID, EventsTable,
+			fmt.Sprintf("%s%d", first.IngestedAt.Format(time.RFC3339Nano), first.EventID),
+			fmt.Sprintf("%s%d", last.IngestedAt.Format(time.RFC3339Nano), last.EventID), len(rows))
+		if err := loader.Load(ctx, EventsTable, id, rows); err != nil {
+			return false, err
+		}
+
+		if err := s.repo.AdvanceEvents(ctx, connector.ConnectorID, last.IngestedAt, last.EventID, len(events)); err != nil {
+			return false, err
+		}
+		filter.AfterIngestedAt, filter.AfterEventID = last.IngestedAt, last.EventID
+		loaded += len(events)
+	}
+	return true, nil
+}
+
+// batchID names a batch of n rows of table by its first and last keys, so the same
+// rows retried after a failure get the same ID
+func batchID(connectorID uuid.UUID, table Table, first, last string, n int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%s/%s/%d", connectorID, table.Name, first, last, n)))
+	return table.Name + "_" + hex.EncodeToString(sum[:12])
+}
@@ -0,0 +1,293 @@
+// Package warehouse loads sessions and events into BigQuery and Snowflake on each
+// connector's schedule, incrementally from per-connector cursors, through the
+// warehouses' bulk-load APIs.
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/models"
+	"github.com/ngocp/user-tracker/internal/storage"
+)
+
+// Column types of the destination tables, mapped to each warehouse's own
+const (
+	TypeString    = "string"
+	TypeInteger   = "integer"
+	TypeFloat     = "float"
+	TypeBoolean   = "boolean"
+	TypeTimestamp = "timestamp"
+	TypeJSON      = "json"
+)
+
+// Column is a column of a destination table
+type Column struct {
+	Name string
+	Type string
+}
+
+// Table is a destination table; its name gets the connector's table_prefix
+type Table struct {
+	Name    string
+	Columns []Column
+	// Partition is the timestamp column the table is partitioned by, where supported
+	Partition string
+	// Key, when set, is the column identifying a row: loaded rows replace the rows with
+	// the same key instead of being appended
+	Key string
+}
+
+// SchemaVersion is the version of the table layouts below. Bump it when columns are
+// added so connectors add them to their tables on their next run; columns are never
+// dropped or retyped.
+const SchemaVersion = 2
+
+// SessionsTable and EventsTable are the destination tables
+var (
+	SessionsTable = Table{
+		Name:      "sessions",
+		Partition: "started_at",
+		Key:       "session_id",
+		Columns: []Column{
+			{"session_id", TypeString},
+			{"project", TypeString},
+			{"user_id", TypeString},
+			{"fingerprint", TypeString},
+			{"started_at", TypeTimestamp},
+			{"ended_at", TypeTimestamp},
+			{"last_activity_at", TypeTimestamp},
+			{"page_url", TypeString},
+			{"referrer", TypeString},
+			{"user_agent", TypeString},
+			{"screen_width", TypeInteger},
+			{"screen_height", TypeInteger},
+			{"viewport_width", TypeInteger},
+			{"viewport_height", TypeInteger},
+			{"device_type", TypeString},
+			{"browser", TypeString},
+			{"os", TypeString},
+			{"country", TypeString},
+			{"city", TypeString},
+			{"metadata", TypeJSON},
+			{"sdk", TypeString},
+			{"consent_state", TypeString},
+			{"updated_at", TypeTimestamp},
+		},
+	}
+	EventsTable = Table{
+		Name:      "events",
+		Partition: "timestamp",
+		Columns: []Column{
+			{"event_id", TypeInteger},
+			{"session_id", TypeString},
+			{"project", TypeString},
+			{"timestamp", TypeTimestamp},
+			{"event_type", TypeString},
+			{"page_url", TypeString},
+			{"normalized_url", TypeString},
+			{"target_selector", TypeString},
+			{"viewport_x", TypeFloat},
+			{"viewport_y", TypeFloat},
+			{"input_value", TypeString},
+			{"input_masked", TypeBoolean},
+			{"key_pressed", TypeString},
+			{"event_data", TypeJSON},
+			{"sdk", TypeString},
+			{"tab_id", TypeString},
+			{"frame_path", TypeString},
+		},
+	}
+)
+
+// Row is a destination row by column name
+type Row map[string]interface{}
+
+// SessionRow maps a session of project to a SessionsTable row
+func SessionRow(project string, s *models.Session) Row {
+	return Row{
+		"session_id":       s.SessionID.String(),
+		"project":          project,
+		"user_id":          s.UserID,
+		"fingerprint":      s.Fingerprint,
+		"started_at":       s.StartedAt.UTC().Format(time.RFC3339Nano),
+		"ended_at":         timestamp(s.EndedAt),
+		"last_activity_at": s.LastActivityAt.UTC().Format(time.RFC3339Nano),
+		"page_url":         s.PageURL,
+		"referrer":         s.Referrer,
+		"user_agent":       s.UserAgent,
+		"screen_width":     s.ScreenWidth,
+		"screen_height":    s.ScreenHeight,
+		"viewport_width":   s.ViewportWidth,
+		"viewport_height":  s.ViewportHeight,
+		"device_type":      s.DeviceType,
+		"browser":          s.Browser,
+		"os":               s.OS,
+		"country":          s.Country,
+		"city":             s.City,
+		"metadata":         s.Metadata,
+		"sdk":              s.SDK,
+		"consent_state":    s.ConsentState,
+		"updated_at":       s.UpdatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// EventRow maps an event of project to an EventsTable row
+func EventRow(project string, e *models.Event) Row {
+	return Row{
+		"event_id":        e.EventID,
+		"session_id":      e.SessionID.String(),
+		"project":         project,
+		"timestamp":       e.Timestamp.UTC().Format(time.RFC3339Nano),
+		"event_type":      string(e.EventType),
+		"page_url":        e.PageURL,
+		"normalized_url":  e.NormalizedURL,
+		"target_selector": e.TargetSelector,
+		"viewport_x":      e.ViewportX,
+		"viewport_y":      e.ViewportY,
+		"input_value":     e.InputValue,
+		"input_masked":    e.InputMasked,
+		"key_pressed":     e.KeyPressed,
+		"event_data":      e.EventData,
+		"sdk":             e.SDK,
+		"tab_id":          e.TabID,
+		"frame_path":      e.FramePath,
+	}
+}
+
+func timestamp(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.UTC().Format(time.RFC3339Nano)
+	return &s
+}
+
+// mergeStatement returns the MERGE that upserts the rows of source into target on
+// table.Key. Both warehouses accept the same statement; names must be quoted by the
+// caller as its warehouse requires.
+func mergeStatement(table Table, target, source string) string {
+	names := make([]string, len(table.Columns))
+	values := make([]string, len(table.Columns))
+	sets := make([]string, 0, len(table.Columns))
+	for i, col := range table.Columns {
+		names[i] = col.Name
+		values[i] = "s." + col.Name
+		if col.Name != table.Key {
+			sets = append(sets, col.Name+" = s."+col.Name)
+		}
+	}
+	return fmt.Sprintf("MERGE INTO %s t USING %s s ON t.%s = s.%s "+
+		"WHEN MATCHED THEN UPDATE SET %s "+
+		"WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)",
+		target, source, table.Key, table.Key,
+		strings.Join(sets, ", "), strings.Join(names, ", "), strings.Join(values, ", "))
+}
+
+// ndjson encodes rows as newline-delimited JSON, the format both warehouses bulk-load
+func ndjson(rows []Row) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Loader writes rows into one warehouse
+type Loader interface {
+	// EnsureTable creates table, or adds the columns it lacks
+	EnsureTable(ctx context.Context, table Table) error
+	// Load appends rows to table, or merges them on table.Key when it has one. batchID
+	// identifies the batch across retries, so a batch whose load succeeded but was not
+	// recorded is not loaded twice.
+	Load(ctx context.Context, table Table, batchID string, rows []Row) error
+}
+
+// Options are what loaders share
+type Options struct {
+	Client *http.Client
+	// Store holds Snowflake batches under StagePrefix/<connector_id>/ while they are
+	// copied in; a connector's external stage must point at StagePrefix
+	Store       storage.Store
+	StagePrefix string
+}
+
+// NewLoader returns the loader of connector's warehouse
+func NewLoader(connector *models.WarehouseConnector, opts Options) (Loader, error) {
+	switch connector.Kind {
+	case models.WarehouseBigQuery:
+		bq, err := newBigQuery(connector.Config, connector.Credentials)
+		if err != nil {
+			return nil, err
+		}
+		bq.client = opts.Client
+		return bq, nil
+	case models.WarehouseSnowflake:
+		if opts.Store == nil {
+			return nil, fmt.Errorf("snowflake connectors need blob storage to stage their loads")
+		}
+		sf, err := newSnowflake(connector.Config, connector.Credentials)
+		if err != nil {
+			return nil, err
+		}
+		sf.client, sf.store = opts.Client, opts.Store
+		sf.stageDir = path.Join(opts.StagePrefix, connector.ConnectorID.String())
+		sf.stagePath = connector.ConnectorID.String()
+		return sf, nil
+	default:
+		return nil, fmt.Errorf("unknown warehouse %q", connector.Kind)
+	}
+}
+
+// Validate checks a connector's config and credentials without connecting
+func Validate(kind string, config map[string]string, credentials string) error {
+	var err error
+	switch kind {
+	case models.WarehouseBigQuery:
+		_, err = newBigQuery(config, credentials)
+	case models.WarehouseSnowflake:
+		_, err = newSnowflake(config, credentials)
+	default:
+		err = fmt.Errorf("kind must be %s or %s", models.WarehouseBigQuery, models.WarehouseSnowflake)
+	}
+	return err
+}
+
+// requireConfig returns an error naming the keys missing from config
+func requireConfig(config map[string]string, keys ...string) error {
+	var missing []string
+	for _, key := range keys {
+		if strings.TrimSpace(config[key]) == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("config is missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// identifier reports whether s is safe to use unquoted as a table or column name
+func identifier(s string) bool {
+	if s == "" || len(s) > 128 {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package watchlist
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngocp/user-tracker/internal/models"
+)
+
+// SessionStarted is the body POSTed to webhooks when a watched identity starts a session
+type SessionStarted struct {
+	Type           string    `json:"type"`
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	Label          *string   `json:"label,omitempty"`
+	IdentityType   string    `json:"identity_type"`
+	Identity       string    `json:"identity"`
+	SessionID      uuid.UUID `json:"session_id"`
+	StartedAt      time.Time `json:"started_at"`
+	PageURL        string    `json:"page_url"`
+	SessionURL     string    `json:"session_url,omitempty"`
+}
+
+// Notifier announces watched sessions to the subscription's notify URL, or a default
+// URL. Slack incoming webhook URLs get a Slack message instead of the JSON event.
+type Notifier struct {
+	defaultURL   string
+	secret       string
+	dashboardURL string
+	client       *http.Client
+}
+
+// NewNotifier creates a watchlist notifier. When secret is set, webhook bodies are
+// signed with HMAC-SHA256 in the X-Tracker-Signature header. dashboardURL, if set,
+// is used to link the session.
+func NewNotifier(defaultURL, secret, dashboardURL string, timeout time.Duration) *Notifier {
+	return &Notifier{
+		defaultURL:   defaultURL,
+		secret:       secret,
+		dashboardURL: strings.TrimRight(dashboardURL, "/"),
+		client:       &http.Client{Timeout: timeout},
+	}
+}
+
+// HasDefault reports whether subscriptions without a notify URL are announced
+func (n *Notifier) HasDefault() bool {
+	return n.defaultURL != ""
+}
+
+// Notify announces match. It is a no-op when neither the subscription nor the
+// notifier has a URL.
+func (n *Notifier) Notify(ctx context.Context, match *models.WatchMatch) error {
+	target := n.defaultURL
+	if match.Subscription.NotifyURL != nil && *match.Subscription.NotifyURL != "" {
+		target = *match.Subscription.NotifyURL
+	}
+	if target == "" {
+		return nil
+	}
+
+	event := SessionStarted{
+		Type:           "watchlist.session_started",
+		SubscriptionID: match.Subscription.SubscriptionID,
+		Label:          match.Subscription.Label,
+		IdentityType:   match.Subscription.IdentityType,
+		SessionID:      match.Session.SessionID,
+		StartedAt:      match.Session.StartedAt,
+		PageURL:        match.Session.PageURL,
+	}
+	if match.Subscription.Identity != nil {
+		event.Identity = *match.Subscription.Identity
+	}
+	if n.dashboardURL != "" {
+		event.SessionURL = n.dashboardURL + "/sessions/" + event.SessionID.String()
+	}
+
+	var payload interface{} = event
+	if isSlackWebhook(target) {
+		payload = map[string]string{"text": slackText(event)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set("X-Tracker-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func isSlackWebhook(target string) bool {
+	u, err := url.Parse(target)
+	return err == nil && u.Host == "hooks.slack.com"
+}
+
+func slackText(e SessionStarted) string {
+	who := e.IdentityType + " " + e.Identity
+	if e.Label != nil && *e.Label != "" {
+		who = *e.Label + " (" + who + ")"
+	}
+	text := fmt.Sprintf("Watched %s started a session on %s at %s", who, e.PageURL, e.StartedAt.UTC().Format(time.RFC3339))
+	if e.SessionURL != "" {
+		text += "\n<" + e.SessionURL + "|Open session " + e.SessionID.String() + ">"
+	} else {
+		text += "\nSession " + e.SessionID.String()
+	}
+	return text
+}
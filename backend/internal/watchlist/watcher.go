@@ -0,0 +1,92 @@
+// Package watchlist pins new sessions of watched user IDs and fingerprints and
+// announces them to webhooks or Slack.
+package watchlist
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ngocp/user-tracker/internal/repository"
+)
+
+// maxNotifyAttempts bounds retries of a failing notification
+const maxNotifyAttempts = 5
+
+// Watcher polls for sessions matching watchlist subscriptions, pins them and sends
+// their notifications. Failed notifications are retried on later polls.
+type Watcher struct {
+	repo     *repository.WatchlistRepository
+	notifier *Notifier
+	interval time.Duration
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewWatcher creates a watcher polling every interval
+func NewWatcher(repo *repository.WatchlistRepository, notifier *Notifier, interval time.Duration) *Watcher {
+	return &Watcher{
+		repo:     repo,
+		notifier: notifier,
+		interval: interval,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start runs the watch loop in the background
+func (w *Watcher) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go w.run(ctx)
+}
+
+// Stop stops the loop
+func (w *Watcher) Stop() {
+	close(w.stopChan)
+	w.wg.Wait()
+}
+
+func (w *Watcher) run(ctx context.Context) {
+	defer w.wg.Done()
+
+	log.Printf("[Watchlist] Watcher started, interval: %v", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopChan:
+			log.Println("[Watchlist] Watcher stopped")
+			return
+		case <-ticker.C:
+			w.poll(ctx)
+		}
+	}
+}
+
+func (w *Watcher) poll(ctx context.Context) {
+	// Look back over a few intervals so a slow or failed poll does not miss sessions
+	pinned, err := w.repo.PinNew(ctx, 3*w.interval+time.Minute)
+	if err != nil {
+		log.Printf("[Watchlist] %v", err)
+	} else if pinned > 0 {
+		log.Printf("[Watchlist] Pinned %d new watched sessions", pinned)
+	}
+
+	matches, err := w.repo.ListUnnotified(ctx, maxNotifyAttempts, w.notifier.HasDefault(), 100)
+	if err != nil {
+		log.Printf("[Watchlist] %v", err)
+		return
+	}
+	for _, match := range matches {
+		notifyErr := w.notifier.Notify(ctx, match)
+		if notifyErr != nil {
+			log.Printf("[Watchlist] Notification for session %s (attempt %d/%d) failed: %v",
+				match.Session.SessionID, match.Attempts+1, maxNotifyAttempts, notifyErr)
+		}
+		if err := w.repo.RecordNotification(ctx, match.Subscription.SubscriptionID, match.Session.SessionID, notifyErr); err != nil {
+			log.Printf("[Watchlist] %v", err)
+		}
+	}
+}
@@ -1,3 +1,5 @@
+import { decodeReplay, REPLAY_CONTENT_TYPE } from './replay';
+
 const API_URL = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080/api/v1';
 
 export interface Session {
@@ -73,8 +75,14 @@ export async function fetchSession(sessionId: string): Promise<Session> {
 }
 
 export async function fetchSessionEvents(sessionId: string): Promise<{ data: SessionEvent[]; total: number }> {
-  const response = await fetch(`${API_URL}/sessions/${sessionId}/events?limit=10000`);
+  const response = await fetch(`${API_URL}/sessions/${sessionId}/events?limit=10000`, {
+    headers: { Accept: `${REPLAY_CONTENT_TYPE}, application/json` },
+  });
   if (!response.ok) throw new Error('Failed to fetch events');
+  if (response.headers.get('Content-Type')?.startsWith(REPLAY_CONTENT_TYPE)) {
+    const { events } = decodeReplay(await response.arrayBuffer());
+    return { data: events, total: Number(response.headers.get('X-Total-Count') ?? events.length) };
+  }
   return response.json();
 }
 
@@ -0,0 +1,121 @@
+import type { SessionEvent } from './api';
+
+// Decoder for the binary replay format (Accept: application/x-tracker-replay).
+// The format is documented in backend/internal/replayformat/format.go.
+
+export const REPLAY_CONTENT_TYPE = 'application/x-tracker-replay';
+
+const MAGIC = 'TRPL';
+const VERSION = 1;
+
+const STRING_REFS = ['target_element', 'target_selector', 'target_tag', 'target_id', 'target_class'] as const;
+const COORDINATES = ['viewport_x', 'viewport_y', 'screen_x', 'screen_y', 'scroll_x', 'scroll_y'] as const;
+
+class Reader {
+  private offset = 0;
+  private strings: string[] = [];
+  private text = new TextDecoder();
+
+  constructor(private bytes: Uint8Array) {}
+
+  byte(): number {
+    if (this.offset >= this.bytes.length) throw new Error('Truncated replay stream');
+    return this.bytes[this.offset++];
+  }
+
+  raw(length: number): Uint8Array {
+    if (this.offset + length > this.bytes.length) throw new Error('Truncated replay stream');
+    const out = this.bytes.subarray(this.offset, this.offset + length);
+    this.offset += length;
+    return out;
+  }
+
+  // Multiplication instead of bit shifts keeps values above 2^32 exact
+  uvarint(): number {
+    let value = 0;
+    let scale = 1;
+    for (;;) {
+      const b = this.byte();
+      value += (b & 0x7f) * scale;
+      if (b < 0x80) return value;
+      scale *= 128;
+    }
+  }
+
+  svarint(): number {
+    const u = this.uvarint();
+    return u % 2 === 0 ? u / 2 : -(u + 1) / 2;
+  }
+
+  string(): string {
+    return this.text.decode(this.raw(this.uvarint()));
+  }
+
+  ref(): string {
+    const index = this.uvarint();
+    if (index === 0) {
+      const s = this.string();
+      this.strings.push(s);
+      return s;
+    }
+    if (index > this.strings.length) throw new Error('Invalid string reference in replay stream');
+    return this.strings[index - 1];
+  }
+}
+
+function hex(bytes: Uint8Array): string {
+  return Array.from(bytes, (b) => b.toString(16).padStart(2, '0')).join('');
+}
+
+export function decodeReplay(buffer: ArrayBuffer): { sessionId: string; events: SessionEvent[] } {
+  const r = new Reader(new Uint8Array(buffer));
+  if (new TextDecoder().decode(r.raw(MAGIC.length)) !== MAGIC) throw new Error('Not a replay stream');
+  const version = r.byte();
+  if (version !== VERSION) throw new Error(`Unsupported replay version ${version}`);
+
+  const id = hex(r.raw(16));
+  const sessionId = `${id.slice(0, 8)}-${id.slice(8, 12)}-${id.slice(12, 16)}-${id.slice(16, 20)}-${id.slice(20)}`;
+
+  const count = r.uvarint();
+  const events: SessionEvent[] = [];
+  let time = 0;
+  let eventId = 0;
+  for (let i = 0; i < count; i++) {
+    const mask = r.uvarint();
+    const has = (bit: number) => Math.floor(mask / 2 ** bit) % 2 === 1;
+
+    time += r.svarint();
+    eventId += r.svarint();
+    const event: SessionEvent = {
+      event_id: eventId,
+      session_id: sessionId,
+      // Millisecond precision is all Date can hold
+      timestamp: new Date(Math.floor(time / 1000)).toISOString(),
+      event_type: r.ref(),
+      page_url: r.ref(),
+    };
+    const fields = event as unknown as Record<string, unknown>;
+
+    STRING_REFS.forEach((name, bit) => {
+      if (has(bit)) fields[name] = r.ref();
+    });
+    COORDINATES.forEach((name, i) => {
+      if (has(5 + i)) fields[name] = r.svarint() / 100;
+    });
+    if (has(11)) fields.norm_x = r.uvarint() / 1e6;
+    if (has(12)) fields.norm_y = r.uvarint() / 1e6;
+    if (has(13)) event.input_value = r.string();
+    event.input_masked = has(14);
+    if (has(15)) event.key_pressed = r.ref();
+    if (has(16)) event.mouse_button = r.uvarint();
+    if (has(17)) event.click_count = r.uvarint();
+    if (has(18)) event.event_data = JSON.parse(r.string());
+    if (has(19)) fields.sdk = r.ref();
+    if (has(20)) fields.tab_id = r.ref();
+    if (has(21)) fields.frame_path = r.ref();
+
+    events.push(event);
+  }
+
+  return { sessionId, events };
+}
@@ -0,0 +1,7 @@
+-- Rollback issue clustering tables
+
+DROP INDEX IF EXISTS idx_issue_occurrences_occurred_at;
+DROP INDEX IF EXISTS idx_issues_last_seen_at;
+
+DROP TABLE IF EXISTS issue_occurrences;
+DROP TABLE IF EXISTS issues;
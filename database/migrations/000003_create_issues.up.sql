@@ -0,0 +1,26 @@
+-- Issues group sessions that share a failure signature
+-- (error fingerprint + page + rage-clicked selector)
+
+CREATE TABLE issues (
+    issue_id BIGSERIAL PRIMARY KEY,
+    fingerprint VARCHAR(64) NOT NULL UNIQUE,
+    error_message TEXT,
+    page_url TEXT NOT NULL,
+    target_selector TEXT,
+    first_seen_at TIMESTAMPTZ NOT NULL,
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    occurrence_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One row per session that hit an issue
+CREATE TABLE issue_occurrences (
+    issue_id BIGINT NOT NULL REFERENCES issues(issue_id) ON DELETE CASCADE,
+    session_id UUID NOT NULL REFERENCES sessions(session_id) ON DELETE CASCADE,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (issue_id, session_id)
+);
+
+CREATE INDEX idx_issues_last_seen_at ON issues(last_seen_at DESC);
+CREATE INDEX idx_issue_occurrences_occurred_at ON issue_occurrences(issue_id, occurred_at);
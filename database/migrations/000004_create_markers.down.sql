@@ -0,0 +1,6 @@
+-- Rollback deploy markers
+
+DROP INDEX IF EXISTS idx_markers_timestamp;
+DROP INDEX IF EXISTS idx_markers_project_timestamp;
+
+DROP TABLE IF EXISTS markers;
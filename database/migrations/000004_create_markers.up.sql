@@ -0,0 +1,15 @@
+-- Deploy/release markers registered by CI
+
+CREATE TABLE markers (
+    marker_id BIGSERIAL PRIMARY KEY,
+    project VARCHAR(100) NOT NULL DEFAULT 'default',
+    kind VARCHAR(50) NOT NULL DEFAULT 'deploy',
+    version VARCHAR(255),
+    description TEXT,
+    timestamp TIMESTAMPTZ NOT NULL,
+    metadata JSONB DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_markers_project_timestamp ON markers(project, timestamp DESC);
+CREATE INDEX idx_markers_timestamp ON markers(timestamp DESC);
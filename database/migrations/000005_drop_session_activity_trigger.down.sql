@@ -0,0 +1,18 @@
+-- Restore the per-row session activity trigger
+
+CREATE OR REPLACE FUNCTION update_session_activity()
+RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE sessions
+    SET
+        last_activity_at = NEW.timestamp,
+        updated_at = NOW()
+    WHERE session_id = NEW.session_id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_update_session_activity
+    AFTER INSERT ON events
+    FOR EACH ROW
+    EXECUTE FUNCTION update_session_activity();
@@ -0,0 +1,5 @@
+-- The event processor now bumps sessions.last_activity_at once per batch in the
+-- same transaction as the insert, so the per-row trigger only adds lock contention
+
+DROP TRIGGER IF EXISTS trigger_update_session_activity ON events;
+DROP FUNCTION IF EXISTS update_session_activity();
@@ -0,0 +1,7 @@
+-- Rollback blob storage support
+-- Note: This will fail if any screenshot has been moved to blob storage (image_data IS NULL)
+
+DROP INDEX IF EXISTS idx_screenshots_unmigrated;
+
+ALTER TABLE screenshots DROP COLUMN IF EXISTS storage_key;
+ALTER TABLE screenshots ALTER COLUMN image_data SET NOT NULL;
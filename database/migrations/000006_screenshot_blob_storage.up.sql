@@ -0,0 +1,7 @@
+-- Allow screenshots to live in external blob storage.
+-- Rows keep either image_data (legacy, in-database) or storage_key (blob store).
+
+ALTER TABLE screenshots ALTER COLUMN image_data DROP NOT NULL;
+ALTER TABLE screenshots ADD COLUMN storage_key TEXT;
+
+CREATE INDEX idx_screenshots_unmigrated ON screenshots(screenshot_id) WHERE storage_key IS NULL;
@@ -0,0 +1,6 @@
+-- Rollback SDK tracking
+
+DROP INDEX IF EXISTS idx_sessions_sdk;
+
+ALTER TABLE events DROP COLUMN IF EXISTS sdk;
+ALTER TABLE sessions DROP COLUMN IF EXISTS sdk;
@@ -0,0 +1,6 @@
+-- Record which SDK (name/version, e.g. "tracker-js/1.0.0") produced each session and event
+
+ALTER TABLE sessions ADD COLUMN sdk VARCHAR(100);
+ALTER TABLE events ADD COLUMN sdk VARCHAR(100);
+
+CREATE INDEX idx_sessions_sdk ON sessions(sdk, started_at DESC);
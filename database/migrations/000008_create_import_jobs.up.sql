@@ -0,0 +1,20 @@
+-- Bulk imports of historical sessions/events (NDJSON), processed by the import worker
+
+CREATE TABLE import_jobs (
+    job_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    source VARCHAR(50) NOT NULL DEFAULT 'ndjson',
+    -- Uploaded payloads are kept inline until the job finishes; object-store imports reference a key instead
+    payload BYTEA,
+    object_key TEXT,
+    lines_processed BIGINT NOT NULL DEFAULT 0,
+    lines_failed BIGINT NOT NULL DEFAULT 0,
+    sessions_imported BIGINT NOT NULL DEFAULT 0,
+    events_imported BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_import_jobs_pending ON import_jobs(created_at) WHERE status = 'pending';
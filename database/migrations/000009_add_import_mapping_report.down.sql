@@ -0,0 +1,3 @@
+-- Rollback import mapping report
+
+ALTER TABLE import_jobs DROP COLUMN IF EXISTS mapping_report;
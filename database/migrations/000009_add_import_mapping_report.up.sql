@@ -0,0 +1,3 @@
+-- Report of fields and records dropped when converting third-party exports (FullStory, Hotjar)
+
+ALTER TABLE import_jobs ADD COLUMN mapping_report JSONB;
@@ -0,0 +1,3 @@
+-- Rollback session dimension index
+
+DROP INDEX IF EXISTS idx_sessions_started_at_dimensions;
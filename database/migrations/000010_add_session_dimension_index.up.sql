@@ -0,0 +1,4 @@
+-- Covering index for analytics breakdowns by country, browser, os and device type
+
+CREATE INDEX idx_sessions_started_at_dimensions ON sessions(started_at)
+    INCLUDE (country, browser, os, device_type, user_id, fingerprint, ended_at, last_activity_at);
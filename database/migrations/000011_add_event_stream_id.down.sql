@@ -0,0 +1,5 @@
+-- Rollback event stream IDs
+
+DROP INDEX IF EXISTS idx_events_stream_id;
+
+ALTER TABLE events DROP COLUMN IF EXISTS stream_id;
@@ -0,0 +1,6 @@
+-- Record the queue message each event was inserted from, so stream replays can
+-- replace those rows instead of duplicating them
+
+ALTER TABLE events ADD COLUMN stream_id VARCHAR(32);
+
+CREATE INDEX idx_events_stream_id ON events(session_id, stream_id) WHERE stream_id IS NOT NULL;
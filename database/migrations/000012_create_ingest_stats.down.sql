@@ -0,0 +1,3 @@
+-- Rollback ingest stats
+
+DROP TABLE IF EXISTS ingest_stats;
@@ -0,0 +1,13 @@
+-- Hourly event counts per ingest stage (received, enqueued, persisted, ...), flushed
+-- from Redis counters, to audit that no events are silently lost
+
+CREATE TABLE ingest_stats (
+    project VARCHAR(100) NOT NULL,
+    bucket TIMESTAMPTZ NOT NULL,
+    stage VARCHAR(30) NOT NULL,
+    count BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (project, bucket, stage)
+);
+
+CREATE INDEX idx_ingest_stats_bucket ON ingest_stats(bucket);
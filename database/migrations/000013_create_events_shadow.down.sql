@@ -0,0 +1,3 @@
+-- Rollback events shadow table
+
+DROP TABLE IF EXISTS events_shadow;
@@ -0,0 +1,33 @@
+-- Shadow copy of events written by the candidate (COPY-based) insert path for a sample
+-- of sessions, so its output can be compared with the primary path before rollout.
+-- Rows are deleted once they match; mismatching rows are kept for inspection.
+
+CREATE TABLE events_shadow (
+    session_id UUID NOT NULL REFERENCES sessions(session_id) ON DELETE CASCADE,
+    timestamp TIMESTAMPTZ NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    target_element TEXT,
+    target_selector TEXT,
+    target_tag VARCHAR(50),
+    target_id VARCHAR(255),
+    target_class TEXT,
+    page_url TEXT NOT NULL,
+    viewport_x INTEGER,
+    viewport_y INTEGER,
+    screen_x INTEGER,
+    screen_y INTEGER,
+    scroll_x INTEGER,
+    scroll_y INTEGER,
+    input_value TEXT,
+    input_masked BOOLEAN DEFAULT FALSE,
+    key_pressed VARCHAR(50),
+    mouse_button INTEGER,
+    click_count INTEGER,
+    event_data JSONB DEFAULT '{}',
+    sdk VARCHAR(100),
+    stream_id VARCHAR(32),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_events_shadow_stream_id ON events_shadow(session_id, stream_id);
+CREATE INDEX idx_events_shadow_created_at ON events_shadow(created_at);
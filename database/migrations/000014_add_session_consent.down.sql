@@ -0,0 +1,4 @@
+-- Rollback session consent
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS consent_state;
+ALTER TABLE sessions DROP COLUMN IF EXISTS consent_string;
@@ -0,0 +1,5 @@
+-- Record the consent string (TCF v2 / GPP) a session was created under and the
+-- resulting collection state: granted, restricted or denied
+
+ALTER TABLE sessions ADD COLUMN consent_string TEXT;
+ALTER TABLE sessions ADD COLUMN consent_state VARCHAR(20);
@@ -0,0 +1,3 @@
+-- Rollback export jobs
+
+DROP TABLE IF EXISTS export_jobs;
@@ -0,0 +1,26 @@
+-- Asynchronous exports written to blob storage, optionally encrypted for a
+-- recipient-provided public key
+
+CREATE TABLE export_jobs (
+    job_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    kind VARCHAR(20) NOT NULL,
+    format VARCHAR(20) NOT NULL DEFAULT 'ndjson',
+    range_from TIMESTAMPTZ NOT NULL,
+    range_to TIMESTAMPTZ NOT NULL,
+    -- Field visibility of the requester, applied when the export is written
+    role VARCHAR(20) NOT NULL DEFAULT 'viewer',
+    -- none, age or gpg; the public key is kept so failed jobs can be retried
+    encryption VARCHAR(10) NOT NULL DEFAULT 'none',
+    public_key TEXT,
+    key_fingerprint TEXT,
+    object_key TEXT,
+    rows_exported BIGINT NOT NULL DEFAULT 0,
+    bytes_written BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_export_jobs_pending ON export_jobs(created_at) WHERE status = 'pending';
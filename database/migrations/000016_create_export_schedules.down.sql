@@ -0,0 +1,5 @@
+-- Rollback export schedules
+
+ALTER TABLE export_jobs DROP COLUMN IF EXISTS schedule_id;
+
+DROP TABLE IF EXISTS export_schedules;
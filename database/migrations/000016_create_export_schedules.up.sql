@@ -0,0 +1,32 @@
+-- Recurring exports: a cron schedule that queues an export job per run. The jobs it
+-- queued form the schedule's run history
+
+CREATE TABLE export_schedules (
+    schedule_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    cron VARCHAR(100) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    kind VARCHAR(20) NOT NULL,
+    format VARCHAR(20) NOT NULL DEFAULT 'ndjson',
+    -- Length of the exported range ending at each run; defaults to the interval between runs
+    window_seconds BIGINT,
+    role VARCHAR(20) NOT NULL DEFAULT 'viewer',
+    encryption VARCHAR(10) NOT NULL DEFAULT 'none',
+    public_key TEXT,
+    key_fingerprint TEXT,
+    -- Failed runs are POSTed here
+    notify_url TEXT,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMPTZ NOT NULL,
+    last_run_at TIMESTAMPTZ,
+    last_status VARCHAR(20),
+    consecutive_failures INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_export_schedules_due ON export_schedules(next_run_at) WHERE enabled;
+
+ALTER TABLE export_jobs ADD COLUMN schedule_id UUID REFERENCES export_schedules(schedule_id) ON DELETE SET NULL;
+
+CREATE INDEX idx_export_jobs_schedule ON export_jobs(schedule_id, created_at DESC) WHERE schedule_id IS NOT NULL;
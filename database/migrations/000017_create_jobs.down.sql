@@ -0,0 +1,3 @@
+-- Rollback generic jobs
+
+DROP TABLE IF EXISTS jobs;
@@ -0,0 +1,26 @@
+-- Generic background jobs run by the job runner off a Redis stream. The row is the
+-- source of truth; stream messages only wake a runner and are re-sent by the sweeper
+-- when lost
+
+CREATE TABLE jobs (
+    job_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    type VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    payload JSONB,
+    progress_done BIGINT NOT NULL DEFAULT 0,
+    progress_total BIGINT,
+    result JSONB,
+    error TEXT,
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 3,
+    run_after TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    queued_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    -- Bumped with every progress report; running jobs that stop updating are requeued
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_jobs_pending ON jobs(run_after) WHERE status = 'pending';
+CREATE INDEX idx_jobs_running ON jobs(updated_at) WHERE status = 'running';
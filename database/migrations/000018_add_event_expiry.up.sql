@@ -0,0 +1,6 @@
+-- Per-event expiry from SDK TTL hints (e.g. events with free text); the retention job
+-- deletes expired events ahead of the global retention policy
+
+ALTER TABLE events ADD COLUMN expires_at TIMESTAMPTZ;
+
+CREATE INDEX idx_events_expires_at ON events(expires_at) WHERE expires_at IS NOT NULL;
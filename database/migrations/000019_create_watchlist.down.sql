@@ -0,0 +1,4 @@
+-- Rollback watchlist
+
+DROP TABLE IF EXISTS watched_sessions;
+DROP TABLE IF EXISTS watch_subscriptions;
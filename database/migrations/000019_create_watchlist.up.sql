@@ -0,0 +1,28 @@
+-- Watchlist: operators subscribe to a user_id or fingerprint; new sessions of that
+-- identity are pinned in watched_sessions and announced to the subscription's webhook
+
+CREATE TABLE watch_subscriptions (
+    subscription_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    identity_type VARCHAR(20) NOT NULL CHECK (identity_type IN ('user_id', 'fingerprint')),
+    identity VARCHAR(255) NOT NULL,
+    label VARCHAR(255),
+    -- New sessions are POSTed here (Slack incoming webhooks get a Slack message)
+    notify_url TEXT,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (identity_type, identity)
+);
+
+CREATE TABLE watched_sessions (
+    subscription_id UUID NOT NULL REFERENCES watch_subscriptions(subscription_id) ON DELETE CASCADE,
+    session_id UUID NOT NULL REFERENCES sessions(session_id) ON DELETE CASCADE,
+    matched_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    notified_at TIMESTAMPTZ,
+    notify_attempts INT NOT NULL DEFAULT 0,
+    notify_error TEXT,
+    PRIMARY KEY (subscription_id, session_id)
+);
+
+CREATE INDEX idx_watched_sessions_matched ON watched_sessions(matched_at DESC);
+CREATE INDEX idx_watched_sessions_unnotified ON watched_sessions(matched_at) WHERE notified_at IS NULL;
@@ -0,0 +1,3 @@
+-- Rollback session links
+
+DROP TABLE IF EXISTS session_links;
@@ -0,0 +1,14 @@
+-- External references (support tickets, issues) attached to sessions by integrations,
+-- looked up in both directions
+
+CREATE TABLE session_links (
+    link_id BIGSERIAL PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES sessions(session_id) ON DELETE CASCADE,
+    link_type VARCHAR(20) NOT NULL CHECK (link_type IN ('zendesk', 'jira', 'intercom')),
+    external_id VARCHAR(255) NOT NULL,
+    url TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (session_id, link_type, external_id)
+);
+
+CREATE INDEX idx_session_links_external ON session_links(link_type, external_id);
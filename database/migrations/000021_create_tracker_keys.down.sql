@@ -0,0 +1,3 @@
+-- Rollback tracker keys
+
+DROP TABLE IF EXISTS tracker_keys;
@@ -0,0 +1,15 @@
+-- Tracker keys: public keys embedded in the tracker snippet, exchanged (with an origin
+-- check) for short-lived signed tokens that authenticate ingest requests
+
+CREATE TABLE tracker_keys (
+    key_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    public_key VARCHAR(64) NOT NULL UNIQUE,
+    -- Page origins allowed to exchange the key, as hosts or "*.example.com"; empty allows any
+    allowed_origins TEXT[] NOT NULL DEFAULT '{}',
+    -- Tokens issued before this are rejected (set when the key is rotated)
+    tokens_not_before TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+-- Rollback normalized coordinates
+
+ALTER TABLE events DROP COLUMN IF EXISTS norm_y;
+ALTER TABLE events DROP COLUMN IF EXISTS norm_x;
@@ -0,0 +1,5 @@
+-- Pointer coordinates normalized to [0,1] of the viewport at ingest, so heatmaps
+-- aggregate across devices with different resolutions
+
+ALTER TABLE events ADD COLUMN norm_x DOUBLE PRECISION;
+ALTER TABLE events ADD COLUMN norm_y DOUBLE PRECISION;
@@ -0,0 +1,3 @@
+-- Rollback session viewport history
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS viewport_history;
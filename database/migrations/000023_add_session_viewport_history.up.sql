@@ -0,0 +1,4 @@
+-- Viewport changes (from resize events) kept on the session, so replay players can
+-- resize their canvas without scanning every event
+
+ALTER TABLE sessions ADD COLUMN viewport_history JSONB NOT NULL DEFAULT '[]';
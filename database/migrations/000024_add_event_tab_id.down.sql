@@ -0,0 +1,3 @@
+-- Rollback event tab IDs
+
+ALTER TABLE events DROP COLUMN IF EXISTS tab_id;
@@ -0,0 +1,4 @@
+-- Browser tab an event came from, so interleaved events of a session opened in several
+-- tabs can be told apart
+
+ALTER TABLE events ADD COLUMN tab_id VARCHAR(64);
@@ -0,0 +1,3 @@
+-- Rollback event frame paths
+
+ALTER TABLE events DROP COLUMN IF EXISTS frame_path;
@@ -0,0 +1,4 @@
+-- Document an event came from, as a path of frames from the top document
+-- (e.g. "main>iframe#checkout"); NULL means the top document
+
+ALTER TABLE events ADD COLUMN frame_path VARCHAR(255);
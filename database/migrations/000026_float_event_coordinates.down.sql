@@ -0,0 +1,27 @@
+-- Rollback float coordinates; sub-pixel values are rounded to whole pixels
+
+ALTER TABLE events_shadow
+    ALTER COLUMN viewport_x TYPE INTEGER USING round(viewport_x)::INTEGER,
+    ALTER COLUMN viewport_y TYPE INTEGER USING round(viewport_y)::INTEGER,
+    ALTER COLUMN screen_x TYPE INTEGER USING round(screen_x)::INTEGER,
+    ALTER COLUMN screen_y TYPE INTEGER USING round(screen_y)::INTEGER,
+    ALTER COLUMN scroll_x TYPE INTEGER USING round(scroll_x)::INTEGER,
+    ALTER COLUMN scroll_y TYPE INTEGER USING round(scroll_y)::INTEGER;
+
+SELECT remove_compression_policy('events', if_exists => TRUE);
+SELECT decompress_chunk(c, if_compressed => TRUE) FROM show_chunks('events') c;
+ALTER TABLE events SET (timescaledb.compress = FALSE);
+
+ALTER TABLE events
+    ALTER COLUMN viewport_x TYPE INTEGER USING round(viewport_x)::INTEGER,
+    ALTER COLUMN viewport_y TYPE INTEGER USING round(viewport_y)::INTEGER,
+    ALTER COLUMN screen_x TYPE INTEGER USING round(screen_x)::INTEGER,
+    ALTER COLUMN screen_y TYPE INTEGER USING round(screen_y)::INTEGER,
+    ALTER COLUMN scroll_x TYPE INTEGER USING round(scroll_x)::INTEGER,
+    ALTER COLUMN scroll_y TYPE INTEGER USING round(scroll_y)::INTEGER;
+
+ALTER TABLE events SET (
+    timescaledb.compress,
+    timescaledb.compress_segmentby = 'session_id'
+);
+SELECT add_compression_policy('events', INTERVAL '7 days', if_not_exists => TRUE);
@@ -0,0 +1,32 @@
+-- Store event coordinates as DOUBLE PRECISION so sub-pixel positions from zoomed and
+-- high-DPI clients survive instead of being rounded to whole pixels. Existing rows
+-- keep their whole-pixel values.
+-- TimescaleDB cannot change column types while compression is enabled, so compressed
+-- chunks are decompressed first; the re-added policy compresses them again.
+
+SELECT remove_compression_policy('events', if_exists => TRUE);
+SELECT decompress_chunk(c, if_compressed => TRUE) FROM show_chunks('events') c;
+ALTER TABLE events SET (timescaledb.compress = FALSE);
+
+ALTER TABLE events
+    ALTER COLUMN viewport_x TYPE DOUBLE PRECISION,
+    ALTER COLUMN viewport_y TYPE DOUBLE PRECISION,
+    ALTER COLUMN screen_x TYPE DOUBLE PRECISION,
+    ALTER COLUMN screen_y TYPE DOUBLE PRECISION,
+    ALTER COLUMN scroll_x TYPE DOUBLE PRECISION,
+    ALTER COLUMN scroll_y TYPE DOUBLE PRECISION;
+
+ALTER TABLE events SET (
+    timescaledb.compress,
+    timescaledb.compress_segmentby = 'session_id'
+);
+SELECT add_compression_policy('events', INTERVAL '7 days', if_not_exists => TRUE);
+
+-- The shadow path must store the same types for its digests to match
+ALTER TABLE events_shadow
+    ALTER COLUMN viewport_x TYPE DOUBLE PRECISION,
+    ALTER COLUMN viewport_y TYPE DOUBLE PRECISION,
+    ALTER COLUMN screen_x TYPE DOUBLE PRECISION,
+    ALTER COLUMN screen_y TYPE DOUBLE PRECISION,
+    ALTER COLUMN scroll_x TYPE DOUBLE PRECISION,
+    ALTER COLUMN scroll_y TYPE DOUBLE PRECISION;
@@ -0,0 +1,5 @@
+-- Rollback tracker key throttles
+
+ALTER TABLE tracker_keys
+    DROP COLUMN IF EXISTS scroll_throttle_ms,
+    DROP COLUMN IF EXISTS mousemove_throttle_ms;
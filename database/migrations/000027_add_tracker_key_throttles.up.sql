@@ -0,0 +1,6 @@
+-- Per-key mousemove and scroll throttles advertised to SDKs by GET /api/v1/track/config.
+-- NULL uses the server default.
+
+ALTER TABLE tracker_keys
+    ADD COLUMN mousemove_throttle_ms INTEGER CHECK (mousemove_throttle_ms >= 0),
+    ADD COLUMN scroll_throttle_ms INTEGER CHECK (scroll_throttle_ms >= 0);
@@ -0,0 +1,4 @@
+-- Rollback URL grouping rules
+
+ALTER TABLE events DROP COLUMN IF EXISTS normalized_url;
+DROP TABLE IF EXISTS url_rules;
@@ -0,0 +1,22 @@
+-- URL grouping rules: applied at ingest to derive events.normalized_url, so page
+-- analytics count /order/123 and /order/456 as one page
+
+CREATE TABLE url_rules (
+    rule_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    -- Tracker key (project) the rule applies to; NULL applies it to every event
+    key_id UUID REFERENCES tracker_keys(key_id) ON DELETE CASCADE,
+    -- Rules run in ascending position, global rules before the key's own
+    position INT NOT NULL DEFAULT 0,
+    -- Query parameters removed from the URL; "*" removes the whole query string
+    strip_params TEXT[] NOT NULL DEFAULT '{}',
+    -- Regular expression (RE2 syntax) whose matches are replaced with replacement
+    pattern TEXT,
+    replacement TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (pattern IS NOT NULL OR cardinality(strip_params) > 0)
+);
+
+CREATE INDEX idx_url_rules_key ON url_rules(key_id, position);
+
+-- page_url after the rules; NULL when they leave it unchanged
+ALTER TABLE events ADD COLUMN normalized_url TEXT;
@@ -0,0 +1,4 @@
+-- Rollback alert rules
+
+DROP TABLE IF EXISTS alert_events;
+DROP TABLE IF EXISTS alert_rules;
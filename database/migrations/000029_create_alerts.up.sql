@@ -0,0 +1,41 @@
+-- Alert rules: a metric compared with a threshold over a trailing window, evaluated
+-- periodically; each change between ok and firing is kept in alert_events and announced
+-- to the rule's notify URL
+
+CREATE TABLE alert_rules (
+    rule_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    metric VARCHAR(40) NOT NULL
+        CHECK (metric IN ('queue_depth', 'error_rate', 'sessions_per_minute', 'goal_conversion')),
+    comparator VARCHAR(3) NOT NULL CHECK (comparator IN ('gt', 'gte', 'lt', 'lte')),
+    threshold DOUBLE PRECISION NOT NULL,
+    window_seconds INT NOT NULL CHECK (window_seconds > 0),
+    -- Page (normalized URL) whose visit counts as a conversion, for goal_conversion
+    goal_url TEXT,
+    -- Webhook or Slack incoming webhook; NULL uses ALERT_NOTIFY_URL
+    notify_url TEXT,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    state VARCHAR(10) NOT NULL DEFAULT 'ok' CHECK (state IN ('ok', 'firing')),
+    state_changed_at TIMESTAMPTZ,
+    -- NULL when the metric had no data (e.g. error_rate without events)
+    last_value DOUBLE PRECISION,
+    last_evaluated_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (metric <> 'goal_conversion' OR goal_url IS NOT NULL)
+);
+
+CREATE TABLE alert_events (
+    event_id BIGSERIAL PRIMARY KEY,
+    rule_id UUID NOT NULL REFERENCES alert_rules(rule_id) ON DELETE CASCADE,
+    -- State the rule entered: firing, or ok when it resolved
+    state VARCHAR(10) NOT NULL,
+    value DOUBLE PRECISION,
+    threshold DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    notified_at TIMESTAMPTZ,
+    notify_error TEXT
+);
+
+CREATE INDEX idx_alert_events_rule ON alert_events(rule_id, created_at DESC);
+CREATE INDEX idx_alert_events_created ON alert_events(created_at DESC);
@@ -0,0 +1,5 @@
+-- Rollback sandbox tracker keys
+
+DROP INDEX IF EXISTS idx_sessions_sandbox;
+ALTER TABLE sessions DROP COLUMN IF EXISTS sandbox;
+ALTER TABLE tracker_keys DROP COLUMN IF EXISTS sandbox;
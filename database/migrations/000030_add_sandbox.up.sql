@@ -0,0 +1,8 @@
+-- Sandbox tracker keys: sessions created with their tokens are flagged sandbox, left out
+-- of analytics and usage counts, and purged nightly
+
+ALTER TABLE tracker_keys ADD COLUMN sandbox BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE sessions ADD COLUMN sandbox BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Sandbox sessions are few; analytics exclude them and the purge finds them by start time
+CREATE INDEX idx_sessions_sandbox ON sessions(started_at) WHERE sandbox;
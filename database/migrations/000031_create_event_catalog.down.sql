@@ -0,0 +1,3 @@
+-- Rollback event catalog
+
+DROP TABLE IF EXISTS event_catalog;
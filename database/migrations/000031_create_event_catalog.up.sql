@@ -0,0 +1,13 @@
+-- Catalog of the event types and event_data keys observed per ingest project, with counts
+-- and first/last seen times, kept up to date by the event processor
+
+CREATE TABLE event_catalog (
+    project VARCHAR(100) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    -- '' for the event type itself, otherwise a top-level event_data key seen on it
+    data_key VARCHAR(255) NOT NULL DEFAULT '',
+    count BIGINT NOT NULL DEFAULT 0,
+    first_seen_at TIMESTAMPTZ NOT NULL,
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (project, event_type, data_key)
+);
@@ -0,0 +1,3 @@
+-- Rollback event schemas
+
+DROP TABLE IF EXISTS event_schemas;
@@ -0,0 +1,11 @@
+-- Declared types of event_data fields per project and event type, used to return the
+-- fields coerced to those types when events are read (schema on read)
+
+CREATE TABLE event_schemas (
+    project VARCHAR(100) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    field VARCHAR(255) NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('string', 'number', 'integer', 'boolean', 'timestamp')),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (project, event_type, field)
+);
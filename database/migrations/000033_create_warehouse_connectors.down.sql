@@ -0,0 +1,3 @@
+-- Rollback warehouse connectors
+
+DROP TABLE IF EXISTS warehouse_connectors;
@@ -0,0 +1,39 @@
+-- Warehouse connectors: scheduled incremental loads of one project's sessions and
+-- events into BigQuery or Snowflake. Each connector keeps its own keyset cursors, so
+-- a run continues after the last row it loaded.
+
+CREATE TABLE warehouse_connectors (
+    connector_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('bigquery', 'snowflake')),
+    -- Ingest stats project whose sessions are loaded: default or sandbox
+    project VARCHAR(100) NOT NULL DEFAULT 'default',
+    -- Destination settings (dataset, database, stage, ...); never holds secrets
+    config JSONB NOT NULL DEFAULT '{}',
+    -- Service account key (BigQuery) or PEM private key (Snowflake); never returned by the API
+    credentials TEXT NOT NULL,
+    cron VARCHAR(100) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    -- Rows newer than this are left for a later run, so late events are not skipped
+    delay_seconds INT NOT NULL DEFAULT 3600 CHECK (delay_seconds >= 0),
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMPTZ NOT NULL,
+    -- Set while an instance runs the connector; an expired lease may be claimed again
+    locked_until TIMESTAMPTZ,
+    -- Version of the destination table layout last applied
+    schema_version INT NOT NULL DEFAULT 0,
+    sessions_cursor_at TIMESTAMPTZ,
+    sessions_cursor_id UUID,
+    events_cursor_at TIMESTAMPTZ,
+    events_cursor_id BIGINT,
+    sessions_loaded BIGINT NOT NULL DEFAULT 0,
+    events_loaded BIGINT NOT NULL DEFAULT 0,
+    last_run_at TIMESTAMPTZ,
+    last_status VARCHAR(20),
+    last_error TEXT,
+    consecutive_failures INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_warehouse_connectors_due ON warehouse_connectors(next_run_at) WHERE enabled;
@@ -0,0 +1,3 @@
+-- Rollback replay assets
+
+DROP TABLE IF EXISTS replay_assets;
@@ -0,0 +1,19 @@
+-- Replay assets: copies of the stylesheets, images and fonts pages referenced when their
+-- screenshots were taken, kept in blob storage so replays still render after the site
+-- changes or the assets move behind auth. Each project's total size is capped; the
+-- least recently used assets are evicted first.
+
+CREATE TABLE replay_assets (
+    project VARCHAR(100) NOT NULL,
+    -- SHA-256 of the absolute URL, hex encoded
+    url_hash VARCHAR(64) NOT NULL,
+    url TEXT NOT NULL,
+    storage_key TEXT NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size_bytes BIGINT NOT NULL CHECK (size_bytes >= 0),
+    fetched_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (project, url_hash)
+);
+
+CREATE INDEX idx_replay_assets_lru ON replay_assets(project, last_used_at);
@@ -0,0 +1,18 @@
+-- API keys: secret keys for server-side callers and scripts. Ingest keys send events
+-- without exchanging a tracker token; read keys read the API with the viewer role.
+-- Only a hash of the secret is stored; it is shown once, on create and rotate.
+
+CREATE TABLE api_keys (
+    key_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    scope VARCHAR(16) NOT NULL CHECK (scope IN ('ingest', 'read')),
+    -- Leading characters of the secret, to tell keys apart in listings
+    key_prefix VARCHAR(16) NOT NULL,
+    -- SHA-256 of the secret, hex encoded
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    -- Updated at most once a minute per instance
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
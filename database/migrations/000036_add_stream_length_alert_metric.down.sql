@@ -0,0 +1,6 @@
+-- Rollback stream_length alert metric
+
+DELETE FROM alert_rules WHERE metric = 'stream_length';
+ALTER TABLE alert_rules DROP CONSTRAINT IF EXISTS alert_rules_metric_check;
+ALTER TABLE alert_rules ADD CONSTRAINT alert_rules_metric_check
+    CHECK (metric IN ('queue_depth', 'error_rate', 'sessions_per_minute', 'goal_conversion'));
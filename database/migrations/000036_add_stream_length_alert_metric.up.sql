@@ -0,0 +1,6 @@
+-- stream_length alerts on the number of entries kept in the event stream, for
+-- deployments that never trim it (QUEUE_TRIM_MODE=none)
+
+ALTER TABLE alert_rules DROP CONSTRAINT IF EXISTS alert_rules_metric_check;
+ALTER TABLE alert_rules ADD CONSTRAINT alert_rules_metric_check
+    CHECK (metric IN ('queue_depth', 'error_rate', 'sessions_per_minute', 'goal_conversion', 'stream_length'));
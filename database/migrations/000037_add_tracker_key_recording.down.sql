@@ -0,0 +1,5 @@
+-- Rollback tracker key recording settings
+
+ALTER TABLE tracker_keys
+    DROP COLUMN IF EXISTS mask_selectors,
+    DROP COLUMN IF EXISTS sample_rate;
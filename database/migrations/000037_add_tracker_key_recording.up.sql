@@ -0,0 +1,6 @@
+-- Recording settings baked into the tracker script served at /t/:public_key/tracker.js:
+-- the share of visitors recorded and CSS selectors of inputs to mask
+
+ALTER TABLE tracker_keys
+    ADD COLUMN sample_rate DOUBLE PRECISION NOT NULL DEFAULT 1 CHECK (sample_rate >= 0 AND sample_rate <= 1),
+    ADD COLUMN mask_selectors TEXT[] NOT NULL DEFAULT '{}';
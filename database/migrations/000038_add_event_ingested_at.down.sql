@@ -0,0 +1,15 @@
+-- Rollback event ingest times
+
+SELECT remove_compression_policy('events', if_exists => TRUE);
+SELECT decompress_chunk(c, if_compressed => TRUE) FROM show_chunks('events') c;
+ALTER TABLE events SET (timescaledb.compress = FALSE);
+
+DROP INDEX IF EXISTS idx_events_ingested_at;
+
+ALTER TABLE events DROP COLUMN IF EXISTS ingested_at;
+
+ALTER TABLE events SET (
+    timescaledb.compress,
+    timescaledb.compress_segmentby = 'session_id'
+);
+SELECT add_compression_policy('events', INTERVAL '7 days', if_not_exists => TRUE);
@@ -0,0 +1,22 @@
+-- When an event was stored, as opposed to its client timestamp, so jobs that pick up
+-- new events (issue clustering, warehouse sync) also see events that arrive late
+-- through the queue or are imported with historical timestamps.
+-- Existing rows take their client timestamp, so the first pass after migrating does
+-- not see the whole retention window as new. Compressed chunks cannot be updated, so
+-- they are decompressed first; the re-added policy compresses them again.
+
+SELECT remove_compression_policy('events', if_exists => TRUE);
+SELECT decompress_chunk(c, if_compressed => TRUE) FROM show_chunks('events') c;
+ALTER TABLE events SET (timescaledb.compress = FALSE);
+
+ALTER TABLE events ADD COLUMN ingested_at TIMESTAMPTZ;
+UPDATE events SET ingested_at = timestamp;
+ALTER TABLE events ALTER COLUMN ingested_at SET DEFAULT NOW();
+
+CREATE INDEX idx_events_ingested_at ON events(ingested_at);
+
+ALTER TABLE events SET (
+    timescaledb.compress,
+    timescaledb.compress_segmentby = 'session_id'
+);
+SELECT add_compression_policy('events', INTERVAL '7 days', if_not_exists => TRUE);
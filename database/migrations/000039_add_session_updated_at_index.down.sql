@@ -0,0 +1,3 @@
+-- Rollback the session updated_at index
+
+DROP INDEX IF EXISTS idx_sessions_updated_at;
@@ -0,0 +1,4 @@
+-- Warehouse connectors load sessions in (updated_at, session_id) order, so sessions
+-- still open when first loaded are loaded again as they change
+
+CREATE INDEX idx_sessions_updated_at ON sessions(updated_at, session_id);
@@ -0,0 +1,3 @@
+-- Rollback the screenshot storage_key index
+
+DROP INDEX IF EXISTS idx_screenshots_storage_key;
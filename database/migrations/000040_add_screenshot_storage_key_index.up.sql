@@ -0,0 +1,4 @@
+-- The blob cleanup job looks up listed screenshot objects by storage_key to find the
+-- ones no row references
+
+CREATE INDEX idx_screenshots_storage_key ON screenshots(storage_key) WHERE storage_key IS NOT NULL;
@@ -1,14 +1,29 @@
 import html2canvas from 'html2canvas';
 
+// Sent with every request so the backend can track SDK versions in the wild
+const SDK_ID = 'tracker-js/1.0.0';
+
 interface TrackerConfig {
   apiUrl: string;
   userId?: string;
   captureScreenshots?: boolean;
   screenshotQuality?: number;
   maskSensitiveInputs?: boolean;
+  // CSS selectors of further inputs whose values are always masked
+  maskSelectors?: string[];
+  // Share of visitors recorded, from 0 to 1; a visitor stays in or out across visits
+  sampleRate?: number;
   batchSize?: number;
   flushInterval?: number;
   mouseMoveThrottle?: number;
+  scrollThrottle?: number;
+  // How often an open tab tells the server the session is still being recorded; 0 disables
+  heartbeatInterval?: number;
+  // Tracker key public key; its throttles are fetched from /track/config on init, and
+  // it is exchanged at /track/token for the token sent with every request
+  publicKey?: string;
+  // Set when the tracker runs inside an embedded frame, e.g. 'main>iframe#checkout'
+  framePath?: string;
   debug?: boolean;
 }
 
@@ -32,25 +47,89 @@ interface EventData {
   key_pressed?: string;
   mouse_button?: number;
   click_count?: number;
+  tab_id?: string;
+  frame_path?: string;
   event_data?: Record<string, any>;
 }
 
+// Short random IDs for tabs and /track batches
+function randomId(): string {
+  return Math.random().toString(36).slice(2, 10) + Date.now().toString(36);
+}
+
+// localStorage keeps a visitor's sampling draw, so changing the rate only moves the
+// visitors between the old and the new rate in or out
+const SAMPLE_KEY = 'user-tracker-sample';
+
+function isSampled(rate: number): boolean {
+  if (rate >= 1) return true;
+  if (rate <= 0) return false;
+  try {
+    let draw = parseFloat(localStorage.getItem(SAMPLE_KEY) || '');
+    if (isNaN(draw)) {
+      draw = Math.random();
+      localStorage.setItem(SAMPLE_KEY, String(draw));
+    }
+    return draw < rate;
+  } catch (error) {
+    // Storage blocked: draw for this page load only
+    return Math.random() < rate;
+  }
+}
+
+// Tokens are exchanged again this long before they expire, so a request in flight
+// does not arrive with an expired one
+const TOKEN_REFRESH_MARGIN = 60 * 1000;
+
+// sessionStorage is per tab, so the ID survives reloads but differs between tabs
+const TAB_ID_KEY = 'user-tracker-tab-id';
+
+function getTabId(): string {
+  try {
+    let tabId = sessionStorage.getItem(TAB_ID_KEY);
+    if (!tabId) {
+      tabId = randomId();
+      sessionStorage.setItem(TAB_ID_KEY, tabId);
+    }
+    return tabId;
+  } catch (error) {
+    // Storage blocked (e.g. privacy mode): fall back to an ID for this page load
+    return randomId();
+  }
+}
+
 class UserTracker {
   private config: TrackerConfig & {
     captureScreenshots: boolean;
     screenshotQuality: number;
     maskSensitiveInputs: boolean;
+    maskSelectors: string[];
+    sampleRate: number;
     batchSize: number;
     flushInterval: number;
     mouseMoveThrottle: number;
+    scrollThrottle: number;
+    heartbeatInterval: number;
     debug: boolean;
   };
   private sessionId: string | null = null;
   private eventQueue: EventData[] = [];
+  // The batch being sent, kept with its ID until the server acknowledges it
+  private pendingBatch: { id: string; events: EventData[] } | null = null;
+  private flushing: boolean = false;
+  // Set from Retry-After when the server is backed up or draining; no batch is sent before it
+  private retryAt: number = 0;
   private flushTimer: number | null = null;
+  private heartbeatTimer: number | null = null;
   private lastMouseMove: number = 0;
+  private lastScroll: number = 0;
   private lastPageUrl: string = '';
   private isCapturingScreenshot: boolean = false;
+  private tabId: string = getTabId();
+  // Tracker token exchanged for the public key, and the exchange in flight if any
+  private token: string | null = null;
+  private tokenExpiresAt: number = 0;
+  private tokenRequest: Promise<void> | null = null;
 
   constructor() {
     this.config = {
@@ -59,9 +138,13 @@ class UserTracker {
       captureScreenshots: true,
       screenshotQuality: 0.8,
       maskSensitiveInputs: true,
+      maskSelectors: [],
+      sampleRate: 1,
       batchSize: 50,
       flushInterval: 5000,
       mouseMoveThrottle: 100,
+      scrollThrottle: 100,
+      heartbeatInterval: 15000,
       debug: false,
     };
   }
@@ -73,11 +156,35 @@ class UserTracker {
       console.error('[UserTracker] API URL is required');
       return;
     }
+    if (!isSampled(this.config.sampleRate)) {
+      this.log('Visitor not sampled, not recording');
+      return;
+    }
 
     this.log('Initializing tracker');
+    this.loadServerConfig();
     this.createSession();
   }
 
+  // The server drops mousemove and scroll events sent faster than its configured
+  // throttles, so never send faster than it asks
+  private async loadServerConfig(): Promise<void> {
+    try {
+      const query = this.config.publicKey ? `?public_key=${encodeURIComponent(this.config.publicKey)}` : '';
+      const response = await fetch(`${this.config.apiUrl}/track/config${query}`, {
+        headers: { 'X-Tracker-SDK': SDK_ID },
+      });
+      if (!response.ok) return;
+
+      const serverConfig = await response.json();
+      this.config.mouseMoveThrottle = Math.max(this.config.mouseMoveThrottle, serverConfig.mousemove_throttle_ms || 0);
+      this.config.scrollThrottle = Math.max(this.config.scrollThrottle, serverConfig.scroll_throttle_ms || 0);
+      this.log('Throttles:', this.config.mouseMoveThrottle, this.config.scrollThrottle);
+    } catch (error) {
+      this.log('Failed to load tracker config:', error);
+    }
+  }
+
   private async createSession(): Promise<void> {
     try {
       const sessionData = {
@@ -95,11 +202,7 @@ class UserTracker {
         os: this.getOS(),
       };
 
-      const response = await fetch(`${this.config.apiUrl}/sessions`, {
-        method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify(sessionData),
-      });
+      const response = await this.send('/sessions', JSON.stringify(sessionData));
 
       if (!response.ok) {
         throw new Error(`Failed to create session: ${response.statusText}`);
@@ -151,6 +254,9 @@ class UserTracker {
     // Start flush timer
     this.startFlushTimer();
 
+    // Keep the session marked live while the page stays open
+    this.startHeartbeat();
+
     this.log('Tracking started');
   }
 
@@ -180,7 +286,7 @@ class UserTracker {
     if (this.shouldIgnore(event.target as HTMLElement)) return;
 
     const target = event.target as HTMLInputElement;
-    const isSensitive = this.config.maskSensitiveInputs && this.isSensitiveInput(target);
+    const isSensitive = (this.config.maskSensitiveInputs && this.isSensitiveInput(target)) || this.matchesMaskSelector(target);
 
     this.queueEvent({
       timestamp: new Date(),
@@ -211,6 +317,10 @@ class UserTracker {
   }
 
   private handleScroll(): void {
+    const now = Date.now();
+    if (now - this.lastScroll < this.config.scrollThrottle) return;
+    this.lastScroll = now;
+
     this.queueEvent({
       timestamp: new Date(),
       event_type: 'scroll',
@@ -279,10 +389,30 @@ class UserTracker {
   }
 
   private handleBeforeUnload(): void {
+    if (this.heartbeatTimer !== null) {
+      window.clearInterval(this.heartbeatTimer);
+      this.heartbeatTimer = null;
+    }
     this.flush();
     this.endSession();
   }
 
+  // Stylesheets and images the page references, so the server can keep copies
+  // for replays after the site changes
+  private collectAssetUrls(): string[] {
+    const urls = new Set<string>();
+    document.querySelectorAll<HTMLLinkElement>('link[rel~="stylesheet"][href]').forEach((link) => {
+      urls.add(link.href);
+    });
+    document.querySelectorAll<HTMLImageElement>('img').forEach((img) => {
+      const src = img.currentSrc || img.src;
+      if (src && !src.startsWith('data:')) {
+        urls.add(src);
+      }
+    });
+    return Array.from(urls).slice(0, 100);
+  }
+
   private async captureScreenshot(): Promise<void> {
     if (this.isCapturingScreenshot || !this.sessionId) return;
 
@@ -298,18 +428,18 @@ class UserTracker {
 
       const imageData = canvas.toDataURL('image/jpeg', this.config.screenshotQuality);
 
-      await fetch(`${this.config.apiUrl}/track/screenshot`, {
-        method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({
+      await this.send(
+        '/track/screenshot',
+        JSON.stringify({
           session_id: this.sessionId,
           page_url: window.location.href,
           timestamp: new Date().toISOString(),
           image_data: imageData,
           width: canvas.width,
           height: canvas.height,
-        }),
-      });
+          assets: this.collectAssetUrls(),
+        })
+      );
 
       this.log('Screenshot captured');
     } catch (error) {
@@ -319,8 +449,77 @@ class UserTracker {
     }
   }
 
+  private requestHeaders(): Record<string, string> {
+    const headers: Record<string, string> = {
+      'Content-Type': 'application/json',
+      'X-Tracker-SDK': SDK_ID,
+    };
+    if (this.token) {
+      headers['X-Tracker-Token'] = this.token;
+    }
+    return headers;
+  }
+
+  // send POSTs body to path with a current tracker token. A 401 means the token was
+  // revoked or its key rotated, so the public key is exchanged again and the request
+  // sent once more.
+  private async send(path: string, body?: string): Promise<Response> {
+    await this.ensureToken();
+    const request = () =>
+      fetch(`${this.config.apiUrl}${path}`, {
+        method: 'POST',
+        headers: this.requestHeaders(),
+        body,
+      });
+
+    const response = await request();
+    if (response.status !== 401 || !this.token) {
+      return response;
+    }
+    this.token = null;
+    await this.ensureToken();
+    return this.token ? request() : response;
+  }
+
+  // ensureToken exchanges the public key for a tracker token when there is none or it
+  // is about to expire. Without a public key, or when the exchange fails, requests go
+  // out without a token, which servers that do not require one still accept.
+  private ensureToken(): Promise<void> {
+    if (!this.config.publicKey) return Promise.resolve();
+    if (this.token && Date.now() < this.tokenExpiresAt - TOKEN_REFRESH_MARGIN) return Promise.resolve();
+
+    if (!this.tokenRequest) {
+      // fetchToken never rejects
+      this.tokenRequest = this.fetchToken().then(() => {
+        this.tokenRequest = null;
+      });
+    }
+    return this.tokenRequest;
+  }
+
+  private async fetchToken(): Promise<void> {
+    try {
+      const response = await fetch(`${this.config.apiUrl}/track/token`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json', 'X-Tracker-SDK': SDK_ID },
+        body: JSON.stringify({ public_key: this.config.publicKey }),
+      });
+      if (!response.ok) {
+        throw new Error(`Failed to get tracker token: ${response.statusText}`);
+      }
+
+      const data = await response.json();
+      this.token = data.token;
+      this.tokenExpiresAt = new Date(data.expires_at).getTime();
+      this.log('Tracker token expires at', data.expires_at);
+    } catch (error) {
+      this.token = null;
+      this.log('Failed to get tracker token:', error);
+    }
+  }
+
   private queueEvent(event: EventData): void {
-    this.eventQueue.push(event);
+    this.eventQueue.push({ ...event, tab_id: this.tabId, frame_path: this.config.framePath });
 
     if (this.eventQueue.length >= this.config.batchSize) {
       this.flush();
@@ -328,30 +527,42 @@ class UserTracker {
   }
 
   private async flush(): Promise<void> {
-    if (this.eventQueue.length === 0 || !this.sessionId) return;
-
-    const events = [...this.eventQueue];
-    this.eventQueue = [];
+    if (this.flushing || !this.sessionId || Date.now() < this.retryAt) return;
+
+    // A batch that failed is sent again as is, under the same ID, in case the
+    // first attempt reached the server and only the response was lost
+    if (!this.pendingBatch) {
+      if (this.eventQueue.length === 0) return;
+      this.pendingBatch = { id: randomId(), events: [...this.eventQueue] };
+      this.eventQueue = [];
+    }
+    const batch = this.pendingBatch;
 
+    this.flushing = true;
     try {
-      const response = await fetch(`${this.config.apiUrl}/track`, {
-        method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({
+      const response = await this.send(
+        '/track',
+        JSON.stringify({
           session_id: this.sessionId,
-          events: events,
-        }),
-      });
-
+          batch_id: batch.id,
+          events: batch.events,
+        })
+      );
+
+      if (response.status === 429 || response.status === 503) {
+        const seconds = Number(response.headers.get('Retry-After'));
+        this.retryAt = Date.now() + (seconds > 0 ? seconds * 1000 : this.config.flushInterval);
+      }
       if (!response.ok) {
         throw new Error(`Failed to send events: ${response.statusText}`);
       }
 
-      this.log(`Flushed ${events.length} events`);
+      this.pendingBatch = null;
+      this.log(`Flushed ${batch.events.length} events`);
     } catch (error) {
       console.error('[UserTracker] Failed to send events:', error);
-      // Re-queue events on failure
-      this.eventQueue.unshift(...events);
+    } finally {
+      this.flushing = false;
     }
   }
 
@@ -361,6 +572,26 @@ class UserTracker {
     }, this.config.flushInterval);
   }
 
+  // Heartbeats go out whether or not the visitor interacts, so a quiet but open tab
+  // still shows as live; browsers slow them down in background tabs
+  private startHeartbeat(): void {
+    if (this.config.heartbeatInterval <= 0) return;
+
+    this.heartbeatTimer = window.setInterval(() => {
+      this.sendHeartbeat();
+    }, this.config.heartbeatInterval);
+  }
+
+  private async sendHeartbeat(): Promise<void> {
+    if (!this.sessionId) return;
+
+    try {
+      await this.send(`/sessions/${this.sessionId}/heartbeat`);
+    } catch (error) {
+      this.log('Failed to send heartbeat:', error);
+    }
+  }
+
   private async endSession(): Promise<void> {
     if (!this.sessionId) return;
 
@@ -394,6 +625,17 @@ class UserTracker {
     );
   }
 
+  private matchesMaskSelector(element: HTMLElement): boolean {
+    return this.config.maskSelectors.some((selector) => {
+      try {
+        return element.matches(selector);
+      } catch (error) {
+        // An invalid selector masks nothing
+        return false;
+      }
+    });
+  }
+
   private getSelector(element: HTMLElement): string {
     if (element.id) return `#${element.id}`;
 